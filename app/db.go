@@ -151,11 +151,17 @@ func createTables() error {
 	err = db.AutoMigrate(
 		&models.DatabaseTask{},
 		&models.DatabaseBackup{},
+		&models.DatabaseBinlog{},
+		&models.DatabaseBackupSchedule{},
 		&models.DatabaseOperationLock{},
 	)
 	if err != nil {
 		return err
 	}
+	err = db.AutoMigrate(&models.RemoteBackupTarget{}, &models.RemoteBackupTransfer{})
+	if err != nil {
+		return err
+	}
 	if err := migrateStoredCredentials(); err != nil {
 		return err
 	}
@@ -177,6 +183,12 @@ func createTables() error {
 		&models.WebsiteSetting{},
 		&models.WebsiteTrafficDaily{},
 		&models.WebsiteTrafficCursor{},
+		&models.WebsiteTrafficHourly{},
+		&models.WebsiteTrafficTop{},
+		&models.WebsiteBackendHealth{},
+		&models.WebsiteRelease{},
+		&models.WebsiteAssignment{},
+		&models.WebsiteStaging{},
 	)
 	if err != nil {
 		return err
@@ -185,6 +197,7 @@ func createTables() error {
 		&models.WebsiteTask{},
 		&models.WebsiteBackup{},
 		&models.WebsiteOperationLock{},
+		&models.WebsiteDeploySource{},
 	)
 	if err != nil {
 		return err
@@ -194,6 +207,7 @@ func createTables() error {
 		&models.ManagedCertificate{},
 		&models.CertificateBinding{},
 		&models.DNSAccount{},
+		&models.ACMEAccount{},
 		&models.CertificateTask{},
 		&models.CertificateOperationLock{},
 	)
@@ -275,9 +289,13 @@ func createTables() error {
 	}
 	err = db.AutoMigrate(
 		&models.MetricSample{},
+		&models.MetricSeriesSample{},
+		&models.MetricRollup{},
 		&models.MonitorRule{},
 		&models.MonitorAlertState{},
+		&models.MonitorResourceAlertState{},
 		&models.MonitorAlertEvent{},
+		&models.MonitorEscalationPolicy{},
 		&models.ComponentHealthState{},
 		&models.NotificationChannel{},
 		&models.NotificationDelivery{},
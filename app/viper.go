@@ -73,17 +73,22 @@ system:
     softwareTaskCleanupSchedule: "30 3 * * *"
     databaseBackupRetentionDays: 30
     databaseBackupCleanupSchedule: "0 4 * * *"
+    databaseBinlogArchiveSchedule: "*/5 * * * *"
     websiteBackupRetentionDays: 30
     websiteBackupCleanupSchedule: "15 4 * * *"
     websiteBackupMaxBytes: 21474836480
     websiteBackupMaxFiles: 200000
+    remoteBackupSyncSchedule: "*/15 * * * *"
     auditRetentionDays: 365
     auditCleanupSchedule: "45 4 * * *"
     auditExportMaxRows: 10000
     monitorSampleSchedule: "*/1 * * * *"
     monitorRetentionDays: 30
     monitorAlertRetentionDays: 365
+    monitorFiveMinuteRetentionDays: 90
+    monitorHourlyRetentionDays: 730
     monitorCleanupSchedule: "20 4 * * *"
+    metricsToken: ""
     runtimeLogRetentionDays: 30
     runtimeLogCleanupSchedule: "10 5 * * *"
     cronExecutionRetentionDays: 30
@@ -159,17 +164,22 @@ func LoadConfig(path ...string) (*viper.Viper, error) {
 	v.SetDefault("system.softwareTaskCleanupSchedule", "30 3 * * *")
 	v.SetDefault("system.databaseBackupRetentionDays", 30)
 	v.SetDefault("system.databaseBackupCleanupSchedule", "0 4 * * *")
+	v.SetDefault("system.databaseBinlogArchiveSchedule", "*/5 * * * *")
 	v.SetDefault("system.websiteBackupRetentionDays", 30)
 	v.SetDefault("system.websiteBackupCleanupSchedule", "15 4 * * *")
 	v.SetDefault("system.websiteBackupMaxBytes", int64(20<<30))
 	v.SetDefault("system.websiteBackupMaxFiles", 200000)
+	v.SetDefault("system.remoteBackupSyncSchedule", "*/15 * * * *")
 	v.SetDefault("system.auditRetentionDays", 365)
 	v.SetDefault("system.auditCleanupSchedule", "45 4 * * *")
 	v.SetDefault("system.auditExportMaxRows", 10000)
 	v.SetDefault("system.monitorSampleSchedule", "*/1 * * * *")
 	v.SetDefault("system.monitorRetentionDays", 30)
 	v.SetDefault("system.monitorAlertRetentionDays", 365)
+	v.SetDefault("system.monitorFiveMinuteRetentionDays", 90)
+	v.SetDefault("system.monitorHourlyRetentionDays", 730)
 	v.SetDefault("system.monitorCleanupSchedule", "20 4 * * *")
+	v.SetDefault("system.metricsToken", "")
 	v.SetDefault("system.runtimeLogRetentionDays", 30)
 	v.SetDefault("system.runtimeLogCleanupSchedule", "10 5 * * *")
 	v.SetDefault("system.cronExecutionRetentionDays", 30)
@@ -241,17 +251,22 @@ func LoadConfig(path ...string) (*viper.Viper, error) {
 		"system.softwareTaskCleanupSchedule":      "ONEINSTACK_SYSTEM_SOFTWARE_TASK_CLEANUP_SCHEDULE",
 		"system.databaseBackupRetentionDays":      "ONEINSTACK_SYSTEM_DATABASE_BACKUP_RETENTION_DAYS",
 		"system.databaseBackupCleanupSchedule":    "ONEINSTACK_SYSTEM_DATABASE_BACKUP_CLEANUP_SCHEDULE",
+		"system.databaseBinlogArchiveSchedule":    "ONEINSTACK_SYSTEM_DATABASE_BINLOG_ARCHIVE_SCHEDULE",
 		"system.websiteBackupRetentionDays":       "ONEINSTACK_SYSTEM_WEBSITE_BACKUP_RETENTION_DAYS",
 		"system.websiteBackupCleanupSchedule":     "ONEINSTACK_SYSTEM_WEBSITE_BACKUP_CLEANUP_SCHEDULE",
 		"system.websiteBackupMaxBytes":            "ONEINSTACK_SYSTEM_WEBSITE_BACKUP_MAX_BYTES",
 		"system.websiteBackupMaxFiles":            "ONEINSTACK_SYSTEM_WEBSITE_BACKUP_MAX_FILES",
+		"system.remoteBackupSyncSchedule":         "ONEINSTACK_SYSTEM_REMOTE_BACKUP_SYNC_SCHEDULE",
 		"system.auditRetentionDays":               "ONEINSTACK_SYSTEM_AUDIT_RETENTION_DAYS",
 		"system.auditCleanupSchedule":             "ONEINSTACK_SYSTEM_AUDIT_CLEANUP_SCHEDULE",
 		"system.auditExportMaxRows":               "ONEINSTACK_SYSTEM_AUDIT_EXPORT_MAX_ROWS",
 		"system.monitorSampleSchedule":            "ONEINSTACK_SYSTEM_MONITOR_SAMPLE_SCHEDULE",
 		"system.monitorRetentionDays":             "ONEINSTACK_SYSTEM_MONITOR_RETENTION_DAYS",
 		"system.monitorAlertRetentionDays":        "ONEINSTACK_SYSTEM_MONITOR_ALERT_RETENTION_DAYS",
+		"system.monitorFiveMinuteRetentionDays":   "ONEINSTACK_SYSTEM_MONITOR_FIVE_MINUTE_RETENTION_DAYS",
+		"system.monitorHourlyRetentionDays":       "ONEINSTACK_SYSTEM_MONITOR_HOURLY_RETENTION_DAYS",
 		"system.monitorCleanupSchedule":           "ONEINSTACK_SYSTEM_MONITOR_CLEANUP_SCHEDULE",
+		"system.metricsToken":                     "ONEINSTACK_SYSTEM_METRICS_TOKEN",
 		"system.runtimeLogRetentionDays":          "ONEINSTACK_SYSTEM_RUNTIME_LOG_RETENTION_DAYS",
 		"system.runtimeLogCleanupSchedule":        "ONEINSTACK_SYSTEM_RUNTIME_LOG_CLEANUP_SCHEDULE",
 		"system.cronExecutionRetentionDays":       "ONEINSTACK_SYSTEM_CRON_EXECUTION_RETENTION_DAYS",
@@ -308,6 +323,12 @@ func LoadConfig(path ...string) (*viper.Viper, error) {
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("read config file: %w", err)
 	}
+	// Configs written before the rollup tiers existed may keep raw samples
+	// longer than the tier defaults; unset tiers then follow the raw window.
+	fiveMinuteDays := max(v.GetInt("system.monitorRetentionDays"), 90)
+	v.SetDefault("system.monitorFiveMinuteRetentionDays", fiveMinuteDays)
+	v.SetDefault("system.monitorHourlyRetentionDays",
+		max(v.GetInt("system.monitorFiveMinuteRetentionDays"), 730))
 	if encoded := strings.TrimSpace(os.Getenv("ONEINSTACK_SCRIPT_CENTER_TRUSTED_KEYS")); encoded != "" {
 		keys := map[string]string{}
 		if err := json.Unmarshal([]byte(encoded), &keys); err != nil {
@@ -693,6 +714,9 @@ func validateSystemConfig() error {
 	if strings.TrimSpace(system.DatabaseBackupCleanupSchedule) == "" {
 		return fmt.Errorf("validate config: system.databaseBackupCleanupSchedule cannot be empty")
 	}
+	if strings.TrimSpace(system.DatabaseBinlogArchiveSchedule) == "" {
+		return fmt.Errorf("validate config: system.databaseBinlogArchiveSchedule cannot be empty")
+	}
 	if system.WebsiteBackupRetentionDays < 1 || system.WebsiteBackupRetentionDays > 3650 {
 		return fmt.Errorf("validate config: system.websiteBackupRetentionDays must be between 1 and 3650")
 	}
@@ -705,6 +729,9 @@ func validateSystemConfig() error {
 	if system.WebsiteBackupMaxFiles < 1 || system.WebsiteBackupMaxFiles > 1000000 {
 		return fmt.Errorf("validate config: system.websiteBackupMaxFiles must be between 1 and 1000000")
 	}
+	if strings.TrimSpace(system.RemoteBackupSyncSchedule) == "" {
+		return fmt.Errorf("validate config: system.remoteBackupSyncSchedule cannot be empty")
+	}
 	if system.AuditRetentionDays < 30 || system.AuditRetentionDays > 3650 {
 		return fmt.Errorf("validate config: system.auditRetentionDays must be between 30 and 3650")
 	}
@@ -724,6 +751,18 @@ func validateSystemConfig() error {
 	if system.MonitorAlertRetentionDays < 1 || system.MonitorAlertRetentionDays > 3650 {
 		return fmt.Errorf("validate config: system.monitorAlertRetentionDays must be between 1 and 3650")
 	}
+	if system.MonitorFiveMinRetentionDays < system.MonitorRetentionDays ||
+		system.MonitorFiveMinRetentionDays > 3650 {
+		return fmt.Errorf("validate config: system.monitorFiveMinuteRetentionDays must be between monitorRetentionDays and 3650")
+	}
+	if system.MonitorHourlyRetentionDays < system.MonitorFiveMinRetentionDays ||
+		system.MonitorHourlyRetentionDays > 3650 {
+		return fmt.Errorf("validate config: system.monitorHourlyRetentionDays must be between monitorFiveMinuteRetentionDays and 3650")
+	}
+	if token := system.MetricsToken; token != "" &&
+		(len(token) < 32 || len(token) > 256 || strings.ContainsAny(token, " \t\r\n")) {
+		return fmt.Errorf("validate config: system.metricsToken must be empty or 32 to 256 characters without whitespace")
+	}
 	if system.RuntimeLogRetentionDays < 1 || system.RuntimeLogRetentionDays > 3650 {
 		return fmt.Errorf("validate config: system.runtimeLogRetentionDays must be between 1 and 3650")
 	}
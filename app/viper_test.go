@@ -47,7 +47,8 @@ func TestLoadConfigCreatesSecureDefault(t *testing.T) {
 		t.Fatalf("unexpected software task retention policy: %+v", ONE_CONFIG.System)
 	}
 	if ONE_CONFIG.System.DatabaseBackupRetentionDays != 30 ||
-		ONE_CONFIG.System.DatabaseBackupCleanupSchedule != "0 4 * * *" {
+		ONE_CONFIG.System.DatabaseBackupCleanupSchedule != "0 4 * * *" ||
+		ONE_CONFIG.System.DatabaseBinlogArchiveSchedule != "*/5 * * * *" {
 		t.Fatalf("unexpected database backup retention policy: %+v", ONE_CONFIG.System)
 	}
 	if ONE_CONFIG.System.WebsiteBackupRetentionDays != 30 ||
@@ -56,6 +57,9 @@ func TestLoadConfigCreatesSecureDefault(t *testing.T) {
 		ONE_CONFIG.System.WebsiteBackupMaxFiles != 200000 {
 		t.Fatalf("unexpected website backup retention policy: %+v", ONE_CONFIG.System)
 	}
+	if ONE_CONFIG.System.RemoteBackupSyncSchedule != "*/15 * * * *" {
+		t.Fatalf("unexpected remote backup sync schedule: %+v", ONE_CONFIG.System)
+	}
 	if ONE_CONFIG.System.AuditRetentionDays != 365 ||
 		ONE_CONFIG.System.AuditCleanupSchedule != "45 4 * * *" ||
 		ONE_CONFIG.System.AuditExportMaxRows != 10000 {
@@ -216,3 +220,33 @@ func TestLoadConfigSupportsEnvironmentOverrides(t *testing.T) {
 		t.Fatalf("unexpected script center environment config: %+v", ONE_CONFIG.ScriptCenter)
 	}
 }
+
+func TestLoadConfigExtendsUnsetMonitorTiersForLongRawRetention(t *testing.T) {
+	originalConfig := ONE_CONFIG
+	originalViper := ONE_VIP
+	t.Cleanup(func() {
+		ONE_CONFIG = originalConfig
+		ONE_VIP = originalViper
+	})
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	legacyConfig := strings.Replace(defaultConfig, "    monitorRetentionDays: 30\n", "    monitorRetentionDays: 180\n", 1)
+	legacyConfig = strings.Replace(legacyConfig, "    monitorFiveMinuteRetentionDays: 90\n", "", 1)
+	legacyConfig = strings.Replace(legacyConfig, "    monitorHourlyRetentionDays: 730\n", "", 1)
+	if strings.Contains(legacyConfig, "monitorFiveMinuteRetentionDays") ||
+		!strings.Contains(legacyConfig, "monitorRetentionDays: 180") {
+		t.Fatal("legacy config fixture was not prepared")
+	}
+	if err := os.WriteFile(configPath, []byte(legacyConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if ONE_CONFIG.System.MonitorRetentionDays != 180 ||
+		ONE_CONFIG.System.MonitorFiveMinRetentionDays != 180 ||
+		ONE_CONFIG.System.MonitorHourlyRetentionDays != 730 {
+		t.Fatalf("unexpected monitor retention tiers: %+v", ONE_CONFIG.System)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"oneinstack/app"
 	"oneinstack/internal/buildinfo"
 	"oneinstack/internal/i18n"
+	"oneinstack/internal/models"
 	approvalservice "oneinstack/internal/services/approval"
 	"oneinstack/internal/services/audit"
 	bastionservice "oneinstack/internal/services/bastion"
@@ -19,7 +20,9 @@ import (
 	"oneinstack/internal/services/filemanager"
 	runtimelog "oneinstack/internal/services/log"
 	"oneinstack/internal/services/monitoring"
+	"oneinstack/internal/services/panelbackup"
 	"oneinstack/internal/services/panelupdate"
+	"oneinstack/internal/services/remotebackup"
 	safeservice "oneinstack/internal/services/safe"
 	"oneinstack/internal/services/software"
 	"oneinstack/internal/services/softwaretask"
@@ -414,7 +417,7 @@ func startServer() error {
 	monitorManager, err := monitoring.NewManager(
 		app.DB(),
 		monitoring.NewSystemCollector(),
-		monitoring.NewWebhookSender(),
+		monitoring.NewChannelSender(),
 		app.ONE_CONFIG.System.MonitorRetentionDays,
 		app.ONE_CONFIG.System.MonitorAlertRetentionDays,
 		app.ONE_CONFIG.System.MonitorSampleSchedule,
@@ -423,9 +426,19 @@ func startServer() error {
 	if err != nil {
 		return fmt.Errorf("initialize monitoring service: %w", err)
 	}
+	if err := monitorManager.SetRollupRetention(
+		app.ONE_CONFIG.System.MonitorFiveMinRetentionDays,
+		app.ONE_CONFIG.System.MonitorHourlyRetentionDays,
+	); err != nil {
+		return fmt.Errorf("initialize monitoring service: %w", err)
+	}
 	monitorManager.SetServiceHealthCollector(
 		software.NewComponentHealthCollector(app.DB()),
 	)
+	monitorManager.SetCertificateCollector(certificate.NewAlertCollector(app.DB()))
+	monitorManager.AddSeriesCollector(monitoring.NewMountCollector())
+	monitorManager.AddSeriesCollector(monitoring.NewServiceProcessCollector())
+	monitorManager.AddSeriesCollector(monitoring.NewWebsiteTrafficCollector(app.DB()))
 	monitoring.ConfigureDefault(monitorManager)
 	monitorManager.Start()
 	defer func() {
@@ -470,6 +483,7 @@ func startServer() error {
 	if err != nil {
 		return fmt.Errorf("initialize software task manager: %w", err)
 	}
+	monitoring.RegisterTaskQueue("software", taskManager.QueueDepth)
 	taskCleaner, err := softwaretask.NewCleaner(
 		taskManager,
 		app.ONE_CONFIG.System.SoftwareTaskRetentionDays,
@@ -499,6 +513,7 @@ func startServer() error {
 	if err != nil {
 		return fmt.Errorf("initialize database task manager: %w", err)
 	}
+	monitoring.RegisterTaskQueue("database", databaseManager.QueueDepth)
 	databaseCleaner, err := databasetask.NewCleaner(
 		databaseManager,
 		app.ONE_CONFIG.System.DatabaseBackupRetentionDays,
@@ -515,6 +530,34 @@ func startServer() error {
 			log.Printf("stop database backup cleaner: %v", stopErr)
 		}
 	}()
+	binlogArchiver, err := databasetask.NewBinlogArchiver(
+		databaseManager,
+		app.ONE_CONFIG.System.DatabaseBinlogArchiveSchedule,
+	)
+	if err != nil {
+		return err
+	}
+	binlogArchiver.Start()
+	defer func() {
+		stopContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if stopErr := binlogArchiver.Stop(stopContext); stopErr != nil {
+			log.Printf("stop database binlog archiver: %v", stopErr)
+		}
+	}()
+
+	backupScheduler, err := databasetask.NewBackupScheduler(databaseManager)
+	if err != nil {
+		return err
+	}
+	backupScheduler.Start()
+	defer func() {
+		stopContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if stopErr := backupScheduler.Stop(stopContext); stopErr != nil {
+			log.Printf("stop database backup scheduler: %v", stopErr)
+		}
+	}()
 
 	websiteTaskManager, err := websiteHandler.DefaultWebsiteTaskManager()
 	if err != nil {
@@ -523,6 +566,7 @@ func startServer() error {
 		}
 		log.Printf("website task service disabled until Nginx is installed: %v", err)
 	} else {
+		monitoring.RegisterTaskQueue("website", websiteTaskManager.QueueDepth)
 		websiteBackupCleaner, err := websitetask.NewCleaner(
 			websiteTaskManager,
 			app.ONE_CONFIG.System.WebsiteBackupRetentionDays,
@@ -547,6 +591,48 @@ func startServer() error {
 			}
 		}()
 	}
+	remoteWorkRoot := strings.TrimSpace(os.Getenv("ONEINSTACK_REMOTE_BACKUP_WORK_DIR"))
+	if remoteWorkRoot == "" {
+		remoteWorkRoot = filepath.Join(app.GetBasePath(), "backups", "remote")
+	}
+	remoteBackupManager := remotebackup.NewManager(app.DB(), remoteWorkRoot)
+	remoteBackupManager.RegisterSource(models.RemoteBackupKindDatabase, remotebackup.NewDatabaseSource(databaseManager))
+	if websiteTaskManager != nil {
+		remoteBackupManager.RegisterSource(models.RemoteBackupKindWebsite, remotebackup.NewWebsiteSource(websiteTaskManager))
+	}
+	panelBackupManager, err := panelbackup.NewApplicationManager(app.DB())
+	if err != nil {
+		return fmt.Errorf("initialize panel backup manager: %w", err)
+	}
+	remoteBackupManager.RegisterSource(models.RemoteBackupKindPanel, remotebackup.NewPanelSource(panelBackupManager))
+	if err := remoteBackupManager.Start(); err != nil {
+		return fmt.Errorf("initialize remote backup manager: %w", err)
+	}
+	remotebackup.ConfigureDefault(remoteBackupManager)
+	defer func() {
+		stopContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if stopErr := remoteBackupManager.Stop(stopContext); stopErr != nil {
+			log.Printf("stop remote backup manager: %v", stopErr)
+		}
+		remotebackup.ClearDefault(remoteBackupManager)
+	}()
+	remoteBackupSyncer, err := remotebackup.NewSyncer(
+		remoteBackupManager,
+		app.ONE_CONFIG.System.RemoteBackupSyncSchedule,
+	)
+	if err != nil {
+		return err
+	}
+	remoteBackupSyncer.Start()
+	defer func() {
+		stopContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if stopErr := remoteBackupSyncer.Stop(stopContext); stopErr != nil {
+			log.Printf("stop remote backup syncer: %v", stopErr)
+		}
+	}()
+
 	websiteLifecycleManager, err := websiteService.NewDefaultLifecycleManager(time.Minute)
 	if err != nil {
 		if !errors.Is(err, websiteService.ErrNginxUnavailable) {
@@ -29,17 +29,22 @@ type System struct {
 	SoftwareTaskCleanupSchedule   string   `mapstructure:"softwareTaskCleanupSchedule" json:"softwareTaskCleanupSchedule" yaml:"softwareTaskCleanupSchedule"`
 	DatabaseBackupRetentionDays   int      `mapstructure:"databaseBackupRetentionDays" json:"databaseBackupRetentionDays" yaml:"databaseBackupRetentionDays"`
 	DatabaseBackupCleanupSchedule string   `mapstructure:"databaseBackupCleanupSchedule" json:"databaseBackupCleanupSchedule" yaml:"databaseBackupCleanupSchedule"`
+	DatabaseBinlogArchiveSchedule string   `mapstructure:"databaseBinlogArchiveSchedule" json:"databaseBinlogArchiveSchedule" yaml:"databaseBinlogArchiveSchedule"`
 	WebsiteBackupRetentionDays    int      `mapstructure:"websiteBackupRetentionDays" json:"websiteBackupRetentionDays" yaml:"websiteBackupRetentionDays"`
 	WebsiteBackupCleanupSchedule  string   `mapstructure:"websiteBackupCleanupSchedule" json:"websiteBackupCleanupSchedule" yaml:"websiteBackupCleanupSchedule"`
 	WebsiteBackupMaxBytes         int64    `mapstructure:"websiteBackupMaxBytes" json:"websiteBackupMaxBytes" yaml:"websiteBackupMaxBytes"`
 	WebsiteBackupMaxFiles         int      `mapstructure:"websiteBackupMaxFiles" json:"websiteBackupMaxFiles" yaml:"websiteBackupMaxFiles"`
+	RemoteBackupSyncSchedule      string   `mapstructure:"remoteBackupSyncSchedule" json:"remoteBackupSyncSchedule" yaml:"remoteBackupSyncSchedule"`
 	AuditRetentionDays            int      `mapstructure:"auditRetentionDays" json:"auditRetentionDays" yaml:"auditRetentionDays"`
 	AuditCleanupSchedule          string   `mapstructure:"auditCleanupSchedule" json:"auditCleanupSchedule" yaml:"auditCleanupSchedule"`
 	AuditExportMaxRows            int      `mapstructure:"auditExportMaxRows" json:"auditExportMaxRows" yaml:"auditExportMaxRows"`
 	MonitorSampleSchedule         string   `mapstructure:"monitorSampleSchedule" json:"monitorSampleSchedule" yaml:"monitorSampleSchedule"`
 	MonitorRetentionDays          int      `mapstructure:"monitorRetentionDays" json:"monitorRetentionDays" yaml:"monitorRetentionDays"`
 	MonitorAlertRetentionDays     int      `mapstructure:"monitorAlertRetentionDays" json:"monitorAlertRetentionDays" yaml:"monitorAlertRetentionDays"`
+	MonitorFiveMinRetentionDays   int      `mapstructure:"monitorFiveMinuteRetentionDays" json:"monitorFiveMinuteRetentionDays" yaml:"monitorFiveMinuteRetentionDays"`
+	MonitorHourlyRetentionDays    int      `mapstructure:"monitorHourlyRetentionDays" json:"monitorHourlyRetentionDays" yaml:"monitorHourlyRetentionDays"`
 	MonitorCleanupSchedule        string   `mapstructure:"monitorCleanupSchedule" json:"monitorCleanupSchedule" yaml:"monitorCleanupSchedule"`
+	MetricsToken                  string   `mapstructure:"metricsToken" json:"-" yaml:"metricsToken"`
 	RuntimeLogRetentionDays       int      `mapstructure:"runtimeLogRetentionDays" json:"runtimeLogRetentionDays" yaml:"runtimeLogRetentionDays"`
 	RuntimeLogCleanupSchedule     string   `mapstructure:"runtimeLogCleanupSchedule" json:"runtimeLogCleanupSchedule" yaml:"runtimeLogCleanupSchedule"`
 	CronExecutionRetentionDays    int      `mapstructure:"cronExecutionRetentionDays" json:"cronExecutionRetentionDays" yaml:"cronExecutionRetentionDays"`
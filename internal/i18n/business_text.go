@@ -27,6 +27,9 @@ func LocalizeBusinessText(locale, value string) string {
 	if strings.HasPrefix(value, "正在验证域名 ") {
 		return "Validating domain " + strings.TrimSpace(strings.TrimPrefix(value, "正在验证域名 "))
 	}
+	if strings.HasPrefix(value, "正在等待 DNS 记录生效 ") {
+		return "Waiting for DNS record " + strings.TrimSpace(strings.TrimPrefix(value, "正在等待 DNS 记录生效 ")) + " to propagate"
+	}
 	for zh, en := range softwareOperationNames {
 		switch value {
 		case "任务已进入" + zh + "队列":
@@ -38,6 +38,9 @@ type Certificate struct {
 	Email           string     `json:"email" gorm:"size:254;not null"`
 	Domains         string     `json:"domains" gorm:"type:text;not null"`
 	DirectoryURL    string     `json:"-" gorm:"size:1024;not null"`
+	ChallengeType   string     `json:"challengeType" gorm:"size:16;not null;default:'http-01'"`
+	DNSAccountID    string     `json:"dnsAccountId,omitempty" gorm:"column:dns_account_id;size:36;index"`
+	ACMEAccountID   string     `json:"acmeAccountId,omitempty" gorm:"column:acme_account_id;size:36;index"`
 	CertificatePath string     `json:"-" gorm:"size:1024;not null"`
 	PrivateKeyPath  string     `json:"-" gorm:"size:1024;not null"`
 	SerialNumber    string     `json:"serialNumber" gorm:"size:128"`
@@ -51,6 +54,7 @@ type Certificate struct {
 	LastRenewAt     *time.Time `json:"lastRenewAt,omitempty"`
 	NextRenewAt     *time.Time `json:"nextRenewAt,omitempty" gorm:"index"`
 	LastError       string     `json:"lastError,omitempty" gorm:"size:1024"`
+	RenewalFailures int        `json:"renewalFailures" gorm:"not null;default:0"`
 	CreatedAt       time.Time  `json:"createdAt"`
 	UpdatedAt       time.Time  `json:"updatedAt"`
 }
@@ -58,22 +62,24 @@ type Certificate struct {
 // ManagedCertificate is the canonical certificate resource. WebsiteID on the
 // legacy Certificate model remains as a deployment compatibility projection.
 type ManagedCertificate struct {
-	ID              string    `json:"id" gorm:"primaryKey;size:36"`
-	Provider        string    `json:"provider" gorm:"size:32;not null"`
-	Domains         string    `json:"domains" gorm:"type:text;not null"`
-	CertificatePath string    `json:"-" gorm:"size:1024;not null"`
-	PrivateKeyPath  string    `json:"-" gorm:"size:1024;not null"`
-	SerialNumber    string    `json:"serialNumber" gorm:"size:128"`
-	Issuer          string    `json:"issuer" gorm:"size:512"`
-	Algorithm       string    `json:"algorithm" gorm:"size:32;not null"`
-	Status          string    `json:"status" gorm:"size:32;not null;index"`
-	AutoRenew       bool      `json:"autoRenew" gorm:"not null;default:false"`
-	RenewBeforeDays int       `json:"renewBeforeDays" gorm:"not null;default:30"`
-	NotBefore       time.Time `json:"notBefore"`
-	NotAfter        time.Time `json:"notAfter" gorm:"index"`
-	Remark          string    `json:"remark" gorm:"size:512"`
-	CreatedAt       time.Time `json:"createdAt"`
-	UpdatedAt       time.Time `json:"updatedAt"`
+	ID              string     `json:"id" gorm:"primaryKey;size:36"`
+	Provider        string     `json:"provider" gorm:"size:32;not null"`
+	Domains         string     `json:"domains" gorm:"type:text;not null"`
+	CertificatePath string     `json:"-" gorm:"size:1024;not null"`
+	PrivateKeyPath  string     `json:"-" gorm:"size:1024;not null"`
+	SerialNumber    string     `json:"serialNumber" gorm:"size:128"`
+	Issuer          string     `json:"issuer" gorm:"size:512"`
+	Algorithm       string     `json:"algorithm" gorm:"size:32;not null"`
+	Status          string     `json:"status" gorm:"size:32;not null;index"`
+	AutoRenew       bool       `json:"autoRenew" gorm:"not null;default:false"`
+	RenewBeforeDays int        `json:"renewBeforeDays" gorm:"not null;default:30"`
+	NotBefore       time.Time  `json:"notBefore"`
+	NotAfter        time.Time  `json:"notAfter" gorm:"index"`
+	Remark          string     `json:"remark" gorm:"size:512"`
+	OCSPStatus      string     `json:"ocspStatus,omitempty" gorm:"column:ocsp_status;size:16"`
+	OCSPCheckedAt   *time.Time `json:"ocspCheckedAt,omitempty" gorm:"column:ocsp_checked_at"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
 }
 
 func (ManagedCertificate) TableName() string { return "managed_certificate" }
@@ -106,6 +112,25 @@ type DNSAccount struct {
 
 func (DNSAccount) TableName() string { return "certificate_dns_account" }
 
+// ACMEAccount is a named CA profile. The EAB HMAC key is encrypted at rest and
+// never serialized; the ACME account key itself is kept on disk.
+type ACMEAccount struct {
+	ID            string    `json:"id" gorm:"primaryKey;size:36"`
+	Name          string    `json:"name" gorm:"size:128;not null"`
+	Provider      string    `json:"provider" gorm:"size:32;not null;index"`
+	DirectoryURL  string    `json:"directoryUrl" gorm:"size:1024;not null"`
+	Email         string    `json:"email" gorm:"size:254"`
+	EABKeyID      string    `json:"eabKeyId,omitempty" gorm:"column:eab_key_id;size:256"`
+	EABHMACKey    string    `json:"-" gorm:"column:eab_hmac_key;type:text"`
+	EABConfigured bool      `json:"eabConfigured" gorm:"column:eab_configured;not null;default:false"`
+	CABundle      string    `json:"caBundle,omitempty" gorm:"column:ca_bundle;type:text"`
+	Enabled       bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func (ACMEAccount) TableName() string { return "certificate_acme_account" }
+
 func (Certificate) TableName() string {
 	return "certificate"
 }
@@ -122,6 +147,9 @@ type CertificateTask struct {
 	Email           string     `json:"email" gorm:"size:254;not null"`
 	Domains         string     `json:"domains" gorm:"type:text;not null"`
 	DirectoryURL    string     `json:"-" gorm:"size:1024;not null"`
+	ChallengeType   string     `json:"challengeType,omitempty" gorm:"size:16"`
+	DNSAccountID    string     `json:"dnsAccountId,omitempty" gorm:"column:dns_account_id;size:36"`
+	ACMEAccountID   string     `json:"acmeAccountId,omitempty" gorm:"column:acme_account_id;size:36"`
 	AutoRenew       bool       `json:"autoRenew" gorm:"not null;default:true"`
 	RenewBeforeDays int        `json:"renewBeforeDays" gorm:"not null;default:30"`
 	ForceHTTPS      bool       `json:"forceHttps" gorm:"column:force_https;not null;default:false"`
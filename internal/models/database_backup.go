@@ -15,6 +15,8 @@ const (
 const (
 	DatabaseBackupSourceManual     = "manual"
 	DatabaseBackupSourcePreRestore = "pre_restore"
+	DatabaseBackupSourceScheduled  = "scheduled"
+	DatabaseBackupSourceRemote     = "remote"
 )
 
 // DatabaseTask stores the durable state of a MySQL backup or restore
@@ -27,6 +29,9 @@ type DatabaseTask struct {
 	SourceBackupID  string     `json:"sourceBackupId,omitempty" gorm:"size:36;index"`
 	ResultBackupID  string     `json:"resultBackupId,omitempty" gorm:"size:36;index"`
 	SafetyBackupID  string     `json:"safetyBackupId,omitempty" gorm:"size:36;index"`
+	Source          string     `json:"source,omitempty" gorm:"size:24"`
+	StopAt          *time.Time `json:"stopAt,omitempty"`
+	StopGTID        string     `json:"stopGtid,omitempty" gorm:"size:128"`
 	Status          string     `json:"status" gorm:"size:32;not null;index:idx_database_task_status_created"`
 	Progress        int        `json:"progress" gorm:"not null;default:0"`
 	Message         string     `json:"message" gorm:"size:512"`
@@ -48,22 +53,70 @@ func (DatabaseTask) TableName() string {
 
 // DatabaseBackup is the verified artifact metadata. FilePath never leaves the
 // backend; downloads resolve it again against the configured backup root.
+// BinlogFile and BinlogPosition are the binary log coordinates a MySQL dump is
+// consistent with; they are empty when binary logging was off.
 type DatabaseBackup struct {
-	ID           string    `json:"id" gorm:"primaryKey;size:36"`
-	LibraryID    int64     `json:"libraryId" gorm:"not null;index:idx_database_backup_library_created"`
-	ConnectionID int64     `json:"connectionId" gorm:"not null"`
-	DatabaseName string    `json:"databaseName" gorm:"size:64;not null"`
-	Source       string    `json:"source" gorm:"size:24;not null"`
-	FileName     string    `json:"fileName" gorm:"size:255;not null"`
+	ID             string    `json:"id" gorm:"primaryKey;size:36"`
+	LibraryID      int64     `json:"libraryId" gorm:"not null;index:idx_database_backup_library_created"`
+	ConnectionID   int64     `json:"connectionId" gorm:"not null"`
+	DatabaseName   string    `json:"databaseName" gorm:"size:64;not null"`
+	Source         string    `json:"source" gorm:"size:24;not null"`
+	FileName       string    `json:"fileName" gorm:"size:255;not null"`
+	FilePath       string    `json:"-" gorm:"size:1024;not null"`
+	SizeBytes      int64     `json:"sizeBytes" gorm:"not null"`
+	SHA256         string    `json:"sha256" gorm:"size:64;not null"`
+	BinlogFile     string    `json:"binlogFile,omitempty" gorm:"size:255"`
+	BinlogPosition int64     `json:"binlogPosition,omitempty"`
+	CreatedBy      int64     `json:"createdBy" gorm:"not null"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"index:idx_database_backup_library_created,priority:2"`
+}
+
+func (DatabaseBackup) TableName() string {
+	return "database_backup"
+}
+
+// DatabaseBinlog is a binary log archived from a MySQL connection. Logs are
+// shared by all databases of the connection. Every event written before
+// CoveredUntil is contained in this log or an earlier one.
+type DatabaseBinlog struct {
+	ID           int64     `json:"id" gorm:"primaryKey"`
+	ConnectionID int64     `json:"connectionId" gorm:"not null;uniqueIndex:idx_database_binlog_file"`
+	FileName     string    `json:"fileName" gorm:"size:255;not null;uniqueIndex:idx_database_binlog_file"`
 	FilePath     string    `json:"-" gorm:"size:1024;not null"`
 	SizeBytes    int64     `json:"sizeBytes" gorm:"not null"`
 	SHA256       string    `json:"sha256" gorm:"size:64;not null"`
-	CreatedBy    int64     `json:"createdBy" gorm:"not null"`
-	CreatedAt    time.Time `json:"createdAt" gorm:"index:idx_database_backup_library_created,priority:2"`
+	CoveredUntil time.Time `json:"coveredUntil" gorm:"index"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
-func (DatabaseBackup) TableName() string {
-	return "database_backup"
+func (DatabaseBinlog) TableName() string {
+	return "database_binlog"
+}
+
+// DatabaseBackupSchedule creates backups of one library on a cron schedule.
+// Scheduled backups are pruned with grandfather-father-son retention: the
+// newest backup of each of the last KeepDaily days, KeepWeekly ISO weeks and
+// KeepMonthly months is kept. Scheduled tasks are requested as UpdatedBy.
+type DatabaseBackupSchedule struct {
+	ID              int64      `json:"id" gorm:"primaryKey"`
+	LibraryID       int64      `json:"libraryId" gorm:"not null;uniqueIndex"`
+	Enabled         bool       `json:"enabled" gorm:"not null;default:false"`
+	Schedule        string     `json:"schedule" gorm:"size:128;not null"`
+	KeepDaily       int        `json:"keepDaily" gorm:"not null;default:0"`
+	KeepWeekly      int        `json:"keepWeekly" gorm:"not null;default:0"`
+	KeepMonthly     int        `json:"keepMonthly" gorm:"not null;default:0"`
+	NotifyOnFailure bool       `json:"notifyOnFailure" gorm:"not null;default:false"`
+	UpdatedBy       int64      `json:"updatedBy" gorm:"not null"`
+	LastRunAt       *time.Time `json:"lastRunAt,omitempty"`
+	LastTaskID      string     `json:"lastTaskId,omitempty" gorm:"size:36"`
+	LastStatus      string     `json:"lastStatus,omitempty" gorm:"size:32"`
+	LastError       string     `json:"lastError,omitempty" gorm:"size:1024"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func (DatabaseBackupSchedule) TableName() string {
+	return "database_backup_schedule"
 }
 
 type DatabaseOperationLock struct {
@@ -27,10 +27,39 @@ type MetricSample struct {
 	DiskWriteBPS      float64   `json:"diskWriteBps"`
 }
 
+// MetricRollup aggregates raw MetricSample values of one history key into a
+// fixed bucket. Resolution is the bucket width in seconds.
+type MetricRollup struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	Resolution  int64     `gorm:"not null;uniqueIndex:idx_metric_rollup_bucket,priority:1" json:"resolution"`
+	BucketStart time.Time `gorm:"not null;index;uniqueIndex:idx_metric_rollup_bucket,priority:2" json:"bucketStart"`
+	Metric      string    `gorm:"size:32;not null;uniqueIndex:idx_metric_rollup_bucket,priority:3" json:"metric"`
+	Min         float64   `json:"min"`
+	Max         float64   `json:"max"`
+	Avg         float64   `json:"avg"`
+	Count       int64     `gorm:"not null" json:"count"`
+}
+
+// MetricSeriesSample is one labeled point of a per-resource metric, such as
+// the request rate of a website or the usage of one mountpoint.
+type MetricSeriesSample struct {
+	ID           uint64    `gorm:"primaryKey" json:"id"`
+	CapturedAt   time.Time `gorm:"index;index:idx_metric_series_lookup,priority:3;not null" json:"capturedAt"`
+	Metric       string    `gorm:"size:32;index:idx_metric_series_lookup,priority:1;not null" json:"metric"`
+	ResourceType string    `gorm:"size:32;not null" json:"resourceType"`
+	ResourceID   string    `gorm:"size:64;index:idx_metric_series_lookup,priority:2;not null" json:"resourceId"`
+	Label        string    `gorm:"size:120" json:"label"`
+	Value        float64   `json:"value"`
+}
+
 type MonitorRule struct {
 	ID                 uint       `gorm:"primaryKey" json:"id"`
 	Name               string     `gorm:"size:120;not null" json:"name"`
 	Metric             string     `gorm:"size:32;index;not null" json:"metric"`
+	ResourceID         string     `gorm:"size:64" json:"resourceId,omitempty"`
+	Expression         string     `gorm:"type:text" json:"expression,omitempty"`
+	Schedule           string     `gorm:"size:64" json:"schedule,omitempty"`
+	EscalationPolicyID *uint      `gorm:"index" json:"escalationPolicyId,omitempty"`
 	Operator           string     `gorm:"size:8;not null" json:"operator"`
 	Threshold          float64    `json:"threshold"`
 	RecoveryThreshold  float64    `json:"recoveryThreshold"`
@@ -59,6 +88,22 @@ type MonitorAlertState struct {
 	UpdatedAt           time.Time  `json:"updatedAt"`
 }
 
+// MonitorResourceAlertState tracks a rule separately for every resource it
+// applies to, such as each managed certificate for certificate metrics.
+type MonitorResourceAlertState struct {
+	RuleID              uint       `gorm:"primaryKey" json:"ruleId"`
+	ResourceType        string     `gorm:"primaryKey;size:32" json:"resourceType"`
+	ResourceID          string     `gorm:"primaryKey;size:64" json:"resourceId"`
+	State               string     `gorm:"size:16;index;not null" json:"state"`
+	ConsecutiveBreaches int        `gorm:"not null" json:"consecutiveBreaches"`
+	LastValue           float64    `json:"lastValue"`
+	PendingSince        *time.Time `json:"pendingSince,omitempty"`
+	FiringSince         *time.Time `json:"firingSince,omitempty"`
+	LastEvaluatedAt     time.Time  `gorm:"index" json:"lastEvaluatedAt"`
+	LastNotifiedAt      *time.Time `json:"lastNotifiedAt,omitempty"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
 type MonitorAlertEvent struct {
 	ID           uint64     `gorm:"primaryKey" json:"id"`
 	RuleID       uint       `gorm:"index;not null" json:"ruleId"`
@@ -74,6 +119,30 @@ type MonitorAlertEvent struct {
 	OccurredAt   time.Time  `gorm:"index;not null" json:"occurredAt"`
 	ResolvedAt   *time.Time `gorm:"index" json:"resolvedAt,omitempty"`
 	Message      string     `gorm:"size:255" json:"message"`
+	// Acknowledgement and escalation progress are tracked on triggered events.
+	AcknowledgedAt     *time.Time `gorm:"index" json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy     string     `gorm:"size:64" json:"acknowledgedBy,omitempty"`
+	EscalationPolicyID *uint      `gorm:"index" json:"escalationPolicyId,omitempty"`
+	EscalationLevel    int        `gorm:"not null;default:0" json:"escalationLevel"`
+	NextEscalationAt   *time.Time `gorm:"index" json:"nextEscalationAt,omitempty"`
+}
+
+// MonitorEscalationPolicy routes the notifications of the rules that use it.
+// Steps are notified in order while a triggered alert stays unacknowledged.
+type MonitorEscalationPolicy struct {
+	ID        uint                    `gorm:"primaryKey" json:"id"`
+	Name      string                  `gorm:"size:120;uniqueIndex;not null" json:"name"`
+	Steps     []MonitorEscalationStep `gorm:"serializer:json;type:text;not null" json:"steps"`
+	CreatedAt time.Time               `json:"createdAt"`
+	UpdatedAt time.Time               `json:"updatedAt"`
+}
+
+// MonitorEscalationStep notifies its channels DelayMinutes after the alert
+// triggered. A step with an on-call Schedule is skipped outside its window.
+type MonitorEscalationStep struct {
+	DelayMinutes int      `json:"delayMinutes"`
+	ChannelIDs   []string `json:"channelIds"`
+	Schedule     string   `json:"schedule,omitempty"`
 }
 
 // ComponentHealthState stores the durable service health state independently
@@ -113,6 +182,7 @@ type NotificationChannel struct {
 	ConfigEncrypted string    `gorm:"type:text;not null" json:"-"`
 	TargetHint      string    `gorm:"size:160" json:"targetHint"`
 	HasSecret       bool      `json:"hasSecret"`
+	Template        string    `gorm:"type:text" json:"template,omitempty"`
 	CreatedAt       time.Time `json:"createdAt"`
 	UpdatedAt       time.Time `json:"updatedAt"`
 }
@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+const (
+	RemoteBackupDriverS3     = "s3"
+	RemoteBackupDriverSFTP   = "sftp"
+	RemoteBackupDriverWebDAV = "webdav"
+)
+
+const (
+	RemoteBackupKindDatabase = "database"
+	RemoteBackupKindWebsite  = "website"
+	RemoteBackupKindPanel    = "panel"
+)
+
+const (
+	RemoteBackupTransferUpload   = "upload"
+	RemoteBackupTransferDownload = "download"
+)
+
+const (
+	RemoteBackupTransferQueued    = "queued"
+	RemoteBackupTransferRunning   = "running"
+	RemoteBackupTransferSucceeded = "succeeded"
+	RemoteBackupTransferFailed    = "failed"
+)
+
+// RemoteBackupTarget is an off-site location backups are copied to.
+// Endpoint is the S3 or WebDAV base URL, or host:port for SFTP. Username is
+// the S3 access key or the login name. SecretEncrypted holds the S3 secret
+// key, WebDAV password, or SFTP password or private key; it never leaves the
+// backend. HostKey pins the SHA256 fingerprint of an SFTP server.
+type RemoteBackupTarget struct {
+	ID              int64      `json:"id" gorm:"primaryKey"`
+	Name            string     `json:"name" gorm:"size:120;not null;uniqueIndex"`
+	Driver          string     `json:"driver" gorm:"size:16;not null"`
+	Endpoint        string     `json:"endpoint" gorm:"size:512;not null"`
+	Region          string     `json:"region,omitempty" gorm:"size:64"`
+	Bucket          string     `json:"bucket,omitempty" gorm:"size:255"`
+	Username        string     `json:"username,omitempty" gorm:"size:255"`
+	HostKey         string     `json:"hostKey,omitempty" gorm:"size:128"`
+	BasePath        string     `json:"basePath" gorm:"size:512"`
+	SecretEncrypted string     `json:"-" gorm:"type:text"`
+	HasSecret       bool       `json:"hasSecret"`
+	Kinds           string     `json:"kinds" gorm:"size:64"`
+	AutoUpload      bool       `json:"autoUpload" gorm:"not null;default:false"`
+	RetentionDays   int        `json:"retentionDays" gorm:"not null;default:0"`
+	Enabled         bool       `json:"enabled" gorm:"not null;default:false"`
+	LastSyncAt      *time.Time `json:"lastSyncAt,omitempty"`
+	LastError       string     `json:"lastError,omitempty" gorm:"size:1024"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func (RemoteBackupTarget) TableName() string {
+	return "remote_backup_target"
+}
+
+// RemoteBackupTransfer uploads a local backup to a target or downloads a
+// remote copy back into the local backup store. ResumeToken is the driver's
+// resume state, such as an S3 multipart upload id. PassphraseEncrypted is
+// only set while a panel backup download waits to be imported.
+type RemoteBackupTransfer struct {
+	ID                  string     `json:"id" gorm:"primaryKey;size:36"`
+	TargetID            int64      `json:"targetId" gorm:"not null;index:idx_remote_backup_transfer_target"`
+	Operation           string     `json:"operation" gorm:"size:16;not null"`
+	Kind                string     `json:"kind" gorm:"size:16;not null;index:idx_remote_backup_transfer_target,priority:2"`
+	BackupID            string     `json:"backupId,omitempty" gorm:"size:64;index:idx_remote_backup_transfer_target,priority:3"`
+	ObjectKey           string     `json:"objectKey" gorm:"size:1024;not null"`
+	SizeBytes           int64      `json:"sizeBytes"`
+	SHA256              string     `json:"sha256" gorm:"size:64"`
+	Status              string     `json:"status" gorm:"size:16;not null;index"`
+	Transferred         int64      `json:"transferred"`
+	Attempts            int        `json:"attempts" gorm:"not null;default:0"`
+	ResumeToken         string     `json:"-" gorm:"size:1024"`
+	ImportLibraryID     int64      `json:"importLibraryId,omitempty"`
+	ImportWebsiteID     int64      `json:"importWebsiteId,omitempty"`
+	PassphraseEncrypted string     `json:"-" gorm:"type:text"`
+	Error               string     `json:"error,omitempty" gorm:"size:1024"`
+	RequestedBy         int64      `json:"requestedBy" gorm:"not null"`
+	CreatedAt           time.Time  `json:"createdAt" gorm:"index"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	FinishedAt          *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (RemoteBackupTransfer) TableName() string {
+	return "remote_backup_transfer"
+}
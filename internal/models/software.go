@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -11,6 +12,22 @@ import (
 // selected database implementation.
 var DatabaseSoftwareKeys = []string{"db", "mysql", "mariadb", "percona"}
 
+// SideBySideSoftwareKeys are the catalog keys whose versions install next to
+// each other. Installing another version adds an installation instead of
+// upgrading the installed one, and uninstalling removes a single version.
+var SideBySideSoftwareKeys = []string{"php"}
+
+// SideBySideSoftware reports whether key belongs to SideBySideSoftwareKeys.
+func SideBySideSoftware(key string) bool {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, candidate := range SideBySideSoftwareKeys {
+		if key == candidate {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	Soft_Status_Default = 0
 	Soft_Status_Ing     = 1
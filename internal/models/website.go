@@ -23,6 +23,8 @@ type Website struct {
 	Enabled              bool       `json:"enabled" gorm:"not null;default:true;index"`
 	ExpiresAt            *time.Time `json:"expires_at,omitempty" gorm:"index"`
 	DisabledReason       string     `json:"disabled_reason,omitempty" gorm:"size:32"`
+	SystemUser           string     `json:"system_user,omitempty" gorm:"size:32"`
+	Isolated             bool       `json:"isolated,omitempty" gorm:"-"`
 	TodayTrafficBytes    int64      `json:"today_traffic_bytes" gorm:"-"`
 	TodayRequests        int64      `json:"today_requests" gorm:"-"`
 	SSLEnabled           bool       `json:"ssl_enabled" gorm:"-"`
@@ -59,6 +61,94 @@ func (WebsiteTrafficCursor) TableName() string {
 	return "website_traffic_cursor"
 }
 
+// WebsiteTrafficHourly stores hourly access-log totals. LatencyBuckets is a
+// JSON array of request counts per request_time bucket, so percentiles can be
+// merged across hours without keeping individual samples.
+type WebsiteTrafficHourly struct {
+	ID             int64     `json:"-"`
+	WebsiteID      int64     `json:"website_id" gorm:"not null;uniqueIndex:idx_website_traffic_hour"`
+	Hour           string    `json:"hour" gorm:"size:13;not null;uniqueIndex:idx_website_traffic_hour"`
+	RequestCount   int64     `json:"request_count" gorm:"not null;default:0"`
+	BytesSent      int64     `json:"bytes_sent" gorm:"not null;default:0"`
+	Status2xx      int64     `json:"status_2xx" gorm:"column:status_2xx;not null;default:0"`
+	Status3xx      int64     `json:"status_3xx" gorm:"column:status_3xx;not null;default:0"`
+	Status4xx      int64     `json:"status_4xx" gorm:"column:status_4xx;not null;default:0"`
+	Status5xx      int64     `json:"status_5xx" gorm:"column:status_5xx;not null;default:0"`
+	BotRequests    int64     `json:"bot_requests" gorm:"not null;default:0"`
+	LatencyBuckets string    `json:"-" gorm:"type:text"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (WebsiteTrafficHourly) TableName() string {
+	return "website_traffic_hourly"
+}
+
+// WebsiteTrafficTop counts requests per value of one access-log dimension
+// (url, status, client_ip, referer, agent) and day. Each collection pass only
+// merges its busiest values, so the long tail is dropped instead of stored.
+type WebsiteTrafficTop struct {
+	ID           int64     `json:"-"`
+	WebsiteID    int64     `json:"website_id" gorm:"not null;uniqueIndex:idx_website_traffic_top"`
+	Day          string    `json:"day" gorm:"size:10;not null;uniqueIndex:idx_website_traffic_top"`
+	Dimension    string    `json:"dimension" gorm:"size:16;not null;uniqueIndex:idx_website_traffic_top"`
+	Value        string    `json:"value" gorm:"size:255;not null;uniqueIndex:idx_website_traffic_top"`
+	RequestCount int64     `json:"request_count" gorm:"not null;default:0"`
+	BytesSent    int64     `json:"bytes_sent" gorm:"not null;default:0"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (WebsiteTrafficTop) TableName() string {
+	return "website_traffic_top"
+}
+
+// WebsiteBackendHealth is the active health-check state of one upstream pool
+// server. Ejected is set while the server is rendered as down.
+type WebsiteBackendHealth struct {
+	WebsiteID           int64      `json:"website_id" gorm:"primaryKey"`
+	Pool                string     `json:"pool" gorm:"primaryKey;size:32"`
+	Address             string     `json:"address" gorm:"primaryKey;size:512"`
+	Healthy             bool       `json:"healthy" gorm:"not null"`
+	Ejected             bool       `json:"ejected" gorm:"not null;default:false"`
+	ConsecutiveFailures int        `json:"consecutive_failures" gorm:"not null;default:0"`
+	ConsecutivePasses   int        `json:"consecutive_passes" gorm:"not null;default:0"`
+	LastError           string     `json:"last_error" gorm:"size:512"`
+	LastCheckedAt       time.Time  `json:"last_checked_at"`
+	DownSince           *time.Time `json:"down_since,omitempty"`
+}
+
+func (WebsiteBackendHealth) TableName() string {
+	return "website_backend_health"
+}
+
+// WebsiteRelease is one release directory of a site below
+// <root>/releases/<name>. Active marks the release the current link points to.
+type WebsiteRelease struct {
+	ID          int64      `json:"id"`
+	WebsiteID   int64      `json:"website_id" gorm:"not null;uniqueIndex:idx_website_release_name"`
+	Name        string     `json:"name" gorm:"size:64;not null;uniqueIndex:idx_website_release_name"`
+	Note        string     `json:"note" gorm:"size:255"`
+	Active      bool       `json:"active" gorm:"not null;default:false"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+}
+
+func (WebsiteRelease) TableName() string {
+	return "website_release"
+}
+
+// WebsiteAssignment binds a panel user to a site. Users with assignments and
+// without the full file root see only the trees of their assigned sites.
+type WebsiteAssignment struct {
+	ID        int64     `json:"id"`
+	WebsiteID int64     `json:"website_id" gorm:"not null;uniqueIndex:idx_website_assignment_user"`
+	UserID    int64     `json:"user_id" gorm:"not null;uniqueIndex:idx_website_assignment_user;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (WebsiteAssignment) TableName() string {
+	return "website_assignment"
+}
+
 func (m *Website) BeforeCreate(tx *gorm.DB) (err error) {
 	m.CreateTime = time.Now()
 	return
@@ -6,6 +6,9 @@ const (
 	WebsiteTaskOperationBackup  = "backup"
 	WebsiteTaskOperationRestore = "restore"
 	WebsiteTaskOperationDelete  = "delete"
+	WebsiteTaskOperationDeploy  = "deploy"
+	WebsiteTaskOperationClone   = "clone"
+	WebsiteTaskOperationPush    = "push"
 )
 
 const (
@@ -22,34 +25,44 @@ const (
 	WebsiteBackupSourceManual     = "manual"
 	WebsiteBackupSourcePreRestore = "pre_restore"
 	WebsiteBackupSourcePreDelete  = "pre_delete"
+	WebsiteBackupSourcePrePush    = "pre_push"
+	WebsiteBackupSourceRemote     = "remote"
 )
 
-// WebsiteTask stores the durable state of website backup, restore, and safe
-// deletion. Server paths never leave the backend.
+// WebsiteTask stores the durable state of website backup, restore, safe
+// deletion, Git deployment, and staging clone/push. Server paths never leave
+// the backend. For staging tasks WebsiteID is the live site and the Staging
+// fields describe its copy.
 type WebsiteTask struct {
-	ID              string     `json:"id" gorm:"primaryKey;size:36"`
-	Operation       string     `json:"operation" gorm:"size:16;not null"`
-	WebsiteID       int64      `json:"websiteId" gorm:"not null;index:idx_website_task_site_created"`
-	WebsiteName     string     `json:"websiteName" gorm:"size:253;not null"`
-	DatabaseID      int64      `json:"databaseId,omitempty" gorm:"index"`
-	DatabaseName    string     `json:"databaseName,omitempty" gorm:"size:64"`
-	SourceBackupID  string     `json:"sourceBackupId,omitempty" gorm:"size:36;index"`
-	ResultBackupID  string     `json:"resultBackupId,omitempty" gorm:"size:36;index"`
-	SafetyBackupID  string     `json:"safetyBackupId,omitempty" gorm:"size:36;index"`
-	DeleteFiles     bool       `json:"deleteFiles" gorm:"not null;default:false"`
-	Status          string     `json:"status" gorm:"size:32;not null;index:idx_website_task_status_created"`
-	Progress        int        `json:"progress" gorm:"not null;default:0"`
-	Message         string     `json:"message" gorm:"size:512"`
-	ErrorCode       string     `json:"errorCode,omitempty" gorm:"size:64"`
-	ErrorMessage    string     `json:"errorMessage,omitempty" gorm:"size:1024"`
-	RequestedBy     int64      `json:"requestedBy" gorm:"not null;index:idx_website_task_user_created"`
-	CancelRequested bool       `json:"cancelRequested" gorm:"not null;default:false"`
-	LogPath         string     `json:"-" gorm:"size:1024"`
-	StartedAt       *time.Time `json:"startedAt,omitempty"`
-	HeartbeatAt     *time.Time `json:"heartbeatAt,omitempty"`
-	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
-	CreatedAt       time.Time  `json:"createdAt" gorm:"index:idx_website_task_site_created,priority:2;index:idx_website_task_status_created,priority:2;index:idx_website_task_user_created,priority:2"`
-	UpdatedAt       time.Time  `json:"updatedAt"`
+	ID                  string     `json:"id" gorm:"primaryKey;size:36"`
+	Operation           string     `json:"operation" gorm:"size:16;not null"`
+	WebsiteID           int64      `json:"websiteId" gorm:"not null;index:idx_website_task_site_created"`
+	WebsiteName         string     `json:"websiteName" gorm:"size:253;not null"`
+	DatabaseID          int64      `json:"databaseId,omitempty" gorm:"index"`
+	DatabaseName        string     `json:"databaseName,omitempty" gorm:"size:64"`
+	SourceBackupID      string     `json:"sourceBackupId,omitempty" gorm:"size:36;index"`
+	ResultBackupID      string     `json:"resultBackupId,omitempty" gorm:"size:36;index"`
+	SafetyBackupID      string     `json:"safetyBackupId,omitempty" gorm:"size:36;index"`
+	DeleteFiles         bool       `json:"deleteFiles" gorm:"not null;default:false"`
+	StagingWebsiteID    int64      `json:"stagingWebsiteId,omitempty" gorm:"index"`
+	StagingDomain       string     `json:"stagingDomain,omitempty" gorm:"size:253"`
+	StagingDatabaseID   int64      `json:"stagingDatabaseId,omitempty"`
+	StagingDatabaseName string     `json:"stagingDatabaseName,omitempty" gorm:"size:64"`
+	RewriteDatabase     bool       `json:"rewriteDatabase" gorm:"not null;default:false"`
+	StagingAuthJSON     string     `json:"-" gorm:"type:text"`
+	Status              string     `json:"status" gorm:"size:32;not null;index:idx_website_task_status_created"`
+	Progress            int        `json:"progress" gorm:"not null;default:0"`
+	Message             string     `json:"message" gorm:"size:512"`
+	ErrorCode           string     `json:"errorCode,omitempty" gorm:"size:64"`
+	ErrorMessage        string     `json:"errorMessage,omitempty" gorm:"size:1024"`
+	RequestedBy         int64      `json:"requestedBy" gorm:"not null;index:idx_website_task_user_created"`
+	CancelRequested     bool       `json:"cancelRequested" gorm:"not null;default:false"`
+	LogPath             string     `json:"-" gorm:"size:1024"`
+	StartedAt           *time.Time `json:"startedAt,omitempty"`
+	HeartbeatAt         *time.Time `json:"heartbeatAt,omitempty"`
+	FinishedAt          *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt" gorm:"index:idx_website_task_site_created,priority:2;index:idx_website_task_status_created,priority:2;index:idx_website_task_user_created,priority:2"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
 }
 
 func (WebsiteTask) TableName() string {
@@ -77,6 +90,20 @@ func (WebsiteBackup) TableName() string {
 	return "website_backup"
 }
 
+// WebsiteStaging links a staging site to the live site it was cloned from.
+type WebsiteStaging struct {
+	WebsiteID      int64     `json:"websiteId" gorm:"primaryKey"`
+	LiveWebsiteID  int64     `json:"liveWebsiteId" gorm:"not null;index"`
+	DatabaseID     int64     `json:"databaseId,omitempty"`
+	LiveDatabaseID int64     `json:"liveDatabaseId,omitempty"`
+	CreatedBy      int64     `json:"createdBy" gorm:"not null"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (WebsiteStaging) TableName() string {
+	return "website_staging"
+}
+
 type WebsiteOperationLock struct {
 	WebsiteID   int64     `json:"-" gorm:"primaryKey"`
 	TaskID      string    `json:"-" gorm:"size:36;not null;uniqueIndex"`
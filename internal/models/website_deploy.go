@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// WebsiteDeploySource is the Git repository a website is deployed from. The
+// deploy key and webhook secret are stored encrypted and never serialized.
+type WebsiteDeploySource struct {
+	WebsiteID              int64      `json:"websiteId" gorm:"primaryKey"`
+	RepoURL                string     `json:"repoUrl" gorm:"size:1024;not null"`
+	Branch                 string     `json:"branch" gorm:"size:255;not null"`
+	DeployKeyEncrypted     string     `json:"-" gorm:"type:text"`
+	DeployKeyConfigured    bool       `json:"deployKeyConfigured" gorm:"-"`
+	WebhookSecretEncrypted string     `json:"-" gorm:"type:text"`
+	BuildCommands          string     `json:"buildCommands" gorm:"type:text"`
+	ConfiguredBy           int64      `json:"configuredBy" gorm:"not null"`
+	LastCommit             string     `json:"lastCommit,omitempty" gorm:"size:64"`
+	LastDeployedAt         *time.Time `json:"lastDeployedAt,omitempty"`
+	CreatedAt              time.Time  `json:"createdAt"`
+	UpdatedAt              time.Time  `json:"updatedAt"`
+}
+
+func (WebsiteDeploySource) TableName() string {
+	return "website_deploy_source"
+}
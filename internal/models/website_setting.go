@@ -17,6 +17,15 @@ type WebsiteSetting struct {
 	BindingsJSON      string    `json:"-" gorm:"type:text"`
 	RedirectsJSON     string    `json:"-" gorm:"type:text"`
 	ProxyRulesJSON    string    `json:"-" gorm:"type:text"`
+	UpstreamsJSON     string    `json:"-" gorm:"type:text"`
+	ProxyUpstream     string    `json:"proxy_upstream" gorm:"size:32"`
+	WAFJSON           string    `json:"-" gorm:"column:waf_json;type:text"`
+	RequestLimitsJSON string    `json:"-" gorm:"type:text"`
+	EjectedBackends   string    `json:"-" gorm:"type:text"`
+	ReleaseKeep       int       `json:"release_keep" gorm:"not null;default:0"`
+	ReleasesEnabled   bool      `json:"-" gorm:"not null;default:false"`
+	CanaryRelease     string    `json:"-" gorm:"size:64"`
+	CanaryPercent     int       `json:"-" gorm:"not null;default:0"`
 	HotlinkEnabled    bool      `json:"hotlink_enabled" gorm:"not null;default:false"`
 	HotlinkAllowEmpty bool      `json:"hotlink_allow_empty" gorm:"not null"`
 	HotlinkDomains    string    `json:"hotlink_domains" gorm:"type:text"`
@@ -24,6 +33,9 @@ type WebsiteSetting struct {
 	SecurityHeaders   bool      `json:"security_headers" gorm:"not null"`
 	DeniedPaths       string    `json:"denied_paths" gorm:"type:text"`
 	PHPBackend        string    `json:"php_backend" gorm:"size:512"`
+	PHPVersion        string    `json:"php_version" gorm:"size:16"`
+	PHPPoolJSON       string    `json:"-" gorm:"type:text"`
+	BasicAuthJSON     string    `json:"-" gorm:"type:text"`
 	TamperProtection  bool      `json:"tamper_protection" gorm:"not null;default:false"`
 	TrafficAlert      bool      `json:"traffic_alert" gorm:"not null;default:false"`
 	TrafficAlertBytes int64     `json:"traffic_alert_bytes" gorm:"not null;default:0"`
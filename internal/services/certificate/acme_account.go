@@ -0,0 +1,199 @@
+package certificate
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"oneinstack/internal/models"
+	"oneinstack/utils"
+
+	"github.com/google/uuid"
+)
+
+const ACMEProviderCustom = "custom"
+
+type ACMEProvider struct {
+	Value        string `json:"value"`
+	Label        string `json:"label"`
+	DirectoryURL string `json:"directoryUrl,omitempty"`
+	RequiresEAB  bool   `json:"requiresEab"`
+}
+
+var acmeProviders = []ACMEProvider{
+	{Value: "letsencrypt", Label: "Let's Encrypt", DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory"},
+	{Value: "letsencrypt-staging", Label: "Let's Encrypt 测试环境", DirectoryURL: "https://acme-staging-v02.api.letsencrypt.org/directory"},
+	{Value: "zerossl", Label: "ZeroSSL", DirectoryURL: "https://acme.zerossl.com/v2/DV90", RequiresEAB: true},
+	{Value: "google", Label: "Google Trust Services", DirectoryURL: "https://dv.acme-v02.api.pki.goog/directory", RequiresEAB: true},
+	{Value: ACMEProviderCustom, Label: "自定义 ACME（如 step-ca）"},
+}
+
+type ACMEAccountOptions struct {
+	ID           string
+	Name         string
+	Provider     string
+	DirectoryURL string
+	Email        string
+	EABKeyID     string
+	EABHMACKey   string
+	CABundle     string
+	Enabled      bool
+}
+
+func SupportedACMEProviders() []ACMEProvider {
+	result := make([]ACMEProvider, len(acmeProviders))
+	copy(result, acmeProviders)
+	return result
+}
+
+func findACMEProvider(value string) (ACMEProvider, bool) {
+	for _, provider := range acmeProviders {
+		if provider.Value == value {
+			return provider, true
+		}
+	}
+	return ACMEProvider{}, false
+}
+
+func (catalog *Catalog) ListACMEAccounts() ([]models.ACMEAccount, error) {
+	var accounts []models.ACMEAccount
+	if err := catalog.db.Order("created_at DESC").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// SaveACMEAccount creates or updates a CA profile. An empty EAB HMAC key on
+// update keeps the stored key, mirroring DNS account credentials.
+func (catalog *Catalog) SaveACMEAccount(options ACMEAccountOptions) (*models.ACMEAccount, error) {
+	name := strings.TrimSpace(options.Name)
+	providerName := strings.TrimSpace(strings.ToLower(options.Provider))
+	if name == "" || len(name) > 128 {
+		return nil, errors.New("ACME account name is required")
+	}
+	provider, ok := findACMEProvider(providerName)
+	if !ok {
+		return nil, errors.New("unsupported ACME provider")
+	}
+	directoryURL := provider.DirectoryURL
+	if provider.Value == ACMEProviderCustom {
+		directoryURL = strings.TrimSpace(options.DirectoryURL)
+	}
+	if err := validateACMEDirectoryURL(directoryURL); err != nil {
+		return nil, err
+	}
+	email := ""
+	if strings.TrimSpace(options.Email) != "" {
+		normalized, err := normalizeEmail(options.Email)
+		if err != nil {
+			return nil, err
+		}
+		email = normalized
+	}
+	caBundle := strings.TrimSpace(options.CABundle)
+	if caBundle != "" {
+		if _, err := acmeRootCAs(caBundle); err != nil {
+			return nil, err
+		}
+	}
+	var account models.ACMEAccount
+	if id := strings.TrimSpace(options.ID); id != "" {
+		if err := catalog.db.First(&account, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+	}
+	keyID := strings.TrimSpace(options.EABKeyID)
+	hmacKey := strings.TrimSpace(options.EABHMACKey)
+	if keyID == "" && hmacKey != "" {
+		return nil, errors.New("EAB key ID is required with an HMAC key")
+	}
+	if hmacKey != "" {
+		if _, err := decodeEABHMACKey(hmacKey); err != nil {
+			return nil, err
+		}
+		encrypted, err := utils.EncryptCredential(hmacKey, utils.CredentialPurposeCertificateACME)
+		if err != nil {
+			return nil, err
+		}
+		account.EABHMACKey = encrypted
+	}
+	if keyID == "" {
+		account.EABHMACKey = ""
+	} else if account.EABHMACKey == "" {
+		return nil, errors.New("EAB HMAC key is required with a key ID")
+	}
+	account.EABKeyID, account.EABConfigured = keyID, keyID != ""
+	if provider.RequiresEAB && !account.EABConfigured {
+		return nil, fmt.Errorf("%s requires an EAB key ID and HMAC key", provider.Label)
+	}
+	account.Name, account.Provider, account.DirectoryURL = name, provider.Value, directoryURL
+	account.Email, account.CABundle, account.Enabled = email, caBundle, options.Enabled
+	if account.ID == "" {
+		account.ID = uuid.NewString()
+	}
+	if err := catalog.db.Save(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (catalog *Catalog) DeleteACMEAccount(id string) error {
+	id = strings.TrimSpace(id)
+	var count int64
+	if err := catalog.db.Model(&models.Certificate{}).Where("acme_account_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("ACME account is still used by a certificate")
+	}
+	return catalog.db.Delete(&models.ACMEAccount{}, "id = ?", id).Error
+}
+
+func validateACMEDirectoryURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || parsed.User != nil {
+		return errors.New("ACME directory URL must be an https URL")
+	}
+	return nil
+}
+
+// decodeEABHMACKey accepts the base64url key handed out by CAs, with or
+// without padding.
+func decodeEABHMACKey(value string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(value), "="))
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("EAB HMAC key must be base64url encoded")
+	}
+	return key, nil
+}
+
+// acmeRootCAs adds a private CA bundle to the system roots so a step-ca
+// directory served with an internal certificate can be reached.
+func acmeRootCAs(bundle string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, errors.New("ACME CA bundle is invalid")
+	}
+	return pool, nil
+}
+
+// acmeAccountKeyPath keeps the historical per-directory key for panel-wide
+// issuance and gives every profile its own key, because an EAB binding ties
+// the key to one external account.
+func acmeAccountKeyPath(certificateRoot, directoryURL, profileID string) string {
+	seed := directoryURL
+	if profileID != "" {
+		seed += "\x00" + profileID
+	}
+	hash := sha256.Sum256([]byte(seed))
+	return filepath.Join(certificateRoot, "accounts", hex.EncodeToString(hash[:16])+".key")
+}
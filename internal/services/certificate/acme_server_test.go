@@ -0,0 +1,535 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testACMEServer is a minimal in-process RFC 8555 CA. It trusts JWS
+// signatures and validates challenges against in-memory fixtures so issuer
+// tests exercise the real golang.org/x/crypto/acme client end to end.
+type testACMEServer struct {
+	t         *testing.T
+	server    *httptest.Server
+	caKey     *ecdsa.PrivateKey
+	caCert    *x509.Certificate
+	dns       *fakeDNSProvider
+	httpRoot  string
+	nextID    int
+	nonce     int
+	accounts  map[string]string
+	byThumb   map[string]string
+	orders    map[string]*testACMEOrder
+	authzs    map[string]*testACMEAuthz
+	chals     map[string]*testACMEChallenge
+	certs     map[string][]byte
+	validated []string
+	eabKIDs   []string
+	mu        sync.Mutex
+}
+
+type testACMEIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type testACMEOrder struct {
+	id          string
+	identifiers []testACMEIdentifier
+	authzIDs    []string
+	finalized   bool
+	certID      string
+}
+
+type testACMEAuthz struct {
+	id         string
+	identifier testACMEIdentifier
+	wildcard   bool
+	challenges []string
+}
+
+type testACMEChallenge struct {
+	id      string
+	typ     string
+	token   string
+	status  string
+	authzID string
+	err     string
+}
+
+type testJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+}
+
+type testJWSHeader struct {
+	JWK json.RawMessage `json:"jwk"`
+	KID string          `json:"kid"`
+}
+
+func newTestACMEServer(t *testing.T, dns *fakeDNSProvider, httpRoot string) *testACMEServer {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OneinStack Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testACMEServer{
+		t: t, caKey: caKey, caCert: caCert, dns: dns, httpRoot: httpRoot,
+		accounts: map[string]string{}, byThumb: map[string]string{},
+		orders: map[string]*testACMEOrder{}, authzs: map[string]*testACMEAuthz{},
+		chals: map[string]*testACMEChallenge{}, certs: map[string][]byte{},
+	}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.handle))
+	t.Cleanup(ca.server.Close)
+	return ca
+}
+
+func (ca *testACMEServer) directoryURL() string { return ca.server.URL + "/directory" }
+
+func (ca *testACMEServer) validatedChallenges() []string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	result := append([]string(nil), ca.validated...)
+	sort.Strings(result)
+	return result
+}
+
+func (ca *testACMEServer) externalAccountKeyIDs() []string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return append([]string(nil), ca.eabKIDs...)
+}
+
+func (ca *testACMEServer) handle(writer http.ResponseWriter, request *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.nonce++
+	writer.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", ca.nonce))
+	writer.Header().Set("Cache-Control", "no-store")
+	base := ca.server.URL
+	if request.URL.Path == "/directory" {
+		ca.writeJSON(writer, http.StatusOK, map[string]any{
+			"newNonce": base + "/nonce", "newAccount": base + "/account",
+			"newOrder": base + "/order", "revokeCert": base + "/revoke",
+			"keyChange": base + "/key-change",
+		})
+		return
+	}
+	if request.URL.Path == "/nonce" {
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	header, payload, ok := ca.decodeJWS(request)
+	if !ok {
+		ca.problem(writer, http.StatusBadRequest, "malformed", "invalid JWS")
+		return
+	}
+	segments := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	switch segments[0] {
+	case "account":
+		ca.handleAccount(writer, header, payload)
+	case "order":
+		if len(segments) == 1 {
+			ca.handleNewOrder(writer, payload)
+			return
+		}
+		ca.writeOrder(writer, http.StatusOK, ca.orders[segments[1]])
+	case "authz":
+		ca.writeAuthz(writer, ca.authzs[segments[1]])
+	case "challenge":
+		ca.handleChallenge(writer, header, payload, segments[1])
+	case "finalize":
+		ca.handleFinalize(writer, payload, segments[1])
+	case "cert":
+		content, exists := ca.certs[segments[1]]
+		if !exists {
+			ca.problem(writer, http.StatusNotFound, "malformed", "certificate not found")
+			return
+		}
+		writer.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = writer.Write(content)
+	default:
+		ca.problem(writer, http.StatusNotFound, "malformed", "unknown resource")
+	}
+}
+
+func (ca *testACMEServer) decodeJWS(request *http.Request) (testJWSHeader, []byte, bool) {
+	var envelope testJWS
+	if err := json.NewDecoder(request.Body).Decode(&envelope); err != nil {
+		return testJWSHeader{}, nil, false
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return testJWSHeader{}, nil, false
+	}
+	var header testJWSHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return testJWSHeader{}, nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return testJWSHeader{}, nil, false
+	}
+	return header, payload, true
+}
+
+func (ca *testACMEServer) handleAccount(writer http.ResponseWriter, header testJWSHeader, payload []byte) {
+	if len(header.JWK) == 0 {
+		ca.problem(writer, http.StatusBadRequest, "malformed", "account requests must carry a JWK")
+		return
+	}
+	digest := sha256.Sum256(header.JWK)
+	thumbprint := base64.RawURLEncoding.EncodeToString(digest[:])
+	var body struct {
+		OnlyReturnExisting     bool     `json:"onlyReturnExisting"`
+		ExternalAccountBinding *testJWS `json:"externalAccountBinding"`
+	}
+	_ = json.Unmarshal(payload, &body)
+	if body.ExternalAccountBinding != nil {
+		var eab testJWSHeader
+		protected, _ := base64.RawURLEncoding.DecodeString(body.ExternalAccountBinding.Protected)
+		_ = json.Unmarshal(protected, &eab)
+		ca.eabKIDs = append(ca.eabKIDs, eab.KID)
+	}
+	accountURL, exists := ca.byThumb[thumbprint]
+	if !exists && body.OnlyReturnExisting {
+		ca.problem(writer, http.StatusBadRequest, "accountDoesNotExist", "no account for key")
+		return
+	}
+	status := http.StatusOK
+	if !exists {
+		accountURL = ca.server.URL + "/account/" + ca.newID()
+		ca.byThumb[thumbprint] = accountURL
+		ca.accounts[accountURL] = thumbprint
+		status = http.StatusCreated
+	}
+	writer.Header().Set("Location", accountURL)
+	ca.writeJSON(writer, status, map[string]any{"status": "valid"})
+}
+
+func (ca *testACMEServer) handleNewOrder(writer http.ResponseWriter, payload []byte) {
+	var body struct {
+		Identifiers []testACMEIdentifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil || len(body.Identifiers) == 0 {
+		ca.problem(writer, http.StatusBadRequest, "malformed", "identifiers are required")
+		return
+	}
+	order := &testACMEOrder{id: ca.newID(), identifiers: body.Identifiers}
+	for _, identifier := range body.Identifiers {
+		authz := &testACMEAuthz{
+			id:         ca.newID(),
+			identifier: testACMEIdentifier{Type: "dns", Value: strings.TrimPrefix(identifier.Value, "*.")},
+			wildcard:   strings.HasPrefix(identifier.Value, "*."),
+		}
+		types := []string{ChallengeTypeHTTP01, ChallengeTypeDNS01}
+		if authz.wildcard {
+			types = []string{ChallengeTypeDNS01}
+		}
+		for _, challengeType := range types {
+			challenge := &testACMEChallenge{
+				id: ca.newID(), typ: challengeType, status: "pending", authzID: authz.id,
+				token: base64.RawURLEncoding.EncodeToString([]byte("token-" + ca.newID())),
+			}
+			ca.chals[challenge.id] = challenge
+			authz.challenges = append(authz.challenges, challenge.id)
+		}
+		ca.authzs[authz.id] = authz
+		order.authzIDs = append(order.authzIDs, authz.id)
+	}
+	ca.orders[order.id] = order
+	ca.writeOrder(writer, http.StatusCreated, order)
+}
+
+func (ca *testACMEServer) handleChallenge(writer http.ResponseWriter, header testJWSHeader, payload []byte, id string) {
+	challenge, exists := ca.chals[id]
+	if !exists {
+		ca.problem(writer, http.StatusNotFound, "malformed", "challenge not found")
+		return
+	}
+	if len(payload) > 0 && challenge.status == "pending" {
+		thumbprint := ca.accounts[header.KID]
+		keyAuthorization := challenge.token + "." + thumbprint
+		authz := ca.authzs[challenge.authzID]
+		challenge.status = "invalid"
+		switch challenge.typ {
+		case ChallengeTypeDNS01:
+			digest := sha256.Sum256([]byte(keyAuthorization))
+			expected := base64.RawURLEncoding.EncodeToString(digest[:])
+			name := "_acme-challenge." + authz.identifier.Value
+			challenge.err = "TXT record not found at " + name
+			if ca.dns != nil {
+				for _, value := range ca.dns.records(name) {
+					if value == expected {
+						challenge.status, challenge.err = "valid", ""
+					}
+				}
+			}
+		case ChallengeTypeHTTP01:
+			content, err := os.ReadFile(filepath.Join(ca.httpRoot, ".well-known", "acme-challenge", challenge.token))
+			challenge.err = "HTTP-01 response mismatch for " + authz.identifier.Value
+			if err == nil && string(content) == keyAuthorization {
+				challenge.status, challenge.err = "valid", ""
+			}
+		}
+		if challenge.status == "valid" {
+			name := authz.identifier.Value
+			if authz.wildcard {
+				name = "*." + name
+			}
+			ca.validated = append(ca.validated, challenge.typ+":"+name)
+		}
+	}
+	ca.writeJSON(writer, http.StatusOK, ca.challengeJSON(challenge))
+}
+
+func (ca *testACMEServer) handleFinalize(writer http.ResponseWriter, payload []byte, id string) {
+	order, exists := ca.orders[id]
+	if !exists || ca.orderStatus(order) != "ready" {
+		ca.problem(writer, http.StatusForbidden, "orderNotReady", "order is not ready")
+		return
+	}
+	var body struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		ca.problem(writer, http.StatusBadRequest, "malformed", "csr is required")
+		return
+	}
+	csrDER, err := base64.RawURLEncoding.DecodeString(body.CSR)
+	if err != nil {
+		ca.problem(writer, http.StatusBadRequest, "badCSR", "csr is not base64url")
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil || csr.CheckSignature() != nil {
+		ca.problem(writer, http.StatusBadRequest, "badCSR", "csr is invalid")
+		return
+	}
+	requested := map[string]bool{}
+	for _, identifier := range order.identifiers {
+		requested[identifier.Value] = true
+	}
+	for _, name := range csr.DNSNames {
+		if !requested[name] {
+			ca.problem(writer, http.StatusBadRequest, "badCSR", "csr names do not match order")
+			return
+		}
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(1000 + ca.nextID)),
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, ca.caCert, csr.PublicKey, ca.caKey)
+	if err != nil {
+		ca.problem(writer, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	order.certID = ca.newID()
+	order.finalized = true
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+	ca.certs[order.certID] = chain
+	ca.writeOrder(writer, http.StatusOK, order)
+}
+
+func (ca *testACMEServer) orderStatus(order *testACMEOrder) string {
+	if order.finalized {
+		return "valid"
+	}
+	for _, authzID := range order.authzIDs {
+		switch ca.authzStatus(ca.authzs[authzID]) {
+		case "invalid":
+			return "invalid"
+		case "pending":
+			return "pending"
+		}
+	}
+	return "ready"
+}
+
+func (ca *testACMEServer) authzStatus(authz *testACMEAuthz) string {
+	status := "pending"
+	for _, id := range authz.challenges {
+		switch ca.chals[id].status {
+		case "valid":
+			return "valid"
+		case "invalid":
+			status = "invalid"
+		}
+	}
+	return status
+}
+
+func (ca *testACMEServer) writeOrder(writer http.ResponseWriter, status int, order *testACMEOrder) {
+	if order == nil {
+		ca.problem(writer, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	authorizations := make([]string, 0, len(order.authzIDs))
+	for _, id := range order.authzIDs {
+		authorizations = append(authorizations, ca.server.URL+"/authz/"+id)
+	}
+	body := map[string]any{
+		"status": ca.orderStatus(order), "identifiers": order.identifiers,
+		"authorizations": authorizations, "finalize": ca.server.URL + "/finalize/" + order.id,
+	}
+	if order.certID != "" {
+		body["certificate"] = ca.server.URL + "/cert/" + order.certID
+	}
+	writer.Header().Set("Location", ca.server.URL+"/order/"+order.id)
+	ca.writeJSON(writer, status, body)
+}
+
+func (ca *testACMEServer) writeAuthz(writer http.ResponseWriter, authz *testACMEAuthz) {
+	if authz == nil {
+		ca.problem(writer, http.StatusNotFound, "malformed", "authorization not found")
+		return
+	}
+	challenges := make([]map[string]any, 0, len(authz.challenges))
+	for _, id := range authz.challenges {
+		challenges = append(challenges, ca.challengeJSON(ca.chals[id]))
+	}
+	ca.writeJSON(writer, http.StatusOK, map[string]any{
+		"identifier": authz.identifier, "status": ca.authzStatus(authz),
+		"wildcard": authz.wildcard, "challenges": challenges,
+	})
+}
+
+func (ca *testACMEServer) challengeJSON(challenge *testACMEChallenge) map[string]any {
+	body := map[string]any{
+		"type": challenge.typ, "url": ca.server.URL + "/challenge/" + challenge.id,
+		"token": challenge.token, "status": challenge.status,
+	}
+	if challenge.err != "" {
+		body["error"] = map[string]any{"type": "urn:ietf:params:acme:error:unauthorized", "detail": challenge.err}
+	}
+	return body
+}
+
+func (ca *testACMEServer) problem(writer http.ResponseWriter, status int, problemType, detail string) {
+	writer.Header().Set("Content-Type", "application/problem+json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(map[string]string{
+		"type": "urn:ietf:params:acme:error:" + problemType, "detail": detail,
+	})
+}
+
+func (ca *testACMEServer) writeJSON(writer http.ResponseWriter, status int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(body)
+}
+
+func (ca *testACMEServer) newID() string {
+	ca.nextID++
+	return fmt.Sprintf("%d", ca.nextID)
+}
+
+// fakeDNSProvider stores TXT records in memory and doubles as the resolver
+// used for the propagation check.
+type fakeDNSProvider struct {
+	mu        sync.Mutex
+	values    map[string][]string
+	created   int
+	deleted   int
+	createErr error
+}
+
+func newFakeDNSProvider() *fakeDNSProvider {
+	return &fakeDNSProvider{values: map[string][]string{}}
+}
+
+func (provider *fakeDNSProvider) CreateTXTRecord(_ context.Context, fqdn, value string) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.createErr != nil {
+		return provider.createErr
+	}
+	provider.created++
+	provider.values[fqdn] = append(provider.values[fqdn], value)
+	return nil
+}
+
+func (provider *fakeDNSProvider) DeleteTXTRecord(_ context.Context, fqdn, value string) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.deleted++
+	remaining := provider.values[fqdn][:0]
+	for _, existing := range provider.values[fqdn] {
+		if existing != value {
+			remaining = append(remaining, existing)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(provider.values, fqdn)
+	} else {
+		provider.values[fqdn] = remaining
+	}
+	return nil
+}
+
+func (provider *fakeDNSProvider) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return provider.records(name), nil
+}
+
+func (provider *fakeDNSProvider) records(name string) []string {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return append([]string(nil), provider.values[name]...)
+}
+
+func (provider *fakeDNSProvider) recordCount() int {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	count := 0
+	for _, values := range provider.values {
+		count += len(values)
+	}
+	return count
+}
@@ -0,0 +1,184 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/monitoring"
+
+	"golang.org/x/crypto/ocsp"
+	"gorm.io/gorm"
+)
+
+const (
+	OCSPStatusGood    = "good"
+	OCSPStatusRevoked = "revoked"
+	OCSPStatusUnknown = "unknown"
+
+	ocspCheckInterval    = 6 * time.Hour
+	maxOCSPResponseBytes = 64 << 10
+)
+
+// AlertCollector reports managed certificates to the monitoring engine. OCSP
+// responders are queried at most every six hours per certificate and the
+// result is cached on the managed certificate row.
+type AlertCollector struct {
+	db     *gorm.DB
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewAlertCollector(db *gorm.DB) *AlertCollector {
+	return &AlertCollector{db: db, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+func (collector *AlertCollector) CollectCertificates(ctx context.Context) ([]monitoring.CertificateObservation, error) {
+	if collector == nil || collector.db == nil {
+		return nil, errors.New("certificate alert database is not initialized")
+	}
+	var managed []models.ManagedCertificate
+	if err := collector.db.Where("status <> ?", models.CertificateStatusDisabled).
+		Order("created_at ASC").Find(&managed).Error; err != nil {
+		return nil, fmt.Errorf("list managed certificates: %w", err)
+	}
+	ids := make([]string, 0, len(managed))
+	for _, record := range managed {
+		ids = append(ids, record.ID)
+	}
+	// Renewal history lives on the owning legacy row, whose ID matches the
+	// managed certificate; bound projections never renew themselves.
+	var owners []models.Certificate
+	if len(ids) > 0 {
+		if err := collector.db.Select("id", "renewal_failures", "last_error").
+			Where("id IN ?", ids).Find(&owners).Error; err != nil {
+			return nil, fmt.Errorf("list certificate renewal state: %w", err)
+		}
+	}
+	ownerByID := make(map[string]models.Certificate, len(owners))
+	for _, owner := range owners {
+		ownerByID[owner.ID] = owner
+	}
+	now := collector.now().UTC()
+	observations := make([]monitoring.CertificateObservation, 0, len(managed))
+	for index := range managed {
+		record := &managed[index]
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		collector.refreshOCSP(ctx, record, now)
+		owner := ownerByID[record.ID]
+		observations = append(observations, monitoring.CertificateObservation{
+			ID:              record.ID,
+			Name:            strings.Split(record.Domains, ",")[0],
+			NotAfter:        record.NotAfter,
+			RenewalFailures: owner.RenewalFailures,
+			Revoked:         record.OCSPStatus == OCSPStatusRevoked,
+			LastError:       owner.LastError,
+			CheckedAt:       now,
+		})
+	}
+	return observations, nil
+}
+
+// refreshOCSP records the responder status when the cached answer is stale.
+// Lookup failures keep the previous status so a flaky responder never clears
+// a revocation.
+func (collector *AlertCollector) refreshOCSP(ctx context.Context, record *models.ManagedCertificate, now time.Time) {
+	if record.Provider == "self-signed" || !record.NotAfter.After(now) {
+		return
+	}
+	if record.OCSPCheckedAt != nil && now.Sub(*record.OCSPCheckedAt) < ocspCheckInterval {
+		return
+	}
+	status, err := collector.queryOCSP(ctx, record.CertificatePath)
+	updates := map[string]any{"ocsp_checked_at": now}
+	if err == nil {
+		updates["ocsp_status"] = status
+		record.OCSPStatus = status
+	}
+	record.OCSPCheckedAt = &now
+	_ = collector.db.Model(&models.ManagedCertificate{}).Where("id = ?", record.ID).Updates(updates).Error
+}
+
+func (collector *AlertCollector) queryOCSP(ctx context.Context, certificatePath string) (string, error) {
+	leaf, issuer, err := readCertificateChain(certificatePath)
+	if err != nil {
+		return "", err
+	}
+	if len(leaf.OCSPServer) == 0 || issuer == nil {
+		return "", errors.New("certificate has no OCSP responder")
+	}
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return "", err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(request))
+	if err != nil {
+		return "", err
+	}
+	httpRequest.Header.Set("Content-Type", "application/ocsp-request")
+	response, err := collector.client.Do(httpRequest)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OCSP responder returned HTTP %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxOCSPResponseBytes))
+	if err != nil {
+		return "", err
+	}
+	parsed, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return "", err
+	}
+	switch parsed.Status {
+	case ocsp.Good:
+		return OCSPStatusGood, nil
+	case ocsp.Revoked:
+		return OCSPStatusRevoked, nil
+	default:
+		return OCSPStatusUnknown, nil
+	}
+}
+
+func readCertificateChain(path string) (*x509.Certificate, *x509.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chain []*x509.Certificate
+	for len(chain) < 2 {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, parsed)
+	}
+	if len(chain) == 0 {
+		return nil, nil, errors.New("certificate file is invalid")
+	}
+	if len(chain) == 1 {
+		return chain[0], nil, nil
+	}
+	return chain[0], chain[1], nil
+}
@@ -0,0 +1,126 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestAlertCollectorReportsRenewalFailuresAndOCSPRevocation(t *testing.T) {
+	db := openCertificateTestDB(t)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "OneinStack OCSP CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(24 * time.Hour),
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature, BasicConstraintsValid: true, IsCA: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	var queries atomic.Int32
+	responder := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		queries.Add(1)
+		body, _ := io.ReadAll(request.Body)
+		parsed, err := ocsp.ParseRequest(body)
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response, err := ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+			Status: ocsp.Revoked, SerialNumber: parsed.SerialNumber,
+			ThisUpdate: time.Now().Add(-time.Minute), RevokedAt: time.Now().Add(-time.Minute),
+		}, caKey)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = writer.Write(response)
+	}))
+	defer responder.Close()
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(77), Subject: pkix.Name{CommonName: "revoked.example.com"},
+		DNSNames: []string{"revoked.example.com"}, OCSPServer: []string{responder.URL},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(20 * 24 * time.Hour),
+	}, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificatePath := filepath.Join(t.TempDir(), "fullchain.pem")
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	if err := os.WriteFile(certificatePath, chain, 0600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	record := &models.ManagedCertificate{
+		ID: "0b6f8c3e-0d3f-4a4b-8b1e-7f0f2f7e9c01", Provider: "acme", Domains: "revoked.example.com",
+		CertificatePath: certificatePath, PrivateKeyPath: certificatePath, Algorithm: "ec-256",
+		Status: models.CertificateStatusActive, NotBefore: now.Add(-time.Hour), NotAfter: now.Add(20 * 24 * time.Hour),
+	}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatal(err)
+	}
+	website := createCertificateTestWebsite(t, db)
+	if err := db.Create(&models.Certificate{
+		ID: record.ID, WebsiteID: website.ID, ManagedID: record.ID, Provider: "acme", Email: "admin@example.com",
+		Domains: website.Domain, DirectoryURL: "https://acme.test/directory", CertificatePath: certificatePath,
+		PrivateKeyPath: certificatePath, Status: models.CertificateStatusActive, NotAfter: record.NotAfter,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	manager := newCertificateTestManager(t, db, &fakeIssuer{err: errors.New("rate limited")}, &fakeDeployer{})
+	defer stopCertificateTestManager(t, manager)
+	for attempt := 0; attempt < 2; attempt++ {
+		task, err := manager.SubmitRenew(record.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task = waitCertificateTask(t, manager, task.ID); task.Status != models.CertificateTaskStatusFailed {
+			t.Fatalf("renewal status = %s", task.Status)
+		}
+	}
+
+	collector := NewAlertCollector(db)
+	for round := 0; round < 2; round++ {
+		observations, err := collector.CollectCertificates(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(observations) != 1 || observations[0].ID != record.ID ||
+			observations[0].RenewalFailures != 2 || !observations[0].Revoked ||
+			observations[0].LastError == "" {
+			t.Fatalf("unexpected observations: %#v", observations)
+		}
+	}
+	if queries.Load() != 1 {
+		t.Fatalf("OCSP responder queried %d times, want a cached answer", queries.Load())
+	}
+}
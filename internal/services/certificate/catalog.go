@@ -337,7 +337,7 @@ func (catalog *Catalog) Bind(ctx context.Context, id string, websiteID int64, fo
 	if err != nil {
 		return nil, err
 	}
-	domains, err := certificateDomains(website.Domain)
+	domains, err := certificateDomains(website.Domain, true)
 	if err != nil {
 		return nil, err
 	}
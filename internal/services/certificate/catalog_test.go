@@ -19,7 +19,7 @@ func newCatalogTest(t *testing.T) (*Catalog, *gorm.DB) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := database.AutoMigrate(&models.Certificate{}, &models.ManagedCertificate{}, &models.CertificateBinding{}, &models.DNSAccount{}); err != nil {
+	if err := database.AutoMigrate(&models.Certificate{}, &models.ManagedCertificate{}, &models.CertificateBinding{}, &models.DNSAccount{}, &models.ACMEAccount{}); err != nil {
 		t.Fatal(err)
 	}
 	return NewCatalog(database, filepath.Join(t.TempDir(), "certificates"), nil), database
@@ -99,6 +99,58 @@ func TestDNSAccountCredentialsAreEncrypted(t *testing.T) {
 	}
 }
 
+func TestACMEAccountValidatesAndEncryptsEAB(t *testing.T) {
+	if err := utils.ConfigureCredentialKey(bytes.Repeat([]byte{0x42}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	catalog, database := newCatalogTest(t)
+	if _, err := catalog.SaveACMEAccount(ACMEAccountOptions{Name: "zerossl", Provider: "zerossl", Enabled: true}); err == nil {
+		t.Fatal("ZeroSSL profile accepted missing EAB credentials")
+	}
+	if _, err := catalog.SaveACMEAccount(ACMEAccountOptions{
+		Name: "step-ca", Provider: ACMEProviderCustom, DirectoryURL: "http://ca.internal/acme/directory", Enabled: true,
+	}); err == nil {
+		t.Fatal("custom profile accepted a plain HTTP directory")
+	}
+	account, err := catalog.SaveACMEAccount(ACMEAccountOptions{
+		Name: "zerossl", Provider: "zerossl", Email: "Admin@Example.com",
+		EABKeyID: "kid-1", EABHMACKey: "c2VjcmV0LWhtYWMta2V5", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.EABConfigured || account.DirectoryURL != "https://acme.zerossl.com/v2/DV90" || account.Email != "admin@example.com" {
+		t.Fatalf("unexpected ACME account: %#v", account)
+	}
+	var stored models.ACMEAccount
+	if err := database.First(&stored, "id = ?", account.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	value, err := utils.DecryptCredential(stored.EABHMACKey, utils.CredentialPurposeCertificateACME)
+	if err != nil || value != "c2VjcmV0LWhtYWMta2V5" {
+		t.Fatalf("decrypt EAB key = %q, err=%v", value, err)
+	}
+	updated, err := catalog.SaveACMEAccount(ACMEAccountOptions{
+		ID: account.ID, Name: "zerossl renamed", Provider: "zerossl", EABKeyID: "kid-1", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.EABHMACKey != stored.EABHMACKey {
+		t.Fatal("update without an HMAC key replaced the stored key")
+	}
+	if err := database.Create(&models.Certificate{
+		ID: "a3c0c7a6-2c61-4f0a-9a55-0a5d5c7a2f10", WebsiteID: 1, Provider: "acme", Email: "admin@example.com",
+		Domains: "example.com", DirectoryURL: updated.DirectoryURL, ACMEAccountID: updated.ID,
+		CertificatePath: "/tmp/cert.pem", PrivateKeyPath: "/tmp/key.pem", Status: models.CertificateStatusActive,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.DeleteACMEAccount(updated.ID); err == nil {
+		t.Fatal("deleted an ACME account still used by a certificate")
+	}
+}
+
 func TestDeleteRemovesManagedMaterial(t *testing.T) {
 	catalog, _ := newCatalogTest(t)
 	record, err := catalog.CreateSelfSigned(SelfSignedOptions{Domains: []string{"delete.example.com"}, Algorithm: "ec-256"})
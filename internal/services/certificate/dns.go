@@ -0,0 +1,202 @@
+package certificate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/utils"
+)
+
+const (
+	ChallengeTypeHTTP01 = "http-01"
+	ChallengeTypeDNS01  = "dns-01"
+	// ChallengeTypeAuto validates wildcard identifiers with dns-01 and every
+	// other identifier of the same order with http-01.
+	ChallengeTypeAuto = "auto"
+)
+
+const (
+	defaultDNSPropagationTimeout  = 3 * time.Minute
+	defaultDNSPropagationInterval = 5 * time.Second
+	dnsChallengeRecordPrefix      = "_acme-challenge."
+)
+
+// DNSChallengeProvider publishes and removes the TXT records answered by the
+// ACME dns-01 challenge. fqdn is the record name without the trailing dot,
+// for example _acme-challenge.example.com. A provider instance is used by a
+// single task, so implementations may keep the created record IDs in memory.
+type DNSChallengeProvider interface {
+	CreateTXTRecord(ctx context.Context, fqdn, value string) error
+	DeleteTXTRecord(ctx context.Context, fqdn, value string) error
+}
+
+// TXTResolver is satisfied by *net.Resolver and lets tests observe
+// propagation without a real DNS server.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSProviderFactory builds a challenge provider from a stored DNS account.
+type DNSProviderFactory func(models.DNSAccount) (DNSChallengeProvider, error)
+
+// NewDNSChallengeProvider decrypts the account credentials and returns the
+// provider implementation registered for account.Provider.
+func NewDNSChallengeProvider(account models.DNSAccount) (DNSChallengeProvider, error) {
+	if !account.Enabled {
+		return nil, errors.New("DNS account is disabled")
+	}
+	if !account.CredentialConfigured || strings.TrimSpace(account.CredentialOne) == "" {
+		return nil, errors.New("DNS account credential is required")
+	}
+	credentialOne, err := utils.DecryptCredential(account.CredentialOne, utils.CredentialPurposeCertificateDNS)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt DNS account credential: %w", err)
+	}
+	credentialTwo := ""
+	if strings.TrimSpace(account.CredentialTwo) != "" {
+		credentialTwo, err = utils.DecryptCredential(account.CredentialTwo, utils.CredentialPurposeCertificateDNS)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt DNS account credential: %w", err)
+		}
+	}
+	switch account.Provider {
+	case "cloudflare":
+		return newCloudflareProvider(credentialOne, credentialTwo), nil
+	case "aliyun":
+		if credentialTwo == "" {
+			return nil, errors.New("aliyun DNS account requires an AccessKey secret")
+		}
+		return newAliyunProvider(credentialOne, credentialTwo), nil
+	case "tencentcloud":
+		if credentialTwo == "" {
+			return nil, errors.New("tencentcloud DNS account requires a SecretKey")
+		}
+		return newTencentCloudProvider(credentialOne, credentialTwo), nil
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider %q", account.Provider)
+	}
+}
+
+func normalizeChallengeType(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ChallengeTypeHTTP01:
+		return ChallengeTypeHTTP01, nil
+	case ChallengeTypeDNS01:
+		return ChallengeTypeDNS01, nil
+	case ChallengeTypeAuto:
+		return ChallengeTypeAuto, nil
+	default:
+		return "", fmt.Errorf("unsupported ACME challenge type %q", value)
+	}
+}
+
+// identifierChallengeType resolves the challenge used for one identifier of
+// an order requested with challengeType.
+func identifierChallengeType(challengeType, domain string) string {
+	if challengeType != ChallengeTypeAuto {
+		return challengeType
+	}
+	if strings.HasPrefix(strings.TrimSpace(domain), "*.") {
+		return ChallengeTypeDNS01
+	}
+	return ChallengeTypeHTTP01
+}
+
+// orderChallengeTypes reports which challenge types an order will use, so
+// callers only prepare the HTTP route or DNS account the order needs.
+func orderChallengeTypes(challengeType string, domains []string) (usesHTTP, usesDNS bool) {
+	for _, domain := range domains {
+		if identifierChallengeType(challengeType, domain) == ChallengeTypeDNS01 {
+			usesDNS = true
+		} else {
+			usesHTTP = true
+		}
+	}
+	return usesHTTP, usesDNS
+}
+
+// dnsChallengeRecordName returns the TXT name validated for domain. A wildcard
+// identifier is validated on its base domain as required by RFC 8555.
+func dnsChallengeRecordName(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	return dnsChallengeRecordPrefix + strings.TrimPrefix(domain, "*.")
+}
+
+// dnsZoneCandidates lists the parent names of fqdn from the most to the least
+// specific one, skipping the challenge label and the bare top-level domain.
+func dnsZoneCandidates(fqdn string) []string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(fqdn), "."), ".")
+	candidates := make([]string, 0, len(labels))
+	for index := 1; index < len(labels)-1; index++ {
+		candidates = append(candidates, strings.Join(labels[index:], "."))
+	}
+	return candidates
+}
+
+// relativeRecordName converts fqdn to a record name relative to zone.
+func relativeRecordName(fqdn, zone string) string {
+	fqdn = strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	if fqdn == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+zone)
+}
+
+// waitForTXTRecord polls the resolver until value is visible at fqdn. Public
+// DNS providers accept API writes long before their edge servers answer, and
+// asking the CA to validate early permanently fails the authorization.
+func waitForTXTRecord(
+	ctx context.Context,
+	resolver TXTResolver,
+	fqdn, value string,
+	timeout, interval time.Duration,
+) error {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if timeout <= 0 {
+		timeout = defaultDNSPropagationTimeout
+	}
+	if interval <= 0 {
+		interval = defaultDNSPropagationInterval
+	}
+	waitContext, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		records, _ := resolver.LookupTXT(waitContext, fqdn)
+		for _, record := range records {
+			if record == value {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-waitContext.Done():
+			return fmt.Errorf("TXT record %s did not propagate within %s", fqdn, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func dnsProviderHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 20 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errors.New("DNS provider redirects are not allowed")
+		},
+	}
+}
+
+func dnsRecordKey(fqdn, value string) string {
+	return strings.ToLower(fqdn) + "\x00" + value
+}
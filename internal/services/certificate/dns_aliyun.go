@@ -0,0 +1,167 @@
+package certificate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const aliyunDNSEndpoint = "https://alidns.aliyuncs.com/"
+
+// aliyunProvider calls the Alibaba Cloud DNS RPC API signed with HMAC-SHA1
+// (signature version 1.0) using a RAM AccessKey pair.
+type aliyunProvider struct {
+	endpoint        string
+	accessKeyID     string
+	accessKeySecret string
+	client          *http.Client
+	now             func() time.Time
+
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func newAliyunProvider(accessKeyID, accessKeySecret string) *aliyunProvider {
+	return &aliyunProvider{
+		endpoint:        aliyunDNSEndpoint,
+		accessKeyID:     strings.TrimSpace(accessKeyID),
+		accessKeySecret: strings.TrimSpace(accessKeySecret),
+		client:          dnsProviderHTTPClient(),
+		now:             time.Now,
+		records:         make(map[string]string),
+	}
+}
+
+func (provider *aliyunProvider) CreateTXTRecord(ctx context.Context, fqdn, value string) error {
+	var domain struct {
+		DomainName string `json:"DomainName"`
+		RR         string `json:"RR"`
+	}
+	if err := provider.call(ctx, map[string]string{
+		"Action": "GetMainDomainName", "InputString": fqdn,
+	}, &domain); err != nil {
+		return fmt.Errorf("find aliyun DNS domain: %w", err)
+	}
+	if domain.DomainName == "" {
+		return fmt.Errorf("no aliyun DNS domain manages %s", fqdn)
+	}
+	rr := domain.RR
+	if rr == "" {
+		rr = relativeRecordName(fqdn, domain.DomainName)
+	}
+	var created struct {
+		RecordID string `json:"RecordId"`
+	}
+	if err := provider.call(ctx, map[string]string{
+		"Action": "AddDomainRecord", "DomainName": domain.DomainName,
+		"RR": rr, "Type": "TXT", "Value": value, "TTL": "600",
+	}, &created); err != nil {
+		return fmt.Errorf("create aliyun TXT record: %w", err)
+	}
+	if created.RecordID == "" {
+		return errors.New("create aliyun TXT record: empty record ID")
+	}
+	provider.mu.Lock()
+	provider.records[dnsRecordKey(fqdn, value)] = created.RecordID
+	provider.mu.Unlock()
+	return nil
+}
+
+func (provider *aliyunProvider) DeleteTXTRecord(ctx context.Context, fqdn, value string) error {
+	provider.mu.Lock()
+	recordID, exists := provider.records[dnsRecordKey(fqdn, value)]
+	delete(provider.records, dnsRecordKey(fqdn, value))
+	provider.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	if err := provider.call(ctx, map[string]string{
+		"Action": "DeleteDomainRecord", "RecordId": recordID,
+	}, nil); err != nil {
+		return fmt.Errorf("delete aliyun TXT record: %w", err)
+	}
+	return nil
+}
+
+func (provider *aliyunProvider) call(ctx context.Context, parameters map[string]string, result any) error {
+	query := provider.signedQuery(parameters)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.endpoint+"?"+query, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", "OneinStack-Panel/ACME")
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return errors.New("aliyun DNS API request failed")
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		var apiError struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		}
+		if json.Unmarshal(body, &apiError) == nil && apiError.Code != "" {
+			return fmt.Errorf("aliyun DNS API error %s: %s", apiError.Code, apiError.Message)
+		}
+		return fmt.Errorf("aliyun DNS API returned HTTP %d", response.StatusCode)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// signedQuery implements the Alibaba Cloud RPC signature: sorted, RFC 3986
+// encoded parameters signed as "GET&%2F&<canonical query>".
+func (provider *aliyunProvider) signedQuery(parameters map[string]string) string {
+	values := map[string]string{
+		"Format":           "JSON",
+		"Version":          "2015-01-09",
+		"AccessKeyId":      provider.accessKeyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   uuid.NewString(),
+		"Timestamp":        provider.now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for key, value := range parameters {
+		values[key] = value
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, aliyunPercentEncode(key)+"="+aliyunPercentEncode(values[key]))
+	}
+	canonical := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(provider.accessKeySecret+"&"))
+	_, _ = mac.Write([]byte("GET&%2F&" + aliyunPercentEncode(canonical)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return canonical + "&Signature=" + aliyunPercentEncode(signature)
+}
+
+func aliyunPercentEncode(value string) string {
+	encoded := url.QueryEscape(value)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	return strings.ReplaceAll(encoded, "%7E", "~")
+}
@@ -0,0 +1,147 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const cloudflareAPIEndpoint = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider uses a scoped API token with Zone.DNS edit permission.
+// The optional zone ID skips zone discovery for tokens without Zone.Read.
+type cloudflareProvider struct {
+	endpoint string
+	token    string
+	zoneID   string
+	client   *http.Client
+
+	mu      sync.Mutex
+	records map[string]cloudflareRecordRef
+}
+
+type cloudflareRecordRef struct {
+	zoneID   string
+	recordID string
+}
+
+type cloudflareEnvelope struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func newCloudflareProvider(token, zoneID string) *cloudflareProvider {
+	return &cloudflareProvider{
+		endpoint: cloudflareAPIEndpoint,
+		token:    strings.TrimSpace(token),
+		zoneID:   strings.TrimSpace(zoneID),
+		client:   dnsProviderHTTPClient(),
+		records:  make(map[string]cloudflareRecordRef),
+	}
+}
+
+func (provider *cloudflareProvider) CreateTXTRecord(ctx context.Context, fqdn, value string) error {
+	zoneID, err := provider.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := provider.call(ctx, http.MethodPost, "/zones/"+url.PathEscape(zoneID)+"/dns_records", map[string]any{
+		"type": "TXT", "name": fqdn, "content": value, "ttl": 120,
+	}, &created); err != nil {
+		return fmt.Errorf("create cloudflare TXT record: %w", err)
+	}
+	if created.ID == "" {
+		return errors.New("create cloudflare TXT record: empty record ID")
+	}
+	provider.mu.Lock()
+	provider.records[dnsRecordKey(fqdn, value)] = cloudflareRecordRef{zoneID: zoneID, recordID: created.ID}
+	provider.mu.Unlock()
+	return nil
+}
+
+func (provider *cloudflareProvider) DeleteTXTRecord(ctx context.Context, fqdn, value string) error {
+	provider.mu.Lock()
+	record, exists := provider.records[dnsRecordKey(fqdn, value)]
+	delete(provider.records, dnsRecordKey(fqdn, value))
+	provider.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	path := "/zones/" + url.PathEscape(record.zoneID) + "/dns_records/" + url.PathEscape(record.recordID)
+	if err := provider.call(ctx, http.MethodDelete, path, nil, nil); err != nil {
+		return fmt.Errorf("delete cloudflare TXT record: %w", err)
+	}
+	return nil
+}
+
+func (provider *cloudflareProvider) findZone(ctx context.Context, fqdn string) (string, error) {
+	if provider.zoneID != "" {
+		return provider.zoneID, nil
+	}
+	for _, candidate := range dnsZoneCandidates(fqdn) {
+		var zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := provider.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", fmt.Errorf("find cloudflare zone: %w", err)
+		}
+		for _, zone := range zones {
+			if strings.EqualFold(zone.Name, candidate) && zone.ID != "" {
+				return zone.ID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no cloudflare zone manages %s", fqdn)
+}
+
+func (provider *cloudflareProvider) call(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(provider.endpoint, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+provider.token)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "OneinStack-Panel/ACME")
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return errors.New("cloudflare API request failed")
+	}
+	defer response.Body.Close()
+	var envelope cloudflareEnvelope
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare API returned HTTP %d", response.StatusCode)
+	}
+	if !envelope.Success || response.StatusCode < 200 || response.StatusCode >= 300 {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("cloudflare API error %d: %s", envelope.Errors[0].Code, envelope.Errors[0].Message)
+		}
+		return fmt.Errorf("cloudflare API returned HTTP %d", response.StatusCode)
+	}
+	if result != nil && len(envelope.Result) > 0 {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tencentCloudDNSEndpoint = "https://dnspod.tencentcloudapi.com"
+	tencentCloudDNSService  = "dnspod"
+	tencentCloudDNSVersion  = "2021-03-23"
+)
+
+// tencentCloudProvider calls the DNSPod API 3.0 signed with TC3-HMAC-SHA256.
+type tencentCloudProvider struct {
+	endpoint  string
+	secretID  string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+
+	mu      sync.Mutex
+	records map[string]tencentCloudRecordRef
+}
+
+type tencentCloudRecordRef struct {
+	domain   string
+	recordID uint64
+}
+
+func newTencentCloudProvider(secretID, secretKey string) *tencentCloudProvider {
+	return &tencentCloudProvider{
+		endpoint:  tencentCloudDNSEndpoint,
+		secretID:  strings.TrimSpace(secretID),
+		secretKey: strings.TrimSpace(secretKey),
+		client:    dnsProviderHTTPClient(),
+		now:       time.Now,
+		records:   make(map[string]tencentCloudRecordRef),
+	}
+}
+
+func (provider *tencentCloudProvider) CreateTXTRecord(ctx context.Context, fqdn, value string) error {
+	domain, err := provider.findDomain(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		RecordID uint64 `json:"RecordId"`
+	}
+	if err := provider.call(ctx, "CreateRecord", map[string]any{
+		"Domain": domain, "SubDomain": relativeRecordName(fqdn, domain),
+		"RecordType": "TXT", "RecordLine": "默认", "Value": value, "TTL": 600,
+	}, &created); err != nil {
+		return fmt.Errorf("create tencentcloud TXT record: %w", err)
+	}
+	if created.RecordID == 0 {
+		return errors.New("create tencentcloud TXT record: empty record ID")
+	}
+	provider.mu.Lock()
+	provider.records[dnsRecordKey(fqdn, value)] = tencentCloudRecordRef{domain: domain, recordID: created.RecordID}
+	provider.mu.Unlock()
+	return nil
+}
+
+func (provider *tencentCloudProvider) DeleteTXTRecord(ctx context.Context, fqdn, value string) error {
+	provider.mu.Lock()
+	record, exists := provider.records[dnsRecordKey(fqdn, value)]
+	delete(provider.records, dnsRecordKey(fqdn, value))
+	provider.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	if err := provider.call(ctx, "DeleteRecord", map[string]any{
+		"Domain": record.domain, "RecordId": record.recordID,
+	}, nil); err != nil {
+		return fmt.Errorf("delete tencentcloud TXT record: %w", err)
+	}
+	return nil
+}
+
+// findDomain picks the longest hosted domain that is a suffix of fqdn.
+func (provider *tencentCloudProvider) findDomain(ctx context.Context, fqdn string) (string, error) {
+	var list struct {
+		DomainList []struct {
+			Name string `json:"Name"`
+		} `json:"DomainList"`
+	}
+	if err := provider.call(ctx, "DescribeDomainList", map[string]any{"Limit": 3000}, &list); err != nil {
+		return "", fmt.Errorf("find tencentcloud DNS domain: %w", err)
+	}
+	hosted := make(map[string]struct{}, len(list.DomainList))
+	for _, domain := range list.DomainList {
+		hosted[strings.ToLower(domain.Name)] = struct{}{}
+	}
+	for _, candidate := range dnsZoneCandidates(fqdn) {
+		if _, exists := hosted[candidate]; exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no tencentcloud DNS domain manages %s", fqdn)
+}
+
+func (provider *tencentCloudProvider) call(ctx context.Context, action string, parameters map[string]any, result any) error {
+	payload, err := json.Marshal(parameters)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if err := provider.sign(request, action, payload); err != nil {
+		return err
+	}
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return errors.New("tencentcloud DNS API request failed")
+	}
+	defer response.Body.Close()
+	var envelope struct {
+		Response json.RawMessage `json:"Response"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("tencentcloud DNS API returned HTTP %d", response.StatusCode)
+	}
+	var apiError struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := json.Unmarshal(envelope.Response, &apiError); err != nil {
+		return fmt.Errorf("tencentcloud DNS API returned HTTP %d", response.StatusCode)
+	}
+	if apiError.Error != nil {
+		return fmt.Errorf("tencentcloud DNS API error %s: %s", apiError.Error.Code, apiError.Error.Message)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("tencentcloud DNS API returned HTTP %d", response.StatusCode)
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Response, result)
+	}
+	return nil
+}
+
+func (provider *tencentCloudProvider) sign(request *http.Request, action string, payload []byte) error {
+	endpoint, err := url.Parse(provider.endpoint)
+	if err != nil {
+		return err
+	}
+	host := endpoint.Host
+	now := provider.now().UTC()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	date := now.Format("2006-01-02")
+	contentType := "application/json; charset=utf-8"
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost, "/", "",
+		"content-type:" + contentType + "\nhost:" + host + "\n",
+		"content-type;host",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + tencentCloudDNSService + "/tc3_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "TC3-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	secretDate := hmacSHA256([]byte("TC3"+provider.secretKey), date)
+	secretService := hmacSHA256(secretDate, tencentCloudDNSService)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	request.Host = host
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("User-Agent", "OneinStack-Panel/ACME")
+	request.Header.Set("X-TC-Action", action)
+	request.Header.Set("X-TC-Timestamp", timestamp)
+	request.Header.Set("X-TC-Version", tencentCloudDNSVersion)
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host, Signature=%s",
+		provider.secretID, scope, signature,
+	))
+	return nil
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
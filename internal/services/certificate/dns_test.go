@@ -0,0 +1,263 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/utils"
+)
+
+func TestDNSZoneHelpers(t *testing.T) {
+	if got := dnsChallengeRecordName("*.Example.com."); got != "_acme-challenge.example.com" {
+		t.Fatalf("wildcard record name = %q", got)
+	}
+	want := []string{"www.example.co.uk", "example.co.uk", "co.uk"}
+	if got := dnsZoneCandidates("_acme-challenge.www.example.co.uk"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone candidates = %v, want %v", got, want)
+	}
+	if got := relativeRecordName("_acme-challenge.www.example.com", "example.com"); got != "_acme-challenge.www" {
+		t.Fatalf("relative record name = %q", got)
+	}
+	if got := relativeRecordName("example.com", "example.com"); got != "@" {
+		t.Fatalf("apex relative record name = %q", got)
+	}
+}
+
+func TestNewDNSChallengeProviderDecryptsCredentials(t *testing.T) {
+	if err := utils.ConfigureCredentialKey(bytes.Repeat([]byte{0x42}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(value string) string {
+		encrypted, err := utils.EncryptCredential(value, utils.CredentialPurposeCertificateDNS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encrypted
+	}
+	account := models.DNSAccount{
+		Provider: "aliyun", Enabled: true, CredentialConfigured: true,
+		CredentialOne: encrypt("access-id"), CredentialTwo: encrypt("access-secret"),
+	}
+	provider, err := NewDNSChallengeProvider(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliyun, ok := provider.(*aliyunProvider)
+	if !ok || aliyun.accessKeyID != "access-id" || aliyun.accessKeySecret != "access-secret" {
+		t.Fatalf("unexpected provider: %#v", provider)
+	}
+
+	account.CredentialTwo = ""
+	if _, err := NewDNSChallengeProvider(account); err == nil {
+		t.Fatal("aliyun account without secret was accepted")
+	}
+	account.Provider = "route53"
+	if _, err := NewDNSChallengeProvider(account); err == nil {
+		t.Fatal("unsupported provider was accepted")
+	}
+	account.Provider = "cloudflare"
+	account.Enabled = false
+	if _, err := NewDNSChallengeProvider(account); err == nil {
+		t.Fatal("disabled account was accepted")
+	}
+}
+
+func TestWaitForTXTRecordPollsUntilVisible(t *testing.T) {
+	resolver := newFakeDNSProvider()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = resolver.CreateTXTRecord(context.Background(), "_acme-challenge.example.com", "token")
+	}()
+	if err := waitForTXTRecord(context.Background(), resolver, "_acme-challenge.example.com", "token",
+		time.Second, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloudflareProviderCreatesAndDeletesRecord(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cf-token" {
+			t.Errorf("missing bearer token")
+		}
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("name") == "example.com":
+			_, _ = io.WriteString(w, `{"success":true,"result":[{"id":"zone-1","name":"example.com"}]}`)
+		case r.Method == http.MethodGet:
+			_, _ = io.WriteString(w, `{"success":true,"result":[]}`)
+		case r.Method == http.MethodPost:
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["type"] != "TXT" || body["name"] != "_acme-challenge.www.example.com" || body["content"] != "value" {
+				t.Errorf("unexpected record body: %v", body)
+			}
+			_, _ = io.WriteString(w, `{"success":true,"result":{"id":"record-1"}}`)
+		case r.Method == http.MethodDelete:
+			_, _ = io.WriteString(w, `{"success":true,"result":{"id":"record-1"}}`)
+		}
+	}))
+	defer server.Close()
+
+	provider := newCloudflareProvider("cf-token", "")
+	provider.endpoint = server.URL
+	ctx := context.Background()
+	if err := provider.CreateTXTRecord(ctx, "_acme-challenge.www.example.com", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteTXTRecord(ctx, "_acme-challenge.www.example.com", "value"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /zones?name=www.example.com",
+		"GET /zones?name=example.com",
+		"POST /zones/zone-1/dns_records",
+		"DELETE /zones/zone-1/dns_records/record-1",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestCloudflareProviderReportsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+	}))
+	defer server.Close()
+	provider := newCloudflareProvider("bad", "zone-1")
+	provider.endpoint = server.URL
+	err := provider.CreateTXTRecord(context.Background(), "_acme-challenge.example.com", "value")
+	if err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Fatalf("expected API error, got %v", err)
+	}
+}
+
+func TestAliyunProviderSignsRequests(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		signature := query.Get("Signature")
+		query.Del("Signature")
+		pairs := make([]string, 0, len(query))
+		for _, key := range sortedKeys(query) {
+			pairs = append(pairs, aliyunPercentEncode(key)+"="+aliyunPercentEncode(query.Get(key)))
+		}
+		mac := hmac.New(sha1.New, []byte("secret&"))
+		_, _ = mac.Write([]byte("GET&%2F&" + aliyunPercentEncode(strings.Join(pairs, "&"))))
+		if signature != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("invalid signature for %s", query.Get("Action"))
+		}
+		actions = append(actions, query.Get("Action"))
+		switch query.Get("Action") {
+		case "GetMainDomainName":
+			_, _ = io.WriteString(w, `{"DomainName":"example.com","RR":"_acme-challenge.www"}`)
+		case "AddDomainRecord":
+			if query.Get("RR") != "_acme-challenge.www" || query.Get("Type") != "TXT" {
+				t.Errorf("unexpected record: %v", query)
+			}
+			_, _ = io.WriteString(w, `{"RecordId":"42"}`)
+		case "DeleteDomainRecord":
+			if query.Get("RecordId") != "42" {
+				t.Errorf("unexpected record ID %q", query.Get("RecordId"))
+			}
+			_, _ = io.WriteString(w, `{"RecordId":"42"}`)
+		}
+	}))
+	defer server.Close()
+
+	provider := newAliyunProvider("id", "secret")
+	provider.endpoint = server.URL + "/"
+	ctx := context.Background()
+	if err := provider.CreateTXTRecord(ctx, "_acme-challenge.www.example.com", "a value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteTXTRecord(ctx, "_acme-challenge.www.example.com", "a value"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"GetMainDomainName", "AddDomainRecord", "DeleteDomainRecord"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+}
+
+func TestTencentCloudProviderUsesLongestHostedDomain(t *testing.T) {
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "TC3-HMAC-SHA256 Credential=sid/") ||
+			!strings.Contains(authorization, "/dnspod/tc3_request") {
+			t.Errorf("unexpected authorization header %q", authorization)
+		}
+		action := r.Header.Get("X-TC-Action")
+		actions = append(actions, action)
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch action {
+		case "DescribeDomainList":
+			_, _ = io.WriteString(w, `{"Response":{"DomainList":[{"Name":"example.com"},{"Name":"dev.example.com"}]}}`)
+		case "CreateRecord":
+			if body["Domain"] != "dev.example.com" || body["SubDomain"] != "_acme-challenge.api" {
+				t.Errorf("unexpected record: %v", body)
+			}
+			_, _ = io.WriteString(w, `{"Response":{"RecordId":7}}`)
+		case "DeleteRecord":
+			if body["RecordId"] != float64(7) {
+				t.Errorf("unexpected record ID %v", body["RecordId"])
+			}
+			_, _ = io.WriteString(w, `{"Response":{}}`)
+		}
+	}))
+	defer server.Close()
+
+	provider := newTencentCloudProvider("sid", "skey")
+	provider.endpoint = server.URL
+	ctx := context.Background()
+	if err := provider.CreateTXTRecord(ctx, "_acme-challenge.api.dev.example.com", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteTXTRecord(ctx, "_acme-challenge.api.dev.example.com", "value"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DescribeDomainList", "CreateRecord", "DeleteRecord"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+}
+
+func TestTencentCloudProviderReportsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"Response":{"Error":{"Code":"AuthFailure","Message":"signature expired"}}}`)
+	}))
+	defer server.Close()
+	provider := newTencentCloudProvider("sid", "skey")
+	provider.endpoint = server.URL
+	err := provider.CreateTXTRecord(context.Background(), "_acme-challenge.example.com", "value")
+	if err == nil || !strings.Contains(err.Error(), "AuthFailure") {
+		t.Fatalf("expected API error, got %v", err)
+	}
+}
+
+func sortedKeys(values url.Values) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -16,6 +17,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/acme"
 )
@@ -30,6 +32,17 @@ type IssueRequest struct {
 	Domains        []string
 	AccountKeyPath string
 	ChallengeRoot  string
+	// ChallengeType selects http-01 (default), dns-01 or auto, which picks
+	// dns-01 for wildcard identifiers and http-01 for the rest. DNSProvider
+	// is required whenever an identifier is validated with dns-01.
+	ChallengeType string
+	DNSProvider   DNSChallengeProvider
+	// EABKeyID and EABHMACKey bind a new ACME account to an external CA
+	// account. RootCAs trusts a private CA's directory in addition to the
+	// system roots.
+	EABKeyID   string
+	EABHMACKey []byte
+	RootCAs    *x509.CertPool
 }
 
 type IssuedCertificate struct {
@@ -43,6 +56,22 @@ type Issuer interface {
 
 type ACMEIssuer struct {
 	HTTPClient *http.Client
+	// Resolver checks dns-01 TXT propagation before the CA is asked to
+	// validate. Nil uses the system resolver.
+	Resolver            TXTResolver
+	PropagationTimeout  time.Duration
+	PropagationInterval time.Duration
+}
+
+// preparedChallenge is a published challenge response waiting for the CA.
+// cleanup is cleared once it has run so it is never executed twice.
+type preparedChallenge struct {
+	authorizationURL string
+	domain           string
+	challenge        *acme.Challenge
+	recordName       string
+	recordValue      string
+	cleanup          func(context.Context) error
 }
 
 func (issuer *ACMEIssuer) Issue(
@@ -61,13 +90,18 @@ func (issuer *ACMEIssuer) Issue(
 	}
 	client := &acme.Client{
 		Key:          accountKey,
-		HTTPClient:   issuer.HTTPClient,
+		HTTPClient:   issuer.httpClient(request.RootCAs),
 		DirectoryURL: request.DirectoryURL,
 		UserAgent:    "OneinStack-Panel/ACME",
 	}
-	_, err = client.Register(ctx, &acme.Account{
-		Contact: []string{"mailto:" + request.Email},
-	}, acme.AcceptTOS)
+	account := &acme.Account{Contact: []string{"mailto:" + request.Email}}
+	if request.EABKeyID != "" {
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: request.EABKeyID,
+			Key: request.EABHMACKey,
+		}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
 	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
 		return nil, fmt.Errorf("register ACME account: %w", err)
 	}
@@ -82,15 +116,13 @@ func (issuer *ACMEIssuer) Issue(
 		return nil, fmt.Errorf("create ACME order: %w", err)
 	}
 
-	challengeDirectory := filepath.Join(
-		filepath.Clean(request.ChallengeRoot),
-		".well-known",
-		"acme-challenge",
-	)
-	if err := os.MkdirAll(challengeDirectory, 0755); err != nil {
-		return nil, fmt.Errorf("create ACME challenge directory: %w", err)
-	}
-	for index, authorizationURL := range order.AuthzURLs {
+	challenges := make([]*preparedChallenge, 0, len(order.AuthzURLs))
+	defer func() {
+		cleanupContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = cleanupChallenges(cleanupContext, challenges)
+	}()
+	for _, authorizationURL := range order.AuthzURLs {
 		authorization, err := client.GetAuthorization(ctx, authorizationURL)
 		if err != nil {
 			return nil, fmt.Errorf("read ACME authorization: %w", err)
@@ -98,34 +130,28 @@ func (issuer *ACMEIssuer) Issue(
 		if authorization.Status == acme.StatusValid {
 			continue
 		}
-		challenge := findHTTPChallenge(authorization)
-		if challenge == nil {
-			return nil, fmt.Errorf("ACME server did not offer http-01 for %s", authorization.Identifier.Value)
-		}
-		if !challengeTokenPattern.MatchString(challenge.Token) {
-			return nil, errors.New("ACME server returned an unsafe challenge token")
-		}
-		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		prepared, err := issuer.prepareChallenge(ctx, client, request, authorization)
 		if err != nil {
-			return nil, fmt.Errorf("create ACME challenge response: %w", err)
-		}
-		challengePath := filepath.Join(challengeDirectory, challenge.Token)
-		if err := writeFileAtomic(challengePath, []byte(response), 0644); err != nil {
-			return nil, fmt.Errorf("publish ACME challenge: %w", err)
+			return nil, err
 		}
-		report(25+(index*35/max(1, len(order.AuthzURLs))), "正在验证域名 "+authorization.Identifier.Value)
-		_, acceptErr := client.Accept(ctx, challenge)
+		challenges = append(challenges, prepared)
+	}
+	if err := issuer.waitForDNSRecords(ctx, challenges, report); err != nil {
+		return nil, err
+	}
+	for index, prepared := range challenges {
+		report(25+(index*35/max(1, len(challenges))), "正在验证域名 "+prepared.domain)
+		_, acceptErr := client.Accept(ctx, prepared.challenge)
 		if acceptErr == nil {
-			_, acceptErr = client.WaitAuthorization(ctx, authorizationURL)
+			_, acceptErr = client.WaitAuthorization(ctx, prepared.authorizationURL)
 		}
-		removeErr := os.Remove(challengePath)
 		if acceptErr != nil {
-			return nil, fmt.Errorf("validate domain %s: %w", authorization.Identifier.Value, acceptErr)
-		}
-		if removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
-			return nil, fmt.Errorf("remove ACME challenge: %w", removeErr)
+			return nil, fmt.Errorf("validate domain %s: %w", prepared.domain, acceptErr)
 		}
 	}
+	if err := cleanupChallenges(ctx, challenges); err != nil {
+		return nil, fmt.Errorf("remove ACME challenge: %w", err)
+	}
 
 	report(65, "域名验证完成，正在生成证书私钥")
 	readyOrder, err := client.WaitOrder(ctx, order.URI)
@@ -183,15 +209,33 @@ func validateIssueRequest(request IssueRequest) error {
 	if len(request.Domains) == 0 || len(request.Domains) > 100 {
 		return errors.New("between 1 and 100 certificate domains are required")
 	}
+	challengeType, err := normalizeChallengeType(request.ChallengeType)
+	if err != nil {
+		return err
+	}
+	if (strings.TrimSpace(request.EABKeyID) == "") != (len(request.EABHMACKey) == 0) {
+		return errors.New("ACME external account binding requires both a key ID and an HMAC key")
+	}
 	for _, domain := range request.Domains {
-		if strings.TrimSpace(domain) == "" || strings.Contains(domain, "*") {
+		if strings.TrimSpace(domain) == "" {
+			return errors.New("certificate domain is required")
+		}
+		if identifierChallengeType(challengeType, domain) == ChallengeTypeHTTP01 && strings.Contains(domain, "*") {
 			return errors.New("HTTP-01 certificate issuance does not support wildcard domains")
 		}
+		if strings.Contains(strings.TrimPrefix(domain, "*."), "*") {
+			return fmt.Errorf("certificate domain %q is invalid", domain)
+		}
 	}
-	for label, value := range map[string]string{
-		"account key":    request.AccountKeyPath,
-		"challenge root": request.ChallengeRoot,
-	} {
+	paths := map[string]string{"account key": request.AccountKeyPath}
+	usesHTTP, usesDNS := orderChallengeTypes(challengeType, request.Domains)
+	if usesHTTP {
+		paths["challenge root"] = request.ChallengeRoot
+	}
+	if usesDNS && request.DNSProvider == nil {
+		return errors.New("DNS-01 certificate issuance requires a DNS provider")
+	}
+	for label, value := range paths {
 		cleaned := filepath.Clean(strings.TrimSpace(value))
 		if !filepath.IsAbs(cleaned) || cleaned == string(filepath.Separator) {
 			return fmt.Errorf("%s path must be a non-root absolute path", label)
@@ -200,12 +244,134 @@ func validateIssueRequest(request IssueRequest) error {
 	return nil
 }
 
-func findHTTPChallenge(authorization *acme.Authorization) *acme.Challenge {
+// httpClient returns the configured client, or one that also trusts rootCAs
+// for a private CA profile.
+func (issuer *ACMEIssuer) httpClient(rootCAs *x509.CertPool) *http.Client {
+	if rootCAs == nil {
+		return issuer.HTTPClient
+	}
+	client := &http.Client{}
+	if issuer.HTTPClient != nil {
+		copied := *issuer.HTTPClient
+		client = &copied
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if configured, ok := client.Transport.(*http.Transport); ok && configured != nil {
+		transport = configured.Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = rootCAs
+	client.Transport = transport
+	return client
+}
+
+func (issuer *ACMEIssuer) prepareChallenge(
+	ctx context.Context,
+	client *acme.Client,
+	request IssueRequest,
+	authorization *acme.Authorization,
+) (*preparedChallenge, error) {
+	domain := authorization.Identifier.Value
+	if authorization.Wildcard && !strings.HasPrefix(domain, "*.") {
+		domain = "*." + domain
+	}
+	requested, _ := normalizeChallengeType(request.ChallengeType)
+	challengeType := identifierChallengeType(requested, domain)
+	challenge := findChallenge(authorization, challengeType)
+	if challenge == nil {
+		return nil, fmt.Errorf("ACME server did not offer %s for %s", challengeType, domain)
+	}
+	if !challengeTokenPattern.MatchString(challenge.Token) {
+		return nil, errors.New("ACME server returned an unsafe challenge token")
+	}
+	prepared := &preparedChallenge{
+		authorizationURL: authorization.URI,
+		domain:           domain,
+		challenge:        challenge,
+	}
+	if challengeType == ChallengeTypeDNS01 {
+		value, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return nil, fmt.Errorf("create ACME challenge response: %w", err)
+		}
+		prepared.recordName = dnsChallengeRecordName(domain)
+		prepared.recordValue = value
+		if err := request.DNSProvider.CreateTXTRecord(ctx, prepared.recordName, value); err != nil {
+			return nil, fmt.Errorf("publish DNS challenge for %s: %w", domain, err)
+		}
+		prepared.cleanup = func(cleanupContext context.Context) error {
+			return request.DNSProvider.DeleteTXTRecord(cleanupContext, prepared.recordName, value)
+		}
+		return prepared, nil
+	}
+	challengeDirectory := filepath.Join(
+		filepath.Clean(request.ChallengeRoot),
+		".well-known",
+		"acme-challenge",
+	)
+	if err := os.MkdirAll(challengeDirectory, 0755); err != nil {
+		return nil, fmt.Errorf("create ACME challenge directory: %w", err)
+	}
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return nil, fmt.Errorf("create ACME challenge response: %w", err)
+	}
+	challengePath := filepath.Join(challengeDirectory, challenge.Token)
+	if err := writeFileAtomic(challengePath, []byte(response), 0644); err != nil {
+		return nil, fmt.Errorf("publish ACME challenge: %w", err)
+	}
+	prepared.cleanup = func(context.Context) error {
+		if err := os.Remove(challengePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return prepared, nil
+}
+
+func (issuer *ACMEIssuer) waitForDNSRecords(
+	ctx context.Context,
+	challenges []*preparedChallenge,
+	report ProgressReporter,
+) error {
+	for _, prepared := range challenges {
+		if prepared.recordName == "" {
+			continue
+		}
+		report(24, "正在等待 DNS 记录生效 "+prepared.recordName)
+		if err := waitForTXTRecord(
+			ctx, issuer.Resolver, prepared.recordName, prepared.recordValue,
+			issuer.PropagationTimeout, issuer.PropagationInterval,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cleanupChallenges(ctx context.Context, challenges []*preparedChallenge) error {
+	var cleanupErr error
+	for _, prepared := range challenges {
+		if prepared == nil || prepared.cleanup == nil {
+			continue
+		}
+		cleanup := prepared.cleanup
+		prepared.cleanup = nil
+		if err := cleanup(ctx); err != nil {
+			cleanupErr = errors.Join(cleanupErr, err)
+		}
+	}
+	return cleanupErr
+}
+
+func findChallenge(authorization *acme.Authorization, challengeType string) *acme.Challenge {
 	if authorization == nil {
 		return nil
 	}
 	for _, challenge := range authorization.Challenges {
-		if challenge != nil && challenge.Type == "http-01" {
+		if challenge != nil && challenge.Type == challengeType {
 			return challenge
 		}
 	}
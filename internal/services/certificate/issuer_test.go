@@ -1,11 +1,15 @@
 package certificate
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadOrCreateACMEAccountKeyIsStableAndPrivate(t *testing.T) {
@@ -73,10 +77,208 @@ func TestValidateIssueRequestRejectsUnsafeHTTP01Inputs(t *testing.T) {
 			value.ChallengeRoot = "/"
 			return value
 		}(),
+		func() IssueRequest {
+			value := valid
+			value.ChallengeType = ChallengeTypeDNS01
+			return value
+		}(),
+		func() IssueRequest {
+			value := valid
+			value.ChallengeType = "tls-alpn-01"
+			return value
+		}(),
 	}
 	for index, request := range cases {
 		if err := validateIssueRequest(request); err == nil {
 			t.Fatalf("unsafe case %d unexpectedly passed validation", index)
 		}
 	}
+	wildcard := valid
+	wildcard.ChallengeType = ChallengeTypeDNS01
+	wildcard.DNSProvider = newFakeDNSProvider()
+	wildcard.ChallengeRoot = ""
+	wildcard.Domains = []string{"*.example.com", "example.com"}
+	if err := validateIssueRequest(wildcard); err != nil {
+		t.Fatalf("DNS-01 wildcard request was rejected: %v", err)
+	}
+	mixed := wildcard
+	mixed.ChallengeType = ChallengeTypeAuto
+	if err := validateIssueRequest(mixed); err == nil {
+		t.Fatal("mixed order without an HTTP-01 challenge root passed validation")
+	}
+	mixed.ChallengeRoot = valid.ChallengeRoot
+	if err := validateIssueRequest(mixed); err != nil {
+		t.Fatalf("mixed order was rejected: %v", err)
+	}
+	mixed.DNSProvider = nil
+	if err := validateIssueRequest(mixed); err == nil {
+		t.Fatal("mixed wildcard order without a DNS provider passed validation")
+	}
+	mixed.Domains = []string{"example.com"}
+	if err := validateIssueRequest(mixed); err != nil {
+		t.Fatalf("auto order without wildcards required a DNS provider: %v", err)
+	}
+}
+
+func TestACMEIssuerIssuesCertificateWithDNS01Challenge(t *testing.T) {
+	provider := newFakeDNSProvider()
+	ca := newTestACMEServer(t, provider, "")
+	issuer := &ACMEIssuer{Resolver: provider, PropagationInterval: 10 * time.Millisecond}
+	var messages []string
+	issued, err := issuer.Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        []string{"example.com", "www.example.com"},
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeType:  ChallengeTypeDNS01,
+		DNSProvider:    provider,
+	}, func(_ int, message string) { messages = append(messages, message) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := validateIssuedCertificate(issued, []string{"example.com", "www.example.com"})
+	if err != nil {
+		t.Fatalf("issued certificate is invalid: %v", err)
+	}
+	if leaf.Issuer.CommonName != "OneinStack Test CA" {
+		t.Fatalf("unexpected issuer: %s", leaf.Issuer)
+	}
+	want := []string{"dns-01:example.com", "dns-01:www.example.com"}
+	if got := ca.validatedChallenges(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("validated challenges = %v, want %v", got, want)
+	}
+	if provider.created != 2 || provider.deleted != 2 || provider.recordCount() != 0 {
+		t.Fatalf("TXT records were not cleaned up: created=%d deleted=%d left=%d",
+			provider.created, provider.deleted, provider.recordCount())
+	}
+	if !strings.Contains(strings.Join(messages, "\n"), "正在等待 DNS 记录生效 _acme-challenge.example.com") {
+		t.Fatalf("propagation progress was not reported: %v", messages)
+	}
+}
+
+func TestACMEIssuerSelectsChallengePerIdentifier(t *testing.T) {
+	provider := newFakeDNSProvider()
+	challengeRoot := t.TempDir()
+	ca := newTestACMEServer(t, provider, challengeRoot)
+	issuer := &ACMEIssuer{Resolver: provider, PropagationInterval: 10 * time.Millisecond}
+	domains := []string{"*.example.com", "example.com", "www.example.com"}
+	issued, err := issuer.Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        domains,
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeRoot:  challengeRoot,
+		ChallengeType:  ChallengeTypeAuto,
+		DNSProvider:    provider,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := validateIssuedCertificate(issued, domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("tenant.example.com"); err != nil {
+		t.Fatalf("wildcard SAN does not cover a tenant subdomain: %v", err)
+	}
+	want := []string{"dns-01:*.example.com", "http-01:example.com", "http-01:www.example.com"}
+	if got := ca.validatedChallenges(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("validated challenges = %v, want %v", got, want)
+	}
+	if provider.created != 1 || provider.recordCount() != 0 {
+		t.Fatalf("unexpected DNS records: created=%d left=%d", provider.created, provider.recordCount())
+	}
+}
+
+func TestACMEIssuerRemovesDNSRecordsWhenValidationFails(t *testing.T) {
+	provider := newFakeDNSProvider()
+	// The CA cannot see the provider's records, as with a stale secondary.
+	ca := newTestACMEServer(t, nil, "")
+	issuer := &ACMEIssuer{Resolver: provider, PropagationInterval: 10 * time.Millisecond}
+	_, err := issuer.Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        []string{"example.com"},
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeType:  ChallengeTypeDNS01,
+		DNSProvider:    provider,
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "validate domain example.com") {
+		t.Fatalf("expected validation failure, got %v", err)
+	}
+	if provider.created != 1 || provider.recordCount() != 0 {
+		t.Fatalf("TXT record was left behind: created=%d left=%d", provider.created, provider.recordCount())
+	}
+}
+
+func TestACMEIssuerTimesOutWaitingForDNSPropagation(t *testing.T) {
+	provider := newFakeDNSProvider()
+	ca := newTestACMEServer(t, provider, "")
+	issuer := &ACMEIssuer{
+		Resolver:            newFakeDNSProvider(),
+		PropagationTimeout:  50 * time.Millisecond,
+		PropagationInterval: 10 * time.Millisecond,
+	}
+	_, err := issuer.Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        []string{"example.com"},
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeType:  ChallengeTypeDNS01,
+		DNSProvider:    provider,
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "did not propagate") {
+		t.Fatalf("expected propagation timeout, got %v", err)
+	}
+	if len(ca.validatedChallenges()) != 0 || provider.recordCount() != 0 {
+		t.Fatal("CA validated or TXT record was left behind after a propagation timeout")
+	}
+}
+
+func TestACMEIssuerIssuesCertificateWithHTTP01Challenge(t *testing.T) {
+	challengeRoot := t.TempDir()
+	ca := newTestACMEServer(t, nil, challengeRoot)
+	issued, err := (&ACMEIssuer{}).Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        []string{"example.com"},
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeRoot:  challengeRoot,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validateIssuedCertificate(issued, []string{"example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(challengeRoot, ".well-known", "acme-challenge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("HTTP-01 challenge files were left behind: %d", len(entries))
+	}
+}
+
+func TestACMEIssuerRegistersWithExternalAccountBinding(t *testing.T) {
+	challengeRoot := t.TempDir()
+	ca := newTestACMEServer(t, nil, challengeRoot)
+	issued, err := (&ACMEIssuer{}).Issue(context.Background(), IssueRequest{
+		DirectoryURL:   ca.directoryURL(),
+		Email:          "admin@example.com",
+		Domains:        []string{"example.com"},
+		AccountKeyPath: filepath.Join(t.TempDir(), "account.key"),
+		ChallengeRoot:  challengeRoot,
+		EABKeyID:       "kid-1",
+		EABHMACKey:     []byte("secret-hmac-key"),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validateIssuedCertificate(issued, []string{"example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if kids := ca.externalAccountKeyIDs(); len(kids) != 1 || kids[0] != "kid-1" {
+		t.Fatalf("external account bindings = %v", kids)
+	}
 }
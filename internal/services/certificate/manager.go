@@ -2,10 +2,8 @@ package certificate
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -20,6 +18,7 @@ import (
 	"time"
 
 	"oneinstack/internal/models"
+	"oneinstack/utils"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -45,6 +44,18 @@ type IssueOptions struct {
 	RenewBeforeDays int
 	ForceHTTPS      bool
 	RequestedBy     int64
+	ChallengeType   string
+	DNSAccountID    string
+	// ACMEAccountID selects a stored CA profile; empty uses the panel-wide
+	// ACME directory.
+	ACMEAccountID string
+}
+
+// RenewOptions overrides the CA profile for one renewal. The profile of a
+// successful renewal is kept for later scheduled renewals.
+type RenewOptions struct {
+	ACMEAccountID string
+	RequestedBy   int64
 }
 
 type TaskListOptions struct {
@@ -74,6 +85,7 @@ type Manager struct {
 	issueTimeout    time.Duration
 	issuer          Issuer
 	deployer        Deployer
+	dnsProviders    DNSProviderFactory
 	queue           chan string
 	stopCh          chan struct{}
 
@@ -102,6 +114,7 @@ func NewManager(
 		issueTimeout:    issueTimeout,
 		issuer:          issuer,
 		deployer:        deployer,
+		dnsProviders:    NewDNSChallengeProvider,
 		queue:           make(chan string, certificateQueueSize),
 		stopCh:          make(chan struct{}),
 		cancels:         make(map[string]context.CancelFunc),
@@ -176,6 +189,17 @@ func (manager *Manager) SubmitIssue(options IssueOptions) (*models.CertificateTa
 	if options.WebsiteID <= 0 {
 		return nil, errors.New("website is required")
 	}
+	profile, err := manager.validateACMEAccount(options.ACMEAccountID)
+	if err != nil {
+		return nil, err
+	}
+	directoryURL := manager.directoryURL
+	if profile != nil {
+		directoryURL = profile.DirectoryURL
+		if strings.TrimSpace(options.Email) == "" {
+			options.Email = profile.Email
+		}
+	}
 	email, err := normalizeEmail(options.Email)
 	if err != nil {
 		return nil, err
@@ -186,11 +210,20 @@ func (manager *Manager) SubmitIssue(options IssueOptions) (*models.CertificateTa
 	if options.RenewBeforeDays < 1 || options.RenewBeforeDays > 90 {
 		return nil, errors.New("renew-before days must be between 1 and 90")
 	}
+	challengeType, err := normalizeChallengeType(options.ChallengeType)
+	if err != nil {
+		return nil, err
+	}
 	var website models.Website
 	if err := manager.db.First(&website, "id = ?", options.WebsiteID).Error; err != nil {
 		return nil, err
 	}
-	domains, err := certificateDomains(website.Domain)
+	domains, err := certificateDomains(website.Domain, challengeType != ChallengeTypeHTTP01)
+	if err != nil {
+		return nil, err
+	}
+	_, usesDNS := orderChallengeTypes(challengeType, domains)
+	dnsAccountID, err := manager.validateDNSAccount(usesDNS, options.DNSAccountID)
 	if err != nil {
 		return nil, err
 	}
@@ -200,7 +233,10 @@ func (manager *Manager) SubmitIssue(options IssueOptions) (*models.CertificateTa
 		WebsiteName:     website.Name,
 		Email:           email,
 		Domains:         strings.Join(domains, ","),
-		DirectoryURL:    manager.directoryURL,
+		DirectoryURL:    directoryURL,
+		ChallengeType:   challengeType,
+		DNSAccountID:    dnsAccountID,
+		ACMEAccountID:   acmeAccountID(profile),
 		AutoRenew:       options.AutoRenew,
 		RenewBeforeDays: options.RenewBeforeDays,
 		ForceHTTPS:      options.ForceHTTPS,
@@ -209,6 +245,10 @@ func (manager *Manager) SubmitIssue(options IssueOptions) (*models.CertificateTa
 }
 
 func (manager *Manager) SubmitRenew(certificateID string, requestedBy int64) (*models.CertificateTask, error) {
+	return manager.SubmitRenewWithOptions(certificateID, RenewOptions{RequestedBy: requestedBy})
+}
+
+func (manager *Manager) SubmitRenewWithOptions(certificateID string, options RenewOptions) (*models.CertificateTask, error) {
 	if err := manager.Start(); err != nil {
 		return nil, err
 	}
@@ -219,18 +259,41 @@ func (manager *Manager) SubmitRenew(certificateID string, requestedBy int64) (*m
 	if certificate.Status == models.CertificateStatusDisabled {
 		return nil, errors.New("disabled certificate cannot be renewed")
 	}
+	if isBoundProjection(&certificate) {
+		return nil, errors.New("shared certificate is renewed through the website that issued it")
+	}
 	var website models.Website
 	if err := manager.db.First(&website, "id = ?", certificate.WebsiteID).Error; err != nil {
 		return nil, err
 	}
-	currentDomains, err := certificateDomains(website.Domain)
+	challengeType, err := normalizeChallengeType(certificate.ChallengeType)
+	if err != nil {
+		return nil, err
+	}
+	currentDomains, err := certificateDomains(website.Domain, challengeType != ChallengeTypeHTTP01)
 	if err != nil {
 		return nil, err
 	}
 	if !sameDomains(strings.Split(certificate.Domains, ","), currentDomains) {
 		return nil, errors.New("website domains changed; request a new certificate instead of renewing")
 	}
+	_, usesDNS := orderChallengeTypes(challengeType, currentDomains)
+	dnsAccountID, err := manager.validateDNSAccount(usesDNS, certificate.DNSAccountID)
+	if err != nil {
+		return nil, err
+	}
+	profileID := certificate.ACMEAccountID
+	if strings.TrimSpace(options.ACMEAccountID) != "" {
+		profileID = options.ACMEAccountID
+	}
+	profile, err := manager.validateACMEAccount(profileID)
+	if err != nil {
+		return nil, err
+	}
 	directoryURL := strings.TrimSpace(certificate.DirectoryURL)
+	if profile != nil {
+		directoryURL = profile.DirectoryURL
+	}
 	if directoryURL == "" {
 		directoryURL = manager.directoryURL
 	}
@@ -242,10 +305,13 @@ func (manager *Manager) SubmitRenew(certificateID string, requestedBy int64) (*m
 		Email:           certificate.Email,
 		Domains:         strings.Join(currentDomains, ","),
 		DirectoryURL:    directoryURL,
+		ChallengeType:   challengeType,
+		DNSAccountID:    dnsAccountID,
+		ACMEAccountID:   acmeAccountID(profile),
 		AutoRenew:       certificate.AutoRenew,
 		RenewBeforeDays: certificate.RenewBeforeDays,
 		ForceHTTPS:      certificate.ForceHTTPS,
-		RequestedBy:     requestedBy,
+		RequestedBy:     options.RequestedBy,
 	})
 }
 
@@ -315,6 +381,95 @@ func (manager *Manager) SubmitManagedBind(managedID string, websiteID int64, for
 	})
 }
 
+// validateDNSAccount returns the account ID to store on a task whose order
+// validates at least one identifier with dns-01, and rejects disabled or
+// incomplete accounts before anything is queued.
+func (manager *Manager) validateDNSAccount(required bool, accountID string) (string, error) {
+	if !required {
+		return "", nil
+	}
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return "", errors.New("DNS account is required for DNS-01 issuance")
+	}
+	var account models.DNSAccount
+	if err := manager.db.First(&account, "id = ?", accountID).Error; err != nil {
+		return "", err
+	}
+	if !account.Enabled {
+		return "", errors.New("DNS account is disabled")
+	}
+	if !account.CredentialConfigured {
+		return "", errors.New("DNS account credential is required")
+	}
+	return account.ID, nil
+}
+
+// validateACMEAccount loads the selected CA profile. An empty ID selects the
+// panel-wide directory and returns nil.
+func (manager *Manager) validateACMEAccount(accountID string) (*models.ACMEAccount, error) {
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return nil, nil
+	}
+	var account models.ACMEAccount
+	if err := manager.db.First(&account, "id = ?", accountID).Error; err != nil {
+		return nil, err
+	}
+	if !account.Enabled {
+		return nil, errors.New("ACME account is disabled")
+	}
+	return &account, nil
+}
+
+// configureACMEAccount applies the task's CA profile to request, decrypting
+// the EAB key only for the duration of the task.
+func (manager *Manager) configureACMEAccount(request *IssueRequest, accountID string) error {
+	profile, err := manager.validateACMEAccount(accountID)
+	if err != nil || profile == nil {
+		return err
+	}
+	request.DirectoryURL = profile.DirectoryURL
+	request.AccountKeyPath = acmeAccountKeyPath(manager.certificateRoot, profile.DirectoryURL, profile.ID)
+	if profile.EABConfigured {
+		encoded, err := utils.DecryptCredential(profile.EABHMACKey, utils.CredentialPurposeCertificateACME)
+		if err != nil {
+			return fmt.Errorf("decrypt ACME EAB key: %w", err)
+		}
+		key, err := decodeEABHMACKey(encoded)
+		if err != nil {
+			return err
+		}
+		request.EABKeyID, request.EABHMACKey = profile.EABKeyID, key
+	}
+	if profile.CABundle != "" {
+		pool, err := acmeRootCAs(profile.CABundle)
+		if err != nil {
+			return err
+		}
+		request.RootCAs = pool
+	}
+	return nil
+}
+
+func acmeAccountID(profile *models.ACMEAccount) string {
+	if profile == nil {
+		return ""
+	}
+	return profile.ID
+}
+
+func (manager *Manager) dnsProvider(accountID string) (DNSChallengeProvider, error) {
+	if manager.dnsProviders == nil {
+		return nil, errors.New("DNS challenge providers are not configured")
+	}
+	var account models.DNSAccount
+	if err := manager.db.First(&account, "id = ?", strings.TrimSpace(accountID)).Error; err != nil {
+		return nil, fmt.Errorf("load DNS account: %w", err)
+	}
+	return manager.dnsProviders(account)
+}
+
 func (manager *Manager) submit(task *models.CertificateTask) (*models.CertificateTask, error) {
 	if manager.stopping.Load() {
 		return nil, errors.New("certificate task manager is stopping")
@@ -429,18 +584,34 @@ func (manager *Manager) run(taskID string) {
 		manager.runManagedTask(ctx, &task, report)
 		return
 	}
-	if err := manager.deployer.EnsureChallenge(ctx, task.WebsiteID); err != nil {
-		manager.failTask(&task, "CHALLENGE_CONFIG_FAILED", fmt.Errorf("publish HTTP-01 route: %w", err))
-		return
-	}
-	directoryHash := sha256.Sum256([]byte(task.DirectoryURL))
-	issued, err := manager.issuer.Issue(ctx, IssueRequest{
+	issueRequest := IssueRequest{
 		DirectoryURL:   task.DirectoryURL,
 		Email:          task.Email,
 		Domains:        strings.Split(task.Domains, ","),
-		AccountKeyPath: filepath.Join(manager.certificateRoot, "accounts", hex.EncodeToString(directoryHash[:16])+".key"),
+		AccountKeyPath: acmeAccountKeyPath(manager.certificateRoot, task.DirectoryURL, ""),
 		ChallengeRoot:  manager.challengeRoot,
-	}, report)
+		ChallengeType:  task.ChallengeType,
+	}
+	if err := manager.configureACMEAccount(&issueRequest, task.ACMEAccountID); err != nil {
+		manager.failTask(&task, "ACME_ACCOUNT_UNAVAILABLE", err)
+		return
+	}
+	usesHTTP, usesDNS := orderChallengeTypes(task.ChallengeType, issueRequest.Domains)
+	if usesDNS {
+		provider, err := manager.dnsProvider(task.DNSAccountID)
+		if err != nil {
+			manager.failTask(&task, "DNS_PROVIDER_UNAVAILABLE", err)
+			return
+		}
+		issueRequest.DNSProvider = provider
+	}
+	if usesHTTP {
+		if err := manager.deployer.EnsureChallenge(ctx, task.WebsiteID); err != nil {
+			manager.failTask(&task, "CHALLENGE_CONFIG_FAILED", fmt.Errorf("publish HTTP-01 route: %w", err))
+			return
+		}
+	}
+	issued, err := manager.issuer.Issue(ctx, issueRequest, report)
 	if err != nil {
 		manager.failTask(&task, "ACME_ISSUE_FAILED", err)
 		return
@@ -505,16 +676,20 @@ func (manager *Manager) run(taskID string) {
 	certificateID := task.CertificateID
 	previousCertificatePath := ""
 	previousPrivateKeyPath := ""
+	// A bound projection points at the files of the shared certificate, which
+	// stay in use by its owner and the other bound sites.
 	if certificateID == "" {
 		var existing models.Certificate
 		if err := manager.db.First(&existing, "website_id = ?", task.WebsiteID).Error; err == nil {
 			certificateID = existing.ID
-			previousCertificatePath = existing.CertificatePath
-			previousPrivateKeyPath = existing.PrivateKeyPath
+			if !isBoundProjection(&existing) {
+				previousCertificatePath = existing.CertificatePath
+				previousPrivateKeyPath = existing.PrivateKeyPath
+			}
 		}
 	} else {
 		var existing models.Certificate
-		if err := manager.db.First(&existing, "id = ?", certificateID).Error; err == nil {
+		if err := manager.db.First(&existing, "id = ?", certificateID).Error; err == nil && !isBoundProjection(&existing) {
 			previousCertificatePath = existing.CertificatePath
 			previousPrivateKeyPath = existing.PrivateKeyPath
 		}
@@ -529,7 +704,10 @@ func (manager *Manager) run(taskID string) {
 		Provider:        "acme",
 		Email:           task.Email,
 		Domains:         task.Domains,
-		DirectoryURL:    task.DirectoryURL,
+		DirectoryURL:    issueRequest.DirectoryURL,
+		ChallengeType:   task.ChallengeType,
+		DNSAccountID:    task.DNSAccountID,
+		ACMEAccountID:   task.ACMEAccountID,
 		CertificatePath: certificatePath,
 		PrivateKeyPath:  privateKeyPath,
 		SerialNumber:    metadata.SerialNumber.String(),
@@ -551,11 +729,17 @@ func (manager *Manager) run(taskID string) {
 		err := tx.First(&existing, "website_id = ?", task.WebsiteID).Error
 		if err == nil {
 			certificateRecord.ID = existing.ID
-			certificateRecord.ManagedID = existing.ManagedID
-			if certificateRecord.ManagedID == "" {
-				certificateRecord.ManagedID = existing.ID
-			}
+			certificateRecord.ManagedID = existing.ID
 			certificateRecord.CreatedAt = existing.CreatedAt
+			// A site that was bound to a shared certificate now owns its own
+			// resource; the shared certificate and its other sites are untouched.
+			if isBoundProjection(&existing) {
+				if err := tx.Model(&models.CertificateBinding{}).
+					Where("managed_certificate_id = ? AND website_id = ?", existing.ManagedID, task.WebsiteID).
+					Updates(map[string]any{"status": BindingStatusDisabled, "updated_at": completedAt}).Error; err != nil {
+					return err
+				}
+			}
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return err
 		} else if err := tx.Create(certificateRecord).Error; err != nil {
@@ -585,17 +769,66 @@ func (manager *Manager) run(taskID string) {
 	}
 	_ = manager.db.Model(&models.CertificateTask{}).Where("id = ?", task.ID).
 		Update("certificate_id", certificateRecord.ID).Error
-	if err := manager.removeSupersededVersion(
-		previousCertificatePath,
-		previousPrivateKeyPath,
-		certificatePath,
-	); err != nil {
-		manager.appendLog(task.ID, "旧证书版本清理失败："+err.Error())
+	// Sites sharing this certificate still reference the previous version, so
+	// it is only removed once every binding has been moved to the new files.
+	if manager.redeployBindings(ctx, &task, certificateRecord) {
+		if err := manager.removeSupersededVersion(
+			task.WebsiteID,
+			previousCertificatePath,
+			previousPrivateKeyPath,
+			certificatePath,
+		); err != nil {
+			manager.appendLog(task.ID, "旧证书版本清理失败："+err.Error())
+		}
 	}
 	manager.appendLog(task.ID, "证书已部署，Nginx 配置验证和重载成功")
 	_ = manager.finish(task.ID, models.CertificateTaskStatusSucceeded, "", "证书签发和部署成功")
 }
 
+// redeployBindings moves every other website bound to the managed
+// certificate to the renewed files. A failed site keeps serving the previous
+// version and its binding is marked as failed; it reports whether all
+// bindings were updated.
+func (manager *Manager) redeployBindings(ctx context.Context, task *models.CertificateTask, record *models.Certificate) bool {
+	var bindings []models.CertificateBinding
+	if err := manager.db.Where("managed_certificate_id = ? AND website_id <> ? AND status = ?",
+		record.ManagedID, task.WebsiteID, BindingStatusActive).
+		Order("created_at ASC").Find(&bindings).Error; err != nil {
+		manager.appendLog(task.ID, "读取证书绑定失败："+err.Error())
+		return false
+	}
+	updated := true
+	for index, binding := range bindings {
+		manager.appendLog(task.ID, fmt.Sprintf("正在更新共享证书的网站绑定 %d/%d", index+1, len(bindings)))
+		_, err := manager.deployer.Deploy(ctx, binding.WebsiteID, record.CertificatePath, record.PrivateKeyPath, binding.ForceHTTPS)
+		now := time.Now().UTC()
+		if err != nil {
+			updated = false
+			manager.appendLog(task.ID, fmt.Sprintf("网站 %d 证书部署失败：%s", binding.WebsiteID, err.Error()))
+			_ = manager.db.Model(&models.CertificateBinding{}).Where("id = ?", binding.ID).Updates(map[string]any{
+				"status": BindingStatusError, "last_error": truncate(err.Error(), 1024), "updated_at": now,
+			}).Error
+			continue
+		}
+		_ = manager.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.CertificateBinding{}).Where("id = ?", binding.ID).Updates(map[string]any{
+				"last_error": "", "deployed_at": now, "updated_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Certificate{}).
+				Where("website_id = ? AND managed_id = ?", binding.WebsiteID, record.ManagedID).
+				Updates(map[string]any{
+					"domains": record.Domains, "certificate_path": record.CertificatePath,
+					"private_key_path": record.PrivateKeyPath, "serial_number": record.SerialNumber,
+					"issuer": record.Issuer, "status": record.Status, "not_before": record.NotBefore,
+					"not_after": record.NotAfter, "last_error": "", "updated_at": now,
+				}).Error
+		})
+	}
+	return updated
+}
+
 func (manager *Manager) runManagedTask(ctx context.Context, task *models.CertificateTask, report ProgressReporter) {
 	catalog := NewCatalog(manager.db, manager.certificateRoot, manager.deployer)
 	var (
@@ -648,6 +881,12 @@ func (manager *Manager) runManagedTask(ctx context.Context, task *models.Certifi
 	_ = manager.finish(task.ID, models.CertificateTaskStatusSucceeded, "", "证书资源操作成功")
 }
 
+// isBoundProjection reports whether certificate is the per-site copy created
+// by Catalog.Bind rather than the record that owns the managed certificate.
+func isBoundProjection(certificate *models.Certificate) bool {
+	return certificate.ManagedID != "" && certificate.ManagedID != certificate.ID
+}
+
 func taskDomains(value string) []string {
 	if strings.TrimSpace(value) == "" {
 		return nil
@@ -676,10 +915,14 @@ func (manager *Manager) failTask(task *models.CertificateTask, code string, err
 	_ = manager.finish(task.ID, status, code, message)
 	if task.CertificateID != "" {
 		retryAt := time.Now().UTC().Add(24 * time.Hour)
-		_ = manager.db.Model(&models.Certificate{}).Where("id = ?", task.CertificateID).Updates(map[string]any{
+		updates := map[string]any{
 			"last_error":    message,
 			"next_renew_at": retryAt,
-		}).Error
+		}
+		if task.Operation == models.CertificateTaskOperationRenew && status == models.CertificateTaskStatusFailed {
+			updates["renewal_failures"] = gorm.Expr("renewal_failures + 1")
+		}
+		_ = manager.db.Model(&models.Certificate{}).Where("id = ?", task.CertificateID).Updates(updates).Error
 	}
 }
 
@@ -910,7 +1153,7 @@ func normalizeEmail(value string) (string, error) {
 	return strings.ToLower(value), nil
 }
 
-func certificateDomains(value string) ([]string, error) {
+func certificateDomains(value string, allowWildcard bool) ([]string, error) {
 	parts := strings.Split(value, ",")
 	domains := make([]string, 0, len(parts))
 	seen := make(map[string]struct{})
@@ -919,8 +1162,8 @@ func certificateDomains(value string) ([]string, error) {
 		if domain == "" {
 			continue
 		}
-		if strings.HasPrefix(domain, "*.") {
-			return nil, errors.New("HTTP-01 does not support wildcard domains; configure DNS-01 in a future provider")
+		if strings.HasPrefix(domain, "*.") && !allowWildcard {
+			return nil, errors.New("HTTP-01 does not support wildcard domains; issue the certificate with DNS-01")
 		}
 		if net.ParseIP(domain) != nil {
 			return nil, errors.New("public ACME certificate issuance requires domain names, not IP addresses")
@@ -1006,6 +1249,7 @@ func truncate(value string, maximum int) string {
 }
 
 func (manager *Manager) removeSupersededVersion(
+	websiteID int64,
 	oldCertificatePath, oldPrivateKeyPath, currentCertificatePath string,
 ) error {
 	if strings.TrimSpace(oldCertificatePath) == "" ||
@@ -1017,10 +1261,11 @@ func (manager *Manager) removeSupersededVersion(
 		oldDirectory == filepath.Dir(filepath.Clean(currentCertificatePath)) {
 		return nil
 	}
-	managedSitesRoot := filepath.Join(manager.certificateRoot, "sites")
-	relative, err := filepath.Rel(managedSitesRoot, oldDirectory)
-	if err != nil || relative == "." || relative == ".." ||
-		strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+	// Only versions issued for this website are removed; anything else may
+	// still be served by another site.
+	versionRoot := filepath.Join(manager.certificateRoot, "sites", strconv.FormatInt(websiteID, 10))
+	relative, err := filepath.Rel(versionRoot, oldDirectory)
+	if err != nil || relative == "." || relative == ".." || strings.ContainsRune(relative, filepath.Separator) {
 		return errors.New("old certificate version is outside the managed directory")
 	}
 	info, err := os.Lstat(oldDirectory)
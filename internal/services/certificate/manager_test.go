@@ -1,6 +1,7 @@
 package certificate
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	"oneinstack/internal/models"
+	"oneinstack/utils"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -27,6 +29,8 @@ type fakeIssuer struct {
 	block   bool
 	err     error
 	once    sync.Once
+	mu      sync.Mutex
+	request IssueRequest
 }
 
 func (issuer *fakeIssuer) Issue(
@@ -34,6 +38,9 @@ func (issuer *fakeIssuer) Issue(
 	request IssueRequest,
 	report ProgressReporter,
 ) (*IssuedCertificate, error) {
+	issuer.mu.Lock()
+	issuer.request = request
+	issuer.mu.Unlock()
 	if issuer.started != nil {
 		issuer.once.Do(func() { close(issuer.started) })
 	}
@@ -55,6 +62,7 @@ type fakeDeployer struct {
 	disableCalls    int
 	rollbackCalls   int
 	failDeploy      bool
+	deployedSites   []int64
 	certificatePath string
 	privateKeyPath  string
 	forceHTTPS      bool
@@ -69,13 +77,14 @@ func (deployer *fakeDeployer) EnsureChallenge(context.Context, int64) error {
 
 func (deployer *fakeDeployer) Deploy(
 	_ context.Context,
-	_ int64,
+	websiteID int64,
 	certificatePath, privateKeyPath string,
 	forceHTTPS bool,
 ) (DeploymentRollback, error) {
 	deployer.mu.Lock()
 	defer deployer.mu.Unlock()
 	deployer.deployCalls++
+	deployer.deployedSites = append(deployer.deployedSites, websiteID)
 	deployer.certificatePath = certificatePath
 	deployer.privateKeyPath = privateKeyPath
 	deployer.forceHTTPS = forceHTTPS
@@ -213,6 +222,281 @@ func TestManagerCancelsRunningCertificateTask(t *testing.T) {
 	}
 }
 
+func TestManagerIssuesDNS01CertificateWithoutHTTPChallengeRoute(t *testing.T) {
+	db := openCertificateTestDB(t)
+	website := &models.Website{
+		Name: "internal.example.com", Domain: "*.internal.example.com,internal.example.com",
+		Type: "static", RootDir: "/tmp/internal.example.com",
+	}
+	if err := db.Create(website).Error; err != nil {
+		t.Fatal(err)
+	}
+	account := &models.DNSAccount{
+		ID: "6f1c7a4e-59a2-4d55-9a53-2a3f0f0b7d11", Name: "primary", Provider: "cloudflare",
+		CredentialOne: "encrypted", CredentialConfigured: true, Enabled: true,
+	}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{}
+	deployer := &fakeDeployer{}
+	manager := newCertificateTestManager(t, db, issuer, deployer)
+	defer stopCertificateTestManager(t, manager)
+	provider := newFakeDNSProvider()
+	factoryAccounts := make(chan string, 2)
+	manager.dnsProviders = func(account models.DNSAccount) (DNSChallengeProvider, error) {
+		factoryAccounts <- account.ID
+		return provider, nil
+	}
+
+	if _, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: website.ID, Email: "admin@example.com", RequestedBy: 1,
+	}); err == nil {
+		t.Fatal("HTTP-01 issuance accepted a wildcard website domain")
+	}
+	if _, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: website.ID, Email: "admin@example.com", RequestedBy: 1,
+		ChallengeType: ChallengeTypeDNS01,
+	}); err == nil {
+		t.Fatal("DNS-01 issuance accepted a request without a DNS account")
+	}
+	task, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: website.ID, Email: "admin@example.com", AutoRenew: true,
+		RenewBeforeDays: 30, RequestedBy: 1,
+		ChallengeType: ChallengeTypeDNS01, DNSAccountID: account.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task = waitCertificateTask(t, manager, task.ID)
+	if task.Status != models.CertificateTaskStatusSucceeded {
+		t.Fatalf("unexpected task result: %#v", task)
+	}
+	issuer.mu.Lock()
+	request := issuer.request
+	issuer.mu.Unlock()
+	if request.ChallengeType != ChallengeTypeDNS01 || request.DNSProvider != provider || <-factoryAccounts != account.ID {
+		t.Fatalf("issuer did not receive the DNS provider: %#v", request)
+	}
+	if deployer.ensureCalls != 0 || deployer.deployCalls != 1 {
+		t.Fatalf("unexpected deployment calls: %#v", deployer)
+	}
+	certificate, err := manager.GetCertificateByWebsite(website.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.ChallengeType != ChallengeTypeDNS01 || certificate.DNSAccountID != account.ID {
+		t.Fatalf("renewal settings were not persisted: %#v", certificate)
+	}
+	renewal, err := manager.SubmitRenew(certificate.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewal.ChallengeType != ChallengeTypeDNS01 || renewal.DNSAccountID != account.ID {
+		t.Fatalf("renewal task lost DNS-01 settings: %#v", renewal)
+	}
+	waitCertificateTask(t, manager, renewal.ID)
+}
+
+func TestManagerIssuesWithACMEAccountProfile(t *testing.T) {
+	if err := utils.ConfigureCredentialKey(bytes.Repeat([]byte{0x42}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	db := openCertificateTestDB(t)
+	website := createCertificateTestWebsite(t, db)
+	catalog := NewCatalog(db, filepath.Join(t.TempDir(), "catalog"), nil)
+	profile, err := catalog.SaveACMEAccount(ACMEAccountOptions{
+		Name: "step-ca", Provider: ACMEProviderCustom, DirectoryURL: "https://ca.internal/acme/acme/directory",
+		Email: "pki@example.com", EABKeyID: "kid-1", EABHMACKey: "c2VjcmV0LWhtYWMta2V5", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{}
+	manager := newCertificateTestManager(t, db, issuer, &fakeDeployer{})
+	defer stopCertificateTestManager(t, manager)
+
+	task, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: website.ID, AutoRenew: true, RenewBeforeDays: 30, RequestedBy: 1,
+		ACMEAccountID: profile.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task = waitCertificateTask(t, manager, task.ID); task.Status != models.CertificateTaskStatusSucceeded {
+		t.Fatalf("unexpected task result: %#v", task)
+	}
+	issuer.mu.Lock()
+	request := issuer.request
+	issuer.mu.Unlock()
+	if request.DirectoryURL != profile.DirectoryURL || request.Email != "pki@example.com" ||
+		request.EABKeyID != "kid-1" || string(request.EABHMACKey) != "secret-hmac-key" {
+		t.Fatalf("issuer did not receive the ACME profile: %#v", request)
+	}
+	if request.AccountKeyPath == acmeAccountKeyPath(manager.certificateRoot, profile.DirectoryURL, "") {
+		t.Fatal("profile issuance reused the panel-wide account key")
+	}
+	certificate, err := manager.GetCertificateByWebsite(website.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.ACMEAccountID != profile.ID || certificate.DirectoryURL != profile.DirectoryURL {
+		t.Fatalf("ACME profile was not persisted: %#v", certificate)
+	}
+
+	if _, err := catalog.SaveACMEAccount(ACMEAccountOptions{
+		ID: profile.ID, Name: profile.Name, Provider: ACMEProviderCustom, DirectoryURL: profile.DirectoryURL,
+		EABKeyID: "kid-1", Enabled: false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.SubmitRenew(certificate.ID, 1); err == nil {
+		t.Fatal("renewal accepted a disabled ACME profile")
+	}
+	fallback, err := catalog.SaveACMEAccount(ACMEAccountOptions{Name: "staging", Provider: "letsencrypt-staging", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewal, err := manager.SubmitRenewWithOptions(certificate.ID, RenewOptions{ACMEAccountID: fallback.ID, RequestedBy: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewal.ACMEAccountID != fallback.ID || renewal.DirectoryURL != fallback.DirectoryURL {
+		t.Fatalf("renewal did not switch ACME profile: %#v", renewal)
+	}
+	waitCertificateTask(t, manager, renewal.ID)
+}
+
+func TestManagerSharesWildcardCertificateAcrossBoundWebsites(t *testing.T) {
+	db := openCertificateTestDB(t)
+	owner := &models.Website{
+		Name: "tenant.example.com", Domain: "*.tenant.example.com,tenant.example.com",
+		Type: "static", RootDir: "/tmp/tenant.example.com", Enabled: true,
+	}
+	shop := &models.Website{Name: "shop", Domain: "shop.tenant.example.com", Type: "static", RootDir: "/tmp/shop", Enabled: true}
+	blog := &models.Website{Name: "blog", Domain: "blog.tenant.example.com", Type: "static", RootDir: "/tmp/blog", Enabled: true}
+	other := &models.Website{Name: "other", Domain: "deep.blog.tenant.example.com", Type: "static", RootDir: "/tmp/other", Enabled: true}
+	for _, website := range []*models.Website{owner, shop, blog, other} {
+		if err := db.Create(website).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	account := &models.DNSAccount{
+		ID: "0b6d2f55-3a8e-4cc1-9f0e-2a7e7f3c9d21", Name: "primary", Provider: "cloudflare",
+		CredentialOne: "encrypted", CredentialConfigured: true, Enabled: true,
+	}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{}
+	deployer := &fakeDeployer{}
+	manager := newCertificateTestManager(t, db, issuer, deployer)
+	defer stopCertificateTestManager(t, manager)
+	manager.dnsProviders = func(models.DNSAccount) (DNSChallengeProvider, error) {
+		return newFakeDNSProvider(), nil
+	}
+
+	if _, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: owner.ID, Email: "admin@example.com", RequestedBy: 1, ChallengeType: ChallengeTypeAuto,
+	}); err == nil {
+		t.Fatal("auto challenge accepted a wildcard order without a DNS account")
+	}
+	task, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: owner.ID, Email: "admin@example.com", AutoRenew: true, RequestedBy: 1,
+		ChallengeType: ChallengeTypeAuto, DNSAccountID: account.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task = waitCertificateTask(t, manager, task.ID); task.Status != models.CertificateTaskStatusSucceeded {
+		t.Fatalf("unexpected task result: %#v", task)
+	}
+	issuer.mu.Lock()
+	request := issuer.request
+	issuer.mu.Unlock()
+	if request.ChallengeType != ChallengeTypeAuto || request.DNSProvider == nil || deployer.ensureCalls != 1 {
+		t.Fatalf("mixed order was not prepared for both challenge types: %#v ensure=%d", request, deployer.ensureCalls)
+	}
+	issued, err := manager.GetCertificateByWebsite(owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := NewCatalog(db, manager.certificateRoot, deployer)
+	for _, website := range []*models.Website{shop, blog} {
+		if _, err := catalog.Bind(context.Background(), issued.ManagedID, website.ID, true); err != nil {
+			t.Fatalf("bind %s: %v", website.Name, err)
+		}
+	}
+	if _, err := catalog.Bind(context.Background(), issued.ManagedID, other.ID, false); err == nil {
+		t.Fatal("wildcard certificate was bound to a domain two labels deep")
+	}
+	var projection models.Certificate
+	if err := db.First(&projection, "website_id = ?", shop.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.SubmitRenew(projection.ID, 1); err == nil {
+		t.Fatal("bound website renewed the shared certificate on its own")
+	}
+
+	deployer.mu.Lock()
+	deployer.deployedSites = nil
+	deployer.mu.Unlock()
+	renewal, err := manager.SubmitRenew(issued.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewal = waitCertificateTask(t, manager, renewal.ID); renewal.Status != models.CertificateTaskStatusSucceeded {
+		t.Fatalf("unexpected renewal result: %#v", renewal)
+	}
+	renewed, err := manager.GetCertificateByWebsite(owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployer.mu.Lock()
+	deployedSites := append([]int64(nil), deployer.deployedSites...)
+	deployer.mu.Unlock()
+	if len(deployedSites) != 3 || deployedSites[0] != owner.ID || deployedSites[1] != shop.ID || deployedSites[2] != blog.ID {
+		t.Fatalf("renewal deployed to %v", deployedSites)
+	}
+	for _, website := range []*models.Website{shop, blog} {
+		var current models.Certificate
+		if err := db.First(&current, "website_id = ?", website.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if current.CertificatePath != renewed.CertificatePath || current.ManagedID != issued.ManagedID || !current.ForceHTTPS {
+			t.Fatalf("%s still serves the previous version: %#v", website.Name, current)
+		}
+	}
+	if _, err := os.Stat(filepath.Dir(issued.CertificatePath)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("superseded shared version was not removed: %v", err)
+	}
+
+	// A bound site that gets its own certificate must leave the shared files
+	// in place for the owner and the remaining bound site.
+	separate, err := manager.SubmitIssue(IssueOptions{
+		WebsiteID: shop.ID, Email: "admin@example.com", RequestedBy: 1, ChallengeType: ChallengeTypeHTTP01,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if separate = waitCertificateTask(t, manager, separate.ID); separate.Status != models.CertificateTaskStatusSucceeded {
+		t.Fatalf("unexpected separate issue result: %#v", separate)
+	}
+	for _, name := range []string{renewed.CertificatePath, renewed.PrivateKeyPath} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("shared certificate file was removed: %v", err)
+		}
+	}
+	var own models.Certificate
+	if err := db.First(&own, "website_id = ?", shop.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if isBoundProjection(&own) || own.CertificatePath == renewed.CertificatePath {
+		t.Fatalf("bound site did not get its own certificate: %#v", own)
+	}
+}
+
 func TestManagerDisablePublishesHTTPConfigAndStopsRenewal(t *testing.T) {
 	db := openCertificateTestDB(t)
 	website := createCertificateTestWebsite(t, db)
@@ -340,6 +624,8 @@ func openCertificateTestDB(t *testing.T) *gorm.DB {
 		&models.CertificateBinding{},
 		&models.CertificateTask{},
 		&models.CertificateOperationLock{},
+		&models.DNSAccount{},
+		&models.ACMEAccount{},
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -85,7 +85,7 @@ func (scheduler *RenewalScheduler) Scan(ctx context.Context) error {
 			scanErr = errors.Join(scanErr, err)
 			continue
 		}
-		if !certificate.AutoRenew {
+		if !certificate.AutoRenew || isBoundProjection(&certificate) {
 			continue
 		}
 		due := certificate.NotAfter.Before(
@@ -104,6 +104,14 @@ func (scheduler *RenewalScheduler) Scan(ctx context.Context) error {
 				Count(&active).Error
 			if activeErr != nil || active == 0 {
 				scanErr = errors.Join(scanErr, err)
+				// A renewal that cannot even be queued, for example because its
+				// ACME profile was disabled, is surfaced and retried a day later.
+				retryAt := now.Add(24 * time.Hour)
+				_ = scheduler.db.Model(&models.Certificate{}).Where("id = ?", certificate.ID).Updates(map[string]any{
+					"last_error":       truncate(err.Error(), 1024),
+					"next_renew_at":    retryAt,
+					"renewal_failures": gorm.Expr("renewal_failures + 1"),
+				}).Error
 			}
 		}
 	}
@@ -0,0 +1,386 @@
+package databasetask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrBinlogDisabled is returned by BinlogOperator implementations for
+// connections that do not write binary logs.
+var ErrBinlogDisabled = errors.New("binary logging is disabled")
+
+var errNoRecoverableBackup = errors.New("no backup of the connection records binlog coordinates")
+
+var binlogNamePattern = regexp.MustCompile(`^([A-Za-z0-9_-][A-Za-z0-9_.-]{0,200})\.([0-9]{6,})$`)
+var gtidPattern = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}):([1-9][0-9]{0,18})$`)
+
+// RecoveryTarget selects where a point-in-time restore stops replaying binary
+// logs. StopAt includes every transaction started at or before that second;
+// StopGTID includes every transaction of that server up to and including the
+// given "uuid:sequence". The zero value restores the full backup only.
+type RecoveryTarget struct {
+	StopAt   *time.Time
+	StopGTID string
+}
+
+func (t RecoveryTarget) IsZero() bool {
+	return t.StopAt == nil && t.StopGTID == ""
+}
+
+// ArchivedBinlog is a closed binary log copied into the archive directory.
+type ArchivedBinlog struct {
+	FileName     string
+	CoveredUntil time.Time
+}
+
+// BinlogOperator is implemented by operators whose engine supports
+// point-in-time recovery from binary logs.
+type BinlogOperator interface {
+	// BackupPosition reads the binary log coordinates a published backup is
+	// consistent with. An empty file name means binary logging was off.
+	BackupPosition(libraryID int64, path string) (string, int64, error)
+	// ArchiveBinlogs copies the closed binary logs of a connection for which
+	// wanted reports true into directory, using the server's file names.
+	ArchiveBinlogs(
+		ctx context.Context,
+		connectionID int64,
+		directory string,
+		wanted func(fileName string) bool,
+	) ([]ArchivedBinlog, error)
+	// ReplayBinlogs applies the changes of one database from files, starting at
+	// position in the first file and stopping at target.
+	ReplayBinlogs(
+		ctx context.Context,
+		libraryID int64,
+		files []string,
+		position int64,
+		target RecoveryTarget,
+		log io.Writer,
+		report ProgressReporter,
+	) error
+}
+
+// RecoveryWindow is the range a backup can be rolled forward to.
+type RecoveryWindow struct {
+	BackupID   string    `json:"backupId"`
+	BinlogFile string    `json:"binlogFile"`
+	From       time.Time `json:"from"`
+	Until      time.Time `json:"until"`
+	Binlogs    int       `json:"binlogs"`
+}
+
+type ArchiveResult struct {
+	Connections int `json:"connections"`
+	Archived    int `json:"archived"`
+}
+
+// BinlogArchiver periodically copies closed binary logs of every MySQL
+// connection into the database backup root. The schedule bounds how much data
+// a point-in-time restore can lose.
+type BinlogArchiver struct {
+	manager   *Manager
+	scheduler *cron.Cron
+	mu        sync.Mutex
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewBinlogArchiver(manager *Manager, schedule string) (*BinlogArchiver, error) {
+	if manager == nil || manager.db == nil {
+		return nil, errors.New("database binlog archiver manager is not configured")
+	}
+	if strings.TrimSpace(schedule) == "" {
+		return nil, errors.New("database binlog archive schedule is empty")
+	}
+	scheduler := cron.New(cron.WithChain(
+		cron.SkipIfStillRunning(cron.DefaultLogger),
+		cron.Recover(cron.DefaultLogger),
+	))
+	archiver := &BinlogArchiver{manager: manager, scheduler: scheduler}
+	if _, err := scheduler.AddFunc(schedule, func() {
+		if _, archiveErr := archiver.RunNow(context.Background()); archiveErr != nil {
+			log.Printf("database binlog archive failed: %v", archiveErr)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid database binlog archive schedule: %w", err)
+	}
+	return archiver, nil
+}
+
+func (a *BinlogArchiver) Start() {
+	if a != nil {
+		a.startOnce.Do(func() { a.scheduler.Start() })
+	}
+}
+
+func (a *BinlogArchiver) Stop(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	var stopped context.Context
+	a.stopOnce.Do(func() { stopped = a.scheduler.Stop() })
+	if stopped == nil {
+		return nil
+	}
+	select {
+	case <-stopped.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunNow archives every MySQL connection once. A failing connection does not
+// stop the others; the errors are joined.
+func (a *BinlogArchiver) RunNow(ctx context.Context) (*ArchiveResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.manager.Start(); err != nil {
+		return nil, err
+	}
+	operator, ok := a.manager.operator.(BinlogOperator)
+	if !ok {
+		return &ArchiveResult{}, nil
+	}
+	var connections []models.Storage
+	if err := a.manager.db.Select("id").Where("type = ?", "mysql").
+		Order("id ASC").Find(&connections).Error; err != nil {
+		return nil, err
+	}
+	result := &ArchiveResult{}
+	var failures []error
+	for _, connection := range connections {
+		archived, err := a.manager.archiveConnection(ctx, operator, connection.ID)
+		switch {
+		case errors.Is(err, ErrBinlogDisabled), errors.Is(err, errNoRecoverableBackup):
+		case err != nil:
+			failures = append(failures, fmt.Errorf("connection %d: %w", connection.ID, err))
+		default:
+			result.Connections++
+			result.Archived += archived
+		}
+	}
+	return result, errors.Join(failures...)
+}
+
+// archiveConnection archives the logs a backup of the connection can be
+// rolled forward with. Logs older than the oldest such backup are of no use and
+// are left on the server.
+func (m *Manager) archiveConnection(ctx context.Context, operator BinlogOperator, connectionID int64) (int, error) {
+	var backups []models.DatabaseBackup
+	if err := m.db.Select("binlog_file").
+		Where("connection_id = ? AND binlog_file <> ''", connectionID).
+		Find(&backups).Error; err != nil {
+		return 0, err
+	}
+	oldest := map[string]int64{}
+	for _, backup := range backups {
+		base, sequence, err := binlogSequence(backup.BinlogFile)
+		if err != nil {
+			continue
+		}
+		if current, ok := oldest[base]; !ok || sequence < current {
+			oldest[base] = sequence
+		}
+	}
+	if len(oldest) == 0 {
+		return 0, errNoRecoverableBackup
+	}
+	directory, err := m.binlogDirectory(connectionID)
+	if err != nil {
+		return 0, err
+	}
+	var existing []models.DatabaseBinlog
+	if err := m.db.Select("file_name").Where("connection_id = ?", connectionID).
+		Find(&existing).Error; err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, binlog := range existing {
+		known[binlog.FileName] = true
+	}
+	files, err := operator.ArchiveBinlogs(ctx, connectionID, directory, func(fileName string) bool {
+		base, sequence, err := binlogSequence(fileName)
+		if err != nil || known[fileName] {
+			return false
+		}
+		first, ok := oldest[base]
+		return ok && sequence >= first
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		path, err := m.binlogPath(connectionID, file.FileName)
+		if err != nil {
+			return 0, err
+		}
+		size, checksum, err := verifyRegularFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("verify archived binlog %s: %w", file.FileName, err)
+		}
+		if err := m.db.Create(&models.DatabaseBinlog{
+			ConnectionID: connectionID, FileName: file.FileName, FilePath: path,
+			SizeBytes: size, SHA256: checksum,
+			CoveredUntil: file.CoveredUntil.UTC(), CreatedAt: time.Now().UTC(),
+		}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(files), nil
+}
+
+// RecoveryWindow reports how far a backup can be rolled forward with the
+// binary logs archived so far.
+func (m *Manager) RecoveryWindow(backupID string) (*RecoveryWindow, error) {
+	backup, err := m.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := m.binlogChain(backup)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryWindow{
+		BackupID: backup.ID, BinlogFile: backup.BinlogFile,
+		From: backup.CreatedAt, Until: chain[len(chain)-1].CoveredUntil,
+		Binlogs: len(chain),
+	}, nil
+}
+
+func (m *Manager) validateRecoveryTarget(backup *models.DatabaseBackup, target RecoveryTarget) error {
+	if target.IsZero() {
+		return nil
+	}
+	if _, ok := m.operator.(BinlogOperator); !ok {
+		return errors.New("point-in-time restore is not supported")
+	}
+	if target.StopAt != nil && target.StopGTID != "" {
+		return errors.New("choose either a stop time or a stop GTID")
+	}
+	chain, err := m.binlogChain(backup)
+	if err != nil {
+		return err
+	}
+	if target.StopGTID != "" {
+		if !gtidPattern.MatchString(target.StopGTID) {
+			return errors.New("stop GTID must have the form server_uuid:sequence")
+		}
+		return nil
+	}
+	stopAt := target.StopAt.UTC()
+	if stopAt.Before(backup.CreatedAt) {
+		return errors.New("stop time is earlier than the backup")
+	}
+	if until := chain[len(chain)-1].CoveredUntil; stopAt.After(until) {
+		return fmt.Errorf("binary logs are archived up to %s only", until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// binlogChain returns the archived logs from the backup's coordinates up to
+// the first gap, oldest first.
+func (m *Manager) binlogChain(backup *models.DatabaseBackup) ([]models.DatabaseBinlog, error) {
+	if backup.BinlogFile == "" {
+		return nil, errors.New("backup was taken without binary logging and cannot be rolled forward")
+	}
+	base, sequence, err := binlogSequence(backup.BinlogFile)
+	if err != nil {
+		return nil, err
+	}
+	var binlogs []models.DatabaseBinlog
+	if err := m.db.Where("connection_id = ?", backup.ConnectionID).Find(&binlogs).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.DatabaseBinlog, len(binlogs))
+	for _, binlog := range binlogs {
+		byName[binlog.FileName] = binlog
+	}
+	var chain []models.DatabaseBinlog
+	width := len(backup.BinlogFile) - len(base) - 1
+	for next := sequence; ; next++ {
+		binlog, ok := byName[fmt.Sprintf("%s.%0*d", base, width, next)]
+		if !ok {
+			break
+		}
+		chain = append(chain, binlog)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("binary log %s has not been archived yet", backup.BinlogFile)
+	}
+	return chain, nil
+}
+
+// verifiedBinlogs checks the archived files of chain against their metadata
+// and returns their paths.
+func (m *Manager) verifiedBinlogs(chain []models.DatabaseBinlog) ([]string, error) {
+	paths := make([]string, 0, len(chain))
+	for _, binlog := range chain {
+		path, err := m.binlogPath(binlog.ConnectionID, binlog.FileName)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(binlog.FilePath) != path {
+			return nil, errors.New("archived binlog path does not match its metadata")
+		}
+		size, checksum, err := verifyRegularFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("verify archived binlog %s: %w", binlog.FileName, err)
+		}
+		if size != binlog.SizeBytes || !strings.EqualFold(checksum, binlog.SHA256) {
+			return nil, fmt.Errorf("archived binlog %s integrity check failed", binlog.FileName)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (m *Manager) binlogDirectory(connectionID int64) (string, error) {
+	if connectionID <= 0 {
+		return "", errors.New("invalid database connection id")
+	}
+	directory := filepath.Join(m.backupRoot, "binlog", strconv.FormatInt(connectionID, 10))
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return "", fmt.Errorf("create binlog archive directory: %w", err)
+	}
+	return directory, nil
+}
+
+func (m *Manager) binlogPath(connectionID int64, fileName string) (string, error) {
+	if _, _, err := binlogSequence(fileName); err != nil {
+		return "", err
+	}
+	directory, err := m.binlogDirectory(connectionID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(directory, fileName), nil
+}
+
+// binlogSequence splits a binary log name such as "mysql-bin.000012" into
+// its base name and sequence number.
+func binlogSequence(fileName string) (string, int64, error) {
+	match := binlogNamePattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return "", 0, fmt.Errorf("invalid binary log name %q", fileName)
+	}
+	sequence, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid binary log name %q", fileName)
+	}
+	return match[1], sequence, nil
+}
@@ -0,0 +1,221 @@
+package databasetask
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+type fakeBinlogOperator struct {
+	fakeDatabaseOperator
+	serverLogs   []string
+	coveredUntil time.Time
+	replayed     []string
+	position     int64
+	target       RecoveryTarget
+}
+
+func (f *fakeBinlogOperator) BackupPosition(int64, string) (string, int64, error) {
+	return "mysql-bin.000002", 120, nil
+}
+
+func (f *fakeBinlogOperator) ArchiveBinlogs(
+	_ context.Context,
+	_ int64,
+	directory string,
+	wanted func(fileName string) bool,
+) ([]ArchivedBinlog, error) {
+	var archived []ArchivedBinlog
+	for _, name := range f.serverLogs[:len(f.serverLogs)-1] {
+		if !wanted(name) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(directory, name), []byte("events of "+name), 0600); err != nil {
+			return nil, err
+		}
+		archived = append(archived, ArchivedBinlog{FileName: name, CoveredUntil: f.coveredUntil})
+	}
+	return archived, nil
+}
+
+func (f *fakeBinlogOperator) ReplayBinlogs(
+	_ context.Context,
+	_ int64,
+	files []string,
+	position int64,
+	target RecoveryTarget,
+	_ io.Writer,
+	report ProgressReporter,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replayed = f.replayed[:0]
+	for _, file := range files {
+		f.replayed = append(f.replayed, filepath.Base(file))
+	}
+	f.position, f.target = position, target
+	report(100, "replayed")
+	return nil
+}
+
+func TestPointInTimeRestoreReplaysArchivedBinlogChain(t *testing.T) {
+	database := openDatabaseTaskTestDB(t)
+	operator := &fakeBinlogOperator{
+		serverLogs: []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000004"},
+	}
+	root := t.TempDir()
+	manager := NewManager(database, filepath.Join(root, "backups"), filepath.Join(root, "logs"), operator)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+
+	backupTask, err := manager.SubmitBackup(11, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupTask = waitForDatabaseTask(t, manager, backupTask.ID)
+	backup, err := manager.GetBackup(backupTask.ResultBackupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.BinlogFile != "mysql-bin.000002" || backup.BinlogPosition != 120 {
+		t.Fatalf("backup coordinates were not recorded: %+v", backup)
+	}
+	stopAt := backup.CreatedAt
+	if _, err := manager.SubmitRestore(11, backup.ID, RecoveryTarget{StopAt: &stopAt}, 1); err == nil {
+		t.Fatal("restore was accepted before its binlogs were archived")
+	}
+
+	operator.coveredUntil = time.Now().UTC()
+	archiver, err := NewBinlogArchiver(manager, "@every 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := archiver.RunNow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The log before the backup is of no use and the active log is not closed.
+	if result.Connections != 1 || result.Archived != 2 {
+		t.Fatalf("unexpected archive result: %+v", result)
+	}
+	if again, err := archiver.RunNow(context.Background()); err != nil || again.Archived != 0 {
+		t.Fatalf("archived logs were copied again: %+v %v", again, err)
+	}
+	window, err := manager.RecoveryWindow(backup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window.Binlogs != 2 || !window.Until.Equal(operator.coveredUntil) {
+		t.Fatalf("unexpected recovery window: %+v", window)
+	}
+
+	late := operator.coveredUntil.Add(time.Hour)
+	for _, target := range []RecoveryTarget{
+		{StopAt: &late},
+		{StopAt: &stopAt, StopGTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"},
+		{StopGTID: "not-a-gtid"},
+	} {
+		if _, err := manager.SubmitRestore(11, backup.ID, target, 1); err == nil {
+			t.Fatalf("invalid recovery target was accepted: %+v", target)
+		}
+	}
+
+	restoreTask, err := manager.SubmitRestore(11, backup.ID, RecoveryTarget{StopAt: &stopAt}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoreTask = waitForDatabaseTask(t, manager, restoreTask.ID)
+	if restoreTask.Status != models.DatabaseTaskStatusSucceeded || restoreTask.StopAt == nil ||
+		restoreTask.SafetyBackupID == "" {
+		t.Fatalf("unexpected restore task: %+v", restoreTask)
+	}
+	operator.mu.Lock()
+	replayed, position, target := strings.Join(operator.replayed, " "), operator.position, operator.target
+	operator.mu.Unlock()
+	if replayed != "mysql-bin.000002 mysql-bin.000003" || position != 120 ||
+		target.StopAt == nil || !target.StopAt.Equal(stopAt) {
+		t.Fatalf("unexpected replay: %s at %d to %+v", replayed, position, target)
+	}
+
+	// A modified archive is never replayed.
+	tampered := filepath.Join(root, "backups", "binlog", "7", "mysql-bin.000003")
+	if err := os.WriteFile(tampered, []byte("forged events"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	failedTask, err := manager.SubmitRestore(11, backup.ID, RecoveryTarget{StopAt: &stopAt}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failedTask = waitForDatabaseTask(t, manager, failedTask.ID); failedTask.Status != models.DatabaseTaskStatusFailed {
+		t.Fatalf("tampered binlog was replayed: %+v", failedTask)
+	}
+}
+
+func TestCleanerKeepsBinlogsNeededByRemainingBackups(t *testing.T) {
+	database := openDatabaseTaskTestDB(t)
+	root := t.TempDir()
+	manager := NewManager(database, filepath.Join(root, "backups"), filepath.Join(root, "logs"), &fakeDatabaseOperator{})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for index, name := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"} {
+		path, err := manager.binlogPath(7, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Create(&models.DatabaseBinlog{
+			ConnectionID: 7, FileName: name, FilePath: path,
+			CoveredUntil: now.AddDate(0, 0, -10+index), CreatedAt: now,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Create(&models.DatabaseBackup{
+		ID: "b3f4c1a2-0000-4000-8000-000000000001", LibraryID: 11, ConnectionID: 7,
+		DatabaseName: "appdb", Source: models.DatabaseBackupSourceManual,
+		FileName: "appdb.sql.gz", FilePath: filepath.Join(root, "backups", "11", "b3f4c1a2-0000-4000-8000-000000000001.sql.gz"),
+		SHA256: strings.Repeat("0", 64), BinlogFile: "mysql-bin.000002", BinlogPosition: 4,
+		CreatedBy: 1, CreatedAt: now,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cleaner, err := NewCleaner(manager, 5, "@every 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := cleaner.RunNow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BinlogsDeleted != 1 {
+		t.Fatalf("unexpected cleanup result: %+v", result)
+	}
+	var remaining []models.DatabaseBinlog
+	if err := database.Order("file_name").Find(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 2 || remaining[0].FileName != "mysql-bin.000002" {
+		t.Fatalf("needed binlogs were removed: %+v", remaining)
+	}
+	if _, err := os.Stat(filepath.Join(root, "backups", "binlog", "7", "mysql-bin.000001")); !os.IsNotExist(err) {
+		t.Fatalf("expired binlog file was kept: %v", err)
+	}
+}
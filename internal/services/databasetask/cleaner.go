@@ -18,6 +18,7 @@ import (
 type CleanupResult struct {
 	BackupsDeleted int `json:"backupsDeleted"`
 	FilesDeleted   int `json:"filesDeleted"`
+	BinlogsDeleted int `json:"binlogsDeleted"`
 }
 
 type Cleaner struct {
@@ -53,8 +54,9 @@ func NewCleaner(manager *Manager, retentionDays int, schedule string) (*Cleaner,
 			log.Printf("database backup cleanup failed: %v", cleanupErr)
 			return
 		}
-		if result.BackupsDeleted > 0 {
-			log.Printf("database backup cleanup removed %d backups", result.BackupsDeleted)
+		if result.BackupsDeleted > 0 || result.BinlogsDeleted > 0 {
+			log.Printf("database backup cleanup removed %d backups and %d binlogs",
+				result.BackupsDeleted, result.BinlogsDeleted)
 		}
 	}); err != nil {
 		return nil, fmt.Errorf("invalid database backup cleanup schedule: %w", err)
@@ -90,44 +92,122 @@ func (c *Cleaner) RunNow() (*CleanupResult, error) {
 		return nil, err
 	}
 	cutoff := c.now().UTC().AddDate(0, 0, -c.retentionDays)
+	// Scheduled backups of a library that still has a schedule are pruned by
+	// its own retention policy instead of by age.
+	scheduled := c.manager.db.Model(&models.DatabaseBackupSchedule{}).Select("library_id")
 	var backups []models.DatabaseBackup
 	if err := c.manager.db.Where("created_at < ?", cutoff).
+		Where("source <> ? OR library_id NOT IN (?)", models.DatabaseBackupSourceScheduled, scheduled).
 		Order("created_at ASC").Find(&backups).Error; err != nil {
 		return nil, err
 	}
 	result := &CleanupResult{}
 	for i := range backups {
-		backup := &backups[i]
-		var active int64
-		if err := c.manager.db.Model(&models.DatabaseTask{}).
-			Where("source_backup_id = ? AND status IN ?", backup.ID, models.ActiveDatabaseTaskStatuses()).
-			Count(&active).Error; err != nil {
+		removed, fileDeleted, err := c.manager.removeRetiredBackup(&backups[i])
+		if err != nil {
 			return nil, err
 		}
-		if active > 0 {
+		if fileDeleted {
+			result.FilesDeleted++
+		}
+		if removed {
+			result.BackupsDeleted++
+		}
+	}
+	deleted, err := c.cleanBinlogs(cutoff)
+	if err != nil {
+		return nil, err
+	}
+	result.BinlogsDeleted = deleted
+	return result, nil
+}
+
+// removeRetiredBackup deletes a backup that fell out of retention together
+// with its file. Backups used by an active restore are left alone.
+func (m *Manager) removeRetiredBackup(backup *models.DatabaseBackup) (bool, bool, error) {
+	var active int64
+	if err := m.db.Model(&models.DatabaseTask{}).
+		Where("source_backup_id = ? AND status IN ?", backup.ID, models.ActiveDatabaseTaskStatuses()).
+		Count(&active).Error; err != nil {
+		return false, false, err
+	}
+	if active > 0 {
+		return false, false, nil
+	}
+	path, err := m.safeBackupPath(backup)
+	if err != nil {
+		return false, false, fmt.Errorf("validate expired backup %s: %w", backup.ID, err)
+	}
+	fileDeleted := false
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return false, false, err
+	case !info.Mode().IsRegular():
+		return false, false, fmt.Errorf("expired database backup %s is not a regular file", backup.ID)
+	default:
+		if err := os.Remove(path); err != nil {
+			return false, false, err
+		}
+		fileDeleted = true
+	}
+	if err := m.db.Delete(&models.DatabaseBackup{}, "id = ?", backup.ID).Error; err != nil {
+		return false, fileDeleted, err
+	}
+	return true, fileDeleted, nil
+}
+
+// cleanBinlogs removes archived binary logs older than cutoff unless a
+// remaining backup still needs them to be rolled forward, so the recovery
+// window always matches the backup retention.
+func (c *Cleaner) cleanBinlogs(cutoff time.Time) (int, error) {
+	var binlogs []models.DatabaseBinlog
+	if err := c.manager.db.Where("covered_until < ?", cutoff).
+		Order("connection_id ASC, id ASC").Find(&binlogs).Error; err != nil {
+		return 0, err
+	}
+	if len(binlogs) == 0 {
+		return 0, nil
+	}
+	var backups []models.DatabaseBackup
+	if err := c.manager.db.Select("connection_id", "binlog_file").
+		Where("binlog_file <> ''").Find(&backups).Error; err != nil {
+		return 0, err
+	}
+	// oldest holds the first log each connection still needs, per log base
+	// name.
+	oldest := map[string]int64{}
+	for _, backup := range backups {
+		base, sequence, err := binlogSequence(backup.BinlogFile)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%d|%s", backup.ConnectionID, base)
+		if current, ok := oldest[key]; !ok || sequence < current {
+			oldest[key] = sequence
+		}
+	}
+	deleted := 0
+	for _, binlog := range binlogs {
+		base, sequence, err := binlogSequence(binlog.FileName)
+		if err != nil {
+			return deleted, fmt.Errorf("validate archived binlog %d: %w", binlog.ID, err)
+		}
+		if needed, ok := oldest[fmt.Sprintf("%d|%s", binlog.ConnectionID, base)]; ok && sequence >= needed {
 			continue
 		}
-		path, err := c.manager.safeBackupPath(backup)
+		path, err := c.manager.binlogPath(binlog.ConnectionID, binlog.FileName)
 		if err != nil {
-			return nil, fmt.Errorf("validate expired backup %s: %w", backup.ID, err)
+			return deleted, err
 		}
-		info, err := os.Lstat(path)
-		switch {
-		case errors.Is(err, os.ErrNotExist):
-		case err != nil:
-			return nil, err
-		case !info.Mode().IsRegular():
-			return nil, fmt.Errorf("expired database backup %s is not a regular file", backup.ID)
-		default:
-			if err := os.Remove(path); err != nil {
-				return nil, err
-			}
-			result.FilesDeleted++
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, err
 		}
-		if err := c.manager.db.Delete(&models.DatabaseBackup{}, "id = ?", backup.ID).Error; err != nil {
-			return nil, err
+		if err := c.manager.db.Delete(&models.DatabaseBinlog{}, binlog.ID).Error; err != nil {
+			return deleted, err
 		}
-		result.BackupsDeleted++
+		deleted++
 	}
-	return result, nil
+	return deleted, nil
 }
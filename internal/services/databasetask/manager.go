@@ -26,6 +26,14 @@ const (
 	defaultWorkerSize = 2
 )
 
+// artifactExtensions lists the engines with backup support and the format
+// their operator writes: a gzipped SQL script for MySQL and a pg_dump custom
+// archive for PostgreSQL.
+var artifactExtensions = map[string]string{
+	"mysql":    ".sql.gz",
+	"postgres": ".dump",
+}
+
 type ProgressReporter func(progress int, message string)
 
 // Operator performs database-specific work. Implementations must honor ctx,
@@ -51,6 +59,9 @@ type Request struct {
 	Operation string
 	LibraryID int64
 	BackupID  string
+	Target    RecoveryTarget
+	// Source records why a backup was taken; it defaults to manual.
+	Source string
 }
 
 type queuedTask struct {
@@ -122,6 +133,14 @@ func (m *Manager) Start() error {
 	return m.startErr
 }
 
+// QueueDepth reports how many accepted tasks are waiting for a worker.
+func (m *Manager) QueueDepth() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.queue)
+}
+
 func invalidRoot(path string) bool {
 	return path == "" || path == "." || path == string(filepath.Separator)
 }
@@ -130,15 +149,20 @@ func (m *Manager) SubmitBackup(libraryID, requestedBy int64) (*models.DatabaseTa
 	return m.submit(Request{Operation: "backup", LibraryID: libraryID}, requestedBy)
 }
 
+// SubmitRestore queues a restore of backupID. A non-zero target rolls the
+// restored database forward by replaying archived binary logs up to it.
 func (m *Manager) SubmitRestore(
 	libraryID int64,
 	backupID string,
+	target RecoveryTarget,
 	requestedBy int64,
 ) (*models.DatabaseTask, error) {
+	target.StopGTID = strings.TrimSpace(target.StopGTID)
 	return m.submit(Request{
 		Operation: "restore",
 		LibraryID: libraryID,
 		BackupID:  strings.TrimSpace(backupID),
+		Target:    target,
 	}, requestedBy)
 }
 
@@ -160,8 +184,8 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.DatabaseTa
 	if err := m.db.First(&library, request.LibraryID).Error; err != nil {
 		return nil, err
 	}
-	if library.Type != "mysql" {
-		return nil, errors.New("database backup and restore currently support MySQL only")
+	if _, ok := artifactExtensions[library.Type]; !ok {
+		return nil, errors.New("database backup and restore support MySQL and PostgreSQL only")
 	}
 	if request.Operation == "restore" {
 		if request.BackupID == "" {
@@ -174,6 +198,9 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.DatabaseTa
 		if backup.LibraryID != library.ID || backup.DatabaseName != library.Name {
 			return nil, errors.New("backup does not belong to the selected database")
 		}
+		if err := m.validateRecoveryTarget(&backup, request.Target); err != nil {
+			return nil, err
+		}
 	}
 
 	m.submitMu.Lock()
@@ -191,8 +218,18 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.DatabaseTa
 	taskID := uuid.NewString()
 	now := time.Now().UTC()
 	message := "数据库备份任务已进入队列"
+	source := ""
+	if request.Operation == "backup" {
+		source = request.Source
+		if source == "" {
+			source = models.DatabaseBackupSourceManual
+		}
+	}
 	if request.Operation == "restore" {
 		message = "数据库恢复任务已进入队列"
+		if !request.Target.IsZero() {
+			message = "数据库时间点恢复任务已进入队列"
+		}
 	}
 	task := &models.DatabaseTask{
 		ID:             taskID,
@@ -200,6 +237,9 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.DatabaseTa
 		LibraryID:      library.ID,
 		DatabaseName:   library.Name,
 		SourceBackupID: request.BackupID,
+		Source:         source,
+		StopAt:         request.Target.StopAt,
+		StopGTID:       request.Target.StopGTID,
 		Status:         models.DatabaseTaskStatusQueued,
 		Progress:       0,
 		Message:        message,
@@ -327,8 +367,12 @@ func (m *Manager) runBackup(
 	log io.Writer,
 	report ProgressReporter,
 ) error {
+	extension, err := m.libraryArtifactExtension(task.LibraryID)
+	if err != nil {
+		return err
+	}
 	backupID := uuid.NewString()
-	destination, err := m.artifactPath(task.LibraryID, backupID)
+	destination, err := m.artifactPath(task.LibraryID, backupID, extension)
 	if err != nil {
 		return err
 	}
@@ -340,12 +384,11 @@ func (m *Manager) runBackup(
 		removePartialArtifacts(destination)
 		return err
 	}
-	backup, err := m.registerBackup(
-		backupID,
-		task,
-		destination,
-		models.DatabaseBackupSourceManual,
-	)
+	source := task.Source
+	if source == "" {
+		source = models.DatabaseBackupSourceManual
+	}
+	backup, err := m.registerBackup(backupID, task, destination, source)
 	if err != nil {
 		_ = os.Remove(destination)
 		return err
@@ -374,8 +417,15 @@ func (m *Manager) runRestore(
 	}
 	report(3, "恢复源校验完成，正在创建恢复前安全备份")
 
+	extension, err := m.libraryArtifactExtension(task.LibraryID)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(sourcePath, extension) {
+		return errors.New("restore source was written by a different database engine")
+	}
 	safetyID := uuid.NewString()
-	safetyPath, err := m.artifactPath(task.LibraryID, safetyID)
+	safetyPath, err := m.artifactPath(task.LibraryID, safetyID, extension)
 	if err != nil {
 		return err
 	}
@@ -401,17 +451,64 @@ func (m *Manager) runRestore(
 		return err
 	}
 
+	target := RecoveryTarget{StopAt: task.StopAt, StopGTID: task.StopGTID}
+	restoreEnd := 95
+	if !target.IsZero() {
+		restoreEnd = 75
+	}
 	report(45, "安全备份已完成，开始恢复数据库")
 	err = m.operator.Restore(ctx, task.LibraryID, sourcePath, log, func(progress int, message string) {
-		report(scaleProgress(progress, 45, 95), message)
+		report(scaleProgress(progress, 45, restoreEnd), message)
 	})
 	if err != nil {
 		return err
 	}
+	if !target.IsZero() {
+		if err := m.replayBinlogs(ctx, task, sourceBackup, target, log, report); err != nil {
+			return err
+		}
+	}
 	report(98, "数据库恢复完成")
 	return nil
 }
 
+// replayBinlogs rolls a restored backup forward to target. The chain is
+// resolved and verified again because logs may have been archived or removed
+// since the task was queued.
+func (m *Manager) replayBinlogs(
+	ctx context.Context,
+	task *models.DatabaseTask,
+	backup *models.DatabaseBackup,
+	target RecoveryTarget,
+	log io.Writer,
+	report ProgressReporter,
+) error {
+	operator, ok := m.operator.(BinlogOperator)
+	if !ok {
+		return errors.New("point-in-time restore is not supported")
+	}
+	if err := m.validateRecoveryTarget(backup, target); err != nil {
+		return err
+	}
+	chain, err := m.binlogChain(backup)
+	if err != nil {
+		return err
+	}
+	paths, err := m.verifiedBinlogs(chain)
+	if err != nil {
+		return err
+	}
+	report(76, fmt.Sprintf("正在重放 %d 个二进制日志", len(paths)))
+	err = operator.ReplayBinlogs(ctx, task.LibraryID, paths, backup.BinlogPosition, target, log,
+		func(progress int, message string) {
+			report(scaleProgress(progress, 76, 95), message)
+		})
+	if err != nil {
+		return fmt.Errorf("replay binary logs: %w", err)
+	}
+	return nil
+}
+
 func scaleProgress(value, start, end int) int {
 	if value < 0 {
 		value = 0
@@ -514,7 +611,30 @@ func (m *Manager) reconcileInterruptedTasks() error {
 	})
 }
 
-func (m *Manager) artifactPath(libraryID int64, backupID string) (string, error) {
+func (m *Manager) libraryArtifactExtension(libraryID int64) (string, error) {
+	var library models.Library
+	if err := m.db.Select("id", "type").First(&library, libraryID).Error; err != nil {
+		return "", err
+	}
+	extension, ok := artifactExtensions[library.Type]
+	if !ok {
+		return "", fmt.Errorf("database backup is not supported for %s", library.Type)
+	}
+	return extension, nil
+}
+
+// artifactExtension returns the known extension a stored backup path ends
+// with.
+func artifactExtension(path string) (string, error) {
+	for _, extension := range artifactExtensions {
+		if strings.HasSuffix(path, extension) {
+			return extension, nil
+		}
+	}
+	return "", errors.New("database backup has an unknown file format")
+}
+
+func (m *Manager) artifactPath(libraryID int64, backupID, extension string) (string, error) {
 	if libraryID <= 0 {
 		return "", errors.New("invalid database id")
 	}
@@ -525,7 +645,7 @@ func (m *Manager) artifactPath(libraryID int64, backupID string) (string, error)
 	if err := os.MkdirAll(directory, 0750); err != nil {
 		return "", fmt.Errorf("create database backup directory: %w", err)
 	}
-	return filepath.Join(directory, backupID+".sql.gz"), nil
+	return filepath.Join(directory, backupID+extension), nil
 }
 
 func (m *Manager) registerBackup(
@@ -538,15 +658,28 @@ func (m *Manager) registerBackup(
 	if err != nil {
 		return nil, err
 	}
+	extension, err := artifactExtension(path)
+	if err != nil {
+		return nil, err
+	}
 	var library models.Library
 	if err := m.db.Select("id", "p_id", "name").First(&library, task.LibraryID).Error; err != nil {
 		return nil, err
 	}
+	var binlogFile string
+	var binlogPosition int64
+	if operator, ok := m.operator.(BinlogOperator); ok {
+		binlogFile, binlogPosition, err = operator.BackupPosition(task.LibraryID, path)
+		if err != nil {
+			return nil, fmt.Errorf("read backup binlog position: %w", err)
+		}
+	}
 	backup := &models.DatabaseBackup{
 		ID: backupID, LibraryID: task.LibraryID, ConnectionID: library.PID,
 		DatabaseName: task.DatabaseName, Source: source,
-		FileName: task.DatabaseName + "_" + time.Now().UTC().Format("20060102_150405") + ".sql.gz",
+		FileName: task.DatabaseName + "_" + time.Now().UTC().Format("20060102_150405") + extension,
 		FilePath: path, SizeBytes: size, SHA256: checksum,
+		BinlogFile: binlogFile, BinlogPosition: binlogPosition,
 		CreatedBy: task.RequestedBy, CreatedAt: time.Now().UTC(),
 	}
 	if err := m.db.Create(backup).Error; err != nil {
@@ -602,7 +735,11 @@ func verifyRegularFile(path string) (int64, string, error) {
 }
 
 func (m *Manager) safeBackupPath(backup *models.DatabaseBackup) (string, error) {
-	expected, err := m.artifactPath(backup.LibraryID, backup.ID)
+	extension, err := artifactExtension(backup.FilePath)
+	if err != nil {
+		return "", err
+	}
+	expected, err := m.artifactPath(backup.LibraryID, backup.ID, extension)
 	if err != nil {
 		return "", err
 	}
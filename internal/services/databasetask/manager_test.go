@@ -21,6 +21,7 @@ type fakeDatabaseOperator struct {
 	backupCalls  int
 	restoreCalls int
 	blockBackup  bool
+	failBackup   bool
 }
 
 func (f *fakeDatabaseOperator) Backup(
@@ -32,13 +33,16 @@ func (f *fakeDatabaseOperator) Backup(
 ) error {
 	f.mu.Lock()
 	f.backupCalls++
-	block := f.blockBackup
+	block, fail := f.blockBackup, f.failBackup
 	f.mu.Unlock()
 	report(20, "exporting")
 	if block {
 		<-ctx.Done()
 		return ctx.Err()
 	}
+	if fail {
+		return errors.New("insufficient disk space for database backup")
+	}
 	if err := os.WriteFile(destination, []byte("verified database backup"), 0600); err != nil {
 		return err
 	}
@@ -107,7 +111,7 @@ func TestBackupAndRestoreCreateVerifiedDurableArtifacts(t *testing.T) {
 	}
 	file.Close()
 
-	restoreTask, err := manager.SubmitRestore(11, backup.ID, 1)
+	restoreTask, err := manager.SubmitRestore(11, backup.ID, RecoveryTarget{}, 1)
 	if err != nil {
 		t.Fatalf("submit restore: %v", err)
 	}
@@ -130,6 +134,59 @@ func TestBackupAndRestoreCreateVerifiedDurableArtifacts(t *testing.T) {
 	}
 }
 
+func TestPostgresBackupUsesCustomArchiveArtifacts(t *testing.T) {
+	database := openDatabaseTaskTestDB(t)
+	if err := database.Create(&models.Library{
+		ID: 12, PID: 7, Name: "pgdb", Type: "postgres",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&models.Library{
+		ID: 13, PID: 7, Name: "cache", Type: "redis",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	operator := &fakeDatabaseOperator{}
+	root := t.TempDir()
+	manager := NewManager(database, filepath.Join(root, "backups"), filepath.Join(root, "logs"), operator)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+	if _, err := manager.SubmitBackup(13, 1); err == nil {
+		t.Fatal("Redis backup was accepted")
+	}
+
+	backupTask, err := manager.SubmitBackup(12, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupTask = waitForDatabaseTask(t, manager, backupTask.ID)
+	backup, err := manager.GetBackup(backupTask.ResultBackupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(backup.FilePath) != ".dump" || filepath.Ext(backup.FileName) != ".dump" {
+		t.Fatalf("PostgreSQL backup is not a custom archive: %+v", backup)
+	}
+	restoreTask, err := manager.SubmitRestore(12, backup.ID, RecoveryTarget{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoreTask = waitForDatabaseTask(t, manager, restoreTask.ID)
+	if restoreTask.Status != models.DatabaseTaskStatusSucceeded {
+		t.Fatalf("unexpected restore task: %+v", restoreTask)
+	}
+	safety, err := manager.GetBackup(restoreTask.SafetyBackupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(safety.FilePath) != ".dump" {
+		t.Fatalf("safety backup used the wrong format: %+v", safety)
+	}
+}
+
 func TestCancelRunningDatabaseTask(t *testing.T) {
 	database := openDatabaseTaskTestDB(t)
 	operator := &fakeDatabaseOperator{blockBackup: true}
@@ -189,7 +246,7 @@ func TestCorruptedBackupIsRejected(t *testing.T) {
 	if _, _, _, err := manager.OpenBackup(backup.ID); err == nil {
 		t.Fatal("expected corrupted backup to be rejected")
 	}
-	if _, err := manager.SubmitRestore(11, backup.ID, 1); err != nil {
+	if _, err := manager.SubmitRestore(11, backup.ID, RecoveryTarget{}, 1); err != nil {
 		t.Fatalf("submit queues metadata-valid source: %v", err)
 	}
 }
@@ -253,6 +310,8 @@ func openDatabaseTaskTestDB(t *testing.T) *gorm.DB {
 		&models.Library{},
 		&models.DatabaseTask{},
 		&models.DatabaseBackup{},
+		&models.DatabaseBinlog{},
+		&models.DatabaseBackupSchedule{},
 		&models.DatabaseOperationLock{},
 	); err != nil {
 		t.Fatal(err)
@@ -9,7 +9,9 @@ import (
 	"strings"
 
 	"oneinstack/internal/models"
+	"oneinstack/utils"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -196,6 +198,50 @@ func (m *Manager) OpenBackup(
 	return file, info, backup, nil
 }
 
+// ImportBackup copies a backup file obtained elsewhere, such as an off-site
+// copy, into the backup store of a database and registers it with the given
+// source. The copy must match original.SHA256; the stored file name is kept.
+func (m *Manager) ImportBackup(
+	libraryID int64,
+	path string,
+	original models.DatabaseBackup,
+	source string,
+	requestedBy int64,
+) (*models.DatabaseBackup, error) {
+	extension, err := m.libraryArtifactExtension(libraryID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(original.FileName, extension) {
+		return nil, fmt.Errorf("backup file %s does not match the %s format of this database", original.FileName, extension)
+	}
+	var library models.Library
+	if err := m.db.Select("id", "name").First(&library, libraryID).Error; err != nil {
+		return nil, err
+	}
+	backupID := uuid.NewString()
+	destination, err := m.artifactPath(libraryID, backupID, extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CopyVerifiedFile(path, destination, original.SHA256); err != nil {
+		return nil, fmt.Errorf("import database backup: %w", err)
+	}
+	task := &models.DatabaseTask{LibraryID: libraryID, DatabaseName: library.Name, RequestedBy: requestedBy}
+	backup, err := m.registerBackup(backupID, task, destination, source)
+	if err != nil {
+		_ = os.Remove(destination)
+		return nil, err
+	}
+	if original.FileName != "" && original.FileName != backup.FileName {
+		if err := m.db.Model(backup).Update("file_name", original.FileName).Error; err != nil {
+			return nil, err
+		}
+		backup.FileName = original.FileName
+	}
+	return backup, nil
+}
+
 func (m *Manager) DeleteBackup(backupID string) error {
 	backup, err := m.GetBackup(strings.TrimSpace(backupID))
 	if err != nil {
@@ -0,0 +1,456 @@
+package databasetask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/monitoring"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// scheduleTick is how often due schedules are looked for; schedules are
+	// evaluated against their last run, so a missed minute is caught up.
+	scheduleTick = "@every 1m"
+	// minimumBackupInterval keeps a schedule from dumping a database more
+	// often than a backup can reasonably finish.
+	minimumBackupInterval = time.Hour
+	maxKeepDaily          = 3650
+	maxKeepWeekly         = 520
+	maxKeepMonthly        = 240
+)
+
+var backupScheduleParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ScheduleInput configures the backup schedule of one library.
+type ScheduleInput struct {
+	Enabled         bool
+	Schedule        string
+	KeepDaily       int
+	KeepWeekly      int
+	KeepMonthly     int
+	NotifyOnFailure bool
+}
+
+// ScheduleResult summarizes one pass of the backup scheduler.
+type ScheduleResult struct {
+	Submitted      int `json:"submitted"`
+	Failed         int `json:"failed"`
+	BackupsDeleted int `json:"backupsDeleted"`
+}
+
+// BackupFailureNotifier reports a scheduled backup that did not complete.
+type BackupFailureNotifier func(ctx context.Context, failure monitoring.DatabaseBackupFailure) error
+
+func notifyMonitoringBackupFailure(ctx context.Context, failure monitoring.DatabaseBackupFailure) error {
+	manager := monitoring.Default()
+	if manager == nil {
+		return nil
+	}
+	return manager.NotifyDatabaseBackupFailure(ctx, failure)
+}
+
+func validateScheduleInput(input *ScheduleInput) error {
+	input.Schedule = strings.TrimSpace(input.Schedule)
+	if input.Schedule == "" {
+		return errors.New("backup schedule is required")
+	}
+	schedule, err := backupScheduleParser.Parse(input.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid backup schedule: %w", err)
+	}
+	first := schedule.Next(time.Now())
+	if second := schedule.Next(first); second.Sub(first) < minimumBackupInterval {
+		return errors.New("backups cannot be scheduled more than once per hour")
+	}
+	switch {
+	case input.KeepDaily < 0 || input.KeepDaily > maxKeepDaily:
+		return fmt.Errorf("daily backups to keep must be between 0 and %d", maxKeepDaily)
+	case input.KeepWeekly < 0 || input.KeepWeekly > maxKeepWeekly:
+		return fmt.Errorf("weekly backups to keep must be between 0 and %d", maxKeepWeekly)
+	case input.KeepMonthly < 0 || input.KeepMonthly > maxKeepMonthly:
+		return fmt.Errorf("monthly backups to keep must be between 0 and %d", maxKeepMonthly)
+	case input.KeepDaily+input.KeepWeekly+input.KeepMonthly == 0:
+		return errors.New("at least one daily, weekly or monthly backup must be kept")
+	}
+	return nil
+}
+
+func (m *Manager) ListSchedules() ([]models.DatabaseBackupSchedule, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	var schedules []models.DatabaseBackupSchedule
+	if err := m.db.Order("library_id ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (m *Manager) GetSchedule(libraryID int64) (*models.DatabaseBackupSchedule, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	var schedule models.DatabaseBackupSchedule
+	if err := m.db.First(&schedule, "library_id = ?", libraryID).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// SaveSchedule creates or replaces the backup schedule of a library. The next
+// run is computed from the last run, so changing a schedule does not trigger
+// an immediate backup unless one is already overdue.
+func (m *Manager) SaveSchedule(
+	libraryID int64,
+	input ScheduleInput,
+	updatedBy int64,
+) (*models.DatabaseBackupSchedule, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	if libraryID <= 0 || updatedBy <= 0 {
+		return nil, errors.New("database and authenticated user are required")
+	}
+	if err := validateScheduleInput(&input); err != nil {
+		return nil, err
+	}
+	var library models.Library
+	if err := m.db.First(&library, libraryID).Error; err != nil {
+		return nil, err
+	}
+	if _, ok := artifactExtensions[library.Type]; !ok {
+		return nil, errors.New("database backup and restore support MySQL and PostgreSQL only")
+	}
+	var schedule models.DatabaseBackupSchedule
+	err := m.db.First(&schedule, "library_id = ?", libraryID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	schedule.LibraryID = libraryID
+	schedule.Enabled = input.Enabled
+	schedule.Schedule = input.Schedule
+	schedule.KeepDaily = input.KeepDaily
+	schedule.KeepWeekly = input.KeepWeekly
+	schedule.KeepMonthly = input.KeepMonthly
+	schedule.NotifyOnFailure = input.NotifyOnFailure
+	schedule.UpdatedBy = updatedBy
+	// Save writes zero values too, so disabling a schedule or turning off
+	// notifications persists.
+	if err := m.db.Save(&schedule).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// DeleteSchedule stops scheduled backups of a library. Existing scheduled
+// backups are kept and fall back to the age-based cleanup.
+func (m *Manager) DeleteSchedule(libraryID int64) error {
+	if err := m.Start(); err != nil {
+		return err
+	}
+	result := m.db.Where("library_id = ?", libraryID).Delete(&models.DatabaseBackupSchedule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// BackupScheduler queues scheduled backups, reports the ones that fail and
+// applies grandfather-father-son retention after each successful run.
+type BackupScheduler struct {
+	manager   *Manager
+	scheduler *cron.Cron
+	now       func() time.Time
+	location  *time.Location
+	notify    BackupFailureNotifier
+	runMu     sync.Mutex
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewBackupScheduler(manager *Manager) (*BackupScheduler, error) {
+	if manager == nil || manager.db == nil {
+		return nil, errors.New("database backup scheduler manager is not configured")
+	}
+	scheduler := cron.New(cron.WithChain(
+		cron.SkipIfStillRunning(cron.DefaultLogger),
+		cron.Recover(cron.DefaultLogger),
+	))
+	backupScheduler := &BackupScheduler{
+		manager: manager, scheduler: scheduler, now: time.Now,
+		location: time.Local, notify: notifyMonitoringBackupFailure,
+	}
+	if _, err := scheduler.AddFunc(scheduleTick, func() {
+		result, runErr := backupScheduler.RunNow(context.Background())
+		if runErr != nil {
+			log.Printf("database backup schedule failed: %v", runErr)
+			return
+		}
+		if result.BackupsDeleted > 0 {
+			log.Printf("database backup retention removed %d scheduled backups", result.BackupsDeleted)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid database backup schedule tick: %w", err)
+	}
+	return backupScheduler, nil
+}
+
+func (s *BackupScheduler) Start() {
+	if s != nil {
+		s.startOnce.Do(func() { s.scheduler.Start() })
+	}
+}
+
+func (s *BackupScheduler) Stop(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	var stopped context.Context
+	s.stopOnce.Do(func() { stopped = s.scheduler.Stop() })
+	if stopped == nil {
+		return nil
+	}
+	select {
+	case <-stopped.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunNow settles the previous run of every schedule and queues the ones that
+// are due. A schedule whose previous backup is still running waits for it.
+func (s *BackupScheduler) RunNow(ctx context.Context) (*ScheduleResult, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if err := s.manager.Start(); err != nil {
+		return nil, err
+	}
+	var schedules []models.DatabaseBackupSchedule
+	if err := s.manager.db.Order("library_id ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	result := &ScheduleResult{}
+	for i := range schedules {
+		schedule := &schedules[i]
+		settled, err := s.settle(ctx, schedule, result)
+		if err != nil {
+			return result, err
+		}
+		if !settled || !schedule.Enabled {
+			continue
+		}
+		if err := s.submitDue(ctx, schedule, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// settle records the outcome of the last scheduled task once it finished. It
+// reports whether the schedule is free to run again.
+func (s *BackupScheduler) settle(
+	ctx context.Context,
+	schedule *models.DatabaseBackupSchedule,
+	result *ScheduleResult,
+) (bool, error) {
+	if schedule.LastTaskID == "" || models.IsDatabaseTaskTerminal(schedule.LastStatus) {
+		return true, nil
+	}
+	var task models.DatabaseTask
+	err := s.manager.db.First(&task, "id = ?", schedule.LastTaskID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		task = models.DatabaseTask{
+			ID: schedule.LastTaskID, Status: models.DatabaseTaskStatusFailed,
+			ErrorMessage: "计划备份任务记录不存在",
+		}
+	case err != nil:
+		return false, err
+	case !models.IsDatabaseTaskTerminal(task.Status):
+		return false, nil
+	}
+	updates := map[string]any{"last_status": task.Status, "last_error": truncateScheduleError(task.ErrorMessage)}
+	if err := s.manager.db.Model(&models.DatabaseBackupSchedule{}).
+		Where("id = ?", schedule.ID).Updates(updates).Error; err != nil {
+		return false, err
+	}
+	schedule.LastStatus = task.Status
+	switch task.Status {
+	case models.DatabaseTaskStatusSucceeded:
+		deleted, err := s.manager.applyRetention(schedule, s.location)
+		result.BackupsDeleted += deleted
+		if err != nil {
+			// Retention is applied again after the next successful run.
+			log.Printf("apply backup retention of database %d: %v", schedule.LibraryID, err)
+		}
+	case models.DatabaseTaskStatusCanceled:
+		// A canceled backup was stopped on purpose.
+	default:
+		result.Failed++
+		s.notifyFailure(ctx, schedule, task.ID, task.Status, task.ErrorMessage)
+	}
+	return true, nil
+}
+
+func (s *BackupScheduler) submitDue(
+	ctx context.Context,
+	schedule *models.DatabaseBackupSchedule,
+	result *ScheduleResult,
+) error {
+	spec, err := backupScheduleParser.Parse(schedule.Schedule)
+	if err != nil {
+		return s.recordSubmitFailure(ctx, schedule, result, fmt.Errorf("invalid backup schedule: %w", err))
+	}
+	since := schedule.CreatedAt
+	if schedule.LastRunAt != nil {
+		since = *schedule.LastRunAt
+	}
+	now := s.now().UTC()
+	if spec.Next(since.In(s.location)).After(now) {
+		return nil
+	}
+	task, err := s.manager.submit(Request{
+		Operation: "backup",
+		LibraryID: schedule.LibraryID,
+		Source:    models.DatabaseBackupSourceScheduled,
+	}, schedule.UpdatedBy)
+	if err != nil {
+		return s.recordSubmitFailure(ctx, schedule, result, err)
+	}
+	result.Submitted++
+	return s.manager.db.Model(&models.DatabaseBackupSchedule{}).Where("id = ?", schedule.ID).
+		Updates(map[string]any{
+			"last_run_at": now, "last_task_id": task.ID,
+			"last_status": task.Status, "last_error": "",
+		}).Error
+}
+
+// recordSubmitFailure marks the run as failed. The run still counts, so a
+// database that cannot be backed up is retried on the next scheduled time
+// instead of every minute.
+func (s *BackupScheduler) recordSubmitFailure(
+	ctx context.Context,
+	schedule *models.DatabaseBackupSchedule,
+	result *ScheduleResult,
+	cause error,
+) error {
+	result.Failed++
+	if err := s.manager.db.Model(&models.DatabaseBackupSchedule{}).Where("id = ?", schedule.ID).
+		Updates(map[string]any{
+			"last_run_at": s.now().UTC(), "last_task_id": "",
+			"last_status": models.DatabaseTaskStatusFailed, "last_error": truncateScheduleError(cause.Error()),
+		}).Error; err != nil {
+		return err
+	}
+	s.notifyFailure(ctx, schedule, "", models.DatabaseTaskStatusFailed, cause.Error())
+	return nil
+}
+
+func (s *BackupScheduler) notifyFailure(
+	ctx context.Context,
+	schedule *models.DatabaseBackupSchedule,
+	taskID, status, detail string,
+) {
+	if !schedule.NotifyOnFailure || s.notify == nil {
+		return
+	}
+	var library models.Library
+	name := fmt.Sprintf("#%d", schedule.LibraryID)
+	if err := s.manager.db.Select("name").First(&library, schedule.LibraryID).Error; err == nil {
+		name = library.Name
+	}
+	notifyContext, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if err := s.notify(notifyContext, monitoring.DatabaseBackupFailure{
+		LibraryID: schedule.LibraryID, DatabaseName: name, TaskID: taskID,
+		Status: status, Detail: detail, OccurredAt: s.now().UTC(),
+	}); err != nil {
+		log.Printf("notify scheduled backup failure of database %d: %v", schedule.LibraryID, err)
+	}
+}
+
+// applyRetention keeps the newest scheduled backup of each of the last
+// KeepDaily days, KeepWeekly ISO weeks and KeepMonthly months, counted over
+// the periods that have a backup, and deletes the other scheduled backups of
+// the library. The newest backup is always kept; manual and pre-restore
+// backups are not touched.
+func (m *Manager) applyRetention(schedule *models.DatabaseBackupSchedule, location *time.Location) (int, error) {
+	var backups []models.DatabaseBackup
+	if err := m.db.Where("library_id = ? AND source = ?", schedule.LibraryID, models.DatabaseBackupSourceScheduled).
+		Order("created_at DESC, id DESC").Find(&backups).Error; err != nil {
+		return 0, err
+	}
+	keep := retainedBackups(backups, schedule, location)
+	deleted := 0
+	for i := range backups {
+		if keep[backups[i].ID] {
+			continue
+		}
+		removed, _, err := m.removeRetiredBackup(&backups[i])
+		if err != nil {
+			return deleted, err
+		}
+		if removed {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// retainedBackups selects the backups to keep from backups ordered newest
+// first.
+func retainedBackups(
+	backups []models.DatabaseBackup,
+	schedule *models.DatabaseBackupSchedule,
+	location *time.Location,
+) map[string]bool {
+	keep := map[string]bool{}
+	if len(backups) == 0 {
+		return keep
+	}
+	keep[backups[0].ID] = true
+	retain := func(limit int, period func(time.Time) string) {
+		seen := map[string]bool{}
+		for _, backup := range backups {
+			if len(seen) >= limit {
+				return
+			}
+			key := period(backup.CreatedAt.In(location))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep[backup.ID] = true
+		}
+	}
+	retain(schedule.KeepDaily, func(at time.Time) string { return at.Format("2006-01-02") })
+	retain(schedule.KeepWeekly, func(at time.Time) string {
+		year, week := at.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	retain(schedule.KeepMonthly, func(at time.Time) string { return at.Format("2006-01") })
+	return keep
+}
+
+func truncateScheduleError(message string) string {
+	runes := []rune(strings.TrimSpace(message))
+	if len(runes) > 1024 {
+		runes = runes[:1024]
+	}
+	return string(runes)
+}
@@ -0,0 +1,188 @@
+package databasetask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/monitoring"
+)
+
+func TestRetentionKeepsDailyWeeklyAndMonthlyBackups(t *testing.T) {
+	database := openDatabaseTaskTestDB(t)
+	root := t.TempDir()
+	manager := NewManager(database, filepath.Join(root, "backups"), filepath.Join(root, "logs"), &fakeDatabaseOperator{})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// One scheduled backup a day at noon from 2026-01-01 (a Thursday) to
+	// 2026-03-31, plus a manual backup that retention must not touch.
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for day := 0; day < 90; day++ {
+		id := fmt.Sprintf("a0000000-0000-4000-8000-%012d", day)
+		path, err := manager.artifactPath(11, id, ".sql.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(id), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Create(&models.DatabaseBackup{
+			ID: id, LibraryID: 11, ConnectionID: 7, DatabaseName: "appdb",
+			Source: models.DatabaseBackupSourceScheduled, FileName: "appdb.sql.gz", FilePath: path,
+			SHA256: strings.Repeat("0", 64), CreatedBy: 1, CreatedAt: start.AddDate(0, 0, day),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Create(&models.DatabaseBackup{
+		ID: "b0000000-0000-4000-8000-000000000001", LibraryID: 11, ConnectionID: 7, DatabaseName: "appdb",
+		Source: models.DatabaseBackupSourceManual, FileName: "appdb.sql.gz",
+		FilePath: filepath.Join(root, "backups", "11", "b0000000-0000-4000-8000-000000000001.sql.gz"),
+		SHA256:   strings.Repeat("0", 64), CreatedBy: 1, CreatedAt: start,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	schedule := &models.DatabaseBackupSchedule{LibraryID: 11, KeepDaily: 3, KeepWeekly: 2, KeepMonthly: 3}
+	deleted, err := manager.applyRetention(schedule, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []models.DatabaseBackup
+	if err := database.Where("source = ?", models.DatabaseBackupSourceScheduled).
+		Order("created_at DESC").Find(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	var days []string
+	for _, backup := range kept {
+		days = append(days, backup.CreatedAt.UTC().Format("01-02"))
+	}
+	// Daily: Mar 31, 30, 29. Weekly: Mar 31 and Sunday Mar 29 closing the
+	// previous ISO week. Monthly: Mar 31, Feb 28 and Jan 31.
+	if got := strings.Join(days, " "); got != "03-31 03-30 03-29 02-28 01-31" || deleted != 85 {
+		t.Fatalf("unexpected retained backups %q after deleting %d", got, deleted)
+	}
+	remaining, err := filepath.Glob(filepath.Join(root, "backups", "11", "a0000000-*"))
+	if err != nil || len(remaining) != 5 {
+		t.Fatalf("pruned backup files were kept: %d %v", len(remaining), err)
+	}
+	if _, err := manager.GetBackup("b0000000-0000-4000-8000-000000000001"); err != nil {
+		t.Fatalf("manual backup was pruned: %v", err)
+	}
+
+	// Scheduled backups of a scheduled library are left to retention by the
+	// age-based cleaner.
+	if err := database.Create(schedule).Error; err != nil {
+		t.Fatal(err)
+	}
+	cleaner, err := NewCleaner(manager, 1, "@every 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := cleaner.RunNow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BackupsDeleted != 1 {
+		t.Fatalf("unexpected cleanup result: %+v", result)
+	}
+}
+
+func TestBackupSchedulerRunsDueBackupsAndReportsFailures(t *testing.T) {
+	database := openDatabaseTaskTestDB(t)
+	operator := &fakeDatabaseOperator{}
+	root := t.TempDir()
+	manager := NewManager(database, filepath.Join(root, "backups"), filepath.Join(root, "logs"), operator)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+	for _, input := range []ScheduleInput{
+		{Schedule: "not a schedule", KeepDaily: 7},
+		{Schedule: "*/10 * * * *", KeepDaily: 7},
+		{Schedule: "0 3 * * *"},
+		{Schedule: "0 3 * * *", KeepDaily: -1, KeepWeekly: 4},
+	} {
+		if _, err := manager.SaveSchedule(11, input, 1); err == nil {
+			t.Fatalf("invalid schedule was accepted: %+v", input)
+		}
+	}
+	if _, err := manager.SaveSchedule(11, ScheduleInput{
+		Enabled: true, Schedule: "0 3 * * *", KeepDaily: 7, KeepWeekly: 4, NotifyOnFailure: true,
+	}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler, err := NewBackupScheduler(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Add(48 * time.Hour)
+	scheduler.now = func() time.Time { return now }
+	var failures []monitoring.DatabaseBackupFailure
+	scheduler.notify = func(_ context.Context, failure monitoring.DatabaseBackupFailure) error {
+		failures = append(failures, failure)
+		return nil
+	}
+
+	result, err := scheduler.RunNow(context.Background())
+	if err != nil || result.Submitted != 1 {
+		t.Fatalf("due backup was not queued: %+v %v", result, err)
+	}
+	schedule, err := manager.GetSchedule(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := waitForDatabaseTask(t, manager, schedule.LastTaskID)
+	if task.Status != models.DatabaseTaskStatusSucceeded || task.Source != models.DatabaseBackupSourceScheduled {
+		t.Fatalf("unexpected scheduled task: %+v", task)
+	}
+	backup, err := manager.GetBackup(task.ResultBackupID)
+	if err != nil || backup.Source != models.DatabaseBackupSourceScheduled {
+		t.Fatalf("scheduled backup was not recorded: %+v %v", backup, err)
+	}
+	if result, err = scheduler.RunNow(context.Background()); err != nil || result.Submitted != 0 {
+		t.Fatalf("backup ran again before its next time: %+v %v", result, err)
+	}
+	if schedule, _ = manager.GetSchedule(11); schedule.LastStatus != models.DatabaseTaskStatusSucceeded {
+		t.Fatalf("run outcome was not recorded: %+v", schedule)
+	}
+
+	operator.mu.Lock()
+	operator.failBackup = true
+	operator.mu.Unlock()
+	now = now.Add(24 * time.Hour)
+	if _, err := scheduler.RunNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	schedule, _ = manager.GetSchedule(11)
+	if task = waitForDatabaseTask(t, manager, schedule.LastTaskID); task.Status != models.DatabaseTaskStatusFailed {
+		t.Fatalf("unexpected failing task: %+v", task)
+	}
+	if result, err = scheduler.RunNow(context.Background()); err != nil || result.Failed != 1 {
+		t.Fatalf("failed backup was not settled: %+v %v", result, err)
+	}
+	if len(failures) != 1 || failures[0].DatabaseName != "appdb" || failures[0].TaskID != task.ID ||
+		!strings.Contains(failures[0].Detail, "insufficient disk space") {
+		t.Fatalf("unexpected failure notifications: %+v", failures)
+	}
+	if schedule, _ = manager.GetSchedule(11); schedule.LastStatus != models.DatabaseTaskStatusFailed ||
+		schedule.LastError == "" {
+		t.Fatalf("failure was not recorded: %+v", schedule)
+	}
+	if _, err := scheduler.RunNow(context.Background()); err != nil || len(failures) != 1 {
+		t.Fatalf("failure was reported twice: %+v %v", failures, err)
+	}
+}
@@ -0,0 +1,202 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	MetricCertificateExpiryDays      = "certificate_expiry_days"
+	MetricCertificateRenewalFailures = "certificate_renewal_failures"
+	MetricCertificateRevoked         = "certificate_revoked"
+
+	resourceTypeCertificate    = "certificate"
+	maxCertificateObservations = 4096
+)
+
+var certificateMetrics = []string{
+	MetricCertificateExpiryDays,
+	MetricCertificateRenewalFailures,
+	MetricCertificateRevoked,
+}
+
+// CertificateObservation is one managed certificate as seen by the
+// certificate service. Rules on certificate metrics are evaluated per
+// observation, so every certificate keeps its own alert state.
+type CertificateObservation struct {
+	ID              string
+	Name            string
+	NotAfter        time.Time
+	RenewalFailures int
+	Revoked         bool
+	LastError       string
+	CheckedAt       time.Time
+}
+
+type CertificateCollector interface {
+	CollectCertificates(context.Context) ([]CertificateObservation, error)
+}
+
+type CertificateCollectorFunc func(context.Context) ([]CertificateObservation, error)
+
+func (function CertificateCollectorFunc) CollectCertificates(
+	ctx context.Context,
+) ([]CertificateObservation, error) {
+	return function(ctx)
+}
+
+func (manager *Manager) SetCertificateCollector(collector CertificateCollector) {
+	if manager == nil {
+		return
+	}
+	manager.certificateMu.Lock()
+	manager.certificates = collector
+	manager.certificateMu.Unlock()
+}
+
+func isCertificateMetric(metric string) bool {
+	for _, candidate := range certificateMetrics {
+		if candidate == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCertificates evaluates certificate rules against the latest
+// observations. State for certificates that disappeared is dropped without a
+// resolved event because there is nothing left to recover.
+func (manager *Manager) CheckCertificates(ctx context.Context) error {
+	if manager == nil {
+		return errors.New("monitoring manager is not initialized")
+	}
+	manager.certificateMu.Lock()
+	defer manager.certificateMu.Unlock()
+	if manager.certificates == nil {
+		return nil
+	}
+	observations, err := manager.certificates.CollectCertificates(ctx)
+	if err != nil {
+		return fmt.Errorf("collect certificate alerts: %w", err)
+	}
+	if len(observations) > maxCertificateObservations {
+		return errors.New("certificate collector returned too many observations")
+	}
+	seen := make([]string, 0, len(observations))
+	for index := range observations {
+		observation := &observations[index]
+		observation.ID = truncateText(observation.ID, 64)
+		observation.Name = truncateText(observation.Name, 80)
+		observation.LastError = truncateText(observation.LastError, 160)
+		if observation.ID == "" {
+			return errors.New("certificate observation id is required")
+		}
+		if observation.Name == "" {
+			observation.Name = observation.ID
+		}
+		if observation.CheckedAt.IsZero() {
+			observation.CheckedAt = manager.now().UTC()
+		} else {
+			observation.CheckedAt = observation.CheckedAt.UTC()
+		}
+		seen = append(seen, observation.ID)
+	}
+	var rules []models.MonitorRule
+	if err := manager.db.Where("enabled = ? AND metric IN ?", true, certificateMetrics).
+		Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+	for index := range rules {
+		rule := &rules[index]
+		for observationIndex := range observations {
+			if rule.ResourceID != "" && rule.ResourceID != observations[observationIndex].ID {
+				continue
+			}
+			event, notify, err := manager.evaluateCertificateRule(rule, &observations[observationIndex])
+			if err != nil {
+				return err
+			}
+			if event != nil && notify {
+				manager.deliver(ctx, event)
+			}
+		}
+	}
+	stale := manager.db.Where("resource_type = ?", resourceTypeCertificate)
+	if len(seen) > 0 {
+		stale = stale.Where("resource_id NOT IN ?", seen)
+	}
+	return stale.Delete(&models.MonitorResourceAlertState{}).Error
+}
+
+func certificateMetricValue(observation *CertificateObservation, metric string) float64 {
+	switch metric {
+	case MetricCertificateExpiryDays:
+		return observation.NotAfter.Sub(observation.CheckedAt).Hours() / 24
+	case MetricCertificateRenewalFailures:
+		return float64(observation.RenewalFailures)
+	case MetricCertificateRevoked:
+		if observation.Revoked {
+			return 1
+		}
+		return 0
+	default:
+		return 0
+	}
+}
+
+func (manager *Manager) evaluateCertificateRule(
+	rule *models.MonitorRule,
+	observation *CertificateObservation,
+) (*models.MonitorAlertEvent, bool, error) {
+	return manager.evaluateResourceRule(
+		rule, resourceTypeCertificate, observation.ID,
+		certificateMetricValue(observation, rule.Metric), observation.CheckedAt,
+		func(eventType string, value float64, started, occurred time.Time, resolved *time.Time) *models.MonitorAlertEvent {
+			return newCertificateEvent(rule, observation, eventType, value, started, occurred, resolved)
+		},
+	)
+}
+
+func newCertificateEvent(
+	rule *models.MonitorRule,
+	observation *CertificateObservation,
+	eventType string,
+	value float64,
+	started, occurred time.Time,
+	resolved *time.Time,
+) *models.MonitorAlertEvent {
+	message := "证书 " + observation.Name
+	switch rule.Metric {
+	case MetricCertificateExpiryDays:
+		if value <= 0 {
+			message += " 已过期"
+		} else {
+			message += fmt.Sprintf(" 剩余 %.1f 天过期", value)
+		}
+	case MetricCertificateRenewalFailures:
+		message += fmt.Sprintf(" 连续续签失败 %d 次", observation.RenewalFailures)
+	case MetricCertificateRevoked:
+		if observation.Revoked {
+			message += " 已被 CA 吊销（OCSP）"
+		} else {
+			message += " OCSP 状态正常"
+		}
+	}
+	if eventType == models.AlertEventResolved {
+		message += "，告警已恢复"
+	} else if observation.LastError != "" && rule.Metric != MetricCertificateRevoked {
+		message += "：" + observation.LastError
+	}
+	return &models.MonitorAlertEvent{
+		RuleID: rule.ID, RuleName: rule.Name, Metric: rule.Metric,
+		ResourceType: resourceTypeCertificate, ResourceID: observation.ID,
+		Severity: rule.Severity, EventType: eventType, Value: value,
+		Threshold: rule.Threshold, StartedAt: started, OccurredAt: occurred,
+		ResolvedAt: resolved, Message: truncateText(strings.TrimSpace(message), 255),
+	}
+}
@@ -0,0 +1,333 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+const defaultNotificationTemplate = `{{.Title}}
+{{.Message}}
+事件：{{.Event}}{{if .ResourceID}}
+资源：{{.ResourceType}} {{.ResourceID}}{{end}}
+时间：{{.OccurredAt.Format "2006-01-02 15:04:05 MST"}}`
+
+const maxNotificationBody = 4000
+
+// notificationData is the value exposed to channel templates.
+type notificationData struct {
+	Title        string
+	Rule         string
+	Metric       string
+	Severity     string
+	Event        string
+	ResourceType string
+	ResourceID   string
+	Message      string
+	Value        float64
+	Threshold    float64
+	StartedAt    time.Time
+	OccurredAt   time.Time
+}
+
+func notificationTitle(event *models.MonitorAlertEvent) string {
+	return "[" + strings.ToUpper(event.Severity) + "] " + event.RuleName
+}
+
+func renderNotification(text string, event *models.MonitorAlertEvent) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		text = defaultNotificationTemplate
+	}
+	parsed, err := template.New("notification").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("notification template is invalid: %w", err)
+	}
+	var output bytes.Buffer
+	if err := parsed.Execute(&output, notificationData{
+		Title: notificationTitle(event), Rule: event.RuleName, Metric: event.Metric,
+		Severity: event.Severity, Event: event.EventType,
+		ResourceType: event.ResourceType, ResourceID: event.ResourceID,
+		Message: event.Message, Value: event.Value, Threshold: event.Threshold,
+		StartedAt: event.StartedAt, OccurredAt: event.OccurredAt,
+	}); err != nil {
+		return "", fmt.Errorf("notification template failed: %w", err)
+	}
+	body := strings.TrimSpace(output.String())
+	if body == "" {
+		return "", errors.New("notification template rendered an empty message")
+	}
+	return truncateText(body, maxNotificationBody), nil
+}
+
+func (sender *ChannelSender) sendWebhook(
+	ctx context.Context,
+	config *channelConfig,
+	event *models.MonitorAlertEvent,
+	body string,
+) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"source": "oneinstack-panel", "event": event.EventType,
+		"severity": event.Severity, "rule": event.RuleName, "metric": event.Metric,
+		"resourceType": event.ResourceType, "resourceId": event.ResourceID,
+		"value": event.Value, "threshold": event.Threshold,
+		"startedAt": event.StartedAt, "occurredAt": event.OccurredAt,
+		"message": event.Message, "text": body,
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"X-Oneinstack-Timestamp": unixTimestamp(sender.now())}
+	if config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(config.Secret))
+		_, _ = mac.Write(payload)
+		headers["X-Oneinstack-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	_, err = sender.post(ctx, config.URL, payload, headers)
+	return err
+}
+
+// sendRobot formats the message for chat robots that accept a single JSON
+// POST. DingTalk and Feishu sign requests with the channel secret when set.
+func (sender *ChannelSender) sendRobot(
+	ctx context.Context,
+	channelType string,
+	config *channelConfig,
+	body string,
+) error {
+	target := config.URL
+	var payload map[string]interface{}
+	switch channelType {
+	case ChannelTypeSlack:
+		payload = map[string]interface{}{"text": body}
+	case ChannelTypeDiscord:
+		payload = map[string]interface{}{"content": truncateText(body, 2000)}
+	case ChannelTypeWeCom:
+		payload = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": body}}
+	case ChannelTypeDingTalk:
+		payload = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": body}}
+		if config.Secret != "" {
+			timestamp := strconv.FormatInt(sender.now().UnixMilli(), 10)
+			mac := hmac.New(sha256.New, []byte(config.Secret))
+			_, _ = mac.Write([]byte(timestamp + "\n" + config.Secret))
+			parsed, err := url.Parse(target)
+			if err != nil {
+				return errors.New("webhook URL is invalid")
+			}
+			query := parsed.Query()
+			query.Set("timestamp", timestamp)
+			query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			parsed.RawQuery = query.Encode()
+			target = parsed.String()
+		}
+	case ChannelTypeFeishu:
+		payload = map[string]interface{}{"msg_type": "text", "content": map[string]string{"text": body}}
+		if config.Secret != "" {
+			timestamp := unixTimestamp(sender.now())
+			mac := hmac.New(sha256.New, []byte(timestamp+"\n"+config.Secret))
+			payload["timestamp"] = timestamp
+			payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+	default:
+		return errors.New("unsupported notification channel")
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	response, err := sender.post(ctx, target, encoded, nil)
+	if err != nil {
+		return err
+	}
+	return robotResponseError(channelType, response)
+}
+
+// robotResponseError reports failures that chat robots return with HTTP 200.
+func robotResponseError(channelType string, response []byte) error {
+	if channelType != ChannelTypeDingTalk && channelType != ChannelTypeWeCom && channelType != ChannelTypeFeishu {
+		return nil
+	}
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("%s returned an unreadable response", channelType)
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("%s rejected the message: %d %s", channelType, *result.ErrCode, truncateText(result.ErrMsg, 120))
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf("%s rejected the message: %d %s", channelType, *result.Code, truncateText(result.Msg, 120))
+	}
+	return nil
+}
+
+func (sender *ChannelSender) sendTelegram(ctx context.Context, config *channelConfig, body string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"chat_id": config.ChatID, "text": body, "disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	response, err := sender.post(ctx, sender.telegramAPI+"/bot"+config.BotToken+"/sendMessage", payload, nil)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil || !result.OK {
+		return fmt.Errorf("telegram rejected the message: %s", truncateText(result.Description, 120))
+	}
+	return nil
+}
+
+// post sends a JSON body and returns at most 4 KiB of the response. Errors
+// never include the URL because robot URLs and bot tokens are credentials.
+func (sender *ChannelSender) post(
+	ctx context.Context,
+	target string,
+	payload []byte,
+	headers map[string]string,
+) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.New("webhook URL is invalid")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Oneinstack-Panel/monitor")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return nil, errors.New("webhook request failed")
+	}
+	defer response.Body.Close()
+	content, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, fmt.Errorf("webhook returned HTTP %d", response.StatusCode)
+	}
+	return content, nil
+}
+
+// sendEmail delivers over implicit TLS or mandatory STARTTLS; plaintext SMTP
+// is never used because the session carries credentials and alert details.
+func (sender *ChannelSender) sendEmail(
+	ctx context.Context,
+	config *channelConfig,
+	event *models.MonitorAlertEvent,
+	body string,
+) error {
+	from, err := mail.ParseAddress(config.SMTPFrom)
+	if err != nil {
+		return errors.New("SMTP sender address is invalid")
+	}
+	recipients := make([]*mail.Address, 0, len(config.SMTPTo))
+	for _, value := range config.SMTPTo {
+		recipient, err := mail.ParseAddress(value)
+		if err != nil {
+			return errors.New("SMTP recipient is invalid")
+		}
+		recipients = append(recipients, recipient)
+	}
+	conn, err := sender.dial(ctx, "tcp", net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort)))
+	if err != nil {
+		return fmt.Errorf("connect SMTP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	tlsConfig := &tls.Config{ServerName: config.SMTPHost, RootCAs: sender.rootCAs, MinVersion: tls.VersionTLS12}
+	if config.SMTPSecurity == SMTPSecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+	if config.SMTPSecurity == SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not offer STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if config.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)); err != nil {
+			return errors.New("SMTP authentication failed")
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP sender rejected: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return fmt.Errorf("SMTP recipient rejected: %w", err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(emailMessage(from, recipients, notificationTitle(event), body, sender.now())); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %w", err)
+	}
+	return client.Quit()
+}
+
+func emailMessage(from *mail.Address, to []*mail.Address, subject, body string, now time.Time) []byte {
+	var message bytes.Buffer
+	addresses := make([]string, 0, len(to))
+	for _, recipient := range to {
+		addresses = append(addresses, recipient.String())
+	}
+	message.WriteString("From: " + from.String() + "\r\n")
+	message.WriteString("To: " + strings.Join(addresses, ", ") + "\r\n")
+	message.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	message.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	encoder := quotedprintable.NewWriter(&message)
+	_, _ = encoder.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	_ = encoder.Close()
+	message.WriteString("\r\n")
+	return message.Bytes()
+}
+
+func unixTimestamp(now time.Time) string {
+	return strconv.FormatInt(now.Unix(), 10)
+}
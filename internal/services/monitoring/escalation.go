@@ -0,0 +1,362 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxEscalationSteps    = 10
+	maxEscalationChannels = 20
+)
+
+type EscalationPolicyInput struct {
+	Name  string                         `json:"name"`
+	Steps []models.MonitorEscalationStep `json:"steps"`
+}
+
+func (manager *Manager) ListEscalationPolicies() ([]models.MonitorEscalationPolicy, error) {
+	var policies []models.MonitorEscalationPolicy
+	err := manager.db.Order("id ASC").Find(&policies).Error
+	return policies, err
+}
+
+func (manager *Manager) CreateEscalationPolicy(input EscalationPolicyInput) (*models.MonitorEscalationPolicy, error) {
+	input, err := manager.validateEscalationPolicy(input)
+	if err != nil {
+		return nil, err
+	}
+	policy := &models.MonitorEscalationPolicy{Name: input.Name, Steps: input.Steps}
+	if err := manager.db.Create(policy).Error; err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (manager *Manager) UpdateEscalationPolicy(
+	id uint,
+	input EscalationPolicyInput,
+) (*models.MonitorEscalationPolicy, error) {
+	var policy models.MonitorEscalationPolicy
+	if err := manager.db.First(&policy, id).Error; err != nil {
+		return nil, err
+	}
+	input, err := manager.validateEscalationPolicy(input)
+	if err != nil {
+		return nil, err
+	}
+	policy.Name = input.Name
+	policy.Steps = input.Steps
+	if err := manager.db.Save(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeleteEscalationPolicy detaches the policy from its rules, which fall back
+// to notifying every enabled channel.
+func (manager *Manager) DeleteEscalationPolicy(id uint) error {
+	return manager.db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Delete(&models.MonitorEscalationPolicy{}, id); result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&models.MonitorRule{}).Where("escalation_policy_id = ?", id).
+			Update("escalation_policy_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.MonitorAlertEvent{}).Where("escalation_policy_id = ? AND next_escalation_at IS NOT NULL", id).
+			Update("next_escalation_at", nil).Error
+	})
+}
+
+func (manager *Manager) validateEscalationPolicy(input EscalationPolicyInput) (EscalationPolicyInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > 120 {
+		return input, errors.New("escalation policy name must contain 1 to 120 characters")
+	}
+	if len(input.Steps) == 0 || len(input.Steps) > maxEscalationSteps {
+		return input, fmt.Errorf("escalation policy must have 1 to %d steps", maxEscalationSteps)
+	}
+	steps := make([]models.MonitorEscalationStep, 0, len(input.Steps))
+	previousDelay := 0
+	for index, step := range input.Steps {
+		if step.DelayMinutes < previousDelay || step.DelayMinutes > 10080 {
+			return input, fmt.Errorf("step %d delay must be between the previous step and 10080 minutes", index+1)
+		}
+		previousDelay = step.DelayMinutes
+		schedule, err := parseRuleSchedule(step.Schedule)
+		if err != nil {
+			return input, fmt.Errorf("step %d has an invalid on-call schedule: %w", index+1, err)
+		}
+		if schedule != nil {
+			step.Schedule = strings.Join(strings.Fields(strings.ToLower(step.Schedule)), " ")
+		} else {
+			step.Schedule = ""
+		}
+		ids := make([]string, 0, len(step.ChannelIDs))
+		seen := make(map[string]bool, len(step.ChannelIDs))
+		for _, id := range step.ChannelIDs {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 || len(ids) > maxEscalationChannels {
+			return input, fmt.Errorf("step %d must notify 1 to %d channels", index+1, maxEscalationChannels)
+		}
+		var count int64
+		if err := manager.db.Model(&models.NotificationChannel{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+			return input, err
+		}
+		if int(count) != len(ids) {
+			return input, fmt.Errorf("step %d references an unknown notification channel", index+1)
+		}
+		step.ChannelIDs = ids
+		steps = append(steps, step)
+	}
+	input.Steps = steps
+	return input, nil
+}
+
+func (manager *Manager) escalationPolicyExists(id *uint) error {
+	if id == nil {
+		return nil
+	}
+	var count int64
+	if err := manager.db.Model(&models.MonitorEscalationPolicy{}).Where("id = ?", *id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("escalation policy does not exist")
+	}
+	return nil
+}
+
+// AcknowledgeEvent records who is handling a triggered alert and stops its
+// escalation. Reminders are not delivered while an alert is acknowledged.
+func (manager *Manager) AcknowledgeEvent(id uint64, username string) (*models.MonitorAlertEvent, error) {
+	username = truncateText(username, 64)
+	if username == "" {
+		return nil, errors.New("acknowledging user is required")
+	}
+	event, err := manager.openIncident(id)
+	if err != nil {
+		return nil, err
+	}
+	if event.AcknowledgedAt != nil {
+		return nil, fmt.Errorf("alert is already acknowledged by %s", event.AcknowledgedBy)
+	}
+	now := manager.now().UTC()
+	if err := manager.db.Model(event).Updates(map[string]interface{}{
+		"acknowledged_at": now, "acknowledged_by": username, "next_escalation_at": nil,
+	}).Error; err != nil {
+		return nil, err
+	}
+	event.AcknowledgedAt, event.AcknowledgedBy, event.NextEscalationAt = &now, username, nil
+	return event, nil
+}
+
+// UnacknowledgeEvent hands an alert back. Escalation resumes on the next
+// evaluation with every step whose delay has already passed.
+func (manager *Manager) UnacknowledgeEvent(id uint64) (*models.MonitorAlertEvent, error) {
+	event, err := manager.openIncident(id)
+	if err != nil {
+		return nil, err
+	}
+	if event.AcknowledgedAt == nil {
+		return nil, errors.New("alert is not acknowledged")
+	}
+	updates := map[string]interface{}{"acknowledged_at": nil, "acknowledged_by": "", "next_escalation_at": nil}
+	var next *time.Time
+	if event.EscalationPolicyID != nil {
+		now := manager.now().UTC()
+		next = &now
+		updates["next_escalation_at"] = now
+	}
+	if err := manager.db.Model(event).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	event.AcknowledgedAt, event.AcknowledgedBy, event.NextEscalationAt = nil, "", next
+	return event, nil
+}
+
+func (manager *Manager) openIncident(id uint64) (*models.MonitorAlertEvent, error) {
+	var event models.MonitorAlertEvent
+	if err := manager.db.First(&event, id).Error; err != nil {
+		return nil, err
+	}
+	if event.EventType != models.AlertEventTriggered {
+		return nil, errors.New("only triggered alerts can be acknowledged")
+	}
+	resolved, err := manager.incidentResolved(&event)
+	if err != nil {
+		return nil, err
+	}
+	if resolved {
+		return nil, errors.New("alert is already resolved")
+	}
+	return &event, nil
+}
+
+func incidentQuery(db *gorm.DB, event *models.MonitorAlertEvent, eventType string) *gorm.DB {
+	return db.Model(&models.MonitorAlertEvent{}).Where(
+		"rule_id = ? AND metric = ? AND resource_type = ? AND resource_id = ? AND started_at = ? AND event_type = ?",
+		event.RuleID, event.Metric, event.ResourceType, event.ResourceID, event.StartedAt.UTC(), eventType,
+	)
+}
+
+func (manager *Manager) incidentResolved(event *models.MonitorAlertEvent) (bool, error) {
+	var count int64
+	err := incidentQuery(manager.db, event, models.AlertEventResolved).Count(&count).Error
+	return count > 0, err
+}
+
+// incidentFor returns the triggered event a reminder or resolution belongs to.
+func (manager *Manager) incidentFor(event *models.MonitorAlertEvent) (*models.MonitorAlertEvent, error) {
+	var incident models.MonitorAlertEvent
+	err := incidentQuery(manager.db, event, models.AlertEventTriggered).Order("id DESC").First(&incident).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &incident, err
+}
+
+func (manager *Manager) escalationPolicy(id *uint) (*models.MonitorEscalationPolicy, error) {
+	if id == nil {
+		return nil, nil
+	}
+	var policy models.MonitorEscalationPolicy
+	err := manager.db.First(&policy, *id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &policy, err
+}
+
+// routeEvent decides which channels receive an event. Rules without an
+// escalation policy notify every enabled channel. With a policy, a triggered
+// event starts the escalation and later events go to the steps reached so far
+// whose on-call window is open.
+func (manager *Manager) routeEvent(ctx context.Context, event *models.MonitorAlertEvent) (bool, []string, error) {
+	if event.RuleID == 0 {
+		return false, nil, nil
+	}
+	if event.EventType == models.AlertEventTriggered {
+		var rule models.MonitorRule
+		if err := manager.db.Select("id", "escalation_policy_id").First(&rule, event.RuleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil, nil
+			}
+			return false, nil, err
+		}
+		policy, err := manager.escalationPolicy(rule.EscalationPolicyID)
+		if err != nil || policy == nil {
+			return false, nil, err
+		}
+		return true, nil, manager.escalate(ctx, event, policy, manager.now().UTC())
+	}
+	incident, err := manager.incidentFor(event)
+	if err != nil || incident == nil {
+		return false, nil, err
+	}
+	policy, err := manager.escalationPolicy(incident.EscalationPolicyID)
+	if err != nil || policy == nil {
+		return false, nil, err
+	}
+	if event.EventType == models.AlertEventResolved && incident.NextEscalationAt != nil {
+		if err := manager.db.Model(incident).Update("next_escalation_at", nil).Error; err != nil {
+			return true, nil, err
+		}
+	}
+	if event.EventType == models.AlertEventReminder && incident.AcknowledgedAt != nil {
+		return true, nil, nil
+	}
+	now := manager.now()
+	ids := make([]string, 0)
+	for index := 0; index < incident.EscalationLevel && index < len(policy.Steps); index++ {
+		if ruleScheduleActive(policy.Steps[index].Schedule, now) {
+			ids = append(ids, policy.Steps[index].ChannelIDs...)
+		}
+	}
+	return true, ids, nil
+}
+
+// escalate notifies every step of the policy whose delay has passed since the
+// alert triggered and schedules the next one.
+func (manager *Manager) escalate(
+	ctx context.Context,
+	event *models.MonitorAlertEvent,
+	policy *models.MonitorEscalationPolicy,
+	now time.Time,
+) error {
+	elapsed := now.Sub(event.OccurredAt)
+	level := event.EscalationLevel
+	for level < len(policy.Steps) && stepDelay(policy.Steps[level]) <= elapsed {
+		step := policy.Steps[level]
+		if ruleScheduleActive(step.Schedule, now) {
+			manager.deliverToChannels(ctx, event, step.ChannelIDs)
+		}
+		level++
+	}
+	var next *time.Time
+	if level < len(policy.Steps) {
+		value := event.OccurredAt.Add(stepDelay(policy.Steps[level])).UTC()
+		next = &value
+	}
+	policyID := policy.ID
+	event.EscalationPolicyID, event.EscalationLevel, event.NextEscalationAt = &policyID, level, next
+	return manager.db.Model(event).Updates(map[string]interface{}{
+		"escalation_policy_id": policyID, "escalation_level": level, "next_escalation_at": next,
+	}).Error
+}
+
+func stepDelay(step models.MonitorEscalationStep) time.Duration {
+	return time.Duration(step.DelayMinutes) * time.Minute
+}
+
+// Escalate advances every unacknowledged alert whose next escalation step is
+// due. Alerts of silenced rules wait until the silence ends.
+func (manager *Manager) Escalate(ctx context.Context) error {
+	now := manager.now().UTC()
+	var due []models.MonitorAlertEvent
+	if err := manager.db.Where("event_type = ? AND acknowledged_at IS NULL AND next_escalation_at <= ?",
+		models.AlertEventTriggered, now).Order("id ASC").Find(&due).Error; err != nil {
+		return err
+	}
+	for index := range due {
+		event := &due[index]
+		resolved, err := manager.incidentResolved(event)
+		if err != nil {
+			return err
+		}
+		policy, err := manager.escalationPolicy(event.EscalationPolicyID)
+		if err != nil {
+			return err
+		}
+		if resolved || policy == nil {
+			if err := manager.db.Model(event).Update("next_escalation_at", nil).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		var rule models.MonitorRule
+		if err := manager.db.Select("id", "silenced_until").First(&rule, event.RuleID).Error; err == nil &&
+			rule.SilencedUntil != nil && rule.SilencedUntil.After(now) {
+			continue
+		}
+		if err := manager.escalate(ctx, event, policy, now); err != nil {
+			log.Printf("escalate alert event %d: %v", event.ID, err)
+		}
+	}
+	return nil
+}
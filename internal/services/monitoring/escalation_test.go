@@ -0,0 +1,132 @@
+package monitoring
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+func TestEscalationPolicyNotifiesStepsUntilAcknowledged(t *testing.T) {
+	started := time.Date(2026, 8, 3, 10, 0, 0, 0, time.UTC)
+	now := started
+	samples := []*models.MetricSample{
+		{CapturedAt: started, CPUPercent: 95},
+		{CapturedAt: started.Add(20 * time.Minute), CPUPercent: 10},
+	}
+	sender := &recordingSender{}
+	manager := newTestManager(t, &sequenceCollector{samples: samples}, sender)
+	manager.now = func() time.Time { return now }
+	for index, id := range []string{"primary", "secondary", "unrelated"} {
+		if err := manager.db.Create(&models.NotificationChannel{
+			ID: id, Name: id, Type: "webhook", Enabled: true, ConfigEncrypted: "not-used-by-recording-sender",
+			CreatedAt: started.Add(time.Duration(index) * time.Second),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	steps := []models.MonitorEscalationStep{
+		{DelayMinutes: 0, ChannelIDs: []string{"primary"}},
+		{DelayMinutes: 10, ChannelIDs: []string{"secondary", " secondary "}},
+	}
+	if _, err := manager.CreateEscalationPolicy(EscalationPolicyInput{
+		Name: "broken", Steps: []models.MonitorEscalationStep{{ChannelIDs: []string{"missing"}}},
+	}); err == nil {
+		t.Fatal("policy accepted an unknown channel")
+	}
+	policy, err := manager.CreateEscalationPolicy(EscalationPolicyInput{Name: "on-call", Steps: steps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Steps[1].ChannelIDs) != 1 {
+		t.Fatalf("duplicate channels were not removed: %#v", policy.Steps[1])
+	}
+	if _, err := manager.CreateRule(RuleInput{
+		Name: "CPU high", Metric: MetricCPU, Operator: "gt", Threshold: 90, RecoveryThreshold: 80,
+		ConsecutiveSamples: 1, CooldownMinutes: 1440, Severity: "critical", Enabled: true,
+		EscalationPolicyID: &policy.ID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := func() string {
+		var rows []models.NotificationDelivery
+		if err := manager.db.Order("id ASC").Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(rows))
+		for _, row := range rows {
+			names = append(names, row.ChannelID)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if _, err := manager.CollectNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := deliveries(); got != "primary" {
+		t.Fatalf("first step deliveries = %s", got)
+	}
+	now = started.Add(5 * time.Minute)
+	if err := manager.Escalate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := deliveries(); got != "primary" {
+		t.Fatalf("escalated before the delay: %s", got)
+	}
+	now = started.Add(10 * time.Minute)
+	if err := manager.Escalate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := deliveries(); got != "primary,secondary" {
+		t.Fatalf("second step deliveries = %s", got)
+	}
+
+	var triggered models.MonitorAlertEvent
+	if err := manager.db.First(&triggered, "event_type = ?", models.AlertEventTriggered).Error; err != nil {
+		t.Fatal(err)
+	}
+	acknowledged, err := manager.AcknowledgeEvent(triggered.ID, "oncall-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acknowledged.AcknowledgedBy != "oncall-admin" || acknowledged.AcknowledgedAt == nil ||
+		acknowledged.NextEscalationAt != nil || acknowledged.EscalationLevel != 2 {
+		t.Fatalf("unexpected acknowledged event: %#v", acknowledged)
+	}
+	if _, err := manager.AcknowledgeEvent(triggered.ID, "someone-else"); err == nil {
+		t.Fatal("alert was acknowledged twice")
+	}
+	if _, err := manager.UnacknowledgeEvent(triggered.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	now = started.Add(20 * time.Minute)
+	if _, err := manager.CollectNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := deliveries(); got != "primary,secondary,primary,secondary" {
+		t.Fatalf("resolution deliveries = %s", got)
+	}
+	if _, err := manager.AcknowledgeEvent(triggered.ID, "oncall-admin"); err == nil {
+		t.Fatal("resolved alert was acknowledged")
+	}
+	if err := manager.Escalate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.db.First(&triggered, triggered.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if triggered.NextEscalationAt != nil {
+		t.Fatalf("resolved alert still escalates at %s", triggered.NextEscalationAt)
+	}
+	unacknowledged := false
+	page, err := manager.Events(EventFilter{Acknowledged: &unacknowledged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Data[0].ID != triggered.ID {
+		t.Fatalf("unexpected unacknowledged events: %#v", page)
+	}
+}
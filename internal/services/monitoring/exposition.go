@@ -0,0 +1,304 @@
+package monitoring
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ExpositionContentType is the Prometheus text format understood by
+// Prometheus, VictoriaMetrics and the OpenMetrics parsers.
+const ExpositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exposition renders metric families in the Prometheus text format. Samples
+// of one family must be written consecutively.
+type Exposition struct {
+	buffer   bytes.Buffer
+	declared map[string]bool
+}
+
+func NewExposition() *Exposition {
+	return &Exposition{declared: make(map[string]bool)}
+}
+
+func (exposition *Exposition) Bytes() []byte {
+	return exposition.buffer.Bytes()
+}
+
+// Gauge writes one gauge sample. Labels are given as name, value pairs.
+func (exposition *Exposition) Gauge(name, help string, value float64, labels ...string) {
+	exposition.declare(name, help, "gauge")
+	exposition.sample(name, value, labels...)
+}
+
+func (exposition *Exposition) Counter(name, help string, value float64, labels ...string) {
+	exposition.declare(name, help, "counter")
+	exposition.sample(name, value, labels...)
+}
+
+func (exposition *Exposition) declare(name, help, kind string) {
+	if exposition.declared[name] {
+		return
+	}
+	exposition.declared[name] = true
+	exposition.buffer.WriteString("# HELP " + name + " " + escapeExpositionHelp(help) + "\n")
+	exposition.buffer.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (exposition *Exposition) sample(name string, value float64, labels ...string) {
+	exposition.buffer.WriteString(name)
+	if len(labels) > 1 {
+		exposition.buffer.WriteByte('{')
+		for index := 0; index+1 < len(labels); index += 2 {
+			if index > 0 {
+				exposition.buffer.WriteByte(',')
+			}
+			exposition.buffer.WriteString(labels[index] + `="` + escapeExpositionLabel(labels[index+1]) + `"`)
+		}
+		exposition.buffer.WriteByte('}')
+	}
+	exposition.buffer.WriteByte(' ')
+	exposition.buffer.WriteString(formatExpositionValue(value))
+	exposition.buffer.WriteByte('\n')
+}
+
+func formatExpositionValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var expositionLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeExpositionLabel(value string) string {
+	return expositionLabelEscaper.Replace(value)
+}
+
+func escapeExpositionHelp(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
+
+// WriteExposition exports the latest host sample, the latest per-resource
+// series and the state of every alert rule.
+func (manager *Manager) WriteExposition(exposition *Exposition) error {
+	if manager == nil {
+		return errors.New("monitoring manager is not initialized")
+	}
+	var latest models.MetricSample
+	err := manager.db.Order("captured_at DESC").Order("id DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		exposition.Gauge("oneinstack_host_sample_timestamp_seconds",
+			"Unix time of the latest host metric sample.", float64(latest.CapturedAt.Unix()))
+		for _, definition := range metricHistorySeriesDefinitions {
+			name := "oneinstack_host_" + expositionName(definition.Key)
+			exposition.Gauge(name, definition.Key+" from the latest host metric sample.", definition.Value(&latest))
+		}
+	}
+
+	series, err := manager.ListSeries("")
+	if err != nil {
+		return err
+	}
+	for _, sample := range series {
+		definition := seriesMetricDefinitions[sample.Metric]
+		exposition.Gauge("oneinstack_"+sample.Metric, sample.Metric+" per "+definition.ResourceType+".",
+			sample.Value, definition.ResourceType, sample.ResourceID, "label", sample.Label)
+	}
+
+	rules, err := manager.ListRules()
+	if err != nil {
+		return err
+	}
+	sort.Slice(rules, func(left, right int) bool { return rules[left].ID < rules[right].ID })
+	for _, rule := range rules {
+		for _, state := range []string{models.MonitorStateNormal, models.MonitorStatePending, models.MonitorStateFiring} {
+			value := 0.0
+			if rule.CurrentState == state {
+				value = 1
+			}
+			exposition.Gauge("oneinstack_monitor_rule_state", "Current alert rule state, one series per state.", value,
+				"rule_id", strconv.FormatUint(uint64(rule.ID), 10), "rule", rule.Name,
+				"metric", rule.Metric, "severity", rule.Severity, "state", state)
+		}
+	}
+	for _, rule := range rules {
+		enabled := 0.0
+		if rule.Enabled {
+			enabled = 1
+		}
+		exposition.Gauge("oneinstack_monitor_rule_enabled", "Whether the alert rule is enabled.", enabled,
+			"rule_id", strconv.FormatUint(uint64(rule.ID), 10), "rule", rule.Name)
+	}
+	return nil
+}
+
+// expositionName converts a camelCase key such as networkReceiveBps into
+// network_receive_bps.
+func expositionName(key string) string {
+	var builder strings.Builder
+	for index, char := range key {
+		if char >= 'A' && char <= 'Z' {
+			if index > 0 {
+				builder.WriteByte('_')
+			}
+			char += 'a' - 'A'
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+var taskQueues struct {
+	sync.RWMutex
+	depths map[string]func() int
+}
+
+// RegisterTaskQueue exports the depth of a background task queue under the
+// given queue label.
+func RegisterTaskQueue(name string, depth func() int) {
+	taskQueues.Lock()
+	defer taskQueues.Unlock()
+	if taskQueues.depths == nil {
+		taskQueues.depths = make(map[string]func() int)
+	}
+	if depth == nil {
+		delete(taskQueues.depths, name)
+		return
+	}
+	taskQueues.depths[name] = depth
+}
+
+func WriteTaskQueueExposition(exposition *Exposition) {
+	taskQueues.RLock()
+	names := make([]string, 0, len(taskQueues.depths))
+	for name := range taskQueues.depths {
+		names = append(names, name)
+	}
+	depths := make(map[string]func() int, len(names))
+	for name, depth := range taskQueues.depths {
+		depths[name] = depth
+	}
+	taskQueues.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		exposition.Gauge("oneinstack_task_queue_depth", "Accepted tasks waiting for a worker.",
+			float64(depths[name]()), "queue", name)
+	}
+}
+
+var httpLatencyMethods = map[string]bool{
+	http.MethodGet: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodHead: true, http.MethodOptions: true,
+}
+
+// httpMethodLabel keeps clients from creating series with arbitrary method
+// tokens, including on routes that need no authentication.
+func httpMethodLabel(method string) string {
+	if httpLatencyMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+var httpLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type httpLatencyKey struct {
+	method, route, status string
+}
+
+type httpLatencyHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+var httpLatency struct {
+	sync.Mutex
+	series map[httpLatencyKey]*httpLatencyHistogram
+}
+
+// ObserveHTTPRequest records one request in the latency histogram. Routes
+// are the registered patterns, unknown methods are reported as OTHER and
+// statuses are grouped by class to keep the number of series bounded.
+func ObserveHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	key := httpLatencyKey{method: httpMethodLabel(method), route: route, status: strconv.Itoa(status/100) + "xx"}
+	seconds := elapsed.Seconds()
+	httpLatency.Lock()
+	defer httpLatency.Unlock()
+	if httpLatency.series == nil {
+		httpLatency.series = make(map[httpLatencyKey]*httpLatencyHistogram)
+	}
+	histogram := httpLatency.series[key]
+	if histogram == nil {
+		histogram = &httpLatencyHistogram{counts: make([]uint64, len(httpLatencyBuckets))}
+		httpLatency.series[key] = histogram
+	}
+	for index, bound := range httpLatencyBuckets {
+		if seconds <= bound {
+			histogram.counts[index]++
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+func WriteHTTPExposition(exposition *Exposition) {
+	const name = "oneinstack_http_request_duration_seconds"
+	httpLatency.Lock()
+	keys := make([]httpLatencyKey, 0, len(httpLatency.series))
+	snapshot := make(map[httpLatencyKey]httpLatencyHistogram, len(httpLatency.series))
+	for key, histogram := range httpLatency.series {
+		keys = append(keys, key)
+		snapshot[key] = httpLatencyHistogram{
+			counts: append([]uint64(nil), histogram.counts...), count: histogram.count, sum: histogram.sum,
+		}
+	}
+	httpLatency.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	sort.Slice(keys, func(left, right int) bool {
+		if keys[left].route != keys[right].route {
+			return keys[left].route < keys[right].route
+		}
+		if keys[left].method != keys[right].method {
+			return keys[left].method < keys[right].method
+		}
+		return keys[left].status < keys[right].status
+	})
+	exposition.declare(name, "HTTP request latency by route.", "histogram")
+	for _, key := range keys {
+		histogram := snapshot[key]
+		labels := []string{"method", key.method, "route", key.route, "status", key.status}
+		for index, bound := range httpLatencyBuckets {
+			exposition.sample(name+"_bucket", float64(histogram.counts[index]),
+				append(labels, "le", formatExpositionValue(bound))...)
+		}
+		exposition.sample(name+"_bucket", float64(histogram.count), append(labels, "le", "+Inf")...)
+		exposition.sample(name+"_sum", histogram.sum, labels...)
+		exposition.sample(name+"_count", float64(histogram.count), labels...)
+	}
+}
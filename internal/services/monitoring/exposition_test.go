@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+func TestWriteExpositionExportsSamplesSeriesAndRuleStates(t *testing.T) {
+	capturedAt := time.Date(2026, 8, 1, 6, 0, 0, 0, time.UTC)
+	manager := newTestManager(t, &sequenceCollector{samples: []*models.MetricSample{
+		{CapturedAt: capturedAt, CPUPercent: 93.5, NetworkReceiveBPS: 2048},
+	}}, &recordingSender{})
+	manager.AddSeriesCollector(SeriesCollectorFunc(func(context.Context) ([]SeriesPoint, error) {
+		return []SeriesPoint{{Metric: MetricServiceMemoryRSS, ResourceID: "mysql", Value: 1 << 30}}, nil
+	}))
+	if _, err := manager.CreateRule(RuleInput{
+		Name: `CPU "hot"`, Metric: MetricCPU, Operator: "gt", Threshold: 90, RecoveryThreshold: 80,
+		ConsecutiveSamples: 1, CooldownMinutes: 60, Severity: "warning", Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.CollectNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	RegisterTaskQueue("software", func() int { return 3 })
+	t.Cleanup(func() { RegisterTaskQueue("software", nil) })
+
+	exposition := NewExposition()
+	if err := manager.WriteExposition(exposition); err != nil {
+		t.Fatal(err)
+	}
+	WriteTaskQueueExposition(exposition)
+	body := string(exposition.Bytes())
+	for _, want := range []string{
+		"# TYPE oneinstack_host_cpu_percent gauge\noneinstack_host_cpu_percent 93.5\n",
+		"oneinstack_host_network_receive_bps 2048\n",
+		"oneinstack_host_sample_timestamp_seconds 1.785564e+09\n",
+		`oneinstack_service_memory_rss{service="mysql",label="mysql"} 1.073741824e+09`,
+		`oneinstack_monitor_rule_state{rule_id="1",rule="CPU \"hot\"",metric="cpu",severity="warning",state="firing"} 1`,
+		`oneinstack_monitor_rule_state{rule_id="1",rule="CPU \"hot\"",metric="cpu",severity="warning",state="normal"} 0`,
+		`oneinstack_task_queue_depth{queue="software"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("exposition is missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "# TYPE oneinstack_monitor_rule_state ") != 1 {
+		t.Fatalf("rule state family declared more than once:\n%s", body)
+	}
+}
+
+func TestObserveHTTPRequestBoundsMethodLabels(t *testing.T) {
+	ObserveHTTPRequest("BREW", "", 404, time.Millisecond)
+	ObserveHTTPRequest("X-RANDOM-1", "", 404, time.Millisecond)
+	ObserveHTTPRequest("PATCH", "/api/v1/websites/:id", 200, time.Millisecond)
+	exposition := NewExposition()
+	WriteHTTPExposition(exposition)
+	body := string(exposition.Bytes())
+	if strings.Contains(body, "BREW") || strings.Contains(body, "X-RANDOM-1") {
+		t.Fatalf("unknown methods were exported as labels:\n%s", body)
+	}
+	for _, want := range []string{
+		`oneinstack_http_request_duration_seconds_count{method="OTHER",route="unmatched",status="4xx"} 2`,
+		`method="PATCH",route="/api/v1/websites/:id",status="2xx"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("exposition is missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"oneinstack/internal/models"
+)
+
+// MetricExpression marks a rule whose condition is an expression over the
+// host sample instead of a single metric and threshold, for example
+//
+//	cpuPercent > 90 AND load5 > cores * 2
+//	delta(diskPercent, 1h) > 10 OR rate(networkSendBps, 5m) > 1e6
+//	avg(cpuPercent, 10m) > 85 AND NOT memoryPercent < 50
+//
+// Identifiers are the history keys of MetricSample plus cores. avg, delta and
+// rate look back over stored samples; rate is per second.
+const (
+	MetricExpression = "expression"
+
+	maxExpressionLength = 1000
+	maxExpressionWindow = 24 * time.Hour
+)
+
+var expressionVariables = func() map[string]func(*models.MetricSample) float64 {
+	variables := make(map[string]func(*models.MetricSample) float64, len(metricHistorySeriesDefinitions))
+	for _, definition := range metricHistorySeriesDefinitions {
+		variables[definition.Key] = definition.Value
+	}
+	return variables
+}()
+
+type expressionContext struct {
+	sample  *models.MetricSample
+	history []models.MetricSample
+	cores   float64
+}
+
+type expressionNode interface {
+	eval(*expressionContext) float64
+}
+
+type numberNode float64
+
+func (node numberNode) eval(*expressionContext) float64 { return float64(node) }
+
+type variableNode string
+
+func (node variableNode) eval(context *expressionContext) float64 {
+	if node == "cores" {
+		return context.cores
+	}
+	return expressionVariables[string(node)](context.sample)
+}
+
+type unaryNode struct {
+	operator string
+	operand  expressionNode
+}
+
+func (node *unaryNode) eval(context *expressionContext) float64 {
+	value := node.operand.eval(context)
+	if node.operator == "-" {
+		return -value
+	}
+	return boolValue(!truthy(value))
+}
+
+type binaryNode struct {
+	operator    string
+	left, right expressionNode
+}
+
+func (node *binaryNode) eval(context *expressionContext) float64 {
+	left := node.left.eval(context)
+	switch node.operator {
+	case "AND":
+		if !truthy(left) {
+			return 0
+		}
+		return boolValue(truthy(node.right.eval(context)))
+	case "OR":
+		if truthy(left) {
+			return 1
+		}
+		return boolValue(truthy(node.right.eval(context)))
+	}
+	right := node.right.eval(context)
+	switch node.operator {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		if right == 0 {
+			return math.NaN()
+		}
+		return left / right
+	case ">":
+		return boolValue(left > right)
+	case ">=":
+		return boolValue(left >= right)
+	case "<":
+		return boolValue(left < right)
+	case "<=":
+		return boolValue(left <= right)
+	case "==":
+		return boolValue(left == right)
+	case "!=":
+		return boolValue(left != right)
+	}
+	return math.NaN()
+}
+
+// windowNode implements avg, delta and rate. Without enough history the
+// result is NaN, which compares false, so a rule cannot fire on data it has
+// not seen yet.
+type windowNode struct {
+	function string
+	variable string
+	window   time.Duration
+}
+
+func (node *windowNode) eval(context *expressionContext) float64 {
+	value := expressionVariables[node.variable]
+	now := context.sample.CapturedAt
+	since := now.Add(-node.window)
+	switch node.function {
+	case "avg":
+		total, count := value(context.sample), 1
+		for index := range context.history {
+			sample := &context.history[index]
+			if sample.CapturedAt.After(since) && sample.CapturedAt.Before(now) {
+				total += value(sample)
+				count++
+			}
+		}
+		return total / float64(count)
+	default:
+		var baseline *models.MetricSample
+		for index := range context.history {
+			sample := &context.history[index]
+			if sample.CapturedAt.After(since) {
+				break
+			}
+			baseline = sample
+		}
+		if baseline == nil {
+			return math.NaN()
+		}
+		delta := value(context.sample) - value(baseline)
+		if node.function == "delta" {
+			return delta
+		}
+		elapsed := now.Sub(baseline.CapturedAt).Seconds()
+		if elapsed <= 0 {
+			return math.NaN()
+		}
+		return delta / elapsed
+	}
+}
+
+func truthy(value float64) bool {
+	return value != 0 && !math.IsNaN(value)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+type ruleExpression struct {
+	root   expressionNode
+	window time.Duration
+}
+
+// evaluate returns 1 when the condition holds and 0 otherwise.
+func (expression *ruleExpression) evaluate(context *expressionContext) float64 {
+	return boolValue(truthy(expression.root.eval(context)))
+}
+
+// expressionHistory loads the samples the expression rules look back over,
+// oldest first. delta and rate use the newest sample at or before the start
+// of their window, so twice the widest window is read to find a baseline.
+func (manager *Manager) expressionHistory(
+	rules []models.MonitorRule,
+	sample *models.MetricSample,
+) ([]models.MetricSample, error) {
+	var window time.Duration
+	for index := range rules {
+		if rules[index].Metric != MetricExpression {
+			continue
+		}
+		if expression, err := parseRuleExpression(rules[index].Expression); err == nil && expression.window > window {
+			window = expression.window
+		}
+	}
+	if window == 0 {
+		return nil, nil
+	}
+	var history []models.MetricSample
+	err := manager.db.Where("captured_at >= ? AND captured_at < ?", sample.CapturedAt.Add(-2*window), sample.CapturedAt).
+		Order("captured_at ASC").Order("id ASC").Find(&history).Error
+	return history, err
+}
+
+type expressionToken struct {
+	kind  string // number, duration, ident, op, end
+	text  string
+	value float64
+}
+
+func tokenizeExpression(source string) ([]expressionToken, error) {
+	tokens := make([]expressionToken, 0)
+	runes := []rune(source)
+	for index := 0; index < len(runes); {
+		char := runes[index]
+		switch {
+		case unicode.IsSpace(char):
+			index++
+		case unicode.IsDigit(char) || char == '.':
+			start := index
+			for index < len(runes) && (unicode.IsDigit(runes[index]) || runes[index] == '.' ||
+				((runes[index] == 'e' || runes[index] == 'E') && index+1 < len(runes) &&
+					(unicode.IsDigit(runes[index+1]) || runes[index+1] == '-' || runes[index+1] == '+')) ||
+				((runes[index] == '-' || runes[index] == '+') && (runes[index-1] == 'e' || runes[index-1] == 'E'))) {
+				index++
+			}
+			value, err := strconv.ParseFloat(string(runes[start:index]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", string(runes[start:index]))
+			}
+			if index < len(runes) && strings.ContainsRune("smh", runes[index]) &&
+				(index+1 == len(runes) || !isIdentifierRune(runes[index+1])) {
+				unit := map[rune]float64{'s': 1, 'm': 60, 'h': 3600}[runes[index]]
+				tokens = append(tokens, expressionToken{kind: "duration", text: string(runes[start : index+1]), value: value * unit})
+				index++
+				continue
+			}
+			tokens = append(tokens, expressionToken{kind: "number", text: string(runes[start:index]), value: value})
+		case isIdentifierRune(char):
+			start := index
+			for index < len(runes) && isIdentifierRune(runes[index]) {
+				index++
+			}
+			text := string(runes[start:index])
+			switch strings.ToUpper(text) {
+			case "AND", "OR", "NOT":
+				tokens = append(tokens, expressionToken{kind: "op", text: strings.ToUpper(text)})
+			default:
+				tokens = append(tokens, expressionToken{kind: "ident", text: text})
+			}
+		default:
+			two := ""
+			if index+1 < len(runes) {
+				two = string(runes[index : index+2])
+			}
+			switch two {
+			case ">=", "<=", "==", "!=":
+				tokens = append(tokens, expressionToken{kind: "op", text: two})
+				index += 2
+				continue
+			case "&&":
+				tokens = append(tokens, expressionToken{kind: "op", text: "AND"})
+				index += 2
+				continue
+			case "||":
+				tokens = append(tokens, expressionToken{kind: "op", text: "OR"})
+				index += 2
+				continue
+			}
+			switch char {
+			case '+', '-', '*', '/', '>', '<', '(', ')', ',':
+				tokens = append(tokens, expressionToken{kind: "op", text: string(char)})
+			case '!':
+				tokens = append(tokens, expressionToken{kind: "op", text: "NOT"})
+			default:
+				return nil, fmt.Errorf("unexpected character %q", char)
+			}
+			index++
+		}
+	}
+	return append(tokens, expressionToken{kind: "end"}), nil
+}
+
+func isIdentifierRune(char rune) bool {
+	return char == '_' || (char < unicode.MaxASCII && (unicode.IsLetter(char) || unicode.IsDigit(char)))
+}
+
+type expressionParser struct {
+	tokens   []expressionToken
+	position int
+	window   time.Duration
+}
+
+func parseRuleExpression(source string) (*ruleExpression, error) {
+	source = strings.TrimSpace(source)
+	if source == "" || len(source) > maxExpressionLength {
+		return nil, fmt.Errorf("expression must contain 1 to %d characters", maxExpressionLength)
+	}
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &expressionParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != "end" {
+		return nil, fmt.Errorf("unexpected %q", token.text)
+	}
+	return &ruleExpression{root: root, window: parser.window}, nil
+}
+
+func (parser *expressionParser) peek() expressionToken {
+	return parser.tokens[parser.position]
+}
+
+func (parser *expressionParser) next() expressionToken {
+	token := parser.tokens[parser.position]
+	if token.kind != "end" {
+		parser.position++
+	}
+	return token
+}
+
+func (parser *expressionParser) accept(operators ...string) (string, bool) {
+	token := parser.peek()
+	if token.kind != "op" {
+		return "", false
+	}
+	for _, operator := range operators {
+		if token.text == operator {
+			parser.position++
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+func (parser *expressionParser) expect(operator string) error {
+	if _, ok := parser.accept(operator); !ok {
+		return fmt.Errorf("expected %q near %q", operator, parser.peek().text)
+	}
+	return nil
+}
+
+func (parser *expressionParser) parseBinary(
+	operand func() (expressionNode, error),
+	operators ...string,
+) (expressionNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator, ok := parser.accept(operators...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: operator, left: left, right: right}
+	}
+}
+
+func (parser *expressionParser) parseOr() (expressionNode, error) {
+	return parser.parseBinary(parser.parseAnd, "OR")
+}
+
+func (parser *expressionParser) parseAnd() (expressionNode, error) {
+	return parser.parseBinary(parser.parseNot, "AND")
+}
+
+func (parser *expressionParser) parseNot() (expressionNode, error) {
+	if _, ok := parser.accept("NOT"); ok {
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: "NOT", operand: operand}, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *expressionParser) parseComparison() (expressionNode, error) {
+	left, err := parser.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if operator, ok := parser.accept(">", ">=", "<", "<=", "==", "!="); ok {
+		right, err := parser.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{operator: operator, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (parser *expressionParser) parseAdditive() (expressionNode, error) {
+	return parser.parseBinary(parser.parseMultiplicative, "+", "-")
+}
+
+func (parser *expressionParser) parseMultiplicative() (expressionNode, error) {
+	return parser.parseBinary(parser.parseUnary, "*", "/")
+}
+
+func (parser *expressionParser) parseUnary() (expressionNode, error) {
+	if _, ok := parser.accept("-"); ok {
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: "-", operand: operand}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *expressionParser) parsePrimary() (expressionNode, error) {
+	token := parser.next()
+	switch token.kind {
+	case "number":
+		return numberNode(token.value), nil
+	case "ident":
+		if _, ok := parser.accept("("); ok {
+			return parser.parseWindow(token.text)
+		}
+		if _, known := expressionVariables[token.text]; !known && token.text != "cores" {
+			return nil, fmt.Errorf("unknown variable %q", token.text)
+		}
+		return variableNode(token.text), nil
+	case "op":
+		if token.text == "(" {
+			inner, err := parser.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, parser.expect(")")
+		}
+	case "duration":
+		return nil, fmt.Errorf("duration %q is only valid as a function argument", token.text)
+	}
+	if token.kind == "end" {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+func (parser *expressionParser) parseWindow(function string) (expressionNode, error) {
+	if function != "avg" && function != "delta" && function != "rate" {
+		return nil, fmt.Errorf("unknown function %q", function)
+	}
+	variable := parser.next()
+	if variable.kind != "ident" {
+		return nil, fmt.Errorf("%s expects a metric name", function)
+	}
+	if _, known := expressionVariables[variable.text]; !known {
+		return nil, fmt.Errorf("unknown variable %q", variable.text)
+	}
+	if err := parser.expect(","); err != nil {
+		return nil, err
+	}
+	duration := parser.next()
+	if duration.kind != "duration" {
+		return nil, fmt.Errorf("%s expects a duration such as 5m or 1h", function)
+	}
+	window := time.Duration(duration.value * float64(time.Second))
+	if window < time.Minute || window > maxExpressionWindow {
+		return nil, errors.New("function windows must be between 1m and 24h")
+	}
+	if err := parser.expect(")"); err != nil {
+		return nil, err
+	}
+	if window > parser.window {
+		parser.window = window
+	}
+	return &windowNode{function: function, variable: variable.text, window: window}, nil
+}
@@ -0,0 +1,127 @@
+package monitoring
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+func TestExpressionRulesCombineConditionsAndLookBack(t *testing.T) {
+	started := time.Date(2026, 8, 3, 10, 0, 0, 0, time.Local) // a Monday
+	values := []struct{ cpu, load5, disk float64 }{
+		{95, 3, 40}, // load below cores*2
+		{95, 9, 41},
+		{95, 9, 55}, // disk grew 15 points within 2 minutes
+		{50, 9, 56},
+	}
+	samples := make([]*models.MetricSample, 0, len(values))
+	for index, value := range values {
+		samples = append(samples, &models.MetricSample{
+			CapturedAt: started.Add(time.Duration(index) * time.Minute),
+			CPUPercent: value.cpu, Load5: value.load5, DiskPercent: value.disk,
+		})
+	}
+	sender := &recordingSender{}
+	manager := newTestManager(t, &sequenceCollector{samples: samples}, sender)
+	manager.cores = 4
+	if err := manager.db.Create(&models.NotificationChannel{
+		ID: "expression-channel", Name: "operations", Type: "webhook", Enabled: true,
+		ConfigEncrypted: "not-used-by-recording-sender",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	base := RuleInput{
+		Metric: MetricExpression, ConsecutiveSamples: 1, CooldownMinutes: 1440,
+		Severity: "critical", Enabled: true,
+	}
+	composite := base
+	composite.Name, composite.Expression = "CPU and load", "cpuPercent > 90 AND load5 > cores*2"
+	rule, err := manager.CreateRule(composite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Operator != "gte" || rule.Threshold != 1 || rule.RecoveryThreshold != 0 {
+		t.Fatalf("expression rule was not normalized: %#v", rule)
+	}
+	growth := base
+	growth.Name, growth.Expression = "Disk growth", "delta(diskPercent, 2m) >= 10"
+	if _, err := manager.CreateRule(growth); err != nil {
+		t.Fatal(err)
+	}
+	offHours := base
+	offHours.Name, offHours.Expression, offHours.Schedule = "Nights only", "cpuPercent > 0", "mon-fri 22:00-06:00"
+	if _, err := manager.CreateRule(offHours); err != nil {
+		t.Fatal(err)
+	}
+
+	for range samples {
+		if _, err := manager.CollectNow(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make([]string, 0, len(sender.events))
+	for _, event := range sender.events {
+		got = append(got, event.RuleName+"/"+event.EventType+"@"+event.OccurredAt.Sub(started).String())
+	}
+	want := []string{
+		"CPU and load/" + models.AlertEventTriggered + "@1m0s",
+		"Disk growth/" + models.AlertEventTriggered + "@2m0s",
+		"CPU and load/" + models.AlertEventResolved + "@3m0s",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expression events = %v, want %v", got, want)
+	}
+	if !strings.Contains(sender.events[0].Message, "load5 > cores*2") {
+		t.Fatalf("message does not describe the expression: %s", sender.events[0].Message)
+	}
+}
+
+func TestExpressionAndScheduleValidation(t *testing.T) {
+	for _, expression := range []string{
+		"", "cpuPercent >", "unknown > 1", "avg(cpuPercent) > 1", "delta(cpuPercent, 2d) > 1",
+		"rate(cpuPercent, 48h) > 1", "cpuPercent > 90 AND", "(cpuPercent > 1", "5m > 1", "cpuPercent # 1",
+	} {
+		if _, err := parseRuleExpression(expression); err == nil {
+			t.Errorf("expression %q was accepted", expression)
+		}
+	}
+	for _, expression := range []string{
+		"cpuPercent > 90 && !(memoryPercent < 50)", "rate(networkSendBps, 5m) > 1e6 or load1 >= -1",
+		"avg(load5, 1h) / cores > 1.5",
+	} {
+		if _, err := parseRuleExpression(expression); err != nil {
+			t.Errorf("expression %q was rejected: %v", expression, err)
+		}
+	}
+	for _, schedule := range []string{"mon-xyz", "09:00", "09:00-09:00", "25:00-26:00", "mon tue", "08:00-09:00 10:00-11:00"} {
+		if _, err := parseRuleSchedule(schedule); err == nil {
+			t.Errorf("schedule %q was accepted", schedule)
+		}
+	}
+	schedule, err := parseRuleSchedule("fri-sun 22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for at, want := range map[time.Time]bool{
+		time.Date(2026, 8, 7, 23, 0, 0, 0, time.Local): true,  // Friday night
+		time.Date(2026, 8, 8, 5, 59, 0, 0, time.Local): true,  // Saturday morning, Friday's window
+		time.Date(2026, 8, 10, 5, 0, 0, 0, time.Local): true,  // Monday morning, Sunday's window
+		time.Date(2026, 8, 11, 5, 0, 0, 0, time.Local): false, // Tuesday morning, Monday's window
+		time.Date(2026, 8, 8, 12, 0, 0, 0, time.Local): false,
+	} {
+		if schedule.active(at) != want {
+			t.Errorf("active(%s) = %v, want %v", at, !want, want)
+		}
+	}
+	manager := newTestManager(t, &sequenceCollector{}, &recordingSender{})
+	input := RuleInput{
+		Name: "CPU", Metric: MetricCPU, Expression: "cpuPercent > 1", Operator: "gt", Threshold: 90,
+		RecoveryThreshold: 80, ConsecutiveSamples: 1, CooldownMinutes: 5, Severity: "warning",
+	}
+	if _, err := manager.CreateRule(input); err == nil {
+		t.Fatal("threshold rule accepted an expression")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +26,13 @@ const (
 	MetricNetSend    = "network_send"
 	MetricDiskRead   = "disk_read"
 	MetricDiskWrite  = "disk_write"
+
+	// Backend health events are raised by the website upstream checker.
+	MetricUpstreamBackend = "upstream_backend"
+	ResourceTypeBackend   = "backend"
+
+	MetricDatabaseBackup = "database_backup"
+	ResourceTypeDatabase = "database"
 )
 
 const monitorHistoryTargetPoints = 1440
@@ -32,6 +40,8 @@ const monitorHistoryTargetPoints = 1440
 type HistoryPoint struct {
 	CapturedAt time.Time `json:"capturedAt"`
 	Value      float64   `json:"value"`
+	Min        *float64  `json:"min,omitempty"`
+	Max        *float64  `json:"max,omitempty"`
 }
 
 type HistorySeries struct {
@@ -46,6 +56,7 @@ type HistoryRange struct {
 	From          time.Time `json:"from"`
 	To            time.Time `json:"to"`
 	BucketSeconds int64     `json:"bucketSeconds"`
+	Resolution    string    `json:"resolution"`
 	SampleCount   int       `json:"sampleCount"`
 	BucketCount   int       `json:"bucketCount"`
 }
@@ -99,6 +110,10 @@ var metricHistorySeriesDefinitions = []historySeriesDefinition{
 type RuleInput struct {
 	Name               string  `json:"name"`
 	Metric             string  `json:"metric"`
+	ResourceID         string  `json:"resourceId"`
+	Expression         string  `json:"expression"`
+	Schedule           string  `json:"schedule"`
+	EscalationPolicyID *uint   `json:"escalationPolicyId"`
 	Operator           string  `json:"operator"`
 	Threshold          float64 `json:"threshold"`
 	RecoveryThreshold  float64 `json:"recoveryThreshold"`
@@ -115,6 +130,7 @@ type EventFilter struct {
 	Severity       string
 	ResourceType   string
 	ResourceID     string
+	Acknowledged   *bool
 }
 
 type EventPage struct {
@@ -150,14 +166,23 @@ type Manager struct {
 	sender         Sender
 	retentionDays  int
 	alertRetention int
-	scheduler      *cron.Cron
-	now            func() time.Time
-	mu             sync.Mutex
-	healthMu       sync.Mutex
-	serviceHealth  ServiceHealthCollector
-	background     sync.WaitGroup
-	startOnce      sync.Once
-	stopOnce       sync.Once
+	// Aggregates outlive raw samples; see SetRollupRetention.
+	fiveMinuteRetention int
+	hourlyRetention     int
+	rollupMu            sync.Mutex
+	scheduler           *cron.Cron
+	now                 func() time.Time
+	cores               float64
+	mu                  sync.Mutex
+	healthMu            sync.Mutex
+	serviceHealth       ServiceHealthCollector
+	certificateMu       sync.Mutex
+	certificates        CertificateCollector
+	seriesMu            sync.Mutex
+	series              []SeriesCollector
+	background          sync.WaitGroup
+	startOnce           sync.Once
+	stopOnce            sync.Once
 }
 
 var defaultManager struct {
@@ -188,7 +213,9 @@ func NewManager(
 	manager := &Manager{
 		db: db, collector: collector, sender: sender,
 		retentionDays: retentionDays, alertRetention: alertRetentionDays,
-		scheduler: scheduler, now: time.Now,
+		fiveMinuteRetention: max(defaultFiveMinuteRetentionDays, retentionDays),
+		hourlyRetention:     max(defaultHourlyRetentionDays, retentionDays),
+		scheduler:           scheduler, now: time.Now, cores: float64(runtime.NumCPU()),
 	}
 	if _, err := scheduler.AddFunc(sampleSchedule, func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
@@ -196,9 +223,18 @@ func NewManager(
 		if _, collectErr := manager.CollectNow(ctx); collectErr != nil {
 			log.Printf("monitor metric collection failed: %v", collectErr)
 		}
+		if rollupErr := manager.Rollup(); rollupErr != nil {
+			log.Printf("monitor metric rollup failed: %v", rollupErr)
+		}
 		if healthErr := manager.CheckServiceHealth(ctx); healthErr != nil {
 			log.Printf("component service health collection failed: %v", healthErr)
 		}
+		if certificateErr := manager.CheckCertificates(ctx); certificateErr != nil {
+			log.Printf("certificate alert evaluation failed: %v", certificateErr)
+		}
+		if escalationErr := manager.Escalate(ctx); escalationErr != nil {
+			log.Printf("alert escalation failed: %v", escalationErr)
+		}
 	}); err != nil {
 		return nil, fmt.Errorf("invalid monitor sample schedule: %w", err)
 	}
@@ -249,6 +285,9 @@ func (manager *Manager) Start() {
 			if err := manager.CheckServiceHealth(ctx); err != nil {
 				log.Printf("initial component service health collection failed: %v", err)
 			}
+			if err := manager.CheckCertificates(ctx); err != nil {
+				log.Printf("initial certificate alert evaluation failed: %v", err)
+			}
 		}()
 	})
 }
@@ -293,16 +332,34 @@ func (manager *Manager) CollectNow(ctx context.Context) (*models.MetricSample, e
 	if err := manager.evaluate(ctx, sample); err != nil {
 		return nil, err
 	}
+	if err := manager.collectSeries(ctx, sample.CapturedAt); err != nil {
+		return nil, err
+	}
 	return sample, nil
 }
 
 func (manager *Manager) evaluate(ctx context.Context, sample *models.MetricSample) error {
 	var rules []models.MonitorRule
-	if err := manager.db.Where("enabled = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+	if err := manager.db.Where("enabled = ? AND metric NOT IN ?", true, resourceMetrics()).
+		Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+	history, err := manager.expressionHistory(rules, sample)
+	if err != nil {
 		return err
 	}
 	for index := range rules {
-		event, notify, err := manager.evaluateRule(&rules[index], sample)
+		rule := &rules[index]
+		value := metricValue(sample, rule.Metric)
+		if rule.Metric == MetricExpression {
+			expression, parseErr := parseRuleExpression(rule.Expression)
+			if parseErr != nil {
+				log.Printf("monitor rule %d has an invalid expression: %v", rule.ID, parseErr)
+				continue
+			}
+			value = expression.evaluate(&expressionContext{sample: sample, history: history, cores: manager.cores})
+		}
+		event, notify, err := manager.evaluateRule(rule, value, sample.CapturedAt)
 		if err != nil {
 			return err
 		}
@@ -315,10 +372,13 @@ func (manager *Manager) evaluate(ctx context.Context, sample *models.MetricSampl
 
 func (manager *Manager) evaluateRule(
 	rule *models.MonitorRule,
-	sample *models.MetricSample,
+	value float64,
+	now time.Time,
 ) (*models.MonitorAlertEvent, bool, error) {
-	value := metricValue(sample, rule.Metric)
-	now := sample.CapturedAt
+	if !ruleScheduleActive(rule.Schedule, now) {
+		// Outside its schedule a rule keeps its state and stays quiet.
+		return nil, false, nil
+	}
 	var event *models.MonitorAlertEvent
 	notify := false
 	err := manager.db.Transaction(func(tx *gorm.DB) error {
@@ -397,8 +457,28 @@ func (manager *Manager) evaluateRule(
 }
 
 func (manager *Manager) deliver(ctx context.Context, event *models.MonitorAlertEvent) {
+	routed, channelIDs, err := manager.routeEvent(ctx, event)
+	if err != nil {
+		log.Printf("route alert event %d: %v", event.ID, err)
+	}
+	if routed {
+		if len(channelIDs) > 0 {
+			manager.deliverToChannels(ctx, event, channelIDs)
+		}
+		return
+	}
+	manager.deliverToChannels(ctx, event, nil)
+}
+
+// deliverToChannels sends an event to the given enabled channels, or to every
+// enabled channel when ids is nil.
+func (manager *Manager) deliverToChannels(ctx context.Context, event *models.MonitorAlertEvent, ids []string) {
+	query := manager.db.Where("enabled = ?", true)
+	if ids != nil {
+		query = query.Where("id IN ?", ids)
+	}
 	var channels []models.NotificationChannel
-	if err := manager.db.Where("enabled = ?", true).Order("created_at ASC").Find(&channels).Error; err != nil {
+	if err := query.Order("created_at ASC").Find(&channels).Error; err != nil {
 		log.Printf("list alert notification channels: %v", err)
 		return
 	}
@@ -459,6 +539,114 @@ func (manager *Manager) NotifyTaskFailure(
 	return nil
 }
 
+// BackendHealthChange describes a proxy backend whose active health check
+// changed state. Ejected reports whether the backend is (or was) rendered as
+// down; the last primary backend of a pool is never ejected. Direct marks a
+// proxy target outside any pool, which can only alert.
+type BackendHealthChange struct {
+	WebsiteID   int64
+	WebsiteName string
+	Pool        string
+	Address     string
+	Direct      bool
+	Healthy     bool
+	Ejected     bool
+	Detail      string
+	DownSince   time.Time
+	OccurredAt  time.Time
+}
+
+// NotifyBackendHealth records an ejection as a triggered alert and the
+// recovery as its resolution, delivered like threshold alerts.
+func (manager *Manager) NotifyBackendHealth(ctx context.Context, change BackendHealthChange) error {
+	if manager == nil {
+		return errors.New("monitoring manager is not initialized")
+	}
+	occurredAt := change.OccurredAt.UTC()
+	if occurredAt.IsZero() {
+		occurredAt = manager.now().UTC()
+	}
+	started := change.DownSince.UTC()
+	if started.IsZero() {
+		started = occurredAt
+	}
+	event := &models.MonitorAlertEvent{
+		RuleName: "上游后端：" + truncateText(change.WebsiteName, 108), Metric: MetricUpstreamBackend,
+		ResourceType: ResourceTypeBackend,
+		ResourceID:   truncateText(fmt.Sprintf("%d/%s/%s", change.WebsiteID, change.Pool, change.Address), 64),
+		Severity:     "critical", EventType: models.AlertEventTriggered, Value: 0, Threshold: 1,
+		StartedAt: started, OccurredAt: occurredAt,
+	}
+	backend := fmt.Sprintf("网站 %s 上游池 %s 的后端 %s", change.WebsiteName, change.Pool, change.Address)
+	if change.Direct {
+		backend = fmt.Sprintf("网站 %s 的反向代理目标 %s", change.WebsiteName, change.Address)
+	}
+	switch {
+	case change.Direct && !change.Healthy:
+		event.Message = backend + " 健康检查失败：" + change.Detail
+	case change.Healthy && change.Ejected:
+		event.Message = backend + " 已恢复，重新加入负载均衡"
+	case change.Healthy:
+		event.Message = backend + " 已恢复"
+	case change.Ejected:
+		event.Message = backend + " 健康检查失败，已移出负载均衡：" + change.Detail
+	default:
+		event.Message = backend + " 健康检查失败，池内没有其他可用后端，未移出负载均衡：" + change.Detail
+	}
+	event.Message = truncateText(event.Message, 255)
+	if change.Healthy {
+		event.EventType = models.AlertEventResolved
+		event.Value = 1
+		event.ResolvedAt = &occurredAt
+	}
+	if err := manager.db.Create(event).Error; err != nil {
+		return fmt.Errorf("persist backend health alert: %w", err)
+	}
+	manager.deliver(ctx, event)
+	return nil
+}
+
+// DatabaseBackupFailure describes a scheduled database backup that did not
+// produce a verified backup.
+type DatabaseBackupFailure struct {
+	LibraryID    int64
+	DatabaseName string
+	TaskID       string
+	Status       string
+	Detail       string
+	OccurredAt   time.Time
+}
+
+// NotifyDatabaseBackupFailure records a one-shot alert for a failed scheduled
+// backup, delivered like threshold alerts.
+func (manager *Manager) NotifyDatabaseBackupFailure(ctx context.Context, failure DatabaseBackupFailure) error {
+	if manager == nil {
+		return errors.New("monitoring manager is not initialized")
+	}
+	occurredAt := failure.OccurredAt.UTC()
+	if occurredAt.IsZero() {
+		occurredAt = manager.now().UTC()
+	}
+	message := fmt.Sprintf("数据库 %s 的计划备份未完成（%s）", failure.DatabaseName, failure.Status)
+	if failure.TaskID != "" {
+		message += "，任务 " + failure.TaskID
+	}
+	if detail := strings.TrimSpace(failure.Detail); detail != "" {
+		message += "：" + detail
+	}
+	event := &models.MonitorAlertEvent{
+		RuleName: "数据库备份：" + truncateText(failure.DatabaseName, 108), Metric: MetricDatabaseBackup,
+		ResourceType: ResourceTypeDatabase, ResourceID: fmt.Sprintf("%d", failure.LibraryID),
+		Severity: "critical", EventType: models.AlertEventTriggered, Value: 0, Threshold: 1,
+		StartedAt: occurredAt, OccurredAt: occurredAt, Message: truncateText(message, 255),
+	}
+	if err := manager.db.Create(event).Error; err != nil {
+		return fmt.Errorf("persist database backup alert: %w", err)
+	}
+	manager.deliver(ctx, event)
+	return nil
+}
+
 func truncateText(value string, limit int) string {
 	runes := []rune(strings.TrimSpace(value))
 	if len(runes) > limit {
@@ -468,11 +656,17 @@ func truncateText(value string, limit int) string {
 }
 
 func (manager *Manager) CreateRule(input RuleInput) (*models.MonitorRule, error) {
+	input = normalizeRuleInput(input)
 	if err := validateRule(input); err != nil {
 		return nil, err
 	}
+	if err := manager.escalationPolicyExists(input.EscalationPolicyID); err != nil {
+		return nil, err
+	}
 	rule := &models.MonitorRule{
-		Name: strings.TrimSpace(input.Name), Metric: input.Metric, Operator: input.Operator,
+		Name: strings.TrimSpace(input.Name), Metric: input.Metric,
+		ResourceID: strings.TrimSpace(input.ResourceID), Expression: input.Expression,
+		Schedule: input.Schedule, EscalationPolicyID: input.EscalationPolicyID, Operator: input.Operator,
 		Threshold: input.Threshold, RecoveryThreshold: input.RecoveryThreshold,
 		ConsecutiveSamples: input.ConsecutiveSamples, CooldownMinutes: input.CooldownMinutes,
 		Severity: input.Severity, Enabled: input.Enabled,
@@ -487,9 +681,13 @@ func (manager *Manager) UpdateRule(id uint, input RuleInput) (*models.MonitorRul
 	if id == 0 {
 		return nil, errors.New("rule id is required")
 	}
+	input = normalizeRuleInput(input)
 	if err := validateRule(input); err != nil {
 		return nil, err
 	}
+	if err := manager.escalationPolicyExists(input.EscalationPolicyID); err != nil {
+		return nil, err
+	}
 	var rule models.MonitorRule
 	if err := manager.db.First(&rule, id).Error; err != nil {
 		return nil, err
@@ -497,7 +695,10 @@ func (manager *Manager) UpdateRule(id uint, input RuleInput) (*models.MonitorRul
 	err := manager.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&rule).Updates(map[string]interface{}{
 			"name": strings.TrimSpace(input.Name), "metric": input.Metric,
-			"operator": input.Operator, "threshold": input.Threshold,
+			"resource_id": strings.TrimSpace(input.ResourceID),
+			"expression":  input.Expression, "schedule": input.Schedule,
+			"escalation_policy_id": input.EscalationPolicyID,
+			"operator":             input.Operator, "threshold": input.Threshold,
 			"recovery_threshold":  input.RecoveryThreshold,
 			"consecutive_samples": input.ConsecutiveSamples,
 			"cooldown_minutes":    input.CooldownMinutes,
@@ -505,6 +706,9 @@ func (manager *Manager) UpdateRule(id uint, input RuleInput) (*models.MonitorRul
 		}).Error; err != nil {
 			return err
 		}
+		if err := tx.Delete(&models.MonitorResourceAlertState{}, "rule_id = ?", id).Error; err != nil {
+			return err
+		}
 		return tx.Delete(&models.MonitorAlertState{}, "rule_id = ?", id).Error
 	})
 	if err != nil {
@@ -520,6 +724,9 @@ func (manager *Manager) DeleteRule(id uint) error {
 		} else if result.RowsAffected == 0 {
 			return gorm.ErrRecordNotFound
 		}
+		if err := tx.Delete(&models.MonitorResourceAlertState{}, "rule_id = ?", id).Error; err != nil {
+			return err
+		}
 		return tx.Delete(&models.MonitorAlertState{}, "rule_id = ?", id).Error
 	})
 }
@@ -592,6 +799,29 @@ func (manager *Manager) attachRuleStates(rules []*models.MonitorRule) error {
 		rule.LastEvaluatedAt = &evaluated
 		rule.FiringSince = state.FiringSince
 	}
+	// Per-resource rules report their most severe resource: firing before
+	// pending, then the earliest firing resource.
+	var resourceStates []models.MonitorResourceAlertState
+	if err := manager.db.Where("rule_id IN ? AND state <> ?", ids, models.MonitorStateNormal).
+		Order("firing_since ASC").Find(&resourceStates).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.MonitorRule, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+	for _, state := range resourceStates {
+		rule := byID[state.RuleID]
+		if rule == nil || rule.CurrentState == models.MonitorStateFiring ||
+			(rule.CurrentState == models.MonitorStatePending && state.State != models.MonitorStateFiring) {
+			continue
+		}
+		rule.CurrentState = state.State
+		rule.LastValue = state.LastValue
+		evaluated := state.LastEvaluatedAt
+		rule.LastEvaluatedAt = &evaluated
+		rule.FiringSince = state.FiringSince
+	}
 	return nil
 }
 
@@ -617,97 +847,6 @@ func (manager *Manager) Metrics(from, to time.Time, limit int) ([]models.MetricS
 	return samples, err
 }
 
-func (manager *Manager) History(from, to time.Time) (*HistoryResponse, error) {
-	from = from.UTC().Truncate(time.Second)
-	to = to.UTC().Truncate(time.Second)
-	if from.IsZero() || to.IsZero() {
-		return nil, errors.New("history range is required")
-	}
-	if to.Before(from) {
-		return nil, errors.New("history range end must not be before start")
-	}
-	if to.Sub(from) > 31*24*time.Hour {
-		return nil, errors.New("history range must not exceed 31 days")
-	}
-
-	query := manager.db.Order("captured_at ASC").Order("id ASC")
-	query = query.Where("captured_at >= ?", from)
-	query = query.Where("captured_at <= ?", to)
-
-	var samples []models.MetricSample
-	if err := query.Find(&samples).Error; err != nil {
-		return nil, err
-	}
-
-	bucketSeconds := int64(math.Ceil(to.Sub(from).Seconds() / monitorHistoryTargetPoints))
-	if bucketSeconds < int64(time.Minute/time.Second) {
-		bucketSeconds = int64(time.Minute / time.Second)
-	}
-	bucketDuration := time.Duration(bucketSeconds) * time.Second
-	series := make([]HistorySeries, len(metricHistorySeriesDefinitions))
-	seriesByKey := make(map[string]*HistorySeries, len(metricHistorySeriesDefinitions))
-	for index, definition := range metricHistorySeriesDefinitions {
-		series[index] = HistorySeries{
-			Group: definition.Group,
-			Key:   definition.Key,
-			Label: definition.Label,
-			Unit:  definition.Unit,
-		}
-		seriesByKey[definition.Key] = &series[index]
-	}
-
-	type historyBucket struct {
-		start  time.Time
-		count  int
-		totals map[string]float64
-	}
-
-	buckets := make([]historyBucket, 0)
-	var current *historyBucket
-	var currentStart time.Time
-	for index := range samples {
-		sample := &samples[index]
-		bucketOffset := int64(sample.CapturedAt.Sub(from) / bucketDuration)
-		if bucketOffset < 0 {
-			bucketOffset = 0
-		}
-		startAt := from.Add(time.Duration(bucketOffset) * bucketDuration)
-		if current == nil || !startAt.Equal(currentStart) {
-			buckets = append(buckets, historyBucket{
-				start:  startAt,
-				totals: make(map[string]float64, len(metricHistorySeriesDefinitions)),
-			})
-			current = &buckets[len(buckets)-1]
-			currentStart = startAt
-		}
-		current.count++
-		for _, definition := range metricHistorySeriesDefinitions {
-			current.totals[definition.Key] += definition.Value(sample)
-		}
-	}
-
-	for _, bucket := range buckets {
-		for _, definition := range metricHistorySeriesDefinitions {
-			item := seriesByKey[definition.Key]
-			item.Points = append(item.Points, HistoryPoint{
-				CapturedAt: bucket.start,
-				Value:      bucket.totals[definition.Key] / float64(bucket.count),
-			})
-		}
-	}
-
-	return &HistoryResponse{
-		Range: HistoryRange{
-			From:          from,
-			To:            to,
-			BucketSeconds: bucketSeconds,
-			SampleCount:   len(samples),
-			BucketCount:   len(buckets),
-		},
-		Series: series,
-	}, nil
-}
-
 func (manager *Manager) Events(filter EventFilter) (*EventPage, error) {
 	if filter.Page < 1 {
 		filter.Page = 1
@@ -734,6 +873,13 @@ func (manager *Manager) Events(filter EventFilter) (*EventPage, error) {
 	if filter.ResourceID != "" {
 		query = query.Where("resource_id = ?", filter.ResourceID)
 	}
+	if filter.Acknowledged != nil {
+		if *filter.Acknowledged {
+			query = query.Where("acknowledged_at IS NOT NULL")
+		} else {
+			query = query.Where("event_type = ? AND acknowledged_at IS NULL", models.AlertEventTriggered)
+		}
+	}
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
 		return nil, err
@@ -799,6 +945,17 @@ func (manager *Manager) Summary() (*Summary, error) {
 		Where("state = ?", models.MonitorStatePending).Count(&summary.PendingCount).Error; err != nil {
 		return nil, err
 	}
+	var resourceFiring, resourcePending int64
+	if err := manager.db.Model(&models.MonitorResourceAlertState{}).
+		Where("state = ?", models.MonitorStateFiring).Count(&resourceFiring).Error; err != nil {
+		return nil, err
+	}
+	if err := manager.db.Model(&models.MonitorResourceAlertState{}).
+		Where("state = ?", models.MonitorStatePending).Count(&resourcePending).Error; err != nil {
+		return nil, err
+	}
+	summary.FiringCount += resourceFiring
+	summary.PendingCount += resourcePending
 	if err := manager.db.Model(&models.ComponentHealthState{}).
 		Where("installed = ? AND health_state = ?", true, models.MonitorStateFiring).
 		Count(&summary.ServiceFiringCount).Error; err != nil {
@@ -824,6 +981,22 @@ func (manager *Manager) Cleanup() error {
 		if err := tx.Where("captured_at < ?", metricCutoff).Delete(&models.MetricSample{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("captured_at < ?", metricCutoff).Delete(&models.MetricSeriesSample{}).Error; err != nil {
+			return err
+		}
+		for _, tier := range []struct {
+			step time.Duration
+			days int
+		}{
+			{step: rollupTiers[0].step, days: manager.fiveMinuteRetention},
+			{step: rollupTiers[1].step, days: manager.hourlyRetention},
+		} {
+			cutoff := manager.now().UTC().AddDate(0, 0, -tier.days)
+			if err := tx.Where("resolution = ? AND bucket_start < ?", int64(tier.step/time.Second), cutoff).
+				Delete(&models.MetricRollup{}).Error; err != nil {
+				return err
+			}
+		}
 		var eventIDs []uint64
 		if err := tx.Model(&models.MonitorAlertEvent{}).Where("occurred_at < ?", alertCutoff).
 			Pluck("id", &eventIDs).Error; err != nil {
@@ -848,10 +1021,30 @@ func validateRule(input RuleInput) error {
 	}
 	switch input.Metric {
 	case MetricCPU, MetricMemory, MetricDisk, MetricLoad1,
-		MetricNetReceive, MetricNetSend, MetricDiskRead, MetricDiskWrite:
+		MetricNetReceive, MetricNetSend, MetricDiskRead, MetricDiskWrite,
+		MetricCertificateExpiryDays, MetricCertificateRenewalFailures, MetricCertificateRevoked,
+		MetricWebsiteRequestRate, MetricWebsiteBytesRate, MetricServiceCPU, MetricServiceMemoryRSS, MetricMountDisk,
+		MetricExpression:
 	default:
 		return errors.New("unsupported monitor metric")
 	}
+	if input.Metric == MetricExpression {
+		if _, err := parseRuleExpression(input.Expression); err != nil {
+			return fmt.Errorf("invalid rule expression: %w", err)
+		}
+	} else if input.Expression != "" {
+		return errors.New("expression is only supported for expression rules")
+	}
+	if _, err := parseRuleSchedule(input.Schedule); err != nil {
+		return fmt.Errorf("invalid rule schedule: %w", err)
+	}
+	input.ResourceID = strings.TrimSpace(input.ResourceID)
+	if input.ResourceID != "" && !isSeriesMetric(input.Metric) && !isCertificateMetric(input.Metric) {
+		return errors.New("resource id is only supported for per-resource metrics")
+	}
+	if len(input.ResourceID) > 64 {
+		return errors.New("resource id must not exceed 64 characters")
+	}
 	switch input.Operator {
 	case "gt", "gte", "lt", "lte":
 	default:
@@ -861,7 +1054,8 @@ func validateRule(input RuleInput) error {
 		math.IsNaN(input.RecoveryThreshold) || math.IsInf(input.RecoveryThreshold, 0) {
 		return errors.New("thresholds must be finite")
 	}
-	if input.Metric == MetricCPU || input.Metric == MetricMemory || input.Metric == MetricDisk {
+	if input.Metric == MetricCPU || input.Metric == MetricMemory || input.Metric == MetricDisk ||
+		input.Metric == MetricMountDisk {
 		if input.Threshold < 0 || input.Threshold > 100 ||
 			input.RecoveryThreshold < 0 || input.RecoveryThreshold > 100 {
 			return errors.New("percentage thresholds must be between 0 and 100")
@@ -889,6 +1083,20 @@ func validateRule(input RuleInput) error {
 	return nil
 }
 
+// normalizeRuleInput trims free-form fields. Expression rules evaluate to 1
+// while their condition holds and 0 otherwise, so the generic state machine
+// runs with a fixed threshold of 1 and recovery at 0.
+func normalizeRuleInput(input RuleInput) RuleInput {
+	input.Expression = strings.TrimSpace(input.Expression)
+	input.Schedule = strings.Join(strings.Fields(strings.ToLower(input.Schedule)), " ")
+	if input.Metric == MetricExpression {
+		input.Operator = "gte"
+		input.Threshold = 1
+		input.RecoveryThreshold = 0
+	}
+	return input
+}
+
 func metricValue(sample *models.MetricSample, metric string) float64 {
 	switch metric {
 	case MetricCPU:
@@ -945,13 +1153,16 @@ func newAlertEvent(
 	started, occurred time.Time,
 	resolved *time.Time,
 ) *models.MonitorAlertEvent {
+	message := fmt.Sprintf("%s: %s value %.2f (threshold %.2f)",
+		rule.Name, eventType, value, rule.Threshold)
+	if rule.Metric == MetricExpression {
+		message = fmt.Sprintf("%s: %s (%s)", rule.Name, eventType, truncateText(rule.Expression, 200))
+	}
 	return &models.MonitorAlertEvent{
 		RuleID: rule.ID, RuleName: rule.Name, Metric: rule.Metric,
 		Severity: rule.Severity, EventType: eventType, Value: value,
 		Threshold: rule.Threshold, StartedAt: started, OccurredAt: occurred,
-		ResolvedAt: resolved,
-		Message: fmt.Sprintf("%s: %s value %.2f (threshold %.2f)",
-			rule.Name, eventType, value, rule.Threshold),
+		ResolvedAt: resolved, Message: message,
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,9 +49,9 @@ func monitorTestDB(t *testing.T) *gorm.DB {
 		t.Fatal(err)
 	}
 	if err := database.AutoMigrate(
-		&models.MetricSample{}, &models.MonitorRule{}, &models.MonitorAlertState{},
-		&models.MonitorAlertEvent{}, &models.ComponentHealthState{}, &models.NotificationChannel{},
-		&models.NotificationDelivery{},
+		&models.MetricSample{}, &models.MetricSeriesSample{}, &models.MetricRollup{}, &models.MonitorRule{}, &models.MonitorAlertState{},
+		&models.MonitorResourceAlertState{}, &models.MonitorAlertEvent{}, &models.ComponentHealthState{}, &models.NotificationChannel{},
+		&models.NotificationDelivery{}, &models.MonitorEscalationPolicy{},
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -288,6 +289,94 @@ func TestAlertStateTriggersAfterConsecutiveSamplesAndRecovers(t *testing.T) {
 	}
 }
 
+func TestCertificateRulesAlertPerCertificateAndSkipSystemSamples(t *testing.T) {
+	started := time.Date(2026, 8, 1, 6, 0, 0, 0, time.UTC)
+	rounds := [][]CertificateObservation{
+		{
+			{ID: "cert-a", Name: "a.example.com", NotAfter: started.Add(5 * 24 * time.Hour), RenewalFailures: 2, LastError: "DNS propagation timeout", CheckedAt: started},
+			{ID: "cert-b", Name: "b.example.com", NotAfter: started.Add(60 * 24 * time.Hour), CheckedAt: started},
+		},
+		{
+			{ID: "cert-a", Name: "a.example.com", NotAfter: started.Add(95 * 24 * time.Hour), CheckedAt: started.Add(time.Hour)},
+			{ID: "cert-b", Name: "b.example.com", NotAfter: started.Add(60 * 24 * time.Hour), Revoked: true, CheckedAt: started.Add(time.Hour)},
+		},
+	}
+	round := 0
+	sender := &recordingSender{}
+	manager := newTestManager(t, &sequenceCollector{samples: []*models.MetricSample{{CapturedAt: started, CPUPercent: 1}}}, sender)
+	manager.SetCertificateCollector(CertificateCollectorFunc(func(context.Context) ([]CertificateObservation, error) {
+		result := rounds[round]
+		round++
+		return result, nil
+	}))
+	if err := manager.db.Create(&models.NotificationChannel{
+		ID: "certificate-channel", Name: "operations", Type: "webhook", Enabled: true,
+		ConfigEncrypted: "not-used-by-recording-sender",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	expiry, err := manager.CreateRule(RuleInput{
+		Name: "Certificate expiring", Metric: MetricCertificateExpiryDays, Operator: "lt",
+		Threshold: 14, RecoveryThreshold: 30, ConsecutiveSamples: 1,
+		CooldownMinutes: 1440, Severity: "critical", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []RuleInput{
+		{Name: "Renewal failing", Metric: MetricCertificateRenewalFailures, Operator: "gte", Threshold: 2},
+		{Name: "Certificate revoked", Metric: MetricCertificateRevoked, Operator: "gte", Threshold: 1},
+	} {
+		input.ConsecutiveSamples, input.CooldownMinutes, input.Severity, input.Enabled = 1, 1440, "critical", true
+		if _, err := manager.CreateRule(input); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := manager.CollectNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var systemEvents int64
+	_ = manager.db.Model(&models.MonitorAlertEvent{}).Count(&systemEvents).Error
+	if systemEvents != 0 {
+		t.Fatalf("system sample evaluated certificate rules: %d events", systemEvents)
+	}
+	if err := manager.CheckCertificates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := manager.GetRule(expiry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.CurrentState != models.MonitorStateFiring {
+		t.Fatalf("expiry rule state = %s", rule.CurrentState)
+	}
+	if err := manager.CheckCertificates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var events []models.MonitorAlertEvent
+	if err := manager.db.Order("id ASC").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(events))
+	for _, event := range events {
+		got = append(got, event.Metric+"/"+event.ResourceID+"/"+event.EventType)
+	}
+	want := []string{
+		MetricCertificateExpiryDays + "/cert-a/" + models.AlertEventTriggered,
+		MetricCertificateRenewalFailures + "/cert-a/" + models.AlertEventTriggered,
+		MetricCertificateExpiryDays + "/cert-a/" + models.AlertEventResolved,
+		MetricCertificateRenewalFailures + "/cert-a/" + models.AlertEventResolved,
+		MetricCertificateRevoked + "/cert-b/" + models.AlertEventTriggered,
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("certificate events = %v, want %v", got, want)
+	}
+	if len(sender.events) != len(want) || !strings.Contains(sender.events[1].Message, "DNS propagation timeout") {
+		t.Fatalf("unexpected certificate notifications: %#v", sender.events)
+	}
+}
+
 func TestTaskFailureUsesConfiguredNotificationChannels(t *testing.T) {
 	sender := &recordingSender{}
 	manager := newTestManager(t, &sequenceCollector{}, sender)
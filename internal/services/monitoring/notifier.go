@@ -1,20 +1,18 @@
 package monitoring
 
 import (
-	"bytes"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
+	"net/mail"
 	"net/netip"
 	"net/url"
-	"strconv"
+	"regexp"
 	"strings"
 	"time"
 
@@ -25,26 +23,77 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	ChannelTypeWebhook  = "webhook"
+	ChannelTypeEmail    = "email"
+	ChannelTypeTelegram = "telegram"
+	ChannelTypeSlack    = "slack"
+	ChannelTypeDiscord  = "discord"
+	ChannelTypeDingTalk = "dingtalk"
+	ChannelTypeWeCom    = "wecom"
+	ChannelTypeFeishu   = "feishu"
+
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+
+	maxTemplateLength = 4096
+	maxSMTPRecipients = 20
+)
+
 type Sender interface {
 	Send(context.Context, *models.NotificationChannel, *models.MonitorAlertEvent) error
 }
 
+// ChannelInput carries every channel type's settings. Secrets left empty on
+// update keep the stored value; ClearSecret only removes the signing secret
+// and ClearSMTPAuth removes the SMTP user name and password, e.g. when
+// switching to a relay without authentication.
 type ChannelInput struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Enabled     bool   `json:"enabled"`
-	WebhookURL  string `json:"webhookUrl"`
-	Secret      string `json:"secret"`
-	ClearSecret bool   `json:"clearSecret"`
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Enabled       bool     `json:"enabled"`
+	WebhookURL    string   `json:"webhookUrl"`
+	Secret        string   `json:"secret"`
+	ClearSecret   bool     `json:"clearSecret"`
+	BotToken      string   `json:"botToken"`
+	ChatID        string   `json:"chatId"`
+	SMTPHost      string   `json:"smtpHost"`
+	SMTPPort      int      `json:"smtpPort"`
+	SMTPSecurity  string   `json:"smtpSecurity"`
+	SMTPUsername  string   `json:"smtpUsername"`
+	SMTPPassword  string   `json:"smtpPassword"`
+	ClearSMTPAuth bool     `json:"clearSmtpAuth"`
+	SMTPFrom      string   `json:"smtpFrom"`
+	SMTPTo        []string `json:"smtpTo"`
+	Template      string   `json:"template"`
 }
 
-type webhookConfig struct {
-	URL    string `json:"url"`
-	Secret string `json:"secret,omitempty"`
+// channelConfig is stored encrypted because webhook URLs, bot tokens and SMTP
+// passwords are all bearer credentials. The url and secret keys predate the
+// other channel types and keep their original names.
+type channelConfig struct {
+	URL          string   `json:"url,omitempty"`
+	Secret       string   `json:"secret,omitempty"`
+	BotToken     string   `json:"botToken,omitempty"`
+	ChatID       string   `json:"chatId,omitempty"`
+	SMTPHost     string   `json:"smtpHost,omitempty"`
+	SMTPPort     int      `json:"smtpPort,omitempty"`
+	SMTPSecurity string   `json:"smtpSecurity,omitempty"`
+	SMTPUsername string   `json:"smtpUsername,omitempty"`
+	SMTPPassword string   `json:"smtpPassword,omitempty"`
+	SMTPFrom     string   `json:"smtpFrom,omitempty"`
+	SMTPTo       []string `json:"smtpTo,omitempty"`
 }
 
-type WebhookSender struct {
-	client *http.Client
+// ChannelSender delivers alerts to every supported channel type. All outbound
+// connections, HTTP and SMTP alike, go through a dialer that refuses
+// non-public addresses.
+type ChannelSender struct {
+	client      *http.Client
+	dial        func(ctx context.Context, network, address string) (net.Conn, error)
+	rootCAs     *x509.CertPool
+	telegramAPI string
+	now         func() time.Time
 }
 
 var blockedWebhookPrefixes = []netip.Prefix{
@@ -58,97 +107,94 @@ var blockedWebhookPrefixes = []netip.Prefix{
 	netip.MustParsePrefix("2001:db8::/32"),
 }
 
-func NewWebhookSender() *WebhookSender {
+var (
+	telegramTokenPattern  = regexp.MustCompile(`^[0-9]{5,16}:[A-Za-z0-9_-]{30,64}$`)
+	telegramChatIDPattern = regexp.MustCompile(`^(-?[0-9]{1,20}|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+)
+
+func NewChannelSender() *ChannelSender {
 	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
 	resolver := net.DefaultResolver
-	transport := &http.Transport{
-		Proxy: nil,
-		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
-			host, port, err := net.SplitHostPort(address)
-			if err != nil {
-				return nil, err
-			}
-			addresses, err := resolver.LookupNetIP(ctx, "ip", host)
-			if err != nil {
-				return nil, err
-			}
-			if len(addresses) == 0 {
-				return nil, errors.New("webhook host has no address")
-			}
-			for _, candidate := range addresses {
-				if !publicWebhookAddress(candidate) {
-					return nil, errors.New("webhook resolved to a non-public address")
-				}
+	return newChannelSender(func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addresses, err := resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addresses) == 0 {
+			return nil, errors.New("notification host has no address")
+		}
+		for _, candidate := range addresses {
+			if !publicWebhookAddress(candidate) {
+				return nil, errors.New("notification host resolved to a non-public address")
 			}
-			return dialer.DialContext(ctx, network, net.JoinHostPort(addresses[0].String(), port))
-		},
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(addresses[0].String(), port))
+	}, nil)
+}
+
+func newChannelSender(
+	dial func(ctx context.Context, network, address string) (net.Conn, error),
+	rootCAs *x509.CertPool,
+) *ChannelSender {
+	transport := &http.Transport{
+		Proxy: nil, DialContext: dial,
+		TLSClientConfig:   &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12},
 		ForceAttemptHTTP2: true, MaxIdleConns: 10,
 		IdleConnTimeout: 30 * time.Second, TLSHandshakeTimeout: 5 * time.Second,
 		ResponseHeaderTimeout: 8 * time.Second,
 	}
-	return &WebhookSender{client: &http.Client{
-		Transport: transport, Timeout: 10 * time.Second,
-		CheckRedirect: func(*http.Request, []*http.Request) error {
-			return errors.New("webhook redirects are not allowed")
+	return &ChannelSender{
+		client: &http.Client{
+			Transport: transport, Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return errors.New("webhook redirects are not allowed")
+			},
 		},
-	}}
+		dial: dial, rootCAs: rootCAs,
+		telegramAPI: "https://api.telegram.org", now: time.Now,
+	}
 }
 
-func (sender *WebhookSender) Send(
+func (sender *ChannelSender) Send(
 	ctx context.Context,
 	channel *models.NotificationChannel,
 	event *models.MonitorAlertEvent,
 ) error {
-	if channel == nil || event == nil || channel.Type != "webhook" {
+	if channel == nil || event == nil || !supportedChannelType(channel.Type) {
 		return errors.New("unsupported notification channel")
 	}
-	config, err := decryptWebhookConfig(channel)
-	if err != nil {
-		return err
-	}
-	payload, err := json.Marshal(map[string]interface{}{
-		"source": "oneinstack-panel", "event": event.EventType,
-		"severity": event.Severity, "rule": event.RuleName, "metric": event.Metric,
-		"resourceType": event.ResourceType, "resourceId": event.ResourceID,
-		"value": event.Value, "threshold": event.Threshold,
-		"startedAt": event.StartedAt, "occurredAt": event.OccurredAt,
-		"message": event.Message,
-	})
+	config, err := decryptChannelConfig(channel)
 	if err != nil {
 		return err
 	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(payload))
+	body, err := renderNotification(channel.Template, event)
 	if err != nil {
 		return err
 	}
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("User-Agent", "Oneinstack-Panel/monitor")
-	request.Header.Set("X-Oneinstack-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
-	if config.Secret != "" {
-		mac := hmac.New(sha256.New, []byte(config.Secret))
-		_, _ = mac.Write(payload)
-		request.Header.Set("X-Oneinstack-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	switch channel.Type {
+	case ChannelTypeWebhook:
+		return sender.sendWebhook(ctx, config, event, body)
+	case ChannelTypeEmail:
+		return sender.sendEmail(ctx, config, event, body)
+	case ChannelTypeTelegram:
+		return sender.sendTelegram(ctx, config, body)
+	default:
+		return sender.sendRobot(ctx, channel.Type, config, body)
 	}
-	response, err := sender.client.Do(request)
-	if err != nil {
-		// net/http errors can contain the full URL, including query-string tokens.
-		return errors.New("webhook request failed")
-	}
-	defer response.Body.Close()
-	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned HTTP %d", response.StatusCode)
-	}
-	return nil
 }
 
 func (manager *Manager) CreateChannel(input ChannelInput) (*models.NotificationChannel, error) {
-	if err := validateChannelInput(input, false); err != nil {
+	if err := validateChannelInput(input); err != nil {
 		return nil, err
 	}
 	channel := &models.NotificationChannel{
 		ID: uuid.NewString(), Name: strings.TrimSpace(input.Name),
 		Type: input.Type, Enabled: input.Enabled,
+		Template: strings.TrimSpace(input.Template),
 	}
 	if err := setChannelConfig(channel, input, nil); err != nil {
 		return nil, err
@@ -167,16 +213,21 @@ func (manager *Manager) UpdateChannel(id string, input ChannelInput) (*models.No
 	if input.Type == "" {
 		input.Type = channel.Type
 	}
-	if err := validateChannelInput(input, input.WebhookURL == ""); err != nil {
+	if err := validateChannelInput(input); err != nil {
 		return nil, err
 	}
-	existing, err := decryptWebhookConfig(&channel)
-	if err != nil {
-		return nil, err
+	var existing *channelConfig
+	if input.Type == channel.Type {
+		stored, err := decryptChannelConfig(&channel)
+		if err != nil {
+			return nil, err
+		}
+		existing = stored
 	}
 	channel.Name = strings.TrimSpace(input.Name)
 	channel.Type = input.Type
 	channel.Enabled = input.Enabled
+	channel.Template = strings.TrimSpace(input.Template)
 	if err := setChannelConfig(&channel, input, existing); err != nil {
 		return nil, err
 	}
@@ -208,36 +259,79 @@ func (manager *Manager) TestChannel(ctx context.Context, id string) error {
 	if err := manager.db.First(&channel, "id = ?", id).Error; err != nil {
 		return err
 	}
-	now := manager.now().UTC()
-	return manager.sender.Send(ctx, &channel, &models.MonitorAlertEvent{
+	return manager.sender.Send(ctx, &channel, testNotificationEvent(manager.now().UTC()))
+}
+
+func testNotificationEvent(now time.Time) *models.MonitorAlertEvent {
+	return &models.MonitorAlertEvent{
 		RuleName: "通知通道测试", Metric: MetricCPU, Severity: "info",
 		EventType: "test", Value: 42, Threshold: 90,
 		StartedAt: now, OccurredAt: now,
 		Message: "Oneinstack Panel 通知通道测试成功",
-	})
+	}
 }
 
 func setChannelConfig(
 	channel *models.NotificationChannel,
 	input ChannelInput,
-	existing *webhookConfig,
+	existing *channelConfig,
 ) error {
-	config := webhookConfig{}
+	config := channelConfig{}
 	if existing != nil {
 		config = *existing
 	}
-	if strings.TrimSpace(input.WebhookURL) != "" {
-		config.URL = strings.TrimSpace(input.WebhookURL)
+	keep := func(target *string, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			*target = value
+		}
+	}
+	keep(&config.URL, input.WebhookURL)
+	keep(&config.BotToken, input.BotToken)
+	keep(&config.ChatID, input.ChatID)
+	keep(&config.SMTPHost, input.SMTPHost)
+	keep(&config.SMTPSecurity, strings.ToLower(input.SMTPSecurity))
+	keep(&config.SMTPUsername, input.SMTPUsername)
+	keep(&config.SMTPFrom, input.SMTPFrom)
+	if input.SMTPPort != 0 {
+		config.SMTPPort = input.SMTPPort
+	}
+	if input.SMTPPassword != "" {
+		config.SMTPPassword = input.SMTPPassword
+	}
+	if input.ClearSMTPAuth {
+		config.SMTPUsername, config.SMTPPassword = "", ""
+	}
+	if len(input.SMTPTo) > 0 {
+		config.SMTPTo = nil
+		for _, recipient := range input.SMTPTo {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				config.SMTPTo = append(config.SMTPTo, recipient)
+			}
+		}
 	}
 	if input.Secret != "" {
 		config.Secret = input.Secret
 	} else if input.ClearSecret {
 		config.Secret = ""
 	}
-	parsed, err := validateWebhookURL(config.URL)
+	if channel.Type == ChannelTypeEmail {
+		if config.SMTPSecurity == "" {
+			config.SMTPSecurity = SMTPSecurityStartTLS
+		}
+		if config.SMTPPort == 0 {
+			config.SMTPPort = 587
+			if config.SMTPSecurity == SMTPSecurityTLS {
+				config.SMTPPort = 465
+			}
+		}
+	}
+	hint, err := validateChannelConfig(channel.Type, &config)
 	if err != nil {
 		return err
 	}
+	if _, err := renderNotification(channel.Template, testNotificationEvent(time.Now().UTC())); err != nil {
+		return err
+	}
 	encoded, err := json.Marshal(config)
 	if err != nil {
 		return err
@@ -249,12 +343,12 @@ func setChannelConfig(
 		return err
 	}
 	channel.ConfigEncrypted = encrypted
-	channel.TargetHint = parsed.Hostname()
+	channel.TargetHint = truncateText(hint, 160)
 	channel.HasSecret = config.Secret != ""
 	return nil
 }
 
-func decryptWebhookConfig(channel *models.NotificationChannel) (*webhookConfig, error) {
+func decryptChannelConfig(channel *models.NotificationChannel) (*channelConfig, error) {
 	if channel == nil || channel.ConfigEncrypted == "" {
 		return nil, errors.New("notification channel configuration is missing")
 	}
@@ -264,11 +358,11 @@ func decryptWebhookConfig(channel *models.NotificationChannel) (*webhookConfig,
 	if err != nil {
 		return nil, err
 	}
-	var config webhookConfig
+	var config channelConfig
 	if err := json.Unmarshal([]byte(plaintext), &config); err != nil {
 		return nil, errors.New("notification channel configuration is invalid")
 	}
-	if _, err := validateWebhookURL(config.URL); err != nil {
+	if _, err := validateChannelConfig(channel.Type, &config); err != nil {
 		return nil, err
 	}
 	return &config, nil
@@ -278,21 +372,78 @@ func notificationPurpose(id string) string {
 	return utils.CredentialPurposeNotification + ":" + id
 }
 
-func validateChannelInput(input ChannelInput, allowEmptyURL bool) error {
+func supportedChannelType(value string) bool {
+	switch value {
+	case ChannelTypeWebhook, ChannelTypeEmail, ChannelTypeTelegram, ChannelTypeSlack,
+		ChannelTypeDiscord, ChannelTypeDingTalk, ChannelTypeWeCom, ChannelTypeFeishu:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateChannelInput(input ChannelInput) error {
 	name := strings.TrimSpace(input.Name)
 	if name == "" || len(name) > 120 {
 		return errors.New("channel name must contain 1 to 120 characters")
 	}
-	if input.Type != "webhook" {
-		return errors.New("only webhook notification channels are supported")
+	if !supportedChannelType(input.Type) {
+		return errors.New("unsupported notification channel type")
 	}
-	if !allowEmptyURL || strings.TrimSpace(input.WebhookURL) != "" {
-		_, err := validateWebhookURL(input.WebhookURL)
-		return err
+	if len(input.Template) > maxTemplateLength {
+		return errors.New("notification template is too long")
 	}
 	return nil
 }
 
+// validateChannelConfig checks the merged configuration for a channel type
+// and returns the non-secret target hint shown in the channel list.
+func validateChannelConfig(channelType string, config *channelConfig) (string, error) {
+	switch channelType {
+	case ChannelTypeEmail:
+		host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(config.SMTPHost)), ".")
+		if err := validatePublicHost(host); err != nil {
+			return "", fmt.Errorf("SMTP %w", err)
+		}
+		config.SMTPHost = host
+		if config.SMTPPort < 1 || config.SMTPPort > 65535 {
+			return "", errors.New("SMTP port must be between 1 and 65535")
+		}
+		if config.SMTPSecurity != SMTPSecurityStartTLS && config.SMTPSecurity != SMTPSecurityTLS {
+			return "", errors.New("SMTP security must be starttls or tls")
+		}
+		if config.SMTPUsername != "" && config.SMTPPassword == "" {
+			return "", errors.New("SMTP password is required with a username")
+		}
+		if _, err := mail.ParseAddress(config.SMTPFrom); err != nil {
+			return "", errors.New("SMTP sender address is invalid")
+		}
+		if len(config.SMTPTo) == 0 || len(config.SMTPTo) > maxSMTPRecipients {
+			return "", fmt.Errorf("SMTP channels need 1 to %d recipients", maxSMTPRecipients)
+		}
+		for _, recipient := range config.SMTPTo {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return "", fmt.Errorf("SMTP recipient %q is invalid", recipient)
+			}
+		}
+		return host, nil
+	case ChannelTypeTelegram:
+		if !telegramTokenPattern.MatchString(config.BotToken) {
+			return "", errors.New("telegram bot token is invalid")
+		}
+		if !telegramChatIDPattern.MatchString(config.ChatID) {
+			return "", errors.New("telegram chat ID is invalid")
+		}
+		return "telegram:" + config.ChatID, nil
+	default:
+		parsed, err := validateWebhookURL(config.URL)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Hostname(), nil
+	}
+}
+
 func validateWebhookURL(value string) (*url.URL, error) {
 	parsed, err := url.Parse(strings.TrimSpace(value))
 	if err != nil || parsed.Host == "" {
@@ -304,14 +455,20 @@ func validateWebhookURL(value string) (*url.URL, error) {
 	if parsed.User != nil || parsed.Fragment != "" {
 		return nil, errors.New("webhook URL cannot contain credentials or a fragment")
 	}
-	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if err := validatePublicHost(strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")); err != nil {
+		return nil, fmt.Errorf("webhook %w", err)
+	}
+	return parsed, nil
+}
+
+func validatePublicHost(host string) error {
 	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
-		return nil, errors.New("webhook host is not allowed")
+		return errors.New("host is not allowed")
 	}
 	if address, parseErr := netip.ParseAddr(host); parseErr == nil && !publicWebhookAddress(address) {
-		return nil, errors.New("webhook address must be public")
+		return errors.New("address must be public")
 	}
-	return parsed, nil
+	return nil
 }
 
 func publicWebhookAddress(address netip.Addr) bool {
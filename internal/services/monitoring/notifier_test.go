@@ -0,0 +1,330 @@
+package monitoring
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+type recordedRequest struct {
+	path  string
+	query string
+	body  map[string]interface{}
+}
+
+type notificationStandIn struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+	reply    map[string]string
+}
+
+func newNotificationStandIn(t *testing.T) *notificationStandIn {
+	t.Helper()
+	standIn := &notificationStandIn{reply: map[string]string{}}
+	standIn.server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		content, _ := io.ReadAll(request.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(content, &body)
+		standIn.mu.Lock()
+		standIn.requests = append(standIn.requests, recordedRequest{
+			path: request.URL.Path, query: request.URL.RawQuery, body: body,
+		})
+		reply := standIn.reply[request.URL.Path]
+		standIn.mu.Unlock()
+		if reply == "" {
+			reply = `{"ok":true,"errcode":0,"code":0}`
+		}
+		_, _ = writer.Write([]byte(reply))
+	}))
+	t.Cleanup(standIn.server.Close)
+	return standIn
+}
+
+func (standIn *notificationStandIn) last() recordedRequest {
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	return standIn.requests[len(standIn.requests)-1]
+}
+
+// sender routes every connection to address while keeping the public host
+// names used by channel validation; the stand-in certificate covers
+// example.com.
+func (standIn *notificationStandIn) sender(address string) *ChannelSender {
+	pool := x509.NewCertPool()
+	pool.AddCert(standIn.server.Certificate())
+	sender := newChannelSender(func(ctx context.Context, network, target string) (net.Conn, error) {
+		destination := standIn.server.Listener.Addr().String()
+		if strings.HasSuffix(target, ":587") {
+			destination = address
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, destination)
+	}, pool)
+	sender.telegramAPI = "https://example.com/telegram"
+	sender.now = func() time.Time { return time.Unix(1785000000, 0) }
+	return sender
+}
+
+func notificationChannel(t *testing.T, manager *Manager, input ChannelInput) *models.NotificationChannel {
+	t.Helper()
+	input.Name, input.Enabled = input.Type+" channel", true
+	channel, err := manager.CreateChannel(input)
+	if err != nil {
+		t.Fatalf("create %s channel: %v", input.Type, err)
+	}
+	return channel
+}
+
+func TestChannelSenderFormatsChatRobotPayloads(t *testing.T) {
+	standIn := newNotificationStandIn(t)
+	sender := standIn.sender("")
+	manager := newTestManager(t, &sequenceCollector{}, sender)
+	event := &models.MonitorAlertEvent{
+		RuleName: "CPU high", Metric: MetricCPU, Severity: "critical",
+		EventType: models.AlertEventTriggered, Value: 97, Threshold: 90,
+		OccurredAt: time.Date(2026, 8, 2, 3, 4, 5, 0, time.UTC), Message: "CPU 97%",
+	}
+	cases := []struct {
+		input  ChannelInput
+		path   string
+		verify func(recordedRequest) bool
+	}{
+		{ChannelInput{Type: ChannelTypeSlack, WebhookURL: "https://example.com/slack"}, "/slack", func(request recordedRequest) bool {
+			return strings.HasPrefix(request.body["text"].(string), "[CRITICAL] CPU high\nCPU 97%")
+		}},
+		{ChannelInput{Type: ChannelTypeDiscord, WebhookURL: "https://example.com/discord", Template: "{{.Rule}} {{.Value}}"}, "/discord", func(request recordedRequest) bool {
+			return request.body["content"] == "CPU high 97"
+		}},
+		{ChannelInput{Type: ChannelTypeWeCom, WebhookURL: "https://example.com/wecom?key=robot"}, "/wecom", func(request recordedRequest) bool {
+			return request.body["msgtype"] == "text" && request.query == "key=robot"
+		}},
+		{ChannelInput{Type: ChannelTypeDingTalk, WebhookURL: "https://example.com/dingtalk?access_token=robot", Secret: "SECdingtalk"}, "/dingtalk", func(request recordedRequest) bool {
+			mac := hmac.New(sha256.New, []byte("SECdingtalk"))
+			_, _ = mac.Write([]byte("1785000000000\nSECdingtalk"))
+			want := "sign=" + strings.NewReplacer("+", "%2B", "/", "%2F", "=", "%3D").
+				Replace(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			return request.body["msgtype"] == "text" && strings.Contains(request.query, want) &&
+				strings.Contains(request.query, "timestamp=1785000000000")
+		}},
+		{ChannelInput{Type: ChannelTypeFeishu, WebhookURL: "https://example.com/feishu", Secret: "feishu-secret"}, "/feishu", func(request recordedRequest) bool {
+			mac := hmac.New(sha256.New, []byte("1785000000\nfeishu-secret"))
+			return request.body["msg_type"] == "text" && request.body["timestamp"] == "1785000000" &&
+				request.body["sign"] == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}},
+		{ChannelInput{Type: ChannelTypeTelegram, BotToken: "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdef", ChatID: "-1001234567"}, "/telegram/bot123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdef/sendMessage", func(request recordedRequest) bool {
+			return request.body["chat_id"] == "-1001234567" && strings.Contains(request.body["text"].(string), "CPU 97%")
+		}},
+	}
+	for _, test := range cases {
+		channel := notificationChannel(t, manager, test.input)
+		if err := sender.Send(context.Background(), channel, event); err != nil {
+			t.Fatalf("send %s: %v", channel.Type, err)
+		}
+		request := standIn.last()
+		if request.path != test.path || !test.verify(request) {
+			t.Fatalf("unexpected %s request: %#v", channel.Type, request)
+		}
+	}
+
+	standIn.reply["/dingtalk"] = `{"errcode":310000,"errmsg":"sign not match"}`
+	var dingTalk models.NotificationChannel
+	if err := manager.db.First(&dingTalk, "type = ?", ChannelTypeDingTalk).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(context.Background(), &dingTalk, event); err == nil ||
+		!strings.Contains(err.Error(), "sign not match") {
+		t.Fatalf("robot error was not surfaced: %v", err)
+	}
+}
+
+func TestChannelSenderDeliversEmailOverSTARTTLS(t *testing.T) {
+	standIn := newNotificationStandIn(t)
+	smtpServer := newSMTPStandIn(t, standIn.server.TLS.Certificates)
+	sender := standIn.sender(smtpServer.address())
+	manager := newTestManager(t, &sequenceCollector{}, sender)
+	channel := notificationChannel(t, manager, ChannelInput{
+		Type: ChannelTypeEmail, SMTPHost: "example.com", SMTPUsername: "alerts",
+		SMTPPassword: "smtp-secret", SMTPFrom: "Panel <alerts@example.com>",
+		SMTPTo: []string{"oncall@example.com", "ops@example.com"},
+	})
+	if err := manager.TestChannel(context.Background(), channel.ID); err != nil {
+		t.Fatal(err)
+	}
+	transcript := smtpServer.wait(t)
+	for _, want := range []string{
+		"STARTTLS", "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00alerts\x00smtp-secret")),
+		"MAIL FROM:<alerts@example.com>", "RCPT TO:<oncall@example.com>", "RCPT TO:<ops@example.com>",
+		"Subject: =?utf-8?q?", "Content-Transfer-Encoding: quoted-printable",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Fatalf("SMTP transcript is missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestChannelConfigValidatesEachTypeAndKeepsSecrets(t *testing.T) {
+	manager := newTestManager(t, &sequenceCollector{}, &recordingSender{})
+	invalid := []ChannelInput{
+		{Type: "pager"},
+		{Type: ChannelTypeSlack, WebhookURL: "http://hooks.example.com/plain"},
+		{Type: ChannelTypeTelegram, BotToken: "not-a-token", ChatID: "1"},
+		{Type: ChannelTypeEmail, SMTPHost: "10.0.0.5", SMTPFrom: "a@example.com", SMTPTo: []string{"b@example.com"}},
+		{Type: ChannelTypeEmail, SMTPHost: "smtp.example.com", SMTPFrom: "a@example.com"},
+		{Type: ChannelTypeWebhook, WebhookURL: "https://hooks.example.com/x", Template: "{{.Missing}}"},
+	}
+	for index, input := range invalid {
+		input.Name = "invalid"
+		if _, err := manager.CreateChannel(input); err == nil {
+			t.Fatalf("invalid channel %d was accepted", index)
+		}
+	}
+	channel := notificationChannel(t, manager, ChannelInput{
+		Type: ChannelTypeTelegram, BotToken: "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdef", ChatID: "@oncall_team",
+	})
+	if channel.TargetHint != "telegram:@oncall_team" {
+		t.Fatalf("target hint = %q", channel.TargetHint)
+	}
+	updated, err := manager.UpdateChannel(channel.ID, ChannelInput{
+		Name: "renamed", Enabled: true, ChatID: "-100987654",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := decryptChannelConfig(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BotToken != "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdef" || config.ChatID != "-100987654" {
+		t.Fatalf("update did not keep the bot token: %#v", config)
+	}
+
+	email := notificationChannel(t, manager, ChannelInput{
+		Type: ChannelTypeEmail, SMTPHost: "smtp.example.com", SMTPUsername: "alerts", SMTPPassword: "secret",
+		SMTPFrom: "alerts@example.com", SMTPTo: []string{"oncall@example.com"},
+	})
+	if updated, err = manager.UpdateChannel(email.ID, ChannelInput{Name: "relay", Enabled: true, SMTPUsername: ""}); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = decryptChannelConfig(updated); err != nil || config.SMTPUsername != "alerts" {
+		t.Fatalf("update without credentials did not keep them: %#v %v", config, err)
+	}
+	if updated, err = manager.UpdateChannel(email.ID, ChannelInput{
+		Name: "relay", Enabled: true, SMTPHost: "relay.example.com", SMTPPort: 25, ClearSMTPAuth: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = decryptChannelConfig(updated); err != nil || config.SMTPUsername != "" || config.SMTPPassword != "" ||
+		config.SMTPHost != "relay.example.com" {
+		t.Fatalf("SMTP authentication was not cleared: %#v %v", config, err)
+	}
+}
+
+type smtpStandIn struct {
+	listener   net.Listener
+	transcript chan string
+}
+
+// newSMTPStandIn accepts a single session that must upgrade with STARTTLS
+// before authenticating, and records every client line.
+func newSMTPStandIn(t *testing.T, certificates []tls.Certificate) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	standIn := &smtpStandIn{listener: listener, transcript: make(chan string, 1)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			standIn.transcript <- err.Error()
+			return
+		}
+		defer conn.Close()
+		var transcript strings.Builder
+		reader := bufio.NewReader(conn)
+		write := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+		secure := false
+		write("220 example.com ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			transcript.WriteString(line + "\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				if secure {
+					write("250-example.com\r\n250 AUTH PLAIN")
+				} else {
+					write("250-example.com\r\n250 STARTTLS")
+				}
+			case command == "STARTTLS":
+				write("220 ready")
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: certificates})
+				if err := tlsConn.Handshake(); err != nil {
+					transcript.WriteString("handshake: " + err.Error())
+					standIn.transcript <- transcript.String()
+					return
+				}
+				conn, reader, secure = tlsConn, bufio.NewReader(tlsConn), true
+			case strings.HasPrefix(command, "AUTH"):
+				if !secure {
+					write("530 must issue STARTTLS first")
+					continue
+				}
+				write("235 accepted")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				write("250 ok")
+			case command == "DATA":
+				write("354 go ahead")
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					transcript.WriteString(dataLine)
+				}
+				write("250 queued")
+			case command == "QUIT":
+				write("221 bye")
+				standIn.transcript <- transcript.String()
+				return
+			default:
+				write("250 ok")
+			}
+		}
+		standIn.transcript <- transcript.String()
+	}()
+	return standIn
+}
+
+func (standIn *smtpStandIn) address() string { return standIn.listener.Addr().String() }
+
+func (standIn *smtpStandIn) wait(t *testing.T) string {
+	t.Helper()
+	select {
+	case transcript := <-standIn.transcript:
+		return transcript
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP session did not finish")
+		return ""
+	}
+}
@@ -0,0 +1,120 @@
+package monitoring
+
+import (
+	"errors"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type resourceEventBuilder func(
+	eventType string,
+	value float64,
+	started, occurred time.Time,
+	resolved *time.Time,
+) *models.MonitorAlertEvent
+
+// evaluateResourceRule runs the rule state machine for one resource of a
+// per-resource metric. It mirrors evaluateRule, keyed by resource.
+func (manager *Manager) evaluateResourceRule(
+	rule *models.MonitorRule,
+	resourceType, resourceID string,
+	value float64,
+	now time.Time,
+	build resourceEventBuilder,
+) (*models.MonitorAlertEvent, bool, error) {
+	if !ruleScheduleActive(rule.Schedule, now) {
+		return nil, false, nil
+	}
+	var event *models.MonitorAlertEvent
+	notify := false
+	err := manager.db.Transaction(func(tx *gorm.DB) error {
+		state := models.MonitorResourceAlertState{
+			RuleID: rule.ID, ResourceType: resourceType,
+			ResourceID: resourceID, State: models.MonitorStateNormal,
+		}
+		result := tx.First(&state, "rule_id = ? AND resource_type = ? AND resource_id = ?",
+			rule.ID, resourceType, resourceID)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		state.LastValue = value
+		state.LastEvaluatedAt = now
+		breached := comparison(value, rule.Operator, rule.Threshold)
+		recovered := recoveryComparison(value, rule.Operator, rule.RecoveryThreshold)
+		switch state.State {
+		case models.MonitorStateFiring:
+			if !breached && recovered {
+				resolved := now
+				started := now
+				if state.FiringSince != nil {
+					started = *state.FiringSince
+				}
+				event = build(models.AlertEventResolved, value, started, now, &resolved)
+				state.State = models.MonitorStateNormal
+				state.ConsecutiveBreaches = 0
+				state.PendingSince = nil
+				state.FiringSince = nil
+				state.LastNotifiedAt = &now
+				notify = true
+			} else if reminderDue(state.LastNotifiedAt, rule.CooldownMinutes, now) {
+				started := now
+				if state.FiringSince != nil {
+					started = *state.FiringSince
+				}
+				event = build(models.AlertEventReminder, value, started, now, nil)
+				state.LastNotifiedAt = &now
+				notify = true
+			}
+		default:
+			if !breached {
+				state.State = models.MonitorStateNormal
+				state.ConsecutiveBreaches = 0
+				state.PendingSince = nil
+			} else {
+				if state.State != models.MonitorStatePending {
+					state.State = models.MonitorStatePending
+					state.ConsecutiveBreaches = 0
+					state.PendingSince = &now
+				}
+				state.ConsecutiveBreaches++
+				if state.ConsecutiveBreaches >= rule.ConsecutiveSamples {
+					started := now
+					if state.PendingSince != nil {
+						started = *state.PendingSince
+					}
+					state.State = models.MonitorStateFiring
+					state.FiringSince = &started
+					state.LastNotifiedAt = &now
+					event = build(models.AlertEventTriggered, value, started, now, nil)
+					notify = true
+				}
+			}
+		}
+		if event != nil {
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&state).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if rule.SilencedUntil != nil && rule.SilencedUntil.After(now) {
+		notify = false
+	}
+	return event, notify, nil
+}
+
+// pruneResourceStates drops state for resources a rule no longer sees, such
+// as a deleted website or an unmounted volume.
+func (manager *Manager) pruneResourceStates(ruleID uint, resourceType string, seen []string) error {
+	query := manager.db.Where("rule_id = ? AND resource_type = ?", ruleID, resourceType)
+	if len(seen) > 0 {
+		query = query.Where("resource_id NOT IN ?", seen)
+	}
+	return query.Delete(&models.MonitorResourceAlertState{}).Error
+}
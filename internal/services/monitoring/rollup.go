@@ -0,0 +1,310 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HistoryResolutionRaw        = "raw"
+	HistoryResolutionFiveMinute = "5m"
+	HistoryResolutionHour       = "1h"
+
+	defaultFiveMinuteRetentionDays = 90
+	defaultHourlyRetentionDays     = 730
+	maxHistoryRange                = 366 * 24 * time.Hour
+	// A single rollup pass reads at most this much raw history so a first run
+	// after an upgrade does not hold the SQLite writer for long.
+	rollupBatchWindow = 7 * 24 * time.Hour
+)
+
+type rollupTier struct {
+	name string
+	step time.Duration
+}
+
+var rollupTiers = []rollupTier{
+	{name: HistoryResolutionFiveMinute, step: 5 * time.Minute},
+	{name: HistoryResolutionHour, step: time.Hour},
+}
+
+// SetRollupRetention configures how long the 5-minute and 1-hour aggregates
+// are kept. Aggregates are expected to outlive the raw samples.
+func (manager *Manager) SetRollupRetention(fiveMinuteDays, hourlyDays int) error {
+	if fiveMinuteDays < manager.retentionDays || fiveMinuteDays > 3650 {
+		return errors.New("5-minute rollup retention must be between the raw retention and 3650 days")
+	}
+	if hourlyDays < fiveMinuteDays || hourlyDays > 3650 {
+		return errors.New("hourly rollup retention must be between the 5-minute retention and 3650 days")
+	}
+	manager.fiveMinuteRetention = fiveMinuteDays
+	manager.hourlyRetention = hourlyDays
+	return nil
+}
+
+// Rollup aggregates completed buckets of raw samples into every tier. It
+// resumes after the newest stored bucket, so it is safe to run after every
+// sample and idempotent when a pass is interrupted.
+func (manager *Manager) Rollup() error {
+	manager.rollupMu.Lock()
+	defer manager.rollupMu.Unlock()
+	now := manager.now().UTC()
+	for _, tier := range rollupTiers {
+		if err := manager.rollupTier(tier, now); err != nil {
+			return fmt.Errorf("roll up %s metrics: %w", tier.name, err)
+		}
+	}
+	return nil
+}
+
+func (manager *Manager) rollupTier(tier rollupTier, now time.Time) error {
+	resolution := int64(tier.step / time.Second)
+	end := now.Truncate(tier.step)
+	var start time.Time
+	var last models.MetricRollup
+	err := manager.db.Where("resolution = ?", resolution).Order("bucket_start DESC").First(&last).Error
+	if err == nil {
+		start = last.BucketStart.Add(tier.step)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	// Skip gaps, such as the panel being stopped, straight to the next sample.
+	var next models.MetricSample
+	err = manager.db.Where("captured_at >= ?", start).Order("captured_at ASC").First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if candidate := next.CapturedAt.UTC().Truncate(tier.step); candidate.After(start) {
+		start = candidate
+	}
+	if !start.Before(end) {
+		return nil
+	}
+	if end.Sub(start) > rollupBatchWindow {
+		end = start.Add(rollupBatchWindow)
+	}
+	var samples []models.MetricSample
+	if err := manager.db.Where("captured_at >= ? AND captured_at < ?", start, end).
+		Order("captured_at ASC").Find(&samples).Error; err != nil {
+		return err
+	}
+	type rollupKey struct {
+		bucket time.Time
+		metric string
+	}
+	aggregates := make(map[rollupKey]*historyAccumulator)
+	order := make([]rollupKey, 0)
+	for index := range samples {
+		bucket := samples[index].CapturedAt.UTC().Truncate(tier.step)
+		for _, definition := range metricHistorySeriesDefinitions {
+			key := rollupKey{bucket: bucket, metric: definition.Key}
+			aggregate := aggregates[key]
+			if aggregate == nil {
+				aggregate = &historyAccumulator{}
+				aggregates[key] = aggregate
+				order = append(order, key)
+			}
+			aggregate.addValue(definition.Value(&samples[index]))
+		}
+	}
+	rows := make([]models.MetricRollup, 0, len(order))
+	for _, key := range order {
+		aggregate := aggregates[key]
+		rows = append(rows, models.MetricRollup{
+			Resolution: resolution, BucketStart: key.bucket, Metric: key.metric,
+			Min: aggregate.min, Max: aggregate.max, Avg: aggregate.average(), Count: aggregate.count,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return manager.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "resolution"}, {Name: "bucket_start"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min", "max", "avg", "count"}),
+	}).CreateInBatches(rows, 200).Error
+}
+
+type historyAccumulator struct {
+	min, max, sum float64
+	count         int64
+}
+
+func (accumulator *historyAccumulator) addValue(value float64) {
+	accumulator.add(value, value, value, 1)
+}
+
+func (accumulator *historyAccumulator) add(minimum, maximum, average float64, count int64) {
+	if count <= 0 {
+		return
+	}
+	if accumulator.count == 0 || minimum < accumulator.min {
+		accumulator.min = minimum
+	}
+	if accumulator.count == 0 || maximum > accumulator.max {
+		accumulator.max = maximum
+	}
+	accumulator.sum += average * float64(count)
+	accumulator.count += count
+}
+
+func (accumulator *historyAccumulator) average() float64 {
+	if accumulator.count == 0 {
+		return 0
+	}
+	return accumulator.sum / float64(accumulator.count)
+}
+
+// historyTier picks the finest tier that still holds the whole range and
+// keeps the number of rows read bounded: raw samples up to two days, 5-minute
+// aggregates up to two weeks, hourly aggregates beyond.
+func (manager *Manager) historyTier(from, to time.Time) *rollupTier {
+	now := manager.now().UTC()
+	span := to.Sub(from)
+	if span <= 2*24*time.Hour && !from.Before(now.AddDate(0, 0, -manager.retentionDays)) {
+		return nil
+	}
+	if span <= 14*24*time.Hour && !from.Before(now.AddDate(0, 0, -manager.fiveMinuteRetention)) {
+		return &rollupTiers[0]
+	}
+	return &rollupTiers[1]
+}
+
+func (manager *Manager) History(from, to time.Time) (*HistoryResponse, error) {
+	from = from.UTC().Truncate(time.Second)
+	to = to.UTC().Truncate(time.Second)
+	if from.IsZero() || to.IsZero() {
+		return nil, errors.New("history range is required")
+	}
+	if to.Before(from) {
+		return nil, errors.New("history range end must not be before start")
+	}
+	if to.Sub(from) > maxHistoryRange {
+		return nil, errors.New("history range must not exceed 366 days")
+	}
+
+	tier := manager.historyTier(from, to)
+	bucketSeconds := int64(math.Ceil(to.Sub(from).Seconds() / monitorHistoryTargetPoints))
+	if bucketSeconds < int64(time.Minute/time.Second) {
+		bucketSeconds = int64(time.Minute / time.Second)
+	}
+	resolution := HistoryResolutionRaw
+	if tier != nil {
+		resolution = tier.name
+		if step := int64(tier.step / time.Second); bucketSeconds < step {
+			bucketSeconds = step
+		}
+	}
+	bucketDuration := time.Duration(bucketSeconds) * time.Second
+
+	type historyBucket struct {
+		start  time.Time
+		values map[string]*historyAccumulator
+	}
+	buckets := make([]*historyBucket, 0)
+	byStart := make(map[time.Time]*historyBucket)
+	bucketAt := func(capturedAt time.Time) *historyBucket {
+		bucketOffset := int64(capturedAt.Sub(from) / bucketDuration)
+		if bucketOffset < 0 {
+			bucketOffset = 0
+		}
+		startAt := from.Add(time.Duration(bucketOffset) * bucketDuration)
+		bucket := byStart[startAt]
+		if bucket == nil {
+			bucket = &historyBucket{
+				start:  startAt,
+				values: make(map[string]*historyAccumulator, len(metricHistorySeriesDefinitions)),
+			}
+			for _, definition := range metricHistorySeriesDefinitions {
+				bucket.values[definition.Key] = &historyAccumulator{}
+			}
+			byStart[startAt] = bucket
+			buckets = append(buckets, bucket)
+		}
+		return bucket
+	}
+
+	sampleCount := 0
+	rawFrom := from
+	if tier != nil {
+		var rollups []models.MetricRollup
+		if err := manager.db.Where("resolution = ? AND bucket_start >= ? AND bucket_start <= ?",
+			int64(tier.step/time.Second), from, to).
+			Order("bucket_start ASC").Order("id ASC").Find(&rollups).Error; err != nil {
+			return nil, err
+		}
+		for index := range rollups {
+			rollup := &rollups[index]
+			if accumulator := bucketAt(rollup.BucketStart).values[rollup.Metric]; accumulator != nil {
+				accumulator.add(rollup.Min, rollup.Max, rollup.Avg, rollup.Count)
+			}
+			if covered := rollup.BucketStart.Add(tier.step); covered.After(rawFrom) {
+				rawFrom = covered
+			}
+		}
+		sampleCount = len(rollups)
+	}
+	// Rollups only cover completed buckets; the newest part of the range is
+	// always read from raw samples.
+	if tier == nil || rawFrom.After(from) || sampleCount == 0 {
+		var samples []models.MetricSample
+		query := manager.db.Where("captured_at >= ? AND captured_at <= ?", rawFrom, to)
+		if tier != nil && sampleCount == 0 {
+			// Nothing rolled up yet for this range, e.g. right after an upgrade:
+			// fall back to whatever raw history remains.
+			query = manager.db.Where("captured_at >= ? AND captured_at <= ?", from, to)
+		}
+		if err := query.Order("captured_at ASC").Order("id ASC").Find(&samples).Error; err != nil {
+			return nil, err
+		}
+		for index := range samples {
+			bucket := bucketAt(samples[index].CapturedAt)
+			for _, definition := range metricHistorySeriesDefinitions {
+				bucket.values[definition.Key].addValue(definition.Value(&samples[index]))
+			}
+		}
+		sampleCount += len(samples)
+	}
+
+	series := make([]HistorySeries, len(metricHistorySeriesDefinitions))
+	for index, definition := range metricHistorySeriesDefinitions {
+		series[index] = HistorySeries{
+			Group:  definition.Group,
+			Key:    definition.Key,
+			Label:  definition.Label,
+			Unit:   definition.Unit,
+			Points: make([]HistoryPoint, 0, len(buckets)),
+		}
+		for _, bucket := range buckets {
+			accumulator := bucket.values[definition.Key]
+			if accumulator.count == 0 {
+				continue
+			}
+			minimum, maximum := accumulator.min, accumulator.max
+			series[index].Points = append(series[index].Points, HistoryPoint{
+				CapturedAt: bucket.start, Value: accumulator.average(), Min: &minimum, Max: &maximum,
+			})
+		}
+	}
+
+	return &HistoryResponse{
+		Range: HistoryRange{
+			From:          from,
+			To:            to,
+			BucketSeconds: bucketSeconds,
+			Resolution:    resolution,
+			SampleCount:   sampleCount,
+			BucketCount:   len(buckets),
+		},
+		Series: series,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+func TestRollupTiersServeHistoryAfterRawRetention(t *testing.T) {
+	now := time.Date(2026, 8, 21, 0, 0, 0, 0, time.UTC)
+	manager := newTestManager(t, &sequenceCollector{}, &recordingSender{})
+	manager.now = func() time.Time { return now }
+	samples := make([]models.MetricSample, 0, 20*24*6)
+	for at, index := now.AddDate(0, 0, -20), 0; at.Before(now); at, index = at.Add(10*time.Minute), index+1 {
+		samples = append(samples, models.MetricSample{CapturedAt: at, CPUPercent: float64(index%6) * 10})
+	}
+	if err := manager.db.CreateInBatches(samples, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+	// The first pass is bounded; later passes resume after the newest bucket.
+	for pass := 0; pass < 4; pass++ {
+		if err := manager.Rollup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var hourly []models.MetricRollup
+	if err := manager.db.Where("resolution = ? AND metric = ?", 3600, "cpuPercent").
+		Order("bucket_start ASC").Find(&hourly).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 20*24 {
+		t.Fatalf("hourly buckets = %d, want %d", len(hourly), 20*24)
+	}
+	if bucket := hourly[0]; bucket.Min != 0 || bucket.Max != 50 || bucket.Avg != 25 || bucket.Count != 6 {
+		t.Fatalf("unexpected hourly bucket: %#v", bucket)
+	}
+	var fiveMinute int64
+	if err := manager.db.Model(&models.MetricRollup{}).Where("resolution = ? AND metric = ?", 300, "cpuPercent").
+		Count(&fiveMinute).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fiveMinute != int64(len(samples)) {
+		t.Fatalf("5-minute buckets = %d, want one per sample", fiveMinute)
+	}
+
+	week, err := manager.History(now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if week.Range.Resolution != HistoryResolutionFiveMinute {
+		t.Fatalf("7-day resolution = %s", week.Range.Resolution)
+	}
+
+	manager.retentionDays = 1
+	if err := manager.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	var raw int64
+	if err := manager.db.Model(&models.MetricSample{}).Count(&raw).Error; err != nil {
+		t.Fatal(err)
+	}
+	if raw != 24*6 {
+		t.Fatalf("raw samples after cleanup = %d", raw)
+	}
+	history, err := manager.History(now.AddDate(0, 0, -20), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Range.Resolution != HistoryResolutionHour {
+		t.Fatalf("20-day resolution = %s", history.Range.Resolution)
+	}
+	var cpu *HistorySeries
+	for index := range history.Series {
+		if history.Series[index].Key == "cpuPercent" {
+			cpu = &history.Series[index]
+		}
+	}
+	if cpu == nil || len(cpu.Points) != 20*24 {
+		t.Fatalf("unexpected CPU history: %#v", cpu)
+	}
+	if point := cpu.Points[0]; point.Value != 25 || point.Min == nil || *point.Min != 0 || *point.Max != 50 {
+		t.Fatalf("unexpected first point: %#v", point)
+	}
+}
@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ruleSchedule restricts when a rule is evaluated. The textual form is an
+// optional day list followed by an optional time window in server local time,
+// for example "mon-fri 09:00-18:00", "sat,sun" or "22:00-06:00". A window
+// that ends before it starts wraps past midnight and belongs to the day it
+// started on.
+type ruleSchedule struct {
+	days        [7]bool
+	allDays     bool
+	startMinute int
+	endMinute   int
+	hasWindow   bool
+}
+
+func parseRuleSchedule(value string) (*ruleSchedule, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return nil, nil
+	}
+	if len(value) > 64 {
+		return nil, errors.New("schedule must not exceed 64 characters")
+	}
+	schedule := &ruleSchedule{allDays: true}
+	for _, field := range strings.Fields(value) {
+		if strings.Contains(field, ":") {
+			if schedule.hasWindow {
+				return nil, errors.New("schedule accepts a single time window")
+			}
+			start, end, ok := strings.Cut(field, "-")
+			if !ok {
+				return nil, fmt.Errorf("invalid schedule window %q", field)
+			}
+			var err error
+			if schedule.startMinute, err = parseScheduleClock(start); err != nil {
+				return nil, err
+			}
+			if schedule.endMinute, err = parseScheduleClock(end); err != nil {
+				return nil, err
+			}
+			if schedule.startMinute == schedule.endMinute {
+				return nil, errors.New("schedule window must not be empty")
+			}
+			schedule.hasWindow = true
+			continue
+		}
+		if !schedule.allDays {
+			return nil, errors.New("schedule accepts a single day list")
+		}
+		schedule.allDays = false
+		for _, part := range strings.Split(field, ",") {
+			first, last, isRange := strings.Cut(part, "-")
+			from, ok := scheduleWeekdays[first]
+			if !ok {
+				return nil, fmt.Errorf("invalid schedule day %q", first)
+			}
+			to := from
+			if isRange {
+				if to, ok = scheduleWeekdays[last]; !ok {
+					return nil, fmt.Errorf("invalid schedule day %q", last)
+				}
+			}
+			for day := from; ; day = (day + 1) % 7 {
+				schedule.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+	return schedule, nil
+}
+
+func parseScheduleClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule time %q", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func (schedule *ruleSchedule) active(now time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+	local := now.Local()
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	if schedule.hasWindow {
+		if schedule.startMinute < schedule.endMinute {
+			if minute < schedule.startMinute || minute >= schedule.endMinute {
+				return false
+			}
+		} else if minute < schedule.endMinute {
+			// Early morning part of a window that started the previous day.
+			day = (day + 6) % 7
+		} else if minute < schedule.startMinute {
+			return false
+		}
+	}
+	return schedule.allDays || schedule.days[day]
+}
+
+// ruleScheduleActive reports whether a rule should be evaluated now. Rules
+// with an unparsable schedule stay active so a bad value cannot hide alerts.
+func ruleScheduleActive(schedule string, now time.Time) bool {
+	parsed, err := parseRuleSchedule(schedule)
+	return err != nil || parsed.active(now)
+}
@@ -0,0 +1,302 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	MetricWebsiteRequestRate = "website_request_rate"
+	MetricWebsiteBytesRate   = "website_bytes_rate"
+	MetricServiceCPU         = "service_cpu_percent"
+	MetricServiceMemoryRSS   = "service_memory_rss"
+	MetricMountDisk          = "mount_disk_percent"
+
+	ResourceTypeWebsite = "website"
+	ResourceTypeService = "service"
+	ResourceTypeMount   = "mount"
+
+	maxSeriesPoints = 4096
+)
+
+type seriesMetricDefinition struct {
+	ResourceType string
+	Label        string
+	Unit         string
+}
+
+var seriesMetricDefinitions = map[string]seriesMetricDefinition{
+	MetricWebsiteRequestRate: {ResourceType: ResourceTypeWebsite, Label: "请求速率", Unit: "req/s"},
+	MetricWebsiteBytesRate:   {ResourceType: ResourceTypeWebsite, Label: "响应流量", Unit: "B/s"},
+	MetricServiceCPU:         {ResourceType: ResourceTypeService, Label: "CPU 使用率", Unit: "%"},
+	MetricServiceMemoryRSS:   {ResourceType: ResourceTypeService, Label: "常驻内存", Unit: "B"},
+	MetricMountDisk:          {ResourceType: ResourceTypeMount, Label: "磁盘使用率", Unit: "%"},
+}
+
+var seriesMetrics = []string{
+	MetricWebsiteRequestRate,
+	MetricWebsiteBytesRate,
+	MetricServiceCPU,
+	MetricServiceMemoryRSS,
+	MetricMountDisk,
+}
+
+// SeriesPoint is one labeled value of a per-resource metric. The resource
+// type is implied by the metric; ResourceID is the stable key rules match on
+// and Label is only used for display.
+type SeriesPoint struct {
+	Metric     string
+	ResourceID string
+	Label      string
+	Value      float64
+}
+
+type SeriesCollector interface {
+	CollectSeries(context.Context) ([]SeriesPoint, error)
+}
+
+type SeriesCollectorFunc func(context.Context) ([]SeriesPoint, error)
+
+func (function SeriesCollectorFunc) CollectSeries(ctx context.Context) ([]SeriesPoint, error) {
+	return function(ctx)
+}
+
+// AddSeriesCollector registers an additional source of labeled series. Every
+// collector runs after the host sample on each collection round.
+func (manager *Manager) AddSeriesCollector(collector SeriesCollector) {
+	if manager == nil || collector == nil {
+		return
+	}
+	manager.seriesMu.Lock()
+	manager.series = append(manager.series, collector)
+	manager.seriesMu.Unlock()
+}
+
+func isSeriesMetric(metric string) bool {
+	_, exists := seriesMetricDefinitions[metric]
+	return exists
+}
+
+// resourceMetrics lists the metrics evaluated per resource instead of
+// against the host-wide sample.
+func resourceMetrics() []string {
+	metrics := make([]string, 0, len(certificateMetrics)+len(seriesMetrics))
+	return append(append(metrics, certificateMetrics...), seriesMetrics...)
+}
+
+// collectSeries runs every registered series collector, stores the points
+// with the host sample timestamp, and evaluates per-resource rules. A failing
+// collector is logged and skipped; stale alert state is only pruned after a
+// complete round so a transient failure does not reset pending alerts.
+func (manager *Manager) collectSeries(ctx context.Context, capturedAt time.Time) error {
+	manager.seriesMu.Lock()
+	collectors := append([]SeriesCollector(nil), manager.series...)
+	manager.seriesMu.Unlock()
+	if len(collectors) == 0 {
+		return nil
+	}
+	complete := true
+	points := make([]SeriesPoint, 0)
+	for _, collector := range collectors {
+		collected, err := collector.CollectSeries(ctx)
+		if err != nil {
+			complete = false
+			log.Printf("monitor series collection failed: %v", err)
+			continue
+		}
+		points = append(points, collected...)
+	}
+	if len(points) > maxSeriesPoints {
+		return errors.New("series collectors returned too many points")
+	}
+	samples := make([]models.MetricSeriesSample, 0, len(points))
+	for index := range points {
+		point := &points[index]
+		definition, exists := seriesMetricDefinitions[point.Metric]
+		if !exists {
+			return fmt.Errorf("unsupported series metric %q", point.Metric)
+		}
+		point.ResourceID = truncateText(point.ResourceID, 64)
+		point.Label = truncateText(point.Label, 120)
+		point.Value = finite(point.Value)
+		if point.ResourceID == "" {
+			return errors.New("series resource id is required")
+		}
+		if point.Label == "" {
+			point.Label = point.ResourceID
+		}
+		samples = append(samples, models.MetricSeriesSample{
+			CapturedAt: capturedAt, Metric: point.Metric, ResourceType: definition.ResourceType,
+			ResourceID: point.ResourceID, Label: point.Label, Value: point.Value,
+		})
+	}
+	if len(samples) > 0 {
+		if err := manager.db.CreateInBatches(samples, 200).Error; err != nil {
+			return fmt.Errorf("persist metric series: %w", err)
+		}
+	}
+	var rules []models.MonitorRule
+	if err := manager.db.Where("enabled = ? AND metric IN ?", true, seriesMetrics).
+		Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+	for index := range rules {
+		rule := &rules[index]
+		definition := seriesMetricDefinitions[rule.Metric]
+		seen := make([]string, 0)
+		for pointIndex := range points {
+			point := &points[pointIndex]
+			if point.Metric != rule.Metric || (rule.ResourceID != "" && rule.ResourceID != point.ResourceID) {
+				continue
+			}
+			seen = append(seen, point.ResourceID)
+			event, notify, err := manager.evaluateResourceRule(
+				rule, definition.ResourceType, point.ResourceID, point.Value, capturedAt,
+				func(eventType string, value float64, started, occurred time.Time, resolved *time.Time) *models.MonitorAlertEvent {
+					return newSeriesEvent(rule, point, eventType, value, started, occurred, resolved)
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if event != nil && notify {
+				manager.deliver(ctx, event)
+			}
+		}
+		if complete {
+			if err := manager.pruneResourceStates(rule.ID, definition.ResourceType, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newSeriesEvent(
+	rule *models.MonitorRule,
+	point *SeriesPoint,
+	eventType string,
+	value float64,
+	started, occurred time.Time,
+	resolved *time.Time,
+) *models.MonitorAlertEvent {
+	definition := seriesMetricDefinitions[rule.Metric]
+	var subject string
+	switch definition.ResourceType {
+	case ResourceTypeWebsite:
+		subject = "网站 " + point.Label
+	case ResourceTypeService:
+		subject = "服务 " + point.Label
+	case ResourceTypeMount:
+		subject = "挂载点 " + point.Label
+	}
+	message := fmt.Sprintf("%s %s %.2f %s（阈值 %.2f）",
+		subject, definition.Label, value, definition.Unit, rule.Threshold)
+	if eventType == models.AlertEventResolved {
+		message += "，告警已恢复"
+	}
+	return &models.MonitorAlertEvent{
+		RuleID: rule.ID, RuleName: rule.Name, Metric: rule.Metric,
+		ResourceType: definition.ResourceType, ResourceID: point.ResourceID,
+		Severity: rule.Severity, EventType: eventType, Value: value,
+		Threshold: rule.Threshold, StartedAt: started, OccurredAt: occurred,
+		ResolvedAt: resolved, Message: truncateText(strings.TrimSpace(message), 255),
+	}
+}
+
+// ListSeries returns the most recent collection round, optionally limited to
+// one metric.
+func (manager *Manager) ListSeries(metric string) ([]models.MetricSeriesSample, error) {
+	if metric != "" && !isSeriesMetric(metric) {
+		return nil, errors.New("unsupported series metric")
+	}
+	query := manager.db.Model(&models.MetricSeriesSample{})
+	if metric != "" {
+		query = query.Where("metric = ?", metric)
+	}
+	var latest models.MetricSeriesSample
+	if err := query.Order("captured_at DESC").Limit(1).Find(&latest).Error; err != nil {
+		return nil, err
+	}
+	samples := make([]models.MetricSeriesSample, 0)
+	if latest.ID == 0 {
+		return samples, nil
+	}
+	query = manager.db.Where("captured_at = ?", latest.CapturedAt)
+	if metric != "" {
+		query = query.Where("metric = ?", metric)
+	}
+	err := query.Order("metric ASC").Order("resource_id ASC").Find(&samples).Error
+	return samples, err
+}
+
+// SeriesHistory returns one resource series averaged into the same buckets
+// as History, so both can be drawn on one chart.
+func (manager *Manager) SeriesHistory(metric, resourceID string, from, to time.Time) (*HistoryResponse, error) {
+	definition, exists := seriesMetricDefinitions[metric]
+	if !exists {
+		return nil, errors.New("unsupported series metric")
+	}
+	resourceID = strings.TrimSpace(resourceID)
+	if resourceID == "" || len(resourceID) > 64 {
+		return nil, errors.New("series resource id must contain 1 to 64 characters")
+	}
+	from = from.UTC().Truncate(time.Second)
+	to = to.UTC().Truncate(time.Second)
+	if from.IsZero() || to.IsZero() {
+		return nil, errors.New("history range is required")
+	}
+	if to.Before(from) {
+		return nil, errors.New("history range end must not be before start")
+	}
+	if to.Sub(from) > 31*24*time.Hour {
+		return nil, errors.New("history range must not exceed 31 days")
+	}
+	var samples []models.MetricSeriesSample
+	if err := manager.db.Where("metric = ? AND resource_id = ?", metric, resourceID).
+		Where("captured_at >= ? AND captured_at <= ?", from, to).
+		Order("captured_at ASC").Order("id ASC").Find(&samples).Error; err != nil {
+		return nil, err
+	}
+
+	bucketSeconds := int64(math.Ceil(to.Sub(from).Seconds() / monitorHistoryTargetPoints))
+	if bucketSeconds < int64(time.Minute/time.Second) {
+		bucketSeconds = int64(time.Minute / time.Second)
+	}
+	bucketDuration := time.Duration(bucketSeconds) * time.Second
+	series := HistorySeries{
+		Group: definition.ResourceType, Key: metric, Label: definition.Label,
+		Unit: definition.Unit, Points: make([]HistoryPoint, 0),
+	}
+	var total float64
+	var count int
+	var currentStart time.Time
+	for index := range samples {
+		sample := &samples[index]
+		startAt := from.Add(sample.CapturedAt.Sub(from) / bucketDuration * bucketDuration)
+		if count > 0 && !startAt.Equal(currentStart) {
+			series.Points = append(series.Points, HistoryPoint{CapturedAt: currentStart, Value: total / float64(count)})
+			total, count = 0, 0
+		}
+		currentStart = startAt
+		total += sample.Value
+		count++
+	}
+	if count > 0 {
+		series.Points = append(series.Points, HistoryPoint{CapturedAt: currentStart, Value: total / float64(count)})
+	}
+	return &HistoryResponse{
+		Range: HistoryRange{
+			From: from, To: to, BucketSeconds: bucketSeconds, Resolution: HistoryResolutionRaw,
+			SampleCount: len(samples), BucketCount: len(series.Points),
+		},
+		Series: []HistorySeries{series},
+	}, nil
+}
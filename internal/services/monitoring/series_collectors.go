@@ -0,0 +1,253 @@
+package monitoring
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/process"
+	"gorm.io/gorm"
+)
+
+var pseudoFilesystems = map[string]bool{
+	"overlay": true, "squashfs": true, "tmpfs": true, "devtmpfs": true,
+	"iso9660": true, "nsfs": true, "fuse.lxcfs": true,
+}
+
+// MountCollector reports disk usage for every mounted block filesystem, so
+// a full data volume can alert independently from the root filesystem.
+type MountCollector struct{}
+
+func NewMountCollector() *MountCollector {
+	return &MountCollector{}
+}
+
+func (collector *MountCollector) CollectSeries(ctx context.Context) ([]SeriesPoint, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]SeriesPoint, 0, len(partitions))
+	seen := make(map[string]bool, len(partitions))
+	for _, partition := range partitions {
+		if pseudoFilesystems[partition.Fstype] || seen[partition.Mountpoint] {
+			continue
+		}
+		seen[partition.Mountpoint] = true
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		points = append(points, SeriesPoint{
+			Metric: MetricMountDisk, ResourceID: partition.Mountpoint,
+			Label: partition.Mountpoint, Value: usage.UsedPercent,
+		})
+	}
+	return points, nil
+}
+
+type serviceProcessMatcher struct {
+	service  string
+	prefixes []string
+}
+
+var monitoredServiceProcesses = []serviceProcessMatcher{
+	{service: "nginx", prefixes: []string{"nginx"}},
+	{service: "mysql", prefixes: []string{"mysqld", "mariadbd"}},
+	{service: "redis", prefixes: []string{"redis-server"}},
+	{service: "php-fpm", prefixes: []string{"php-fpm"}},
+}
+
+type processStat struct {
+	pid        int32
+	name       string
+	rss        uint64
+	cpuSeconds float64
+	createdAt  time.Time
+}
+
+// ServiceProcessCollector sums resident memory and CPU time over every
+// process of the managed services. CPU is reported like top: 100 means one
+// fully busy core.
+type ServiceProcessCollector struct {
+	mu        sync.Mutex
+	processes func(context.Context) ([]processStat, error)
+	now       func() time.Time
+	previous  map[int32]float64
+	sampledAt time.Time
+}
+
+func NewServiceProcessCollector() *ServiceProcessCollector {
+	return &ServiceProcessCollector{processes: listProcessStats, now: time.Now}
+}
+
+func (collector *ServiceProcessCollector) CollectSeries(ctx context.Context) ([]SeriesPoint, error) {
+	stats, err := collector.processes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	now := collector.now().UTC()
+	elapsed := now.Sub(collector.sampledAt).Seconds()
+	type totals struct {
+		rss        uint64
+		cpuSeconds float64
+	}
+	byService := make(map[string]*totals)
+	current := make(map[int32]float64, len(stats))
+	for _, stat := range stats {
+		service := matchServiceProcess(stat.name)
+		if service == "" {
+			continue
+		}
+		current[stat.pid] = stat.cpuSeconds
+		total := byService[service]
+		if total == nil {
+			total = &totals{}
+			byService[service] = total
+		}
+		total.rss += stat.rss
+		if previous, exists := collector.previous[stat.pid]; exists && stat.cpuSeconds >= previous {
+			total.cpuSeconds += stat.cpuSeconds - previous
+		} else if !exists && collector.previous != nil && stat.createdAt.After(collector.sampledAt) {
+			total.cpuSeconds += stat.cpuSeconds
+		}
+	}
+	firstRound := collector.previous == nil
+	collector.previous = current
+	collector.sampledAt = now
+
+	services := make([]string, 0, len(byService))
+	for service := range byService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	points := make([]SeriesPoint, 0, len(services)*2)
+	for _, service := range services {
+		total := byService[service]
+		points = append(points, SeriesPoint{
+			Metric: MetricServiceMemoryRSS, ResourceID: service, Label: service, Value: float64(total.rss),
+		})
+		if !firstRound && elapsed > 0 {
+			points = append(points, SeriesPoint{
+				Metric: MetricServiceCPU, ResourceID: service, Label: service,
+				Value: total.cpuSeconds / elapsed * 100,
+			})
+		}
+	}
+	return points, nil
+}
+
+func matchServiceProcess(name string) string {
+	for _, matcher := range monitoredServiceProcesses {
+		for _, prefix := range matcher.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return matcher.service
+			}
+		}
+	}
+	return ""
+}
+
+func listProcessStats(ctx context.Context) ([]processStat, error) {
+	processes, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]processStat, 0)
+	for _, item := range processes {
+		name, err := item.NameWithContext(ctx)
+		if err != nil || matchServiceProcess(name) == "" {
+			continue
+		}
+		memory, err := item.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		times, err := item.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		stat := processStat{pid: item.Pid, name: name, rss: memory.RSS, cpuSeconds: times.User + times.System}
+		if created, err := item.CreateTimeWithContext(ctx); err == nil {
+			stat.createdAt = time.UnixMilli(created).UTC()
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+type websiteTrafficCounters struct {
+	requests, bytes int64
+}
+
+// WebsiteTrafficCollector turns the daily traffic counters maintained by the
+// website access log parser into per-site request and byte rates.
+type WebsiteTrafficCollector struct {
+	db        *gorm.DB
+	now       func() time.Time
+	mu        sync.Mutex
+	previous  map[int64]map[string]websiteTrafficCounters
+	sampledAt time.Time
+}
+
+func NewWebsiteTrafficCollector(db *gorm.DB) *WebsiteTrafficCollector {
+	return &WebsiteTrafficCollector{db: db, now: time.Now}
+}
+
+func (collector *WebsiteTrafficCollector) CollectSeries(ctx context.Context) ([]SeriesPoint, error) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	now := collector.now()
+	// Access log days are in the server's local time; two days back keeps the
+	// previous day's late lines in view across midnight.
+	since := now.AddDate(0, 0, -2).Format("2006-01-02")
+	var rows []models.WebsiteTrafficDaily
+	if err := collector.db.WithContext(ctx).Where("day >= ?", since).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	var sites []models.Website
+	if err := collector.db.WithContext(ctx).Select("id", "name").Order("id ASC").Find(&sites).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[int64]map[string]websiteTrafficCounters, len(sites))
+	for _, row := range rows {
+		if current[row.WebsiteID] == nil {
+			current[row.WebsiteID] = make(map[string]websiteTrafficCounters)
+		}
+		current[row.WebsiteID][row.Day] = websiteTrafficCounters{requests: row.RequestCount, bytes: row.BytesSent}
+	}
+	previous, elapsed := collector.previous, now.Sub(collector.sampledAt).Seconds()
+	collector.previous, collector.sampledAt = current, now
+	if previous == nil || elapsed <= 0 {
+		return nil, nil
+	}
+	points := make([]SeriesPoint, 0, len(sites)*2)
+	for _, site := range sites {
+		var delta websiteTrafficCounters
+		for day, counters := range current[site.ID] {
+			before := previous[site.ID][day]
+			if counters.requests >= before.requests {
+				delta.requests += counters.requests - before.requests
+			}
+			if counters.bytes >= before.bytes {
+				delta.bytes += counters.bytes - before.bytes
+			}
+		}
+		id := strconv.FormatInt(site.ID, 10)
+		points = append(points,
+			SeriesPoint{Metric: MetricWebsiteRequestRate, ResourceID: id, Label: site.Name,
+				Value: float64(delta.requests) / elapsed},
+			SeriesPoint{Metric: MetricWebsiteBytesRate, ResourceID: id, Label: site.Name,
+				Value: float64(delta.bytes) / elapsed},
+		)
+	}
+	return points, nil
+}
@@ -0,0 +1,131 @@
+package monitoring
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+func TestSeriesRulesAlertPerMountAndHonorResourceFilter(t *testing.T) {
+	started := time.Date(2026, 8, 1, 6, 0, 0, 0, time.UTC)
+	samples := make([]*models.MetricSample, 0, 3)
+	for index := 0; index < 3; index++ {
+		samples = append(samples, &models.MetricSample{CapturedAt: started.Add(time.Duration(index) * time.Minute), DiskPercent: 40})
+	}
+	rounds := [][]SeriesPoint{
+		{{Metric: MetricMountDisk, ResourceID: "/", Value: 40}, {Metric: MetricMountDisk, ResourceID: "/data", Value: 97}},
+		{{Metric: MetricMountDisk, ResourceID: "/", Value: 96}, {Metric: MetricMountDisk, ResourceID: "/data", Value: 98}},
+		{{Metric: MetricMountDisk, ResourceID: "/", Value: 96}, {Metric: MetricMountDisk, ResourceID: "/data", Value: 50}},
+	}
+	round := 0
+	sender := &recordingSender{}
+	manager := newTestManager(t, &sequenceCollector{samples: samples}, sender)
+	manager.AddSeriesCollector(SeriesCollectorFunc(func(context.Context) ([]SeriesPoint, error) {
+		result := rounds[round]
+		round++
+		return result, nil
+	}))
+	if err := manager.db.Create(&models.NotificationChannel{
+		ID: "series-channel", Name: "operations", Type: "webhook", Enabled: true,
+		ConfigEncrypted: "not-used-by-recording-sender",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	input := RuleInput{
+		Name: "Data volume full", Metric: MetricMountDisk, ResourceID: "/data", Operator: "gt",
+		Threshold: 95, RecoveryThreshold: 90, ConsecutiveSamples: 1,
+		CooldownMinutes: 1440, Severity: "critical", Enabled: true,
+	}
+	if _, err := manager.CreateRule(input); err != nil {
+		t.Fatal(err)
+	}
+	input.Name, input.Metric = "CPU on one mount", MetricCPU
+	if _, err := manager.CreateRule(input); err == nil {
+		t.Fatal("host metric rule accepted a resource id")
+	}
+	input.Name, input.Metric, input.ResourceID, input.Threshold = "Mount above 100", MetricMountDisk, "", 120
+	if _, err := manager.CreateRule(input); err == nil {
+		t.Fatal("mount rule accepted a threshold above 100 percent")
+	}
+
+	for range rounds {
+		if _, err := manager.CollectNow(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make([]string, 0, len(sender.events))
+	for _, event := range sender.events {
+		got = append(got, event.ResourceType+":"+event.ResourceID+"/"+event.EventType)
+	}
+	want := []string{"mount:/data/" + models.AlertEventTriggered, "mount:/data/" + models.AlertEventResolved}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("series events = %v, want %v", got, want)
+	}
+	if !strings.Contains(sender.events[0].Message, "挂载点 /data") {
+		t.Fatalf("unexpected message: %s", sender.events[0].Message)
+	}
+	latest, err := manager.ListSeries(MetricMountDisk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].ResourceID != "/" || latest[1].ResourceID != "/data" ||
+		latest[1].Value != 50 || !latest[1].CapturedAt.Equal(samples[2].CapturedAt) {
+		t.Fatalf("unexpected latest series: %#v", latest)
+	}
+	history, err := manager.SeriesHistory(MetricMountDisk, "/data", started, started.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Series) != 1 || len(history.Series[0].Points) != 3 || history.Series[0].Points[1].Value != 98 {
+		t.Fatalf("unexpected series history: %#v", history)
+	}
+}
+
+func TestWebsiteTrafficCollectorReportsRatesAcrossMidnight(t *testing.T) {
+	db := monitorTestDB(t)
+	if err := db.AutoMigrate(&models.Website{}, &models.WebsiteTrafficDaily{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Website{ID: 7, Name: "shop.example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	traffic := models.WebsiteTrafficDaily{WebsiteID: 7, Day: "2026-08-01", RequestCount: 1000, BytesSent: 5000}
+	if err := db.Create(&traffic).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 8, 1, 23, 59, 30, 0, time.Local)
+	collector := NewWebsiteTrafficCollector(db)
+	collector.now = func() time.Time { return now }
+	if points, err := collector.CollectSeries(context.Background()); err != nil || len(points) != 0 {
+		t.Fatalf("first round = %#v, %v; want no rates without a baseline", points, err)
+	}
+
+	// The old day receives its last lines while the new day starts counting.
+	now = now.Add(time.Minute)
+	if err := db.Model(&traffic).Updates(map[string]any{"request_count": 1060, "bytes_sent": 8000}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.WebsiteTrafficDaily{
+		WebsiteID: 7, Day: "2026-08-02", RequestCount: 60, BytesSent: 4000,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	points, err := collector.CollectSeries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64, len(points))
+	for _, point := range points {
+		if point.ResourceID != "7" || point.Label != "shop.example.com" {
+			t.Fatalf("unexpected point: %#v", point)
+		}
+		values[point.Metric] = point.Value
+	}
+	if math.Abs(values[MetricWebsiteRequestRate]-2) > 1e-9 || math.Abs(values[MetricWebsiteBytesRate]-7000.0/60) > 1e-9 {
+		t.Fatalf("unexpected rates: %#v", values)
+	}
+}
@@ -0,0 +1,91 @@
+package remotebackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+)
+
+var ErrObjectNotFound = errors.New("remote backup object not found")
+
+// Object is a file stored on a target. Key is relative to the target's base
+// path and always uses forward slashes.
+type Object struct {
+	Key          string
+	SizeBytes    int64
+	LastModified time.Time
+}
+
+// Checkpoint is the resume state of an interrupted upload. Token is opaque
+// to callers; Uploaded counts the bytes the target already holds.
+type Checkpoint struct {
+	Token    string
+	Uploaded int64
+}
+
+// Driver stores backups on one kind of target. Implementations resolve keys
+// below the target's base path, resume an upload from the checkpoint when the
+// protocol allows it, and call save after every durable step so a restarted
+// Panel can continue where it stopped.
+type Driver interface {
+	Upload(
+		ctx context.Context,
+		key string,
+		source io.ReaderAt,
+		size int64,
+		checkpoint Checkpoint,
+		save func(Checkpoint) error,
+	) error
+	Download(ctx context.Context, key string, destination io.Writer) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// targetConfig is a target with its decrypted secret.
+type targetConfig struct {
+	models.RemoteBackupTarget
+	Secret string
+}
+
+// openDriver connects to a target. Tests replace it to avoid the network.
+var openDriver = func(ctx context.Context, config *targetConfig) (Driver, error) {
+	switch config.Driver {
+	case models.RemoteBackupDriverS3:
+		return newS3Driver(config)
+	case models.RemoteBackupDriverSFTP:
+		return newSFTPDriver(ctx, config)
+	case models.RemoteBackupDriverWebDAV:
+		return newWebDAVDriver(config)
+	default:
+		return nil, fmt.Errorf("unsupported remote backup driver: %s", config.Driver)
+	}
+}
+
+// validObjectKey rejects keys that could leave the base path.
+func validObjectKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return path.Clean(key) == key
+}
+
+// joinRemotePath joins the base path and a validated key.
+func joinRemotePath(base, key string) string {
+	base = strings.Trim(base, "/")
+	if base == "" {
+		return key
+	}
+	return base + "/" + key
+}
@@ -0,0 +1,434 @@
+package remotebackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPinnedHostKeyRejectsOtherKeys(t *testing.T) {
+	pinned := testPublicKey(t, 1)
+	other := testPublicKey(t, 2)
+	callback := pinnedHostKey(ssh.FingerprintSHA256(pinned))
+	if err := callback("backup.example.com:22", nil, pinned); err != nil {
+		t.Fatalf("pinned key was rejected: %v", err)
+	}
+	err := callback("backup.example.com:22", nil, other)
+	if err == nil || !strings.Contains(err.Error(), ssh.FingerprintSHA256(other)) {
+		t.Fatalf("unexpected result for a changed host key: %v", err)
+	}
+}
+
+func TestSFTPUploadResumesFromPartialFile(t *testing.T) {
+	for _, posixRename := range []bool{true, false} {
+		t.Run("posix-rename="+strconv.FormatBool(posixRename), func(t *testing.T) {
+			server := startFakeSFTP(t, posixRename)
+			driver, err := newSFTPDriver(context.Background(), &targetConfig{
+				RemoteBackupTarget: models.RemoteBackupTarget{
+					Driver: models.RemoteBackupDriverSFTP, Endpoint: "backup.example.com", Username: "backup",
+					BasePath: "panel",
+				},
+				Secret: "password",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer driver.Close()
+
+			key := "database/11-appdb/20260331T000000Z_a.sql.gz"
+			content := bytes.Repeat([]byte("remote backup "), 10000)
+			// An earlier run left 50000 bytes but only 40000 were acknowledged
+			// in order; a stale copy of the final object must be replaced.
+			server.write(t, "panel/"+key+".partial", content[:50000])
+			server.write(t, "panel/"+key, []byte("stale"))
+			server.resetReceived()
+			if err := driver.Upload(context.Background(), key, bytes.NewReader(content), int64(len(content)),
+				Checkpoint{Uploaded: 40000}, func(Checkpoint) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if got, resent := server.receivedBytes(), int64(len(content)-40000); got < resent || got > resent+4096 {
+				t.Fatalf("resumed upload sent %d bytes for %d remaining", got, resent)
+			}
+			if stored := server.read(t, "panel/"+key); !bytes.Equal(stored, content) {
+				t.Fatalf("stored object differs: %d bytes", len(stored))
+			}
+			if _, err := os.Stat(filepath.Join(server.root, "panel", key+".partial")); !os.IsNotExist(err) {
+				t.Fatalf("partial file was left behind: %v", err)
+			}
+
+			server.write(t, "panel/database/12-shop/other.sql.gz.partial", []byte("incomplete"))
+			objects, err := driver.List(context.Background(), "database")
+			if err != nil || len(objects) != 1 || objects[0].Key != key || objects[0].SizeBytes != int64(len(content)) {
+				t.Fatalf("unexpected listing: %+v %v", objects, err)
+			}
+			if objects, err := driver.List(context.Background(), "panel"); err != nil || len(objects) != 0 {
+				t.Fatalf("missing directory was not empty: %+v %v", objects, err)
+			}
+			var downloaded bytes.Buffer
+			if err := driver.Download(context.Background(), key, &downloaded); err != nil ||
+				!bytes.Equal(downloaded.Bytes(), content) {
+				t.Fatalf("download failed: %d bytes %v", downloaded.Len(), err)
+			}
+			if err := driver.Delete(context.Background(), key); err != nil {
+				t.Fatal(err)
+			}
+			if err := driver.Delete(context.Background(), key); err != nil {
+				t.Fatalf("deleting a missing object failed: %v", err)
+			}
+			if err := driver.Download(context.Background(), key, io.Discard); !errors.Is(err, ErrObjectNotFound) {
+				t.Fatalf("unexpected download result for a deleted object: %v", err)
+			}
+		})
+	}
+}
+
+func TestSFTPUploadResumesFromCheckpointAfterInterruption(t *testing.T) {
+	server := startFakeSFTP(t, true)
+	config := &targetConfig{
+		RemoteBackupTarget: models.RemoteBackupTarget{
+			Driver: models.RemoteBackupDriverSFTP, Endpoint: "backup.example.com", Username: "backup",
+		},
+		Secret: "password",
+	}
+	content := make([]byte, sftpCheckpointSize+1<<20)
+	for index := range content {
+		content[index] = byte(index%251 + 1)
+	}
+	// The connection drops once the first section has been acknowledged and
+	// the second one is under way.
+	server.dropAfter(sftpCheckpointSize + 256<<10)
+
+	var checkpoint Checkpoint
+	save := func(saved Checkpoint) error {
+		checkpoint = saved
+		return nil
+	}
+	driver, err := newSFTPDriver(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Upload(context.Background(), "site.tar.gz", bytes.NewReader(content), int64(len(content)),
+		Checkpoint{}, save); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+	driver.Close()
+	server.waitIdle(t)
+	if checkpoint.Uploaded != sftpCheckpointSize {
+		t.Fatalf("unexpected checkpoint after the interruption: %d", checkpoint.Uploaded)
+	}
+	// Writes in flight may have landed past the checkpoint in any order.
+	partial := append(server.read(t, "site.tar.gz.partial")[:checkpoint.Uploaded], bytes.Repeat([]byte{0}, 64<<10)...)
+	server.write(t, "site.tar.gz.partial", partial)
+
+	driver, err = newSFTPDriver(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if err := driver.Upload(context.Background(), "site.tar.gz", bytes.NewReader(content), int64(len(content)),
+		checkpoint, save); err != nil {
+		t.Fatal(err)
+	}
+	if stored := server.read(t, "site.tar.gz"); !bytes.Equal(stored, content) {
+		t.Fatalf("resumed object differs from the source: %d bytes", len(stored))
+	}
+}
+
+func TestWebDAVDriverRoundTrip(t *testing.T) {
+	server := newFakeWebDAV(t, "backup", "dav-secret")
+	config := &targetConfig{
+		RemoteBackupTarget: models.RemoteBackupTarget{
+			Driver: models.RemoteBackupDriverWebDAV, Endpoint: server.URL + "/dav/", Username: "backup",
+			BasePath: "panel-a",
+		},
+		Secret: "dav-secret",
+	}
+	driver, err := newWebDAVDriver(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "website/7-blog/20260331T000000Z_b.tar.gz"
+	content := []byte("website archive")
+	if err := driver.Upload(context.Background(), key, bytes.NewReader(content), int64(len(content)),
+		Checkpoint{}, func(Checkpoint) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Upload(context.Background(), key+manifestSuffix, strings.NewReader("{}"), 2,
+		Checkpoint{}, func(Checkpoint) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := driver.List(context.Background(), "")
+	if err != nil || len(objects) != 2 || objects[0].Key != key || objects[0].SizeBytes != int64(len(content)) ||
+		objects[1].Key != key+manifestSuffix {
+		t.Fatalf("unexpected listing: %+v %v", objects, err)
+	}
+	var downloaded bytes.Buffer
+	if err := driver.Download(context.Background(), key, &downloaded); err != nil ||
+		!bytes.Equal(downloaded.Bytes(), content) {
+		t.Fatalf("download failed: %q %v", downloaded.Bytes(), err)
+	}
+	if err := driver.Delete(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Download(context.Background(), key, io.Discard); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("unexpected download result for a deleted object: %v", err)
+	}
+
+	config.Secret = "wrong"
+	if driver, err = newWebDAVDriver(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.List(context.Background(), ""); err == nil {
+		t.Fatal("listing with a wrong password succeeded")
+	}
+}
+
+func testPublicKey(t *testing.T, seed byte) ssh.PublicKey {
+	t.Helper()
+	private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	key, err := ssh.NewPublicKey(private.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// fakeSFTP runs the github.com/pkg/sftp server on a directory. It is
+// connected through dialSFTP, so the SSH layer is not involved.
+type fakeSFTP struct {
+	root string
+
+	mu       sync.Mutex
+	received int64
+	// dropAt closes the connection once the server has received that many
+	// bytes, as a server failing with writes in flight.
+	dropAt  int64
+	serving sync.WaitGroup
+}
+
+func startFakeSFTP(t *testing.T, posixRename bool) *fakeSFTP {
+	t.Helper()
+	server := &fakeSFTP{root: t.TempDir()}
+	if !posixRename {
+		if err := sftp.SetSFTPExtensions("hardlink@openssh.com", "statvfs@openssh.com"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			sftp.SetSFTPExtensions("hardlink@openssh.com", "posix-rename@openssh.com", "statvfs@openssh.com")
+		})
+	}
+	previous := dialSFTP
+	dialSFTP = func(context.Context, *targetConfig) (sftpTransport, error) {
+		client, conn := net.Pipe()
+		handler, err := sftp.NewServer(&fakeSFTPConn{Conn: conn, server: server},
+			sftp.WithServerWorkingDirectory(server.root))
+		if err != nil {
+			return nil, err
+		}
+		server.serving.Add(1)
+		go func() {
+			defer server.serving.Done()
+			handler.Serve()
+			handler.Close()
+		}()
+		return client, nil
+	}
+	t.Cleanup(func() { dialSFTP = previous })
+	return server
+}
+
+func (s *fakeSFTP) write(t *testing.T, name string, content []byte) {
+	t.Helper()
+	full := filepath.Join(s.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *fakeSFTP) read(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func (s *fakeSFTP) resetReceived() {
+	s.mu.Lock()
+	s.received = 0
+	s.mu.Unlock()
+}
+
+func (s *fakeSFTP) receivedBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+func (s *fakeSFTP) dropAfter(size int64) {
+	s.mu.Lock()
+	s.received, s.dropAt = 0, size
+	s.mu.Unlock()
+}
+
+// waitIdle waits until the served connections have finished their requests.
+func (s *fakeSFTP) waitIdle(t *testing.T) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		s.serving.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SFTP server did not stop")
+	}
+}
+
+// fakeSFTPConn counts what the server receives and drops the connection at
+// the configured size.
+type fakeSFTPConn struct {
+	net.Conn
+	server *fakeSFTP
+}
+
+func (c *fakeSFTPConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.server.mu.Lock()
+	c.server.received += int64(n)
+	drop := c.server.dropAt > 0 && c.server.received >= c.server.dropAt
+	if drop {
+		c.server.dropAt = 0
+	}
+	c.server.mu.Unlock()
+	if drop {
+		c.Conn.Close()
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// fakeWebDAV keeps resources in memory and answers MKCOL, PUT, GET, DELETE
+// and Depth 1 PROPFIND below /dav.
+type fakeWebDAV struct {
+	*httptest.Server
+	username string
+	password string
+
+	mu          sync.Mutex
+	files       map[string][]byte
+	collections map[string]bool
+}
+
+func newFakeWebDAV(t *testing.T, username, password string) *fakeWebDAV {
+	t.Helper()
+	server := &fakeWebDAV{
+		username: username, password: password,
+		files: map[string][]byte{}, collections: map[string]bool{"/dav": true},
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeWebDAV) serve(w http.ResponseWriter, r *http.Request) {
+	if username, password, ok := r.BasicAuth(); !ok || username != s.username || password != s.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	name := strings.TrimRight(r.URL.Path, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case "MKCOL":
+		switch {
+		case s.collections[name] || s.files[name] != nil:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !s.collections[path.Dir(name)]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			s.collections[name] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPut:
+		if !s.collections[path.Dir(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.files[name] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		content, ok := s.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	case http.MethodDelete:
+		if _, ok := s.files[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		if !s.collections[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var members []string
+		for collection := range s.collections {
+			if path.Dir(collection) == name && collection != name {
+				members = append(members, collection)
+			}
+		}
+		for file := range s.files {
+			if path.Dir(file) == name {
+				members = append(members, file)
+			}
+		}
+		sort.Strings(members)
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		for _, member := range append([]string{name}, members...) {
+			if s.collections[member] {
+				fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/>`+
+					`</d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, member)
+				continue
+			}
+			fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype/>`+
+				`<d:getcontentlength>%d</d:getcontentlength>`+
+				`<d:getlastmodified>Tue, 31 Mar 2026 00:00:00 GMT</d:getlastmodified></d:prop>`+
+				`<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, member, len(s.files[member]))
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
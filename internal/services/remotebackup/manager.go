@@ -0,0 +1,1237 @@
+package remotebackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/utils"
+
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/disk"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultQueueSize  = 64
+	defaultWorkerSize = 2
+	// maxUploadAttempts bounds how often a sync retries a failed upload.
+	maxUploadAttempts = 5
+	maxRetentionDays  = 3650
+	manifestSuffix    = ".json"
+	maxManifestBytes  = 1 << 20
+	keyTimeLayout     = "20060102T150405Z"
+)
+
+// objectExtensions are the backup formats whose extension is kept in the
+// object key; the longest suffix is listed first.
+var objectExtensions = []string{".tar.gz", ".sql.gz", ".onebak", ".dump"}
+
+var kindOrder = []string{
+	models.RemoteBackupKindDatabase,
+	models.RemoteBackupKindWebsite,
+	models.RemoteBackupKindPanel,
+}
+
+// Manifest is stored next to every remote object as "<key>.json" so the
+// backups on a target can be listed and restored without the local database.
+type Manifest struct {
+	Kind       string          `json:"kind"`
+	BackupID   string          `json:"backupId"`
+	Group      string          `json:"group"`
+	FileName   string          `json:"fileName"`
+	SizeBytes  int64           `json:"sizeBytes"`
+	SHA256     string          `json:"sha256"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UploadedAt time.Time       `json:"uploadedAt"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+}
+
+func (m Manifest) websiteMetadata() (models.WebsiteBackup, bool) {
+	var backup models.WebsiteBackup
+	if len(m.Metadata) == 0 || json.Unmarshal(m.Metadata, &backup) != nil {
+		return backup, false
+	}
+	return backup, true
+}
+
+// RemoteBackup is a backup found on a target.
+type RemoteBackup struct {
+	Key string `json:"key"`
+	Manifest
+}
+
+type TargetInput struct {
+	Name          string   `json:"name"`
+	Driver        string   `json:"driver"`
+	Endpoint      string   `json:"endpoint"`
+	Region        string   `json:"region"`
+	Bucket        string   `json:"bucket"`
+	Username      string   `json:"username"`
+	HostKey       string   `json:"hostKey"`
+	BasePath      string   `json:"basePath"`
+	Secret        string   `json:"secret"`
+	Kinds         []string `json:"kinds"`
+	AutoUpload    bool     `json:"autoUpload"`
+	RetentionDays int      `json:"retentionDays"`
+	Enabled       bool     `json:"enabled"`
+}
+
+type RestoreInput struct {
+	Key        string `json:"key"`
+	LibraryID  int64  `json:"libraryId"`
+	WebsiteID  int64  `json:"websiteId"`
+	Passphrase string `json:"passphrase"`
+}
+
+type SyncResult struct {
+	Targets int `json:"targets"`
+	Queued  int `json:"queued"`
+	Deleted int `json:"deleted"`
+}
+
+type TransferList struct {
+	Data     []models.RemoteBackupTransfer `json:"data"`
+	Total    int64                         `json:"total"`
+	Page     int                           `json:"page"`
+	PageSize int                           `json:"pageSize"`
+}
+
+// Manager copies local backups to remote targets and back. Transfers run on
+// a small worker pool; an upload interrupted by a restart resumes from its
+// last checkpoint.
+type Manager struct {
+	db       *gorm.DB
+	workRoot string
+	queue    chan string
+	stopCh   chan struct{}
+	now      func() time.Time
+
+	sourcesMu sync.RWMutex
+	sources   map[string]Source
+
+	startOnce sync.Once
+	startErr  error
+	stopOnce  sync.Once
+	submitMu  sync.Mutex
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+	cancelMu  sync.Mutex
+	cancels   map[string]context.CancelFunc
+	runWG     sync.WaitGroup
+	stopping  atomic.Bool
+}
+
+var defaultManager struct {
+	sync.RWMutex
+	value *Manager
+}
+
+func NewManager(db *gorm.DB, workRoot string) *Manager {
+	return &Manager{
+		db:       db,
+		workRoot: filepath.Clean(workRoot),
+		queue:    make(chan string, defaultQueueSize),
+		stopCh:   make(chan struct{}),
+		now:      time.Now,
+		sources:  make(map[string]Source),
+		pending:  make(map[string]struct{}),
+		cancels:  make(map[string]context.CancelFunc),
+	}
+}
+
+func ConfigureDefault(manager *Manager) {
+	defaultManager.Lock()
+	defaultManager.value = manager
+	defaultManager.Unlock()
+}
+
+func Default() *Manager {
+	defaultManager.RLock()
+	defer defaultManager.RUnlock()
+	return defaultManager.value
+}
+
+func ClearDefault(manager *Manager) {
+	defaultManager.Lock()
+	if defaultManager.value == manager {
+		defaultManager.value = nil
+	}
+	defaultManager.Unlock()
+}
+
+// RegisterSource connects the local backup store of a kind. Kinds without a
+// source, such as websites while Nginx is not installed, are skipped.
+func (m *Manager) RegisterSource(kind string, source Source) {
+	m.sourcesMu.Lock()
+	m.sources[kind] = source
+	m.sourcesMu.Unlock()
+}
+
+func (m *Manager) source(kind string) (Source, error) {
+	m.sourcesMu.RLock()
+	defer m.sourcesMu.RUnlock()
+	source, ok := m.sources[kind]
+	if !ok {
+		return nil, fmt.Errorf("%s backups are not available", kind)
+	}
+	return source, nil
+}
+
+func (m *Manager) Start() error {
+	m.startOnce.Do(func() {
+		switch {
+		case m.db == nil:
+			m.startErr = errors.New("remote backup database is not initialized")
+		case m.workRoot == "" || m.workRoot == "." || m.workRoot == string(filepath.Separator):
+			m.startErr = errors.New("remote backup work directory is invalid")
+		}
+		if m.startErr != nil {
+			return
+		}
+		if err := os.MkdirAll(m.workRoot, 0700); err != nil {
+			m.startErr = fmt.Errorf("create remote backup work directory: %w", err)
+			return
+		}
+		// Transfers cut off by a restart continue from their checkpoint.
+		if err := m.db.Model(&models.RemoteBackupTransfer{}).
+			Where("status = ?", models.RemoteBackupTransferRunning).
+			Update("status", models.RemoteBackupTransferQueued).Error; err != nil {
+			m.startErr = fmt.Errorf("reconcile interrupted remote backup transfers: %w", err)
+			return
+		}
+		for i := 0; i < defaultWorkerSize; i++ {
+			go m.worker()
+		}
+		m.requeue(0)
+	})
+	return m.startErr
+}
+
+func (m *Manager) Stop(ctx context.Context) error {
+	if !m.stopping.CompareAndSwap(false, true) {
+		return nil
+	}
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+	m.cancelMu.Lock()
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	m.cancelMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.runWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) ListTargets() ([]models.RemoteBackupTarget, error) {
+	var targets []models.RemoteBackupTarget
+	err := m.db.Order("name ASC").Find(&targets).Error
+	return targets, err
+}
+
+func (m *Manager) GetTarget(id int64) (*models.RemoteBackupTarget, error) {
+	var target models.RemoteBackupTarget
+	if err := m.db.First(&target, id).Error; err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func (m *Manager) CreateTarget(input TargetInput) (*models.RemoteBackupTarget, error) {
+	target := &models.RemoteBackupTarget{}
+	if err := applyTargetInput(target, input, ""); err != nil {
+		return nil, err
+	}
+	if err := m.db.Create(target).Error; err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// UpdateTarget keeps the stored secret when input.Secret is empty and the
+// driver is unchanged.
+func (m *Manager) UpdateTarget(id int64, input TargetInput) (*models.RemoteBackupTarget, error) {
+	target, err := m.GetTarget(id)
+	if err != nil {
+		return nil, err
+	}
+	existing := ""
+	if input.Secret == "" && (input.Driver == "" || input.Driver == target.Driver) && target.SecretEncrypted != "" {
+		if existing, err = utils.DecryptCredential(target.SecretEncrypted, utils.CredentialPurposeRemoteBackup); err != nil {
+			return nil, err
+		}
+	}
+	if input.Driver == "" {
+		input.Driver = target.Driver
+	}
+	if err := applyTargetInput(target, input, existing); err != nil {
+		return nil, err
+	}
+	if err := m.db.Save(target).Error; err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// DeleteTarget removes a target and its transfer history. Remote objects are
+// left in place.
+func (m *Manager) DeleteTarget(id int64) error {
+	var active int64
+	if err := m.db.Model(&models.RemoteBackupTransfer{}).
+		Where("target_id = ? AND status IN ?", id, activeTransferStatuses()).
+		Count(&active).Error; err != nil {
+		return err
+	}
+	if active > 0 {
+		return errors.New("remote backup target has active transfers")
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.RemoteBackupTarget{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("target_id = ?", id).Delete(&models.RemoteBackupTransfer{}).Error
+	})
+}
+
+// TestTarget writes, reads back and deletes a small object to prove the
+// credentials and permissions work.
+func (m *Manager) TestTarget(ctx context.Context, id int64) error {
+	target, err := m.GetTarget(id)
+	if err != nil {
+		return err
+	}
+	config, err := decryptTarget(target)
+	if err != nil {
+		return err
+	}
+	driver, err := openDriver(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+	content := []byte("oneinstack remote backup probe " + uuid.NewString())
+	key := ".oneinstack-probe/" + uuid.NewString()
+	if err := driver.Upload(ctx, key, bytes.NewReader(content), int64(len(content)), Checkpoint{},
+		func(Checkpoint) error { return nil }); err != nil {
+		return fmt.Errorf("write probe object: %w", err)
+	}
+	var read bytes.Buffer
+	downloadErr := driver.Download(ctx, key, &read)
+	deleteErr := driver.Delete(ctx, key)
+	if downloadErr != nil {
+		return fmt.Errorf("read probe object: %w", downloadErr)
+	}
+	if !bytes.Equal(read.Bytes(), content) {
+		return errors.New("probe object was read back with different content")
+	}
+	if deleteErr != nil {
+		return fmt.Errorf("delete probe object: %w", deleteErr)
+	}
+	return nil
+}
+
+func (m *Manager) ListTransfers(targetID int64, page, pageSize int) (*TransferList, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	query := m.db.Model(&models.RemoteBackupTransfer{})
+	if targetID > 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var transfers []models.RemoteBackupTransfer
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	return &TransferList{Data: transfers, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// SubmitUpload queues a copy of a local backup. An upload of the same backup
+// that is still queued or running is returned instead of a new one, and a
+// failed one is retried from its checkpoint.
+func (m *Manager) SubmitUpload(
+	targetID int64,
+	kind, backupID string,
+	requestedBy int64,
+) (*models.RemoteBackupTransfer, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	target, err := m.enabledTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	if !targetHandles(target, kind) {
+		return nil, fmt.Errorf("remote backup target does not accept %s backups", kind)
+	}
+	source, err := m.source(kind)
+	if err != nil {
+		return nil, err
+	}
+	file, backup, err := source.Open(strings.TrimSpace(backupID))
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	transfer, _, err := m.enqueueUpload(target, kind, backup, requestedBy, false)
+	return transfer, err
+}
+
+func (m *Manager) enqueueUpload(
+	target *models.RemoteBackupTarget,
+	kind string,
+	backup LocalBackup,
+	requestedBy int64,
+	automatic bool,
+) (*models.RemoteBackupTransfer, bool, error) {
+	if m.stopping.Load() {
+		return nil, false, errors.New("remote backup manager is stopping")
+	}
+	m.submitMu.Lock()
+	defer m.submitMu.Unlock()
+	var existing models.RemoteBackupTransfer
+	err := m.db.Where("target_id = ? AND operation = ? AND kind = ? AND backup_id = ?",
+		target.ID, models.RemoteBackupTransferUpload, kind, backup.ID).
+		Order("created_at DESC").First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return nil, false, err
+	case existing.Status == models.RemoteBackupTransferQueued ||
+		existing.Status == models.RemoteBackupTransferRunning:
+		return &existing, false, nil
+	case existing.Status == models.RemoteBackupTransferSucceeded && automatic:
+		return &existing, false, nil
+	case existing.Status == models.RemoteBackupTransferFailed:
+		if automatic && existing.Attempts >= maxUploadAttempts {
+			return &existing, false, nil
+		}
+		existing.Status = models.RemoteBackupTransferQueued
+		existing.Error = ""
+		existing.FinishedAt = nil
+		if !automatic {
+			existing.Attempts = 0
+		}
+		if err := m.db.Save(&existing).Error; err != nil {
+			return nil, false, err
+		}
+		m.enqueue(existing.ID)
+		return &existing, true, nil
+	}
+	now := m.now().UTC()
+	transfer := &models.RemoteBackupTransfer{
+		ID: uuid.NewString(), TargetID: target.ID,
+		Operation: models.RemoteBackupTransferUpload, Kind: kind, BackupID: backup.ID,
+		ObjectKey: objectKey(kind, backup), SizeBytes: backup.SizeBytes, SHA256: backup.SHA256,
+		Status: models.RemoteBackupTransferQueued, RequestedBy: requestedBy,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if err := m.db.Create(transfer).Error; err != nil {
+		return nil, false, err
+	}
+	m.enqueue(transfer.ID)
+	return transfer, true, nil
+}
+
+// ListRemote reads the manifests on a target. Objects without a manifest,
+// such as unfinished uploads, are not listed.
+func (m *Manager) ListRemote(ctx context.Context, targetID int64) ([]RemoteBackup, error) {
+	target, err := m.GetTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := decryptTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := openDriver(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer driver.Close()
+	objects, err := driver.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		present[object.Key] = true
+	}
+	backups := make([]RemoteBackup, 0)
+	for _, object := range objects {
+		key := strings.TrimSuffix(object.Key, manifestSuffix)
+		if key == object.Key || !present[key] || !validObjectKey(key) {
+			continue
+		}
+		manifest, err := readManifest(ctx, driver, key)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, RemoteBackup{Key: key, Manifest: *manifest})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// RestoreFromRemote queues a download of a remote backup. Once verified it
+// is imported as a local backup, which is then restored through the usual
+// restore flow and its approvals.
+func (m *Manager) RestoreFromRemote(
+	targetID int64,
+	input RestoreInput,
+	requestedBy int64,
+) (*models.RemoteBackupTransfer, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	if m.stopping.Load() {
+		return nil, errors.New("remote backup manager is stopping")
+	}
+	target, err := m.enabledTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.Trim(strings.TrimSpace(input.Key), "/")
+	if !validObjectKey(key) || strings.HasSuffix(key, manifestSuffix) {
+		return nil, errors.New("invalid remote backup key")
+	}
+	kind, _, _ := strings.Cut(key, "/")
+	if _, err := m.source(kind); err != nil {
+		return nil, err
+	}
+	transfer := &models.RemoteBackupTransfer{
+		ID: uuid.NewString(), TargetID: target.ID,
+		Operation: models.RemoteBackupTransferDownload, Kind: kind, ObjectKey: key,
+		Status: models.RemoteBackupTransferQueued, RequestedBy: requestedBy,
+	}
+	switch kind {
+	case models.RemoteBackupKindDatabase:
+		if input.LibraryID <= 0 {
+			return nil, errors.New("target database is required")
+		}
+		transfer.ImportLibraryID = input.LibraryID
+	case models.RemoteBackupKindWebsite:
+		if input.WebsiteID <= 0 {
+			return nil, errors.New("target website is required")
+		}
+		transfer.ImportWebsiteID = input.WebsiteID
+	case models.RemoteBackupKindPanel:
+		if input.Passphrase == "" {
+			return nil, errors.New("backup passphrase is required")
+		}
+		encrypted, err := utils.EncryptCredential(input.Passphrase, passphrasePurpose(transfer.ID))
+		if err != nil {
+			return nil, err
+		}
+		transfer.PassphraseEncrypted = encrypted
+	}
+	now := m.now().UTC()
+	transfer.CreatedAt, transfer.UpdatedAt = now, now
+	if err := m.db.Create(transfer).Error; err != nil {
+		return nil, err
+	}
+	m.enqueue(transfer.ID)
+	return transfer, nil
+}
+
+// SyncTarget queues automatic uploads of local backups that have no remote
+// copy yet and removes remote backups older than the target's retention. The
+// newest remote backup of every database, website and the panel is kept.
+func (m *Manager) SyncTarget(ctx context.Context, targetID int64) (*SyncResult, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	target, err := m.enabledTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{Targets: 1}
+	syncErr := m.syncTarget(ctx, target, result)
+	updates := map[string]any{"last_sync_at": m.now().UTC(), "last_error": ""}
+	if syncErr != nil {
+		updates["last_error"] = truncate(syncErr.Error(), 1024)
+	}
+	if err := m.db.Model(&models.RemoteBackupTarget{}).Where("id = ?", target.ID).
+		Updates(updates).Error; err != nil && syncErr == nil {
+		syncErr = err
+	}
+	return result, syncErr
+}
+
+// SyncAll syncs every enabled target. A failing target does not stop the
+// others; the errors are joined.
+func (m *Manager) SyncAll(ctx context.Context) (*SyncResult, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	var targets []models.RemoteBackupTarget
+	if err := m.db.Select("id").Where("enabled = ?", true).Order("id ASC").Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	result := &SyncResult{}
+	var failures []error
+	for _, target := range targets {
+		synced, err := m.SyncTarget(ctx, target.ID)
+		if synced != nil {
+			result.Targets += synced.Targets
+			result.Queued += synced.Queued
+			result.Deleted += synced.Deleted
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("target %d: %w", target.ID, err))
+		}
+	}
+	m.requeue(0)
+	return result, errors.Join(failures...)
+}
+
+func (m *Manager) syncTarget(ctx context.Context, target *models.RemoteBackupTarget, result *SyncResult) error {
+	var cutoff time.Time
+	if target.RetentionDays > 0 {
+		cutoff = m.now().UTC().AddDate(0, 0, -target.RetentionDays)
+	}
+	var failures []error
+	if target.AutoUpload {
+		for _, kind := range strings.Split(target.Kinds, ",") {
+			source, err := m.source(kind)
+			if err != nil {
+				continue
+			}
+			backups, err := source.List()
+			if err != nil {
+				failures = append(failures, fmt.Errorf("list %s backups: %w", kind, err))
+				continue
+			}
+			for _, backup := range backups {
+				if !cutoff.IsZero() && backup.CreatedAt.Before(cutoff) {
+					continue
+				}
+				_, queued, err := m.enqueueUpload(target, kind, backup, 0, true)
+				if err != nil {
+					failures = append(failures, err)
+					continue
+				}
+				if queued {
+					result.Queued++
+				}
+			}
+		}
+	}
+	m.requeue(target.ID)
+	if !cutoff.IsZero() {
+		deleted, err := m.applyRetention(ctx, target, cutoff)
+		result.Deleted += deleted
+		if err != nil {
+			failures = append(failures, fmt.Errorf("apply remote retention: %w", err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// applyRetention deletes expired backups but keeps the newest of each group.
+// The target may hold files of other tools or Panels, so only objects named
+// by objectKey that have a manifest describing the same key are deleted.
+func (m *Manager) applyRetention(ctx context.Context, target *models.RemoteBackupTarget, cutoff time.Time) (int, error) {
+	config, err := decryptTarget(target)
+	if err != nil {
+		return 0, err
+	}
+	driver, err := openDriver(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer driver.Close()
+	objects, err := driver.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	present := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		present[object.Key] = true
+	}
+	type entry struct {
+		key     string
+		created time.Time
+	}
+	groups := map[string][]entry{}
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, manifestSuffix) || !present[object.Key+manifestSuffix] {
+			continue
+		}
+		parts := strings.Split(object.Key, "/")
+		if len(parts) != 3 || !knownKind(parts[0]) {
+			continue
+		}
+		created, ok := keyCreatedAt(parts[2])
+		if !ok {
+			continue
+		}
+		group := parts[0] + "/" + parts[1]
+		groups[group] = append(groups[group], entry{key: object.Key, created: created})
+	}
+	deleted := 0
+	var failures []error
+	for _, entries := range groups {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].created.After(entries[j].created)
+		})
+		for _, entry := range entries[1:] {
+			if !entry.created.Before(cutoff) {
+				continue
+			}
+			manifest, err := readManifest(ctx, driver, entry.key)
+			if err != nil || manifestKey(manifest) != entry.key {
+				continue
+			}
+			if err := driver.Delete(ctx, entry.key); err != nil {
+				failures = append(failures, err)
+				continue
+			}
+			if err := driver.Delete(ctx, entry.key+manifestSuffix); err != nil {
+				failures = append(failures, err)
+			}
+			deleted++
+		}
+	}
+	return deleted, errors.Join(failures...)
+}
+
+// requeue hands queued transfers to the workers, for example after a restart
+// or when the queue was full. targetID 0 requeues every target.
+func (m *Manager) requeue(targetID int64) {
+	query := m.db.Model(&models.RemoteBackupTransfer{}).
+		Where("status = ?", models.RemoteBackupTransferQueued)
+	if targetID > 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+	var ids []string
+	if err := query.Order("created_at ASC").Limit(defaultQueueSize).Pluck("id", &ids).Error; err != nil {
+		return
+	}
+	for _, id := range ids {
+		m.enqueue(id)
+	}
+}
+
+// enqueue hands a queued transfer to the workers once. When the queue is
+// full the transfer stays queued and a later sync picks it up.
+func (m *Manager) enqueue(id string) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	if _, ok := m.pending[id]; ok || m.stopping.Load() {
+		return
+	}
+	select {
+	case m.queue <- id:
+		m.pending[id] = struct{}{}
+	default:
+	}
+}
+
+func (m *Manager) worker() {
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case id := <-m.queue:
+			if m.stopping.Load() {
+				return
+			}
+			m.runWG.Add(1)
+			m.run(id)
+			m.runWG.Done()
+			m.pendingMu.Lock()
+			delete(m.pending, id)
+			m.pendingMu.Unlock()
+		}
+	}
+}
+
+func (m *Manager) run(id string) {
+	var transfer models.RemoteBackupTransfer
+	if err := m.db.First(&transfer, "id = ?", id).Error; err != nil {
+		return
+	}
+	if transfer.Status != models.RemoteBackupTransferQueued {
+		return
+	}
+	transfer.Attempts++
+	if err := m.db.Model(&transfer).Updates(map[string]any{
+		"status": models.RemoteBackupTransferRunning, "attempts": transfer.Attempts,
+		"error": "", "updated_at": m.now().UTC(),
+	}).Error; err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelMu.Lock()
+	m.cancels[transfer.ID] = cancel
+	m.cancelMu.Unlock()
+	defer func() {
+		m.cancelMu.Lock()
+		delete(m.cancels, transfer.ID)
+		m.cancelMu.Unlock()
+		cancel()
+	}()
+
+	var err error
+	if transfer.Operation == models.RemoteBackupTransferDownload {
+		err = m.runDownload(ctx, &transfer)
+	} else {
+		err = m.runUpload(ctx, &transfer)
+	}
+	now := m.now().UTC()
+	updates := map[string]any{"updated_at": now}
+	switch {
+	case err == nil:
+		updates["status"] = models.RemoteBackupTransferSucceeded
+		updates["resume_token"] = ""
+		updates["passphrase_encrypted"] = ""
+		updates["finished_at"] = now
+	case m.stopping.Load():
+		// Resume after the restart.
+		updates["status"] = models.RemoteBackupTransferQueued
+	default:
+		updates["status"] = models.RemoteBackupTransferFailed
+		updates["error"] = truncate(err.Error(), 1024)
+		updates["passphrase_encrypted"] = ""
+		updates["finished_at"] = now
+	}
+	_ = m.db.Model(&models.RemoteBackupTransfer{}).Where("id = ?", transfer.ID).Updates(updates).Error
+	if err != nil && !m.stopping.Load() {
+		_ = m.db.Model(&models.RemoteBackupTarget{}).Where("id = ?", transfer.TargetID).
+			Update("last_error", truncate(err.Error(), 1024)).Error
+	}
+}
+
+func (m *Manager) runUpload(ctx context.Context, transfer *models.RemoteBackupTransfer) error {
+	target, err := m.enabledTarget(transfer.TargetID)
+	if err != nil {
+		return err
+	}
+	source, err := m.source(transfer.Kind)
+	if err != nil {
+		return err
+	}
+	file, backup, err := source.Open(transfer.BackupID)
+	if err != nil {
+		return fmt.Errorf("open local backup: %w", err)
+	}
+	defer file.Close()
+	checkpoint := Checkpoint{Token: transfer.ResumeToken, Uploaded: transfer.Transferred}
+	if backup.SizeBytes != transfer.SizeBytes || !strings.EqualFold(backup.SHA256, transfer.SHA256) {
+		return errors.New("local backup changed since the upload was queued")
+	}
+	config, err := decryptTarget(target)
+	if err != nil {
+		return err
+	}
+	driver, err := openDriver(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+	save := func(checkpoint Checkpoint) error {
+		return m.db.Model(&models.RemoteBackupTransfer{}).Where("id = ?", transfer.ID).
+			Updates(map[string]any{
+				"resume_token": checkpoint.Token, "transferred": checkpoint.Uploaded,
+				"updated_at": m.now().UTC(),
+			}).Error
+	}
+	if err := driver.Upload(ctx, transfer.ObjectKey, file, backup.SizeBytes, checkpoint, save); err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(backup.Metadata)
+	if err != nil {
+		return err
+	}
+	manifest, err := json.MarshalIndent(Manifest{
+		Kind: transfer.Kind, BackupID: backup.ID, Group: backup.Group, FileName: backup.FileName,
+		SizeBytes: backup.SizeBytes, SHA256: backup.SHA256, CreatedAt: backup.CreatedAt.UTC(),
+		UploadedAt: m.now().UTC(), Metadata: metadata,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The manifest goes last, so a listed backup is always complete.
+	return driver.Upload(ctx, transfer.ObjectKey+manifestSuffix, bytes.NewReader(manifest),
+		int64(len(manifest)), Checkpoint{}, func(Checkpoint) error { return nil })
+}
+
+func (m *Manager) runDownload(ctx context.Context, transfer *models.RemoteBackupTransfer) error {
+	target, err := m.enabledTarget(transfer.TargetID)
+	if err != nil {
+		return err
+	}
+	source, err := m.source(transfer.Kind)
+	if err != nil {
+		return err
+	}
+	config, err := decryptTarget(target)
+	if err != nil {
+		return err
+	}
+	driver, err := openDriver(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+	manifest, err := readManifest(ctx, driver, transfer.ObjectKey)
+	if err != nil {
+		return err
+	}
+	if manifest.Kind != transfer.Kind {
+		return errors.New("remote backup manifest does not match its location")
+	}
+	if err := m.db.Model(&models.RemoteBackupTransfer{}).Where("id = ?", transfer.ID).
+		Updates(map[string]any{"size_bytes": manifest.SizeBytes, "sha256": manifest.SHA256}).Error; err != nil {
+		return err
+	}
+
+	if err := m.checkWorkSpace(manifest.SizeBytes); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(m.workRoot, "download-*.partial")
+	if err != nil {
+		return err
+	}
+	temporaryPath := file.Name()
+	defer os.Remove(temporaryPath)
+	hash := sha256.New()
+	counter := &countingWriter{limit: manifest.SizeBytes}
+	err = driver.Download(ctx, transfer.ObjectKey, io.MultiWriter(file, hash, counter))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if counter.count != manifest.SizeBytes || !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), manifest.SHA256) {
+		return errors.New("downloaded backup failed the integrity check")
+	}
+	_ = m.db.Model(&models.RemoteBackupTransfer{}).Where("id = ?", transfer.ID).
+		Update("transferred", counter.count).Error
+
+	request := ImportRequest{
+		Path: temporaryPath, Manifest: *manifest,
+		LibraryID: transfer.ImportLibraryID, WebsiteID: transfer.ImportWebsiteID,
+		RequestedBy: transfer.RequestedBy,
+	}
+	if transfer.PassphraseEncrypted != "" {
+		passphrase, err := utils.DecryptCredential(transfer.PassphraseEncrypted, passphrasePurpose(transfer.ID))
+		if err != nil {
+			return err
+		}
+		request.Passphrase = passphrase
+	}
+	backupID, err := source.Import(ctx, request)
+	if err != nil {
+		return fmt.Errorf("import downloaded backup: %w", err)
+	}
+	return m.db.Model(&models.RemoteBackupTransfer{}).Where("id = ?", transfer.ID).
+		Update("backup_id", backupID).Error
+}
+
+// checkWorkSpace refuses a download that would not fit in the work
+// directory, keeping a small headroom for the rest of the panel.
+func (m *Manager) checkWorkSpace(size int64) error {
+	usage, err := disk.Usage(m.workRoot)
+	if err != nil {
+		return fmt.Errorf("read remote backup work disk capacity: %w", err)
+	}
+	const headroom = uint64(1 << 20)
+	if uint64(size) > ^uint64(0)-headroom || usage.Free <= uint64(size)+headroom {
+		return fmt.Errorf(
+			"insufficient disk space to download remote backup: available %d bytes, required %d bytes",
+			usage.Free, size,
+		)
+	}
+	return nil
+}
+
+func (m *Manager) enabledTarget(id int64) (*models.RemoteBackupTarget, error) {
+	target, err := m.GetTarget(id)
+	if err != nil {
+		return nil, err
+	}
+	if !target.Enabled {
+		return nil, errors.New("remote backup target is disabled")
+	}
+	return target, nil
+}
+
+func readManifest(ctx context.Context, driver Driver, key string) (*Manifest, error) {
+	var buffer limitedBuffer
+	if err := driver.Download(ctx, key+manifestSuffix, &buffer); err != nil {
+		return nil, fmt.Errorf("read remote backup manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(buffer.Bytes(), &manifest); err != nil {
+		return nil, fmt.Errorf("decode remote backup manifest: %w", err)
+	}
+	if !knownKind(manifest.Kind) || manifest.SizeBytes < 0 || len(manifest.SHA256) != 64 {
+		return nil, errors.New("remote backup manifest is invalid")
+	}
+	if _, err := hex.DecodeString(manifest.SHA256); err != nil {
+		return nil, errors.New("remote backup manifest is invalid")
+	}
+	return &manifest, nil
+}
+
+func applyTargetInput(target *models.RemoteBackupTarget, input TargetInput, existingSecret string) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > 120 {
+		return errors.New("target name must contain 1 to 120 characters")
+	}
+	basePath := strings.Trim(strings.TrimSpace(input.BasePath), "/")
+	if basePath != "" && !validObjectKey(basePath) {
+		return errors.New("target base path is invalid")
+	}
+	kinds, err := normalizeKinds(input.Kinds)
+	if err != nil {
+		return err
+	}
+	if input.RetentionDays < 0 || input.RetentionDays > maxRetentionDays {
+		return fmt.Errorf("retention must be between 0 and %d days", maxRetentionDays)
+	}
+	secret := input.Secret
+	if secret == "" {
+		secret = existingSecret
+	}
+	config := &targetConfig{
+		RemoteBackupTarget: models.RemoteBackupTarget{
+			Driver: input.Driver, Endpoint: strings.TrimSpace(input.Endpoint),
+			Region: strings.TrimSpace(input.Region), Bucket: strings.TrimSpace(input.Bucket),
+			Username: strings.TrimSpace(input.Username), HostKey: strings.TrimSpace(input.HostKey),
+			BasePath: basePath,
+		},
+		Secret: secret,
+	}
+	switch input.Driver {
+	case models.RemoteBackupDriverS3:
+		_, err = newS3Driver(config)
+	case models.RemoteBackupDriverWebDAV:
+		_, err = newWebDAVDriver(config)
+	case models.RemoteBackupDriverSFTP:
+		switch {
+		case config.Endpoint == "" || config.Username == "" || secret == "":
+			err = errors.New("SFTP host, user name and credential are required")
+		case !strings.HasPrefix(config.HostKey, "SHA256:"):
+			err = errors.New("SFTP host key must be a SHA256 fingerprint")
+		}
+	default:
+		err = errors.New("unsupported remote backup driver")
+	}
+	if err != nil {
+		return err
+	}
+	encrypted := ""
+	if secret != "" {
+		if encrypted, err = utils.EncryptCredential(secret, utils.CredentialPurposeRemoteBackup); err != nil {
+			return err
+		}
+	}
+	target.Name = name
+	target.Driver = config.Driver
+	target.Endpoint = config.Endpoint
+	target.Region = config.Region
+	target.Bucket = config.Bucket
+	target.Username = config.Username
+	target.HostKey = config.HostKey
+	target.BasePath = basePath
+	target.SecretEncrypted = encrypted
+	target.HasSecret = secret != ""
+	target.Kinds = kinds
+	target.AutoUpload = input.AutoUpload
+	target.RetentionDays = input.RetentionDays
+	target.Enabled = input.Enabled
+	return nil
+}
+
+func decryptTarget(target *models.RemoteBackupTarget) (*targetConfig, error) {
+	config := &targetConfig{RemoteBackupTarget: *target}
+	if target.SecretEncrypted != "" {
+		secret, err := utils.DecryptCredential(target.SecretEncrypted, utils.CredentialPurposeRemoteBackup)
+		if err != nil {
+			return nil, err
+		}
+		config.Secret = secret
+	}
+	return config, nil
+}
+
+func normalizeKinds(kinds []string) (string, error) {
+	selected := map[string]bool{}
+	for _, kind := range kinds {
+		kind = strings.TrimSpace(kind)
+		if !knownKind(kind) {
+			return "", fmt.Errorf("unsupported backup kind: %s", kind)
+		}
+		selected[kind] = true
+	}
+	var ordered []string
+	for _, kind := range kindOrder {
+		if selected[kind] {
+			ordered = append(ordered, kind)
+		}
+	}
+	if len(ordered) == 0 {
+		return "", errors.New("select at least one backup kind")
+	}
+	return strings.Join(ordered, ","), nil
+}
+
+func knownKind(kind string) bool {
+	for _, known := range kindOrder {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
+
+func targetHandles(target *models.RemoteBackupTarget, kind string) bool {
+	for _, handled := range strings.Split(target.Kinds, ",") {
+		if handled == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func activeTransferStatuses() []string {
+	return []string{models.RemoteBackupTransferQueued, models.RemoteBackupTransferRunning}
+}
+
+func passphrasePurpose(transferID string) string {
+	return utils.CredentialPurposeRemotePassphrase + ":" + transferID
+}
+
+// objectKey places a backup at <kind>/<group>/<created>_<id><extension>. The
+// creation time in the name lets retention work from a listing alone.
+func objectKey(kind string, backup LocalBackup) string {
+	extension := ""
+	for _, candidate := range objectExtensions {
+		if strings.HasSuffix(backup.FileName, candidate) {
+			extension = candidate
+			break
+		}
+	}
+	return kind + "/" + keySegment(backup.Group) + "/" +
+		backup.CreatedAt.UTC().Format(keyTimeLayout) + "_" + keySegment(backup.ID) + extension
+}
+
+// manifestKey is the object key the backup a manifest describes was
+// uploaded under.
+func manifestKey(manifest *Manifest) string {
+	return objectKey(manifest.Kind, LocalBackup{
+		ID: manifest.BackupID, Group: manifest.Group, FileName: manifest.FileName, CreatedAt: manifest.CreatedAt,
+	})
+}
+
+func keyCreatedAt(name string) (time.Time, bool) {
+	prefix, _, found := strings.Cut(path.Base(name), "_")
+	if !found {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(keyTimeLayout, prefix)
+	return created, err == nil
+}
+
+// keySegment keeps letters, digits, dot, dash and underscore so every driver
+// stores the key unchanged.
+func keySegment(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '-', r == '_', r == '.':
+			builder.WriteRune(r)
+		default:
+			builder.WriteByte('_')
+		}
+	}
+	segment := strings.TrimLeft(builder.String(), ".")
+	if len(segment) > 96 {
+		segment = segment[:96]
+	}
+	if segment == "" {
+		return "_"
+	}
+	return segment
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
+
+// countingWriter counts a download and stops it once it grows past the
+// size its manifest announced.
+type countingWriter struct {
+	count int64
+	limit int64
+}
+
+func (w *countingWriter) Write(content []byte) (int, error) {
+	w.count += int64(len(content))
+	if w.count > w.limit {
+		return 0, errors.New("downloaded backup is larger than its manifest")
+	}
+	return len(content), nil
+}
+
+// limitedBuffer refuses manifests larger than maxManifestBytes.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(content []byte) (int, error) {
+	if b.Len()+len(content) > maxManifestBytes {
+		return 0, errors.New("remote backup manifest is too large")
+	}
+	return b.Buffer.Write(content)
+}
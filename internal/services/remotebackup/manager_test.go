@@ -0,0 +1,565 @@
+package remotebackup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/utils"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestS3UploadResumesAndRestoresFromRemote(t *testing.T) {
+	manager, source, storage := newS3TestManager(t)
+	previousPartSize := s3PartSize
+	s3PartSize = 64
+	t.Cleanup(func() { s3PartSize = previousPartSize })
+
+	for _, input := range []TargetInput{
+		{Name: "no secret", Driver: models.RemoteBackupDriverS3, Endpoint: storage.server.URL,
+			Bucket: "backups", Username: "minio", Kinds: []string{"database"}},
+		{Name: "bad kind", Driver: models.RemoteBackupDriverS3, Endpoint: storage.server.URL,
+			Bucket: "backups", Username: "minio", Secret: "minio-secret", Kinds: []string{"mail"}},
+		{Name: "unpinned", Driver: models.RemoteBackupDriverSFTP, Endpoint: "backup.example.com",
+			Username: "backup", Secret: "password", Kinds: []string{"database"}},
+		{Name: "escape", Driver: models.RemoteBackupDriverWebDAV, Endpoint: "https://dav.example.com",
+			BasePath: "../etc", Kinds: []string{"database"}},
+	} {
+		if _, err := manager.CreateTarget(input); err == nil {
+			t.Fatalf("invalid target was accepted: %+v", input)
+		}
+	}
+	target, err := manager.CreateTarget(TargetInput{
+		Name: "minio", Driver: models.RemoteBackupDriverS3, Endpoint: storage.server.URL,
+		Bucket: "backups", Username: "minio", Secret: "minio-secret", BasePath: "/panel-a/",
+		Kinds: []string{"database"}, Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := json.Marshal(target)
+	if !target.HasSecret || strings.Contains(string(encoded), "minio-secret") ||
+		strings.Contains(target.SecretEncrypted, "minio-secret") {
+		t.Fatalf("target secret was not protected: %s", encoded)
+	}
+	// An update without a secret keeps the stored one.
+	if target, err = manager.UpdateTarget(target.ID, TargetInput{
+		Name: "minio", Endpoint: storage.server.URL, Bucket: "backups", Username: "minio",
+		BasePath: "panel-a", Kinds: []string{"database"}, Enabled: true,
+	}); err != nil || target.Driver != models.RemoteBackupDriverS3 {
+		t.Fatalf("update failed: %+v %v", target, err)
+	}
+	if err := manager.TestTarget(context.Background(), target.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 14) // 224 bytes, four parts
+	backup := source.add(t, "a1b2c3d4-0000-4000-8000-000000000001", content, time.Now().Add(-time.Hour))
+
+	storage.failPart(3)
+	transfer, err := manager.SubmitUpload(target.ID, models.RemoteBackupKindDatabase, backup.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := waitForTransfer(t, manager, transfer.ID)
+	if failed.Status != models.RemoteBackupTransferFailed || failed.Transferred != 128 || failed.ResumeToken == "" {
+		t.Fatalf("interrupted upload did not keep its checkpoint: %+v", failed)
+	}
+	if transfer, err = manager.SubmitUpload(target.ID, models.RemoteBackupKindDatabase, backup.ID, 1); err != nil ||
+		transfer.ID != failed.ID {
+		t.Fatalf("failed upload was not resumed: %+v %v", transfer, err)
+	}
+	if done := waitForTransfer(t, manager, transfer.ID); done.Status != models.RemoteBackupTransferSucceeded {
+		t.Fatalf("resumed upload failed: %+v", done)
+	}
+	if got := storage.partUploads("panel-a/" + transfer.ObjectKey); got != "1:1 2:1 3:2 4:1" {
+		t.Fatalf("uploaded parts were sent again: %s", got)
+	}
+	if stored := storage.object("panel-a/" + transfer.ObjectKey); !bytes.Equal(stored, content) {
+		t.Fatalf("remote object differs: %q", stored)
+	}
+	if !strings.HasPrefix(transfer.ObjectKey, "database/11-appdb/") || !strings.HasSuffix(transfer.ObjectKey, ".sql.gz") {
+		t.Fatalf("unexpected object key %s", transfer.ObjectKey)
+	}
+
+	remote, err := manager.ListRemote(context.Background(), target.ID)
+	if err != nil || len(remote) != 1 || remote[0].Key != transfer.ObjectKey ||
+		remote[0].SHA256 != backup.SHA256 || remote[0].FileName != "appdb.sql.gz" {
+		t.Fatalf("unexpected remote listing: %+v %v", remote, err)
+	}
+
+	download, err := manager.RestoreFromRemote(target.ID, RestoreInput{Key: remote[0].Key, LibraryID: 11}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done := waitForTransfer(t, manager, download.ID); done.Status != models.RemoteBackupTransferSucceeded ||
+		done.BackupID != "imported-1" {
+		t.Fatalf("restore from remote failed: %+v", done)
+	}
+	if imported := source.lastImport(); !bytes.Equal(imported.content, content) ||
+		imported.request.LibraryID != 11 || imported.request.Manifest.BackupID != backup.ID {
+		t.Fatalf("unexpected import: %+v", imported.request)
+	}
+
+	// A manifest announcing more than the work directory can hold is
+	// refused before anything is downloaded.
+	manifestKey := "panel-a/" + transfer.ObjectKey + manifestSuffix
+	original := storage.object(manifestKey)
+	var oversized Manifest
+	if err := json.Unmarshal(original, &oversized); err != nil {
+		t.Fatal(err)
+	}
+	oversized.SizeBytes = 1 << 60
+	encoded, _ = json.Marshal(oversized)
+	storage.put(manifestKey, encoded)
+	if download, err = manager.RestoreFromRemote(target.ID, RestoreInput{Key: remote[0].Key, LibraryID: 11}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if done := waitForTransfer(t, manager, download.ID); done.Status != models.RemoteBackupTransferFailed ||
+		!strings.Contains(done.Error, "disk space") {
+		t.Fatalf("oversized backup was downloaded: %+v", done)
+	}
+	storage.put(manifestKey, original)
+
+	storage.put("panel-a/"+transfer.ObjectKey, []byte("tampered"))
+	if download, err = manager.RestoreFromRemote(target.ID, RestoreInput{Key: remote[0].Key, LibraryID: 11}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if done := waitForTransfer(t, manager, download.ID); done.Status != models.RemoteBackupTransferFailed ||
+		!strings.Contains(done.Error, "integrity") {
+		t.Fatalf("tampered backup was imported: %+v", done)
+	}
+	if _, err := manager.RestoreFromRemote(target.ID, RestoreInput{Key: "../database/x.sql.gz", LibraryID: 11}, 1); err == nil {
+		t.Fatal("escaping key was accepted")
+	}
+}
+
+func TestSyncUploadsNewBackupsAndAppliesRemoteRetention(t *testing.T) {
+	manager, source, storage := newS3TestManager(t)
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+	target, err := manager.CreateTarget(TargetInput{
+		Name: "minio", Driver: models.RemoteBackupDriverS3, Endpoint: storage.server.URL,
+		Bucket: "backups", Username: "minio", Secret: "minio-secret",
+		Kinds: []string{"database", "panel"}, AutoUpload: true, RetentionDays: 7, Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := source.add(t, "a1b2c3d4-0000-4000-8000-000000000002", []byte("recent"), now.Add(-24*time.Hour))
+	source.add(t, "a1b2c3d4-0000-4000-8000-000000000003", []byte("too old"), now.AddDate(0, 0, -30))
+
+	// Remote copies left by earlier runs: an expired one next to a newer copy
+	// of the same database, and an expired one that is the last of its group.
+	var expired Manifest
+	for _, backup := range []LocalBackup{
+		{ID: "old", Group: "11-appdb", CreatedAt: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "new", Group: "11-appdb", CreatedAt: time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)},
+		{ID: "only", Group: "12-shop", CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		key := objectKey(models.RemoteBackupKindDatabase, LocalBackup{
+			ID: backup.ID, Group: backup.Group, FileName: "appdb.sql.gz", CreatedAt: backup.CreatedAt,
+		})
+		manifest := Manifest{
+			Kind: models.RemoteBackupKindDatabase, BackupID: backup.ID, Group: backup.Group,
+			FileName: "appdb.sql.gz", SizeBytes: int64(len(key)), SHA256: strings.Repeat("0", 64),
+			CreatedAt: backup.CreatedAt,
+		}
+		encoded, _ := json.Marshal(manifest)
+		storage.put(key, []byte(key))
+		storage.put(key+manifestSuffix, encoded)
+		if backup.ID == "old" {
+			expired = manifest
+		}
+	}
+	// Expired files of other tools in the same layout are left alone: one
+	// without a manifest and one whose manifest describes another object.
+	storage.put("database/11-appdb/20260201T000000Z_foreign.sql.gz", []byte("foreign"))
+	storage.put("database/11-appdb/20260215T000000Z_copied.sql.gz", []byte("copied"))
+	encoded, _ := json.Marshal(expired)
+	storage.put("database/11-appdb/20260215T000000Z_copied.sql.gz"+manifestSuffix, encoded)
+
+	result, err := manager.SyncTarget(context.Background(), target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Queued != 1 || result.Deleted != 1 {
+		t.Fatalf("unexpected sync result: %+v", result)
+	}
+	if storage.object("database/11-appdb/20260301T000000Z_old.sql.gz") != nil ||
+		storage.object("database/11-appdb/20260301T000000Z_old.sql.gz.json") != nil {
+		t.Fatal("expired remote backup was kept")
+	}
+	if storage.object("database/12-shop/20260101T000000Z_only.sql.gz") == nil {
+		t.Fatal("the last remote backup of a database was deleted")
+	}
+	if storage.object("database/11-appdb/20260201T000000Z_foreign.sql.gz") == nil ||
+		storage.object("database/11-appdb/20260215T000000Z_copied.sql.gz") == nil ||
+		storage.object("database/11-appdb/20260215T000000Z_copied.sql.gz"+manifestSuffix) == nil {
+		t.Fatal("a remote file this Panel did not upload was deleted")
+	}
+	var transfer models.RemoteBackupTransfer
+	if err := manager.db.First(&transfer, "backup_id = ?", recent.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if done := waitForTransfer(t, manager, transfer.ID); done.Status != models.RemoteBackupTransferSucceeded {
+		t.Fatalf("automatic upload failed: %+v", done)
+	}
+	if result, err = manager.SyncTarget(context.Background(), target.ID); err != nil || result.Queued != 0 {
+		t.Fatalf("uploaded backup was queued again: %+v %v", result, err)
+	}
+	stored, err := manager.GetTarget(target.ID)
+	if err != nil || stored.LastSyncAt == nil || stored.LastError != "" {
+		t.Fatalf("sync outcome was not recorded: %+v %v", stored, err)
+	}
+}
+
+func newS3TestManager(t *testing.T) (*Manager, *fakeSource, *fakeS3) {
+	t.Helper()
+	if err := utils.ConfigureCredentialKey(bytes.Repeat([]byte{0x52}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "remote.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(&models.RemoteBackupTarget{}, &models.RemoteBackupTransfer{}); err != nil {
+		t.Fatal(err)
+	}
+	storage := newFakeS3(t, "backups", "minio", "minio-secret")
+	manager := NewManager(database, filepath.Join(t.TempDir(), "work"))
+	source := &fakeSource{root: t.TempDir(), backups: map[string]LocalBackup{}}
+	manager.RegisterSource(models.RemoteBackupKindDatabase, source)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return manager, source, storage
+}
+
+func waitForTransfer(t *testing.T, manager *Manager, id string) models.RemoteBackupTransfer {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var transfer models.RemoteBackupTransfer
+		if err := manager.db.First(&transfer, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if transfer.Status == models.RemoteBackupTransferSucceeded ||
+			transfer.Status == models.RemoteBackupTransferFailed {
+			return transfer
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transfer did not finish: %+v", transfer)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type fakeImport struct {
+	request ImportRequest
+	content []byte
+}
+
+type fakeSource struct {
+	mu      sync.Mutex
+	root    string
+	backups map[string]LocalBackup
+	imports []fakeImport
+}
+
+func (s *fakeSource) add(t *testing.T, id string, content []byte, created time.Time) LocalBackup {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(s.root, id), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	backup := LocalBackup{
+		ID: id, Group: "11-appdb", FileName: "appdb.sql.gz", SizeBytes: int64(len(content)),
+		SHA256: hex.EncodeToString(sum[:]), CreatedAt: created,
+		Metadata: map[string]any{"libraryId": 11},
+	}
+	s.mu.Lock()
+	s.backups[id] = backup
+	s.mu.Unlock()
+	return backup
+}
+
+func (s *fakeSource) List() ([]LocalBackup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var backups []LocalBackup
+	for _, backup := range s.backups {
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+func (s *fakeSource) Open(backupID string) (*os.File, LocalBackup, error) {
+	s.mu.Lock()
+	backup, ok := s.backups[backupID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, LocalBackup{}, os.ErrNotExist
+	}
+	file, err := os.Open(filepath.Join(s.root, backupID))
+	return file, backup, err
+}
+
+func (s *fakeSource) Import(_ context.Context, request ImportRequest) (string, error) {
+	content, err := os.ReadFile(request.Path)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imports = append(s.imports, fakeImport{request: request, content: content})
+	return "imported-" + strconv.Itoa(len(s.imports)), nil
+}
+
+func (s *fakeSource) lastImport() fakeImport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.imports[len(s.imports)-1]
+}
+
+// fakeS3 is an in-memory stand-in for MinIO that checks request credentials
+// and implements the object, listing and multipart calls the driver uses.
+type fakeS3 struct {
+	server    *httptest.Server
+	bucket    string
+	accessKey string
+	secretKey string
+
+	mu        sync.Mutex
+	objects   map[string][]byte
+	uploads   map[string]map[int][]byte
+	keys      map[string]string
+	parts     map[string]map[int]int
+	failingAt int
+}
+
+func newFakeS3(t *testing.T, bucket, accessKey, secretKey string) *fakeS3 {
+	s := &fakeS3{
+		bucket: bucket, accessKey: accessKey, secretKey: secretKey,
+		objects: map[string][]byte{}, uploads: map[string]map[int][]byte{},
+		keys: map[string]string{}, parts: map[string]map[int]int{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *fakeS3) failPart(number int) {
+	s.mu.Lock()
+	s.failingAt = number
+	s.mu.Unlock()
+}
+
+func (s *fakeS3) put(key string, content []byte) {
+	s.mu.Lock()
+	s.objects[key] = content
+	s.mu.Unlock()
+}
+
+func (s *fakeS3) object(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+func (s *fakeS3) partUploads(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var numbers []int
+	for number := range s.parts[key] {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var parts []string
+	for _, number := range numbers {
+		parts = append(parts, fmt.Sprintf("%d:%d", number, s.parts[key][number]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !s.validSignature(r, body) {
+		s.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	query := r.URL.Query()
+	if strings.TrimSuffix(r.URL.Path, "/") == "/"+s.bucket {
+		s.list(w, query)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+s.bucket+"/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(s.uploads)+1)
+		s.uploads[uploadID] = map[int][]byte{}
+		s.keys[uploadID] = key
+		if s.parts[key] == nil {
+			s.parts[key] = map[int]int{}
+		}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts[s.keys[query.Get("uploadId")]][number]++
+		if number == s.failingAt {
+			s.failingAt = 0
+			s.fail(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", "etag-"+strconv.Itoa(number)))
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		fmt.Fprint(w, "<ListPartsResult>")
+		for number, content := range parts {
+			fmt.Fprintf(w, "<Part><PartNumber>%d</PartNumber><ETag>\"etag-%d\"</ETag><Size>%d</Size></Part>",
+				number, number, len(content))
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListPartsResult>")
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var request struct {
+			Parts []struct {
+				Number int    `xml:"PartNumber"`
+				ETag   string `xml:"ETag"`
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &request); err != nil {
+			s.fail(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var content []byte
+		for index, part := range request.Parts {
+			if part.Number != index+1 || strings.Trim(part.ETag, `"`) != "etag-"+strconv.Itoa(part.Number) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+				return
+			}
+			content = append(content, parts[part.Number]...)
+		}
+		s.objects[key] = content
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key></CompleteMultipartUploadResult>",
+			s.bucket, key)
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+	case r.Method == http.MethodGet:
+		content, ok := s.objects[key]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Last-Modified", "Tue, 31 Mar 2026 00:00:00 GMT")
+		w.Header().Set("ETag", `"object"`)
+		w.Write(content)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list pages two keys at a time to exercise continuation tokens.
+func (s *fakeS3) list(w http.ResponseWriter, query map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := ""
+	if values := query["prefix"]; len(values) > 0 {
+		prefix = values[0]
+	}
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start := 0
+	if values := query["continuation-token"]; len(values) > 0 {
+		start, _ = strconv.Atoi(values[0])
+	}
+	end := start + 2
+	if end > len(keys) {
+		end = len(keys)
+	}
+	fmt.Fprint(w, "<ListBucketResult>")
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2026-03-31T00:00:00Z</LastModified></Contents>",
+			key, len(s.objects[key]))
+	}
+	if end < len(keys) {
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+// validSignature checks the parts of a Signature Version 4 request the
+// driver controls: the access key, the region and the signed payload hash.
+// The signature itself is computed by minio-go.
+func (s *fakeS3) validSignature(r *http.Request, body []byte) bool {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	credential := "AWS4-HMAC-SHA256 Credential=" + s.accessKey + "/" + date.Format("20060102") + "/us-east-1/s3/aws4_request,"
+	if !strings.HasPrefix(r.Header.Get("Authorization"), credential) {
+		return false
+	}
+	sum := sha256.Sum256(body)
+	switch r.Header.Get("X-Amz-Content-Sha256") {
+	case hex.EncodeToString(sum[:]):
+		return true
+	case "UNSIGNED-PAYLOAD":
+		return r.Method != http.MethodPut
+	default:
+		return false
+	}
+}
+
+func (s *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
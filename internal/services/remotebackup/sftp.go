@@ -0,0 +1,321 @@
+package remotebackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpCheckpointSize is how much of an upload is written and acknowledged
+// before its checkpoint is saved.
+const sftpCheckpointSize = 8 << 20
+
+// sftpTransport is the byte stream of an "sftp" subsystem.
+type sftpTransport interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// dialSFTP opens the SFTP subsystem of a target. Tests replace it with an
+// in-process server.
+var dialSFTP = func(ctx context.Context, config *targetConfig) (sftpTransport, error) {
+	fingerprint := strings.TrimSpace(config.HostKey)
+	if fingerprint == "" {
+		return nil, errors.New("SFTP host key fingerprint is required")
+	}
+	auth := ssh.Password(config.Secret)
+	if signer, err := ssh.ParsePrivateKey([]byte(config.Secret)); err == nil {
+		auth = ssh.PublicKeys(signer)
+	}
+	clientConfig := &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: pinnedHostKey(fingerprint),
+		Timeout:         15 * time.Second,
+	}
+	address := strings.TrimSpace(config.Endpoint)
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	dialer := net.Dialer{Timeout: clientConfig.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(clientConn, channels, requests)
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("start SFTP subsystem: %w", err)
+	}
+	return &sshSFTPTransport{Reader: stdout, stdin: stdin, session: session, client: client}, nil
+}
+
+// pinnedHostKey accepts only the server key with the configured SHA256
+// fingerprint. The presented fingerprint is reported so a changed key can be
+// verified and pinned again.
+func pinnedHostKey(fingerprint string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if presented := ssh.FingerprintSHA256(key); presented != fingerprint {
+			return fmt.Errorf("SFTP host key mismatch: server presented %s", presented)
+		}
+		return nil
+	}
+}
+
+type sshSFTPTransport struct {
+	io.Reader
+	stdin   io.WriteCloser
+	session *ssh.Session
+	client  *ssh.Client
+}
+
+func (t *sshSFTPTransport) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *sshSFTPTransport) Close() error {
+	t.stdin.Close()
+	t.session.Close()
+	return t.client.Close()
+}
+
+// sftpDriver stores backups through github.com/pkg/sftp over the pinned SSH
+// connection. Uploads go to "<key>.partial" and are renamed into place once
+// complete, so an interrupted upload resumes from its last checkpoint.
+type sftpDriver struct {
+	client   *sftp.Client
+	basePath string
+}
+
+func newSFTPDriver(ctx context.Context, config *targetConfig) (*sftpDriver, error) {
+	if strings.TrimSpace(config.Endpoint) == "" || config.Username == "" || config.Secret == "" {
+		return nil, errors.New("SFTP host, user name and credential are required")
+	}
+	transport, err := dialSFTP(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClientPipe(transport, transport)
+	if err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("SFTP handshake: %w", err)
+	}
+	return &sftpDriver{client: client, basePath: strings.TrimRight(config.BasePath, "/")}, nil
+}
+
+func (d *sftpDriver) Close() error {
+	return d.client.Close()
+}
+
+func (d *sftpDriver) remotePath(key string) string {
+	if d.basePath == "" {
+		return key
+	}
+	return d.basePath + "/" + key
+}
+
+func (d *sftpDriver) Upload(
+	ctx context.Context,
+	key string,
+	source io.ReaderAt,
+	size int64,
+	checkpoint Checkpoint,
+	save func(Checkpoint) error,
+) error {
+	target := d.remotePath(key)
+	partial := target + ".partial"
+	if err := d.mkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+	var offset int64
+	if checkpoint.Uploaded > 0 && checkpoint.Uploaded <= size {
+		// Only the checkpoint is known to be contiguous: writes that were in
+		// flight can leave the partial file longer than it, with holes. A
+		// partial file shorter than the checkpoint lost data on the server.
+		if info, err := d.client.Stat(partial); err == nil {
+			offset = min(checkpoint.Uploaded, info.Size())
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := d.client.OpenFile(partial, flags)
+	if err != nil {
+		return sftpError(err)
+	}
+	if err := d.writeFrom(ctx, file, source, offset, size, save); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return d.rename(partial, target)
+}
+
+// writeFrom sends the upload in sftpCheckpointSize sections. The writes of a
+// section are pipelined and all acknowledged before its checkpoint is saved.
+func (d *sftpDriver) writeFrom(
+	ctx context.Context,
+	file *sftp.File,
+	source io.ReaderAt,
+	offset, size int64,
+	save func(Checkpoint) error,
+) error {
+	if err := file.Chmod(0o600); err != nil {
+		return err
+	}
+	for offset < size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(offset+sftpCheckpointSize, size)
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := file.ReadFromWithConcurrency(io.NewSectionReader(source, offset, end-offset), 0); err != nil {
+			return err
+		}
+		offset = end
+		if err := save(Checkpoint{Uploaded: offset}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *sftpDriver) Download(ctx context.Context, key string, destination io.Writer) error {
+	file, err := d.client.Open(d.remotePath(key))
+	if err != nil {
+		return sftpError(err)
+	}
+	defer file.Close()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err = file.WriteTo(destination)
+	return err
+}
+
+func (d *sftpDriver) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	var walk func(directory string) error
+	walk = func(directory string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := d.client.ReadDir(d.remotePath(directory))
+		if err != nil {
+			return sftpError(err)
+		}
+		for _, entry := range entries {
+			key := entry.Name()
+			if directory != "" {
+				key = directory + "/" + entry.Name()
+			}
+			if entry.IsDir() {
+				if err := walk(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if strings.HasSuffix(entry.Name(), ".partial") {
+				continue
+			}
+			objects = append(objects, Object{Key: key, SizeBytes: entry.Size(), LastModified: entry.ModTime()})
+		}
+		return nil
+	}
+	err := walk(strings.Trim(prefix, "/"))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+func (d *sftpDriver) Delete(_ context.Context, key string) error {
+	return d.remove(d.remotePath(key))
+}
+
+func (d *sftpDriver) remove(name string) error {
+	err := sftpError(d.client.Remove(name))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+// mkdirAll creates the missing directories of a key as 0700.
+func (d *sftpDriver) mkdirAll(directory string) error {
+	if directory == "." || directory == "/" || directory == "" {
+		return nil
+	}
+	if info, err := d.client.Stat(directory); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("SFTP path %s is not a directory", directory)
+		}
+		return nil
+	}
+	if err := d.mkdirAll(path.Dir(directory)); err != nil {
+		return err
+	}
+	if err := d.client.Mkdir(directory); err != nil {
+		// Another upload may have created it in the meantime.
+		if info, statErr := d.client.Stat(directory); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return fmt.Errorf("create SFTP directory %s: %w", directory, err)
+	}
+	return d.client.Chmod(directory, 0o700)
+}
+
+func (d *sftpDriver) rename(from, to string) error {
+	if _, ok := d.client.HasExtension("posix-rename@openssh.com"); ok {
+		return d.client.PosixRename(from, to)
+	}
+	// Plain SFTP v3 rename refuses to replace an existing file.
+	if err := d.remove(to); err != nil {
+		return err
+	}
+	return d.client.Rename(from, to)
+}
+
+// sftpError maps a missing file to ErrObjectNotFound.
+func sftpError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrObjectNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package remotebackup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/internal/services/panelbackup"
+	"oneinstack/internal/services/websitetask"
+)
+
+// LocalBackup is a backup in one of the Panel's local backup stores. Group
+// names the database or website it belongs to; retention always keeps the
+// newest remote copy of every group.
+type LocalBackup struct {
+	ID        string
+	Group     string
+	FileName  string
+	SizeBytes int64
+	SHA256    string
+	CreatedAt time.Time
+	Metadata  any
+}
+
+// ImportRequest turns a downloaded and verified remote copy into a local
+// backup. LibraryID, WebsiteID and Passphrase are only used by the source of
+// the matching kind.
+type ImportRequest struct {
+	Path        string
+	Manifest    Manifest
+	LibraryID   int64
+	WebsiteID   int64
+	Passphrase  string
+	RequestedBy int64
+}
+
+// Source connects a local backup store to remote targets.
+type Source interface {
+	List() ([]LocalBackup, error)
+	Open(backupID string) (*os.File, LocalBackup, error)
+	// Import registers the file as a new local backup and returns its id.
+	Import(ctx context.Context, request ImportRequest) (string, error)
+}
+
+const sourcePageSize = 100
+
+type databaseSource struct {
+	manager *databasetask.Manager
+}
+
+func NewDatabaseSource(manager *databasetask.Manager) Source {
+	return &databaseSource{manager: manager}
+}
+
+func (s *databaseSource) List() ([]LocalBackup, error) {
+	var backups []LocalBackup
+	for page := 1; ; page++ {
+		list, err := s.manager.ListBackups(0, 0, true, page, sourcePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range list.Data {
+			backups = append(backups, databaseLocalBackup(&backup))
+		}
+		if len(list.Data) < sourcePageSize {
+			return backups, nil
+		}
+	}
+}
+
+func (s *databaseSource) Open(backupID string) (*os.File, LocalBackup, error) {
+	file, _, backup, err := s.manager.OpenBackup(backupID)
+	if err != nil {
+		return nil, LocalBackup{}, err
+	}
+	return file, databaseLocalBackup(backup), nil
+}
+
+func (s *databaseSource) Import(_ context.Context, request ImportRequest) (string, error) {
+	if request.LibraryID <= 0 {
+		return "", errors.New("target database is required")
+	}
+	backup, err := s.manager.ImportBackup(request.LibraryID, request.Path, models.DatabaseBackup{
+		FileName: request.Manifest.FileName, SHA256: request.Manifest.SHA256,
+	}, models.DatabaseBackupSourceRemote, request.RequestedBy)
+	if err != nil {
+		return "", err
+	}
+	return backup.ID, nil
+}
+
+func databaseLocalBackup(backup *models.DatabaseBackup) LocalBackup {
+	return LocalBackup{
+		ID: backup.ID, Group: strconv.FormatInt(backup.LibraryID, 10) + "-" + backup.DatabaseName,
+		FileName: backup.FileName, SizeBytes: backup.SizeBytes, SHA256: backup.SHA256,
+		CreatedAt: backup.CreatedAt, Metadata: backup,
+	}
+}
+
+type websiteSource struct {
+	manager *websitetask.Manager
+}
+
+func NewWebsiteSource(manager *websitetask.Manager) Source {
+	return &websiteSource{manager: manager}
+}
+
+func (s *websiteSource) List() ([]LocalBackup, error) {
+	var backups []LocalBackup
+	for page := 1; ; page++ {
+		list, err := s.manager.ListBackups(0, 0, true, page, sourcePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range list.Data {
+			backups = append(backups, websiteLocalBackup(&backup))
+		}
+		if len(list.Data) < sourcePageSize {
+			return backups, nil
+		}
+	}
+}
+
+func (s *websiteSource) Open(backupID string) (*os.File, LocalBackup, error) {
+	file, _, backup, err := s.manager.OpenBackup(backupID)
+	if err != nil {
+		return nil, LocalBackup{}, err
+	}
+	return file, websiteLocalBackup(backup), nil
+}
+
+func (s *websiteSource) Import(_ context.Context, request ImportRequest) (string, error) {
+	if request.WebsiteID <= 0 {
+		return "", errors.New("target website is required")
+	}
+	original := models.WebsiteBackup{FileName: request.Manifest.FileName, SHA256: request.Manifest.SHA256}
+	if metadata, ok := request.Manifest.websiteMetadata(); ok {
+		original.DatabaseID = metadata.DatabaseID
+		original.DatabaseName = metadata.DatabaseName
+	}
+	backup, err := s.manager.ImportBackup(
+		request.WebsiteID, request.Path, original, models.WebsiteBackupSourceRemote, request.RequestedBy,
+	)
+	if err != nil {
+		return "", err
+	}
+	return backup.ID, nil
+}
+
+func websiteLocalBackup(backup *models.WebsiteBackup) LocalBackup {
+	return LocalBackup{
+		ID: backup.ID, Group: strconv.FormatInt(backup.WebsiteID, 10) + "-" + backup.WebsiteName,
+		FileName: backup.FileName, SizeBytes: backup.SizeBytes, SHA256: backup.SHA256,
+		CreatedAt: backup.CreatedAt, Metadata: backup,
+	}
+}
+
+// panelSource uploads the encrypted panel archives as they are; a restore
+// needs the passphrase the archive was created with.
+type panelSource struct {
+	manager *panelbackup.Manager
+}
+
+func NewPanelSource(manager *panelbackup.Manager) Source {
+	return &panelSource{manager: manager}
+}
+
+func (s *panelSource) List() ([]LocalBackup, error) {
+	infos, err := s.manager.List()
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]LocalBackup, 0, len(infos))
+	for _, info := range infos {
+		backups = append(backups, panelLocalBackup(info))
+	}
+	return backups, nil
+}
+
+func (s *panelSource) Open(backupID string) (*os.File, LocalBackup, error) {
+	file, info, err := s.manager.Open(backupID)
+	if err != nil {
+		return nil, LocalBackup{}, err
+	}
+	return file, panelLocalBackup(info), nil
+}
+
+func (s *panelSource) Import(ctx context.Context, request ImportRequest) (string, error) {
+	file, err := os.Open(request.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := s.manager.Import(ctx, file, request.Passphrase)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+func panelLocalBackup(info panelbackup.BackupInfo) LocalBackup {
+	return LocalBackup{
+		ID: info.ID, Group: "panel", FileName: info.FileName,
+		SizeBytes: info.Size, SHA256: info.SHA256, CreatedAt: info.CreatedAt, Metadata: info,
+	}
+}
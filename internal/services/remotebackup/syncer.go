@@ -0,0 +1,66 @@
+package remotebackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Syncer periodically uploads new local backups to the targets that have
+// automatic upload enabled and applies remote retention.
+type Syncer struct {
+	manager   *Manager
+	scheduler *cron.Cron
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewSyncer(manager *Manager, schedule string) (*Syncer, error) {
+	if manager == nil || manager.db == nil {
+		return nil, errors.New("remote backup syncer manager is not configured")
+	}
+	if strings.TrimSpace(schedule) == "" {
+		return nil, errors.New("remote backup sync schedule is empty")
+	}
+	scheduler := cron.New(cron.WithChain(
+		cron.SkipIfStillRunning(cron.DefaultLogger),
+		cron.Recover(cron.DefaultLogger),
+	))
+	syncer := &Syncer{manager: manager, scheduler: scheduler}
+	if _, err := scheduler.AddFunc(schedule, func() {
+		if _, syncErr := manager.SyncAll(context.Background()); syncErr != nil {
+			log.Printf("remote backup sync failed: %v", syncErr)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid remote backup sync schedule: %w", err)
+	}
+	return syncer, nil
+}
+
+func (s *Syncer) Start() {
+	if s != nil {
+		s.startOnce.Do(func() { s.scheduler.Start() })
+	}
+}
+
+func (s *Syncer) Stop(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	var stopped context.Context
+	s.stopOnce.Do(func() { stopped = s.scheduler.Stop() })
+	if stopped == nil {
+		return nil
+	}
+	select {
+	case <-stopped.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,278 @@
+package remotebackup
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// webDAVDriver stores objects on a WebDAV share with basic authentication.
+// WebDAV has no standard partial upload, so an interrupted upload starts
+// again from the beginning.
+type webDAVDriver struct {
+	client   *http.Client
+	root     *url.URL
+	username string
+	password string
+	basePath string
+}
+
+func newWebDAVDriver(config *targetConfig) (*webDAVDriver, error) {
+	root, err := url.Parse(strings.TrimRight(strings.TrimSpace(config.Endpoint), "/"))
+	if err != nil || (root.Scheme != "https" && root.Scheme != "http") || root.Host == "" {
+		return nil, errors.New("WebDAV endpoint must be an http or https URL")
+	}
+	return &webDAVDriver{
+		client: &http.Client{Timeout: 30 * time.Minute},
+		root:   root, username: config.Username, password: config.Secret,
+		basePath: strings.Trim(config.BasePath, "/"),
+	}, nil
+}
+
+func (d *webDAVDriver) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
+
+// url resolves a slash separated path below the base path.
+func (d *webDAVDriver) url(name string, collection bool) string {
+	target := *d.root
+	full := joinRemotePath(d.basePath, name)
+	if collection && full != "" {
+		full += "/"
+	}
+	target.Path = strings.TrimRight(target.Path, "/") + "/" + full
+	target.RawPath = ""
+	return target.String()
+}
+
+func (d *webDAVDriver) Upload(
+	ctx context.Context,
+	key string,
+	source io.ReaderAt,
+	size int64,
+	_ Checkpoint,
+	save func(Checkpoint) error,
+) error {
+	if err := d.makeCollections(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+	body := io.NewSectionReader(source, 0, size)
+	request, err := d.request(ctx, http.MethodPut, d.url(key, false), body)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(source, 0, size)), nil
+	}
+	response, err := d.do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return save(Checkpoint{Uploaded: size})
+}
+
+// makeCollections creates every collection of a directory path below the
+// base path. 405 means the collection already exists.
+func (d *webDAVDriver) makeCollections(ctx context.Context, directory string) error {
+	if directory == "." {
+		directory = ""
+	}
+	full := strings.Trim(joinRemotePath(d.basePath, directory), "/")
+	var current []string
+	for _, segment := range strings.Split(full, "/") {
+		if segment == "" {
+			continue
+		}
+		current = append(current, segment)
+		target := *d.root
+		target.Path = strings.TrimRight(target.Path, "/") + "/" + strings.Join(current, "/") + "/"
+		request, err := d.request(ctx, "MKCOL", target.String(), nil)
+		if err != nil {
+			return err
+		}
+		response, err := d.client.Do(request)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+		response.Body.Close()
+		if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusMethodNotAllowed &&
+			(response.StatusCode < 200 || response.StatusCode >= 300) {
+			return fmt.Errorf("WebDAV MKCOL %s returned %d", strings.Join(current, "/"), response.StatusCode)
+		}
+	}
+	return nil
+}
+
+func (d *webDAVDriver) Download(ctx context.Context, key string, destination io.Writer) error {
+	request, err := d.request(ctx, http.MethodGet, d.url(key, false), nil)
+	if err != nil {
+		return err
+	}
+	response, err := d.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(destination, response.Body)
+	return err
+}
+
+func (d *webDAVDriver) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	var walk func(directory string) error
+	walk = func(directory string) error {
+		entries, err := d.propfind(ctx, directory)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.collection {
+				if err := walk(entry.key); err != nil {
+					return err
+				}
+				continue
+			}
+			objects = append(objects, Object{Key: entry.key, SizeBytes: entry.size, LastModified: entry.modified})
+		}
+		return nil
+	}
+	err := walk(strings.Trim(prefix, "/"))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+type webDAVEntry struct {
+	key        string
+	size       int64
+	modified   time.Time
+	collection bool
+}
+
+// propfind lists the direct members of a collection.
+func (d *webDAVDriver) propfind(ctx context.Context, directory string) ([]webDAVEntry, error) {
+	const body = `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/>` +
+		`<D:getlastmodified/></D:prop></D:propfind>`
+	request, err := d.request(ctx, "PROPFIND", d.url(directory, true), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Depth", "1")
+	request.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	response, err := d.do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var result struct {
+		Responses []struct {
+			Href      string `xml:"DAV: href"`
+			Propstats []struct {
+				Status string `xml:"DAV: status"`
+				Prop   struct {
+					ResourceType struct {
+						Collection *struct{} `xml:"DAV: collection"`
+					} `xml:"DAV: resourcetype"`
+					Length   int64  `xml:"DAV: getcontentlength"`
+					Modified string `xml:"DAV: getlastmodified"`
+				} `xml:"DAV: prop"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 64<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode WebDAV listing: %w", err)
+	}
+
+	rootPath := strings.TrimRight(d.root.Path, "/") + "/"
+	if d.basePath != "" {
+		rootPath += d.basePath + "/"
+	}
+	var entries []webDAVEntry
+	for _, item := range result.Responses {
+		href, err := url.Parse(item.Href)
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(href.Path+"/", rootPath) {
+			continue
+		}
+		// The collection itself is listed alongside its members.
+		key := strings.Trim(strings.TrimPrefix(href.Path, rootPath), "/")
+		if key == "" || key == strings.Trim(directory, "/") || !validObjectKey(key) {
+			continue
+		}
+		entry := webDAVEntry{key: key}
+		for _, propstat := range item.Propstats {
+			if !strings.Contains(propstat.Status, " 200") {
+				continue
+			}
+			entry.collection = entry.collection || propstat.Prop.ResourceType.Collection != nil
+			if propstat.Prop.Length > 0 {
+				entry.size = propstat.Prop.Length
+			}
+			if modified, err := http.ParseTime(propstat.Prop.Modified); err == nil {
+				entry.modified = modified
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (d *webDAVDriver) Delete(ctx context.Context, key string) error {
+	request, err := d.request(ctx, http.MethodDelete, d.url(key, false), nil)
+	if err != nil {
+		return err
+	}
+	response, err := d.do(request)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (d *webDAVDriver) request(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if d.username != "" || d.password != "" {
+		request.SetBasicAuth(d.username, d.password)
+	}
+	return request, nil
+}
+
+// do sends a request and turns error responses into errors. The caller closes
+// the body of a successful response.
+func (d *webDAVDriver) do(request *http.Request) (*http.Response, error) {
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, request.URL.Path)
+	}
+	return nil, fmt.Errorf("WebDAV %s returned %d", request.Method, response.StatusCode)
+}
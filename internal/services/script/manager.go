@@ -1059,17 +1059,20 @@ func (sm *ScriptManager) updateSoftwareInstallInfo(
 	if len(packageVersions) > 0 {
 		packageVersion = strings.TrimSpace(packageVersions[0])
 	}
+	sideBySide := models.SideBySideSoftware(params.Key)
 	if installed {
 		if err := app.DB().Transaction(func(tx *gorm.DB) error {
-			if err := tx.Model(&models.Software{}).
-				Where("`key` = ? AND version <> ?", params.Key, params.Version).
-				Updates(map[string]interface{}{
-					"installed":                 false,
-					"install_version":           "",
-					"installed_package_version": "",
-					"is_update":                 false,
-				}).Error; err != nil {
-				return err
+			if !sideBySide {
+				if err := tx.Model(&models.Software{}).
+					Where("`key` = ? AND version <> ?", params.Key, params.Version).
+					Updates(map[string]interface{}{
+						"installed":                 false,
+						"install_version":           "",
+						"installed_package_version": "",
+						"is_update":                 false,
+					}).Error; err != nil {
+					return err
+				}
 			}
 			return tx.Model(&models.Software{}).
 				Where("`key` = ? AND version = ?", params.Key, params.Version).
@@ -1085,15 +1088,17 @@ func (sm *ScriptManager) updateSoftwareInstallInfo(
 		}
 		return
 	}
-	if err := app.DB().Model(&models.Software{}).
-		Where("`key` = ? AND installed = ?", params.Key, true).
-		Updates(map[string]interface{}{
-			"installed":                 false,
-			"install_version":           "",
-			"installed_package_version": "",
-			"is_update":                 false,
-			"status":                    models.Soft_Status_Default,
-		}).Error; err != nil {
+	query := app.DB().Model(&models.Software{}).Where("`key` = ? AND installed = ?", params.Key, true)
+	if sideBySide && strings.TrimSpace(params.Version) != "" {
+		query = query.Where("version = ?", params.Version)
+	}
+	if err := query.Updates(map[string]interface{}{
+		"installed":                 false,
+		"install_version":           "",
+		"installed_package_version": "",
+		"is_update":                 false,
+		"status":                    models.Soft_Status_Default,
+	}).Error; err != nil {
 		fmt.Printf("Update software install state failed: %v\n", err)
 	}
 }
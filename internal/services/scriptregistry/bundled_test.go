@@ -14,51 +14,63 @@ func TestProductionBundledPackagesValidate(t *testing.T) {
 		"php":       {"8.1", "8.2", "8.3"},
 		"redis":     {"7.4.8"},
 	}
+	packages := map[string][]string{"php": {"1.0.0", "1.1.0"}}
 	for component, softwareVersions := range expected {
 		t.Run(component, func(t *testing.T) {
-			manifest, err := validateDirectory(filepath.Join(root, component, "1.0.0"))
-			if err != nil {
-				t.Fatal(err)
+			versions := packages[component]
+			if versions == nil {
+				versions = []string{"1.0.0"}
 			}
-			if manifest.Component.ID != component {
-				t.Fatalf("component id = %q", manifest.Component.ID)
-			}
-			for _, version := range softwareVersions {
-				if !manifest.supportsSoftwareVersion(version) {
-					t.Fatalf("package does not support %s", version)
-				}
-			}
-			if component == "firewalld" {
-				if manifest.Actions.Status != "" ||
-					manifest.Actions.Start != "" ||
-					manifest.Actions.Stop != "" ||
-					manifest.Actions.Restart != "" {
-					t.Fatalf("firewalld lifecycle is managed by the safe service: %#v", manifest.Actions)
-				}
-				return
-			}
-			if manifest.Actions.Status == "" ||
-				manifest.Actions.Start == "" ||
-				manifest.Actions.Stop == "" ||
-				manifest.Actions.Restart == "" {
-				t.Fatalf("component service actions are incomplete: %#v", manifest.Actions)
-			}
-			if (component == "nginx" || component == "php") && manifest.Actions.Reload == "" {
-				t.Fatalf("%s should support safe reload", component)
-			}
-			if (component == "mysql" || component == "redis") && manifest.Actions.Reload != "" {
-				t.Fatalf("%s must not advertise unsupported reload", component)
-			}
-			if manifest.Actions.ConfigGet == "" || manifest.Actions.ConfigApply == "" {
-				t.Fatalf("%s managed configuration actions are incomplete", component)
-			}
-			if manifest.Timeouts.ConfigGet < 1 || manifest.Timeouts.ConfigApply < 1 {
-				t.Fatalf("%s managed configuration timeouts are incomplete", component)
+			for _, packageVersion := range versions {
+				validateBundledPackage(t, filepath.Join(root, component, packageVersion), component, softwareVersions)
 			}
 		})
 	}
 }
 
+func validateBundledPackage(t *testing.T, directory, component string, softwareVersions []string) {
+	t.Helper()
+	manifest, err := validateDirectory(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Component.ID != component {
+		t.Fatalf("component id = %q", manifest.Component.ID)
+	}
+	for _, version := range softwareVersions {
+		if !manifest.supportsSoftwareVersion(version) {
+			t.Fatalf("package does not support %s", version)
+		}
+	}
+	if component == "firewalld" {
+		if manifest.Actions.Status != "" ||
+			manifest.Actions.Start != "" ||
+			manifest.Actions.Stop != "" ||
+			manifest.Actions.Restart != "" {
+			t.Fatalf("firewalld lifecycle is managed by the safe service: %#v", manifest.Actions)
+		}
+		return
+	}
+	if manifest.Actions.Status == "" ||
+		manifest.Actions.Start == "" ||
+		manifest.Actions.Stop == "" ||
+		manifest.Actions.Restart == "" {
+		t.Fatalf("component service actions are incomplete: %#v", manifest.Actions)
+	}
+	if (component == "nginx" || component == "php") && manifest.Actions.Reload == "" {
+		t.Fatalf("%s should support safe reload", component)
+	}
+	if (component == "mysql" || component == "redis") && manifest.Actions.Reload != "" {
+		t.Fatalf("%s must not advertise unsupported reload", component)
+	}
+	if manifest.Actions.ConfigGet == "" || manifest.Actions.ConfigApply == "" {
+		t.Fatalf("%s managed configuration actions are incomplete", component)
+	}
+	if manifest.Timeouts.ConfigGet < 1 || manifest.Timeouts.ConfigApply < 1 {
+		t.Fatalf("%s managed configuration timeouts are incomplete", component)
+	}
+}
+
 func TestParseManifestRejectsUnknownFields(t *testing.T) {
 	contents := []byte(`schemaVersion: 1
 component:
@@ -12,6 +12,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 var bundledOnlySoftwareKeys = map[string]struct{}{
@@ -56,9 +58,7 @@ func (installer *Installer) install(ctx context.Context, params *input.InstallPa
 	actionName := "install"
 	if app.DB() != nil {
 		var installed int64
-		app.DB().Model(&models.Software{}).
-			Where("`key` = ? AND installed = ?", params.Key, true).
-			Count(&installed)
+		installedForUpgrade(app.DB(), params).Count(&installed)
 		if installed > 0 {
 			actionName = "upgrade"
 		}
@@ -87,9 +87,7 @@ func (installer *Installer) InstallTask(
 	actionName := "install"
 	if app.DB() != nil {
 		var installed int64
-		if err := app.DB().Model(&models.Software{}).
-			Where("`key` = ? AND installed = ?", params.Key, true).
-			Count(&installed).Error; err != nil {
+		if err := installedForUpgrade(app.DB(), params).Count(&installed).Error; err != nil {
 			return "", err
 		}
 		if installed > 0 {
@@ -105,6 +103,17 @@ func (installer *Installer) InstallTask(
 	return installer.scriptManager.ExecuteScriptTask(ctx, scriptInfo, params, logPath, observer)
 }
 
+// installedForUpgrade selects the installations an install of params
+// replaces: any installed version, or the same version for software whose
+// versions install side by side.
+func installedForUpgrade(database *gorm.DB, params *input.InstallParams) *gorm.DB {
+	query := database.Model(&models.Software{}).Where("`key` = ? AND installed = ?", params.Key, true)
+	if models.SideBySideSoftware(params.Key) {
+		query = query.Where("version = ?", params.Version)
+	}
+	return query
+}
+
 // Uninstall 卸载软件
 func (installer *Installer) Uninstall(params *input.RemoveParams, async bool) (string, error) {
 	scriptInfo, installParams, err := installer.getUninstallScript(context.Background(), params)
@@ -12,6 +12,8 @@ import (
 	"os"
 	"slices"
 	"strings"
+
+	"gorm.io/gorm"
 )
 
 var softwareCategoryOrder = []string{
@@ -363,15 +365,20 @@ func Remove(param *input.RemoveParams) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	installed := func() *gorm.DB {
+		query := app.DB().Model(&models.Software{}).Where("`key` = ? AND installed = ?", softwareKey, true)
+		if models.SideBySideSoftware(softwareKey) && strings.TrimSpace(param.Version) != "" {
+			query = query.Where("version = ?", strings.TrimSpace(param.Version))
+		}
+		return query
+	}
 	installer := NewInstaller()
 	logFile, err := installer.Uninstall(param, false)
 	if err != nil {
-		app.DB().Model(&models.Software{}).
-			Where("`key` = ? AND installed = ?", softwareKey, true).
-			Updates(map[string]interface{}{"status": models.Soft_Status_Err, "log": logFile})
+		installed().Updates(map[string]interface{}{"status": models.Soft_Status_Err, "log": logFile})
 		return false, err
 	}
-	tx := app.DB().Model(&models.Software{}).Where("`key` = ? AND installed = ?", softwareKey, true).Updates(map[string]interface{}{
+	tx := installed().Updates(map[string]interface{}{
 		"status":                    models.Soft_Status_Default,
 		"log":                       logFile,
 		"installed":                 false,
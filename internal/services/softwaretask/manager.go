@@ -123,6 +123,14 @@ func (m *Manager) Start() error {
 	return m.startErr
 }
 
+// QueueDepth reports how many accepted tasks are waiting for a worker.
+func (m *Manager) QueueDepth() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.queue)
+}
+
 func (m *Manager) Submit(request InstallRequest, requestedBy int64) (*models.SoftwareTask, error) {
 	request.Operation = "install"
 	return m.submit(request, requestedBy)
@@ -260,9 +268,25 @@ func (m *Manager) submit(request InstallRequest, requestedBy int64) (*models.Sof
 
 	operation := request.Operation
 	var installed models.Software
-	installedResult := m.db.
-		Where("`key` = ? AND installed = ?", request.Key, true).
-		First(&installed)
+	installedQuery := m.db.Where("`key` = ? AND installed = ?", request.Key, true)
+	if models.SideBySideSoftware(request.Key) {
+		// Each version is its own installation; an unversioned runtime or
+		// uninstall request is only unambiguous with a single installation.
+		if request.Version != "" {
+			installedQuery = installedQuery.Where("version = ?", request.Version)
+		} else {
+			var count int64
+			if err := m.db.Model(&models.Software{}).
+				Where("`key` = ? AND installed = ?", request.Key, true).
+				Count(&count).Error; err != nil {
+				return nil, fmt.Errorf("check installed software: %w", err)
+			}
+			if count > 1 {
+				return nil, fmt.Errorf("several %s versions are installed; specify the version", component)
+			}
+		}
+	}
+	installedResult := installedQuery.First(&installed)
 	if installedResult.Error != nil && !errors.Is(installedResult.Error, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("check installed software: %w", installedResult.Error)
 	}
@@ -229,6 +229,52 @@ func TestManagerRunsUninstallAsDurableTask(t *testing.T) {
 	}
 }
 
+func TestManagerInstallsSideBySidePHPVersions(t *testing.T) {
+	db := openTaskTestDB(t)
+	for _, row := range []models.Software{
+		{Name: "PHP", Key: "php", Component: "php", Version: "8.2", Installed: true, InstallVersion: "8.2", Status: models.Soft_Status_Suc},
+		{Name: "PHP", Key: "php", Component: "php", Version: "8.3", Installable: true},
+	} {
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	operations := make(chan InstallRequest, 2)
+	manager := NewManager(db, t.TempDir(), func(
+		_ context.Context,
+		request InstallRequest,
+		_ string,
+		_ *Reporter,
+	) error {
+		operations <- request
+		return nil
+	})
+	task, err := manager.Submit(InstallRequest{Key: "php", Version: "8.3"}, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Operation != "install" {
+		t.Fatalf("second PHP version was queued as %s", task.Operation)
+	}
+	waitForTaskStatus(t, manager, task.ID, models.SoftwareTaskStatusSucceeded)
+	<-operations
+	if err := db.Model(&models.Software{}).Where("`key` = ? AND version = ?", "php", "8.3").
+		Updates(map[string]any{"installed": true, "install_version": "8.3"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.SubmitUninstall("php", "", 9); err == nil || !strings.Contains(err.Error(), "specify the version") {
+		t.Fatalf("ambiguous PHP uninstall was accepted: %v", err)
+	}
+	task, err = manager.SubmitUninstall("php", "8.2", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForTaskStatus(t, manager, task.ID, models.SoftwareTaskStatusSucceeded)
+	if request := <-operations; request.Operation != "uninstall" || request.Version != "8.2" {
+		t.Fatalf("unexpected uninstall request: %#v", request)
+	}
+}
+
 func TestManagerRunsServiceActionAsDurableTask(t *testing.T) {
 	db := openTaskTestDB(t)
 	if err := db.Create(&models.Software{
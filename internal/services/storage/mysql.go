@@ -166,9 +166,21 @@ func persistSyncedMySQLLibraries(
 	tx *gorm.DB,
 	connectionID int64,
 	discovered []models.Library,
+) error {
+	return persistSyncedLibraries(tx, connectionID, "mysql", discovered)
+}
+
+// persistSyncedLibraries reconciles the libraries found on a server with the
+// Panel records of that connection. Matching rows keep their ID, so backups
+// and stored credentials stay linked.
+func persistSyncedLibraries(
+	tx *gorm.DB,
+	connectionID int64,
+	libraryType string,
+	discovered []models.Library,
 ) error {
 	var existing []models.Library
-	if err := tx.Where("p_id = ? AND type = ?", connectionID, "mysql").
+	if err := tx.Where("p_id = ? AND type = ?", connectionID, libraryType).
 		Find(&existing).Error; err != nil {
 		return err
 	}
@@ -183,7 +195,7 @@ func persistSyncedMySQLLibraries(
 			updates := map[string]any{
 				"capacity": item.Capacity,
 				"p_addr":   item.PAddr,
-				"type":     "mysql",
+				"type":     libraryType,
 			}
 			if strings.TrimSpace(item.User) != "" {
 				updates["user"] = item.User
@@ -199,7 +211,7 @@ func persistSyncedMySQLLibraries(
 			continue
 		}
 		item.PID = connectionID
-		item.Type = "mysql"
+		item.Type = libraryType
 		if item.CreateTime.IsZero() {
 			item.CreateTime = time.Now()
 		}
@@ -0,0 +1,629 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+	"oneinstack/router/input"
+)
+
+var (
+	ErrMySQLAccountInvalid   = errors.New("invalid MySQL account change")
+	ErrMySQLAccountNotFound  = errors.New("MySQL account not found")
+	ErrMySQLAccountProtected = errors.New("MySQL account is managed outside this API")
+	ErrMySQLAccountChanged   = errors.New("MySQL account changed since preview")
+)
+
+const maxMySQLAccountLimit = 1000000
+
+var (
+	mysqlAccountUserPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,31}$`)
+	mysqlAccountHostPattern = regexp.MustCompile(`^[A-Za-z0-9%_.:/-]{1,255}$`)
+)
+
+// mysqlPrivilegeColumns lists the database-level privileges accounts may be
+// granted, in GRANT order, with their mysql.db column. GRANT OPTION is left
+// out on purpose so managed accounts cannot hand out rights themselves.
+var mysqlPrivilegeColumns = []struct {
+	privilege string
+	column    string
+}{
+	{"SELECT", "Select_priv"},
+	{"INSERT", "Insert_priv"},
+	{"UPDATE", "Update_priv"},
+	{"DELETE", "Delete_priv"},
+	{"CREATE", "Create_priv"},
+	{"DROP", "Drop_priv"},
+	{"REFERENCES", "References_priv"},
+	{"INDEX", "Index_priv"},
+	{"ALTER", "Alter_priv"},
+	{"CREATE TEMPORARY TABLES", "Create_tmp_table_priv"},
+	{"LOCK TABLES", "Lock_tables_priv"},
+	{"CREATE VIEW", "Create_view_priv"},
+	{"SHOW VIEW", "Show_view_priv"},
+	{"CREATE ROUTINE", "Create_routine_priv"},
+	{"ALTER ROUTINE", "Alter_routine_priv"},
+	{"EXECUTE", "Execute_priv"},
+	{"EVENT", "Event_priv"},
+	{"TRIGGER", "Trigger_priv"},
+}
+
+// MySQLAccountGrant holds the privileges of an account on one database.
+type MySQLAccountGrant struct {
+	Database   string   `json:"database"`
+	Privileges []string `json:"privileges"`
+}
+
+// MySQLAccountLimits are the per-account resource limits; zero means
+// unlimited, as in MySQL.
+type MySQLAccountLimits struct {
+	MaxQueriesPerHour     int `json:"maxQueriesPerHour"`
+	MaxUpdatesPerHour     int `json:"maxUpdatesPerHour"`
+	MaxConnectionsPerHour int `json:"maxConnectionsPerHour"`
+	MaxUserConnections    int `json:"maxUserConnections"`
+}
+
+type MySQLAccount struct {
+	User   string              `json:"user"`
+	Host   string              `json:"host"`
+	Grants []MySQLAccountGrant `json:"grants"`
+	Limits MySQLAccountLimits  `json:"limits"`
+	// Library names the Panel database whose dedicated account this is. Its
+	// password is rotated through the library credential API.
+	Library string `json:"library,omitempty"`
+}
+
+// MySQLAccountChange is the desired state of one account. Action "save"
+// creates or updates the account so its grants and limits match exactly;
+// "delete" drops it.
+type MySQLAccountChange struct {
+	ConnectionID int64               `json:"connectionId"`
+	Action       string              `json:"action"`
+	User         string              `json:"user"`
+	Host         string              `json:"host"`
+	Password     string              `json:"password,omitempty"`
+	Grants       []MySQLAccountGrant `json:"grants"`
+	Limits       MySQLAccountLimits  `json:"limits"`
+}
+
+type MySQLAccountStep struct {
+	Summary   string `json:"summary"`
+	Statement string `json:"statement"`
+	query     string
+	args      []any
+}
+
+// MySQLAccountPlan is the difference between the current and the requested
+// account. Version identifies the current state so an outdated plan is never
+// applied.
+type MySQLAccountPlan struct {
+	Before  *MySQLAccount      `json:"before,omitempty"`
+	After   *MySQLAccount      `json:"after,omitempty"`
+	Steps   []MySQLAccountStep `json:"steps"`
+	Version string             `json:"version"`
+}
+
+type mysqlAccountStore interface {
+	accounts() ([]MySQLAccount, error)
+	exec(query string, args ...any) error
+	Close() error
+}
+
+var openMySQLAccountStore = func(connection *models.Storage) (mysqlAccountStore, error) {
+	op := NewMysqlOP(connection, "")
+	if err := op.Connect(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func ListMySQLAccounts(connectionID int64) ([]MySQLAccount, error) {
+	connection, store, err := openMySQLAccountConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	accounts, err := store.accounts()
+	if err != nil {
+		return nil, err
+	}
+	libraries, err := mysqlLibraryAccounts(connection.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]MySQLAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if protectedMySQLAccount(connection, account.User) {
+			continue
+		}
+		if account.Host == managedMySQLAccountHost {
+			account.Library = libraries[account.User]
+		}
+		result = append(result, account)
+	}
+	return result, nil
+}
+
+// PlanMySQLAccountChange validates change and returns the statements that
+// would bring the account to the requested state, without running them.
+func PlanMySQLAccountChange(change *MySQLAccountChange) (*MySQLAccountPlan, error) {
+	connection, store, err := openMySQLAccountConnection(change.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return planMySQLAccountChange(connection, store, change)
+}
+
+// ApplyMySQLAccountChange re-plans change and runs the statements. When
+// version is set the account must still be in the previewed state. MySQL
+// account statements are not transactional; a new account is dropped again
+// when a later step fails.
+func ApplyMySQLAccountChange(change *MySQLAccountChange, version string) (*MySQLAccountPlan, error) {
+	connection, store, err := openMySQLAccountConnection(change.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	plan, err := planMySQLAccountChange(connection, store, change)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && plan.Version != version {
+		return nil, ErrMySQLAccountChanged
+	}
+	for index, step := range plan.Steps {
+		if err := store.exec(step.query, step.args...); err != nil {
+			if plan.Before == nil && index > 0 {
+				if dropErr := store.exec("DROP USER IF EXISTS ?@?", change.User, change.Host); dropErr != nil {
+					return nil, fmt.Errorf("%s: %w; removing the new account failed: %v", step.Summary, err, dropErr)
+				}
+				return nil, fmt.Errorf("%s: %w; the new account was removed", step.Summary, err)
+			}
+			return nil, fmt.Errorf("%s: %w (applied %d of %d steps)", step.Summary, err, index, len(plan.Steps))
+		}
+	}
+	return plan, nil
+}
+
+// ValidateMySQLAccountVersion reports whether the account a preview was
+// built from is unchanged.
+func ValidateMySQLAccountVersion(version string) error {
+	var connectionID int64
+	var user, host, revision string
+	fields := strings.Split(version, "|")
+	if len(fields) != 5 || fields[0] != "mysql-account" {
+		return ErrMySQLAccountChanged
+	}
+	if _, err := fmt.Sscanf(fields[1], "connection=%d", &connectionID); err != nil {
+		return ErrMySQLAccountChanged
+	}
+	user = strings.TrimPrefix(fields[2], "user=")
+	host = strings.TrimPrefix(fields[3], "host=")
+	revision = strings.TrimPrefix(fields[4], "revision=")
+	if revision == fields[4] {
+		return ErrMySQLAccountChanged
+	}
+	_, store, err := openMySQLAccountConnection(connectionID)
+	if err != nil {
+		return ErrMySQLAccountChanged
+	}
+	defer store.Close()
+	accounts, err := store.accounts()
+	if err != nil {
+		return ErrMySQLAccountChanged
+	}
+	if mysqlAccountVersion(connectionID, user, host, findMySQLAccount(accounts, user, host)) != version {
+		return ErrMySQLAccountChanged
+	}
+	return nil
+}
+
+// RenderMySQLAccount prints an account as the statements that recreate its
+// grants and limits, for diffs.
+func RenderMySQLAccount(account *MySQLAccount) string {
+	if account == nil {
+		return ""
+	}
+	var builder strings.Builder
+	target := quoteMySQLString(account.User) + "@" + quoteMySQLString(account.Host)
+	builder.WriteString("CREATE USER " + target + mysqlLimitClause(account.Limits) + "\n")
+	for _, grant := range account.Grants {
+		builder.WriteString("GRANT " + strings.Join(grant.Privileges, ", ") + " ON " +
+			quoteMySQLIdentifier(grant.Database) + ".* TO " + target + "\n")
+	}
+	return builder.String()
+}
+
+func openMySQLAccountConnection(connectionID int64) (*models.Storage, mysqlAccountStore, error) {
+	connection, err := loadStorage(connectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if connection.Type != "mysql" {
+		return nil, nil, fmt.Errorf("%w: connection %d is not a MySQL connection", ErrMySQLAccountInvalid, connection.ID)
+	}
+	store, err := openMySQLAccountStore(connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	return connection, store, nil
+}
+
+func planMySQLAccountChange(
+	connection *models.Storage,
+	store mysqlAccountStore,
+	change *MySQLAccountChange,
+) (*MySQLAccountPlan, error) {
+	if err := normalizeMySQLAccountChange(connection, change); err != nil {
+		return nil, err
+	}
+	accounts, err := store.accounts()
+	if err != nil {
+		return nil, err
+	}
+	libraries, err := mysqlLibraryAccounts(connection.ID)
+	if err != nil {
+		return nil, err
+	}
+	current := findMySQLAccount(accounts, change.User, change.Host)
+	library := ""
+	if change.Host == managedMySQLAccountHost {
+		library = libraries[change.User]
+	}
+	plan := &MySQLAccountPlan{
+		Before:  current,
+		Version: mysqlAccountVersion(connection.ID, change.User, change.Host, current),
+	}
+	target := quoteMySQLString(change.User) + "@" + quoteMySQLString(change.Host)
+	if change.Action == "delete" {
+		if current == nil {
+			return nil, ErrMySQLAccountNotFound
+		}
+		if library != "" {
+			return nil, fmt.Errorf("%w: account belongs to database %s; delete the database instead", ErrMySQLAccountProtected, library)
+		}
+		plan.Steps = append(plan.Steps, MySQLAccountStep{
+			Summary:   "删除 MySQL 账号 " + target,
+			Statement: "DROP USER " + target,
+			query:     "DROP USER ?@?", args: []any{change.User, change.Host},
+		})
+		return plan, nil
+	}
+
+	plan.After = &MySQLAccount{
+		User: change.User, Host: change.Host,
+		Grants: change.Grants, Limits: change.Limits, Library: library,
+	}
+	if current == nil {
+		if change.Password == "" {
+			return nil, fmt.Errorf("%w: a password is required for a new account", ErrMySQLAccountInvalid)
+		}
+		plan.Steps = append(plan.Steps, MySQLAccountStep{
+			Summary:   "创建 MySQL 账号 " + target,
+			Statement: "CREATE USER " + target + " IDENTIFIED BY '******'" + mysqlLimitClause(change.Limits),
+			query:     "CREATE USER ?@? IDENTIFIED BY ?" + mysqlLimitClause(change.Limits),
+			args:      []any{change.User, change.Host, change.Password},
+		})
+		current = &MySQLAccount{User: change.User, Host: change.Host}
+	} else {
+		if change.Password != "" {
+			if library != "" {
+				return nil, fmt.Errorf("%w: rotate the password of database %s through its credential", ErrMySQLAccountProtected, library)
+			}
+			plan.Steps = append(plan.Steps, MySQLAccountStep{
+				Summary:   "修改 MySQL 账号 " + target + " 的密码",
+				Statement: "ALTER USER " + target + " IDENTIFIED BY '******'",
+				query:     "ALTER USER ?@? IDENTIFIED BY ?",
+				args:      []any{change.User, change.Host, change.Password},
+			})
+		}
+		if current.Limits != change.Limits {
+			plan.Steps = append(plan.Steps, MySQLAccountStep{
+				Summary:   "调整 MySQL 账号 " + target + " 的资源限制",
+				Statement: "ALTER USER " + target + mysqlLimitClause(change.Limits),
+				query:     "ALTER USER ?@?" + mysqlLimitClause(change.Limits),
+				args:      []any{change.User, change.Host},
+			})
+		}
+	}
+
+	before := make(map[string][]string, len(current.Grants))
+	for _, grant := range current.Grants {
+		before[grant.Database] = grant.Privileges
+	}
+	after := make(map[string][]string, len(change.Grants))
+	for _, grant := range change.Grants {
+		after[grant.Database] = grant.Privileges
+	}
+	databases := make([]string, 0, len(before)+len(after))
+	for database := range before {
+		databases = append(databases, database)
+	}
+	for database := range after {
+		if _, ok := before[database]; !ok {
+			databases = append(databases, database)
+		}
+	}
+	sort.Strings(databases)
+	for _, database := range databases {
+		revoked := privilegeDifference(before[database], after[database])
+		granted := privilegeDifference(after[database], before[database])
+		object := quoteMySQLIdentifier(database) + ".*"
+		if len(revoked) > 0 {
+			privileges := strings.Join(revoked, ", ")
+			plan.Steps = append(plan.Steps, MySQLAccountStep{
+				Summary:   "撤销 " + target + " 在 " + database + " 上的 " + privileges + " 权限",
+				Statement: "REVOKE " + privileges + " ON " + object + " FROM " + target,
+				query:     "REVOKE " + privileges + " ON " + object + " FROM ?@?",
+				args:      []any{change.User, change.Host},
+			})
+		}
+		if len(granted) > 0 {
+			privileges := strings.Join(granted, ", ")
+			plan.Steps = append(plan.Steps, MySQLAccountStep{
+				Summary:   "授予 " + target + " 在 " + database + " 上的 " + privileges + " 权限",
+				Statement: "GRANT " + privileges + " ON " + object + " TO " + target,
+				query:     "GRANT " + privileges + " ON " + object + " TO ?@?",
+				args:      []any{change.User, change.Host},
+			})
+		}
+	}
+	return plan, nil
+}
+
+func normalizeMySQLAccountChange(connection *models.Storage, change *MySQLAccountChange) error {
+	change.Action = strings.ToLower(strings.TrimSpace(change.Action))
+	change.User = strings.TrimSpace(change.User)
+	change.Host = strings.TrimSpace(change.Host)
+	if change.Action == "" {
+		change.Action = "save"
+	}
+	if change.Action != "save" && change.Action != "delete" {
+		return fmt.Errorf("%w: unsupported action %q", ErrMySQLAccountInvalid, change.Action)
+	}
+	if change.Host == "" {
+		change.Host = managedMySQLAccountHost
+	}
+	if !mysqlAccountUserPattern.MatchString(change.User) {
+		return fmt.Errorf("%w: username must start with a letter and contain at most 32 letters, numbers, dots, dashes, or underscores", ErrMySQLAccountInvalid)
+	}
+	if !mysqlAccountHostPattern.MatchString(change.Host) {
+		return fmt.Errorf("%w: host must be a host name, IP address, netmask, or %% pattern", ErrMySQLAccountInvalid)
+	}
+	if protectedMySQLAccount(connection, change.User) {
+		return fmt.Errorf("%w: %s is a system or administrator account", ErrMySQLAccountProtected, change.User)
+	}
+	if change.Action == "delete" {
+		change.Password = ""
+		change.Grants = nil
+		change.Limits = MySQLAccountLimits{}
+		return nil
+	}
+	if change.Password != "" {
+		if err := input.ValidateDatabaseUserPassword(change.Password); err != nil {
+			return fmt.Errorf("%w: %v", ErrMySQLAccountInvalid, err)
+		}
+	}
+	for _, limit := range []int{
+		change.Limits.MaxQueriesPerHour, change.Limits.MaxUpdatesPerHour,
+		change.Limits.MaxConnectionsPerHour, change.Limits.MaxUserConnections,
+	} {
+		if limit < 0 || limit > maxMySQLAccountLimit {
+			return fmt.Errorf("%w: resource limits must be between 0 and %d", ErrMySQLAccountInvalid, maxMySQLAccountLimit)
+		}
+	}
+	merged := map[string][]string{}
+	for _, grant := range change.Grants {
+		database := strings.TrimSpace(grant.Database)
+		if err := validateMySQLIdentifier(database, 64); err != nil {
+			return fmt.Errorf("%w: database %q: %v", ErrMySQLAccountInvalid, grant.Database, err)
+		}
+		if isSystemDatabase("mysql", database) {
+			return fmt.Errorf("%w: privileges on system database %s cannot be granted", ErrMySQLAccountInvalid, database)
+		}
+		for _, privilege := range grant.Privileges {
+			privilege = strings.Join(strings.Fields(strings.ToUpper(privilege)), " ")
+			if privilege == "ALL" || privilege == "ALL PRIVILEGES" {
+				for _, known := range mysqlPrivilegeColumns {
+					merged[database] = append(merged[database], known.privilege)
+				}
+				continue
+			}
+			if !knownMySQLPrivilege(privilege) {
+				return fmt.Errorf("%w: unsupported privilege %q", ErrMySQLAccountInvalid, privilege)
+			}
+			merged[database] = append(merged[database], privilege)
+		}
+	}
+	change.Grants = change.Grants[:0]
+	for database, privileges := range merged {
+		if privileges = canonicalPrivileges(privileges); len(privileges) > 0 {
+			change.Grants = append(change.Grants, MySQLAccountGrant{Database: database, Privileges: privileges})
+		}
+	}
+	sort.Slice(change.Grants, func(i, j int) bool { return change.Grants[i].Database < change.Grants[j].Database })
+	return nil
+}
+
+func (s *MysqlOP) accounts() ([]MySQLAccount, error) {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sqlDB.Query(
+		"SELECT User, Host, max_questions, max_updates, max_connections, max_user_connections FROM mysql.user",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("read MySQL accounts: %w", err)
+	}
+	var accounts []MySQLAccount
+	for rows.Next() {
+		var account MySQLAccount
+		limits := &account.Limits
+		if err := rows.Scan(
+			&account.User, &account.Host, &limits.MaxQueriesPerHour, &limits.MaxUpdatesPerHour,
+			&limits.MaxConnectionsPerHour, &limits.MaxUserConnections,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, len(mysqlPrivilegeColumns))
+	for _, item := range mysqlPrivilegeColumns {
+		columns = append(columns, item.column)
+	}
+	rows, err = sqlDB.Query("SELECT User, Host, Db, " + strings.Join(columns, ", ") + " FROM mysql.db ORDER BY Db")
+	if err != nil {
+		return nil, fmt.Errorf("read MySQL database privileges: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user, host, database string
+		flags := make([]sql.NullString, len(mysqlPrivilegeColumns))
+		targets := []any{&user, &host, &database}
+		for index := range flags {
+			targets = append(targets, &flags[index])
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		grant := MySQLAccountGrant{Database: database}
+		for index, flag := range flags {
+			if flag.String == "Y" {
+				grant.Privileges = append(grant.Privileges, mysqlPrivilegeColumns[index].privilege)
+			}
+		}
+		if len(grant.Privileges) == 0 {
+			continue
+		}
+		for index := range accounts {
+			if accounts[index].User == user && accounts[index].Host == host {
+				accounts[index].Grants = append(accounts[index].Grants, grant)
+			}
+		}
+	}
+	return accounts, rows.Err()
+}
+
+func (s *MysqlOP) exec(query string, args ...any) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	_, err = sqlDB.Exec(query, args...)
+	return err
+}
+
+func findMySQLAccount(accounts []MySQLAccount, user, host string) *MySQLAccount {
+	for index := range accounts {
+		if accounts[index].User == user && accounts[index].Host == host {
+			account := accounts[index]
+			return &account
+		}
+	}
+	return nil
+}
+
+func mysqlAccountVersion(connectionID int64, user, host string, account *MySQLAccount) string {
+	state, _ := json.Marshal(account)
+	digest := sha256.Sum256(state)
+	return fmt.Sprintf("mysql-account|connection=%d|user=%s|host=%s|revision=%s",
+		connectionID, user, host, hex.EncodeToString(digest[:8]))
+}
+
+// mysqlLibraryAccounts maps the dedicated account of each Panel library on
+// the connection to the library name.
+func mysqlLibraryAccounts(connectionID int64) (map[string]string, error) {
+	var libraries []models.Library
+	if err := app.DB().Select("name", "user").
+		Where("p_id = ? AND type = ? AND user <> ''", connectionID, "mysql").
+		Find(&libraries).Error; err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]string, len(libraries))
+	for _, library := range libraries {
+		accounts[library.User] = library.Name
+	}
+	return accounts, nil
+}
+
+func protectedMySQLAccount(connection *models.Storage, user string) bool {
+	switch user {
+	case "", "root", "mysql.sys", "mysql.session", "mysql.infoschema", "debian-sys-maint":
+		return true
+	}
+	return user == connection.Root
+}
+
+func mysqlLimitClause(limits MySQLAccountLimits) string {
+	return fmt.Sprintf(
+		" WITH MAX_QUERIES_PER_HOUR %d MAX_UPDATES_PER_HOUR %d MAX_CONNECTIONS_PER_HOUR %d MAX_USER_CONNECTIONS %d",
+		limits.MaxQueriesPerHour, limits.MaxUpdatesPerHour,
+		limits.MaxConnectionsPerHour, limits.MaxUserConnections,
+	)
+}
+
+func knownMySQLPrivilege(privilege string) bool {
+	for _, known := range mysqlPrivilegeColumns {
+		if known.privilege == privilege {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalPrivileges removes duplicates and orders privileges as
+// mysqlPrivilegeColumns does, so plans and diffs are stable.
+func canonicalPrivileges(privileges []string) []string {
+	result := make([]string, 0, len(privileges))
+	for _, known := range mysqlPrivilegeColumns {
+		for _, privilege := range privileges {
+			if privilege == known.privilege {
+				result = append(result, privilege)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func privilegeDifference(from, without []string) []string {
+	var result []string
+	for _, privilege := range from {
+		found := false
+		for _, other := range without {
+			if other == privilege {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, privilege)
+		}
+	}
+	return result
+}
+
+// quoteMySQLString is for display only; statements bind values as
+// parameters.
+func quoteMySQLString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+)
+
+type fakeMySQLAccountStore struct {
+	current    []MySQLAccount
+	statements []string
+	failAt     int
+}
+
+func (s *fakeMySQLAccountStore) accounts() ([]MySQLAccount, error) {
+	return s.current, nil
+}
+
+func (s *fakeMySQLAccountStore) exec(query string, args ...any) error {
+	s.statements = append(s.statements, fmt.Sprintf("%s %v", query, args))
+	if s.failAt > 0 && len(s.statements) == s.failAt {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+func (s *fakeMySQLAccountStore) Close() error {
+	return nil
+}
+
+func prepareMySQLAccountTest(t *testing.T, store *fakeMySQLAccountStore) *models.Storage {
+	t.Helper()
+	prepareStorageTest(t)
+	connection := &models.Storage{Addr: "127.0.0.1", Port: "3306", Root: "admin", Type: "mysql"}
+	if err := app.DB().Create(connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DB().Create(&models.Library{PID: connection.ID, Name: "shop", User: "shop", Type: "mysql"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	previous := openMySQLAccountStore
+	openMySQLAccountStore = func(*models.Storage) (mysqlAccountStore, error) {
+		return store, nil
+	}
+	t.Cleanup(func() {
+		openMySQLAccountStore = previous
+	})
+	return connection
+}
+
+func TestMySQLAccountPlanCreatesReadOnlyAccount(t *testing.T) {
+	store := &fakeMySQLAccountStore{}
+	connection := prepareMySQLAccountTest(t, store)
+	change := &MySQLAccountChange{
+		ConnectionID: connection.ID, User: "report", Host: "10.0.0.%", Password: "reporting-password-1234",
+		Grants: []MySQLAccountGrant{{Database: "shop", Privileges: []string{"select", "SELECT", "show  view"}}},
+		Limits: MySQLAccountLimits{MaxUserConnections: 5},
+	}
+	plan, err := PlanMySQLAccountChange(change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Before != nil || len(plan.Steps) != 2 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.Steps[0].Statement != "CREATE USER 'report'@'10.0.0.%' IDENTIFIED BY '******' WITH MAX_QUERIES_PER_HOUR 0 "+
+		"MAX_UPDATES_PER_HOUR 0 MAX_CONNECTIONS_PER_HOUR 0 MAX_USER_CONNECTIONS 5" ||
+		plan.Steps[1].Statement != "GRANT SELECT, SHOW VIEW ON `shop`.* TO 'report'@'10.0.0.%'" {
+		t.Fatalf("unexpected statements: %+v", plan.Steps)
+	}
+	for _, step := range plan.Steps {
+		if strings.Contains(step.Statement, change.Password) || strings.Contains(step.Summary, change.Password) {
+			t.Fatalf("password leaked into the plan: %+v", step)
+		}
+	}
+	if len(store.statements) != 0 {
+		t.Fatalf("planning executed statements: %v", store.statements)
+	}
+
+	if _, err := ApplyMySQLAccountChange(change, plan.Version); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.statements) != 2 || !strings.HasPrefix(store.statements[0], "CREATE USER ?@? IDENTIFIED BY ?") ||
+		!strings.Contains(store.statements[0], change.Password) {
+		t.Fatalf("unexpected executed statements: %v", store.statements)
+	}
+
+	// The previewed state changed, so the plan is not applied.
+	store.current = []MySQLAccount{{User: "report", Host: "10.0.0.%"}}
+	if _, err := ApplyMySQLAccountChange(change, plan.Version); !errors.Is(err, ErrMySQLAccountChanged) {
+		t.Fatalf("outdated plan was applied: %v", err)
+	}
+	if err := ValidateMySQLAccountVersion(plan.Version); !errors.Is(err, ErrMySQLAccountChanged) {
+		t.Fatalf("outdated version was accepted: %v", err)
+	}
+}
+
+func TestMySQLAccountPlanRevokesRemovedPrivilegesAndAdjustsLimits(t *testing.T) {
+	store := &fakeMySQLAccountStore{current: []MySQLAccount{{
+		User: "etl", Host: "%",
+		Grants: []MySQLAccountGrant{
+			{Database: "shop", Privileges: []string{"SELECT", "INSERT", "UPDATE"}},
+			{Database: "legacy", Privileges: []string{"SELECT"}},
+		},
+	}}}
+	connection := prepareMySQLAccountTest(t, store)
+	plan, err := PlanMySQLAccountChange(&MySQLAccountChange{
+		ConnectionID: connection.ID, User: "etl",
+		Grants: []MySQLAccountGrant{{Database: "shop", Privileges: []string{"SELECT", "CREATE", "ALTER", "INDEX"}}},
+		Limits: MySQLAccountLimits{MaxQueriesPerHour: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, step := range plan.Steps {
+		statements = append(statements, step.Statement)
+	}
+	expected := []string{
+		"ALTER USER 'etl'@'%' WITH MAX_QUERIES_PER_HOUR 1000 MAX_UPDATES_PER_HOUR 0 MAX_CONNECTIONS_PER_HOUR 0 MAX_USER_CONNECTIONS 0",
+		"REVOKE SELECT ON `legacy`.* FROM 'etl'@'%'",
+		"REVOKE INSERT, UPDATE ON `shop`.* FROM 'etl'@'%'",
+		"GRANT CREATE, INDEX, ALTER ON `shop`.* TO 'etl'@'%'",
+	}
+	if strings.Join(statements, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected statements:\n%s", strings.Join(statements, "\n"))
+	}
+	if before, after := RenderMySQLAccount(plan.Before), RenderMySQLAccount(plan.After); !strings.Contains(before, "GRANT SELECT ON `legacy`.*") ||
+		strings.Contains(after, "legacy") {
+		t.Fatalf("unexpected rendering:\n%s\n%s", before, after)
+	}
+}
+
+func TestMySQLAccountChangeRejectsProtectedAndInvalidAccounts(t *testing.T) {
+	store := &fakeMySQLAccountStore{current: []MySQLAccount{{User: "shop", Host: "%"}}}
+	connection := prepareMySQLAccountTest(t, store)
+	for _, change := range []MySQLAccountChange{
+		{User: "root", Password: "reporting-password-1234"},
+		{User: "admin", Password: "reporting-password-1234"},
+		{User: "shop", Action: "delete"},
+		{User: "shop", Password: "rotated-password-1234"},
+		{User: "report", Password: "reporting-password-1234", Grants: []MySQLAccountGrant{{Database: "mysql", Privileges: []string{"SELECT"}}}},
+		{User: "report", Password: "reporting-password-1234", Grants: []MySQLAccountGrant{{Database: "shop", Privileges: []string{"SUPER"}}}},
+		{User: "report", Password: "reporting-password-1234", Host: "bad host"},
+		{User: "report"},
+		{User: "missing", Action: "delete"},
+	} {
+		change.ConnectionID = connection.ID
+		if _, err := PlanMySQLAccountChange(&change); err == nil {
+			t.Fatalf("change was accepted: %+v", change)
+		}
+	}
+	accounts, err := ListMySQLAccounts(connection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Library != "shop" {
+		t.Fatalf("library account was not marked: %+v", accounts)
+	}
+}
+
+func TestMySQLAccountApplyRemovesNewAccountWhenGrantFails(t *testing.T) {
+	store := &fakeMySQLAccountStore{failAt: 2}
+	connection := prepareMySQLAccountTest(t, store)
+	_, err := ApplyMySQLAccountChange(&MySQLAccountChange{
+		ConnectionID: connection.ID, User: "report", Password: "reporting-password-1234",
+		Grants: []MySQLAccountGrant{{Database: "shop", Privileges: []string{"SELECT"}}},
+	}, "")
+	if err == nil {
+		t.Fatal("failed grant was reported as applied")
+	}
+	if len(store.statements) != 3 || !strings.HasPrefix(store.statements[2], "DROP USER IF EXISTS ?@? [report %]") {
+		t.Fatalf("new account was not removed: %v", store.statements)
+	}
+}
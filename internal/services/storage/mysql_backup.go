@@ -51,7 +51,7 @@ func (o *MySQLDatabaseOperator) Backup(
 	if err := os.MkdirAll(filepath.Dir(destination), 0750); err != nil {
 		return fmt.Errorf("create backup directory: %w", err)
 	}
-	if err := checkDatabaseBackupDiskSpace(filepath.Dir(destination)); err != nil {
+	if err := checkDatabaseBackupDiskSpace(filepath.Dir(destination), libraryID); err != nil {
 		return err
 	}
 	partial := destination + ".partial"
@@ -69,10 +69,8 @@ func (o *MySQLDatabaseOperator) Backup(
 	}()
 
 	report(10, "正在连接 MySQL")
-	command := exec.CommandContext(
-		ctx,
-		dumpBinary,
-		"--defaults-extra-file="+credentialPath,
+	arguments := []string{
+		"--defaults-extra-file=" + credentialPath,
 		"--single-transaction",
 		"--quick",
 		"--routines",
@@ -81,9 +79,17 @@ func (o *MySQLDatabaseOperator) Backup(
 		"--hex-blob",
 		"--add-drop-database",
 		"--set-gtid-purged=OFF",
-		"--databases",
-		library.Name,
-	)
+	}
+	// With binary logging on, the dump records the log coordinates it is
+	// consistent with so archived binlogs can roll it forward.
+	sourceDataOption, err := mysqlSourceDataOption(ctx, credentialPath)
+	if err != nil {
+		return err
+	}
+	if sourceDataOption != "" {
+		arguments = append(arguments, sourceDataOption)
+	}
+	command := exec.CommandContext(ctx, dumpBinary, append(arguments, "--databases", library.Name)...)
 	command.Stderr = log
 	gzipWriter, err := gzip.NewWriterLevel(output, gzip.BestSpeed)
 	if err != nil {
@@ -201,7 +207,13 @@ func loadMySQLLibrary(libraryID int64) (*models.Library, *models.Storage, error)
 }
 
 func mysqlBinary(name string) (string, error) {
-	if configured := strings.TrimSpace(os.Getenv("ONEINSTACK_MYSQL_BIN_DIR")); configured != "" {
+	return databaseBinary("ONEINSTACK_MYSQL_BIN_DIR", name, "/usr/local/mysql/bin", "/usr/bin")
+}
+
+// databaseBinary resolves a client tool from the directory named by
+// environment, then from the engine's install directories, then from PATH.
+func databaseBinary(environment, name string, directories ...string) (string, error) {
+	if configured := strings.TrimSpace(os.Getenv(environment)); configured != "" {
 		candidate := filepath.Join(filepath.Clean(configured), name)
 		info, err := os.Stat(candidate)
 		if err != nil {
@@ -212,11 +224,8 @@ func mysqlBinary(name string) (string, error) {
 		}
 		return candidate, nil
 	}
-	candidates := []string{
-		filepath.Join("/usr/local/mysql/bin", name),
-		filepath.Join("/usr/bin", name),
-	}
-	for _, candidate := range candidates {
+	for _, directory := range directories {
+		candidate := filepath.Join(directory, name)
 		if info, err := os.Stat(candidate); err == nil &&
 			info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
 			return candidate, nil
@@ -275,7 +284,10 @@ func escapeMySQLOption(value string) string {
 	return replacer.Replace(value)
 }
 
-func checkDatabaseBackupDiskSpace(directory string) error {
+// checkDatabaseBackupDiskSpace refuses to start a backup that would leave less
+// than the configured free space. The backup is expected to be about as large
+// as the previous backup of the library plus a quarter for growth.
+func checkDatabaseBackupDiskSpace(directory string, libraryID int64) error {
 	usage, err := disk.Usage(directory)
 	if err != nil {
 		return fmt.Errorf("read database backup disk capacity: %w", err)
@@ -284,15 +296,33 @@ func checkDatabaseBackupDiskSpace(directory string) error {
 	if minimum < 0 {
 		minimum = 0
 	}
+	estimated, err := estimatedDatabaseBackupBytes(libraryID)
+	if err != nil {
+		return err
+	}
 	const operationHeadroom = uint64(1 << 20)
 	required := uint64(minimum)
-	if required > ^uint64(0)-operationHeadroom ||
-		usage.Free <= required+operationHeadroom {
+	if required > ^uint64(0)-operationHeadroom-estimated ||
+		usage.Free <= required+operationHeadroom+estimated {
 		return fmt.Errorf(
-			"insufficient disk space for database backup: available %d bytes, reserved %d bytes",
+			"insufficient disk space for database backup: available %d bytes, reserved %d bytes, estimated backup %d bytes",
 			usage.Free,
 			minimum,
+			estimated,
 		)
 	}
 	return nil
 }
+
+func estimatedDatabaseBackupBytes(libraryID int64) (uint64, error) {
+	var backups []models.DatabaseBackup
+	if err := app.DB().Select("size_bytes").Where("library_id = ?", libraryID).
+		Order("created_at DESC").Limit(1).Find(&backups).Error; err != nil {
+		return 0, fmt.Errorf("estimate database backup size: %w", err)
+	}
+	if len(backups) == 0 || backups[0].SizeBytes <= 0 {
+		return 0, nil
+	}
+	size := uint64(backups[0].SizeBytes)
+	return size + size/4, nil
+}
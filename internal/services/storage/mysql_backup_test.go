@@ -162,3 +162,23 @@ cat > "$MYSQL_RESTORE_LOG"
 		t.Fatalf("temporary credential files were not removed: %v", credentialFiles)
 	}
 }
+
+func TestDatabaseBackupDiskSpaceCheckReservesPreviousBackupSize(t *testing.T) {
+	prepareStorageTest(t)
+	directory := t.TempDir()
+	if err := checkDatabaseBackupDiskSpace(directory, 41); err != nil {
+		t.Fatalf("first backup was refused: %v", err)
+	}
+	// A previous backup larger than any disk cannot be followed by another.
+	if err := app.DB().Create(&models.DatabaseBackup{
+		ID: "c1d2e3f4-0000-4000-8000-000000000001", LibraryID: 41, ConnectionID: 1,
+		DatabaseName: "huge", Source: models.DatabaseBackupSourceScheduled, FileName: "huge.sql.gz",
+		FilePath: filepath.Join(directory, "huge.sql.gz"), SizeBytes: 1 << 60, SHA256: strings.Repeat("0", 64),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := checkDatabaseBackupDiskSpace(directory, 41)
+	if err == nil || !strings.Contains(err.Error(), "estimated backup") {
+		t.Fatalf("oversized backup was not refused: %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneinstack/internal/services/databasetask"
+)
+
+// mysqlBinlogCoordinates matches the commented replication statement that
+// mysqldump writes with --source-data=2 or --master-data=2.
+var mysqlBinlogCoordinates = regexp.MustCompile(
+	`^-- CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=([0-9]+);`,
+)
+
+var mysqlBinlogFileName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// BackupPosition reads the binlog coordinates from the header of a dump
+// written by Backup.
+func (o *MySQLDatabaseOperator) BackupPosition(_ int64, path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", 0, fmt.Errorf("open compressed database backup: %w", err)
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	// The coordinates precede the first statement of the database, so only
+	// the header is read.
+	for line := 0; line < 200 && scanner.Scan(); line++ {
+		text := scanner.Text()
+		if match := mysqlBinlogCoordinates.FindStringSubmatch(text); match != nil {
+			position, err := strconv.ParseInt(match[2], 10, 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid binlog position in backup: %w", err)
+			}
+			return match[1], position, nil
+		}
+		if strings.HasPrefix(text, "CREATE DATABASE") || strings.HasPrefix(text, "USE ") {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return "", 0, fmt.Errorf("read database backup header: %w", err)
+	}
+	return "", 0, nil
+}
+
+// ArchiveBinlogs rotates the binary log so recent events are in a closed
+// file, then copies the wanted closed logs with mysqlbinlog. Files are staged
+// privately and published under their server name.
+func (o *MySQLDatabaseOperator) ArchiveBinlogs(
+	ctx context.Context,
+	connectionID int64,
+	directory string,
+	wanted func(fileName string) bool,
+) ([]databasetask.ArchivedBinlog, error) {
+	connection, err := loadStorage(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if connection.Type != "mysql" {
+		return nil, databasetask.ErrBinlogDisabled
+	}
+	binlogBinary, err := mysqlBinary("mysqlbinlog")
+	if err != nil {
+		return nil, err
+	}
+	credentialPath, cleanup, err := writeMySQLDefaultsFile(directory, connection)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	rows, err := mysqlQuery(ctx, credentialPath, "SELECT @@GLOBAL.log_bin")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || strings.TrimSpace(rows[0]) != "1" {
+		return nil, databasetask.ErrBinlogDisabled
+	}
+	// Every event written before the rotation ends up in a closed file.
+	coveredUntil := time.Now().UTC()
+	if _, err := mysqlQuery(ctx, credentialPath, "FLUSH BINARY LOGS"); err != nil {
+		return nil, err
+	}
+	rows, err = mysqlQuery(ctx, credentialPath, "SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	staging, err := os.MkdirTemp(directory, ".binlog-*")
+	if err != nil {
+		return nil, fmt.Errorf("create binlog staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	var archived []databasetask.ArchivedBinlog
+	// The last log is the one the server is writing to.
+	for _, row := range rows[:len(rows)-1] {
+		name := strings.SplitN(row, "\t", 2)[0]
+		if !mysqlBinlogFileName.MatchString(name) || !wanted(name) {
+			continue
+		}
+		var stderr bytes.Buffer
+		command := exec.CommandContext(
+			ctx,
+			binlogBinary,
+			"--defaults-extra-file="+credentialPath,
+			"--read-from-remote-server",
+			"--raw",
+			"--result-file="+staging+string(filepath.Separator),
+			name,
+		)
+		command.Stderr = &stderr
+		if err := command.Run(); err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return archived, context.Canceled
+			}
+			return archived, fmt.Errorf("mysqlbinlog %s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+		}
+		staged := filepath.Join(staging, name)
+		if err := os.Chmod(staged, 0600); err != nil {
+			return archived, fmt.Errorf("secure archived binlog %s: %w", name, err)
+		}
+		if err := syncFile(staged); err != nil {
+			return archived, fmt.Errorf("sync archived binlog %s: %w", name, err)
+		}
+		if err := os.Rename(staged, filepath.Join(directory, name)); err != nil {
+			return archived, fmt.Errorf("publish archived binlog %s: %w", name, err)
+		}
+		archived = append(archived, databasetask.ArchivedBinlog{FileName: name, CoveredUntil: coveredUntil})
+	}
+	return archived, nil
+}
+
+// ReplayBinlogs decodes the events of the library's database with mysqlbinlog
+// and pipes them into the mysql client. GTIDs are stripped because the server
+// has already executed the original transactions.
+func (o *MySQLDatabaseOperator) ReplayBinlogs(
+	ctx context.Context,
+	libraryID int64,
+	files []string,
+	position int64,
+	target databasetask.RecoveryTarget,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	if len(files) == 0 {
+		return errors.New("no binary logs to replay")
+	}
+	library, connection, err := loadMySQLLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	binlogBinary, err := mysqlBinary("mysqlbinlog")
+	if err != nil {
+		return err
+	}
+	mysql, err := mysqlBinary("mysql")
+	if err != nil {
+		return err
+	}
+	credentialPath, cleanup, err := writeMySQLDefaultsFile(filepath.Dir(files[0]), connection)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	arguments := []string{
+		"--skip-gtids",
+		"--database=" + library.Name,
+		"--start-position=" + strconv.FormatInt(position, 10),
+	}
+	switch {
+	case target.StopAt != nil:
+		// mysqlbinlog stops before the first event at or after the given local
+		// time, so the chosen second itself is included.
+		stopAt := target.StopAt.Add(time.Second).In(time.Local)
+		arguments = append(arguments, "--stop-datetime="+stopAt.Format("2006-01-02 15:04:05"))
+	case target.StopGTID != "":
+		separator := strings.LastIndex(target.StopGTID, ":")
+		if separator <= 0 {
+			return errors.New("invalid stop GTID")
+		}
+		arguments = append(arguments, "--include-gtids="+
+			target.StopGTID[:separator]+":1-"+target.StopGTID[separator+1:])
+	}
+	decode := exec.CommandContext(ctx, binlogBinary, append(arguments, files...)...)
+	decode.Stderr = log
+	events, err := decode.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	apply := exec.CommandContext(
+		ctx,
+		mysql,
+		"--defaults-extra-file="+credentialPath,
+		"--binary-mode=1",
+		"--database="+library.Name,
+	)
+	apply.Stdin = events
+	apply.Stdout = log
+	apply.Stderr = log
+
+	report(10, "正在解析二进制日志")
+	if err := decode.Start(); err != nil {
+		return fmt.Errorf("start mysqlbinlog: %w", err)
+	}
+	if err := apply.Start(); err != nil {
+		_ = decode.Process.Kill()
+		_ = decode.Wait()
+		return fmt.Errorf("start mysql: %w", err)
+	}
+	report(30, "正在重放二进制日志，请勿中断服务")
+	applyErr := apply.Wait()
+	if applyErr != nil {
+		_ = decode.Process.Kill()
+	}
+	decodeErr := decode.Wait()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return context.Canceled
+	}
+	if applyErr != nil {
+		return fmt.Errorf("apply binary logs failed: %w", applyErr)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("mysqlbinlog failed: %w", decodeErr)
+	}
+	report(100, "二进制日志重放完成")
+	return nil
+}
+
+// mysqlSourceDataOption returns the mysqldump option that records binlog
+// coordinates in a comment, or "" when binary logging is off. MySQL 8.0.26
+// renamed --master-data to --source-data.
+func mysqlSourceDataOption(ctx context.Context, credentialPath string) (string, error) {
+	rows, err := mysqlQuery(ctx, credentialPath, "SELECT @@GLOBAL.log_bin, VERSION()")
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	fields := strings.Split(rows[0], "\t")
+	if len(fields) < 2 || strings.TrimSpace(fields[0]) != "1" {
+		return "", nil
+	}
+	if mysqlVersionAtLeast(fields[1], 8, 0, 26) {
+		return "--source-data=2", nil
+	}
+	return "--master-data=2", nil
+}
+
+func mysqlVersionAtLeast(version string, want ...int) bool {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+	if index := strings.IndexAny(version, "-+ "); index >= 0 {
+		version = version[:index]
+	}
+	parts := strings.Split(version, ".")
+	for index, minimum := range want {
+		if index >= len(parts) {
+			return false
+		}
+		value, err := strconv.Atoi(parts[index])
+		if err != nil {
+			return false
+		}
+		if value != minimum {
+			return value > minimum
+		}
+	}
+	return true
+}
+
+// mysqlQuery runs one statement with the mysql client and returns its rows as
+// tab-separated lines.
+func mysqlQuery(ctx context.Context, credentialPath, statement string) ([]string, error) {
+	mysql, err := mysqlBinary("mysql")
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(
+		ctx,
+		mysql,
+		"--defaults-extra-file="+credentialPath,
+		"--batch",
+		"--skip-column-names",
+		"--execute="+statement,
+	)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, context.Canceled
+		}
+		return nil, fmt.Errorf("mysql query failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var rows []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return rows, nil
+}
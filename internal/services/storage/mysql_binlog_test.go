@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/utils"
+)
+
+func TestMySQLBinlogArchiveAndReplayCommandContract(t *testing.T) {
+	prepareStorageTest(t)
+	binDirectory := t.TempDir()
+	logDirectory := t.TempDir()
+	t.Setenv("ONEINSTACK_MYSQL_BIN_DIR", binDirectory)
+	t.Setenv("MYSQL_TEST_LOG", logDirectory)
+	tools := map[string]string{
+		"mysql": `#!/bin/sh
+case "$*" in
+*"--execute=SELECT @@GLOBAL.log_bin, VERSION()"*) printf '1\t8.0.36\n' ;;
+*"--execute=SELECT @@GLOBAL.log_bin"*) printf '1\n' ;;
+*"--execute=FLUSH BINARY LOGS"*) ;;
+*"--execute=SHOW BINARY LOGS"*) printf 'binlog.000001\t100\tNo\nbinlog.000002\t200\tNo\nbinlog.000003\t300\tNo\n' ;;
+*) cat > "$MYSQL_TEST_LOG/applied.sql" ;;
+esac
+`,
+		"mysqldump": `#!/bin/sh
+printf '%s\n' "$@" > "$MYSQL_TEST_LOG/mysqldump.args"
+printf -- "-- MySQL dump\n--\n-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000002', SOURCE_LOG_POS=157;\nCREATE DATABASE site_db;\n"
+`,
+		"mysqlbinlog": `#!/bin/sh
+printf '%s\n' "$@" > "$MYSQL_TEST_LOG/mysqlbinlog.args"
+for argument in "$@"; do
+	case "$argument" in --result-file=*) prefix="${argument#--result-file=}" ;; esac
+	name="$argument"
+done
+if [ -n "$prefix" ]; then
+	printf 'events of %s' "$name" > "$prefix$name"
+else
+	printf 'REPLAYED'
+fi
+`,
+	}
+	for name, content := range tools {
+		if err := os.WriteFile(filepath.Join(binDirectory, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encrypted, err := utils.EncryptCredential("root-binlog-secret", utils.CredentialPurposeStoragePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := &models.Storage{Addr: "127.0.0.1", Port: "3306", Root: "root", Password: encrypted, Type: "mysql"}
+	if err := app.DB().Create(connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	library := &models.Library{PID: connection.ID, Name: "site_db", Type: "mysql"}
+	if err := app.DB().Create(library).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	operator := NewDatabaseOperator()
+	destination := filepath.Join(t.TempDir(), "site_db.sql.gz")
+	if err := operator.Backup(context.Background(), library.ID, destination, io.Discard, func(int, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	dumpArguments, err := os.ReadFile(filepath.Join(logDirectory, "mysqldump.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dumpArguments), "--source-data=2\n") {
+		t.Fatalf("dump does not record binlog coordinates:\n%s", dumpArguments)
+	}
+	file, position, err := operator.BackupPosition(library.ID, destination)
+	if err != nil || file != "binlog.000002" || position != 157 {
+		t.Fatalf("unexpected backup position: %s %d %v", file, position, err)
+	}
+
+	archive := t.TempDir()
+	archived, err := operator.ArchiveBinlogs(context.Background(), connection.ID, archive, func(name string) bool {
+		return name != "binlog.000001"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// binlog.000003 is the active log and is archived by a later run.
+	if len(archived) != 1 || archived[0].FileName != "binlog.000002" || archived[0].CoveredUntil.IsZero() {
+		t.Fatalf("unexpected archived logs: %+v", archived)
+	}
+	info, err := os.Stat(filepath.Join(archive, "binlog.000002"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("archived binlog permissions = %04o, want 0600", info.Mode().Perm())
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(archive, ".*"))
+	if len(leftovers) != 0 {
+		t.Fatalf("staging or credential files were left behind: %v", leftovers)
+	}
+
+	stopAt := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	files := []string{filepath.Join(archive, "binlog.000002")}
+	if err := operator.ReplayBinlogs(context.Background(), library.ID, files, position,
+		databasetask.RecoveryTarget{StopAt: &stopAt}, io.Discard, func(int, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	replayArguments, err := os.ReadFile(filepath.Join(logDirectory, "mysqlbinlog.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"--skip-gtids", "--database=site_db", "--start-position=157",
+		"--stop-datetime=" + stopAt.Add(time.Second).In(time.Local).Format("2006-01-02 15:04:05"), files[0],
+	} {
+		if !strings.Contains(string(replayArguments), expected+"\n") {
+			t.Fatalf("mysqlbinlog arguments miss %s:\n%s", expected, replayArguments)
+		}
+	}
+	if applied, err := os.ReadFile(filepath.Join(logDirectory, "applied.sql")); err != nil || string(applied) != "REPLAYED" {
+		t.Fatalf("binlog events were not applied: %q %v", applied, err)
+	}
+	if err := operator.ReplayBinlogs(context.Background(), library.ID, files, position,
+		databasetask.RecoveryTarget{StopGTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:42"}, io.Discard, func(int, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	replayArguments, _ = os.ReadFile(filepath.Join(logDirectory, "mysqlbinlog.args"))
+	if !strings.Contains(string(replayArguments), "--include-gtids=3e11fa47-71ca-11e1-9e33-c80aa9429562:1-42\n") ||
+		strings.Contains(string(replayArguments), "root-binlog-secret") {
+		t.Fatalf("unexpected GTID replay arguments:\n%s", replayArguments)
+	}
+}
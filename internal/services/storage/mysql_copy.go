@@ -0,0 +1,400 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/router/input"
+)
+
+// CreateLibraryLike creates an empty library with its own account on the
+// connection of sourceID, for use as the target of Copy.
+func (o *MySQLDatabaseOperator) CreateLibraryLike(_ context.Context, sourceID int64, name string) (int64, error) {
+	library, _, err := loadMySQLLibrary(sourceID)
+	if err != nil {
+		return 0, err
+	}
+	credential, err := AddLibs(&input.LibParam{ID: library.PID, Name: name, Encoding: library.Encoding})
+	if err != nil {
+		return 0, err
+	}
+	return credential.LibraryID, nil
+}
+
+// DropLibrary removes a library created by CreateLibraryLike.
+func (o *MySQLDatabaseOperator) DropLibrary(_ context.Context, libraryID int64) error {
+	library, _, err := loadMySQLLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	return DeleteLibrary(&input.DeleteLibraryParam{ID: library.ID, ConfirmName: library.Name})
+}
+
+// Copy streams the tables, routines and triggers of sourceID into targetID.
+// replacements holds old/new pairs applied to string values; PHP serialized
+// strings are rewritten with their lengths recomputed. The dump is taken
+// without --databases so it never switches to the source schema.
+func (o *MySQLDatabaseOperator) Copy(
+	ctx context.Context,
+	sourceID, targetID int64,
+	replacements []string,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	if sourceID == targetID {
+		return errors.New("source and target database must differ")
+	}
+	if len(replacements)%2 != 0 {
+		return errors.New("database replacements must be old/new pairs")
+	}
+	source, sourceConnection, err := loadMySQLLibrary(sourceID)
+	if err != nil {
+		return err
+	}
+	target, targetConnection, err := loadMySQLLibrary(targetID)
+	if err != nil {
+		return err
+	}
+	dumpBinary, err := mysqlBinary("mysqldump")
+	if err != nil {
+		return err
+	}
+	mysql, err := mysqlBinary("mysql")
+	if err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp("", "oneinstack-mysql-copy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+	sourceCredential, cleanupSource, err := writeMySQLDefaultsFile(workDir, sourceConnection)
+	if err != nil {
+		return err
+	}
+	defer cleanupSource()
+	targetCredential, cleanupTarget, err := writeMySQLDefaultsFile(workDir, targetConnection)
+	if err != nil {
+		return err
+	}
+	defer cleanupTarget()
+
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dump := exec.CommandContext(
+		copyCtx,
+		dumpBinary,
+		"--defaults-extra-file="+sourceCredential,
+		"--single-transaction",
+		"--quick",
+		"--routines",
+		"--triggers",
+		"--set-gtid-purged=OFF",
+		source.Name,
+	)
+	dump.Stderr = log
+	load := exec.CommandContext(
+		copyCtx,
+		mysql,
+		"--defaults-extra-file="+targetCredential,
+		"--binary-mode=1",
+		"--database="+target.Name,
+	)
+	load.Stdout = log
+	load.Stderr = log
+	dumpOutput, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	loadInput, err := load.StdinPipe()
+	if err != nil {
+		return err
+	}
+	report(10, "正在连接 MySQL")
+	if err := load.Start(); err != nil {
+		return fmt.Errorf("start mysql: %w", err)
+	}
+	if err := dump.Start(); err != nil {
+		loadInput.Close()
+		_ = load.Wait()
+		return fmt.Errorf("start mysqldump: %w", err)
+	}
+	report(25, "正在复制数据库 "+source.Name+" 到 "+target.Name)
+	rewriteErr := rewriteSQLDump(loadInput, dumpOutput, replacements)
+	if rewriteErr != nil {
+		cancel()
+	}
+	closeErr := loadInput.Close()
+	dumpErr := dump.Wait()
+	loadErr := load.Wait()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return context.Canceled
+	}
+	var result error
+	if rewriteErr != nil {
+		result = errors.Join(result, fmt.Errorf("rewrite database dump: %w", rewriteErr))
+	}
+	if dumpErr != nil {
+		result = errors.Join(result, fmt.Errorf("mysqldump failed: %w", dumpErr))
+	}
+	if closeErr != nil {
+		result = errors.Join(result, fmt.Errorf("finish database import: %w", closeErr))
+	}
+	if loadErr != nil {
+		result = errors.Join(result, fmt.Errorf("mysql import failed: %w", loadErr))
+	}
+	if result != nil {
+		return result
+	}
+	report(100, "数据库复制完成")
+	return nil
+}
+
+// SQL lexer states used by rewriteSQLDump.
+const (
+	sqlCode = iota
+	sqlLiteral
+	sqlQuoted
+	sqlIdentifier
+	sqlLineComment
+	sqlBlockComment
+)
+
+// rewriteSQLDump copies a mysqldump stream, applying replacements inside
+// single-quoted string literals only so identifiers, keywords, comments and
+// double-quoted strings in routine and trigger bodies stay intact. Versioned
+// /*! ... */ comments hold executable SQL and are lexed as code.
+func rewriteSQLDump(destination io.Writer, source io.Reader, replacements []string) error {
+	reader := bufio.NewReaderSize(source, 64<<10)
+	writer := bufio.NewWriterSize(destination, 64<<10)
+	if len(replacements) == 0 {
+		if _, err := io.Copy(writer, reader); err != nil {
+			return err
+		}
+		return writer.Flush()
+	}
+	replacer := strings.NewReplacer(replacements...)
+	var literal bytes.Buffer
+	state, escaped := sqlCode, false
+	for {
+		char, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if state == sqlLiteral {
+			switch {
+			case escaped:
+				literal.WriteByte(char)
+				escaped = false
+			case char == '\\':
+				literal.WriteByte(char)
+				escaped = true
+			case char == '\'':
+				if next, peekErr := reader.Peek(1); peekErr == nil && next[0] == '\'' {
+					_, _ = reader.ReadByte()
+					literal.WriteString(`\'`)
+					continue
+				}
+				state = sqlCode
+				if _, err := writer.Write(rewriteSQLLiteral(literal.Bytes(), replacer)); err != nil {
+					return err
+				}
+				literal.Reset()
+				if err := writer.WriteByte(char); err != nil {
+					return err
+				}
+			default:
+				literal.WriteByte(char)
+			}
+			continue
+		}
+		if err := writer.WriteByte(char); err != nil {
+			return err
+		}
+		switch state {
+		case sqlQuoted:
+			switch {
+			case escaped:
+				escaped = false
+			case char == '\\':
+				escaped = true
+			case char == '"':
+				// A doubled quote is an escaped quote; the next byte reopens
+				// the string.
+				state = sqlCode
+			}
+		case sqlIdentifier:
+			if char == '`' {
+				state = sqlCode
+			}
+		case sqlLineComment:
+			if char == '\n' {
+				state = sqlCode
+			}
+		case sqlBlockComment:
+			if char == '*' {
+				if next, peekErr := reader.Peek(1); peekErr == nil && next[0] == '/' {
+					_, _ = reader.ReadByte()
+					if err := writer.WriteByte('/'); err != nil {
+						return err
+					}
+					state = sqlCode
+				}
+			}
+		default:
+			switch char {
+			case '\'':
+				state = sqlLiteral
+			case '"':
+				state = sqlQuoted
+			case '`':
+				state = sqlIdentifier
+			case '#':
+				state = sqlLineComment
+			case '-':
+				// "--" starts a comment only when followed by whitespace, a
+				// control character or the end of the input.
+				if next, _ := reader.Peek(2); len(next) > 0 && next[0] == '-' && (len(next) == 1 || next[1] <= ' ') {
+					state = sqlLineComment
+				}
+			case '/':
+				if next, _ := reader.Peek(2); len(next) > 0 && next[0] == '*' && (len(next) == 1 || (next[1] != '!' && next[1] != '+')) {
+					_, _ = reader.ReadByte()
+					if err := writer.WriteByte('*'); err != nil {
+						return err
+					}
+					state = sqlBlockComment
+				}
+			}
+		}
+	}
+	if state == sqlLiteral || state == sqlQuoted {
+		return errors.New("unterminated string literal")
+	}
+	return writer.Flush()
+}
+
+// rewriteSQLLiteral rewrites the body of an escaped SQL string literal and
+// returns it re-escaped, or unchanged when nothing matched.
+func rewriteSQLLiteral(escaped []byte, replacer *strings.Replacer) []byte {
+	value := unescapeSQLString(escaped)
+	rewritten := rewriteSerialized(value, replacer)
+	if rewritten == value {
+		return escaped
+	}
+	return []byte(escapeSQLString(rewritten))
+}
+
+// rewriteSerialized applies replacer to a value that may contain PHP
+// serialized data. Each s:N:"..."; segment is rewritten recursively and its
+// byte length recomputed; text between segments is replaced as is.
+func rewriteSerialized(value string, replacer *strings.Replacer) string {
+	var builder strings.Builder
+	plainStart := 0
+	for index := 0; index < len(value); {
+		content, end, ok := serializedString(value, index)
+		if !ok {
+			index++
+			continue
+		}
+		builder.WriteString(replacer.Replace(value[plainStart:index]))
+		inner := rewriteSerialized(content, replacer)
+		builder.WriteString("s:" + strconv.Itoa(len(inner)) + `:"` + inner + `";`)
+		index = end
+		plainStart = end
+	}
+	builder.WriteString(replacer.Replace(value[plainStart:]))
+	return builder.String()
+}
+
+// serializedString matches s:N:"<N bytes>"; at offset and returns the
+// content and the offset after the segment.
+func serializedString(value string, offset int) (string, int, bool) {
+	if !strings.HasPrefix(value[offset:], "s:") {
+		return "", 0, false
+	}
+	index := offset + 2
+	digits := index
+	for index < len(value) && value[index] >= '0' && value[index] <= '9' {
+		index++
+	}
+	if index == digits || index-digits > 10 || !strings.HasPrefix(value[index:], `:"`) {
+		return "", 0, false
+	}
+	length, err := strconv.Atoi(value[digits:index])
+	if err != nil {
+		return "", 0, false
+	}
+	start := index + 2
+	end := start + length
+	if end+2 > len(value) || value[end:end+2] != `";` {
+		return "", 0, false
+	}
+	return value[start:end], end + 2, true
+}
+
+func unescapeSQLString(escaped []byte) string {
+	var builder strings.Builder
+	builder.Grow(len(escaped))
+	for index := 0; index < len(escaped); index++ {
+		char := escaped[index]
+		if char != '\\' || index+1 == len(escaped) {
+			builder.WriteByte(char)
+			continue
+		}
+		index++
+		switch escaped[index] {
+		case '0':
+			builder.WriteByte(0)
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'b':
+			builder.WriteByte('\b')
+		case 'Z':
+			builder.WriteByte(0x1a)
+		default:
+			builder.WriteByte(escaped[index])
+		}
+	}
+	return builder.String()
+}
+
+// escapeSQLString escapes the same characters as mysql_real_escape_string.
+func escapeSQLString(value string) string {
+	var builder strings.Builder
+	builder.Grow(len(value) + 8)
+	for index := 0; index < len(value); index++ {
+		switch char := value[index]; char {
+		case 0:
+			builder.WriteString(`\0`)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case 0x1a:
+			builder.WriteString(`\Z`)
+		case '\\', '\'', '"':
+			builder.WriteByte('\\')
+			builder.WriteByte(char)
+		default:
+			builder.WriteByte(char)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+)
+
+func TestRewriteSQLDumpRecomputesSerializedLengths(t *testing.T) {
+	dump := "INSERT INTO `wp_options` VALUES (1,'siteurl','https://live.example.com','yes')," +
+		`(2,'widget','a:2:{s:3:\"url\";s:24:\"https://live.example.com\";s:4:\"note\";s:24:\"s:16:\"live.example.com\";\";}','yes'),` +
+		"(3,'it''s live.example.com','x');\n" +
+		"CREATE TABLE `live.example.com` (id INT);\n"
+	var output bytes.Buffer
+	if err := rewriteSQLDump(&output, strings.NewReader(dump), []string{"live.example.com", "staging.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"'https://staging.example.com'",
+		`s:27:\"https://staging.example.com\"`,
+		`s:27:\"s:19:\"staging.example.com\";\";}`,
+		`'it\'s staging.example.com'`,
+		"CREATE TABLE `live.example.com`",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Fatalf("rewritten dump is missing %q:\n%s", expected, output.String())
+		}
+	}
+	if err := rewriteSQLDump(io.Discard, strings.NewReader("INSERT INTO t VALUES ('open"), []string{"a", "b"}); err == nil {
+		t.Fatal("unterminated literal was accepted")
+	}
+}
+
+func TestRewriteSQLDumpSkipsCommentsAndDoubleQuotedStrings(t *testing.T) {
+	dump := "-- Dump of live.example.com, don't edit\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"DELIMITER ;;\n" +
+		"CREATE PROCEDURE `p`()\nBEGIN\n" +
+		"  -- don't touch live.example.com\n" +
+		"  # it's a note\n" +
+		"  /* can't stop live.example.com */\n" +
+		"  SELECT \"it's live.example.com\", \"say \"\"hi\"\"\", 'live.example.com', 1--1;\n" +
+		"END ;;\n" +
+		"DELIMITER ;\n" +
+		"/*!50003 CREATE*/ /*!50003 TRIGGER `t` BEFORE INSERT ON `x` FOR EACH ROW SET NEW.url = 'https://live.example.com' */;;\n" +
+		"INSERT INTO `x` VALUES ('live.example.com');\n"
+	var output bytes.Buffer
+	if err := rewriteSQLDump(&output, strings.NewReader(dump), []string{"live.example.com", "staging.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.NewReplacer(
+		"'live.example.com'", "'staging.example.com'",
+		"'https://live.example.com'", "'https://staging.example.com'",
+	).Replace(dump)
+	if output.String() != expected {
+		t.Fatalf("unexpected rewritten dump:\n%s", output.String())
+	}
+}
+
+func TestMySQLDatabaseOperatorCopyPipesRewrittenDumpIntoTarget(t *testing.T) {
+	prepareStorageTest(t)
+	binDirectory := t.TempDir()
+	argumentLog := filepath.Join(t.TempDir(), "dump-args.log")
+	importLog := filepath.Join(t.TempDir(), "import.sql")
+	t.Setenv("MYSQL_ARGS_LOG", argumentLog)
+	t.Setenv("MYSQL_IMPORT_LOG", importLog)
+	t.Setenv("ONEINSTACK_MYSQL_BIN_DIR", binDirectory)
+	for name, content := range map[string]string{
+		"mysqldump": "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$MYSQL_ARGS_LOG\"\nprintf '%s' \"INSERT INTO t VALUES ('http://live.example.com');\"\n",
+		"mysql":     "#!/bin/sh\nprintf '%s\\n' \"$@\" >> \"$MYSQL_ARGS_LOG.import\"\ncat > \"$MYSQL_IMPORT_LOG\"\n",
+	} {
+		if err := os.WriteFile(filepath.Join(binDirectory, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connection := &models.Storage{Addr: "127.0.0.1", Port: "3306", Root: "root", Type: "mysql"}
+	if err := app.DB().Create(connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	source := &models.Library{PID: connection.ID, Name: "live_db", Type: "mysql"}
+	target := &models.Library{PID: connection.ID, Name: "staging_db", Type: "mysql"}
+	for _, library := range []*models.Library{source, target} {
+		if err := app.DB().Create(library).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	operator := NewMySQLDatabaseOperator()
+	if err := operator.Copy(context.Background(), source.ID, source.ID, nil, io.Discard, func(int, string) {}); err == nil {
+		t.Fatal("copy onto itself was accepted")
+	}
+	if err := operator.Copy(
+		context.Background(), source.ID, target.ID,
+		[]string{"live.example.com", "staging.example.com"},
+		io.Discard, func(int, string) {},
+	); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := os.ReadFile(importLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(imported) != "INSERT INTO t VALUES ('http://staging.example.com');" {
+		t.Fatalf("unexpected imported SQL: %q", imported)
+	}
+	arguments, err := os.ReadFile(argumentLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(arguments), "--databases") || !strings.HasSuffix(string(arguments), "live_db\n") {
+		t.Fatalf("dump would switch schemas: %s", arguments)
+	}
+	importArguments, err := os.ReadFile(argumentLog + ".import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(importArguments), "--database=staging_db") {
+		t.Fatalf("dump was not loaded into the target: %s", importArguments)
+	}
+}
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PostgresOP manages a PostgreSQL server through psql. Statements, including
+// the ones carrying role passwords, are written to stdin and the connection
+// password is read from a private passfile, so no secret reaches the process
+// arguments or environment.
+type PostgresOP struct {
+	ID       int64
+	Addr     string
+	Port     string
+	Root     string
+	Password string
+	Type     string
+	Lib      string
+}
+
+const (
+	postgresMaintenanceDatabase = "postgres"
+	postgresCommandTimeout      = 30 * time.Second
+)
+
+var postgresIdentifierPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+func NewPostgresOP(p *models.Storage, lib string) *PostgresOP {
+	return &PostgresOP{
+		ID:       p.ID,
+		Addr:     p.Addr,
+		Port:     p.Port,
+		Root:     p.Root,
+		Password: p.Password,
+		Type:     p.Type,
+		Lib:      lib,
+	}
+}
+
+// Connect verifies the credential. psql opens a session per call, so there
+// is no connection to keep.
+func (s *PostgresOP) Connect() error {
+	_, err := s.query(s.database(), "SELECT 1;")
+	return err
+}
+
+func (s *PostgresOP) Close() error {
+	return nil
+}
+
+func (s *PostgresOP) Sync() error {
+	output, err := s.query(postgresMaintenanceDatabase, `
+		SELECT d.datname, pg_database_size(d.oid), pg_encoding_to_char(d.encoding), r.rolname
+		FROM pg_database d
+		JOIN pg_roles r ON r.oid = d.datdba
+		WHERE d.datallowconn AND NOT d.datistemplate AND d.datname <> 'postgres'
+		ORDER BY d.datname;
+	`)
+	if err != nil {
+		return err
+	}
+	ls := []models.Library{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseFloat(fields[1], 64)
+		l := models.Library{
+			PID:      s.ID,
+			Name:     fields[0],
+			Encoding: fields[2],
+			Capacity: ConvertBytes(size),
+			PAddr:    fmt.Sprintf("%s:%v", s.Addr, s.Port),
+			Type:     s.Type,
+		}
+		// 数据库属主即业务账号，管理员账号不作为数据库用户展示
+		if fields[3] != s.Root {
+			l.User = fields[3]
+		}
+		ls = append(ls, l)
+	}
+	return app.DB().Transaction(func(tx *gorm.DB) error {
+		return persistSyncedLibraries(tx, s.ID, "postgres", ls)
+	})
+}
+
+func (s *PostgresOP) CreateLibrary(lb *models.Library) error {
+	lib := s.Lib
+	if err := validatePostgresIdentifier(lib); err != nil {
+		return err
+	}
+	if err := validatePostgresIdentifier(lb.User); err != nil {
+		return fmt.Errorf("invalid database username: %w", err)
+	}
+	if lb.User == s.Root {
+		return fmt.Errorf("database user cannot be the connection administrator")
+	}
+	encoding, err := postgresEncoding(lb.Encoding)
+	if err != nil {
+		return err
+	}
+	output, err := s.query(postgresMaintenanceDatabase, fmt.Sprintf(
+		"SELECT (SELECT count(*) FROM pg_database WHERE datname = %s), (SELECT count(*) FROM pg_roles WHERE rolname = %s);",
+		quotePostgresLiteral(lib), quotePostgresLiteral(lb.User),
+	))
+	if err != nil {
+		return err
+	}
+	switch strings.TrimSpace(output) {
+	case "0\t0":
+	case "0\t1", "1\t1":
+		return fmt.Errorf("database user %s already exists", lb.User)
+	default:
+		return fmt.Errorf("database %s already exists", lib)
+	}
+	database := quotePostgresIdentifier(lib)
+	role := quotePostgresIdentifier(lb.User)
+	if _, err := s.query(postgresMaintenanceDatabase,
+		"CREATE ROLE "+role+" LOGIN PASSWORD "+quotePostgresLiteral(lb.Password)+";",
+	); err != nil {
+		return err
+	}
+	cleanup := func() {
+		_, _ = s.query(postgresMaintenanceDatabase,
+			"DROP DATABASE IF EXISTS "+database+";\nDROP ROLE IF EXISTS "+role+";")
+	}
+	// CREATE DATABASE cannot run inside a transaction block, so every
+	// statement is sent on its own line and psql autocommits each one.
+	if _, err := s.query(postgresMaintenanceDatabase,
+		"CREATE DATABASE "+database+" OWNER "+role+
+			" ENCODING "+quotePostgresLiteral(encoding)+" TEMPLATE template0;\n"+
+			"REVOKE ALL ON DATABASE "+database+" FROM PUBLIC;\n"+
+			"GRANT ALL PRIVILEGES ON DATABASE "+database+" TO "+role+";",
+	); err != nil {
+		cleanup()
+		return err
+	}
+	credentialCheck := &PostgresOP{
+		Addr: s.Addr, Port: s.Port, Root: lb.User,
+		Password: lb.Password, Type: s.Type, Lib: lib,
+	}
+	if err := credentialCheck.Connect(); err != nil {
+		cleanup()
+		return fmt.Errorf("verify database user credential: %w", err)
+	}
+	log.Println("PostgreSQL database and owner role created successfully.")
+	return nil
+}
+
+func (s *PostgresOP) DeleteLibrary(lb *models.Library) error {
+	if err := validatePostgresIdentifier(lb.Name); err != nil {
+		return err
+	}
+	if lb.User != "" {
+		if err := validatePostgresIdentifier(lb.User); err != nil {
+			return fmt.Errorf("invalid database username: %w", err)
+		}
+	}
+	database := quotePostgresIdentifier(lb.Name)
+	if _, err := s.query(postgresMaintenanceDatabase,
+		"REVOKE CONNECT ON DATABASE "+database+" FROM PUBLIC;\n"+
+			"SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity WHERE datname = "+
+			quotePostgresLiteral(lb.Name)+" AND pid <> pg_backend_pid();\n"+
+			"DROP DATABASE "+database+";",
+	); err != nil {
+		return err
+	}
+	if lb.User != "" && lb.User != s.Root {
+		if _, err := s.query(postgresMaintenanceDatabase,
+			"DROP ROLE IF EXISTS "+quotePostgresIdentifier(lb.User)+";",
+		); err != nil {
+			return fmt.Errorf("database removed but user cleanup failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresOP) UpdateLibraryPassword(lb *models.Library, password string) error {
+	if err := validatePostgresIdentifier(lb.User); err != nil {
+		return fmt.Errorf("invalid database username: %w", err)
+	}
+	if lb.User == s.Root {
+		return fmt.Errorf("the connection administrator password is managed on the connection")
+	}
+	if _, err := s.query(postgresMaintenanceDatabase,
+		"ALTER ROLE "+quotePostgresIdentifier(lb.User)+" WITH PASSWORD "+quotePostgresLiteral(password)+";",
+	); err != nil {
+		return fmt.Errorf("update database user password: %w", err)
+	}
+	credentialCheck := &PostgresOP{
+		Addr: s.Addr, Port: s.Port, Root: lb.User,
+		Password: password, Type: s.Type, Lib: lb.Name,
+	}
+	if err := credentialCheck.Connect(); err != nil {
+		return fmt.Errorf("verify updated database user credential: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresOP) database() string {
+	if s.Lib == "" {
+		return postgresMaintenanceDatabase
+	}
+	return s.Lib
+}
+
+// query runs script with psql against database and returns the unaligned,
+// tab separated rows it prints.
+func (s *PostgresOP) query(database, script string) (string, error) {
+	psql, err := postgresBinary("psql")
+	if err != nil {
+		return "", err
+	}
+	connection := &models.Storage{Addr: s.Addr, Port: s.Port, Root: s.Root, Password: s.Password}
+	passfile, cleanup, err := writePostgresPassfile(os.TempDir(), connection)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), postgresCommandTimeout)
+	defer cancel()
+	command := exec.CommandContext(ctx, psql, append(
+		postgresConnectionArguments(connection, database),
+		"--no-psqlrc", "--quiet", "--tuples-only", "--no-align",
+		"--field-separator=\t", "--set=ON_ERROR_STOP=1",
+	)...)
+	command.Env = postgresCommandEnvironment(passfile)
+	command.Stdin = strings.NewReader("SET standard_conforming_strings = on;\n" + script)
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return "", fmt.Errorf("psql failed: %w", err)
+		}
+		return "", fmt.Errorf("psql failed: %s", message)
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+func postgresBinary(name string) (string, error) {
+	return databaseBinary("ONEINSTACK_POSTGRES_BIN_DIR", name, "/usr/local/pgsql/bin", "/usr/bin")
+}
+
+func postgresConnectionArguments(connection *models.Storage, database string) []string {
+	return []string{
+		"--host=" + connection.Addr,
+		"--port=" + connection.Port,
+		"--username=" + connection.Root,
+		"--dbname=" + database,
+		"--no-password",
+	}
+}
+
+// postgresCommandEnvironment points libpq at the passfile and drops any
+// inherited PG* variables that could redirect the connection.
+func postgresCommandEnvironment(passfile string) []string {
+	environment := []string{"PGPASSFILE=" + passfile, "PGCONNECT_TIMEOUT=5"}
+	for _, item := range os.Environ() {
+		if !strings.HasPrefix(item, "PG") {
+			environment = append(environment, item)
+		}
+	}
+	return environment
+}
+
+func writePostgresPassfile(directory string, connection *models.Storage) (string, func(), error) {
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return "", func() {}, err
+	}
+	file, err := os.CreateTemp(directory, ".pgpass-*")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("create PostgreSQL credential file: %w", err)
+	}
+	path := file.Name()
+	cleanup := func() {
+		_ = os.Remove(path)
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		cleanup()
+		return "", func() {}, err
+	}
+	if strings.ContainsAny(connection.Root+connection.Password, "\r\n") {
+		file.Close()
+		cleanup()
+		return "", func() {}, errors.New("PostgreSQL credential cannot contain line breaks")
+	}
+	content := "*:*:*:" + escapePostgresPassfileField(connection.Root) + ":" +
+		escapePostgresPassfileField(connection.Password) + "\n"
+	if _, err := io.WriteString(file, content); err != nil {
+		file.Close()
+		cleanup()
+		return "", func() {}, fmt.Errorf("write PostgreSQL credential file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return path, cleanup, nil
+}
+
+func escapePostgresPassfileField(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(value)
+}
+
+// validatePostgresIdentifier keeps names within NAMEDATALEN and restricted
+// to characters that never need case folding or escaping in psql.
+func validatePostgresIdentifier(value string) error {
+	if len(value) < 1 || len(value) > 63 || !postgresIdentifierPattern.MatchString(value) {
+		return fmt.Errorf("identifier must start with a letter, contain only letters, numbers, or underscores, and be at most 63 characters")
+	}
+	return nil
+}
+
+func quotePostgresIdentifier(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+func quotePostgresLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// postgresEncoding maps the encodings offered for MySQL libraries to a server
+// encoding. GBK and Big5 are client-only encodings in PostgreSQL.
+func postgresEncoding(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "utf8", "utf8mb4", "utf8mb3":
+		return "UTF8", nil
+	default:
+		return "", fmt.Errorf("unsupported PostgreSQL database encoding: %s", value)
+	}
+}
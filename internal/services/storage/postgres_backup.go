@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+)
+
+// PostgresDatabaseOperator executes PostgreSQL backups as pg_dump custom
+// archives and restores them with pg_restore. Credentials are passed through
+// a private passfile only.
+type PostgresDatabaseOperator struct{}
+
+func NewPostgresDatabaseOperator() *PostgresDatabaseOperator {
+	return &PostgresDatabaseOperator{}
+}
+
+func (o *PostgresDatabaseOperator) Backup(
+	ctx context.Context,
+	libraryID int64,
+	destination string,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	library, connection, err := loadPostgresLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	dumpBinary, err := postgresBinary("pg_dump")
+	if err != nil {
+		return err
+	}
+	restoreBinary, err := postgresBinary("pg_restore")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0750); err != nil {
+		return fmt.Errorf("create backup directory: %w", err)
+	}
+	passfile, cleanup, err := writePostgresPassfile(filepath.Dir(destination), connection)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if err := checkDatabaseBackupDiskSpace(filepath.Dir(destination), libraryID); err != nil {
+		return err
+	}
+	partial := destination + ".partial"
+	_ = os.Remove(partial)
+	// pg_dump truncates the file it is given, so creating it first keeps the
+	// archive private from the first byte.
+	placeholder, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("create database backup file: %w", err)
+	}
+	if err := placeholder.Close(); err != nil {
+		return fmt.Errorf("create database backup file: %w", err)
+	}
+	removePartial := true
+	defer func() {
+		if removePartial {
+			_ = os.Remove(partial)
+		}
+	}()
+
+	report(10, "正在连接 PostgreSQL")
+	command := exec.CommandContext(ctx, dumpBinary, append(
+		postgresConnectionArguments(connection, library.Name),
+		"--format=custom",
+		"--compress=6",
+		"--file="+partial,
+	)...)
+	command.Env = postgresCommandEnvironment(passfile)
+	command.Stdout = log
+	command.Stderr = log
+	report(25, "正在导出并压缩数据库")
+	if err := command.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return context.Canceled
+		}
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+
+	// pg_restore reads the table of contents of the archive, so a truncated
+	// or foreign file is rejected before it is published as a backup.
+	report(80, "正在校验备份文件")
+	verify := exec.CommandContext(ctx, restoreBinary, "--list", partial)
+	verify.Env = postgresCommandEnvironment(passfile)
+	verify.Stdout = io.Discard
+	verify.Stderr = log
+	if err := verify.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return context.Canceled
+		}
+		return fmt.Errorf("verify database backup archive: %w", err)
+	}
+	if err := syncFile(partial); err != nil {
+		return fmt.Errorf("sync database backup file: %w", err)
+	}
+	report(90, "正在发布备份文件")
+	if err := os.Rename(partial, destination); err != nil {
+		return fmt.Errorf("publish database backup file: %w", err)
+	}
+	removePartial = false
+	report(100, "数据库备份导出完成")
+	return nil
+}
+
+func (o *PostgresDatabaseOperator) Restore(
+	ctx context.Context,
+	libraryID int64,
+	source string,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	library, connection, err := loadPostgresLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	restoreBinary, err := postgresBinary("pg_restore")
+	if err != nil {
+		return err
+	}
+	passfile, cleanup, err := writePostgresPassfile(filepath.Dir(source), connection)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	arguments := append(
+		postgresConnectionArguments(connection, library.Name),
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--exit-on-error",
+		"--single-transaction",
+	)
+	// Restored objects belong to the database owner rather than to the
+	// administrator running pg_restore.
+	if library.User != "" && library.User != connection.Root {
+		arguments = append(arguments, "--role="+library.User)
+	}
+	arguments = append(arguments, source)
+
+	report(10, "正在连接 PostgreSQL")
+	command := exec.CommandContext(ctx, restoreBinary, arguments...)
+	command.Env = postgresCommandEnvironment(passfile)
+	command.Stdout = log
+	command.Stderr = log
+	report(25, "正在恢复数据库，请勿中断服务")
+	if err := command.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return context.Canceled
+		}
+		return fmt.Errorf("pg_restore failed: %w", err)
+	}
+	report(100, "数据库恢复完成")
+	return nil
+}
+
+func loadPostgresLibrary(libraryID int64) (*models.Library, *models.Storage, error) {
+	if libraryID <= 0 {
+		return nil, nil, errors.New("database is required")
+	}
+	var library models.Library
+	if err := app.DB().First(&library, libraryID).Error; err != nil {
+		return nil, nil, err
+	}
+	if library.Type != "postgres" {
+		return nil, nil, errors.New("database is not a PostgreSQL database")
+	}
+	if err := validatePostgresIdentifier(library.Name); err != nil {
+		return nil, nil, err
+	}
+	if library.User != "" {
+		if err := validatePostgresIdentifier(library.User); err != nil {
+			return nil, nil, fmt.Errorf("invalid database owner: %w", err)
+		}
+	}
+	connection, err := loadStorage(library.PID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if connection.Type != "postgres" {
+		return nil, nil, errors.New("database connection is not PostgreSQL")
+	}
+	port, err := strconv.Atoi(connection.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, nil, errors.New("database connection port is invalid")
+	}
+	return &library, connection, nil
+}
+
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DatabaseOperator routes database backups and restores to the operator of
+// the library's engine.
+type DatabaseOperator struct {
+	mysql    *MySQLDatabaseOperator
+	postgres *PostgresDatabaseOperator
+}
+
+func NewDatabaseOperator() *DatabaseOperator {
+	return &DatabaseOperator{
+		mysql:    NewMySQLDatabaseOperator(),
+		postgres: NewPostgresDatabaseOperator(),
+	}
+}
+
+func (o *DatabaseOperator) Backup(
+	ctx context.Context,
+	libraryID int64,
+	destination string,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	operator, err := o.forLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	return operator.Backup(ctx, libraryID, destination, log, report)
+}
+
+func (o *DatabaseOperator) Restore(
+	ctx context.Context,
+	libraryID int64,
+	source string,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	operator, err := o.forLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	return operator.Restore(ctx, libraryID, source, log, report)
+}
+
+func (o *DatabaseOperator) forLibrary(libraryID int64) (databasetask.Operator, error) {
+	var library models.Library
+	if err := app.DB().Select("id", "type").First(&library, libraryID).Error; err != nil {
+		return nil, err
+	}
+	switch library.Type {
+	case "mysql":
+		return o.mysql, nil
+	case "postgres":
+		return o.postgres, nil
+	}
+	return nil, fmt.Errorf("database backup is not supported for %s", library.Type)
+}
+
+// BackupPosition returns the binlog coordinates of MySQL backups; other
+// engines have none.
+func (o *DatabaseOperator) BackupPosition(libraryID int64, path string) (string, int64, error) {
+	operator, err := o.forLibrary(libraryID)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, ok := operator.(*MySQLDatabaseOperator); !ok {
+		return "", 0, nil
+	}
+	return o.mysql.BackupPosition(libraryID, path)
+}
+
+func (o *DatabaseOperator) ArchiveBinlogs(
+	ctx context.Context,
+	connectionID int64,
+	directory string,
+	wanted func(fileName string) bool,
+) ([]databasetask.ArchivedBinlog, error) {
+	return o.mysql.ArchiveBinlogs(ctx, connectionID, directory, wanted)
+}
+
+func (o *DatabaseOperator) ReplayBinlogs(
+	ctx context.Context,
+	libraryID int64,
+	files []string,
+	position int64,
+	target databasetask.RecoveryTarget,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	operator, err := o.forLibrary(libraryID)
+	if err != nil {
+		return err
+	}
+	if _, ok := operator.(*MySQLDatabaseOperator); !ok {
+		return errors.New("point-in-time restore is supported for MySQL only")
+	}
+	return o.mysql.ReplayBinlogs(ctx, libraryID, files, position, target, log, report)
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/app"
+	"oneinstack/internal/models"
+	"oneinstack/router/input"
+	"oneinstack/utils"
+)
+
+// preparePostgresTools installs fake client tools that record their
+// arguments, stdin, and passfile, and answer the catalog queries Panel sends.
+func preparePostgresTools(t *testing.T) string {
+	t.Helper()
+	binDirectory := t.TempDir()
+	logDirectory := t.TempDir()
+	t.Setenv("ONEINSTACK_POSTGRES_BIN_DIR", binDirectory)
+	t.Setenv("POSTGRES_TEST_LOG", logDirectory)
+	t.Setenv("PGHOST", "attacker.example.com")
+	tools := map[string]string{
+		"psql": `#!/bin/sh
+[ -z "$PGHOST" ] || exit 3
+printf '%s\n' "$@" >> "$POSTGRES_TEST_LOG/psql.args"
+cat "$PGPASSFILE" >> "$POSTGRES_TEST_LOG/passfiles"
+script=$(cat)
+printf '%s\n' "$script" >> "$POSTGRES_TEST_LOG/psql.sql"
+case "$script" in
+*"FROM pg_database d"*) printf 'app_db\t2048\tUTF8\tapp_db\nlegacy\t0\tUTF8\tpostgres\n' ;;
+*"count(*) FROM pg_database"*) printf '0\t0\n' ;;
+esac
+`,
+		"pg_dump": `#!/bin/sh
+printf '%s\n' "$@" > "$POSTGRES_TEST_LOG/pg_dump.args"
+for argument in "$@"; do
+	case "$argument" in --file=*) printf 'PGDMP archive' > "${argument#--file=}" ;; esac
+done
+`,
+		"pg_restore": `#!/bin/sh
+if [ "$1" = "--list" ]; then
+	grep -q '^PGDMP' "$2"
+	exit $?
+fi
+printf '%s\n' "$@" > "$POSTGRES_TEST_LOG/pg_restore.args"
+`,
+	}
+	for name, content := range tools {
+		if err := os.WriteFile(filepath.Join(binDirectory, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return logDirectory
+}
+
+func createPostgresConnection(t *testing.T) *models.Storage {
+	t.Helper()
+	encrypted, err := utils.EncryptCredential("pg:admin\\secret", utils.CredentialPurposeStoragePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := &models.Storage{
+		Addr: "127.0.0.1", Port: "5432", Root: "postgres", Password: encrypted, Type: "postgres",
+	}
+	if err := app.DB().Create(connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	return connection
+}
+
+func TestPostgresLibraryLifecycleKeepsSecretsOutOfArguments(t *testing.T) {
+	prepareStorageTest(t)
+	logDirectory := preparePostgresTools(t)
+	connection := createPostgresConnection(t)
+
+	credential, err := AddLibs(&input.LibParam{ID: connection.ID, Name: "app_db", Encoding: "utf8mb4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := os.ReadFile(filepath.Join(logDirectory, "psql.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`CREATE ROLE "app_db" LOGIN PASSWORD '` + credential.Password + `';`,
+		`CREATE DATABASE "app_db" OWNER "app_db" ENCODING 'UTF8' TEMPLATE template0;`,
+		`REVOKE ALL ON DATABASE "app_db" FROM PUBLIC;`,
+	} {
+		if !strings.Contains(string(script), expected) {
+			t.Fatalf("missing statement %q in:\n%s", expected, script)
+		}
+	}
+	passfiles, err := os.ReadFile(filepath.Join(logDirectory, "passfiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(passfiles), `*:*:*:postgres:pg\:admin\\secret`) ||
+		!strings.Contains(string(passfiles), "*:*:*:app_db:"+credential.Password) {
+		t.Fatalf("unexpected passfiles:\n%s", passfiles)
+	}
+	arguments, err := os.ReadFile(filepath.Join(logDirectory, "psql.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(arguments), "secret") || strings.Contains(string(arguments), credential.Password) {
+		t.Fatalf("secret leaked into psql arguments:\n%s", arguments)
+	}
+
+	var stored models.Library
+	if err := app.DB().First(&stored, credential.LibraryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Type != "postgres" || stored.User != "app_db" || stored.Password == credential.Password {
+		t.Fatalf("unexpected library metadata: %+v", stored)
+	}
+	if revealed, err := GetLibraryCredential(stored.ID); err != nil || revealed.Password != credential.Password {
+		t.Fatalf("credential was not revealed: %+v %v", revealed, err)
+	}
+	if _, err := UpdateLibraryCredential(stored.ID, "rotated-password-1234"); err != nil {
+		t.Fatal(err)
+	}
+	script, _ = os.ReadFile(filepath.Join(logDirectory, "psql.sql"))
+	if !strings.Contains(string(script), `ALTER ROLE "app_db" WITH PASSWORD 'rotated-password-1234';`) {
+		t.Fatalf("password was not rotated:\n%s", script)
+	}
+
+	if err := Sync(&input.IDParam{ID: connection.ID}); err != nil {
+		t.Fatal(err)
+	}
+	var synced []models.Library
+	if err := app.DB().Where("p_id = ?", connection.ID).Order("name").Find(&synced).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 2 || synced[0].ID != stored.ID || synced[0].Capacity != "2.00 KB" ||
+		synced[1].Name != "legacy" || synced[1].User != "" {
+		t.Fatalf("unexpected synced libraries: %+v", synced)
+	}
+
+	if err := DeleteLibrary(&input.DeleteLibraryParam{ID: stored.ID, ConfirmName: "app_db"}); err != nil {
+		t.Fatal(err)
+	}
+	script, _ = os.ReadFile(filepath.Join(logDirectory, "psql.sql"))
+	if !strings.Contains(string(script), `DROP DATABASE "app_db";`) ||
+		!strings.Contains(string(script), `DROP ROLE IF EXISTS "app_db";`) {
+		t.Fatalf("library was not dropped:\n%s", script)
+	}
+}
+
+func TestPostgresDatabaseOperatorBackupAndRestoreCommandContract(t *testing.T) {
+	prepareStorageTest(t)
+	logDirectory := preparePostgresTools(t)
+	connection := createPostgresConnection(t)
+	library := &models.Library{PID: connection.ID, Name: "app_db", User: "app_db", Type: "postgres"}
+	if err := app.DB().Create(library).Error; err != nil {
+		t.Fatal(err)
+	}
+	operator := NewDatabaseOperator()
+	destination := filepath.Join(t.TempDir(), "backup.dump")
+	if err := operator.Backup(context.Background(), library.ID, destination, io.Discard, func(int, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("backup permissions = %04o, want 0600", info.Mode().Perm())
+	}
+	dumpArguments, err := os.ReadFile(filepath.Join(logDirectory, "pg_dump.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dumpArguments), "--format=custom") ||
+		!strings.Contains(string(dumpArguments), "--dbname=app_db") ||
+		strings.Contains(string(dumpArguments), "secret") {
+		t.Fatalf("unexpected pg_dump arguments:\n%s", dumpArguments)
+	}
+
+	if err := operator.Restore(context.Background(), library.ID, destination, io.Discard, func(int, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	restoreArguments, err := os.ReadFile(filepath.Join(logDirectory, "pg_restore.args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"--clean", "--single-transaction", "--exit-on-error", "--role=app_db", destination} {
+		if !strings.Contains(string(restoreArguments), expected+"\n") {
+			t.Fatalf("pg_restore arguments miss %s:\n%s", expected, restoreArguments)
+		}
+	}
+
+	// A file that is not a pg_dump archive is never published.
+	if err := os.WriteFile(filepath.Join(os.Getenv("ONEINSTACK_POSTGRES_BIN_DIR"), "pg_dump"),
+		[]byte("#!/bin/sh\nfor a in \"$@\"; do case \"$a\" in --file=*) printf truncated > \"${a#--file=}\" ;; esac; done\n"),
+		0755); err != nil {
+		t.Fatal(err)
+	}
+	rejected := filepath.Join(t.TempDir(), "rejected.dump")
+	if err := operator.Backup(context.Background(), library.ID, rejected, io.Discard, func(int, string) {}); err == nil {
+		t.Fatal("unverifiable archive was published")
+	}
+	if _, err := os.Stat(rejected); !os.IsNotExist(err) {
+		t.Fatalf("rejected archive exists: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(rejected), "*"))
+	if len(leftovers) != 0 {
+		t.Fatalf("temporary files were not removed: %v", leftovers)
+	}
+}
@@ -152,8 +152,8 @@ func AddLibs(param *input.LibParam) (*output.DatabaseCredential, error) {
 	if err != nil {
 		return nil, err
 	}
-	if s.Type != "mysql" {
-		return nil, fmt.Errorf("creating logical databases is supported only for MySQL connections")
+	if s.Type != "mysql" && s.Type != "postgres" {
+		return nil, fmt.Errorf("creating logical databases is supported only for MySQL and PostgreSQL connections")
 	}
 	param.Root = param.Name
 	if strings.TrimSpace(param.Password) == "" {
@@ -231,7 +231,7 @@ func Sync(param *input.IDParam) error {
 	if err != nil {
 		return err
 	}
-	op, err := newStorageOP(m, "information_schema")
+	op, err := newStorageOP(m, syncLibrary(m.Type))
 	if err != nil {
 		return err
 	}
@@ -317,14 +317,14 @@ func DeleteLibrary(param *input.DeleteLibraryParam) error {
 	if strings.TrimSpace(param.ConfirmName) != library.Name {
 		return fmt.Errorf("database confirmation name does not match")
 	}
-	if isSystemDatabase(library.Name) {
+	if isSystemDatabase(library.Type, library.Name) {
 		return fmt.Errorf("system database %s cannot be deleted", library.Name)
 	}
 	connection, err := loadStorage(library.PID)
 	if err != nil {
 		return err
 	}
-	if connection.Type != "mysql" {
+	if connection.Type == "redis" {
 		return fmt.Errorf("deleting Redis logical databases is not supported")
 	}
 	op, err := newStorageOP(connection, "")
@@ -501,7 +501,7 @@ func GetLibraryCredential(id int64) (*output.DatabaseCredential, error) {
 		}
 		return nil, fmt.Errorf("load database library id=%d: %w", id, err)
 	}
-	if library.Type != "mysql" || strings.TrimSpace(library.User) == "" {
+	if !managedAccountLibrary(&library) {
 		return nil, fmt.Errorf("%w: id=%d", ErrLibraryCredentialUnavailable, id)
 	}
 	password, err := utils.DecryptCredential(
@@ -538,8 +538,8 @@ func UpdateLibraryCredential(id int64, password string) (*output.DatabaseCredent
 	if err := app.DB().First(&library, id).Error; err != nil {
 		return nil, err
 	}
-	if library.Type != "mysql" || strings.TrimSpace(library.User) == "" {
-		return nil, fmt.Errorf("database does not have a managed MySQL account")
+	if !managedAccountLibrary(&library) {
+		return nil, fmt.Errorf("database does not have a managed account")
 	}
 	oldPassword, err := utils.DecryptCredential(
 		library.Password,
@@ -589,11 +589,7 @@ func UpdateLibraryCredential(id int64, password string) (*output.DatabaseCredent
 }
 
 func testStorageConnection(storage *models.Storage) error {
-	lib := ""
-	if storage.Type == "mysql" {
-		lib = "information_schema"
-	}
-	op, err := newStorageOP(storage, lib)
+	op, err := newStorageOP(storage, syncLibrary(storage.Type))
 	if err != nil {
 		return err
 	}
@@ -725,8 +721,30 @@ func libraryPageOutput(
 	}
 }
 
-func isSystemDatabase(name string) bool {
-	switch strings.ToLower(strings.TrimSpace(name)) {
+// syncLibrary names the database a connection opens to read the catalog.
+func syncLibrary(storageType string) string {
+	switch storageType {
+	case "mysql":
+		return "information_schema"
+	case "postgres":
+		return postgresMaintenanceDatabase
+	}
+	return ""
+}
+
+// managedAccountLibrary reports whether the library has a dedicated account
+// whose credential Panel can reveal and rotate.
+func managedAccountLibrary(library *models.Library) bool {
+	return (library.Type == "mysql" || library.Type == "postgres") &&
+		strings.TrimSpace(library.User) != ""
+}
+
+func isSystemDatabase(libraryType, name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if libraryType == "postgres" {
+		return name == "postgres" || name == "template0" || name == "template1"
+	}
+	switch name {
 	case "information_schema", "mysql", "performance_schema", "sys":
 		return true
 	default:
@@ -22,6 +22,8 @@ func NewStorageOP(p *models.Storage, lib string) (StorageOPI, error) {
 		return NewMysqlOP(p, lib), nil
 	case "redis":
 		return NewRedisOP(p), nil
+	case "postgres":
+		return NewPostgresOP(p, lib), nil
 	}
 	return nil, fmt.Errorf("未知的存储服务")
 }
@@ -0,0 +1,378 @@
+package website
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TrafficDimensionURL      = "url"
+	TrafficDimensionStatus   = "status"
+	TrafficDimensionClientIP = "client_ip"
+	TrafficDimensionReferer  = "referer"
+	TrafficDimensionAgent    = "agent"
+
+	trafficHourLayout      = "2006-01-02 15"
+	maxTrafficTopValues    = 100
+	maxTrafficTopValueLen  = 255
+	trafficAnalyticsMaxAge = 31
+	defaultTrafficDays     = 7
+	defaultTrafficTopLimit = 10
+	maxTrafficTopLimit     = 100
+)
+
+// trafficLatencyBoundsMs are the upper bounds of the request_time buckets; the
+// final bucket collects everything slower.
+var trafficLatencyBoundsMs = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var trafficBotPattern = regexp.MustCompile(
+	`(?i)bot\b|bot/|crawl|spider|slurp|bingpreview|facebookexternalhit|headless|curl/|wget/|python-requests|go-http-client`,
+)
+
+var trafficDimensions = []string{
+	TrafficDimensionURL, TrafficDimensionStatus, TrafficDimensionClientIP,
+	TrafficDimensionReferer, TrafficDimensionAgent,
+}
+
+type TrafficAnalyticsQuery struct {
+	From  string
+	To    string
+	Limit int
+}
+
+type TrafficTopEntry struct {
+	Value        string `json:"value"`
+	RequestCount int64  `json:"request_count"`
+	BytesSent    int64  `json:"bytes_sent"`
+}
+
+// TrafficLatency reports request_time percentiles as bucket upper bounds in
+// milliseconds. A zero value means no request in the range logged a time.
+type TrafficLatency struct {
+	Samples int64   `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+}
+
+type TrafficAnalytics struct {
+	From          string                       `json:"from"`
+	To            string                       `json:"to"`
+	RequestCount  int64                        `json:"request_count"`
+	BytesSent     int64                        `json:"bytes_sent"`
+	BotRequests   int64                        `json:"bot_requests"`
+	StatusClasses map[string]int64             `json:"status_classes"`
+	RequestTime   TrafficLatency               `json:"request_time"`
+	Top           map[string][]TrafficTopEntry `json:"top"`
+}
+
+type TrafficHour struct {
+	models.WebsiteTrafficHourly
+	RequestTime TrafficLatency `json:"request_time"`
+}
+
+// TrafficAnalytics summarizes a website's access log between two days
+// (inclusive, log-local dates).
+func (service *Service) TrafficAnalytics(id int64, query TrafficAnalyticsQuery) (*TrafficAnalytics, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	from, to, err := normalizeTrafficRange(query)
+	if err != nil {
+		return nil, err
+	}
+	var hours []models.WebsiteTrafficHourly
+	if err := service.DB.Where("website_id = ? AND hour >= ? AND hour <= ?", id, from+" 00", to+" 23").
+		Find(&hours).Error; err != nil {
+		return nil, err
+	}
+	result := &TrafficAnalytics{
+		From: from, To: to,
+		StatusClasses: map[string]int64{"2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0},
+		Top:           make(map[string][]TrafficTopEntry, len(trafficDimensions)),
+	}
+	latency := make([]int64, len(trafficLatencyBoundsMs)+1)
+	for _, hour := range hours {
+		result.RequestCount += hour.RequestCount
+		result.BytesSent += hour.BytesSent
+		result.BotRequests += hour.BotRequests
+		result.StatusClasses["2xx"] += hour.Status2xx
+		result.StatusClasses["3xx"] += hour.Status3xx
+		result.StatusClasses["4xx"] += hour.Status4xx
+		result.StatusClasses["5xx"] += hour.Status5xx
+		addTrafficLatency(latency, decodeTrafficLatency(hour.LatencyBuckets))
+	}
+	result.RequestTime = trafficLatencySummary(latency)
+	limit := normalizeTrafficTopLimit(query.Limit)
+	for _, dimension := range trafficDimensions {
+		entries, err := service.trafficTop(id, dimension, from, to, limit)
+		if err != nil {
+			return nil, err
+		}
+		result.Top[dimension] = entries
+	}
+	return result, nil
+}
+
+// TrafficHours returns the hourly buckets of a day range, oldest first.
+func (service *Service) TrafficHours(id int64, query TrafficAnalyticsQuery) ([]TrafficHour, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	from, to, err := normalizeTrafficRange(query)
+	if err != nil {
+		return nil, err
+	}
+	var rows []models.WebsiteTrafficHourly
+	if err := service.DB.Where("website_id = ? AND hour >= ? AND hour <= ?", id, from+" 00", to+" 23").
+		Order("hour ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	hours := make([]TrafficHour, 0, len(rows))
+	for _, row := range rows {
+		hours = append(hours, TrafficHour{
+			WebsiteTrafficHourly: row,
+			RequestTime:          trafficLatencySummary(decodeTrafficLatency(row.LatencyBuckets)),
+		})
+	}
+	return hours, nil
+}
+
+// TrafficTop returns the busiest values of one dimension in a day range.
+func (service *Service) TrafficTop(id int64, dimension string, query TrafficAnalyticsQuery) ([]TrafficTopEntry, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	known := false
+	for _, candidate := range trafficDimensions {
+		known = known || candidate == dimension
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: 不支持的统计维度 %q", ErrWebsiteParameterInvalid, dimension)
+	}
+	from, to, err := normalizeTrafficRange(query)
+	if err != nil {
+		return nil, err
+	}
+	return service.trafficTop(id, dimension, from, to, normalizeTrafficTopLimit(query.Limit))
+}
+
+func (service *Service) trafficTop(id int64, dimension, from, to string, limit int) ([]TrafficTopEntry, error) {
+	entries := make([]TrafficTopEntry, 0)
+	err := service.DB.Model(&models.WebsiteTrafficTop{}).
+		Select("value, SUM(request_count) AS request_count, SUM(bytes_sent) AS bytes_sent").
+		Where("website_id = ? AND dimension = ? AND day >= ? AND day <= ?", id, dimension, from, to).
+		Group("value").Order("request_count DESC, value ASC").Limit(limit).
+		Scan(&entries).Error
+	return entries, err
+}
+
+func normalizeTrafficRange(query TrafficAnalyticsQuery) (string, string, error) {
+	to := strings.TrimSpace(query.To)
+	if to == "" {
+		to = time.Now().Format("2006-01-02")
+	}
+	toDay, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: 结束日期格式应为 YYYY-MM-DD", ErrWebsiteParameterInvalid)
+	}
+	from := strings.TrimSpace(query.From)
+	if from == "" {
+		from = toDay.AddDate(0, 0, 1-defaultTrafficDays).Format("2006-01-02")
+	}
+	fromDay, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: 开始日期格式应为 YYYY-MM-DD", ErrWebsiteParameterInvalid)
+	}
+	if fromDay.After(toDay) {
+		return "", "", fmt.Errorf("%w: 开始日期不能晚于结束日期", ErrWebsiteParameterInvalid)
+	}
+	if toDay.Sub(fromDay) >= trafficAnalyticsMaxAge*24*time.Hour {
+		return "", "", fmt.Errorf("%w: 统计范围不能超过 %d 天", ErrWebsiteParameterInvalid, trafficAnalyticsMaxAge)
+	}
+	return from, to, nil
+}
+
+func normalizeTrafficTopLimit(limit int) int {
+	if limit <= 0 {
+		return defaultTrafficTopLimit
+	}
+	if limit > maxTrafficTopLimit {
+		return maxTrafficTopLimit
+	}
+	return limit
+}
+
+// mergeTrafficHours adds a collection pass to the stored hourly buckets. The
+// latency histogram is JSON, so rows are merged in Go rather than in SQL.
+func mergeTrafficHours(tx *gorm.DB, websiteID int64, hours map[string]*trafficHour) error {
+	for key, hour := range hours {
+		record := models.WebsiteTrafficHourly{WebsiteID: websiteID, Hour: key}
+		err := tx.First(&record, "website_id = ? AND hour = ?", websiteID, key).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		record.RequestCount += hour.requests
+		record.BytesSent += hour.bytes
+		record.Status2xx += hour.status[0]
+		record.Status3xx += hour.status[1]
+		record.Status4xx += hour.status[2]
+		record.Status5xx += hour.status[3]
+		record.BotRequests += hour.bots
+		latency := decodeTrafficLatency(record.LatencyBuckets)
+		addTrafficLatency(latency, hour.latency)
+		encoded, err := json.Marshal(latency)
+		if err != nil {
+			return err
+		}
+		record.LatencyBuckets = string(encoded)
+		if err := tx.Save(&record).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTrafficTop keeps only the busiest values of each day and dimension in
+// a collection pass and adds them to the stored counters.
+func mergeTrafficTop(tx *gorm.DB, websiteID int64, top map[trafficTopKey]trafficAggregate) error {
+	grouped := make(map[[2]string][]trafficTopKey)
+	for key := range top {
+		group := [2]string{key.day, key.dimension}
+		grouped[group] = append(grouped[group], key)
+	}
+	now := time.Now()
+	for _, keys := range grouped {
+		sort.Slice(keys, func(i, j int) bool {
+			left, right := top[keys[i]], top[keys[j]]
+			if left.requests != right.requests {
+				return left.requests > right.requests
+			}
+			return keys[i].value < keys[j].value
+		})
+		if len(keys) > maxTrafficTopValues {
+			keys = keys[:maxTrafficTopValues]
+		}
+		for _, key := range keys {
+			record := models.WebsiteTrafficTop{
+				WebsiteID: websiteID, Day: key.day, Dimension: key.dimension, Value: key.value,
+				RequestCount: top[key].requests, BytesSent: top[key].bytes, UpdatedAt: now,
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "website_id"}, {Name: "day"}, {Name: "dimension"}, {Name: "value"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"bytes_sent":    gorm.Expr("website_traffic_top.bytes_sent + excluded.bytes_sent"),
+					"request_count": gorm.Expr("website_traffic_top.request_count + excluded.request_count"),
+					"updated_at":    now,
+				}),
+			}).Create(&record).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneTrafficAnalytics drops hourly and top-value rows older than the
+// analytics window; daily totals are kept.
+func (service *Service) pruneTrafficAnalytics(now time.Time) error {
+	cutoff := now.AddDate(0, 0, -trafficAnalyticsMaxAge).Format("2006-01-02")
+	if err := service.DB.Where("hour < ?", cutoff).Delete(&models.WebsiteTrafficHourly{}).Error; err != nil {
+		return err
+	}
+	return service.DB.Where("day < ?", cutoff).Delete(&models.WebsiteTrafficTop{}).Error
+}
+
+func trafficLatencyBucket(milliseconds float64) int {
+	for i, bound := range trafficLatencyBoundsMs {
+		if milliseconds <= bound {
+			return i
+		}
+	}
+	return len(trafficLatencyBoundsMs)
+}
+
+func decodeTrafficLatency(value string) []int64 {
+	buckets := make([]int64, len(trafficLatencyBoundsMs)+1)
+	var stored []int64
+	if value == "" || json.Unmarshal([]byte(value), &stored) != nil {
+		return buckets
+	}
+	addTrafficLatency(buckets, stored)
+	return buckets
+}
+
+func addTrafficLatency(target, source []int64) {
+	for i := 0; i < len(target) && i < len(source); i++ {
+		target[i] += source[i]
+	}
+}
+
+func trafficLatencySummary(buckets []int64) TrafficLatency {
+	var summary TrafficLatency
+	for _, count := range buckets {
+		summary.Samples += count
+	}
+	if summary.Samples == 0 {
+		return summary
+	}
+	summary.P50Ms = trafficLatencyPercentile(buckets, summary.Samples, 0.50)
+	summary.P95Ms = trafficLatencyPercentile(buckets, summary.Samples, 0.95)
+	return summary
+}
+
+// trafficLatencyPercentile returns the upper bound of the bucket holding the
+// percentile. Requests slower than the last bound report that bound.
+func trafficLatencyPercentile(buckets []int64, total int64, percentile float64) float64 {
+	rank := int64(float64(total)*percentile + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range buckets {
+		seen += count
+		if seen >= rank {
+			if i < len(trafficLatencyBoundsMs) {
+				return trafficLatencyBoundsMs[i]
+			}
+			break
+		}
+	}
+	return trafficLatencyBoundsMs[len(trafficLatencyBoundsMs)-1]
+}
+
+// trafficRequestPath extracts the path of "METHOD /path?query PROTO", dropping
+// the query string so parameters do not fragment the URL ranking.
+func trafficRequestPath(request string) string {
+	fields := strings.Fields(request)
+	if len(fields) < 2 {
+		return ""
+	}
+	path := fields[1]
+	if index := strings.IndexByte(path, '?'); index >= 0 {
+		path = path[:index]
+	}
+	return path
+}
+
+func truncateTrafficValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) <= maxTrafficTopValueLen {
+		return value
+	}
+	value = value[:maxTrafficTopValueLen]
+	for len(value) > 0 && !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+	return value
+}
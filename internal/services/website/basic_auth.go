@@ -0,0 +1,216 @@
+package website
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	basicAuthDirectory    = ".oneinstack-auth"
+	defaultBasicAuthRealm = "Restricted"
+	maxBasicAuthUsers     = 32
+)
+
+var (
+	basicAuthUserPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+	basicAuthHashPattern = regexp.MustCompile(`^\{SSHA\}[A-Za-z0-9+/]+={0,2}$`)
+)
+
+// WebsiteBasicAuthUser is one account of the password file. Password is only
+// accepted on input; the stored form is the salted SHA-1 hash Nginx reads.
+type WebsiteBasicAuthUser struct {
+	Username     string `json:"username"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// WebsiteBasicAuth protects the whole site with HTTP basic authentication,
+// typically for staging copies.
+type WebsiteBasicAuth struct {
+	Enabled bool                   `json:"enabled"`
+	Realm   string                 `json:"realm"`
+	Users   []WebsiteBasicAuthUser `json:"users"`
+}
+
+// basicAuthFile places the password file below WebRoot but outside every
+// site root, next to the restore and delete staging directories.
+func basicAuthFile(webRoot string, siteID int64) string {
+	return filepath.Join(filepath.Clean(webRoot), basicAuthDirectory, fmt.Sprintf("site%d.htpasswd", siteID))
+}
+
+// normalizeBasicAuth hashes new passwords and keeps the stored hash of users
+// submitted without one, so settings can be saved without re-entering every
+// password.
+func normalizeBasicAuth(current, previous *WebsiteBasicAuth) (*WebsiteBasicAuth, error) {
+	if current == nil {
+		return nil, nil
+	}
+	result := &WebsiteBasicAuth{Enabled: current.Enabled, Realm: strings.TrimSpace(current.Realm)}
+	if result.Realm == "" {
+		result.Realm = defaultBasicAuthRealm
+	}
+	if err := validateBasicAuthRealm(result.Realm); err != nil {
+		return nil, err
+	}
+	if len(current.Users) > maxBasicAuthUsers {
+		return nil, fmt.Errorf("访问认证用户不能超过 %d 个", maxBasicAuthUsers)
+	}
+	stored := map[string]string{}
+	if previous != nil {
+		for _, account := range previous.Users {
+			stored[account.Username] = account.PasswordHash
+		}
+	}
+	seen := make(map[string]struct{}, len(current.Users))
+	for _, account := range current.Users {
+		username := strings.TrimSpace(account.Username)
+		if !basicAuthUserPattern.MatchString(username) {
+			return nil, fmt.Errorf("访问认证用户名 %q 无效", account.Username)
+		}
+		if _, exists := seen[username]; exists {
+			return nil, fmt.Errorf("访问认证用户 %s 重复", username)
+		}
+		seen[username] = struct{}{}
+		hash := strings.TrimSpace(account.PasswordHash)
+		switch {
+		case account.Password != "":
+			if len(account.Password) > 128 || strings.ContainsAny(account.Password, "\r\n") {
+				return nil, fmt.Errorf("访问认证用户 %s 的密码无效", username)
+			}
+			var err error
+			if hash, err = hashBasicAuthPassword(account.Password); err != nil {
+				return nil, err
+			}
+		case hash == "":
+			hash = stored[username]
+		}
+		if !basicAuthHashPattern.MatchString(hash) {
+			return nil, fmt.Errorf("访问认证用户 %s 需要设置密码", username)
+		}
+		result.Users = append(result.Users, WebsiteBasicAuthUser{Username: username, PasswordHash: hash})
+	}
+	if result.Enabled && len(result.Users) == 0 {
+		return nil, errors.New("启用访问认证时至少需要一个用户")
+	}
+	return result, nil
+}
+
+// NewBasicAuthUser validates an account and hashes its password, for callers
+// that must persist it before the settings are saved.
+func NewBasicAuthUser(username, password string) (WebsiteBasicAuthUser, error) {
+	auth, err := normalizeBasicAuth(&WebsiteBasicAuth{
+		Users: []WebsiteBasicAuthUser{{Username: username, Password: password}},
+	}, nil)
+	if err != nil {
+		return WebsiteBasicAuthUser{}, err
+	}
+	return auth.Users[0], nil
+}
+
+func validateBasicAuthRealm(realm string) error {
+	if len(realm) > 128 {
+		return errors.New("访问认证提示不能超过 128 个字符")
+	}
+	for _, char := range realm {
+		if char == '"' || char == '\\' || char == '$' || char == ';' || unicode.IsControl(char) {
+			return fmt.Errorf("访问认证提示 %q 包含不支持的字符", realm)
+		}
+	}
+	return nil
+}
+
+// hashBasicAuthPassword produces an {SSHA} entry, which Nginx verifies
+// without depending on the crypt(3) schemes of the host libc.
+func hashBasicAuthPassword(password string) (string, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	digest := sha1.Sum(append([]byte(password), salt...))
+	return "{SSHA}" + base64.StdEncoding.EncodeToString(append(digest[:], salt...)), nil
+}
+
+// renderBasicAuthFile validates the stored accounts and returns the password
+// file content.
+func renderBasicAuthFile(auth *WebsiteBasicAuth) (string, error) {
+	var builder strings.Builder
+	for _, account := range auth.Users {
+		if !basicAuthUserPattern.MatchString(account.Username) ||
+			!basicAuthHashPattern.MatchString(account.PasswordHash) {
+			return "", fmt.Errorf("访问认证用户 %s 的密码未设置", account.Username)
+		}
+		builder.WriteString(account.Username + ":" + account.PasswordHash + "\n")
+	}
+	return builder.String(), nil
+}
+
+// writeBasicAuthFile publishes the password file of a site, or removes it
+// when authentication is off. The returned function restores the previous
+// file.
+func writeBasicAuthFile(webRoot string, siteID int64, auth *WebsiteBasicAuth) (func() error, error) {
+	path := basicAuthFile(webRoot, siteID)
+	previous, readErr := os.ReadFile(path)
+	if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+		return nil, readErr
+	}
+	restore := func() error {
+		if readErr != nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+		return writeWebServerReadable(path, previous)
+	}
+	if auth == nil || !auth.Enabled {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return restore, nil
+	}
+	content, err := renderBasicAuthFile(auth)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	if err := webServerGroupOwned(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if err := writeWebServerReadable(path, []byte(content)); err != nil {
+		return nil, err
+	}
+	return restore, nil
+}
+
+func writeWebServerReadable(path string, data []byte) error {
+	if err := atomicWriteConfig(filepath.Dir(path), path, data); err != nil {
+		return err
+	}
+	return webServerGroupOwned(path)
+}
+
+// webServerGroupOwned hands a root-owned path to the web server group so the
+// Nginx workers can read it. Hosts without the account keep root ownership.
+func webServerGroupOwned(path string) error {
+	group, err := user.LookupGroup(webServerAccount)
+	if err != nil {
+		return nil
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return nil
+	}
+	return os.Chown(path, -1, gid)
+}
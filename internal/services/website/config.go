@@ -62,8 +62,10 @@ type siteTemplateData struct {
 	ListenPort        int
 	ServerNames       string
 	RootDir           string
+	RealPathRoot      bool
 	ProxyURL          string
 	ProxyHost         string
+	Upstreams         string
 	Remark            string
 	LogDir            string
 	LogName           string
@@ -78,6 +80,8 @@ type siteTemplateData struct {
 	RewriteDirectives string
 	ServerDirectives  string
 	ExtraLocations    string
+	WAFVariable       string
+	BasicAuth         bool
 	AccessLogEnabled  bool
 	ErrorLogEnabled   bool
 }
@@ -88,6 +92,9 @@ var siteTemplates = template.Must(template.New("nginx-sites").Parse(`
         root {{.ChallengeRoot}};
         default_type text/plain;
         allow all;
+{{- if .BasicAuth}}
+        auth_basic off;
+{{- end}}
         try_files $uri =404;
     }
 {{end}}
@@ -102,13 +109,20 @@ var siteTemplates = template.Must(template.New("nginx-sites").Parse(`
     add_header Strict-Transport-Security "max-age=31536000" always;
 {{end}}
 {{end}}
+{{define "log-format"}}{{if .AccessLogEnabled}}log_format oneinstack_{{.LogName}} '$remote_addr - $remote_user [$time_local] "$request" '
+    '$status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time';
+{{end}}{{if .WAFVariable}}log_format oneinstack_waf_{{.LogName}} '$time_iso8601\t$remote_addr\t{{.WAFVariable}}\t$request_method\t$request_uri\t$http_user_agent';
+{{end}}{{end}}
 {{define "logs"}}
     # {{.Remark}}
 {{if .AccessLogEnabled}}
-    access_log {{.LogDir}}/{{.LogName}}_access.log;
-{{else}}
+    access_log {{.LogDir}}/{{.LogName}}_access.log oneinstack_{{.LogName}};
+{{else if not .WAFVariable}}
     access_log off;
 {{end}}
+{{if .WAFVariable}}
+    access_log {{.LogDir}}/{{.LogName}}_waf.log oneinstack_waf_{{.LogName}} if={{.WAFVariable}};
+{{end}}
 {{if .ErrorLogEnabled}}
     error_log {{.LogDir}}/{{.LogName}}_error.log;
 {{else}}
@@ -130,7 +144,8 @@ var siteTemplates = template.Must(template.New("nginx-sites").Parse(`
         fastcgi_pass {{.PHPBackend}};
         fastcgi_index index.php;
         include fastcgi_params;
-        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        fastcgi_param SCRIPT_FILENAME {{if .RealPathRoot}}$realpath_root{{else}}$document_root{{end}}$fastcgi_script_name;{{if .RealPathRoot}}
+        fastcgi_param DOCUMENT_ROOT $realpath_root;{{end}}
     }
 {{end}}
 {{define "proxy-content"}}
@@ -155,7 +170,8 @@ var siteTemplates = template.Must(template.New("nginx-sites").Parse(`
     }
 {{end}}
 {{define "php"}}# Managed by OneinStack Panel - {{.Name}}
-server {
+{{template "log-format" .}}{{if .Upstreams}}{{.Upstreams}}
+{{end}}server {
     listen {{.ListenPort}};
     server_name {{.ServerNames}};
 {{template "challenge" .}}
@@ -184,7 +200,8 @@ server {
 {{end}}
 {{end}}
 {{define "proxy"}}# Managed by OneinStack Panel - {{.Name}}
-server {
+{{template "log-format" .}}{{if .Upstreams}}{{.Upstreams}}
+{{end}}server {
     listen {{.ListenPort}};
     server_name {{.ServerNames}};
 {{template "challenge" .}}
@@ -213,7 +230,8 @@ server {
 {{end}}
 {{end}}
 {{define "static"}}# Managed by OneinStack Panel - {{.Name}}
-server {
+{{template "log-format" .}}{{if .Upstreams}}{{.Upstreams}}
+{{end}}server {
     listen {{.ListenPort}};
     server_name {{.ServerNames}};
 {{template "challenge" .}}
@@ -381,13 +399,27 @@ func prepareWebsiteWithTLSAndSettings(
 	if runtimeSettings.RootDir != "" {
 		rootDir = runtimeSettings.RootDir
 	}
+	if runtimeSettings.ProxyURL != "" {
+		proxyURL = runtimeSettings.ProxyURL
+	}
+	if runtimeSettings.BasicAuthRealm != "" {
+		runtimeSettings.ServerDirectives = strings.TrimPrefix(runtimeSettings.ServerDirectives+"\n"+
+			"    auth_basic \""+runtimeSettings.BasicAuthRealm+"\";\n"+
+			"    auth_basic_user_file "+basicAuthFile(webRoot, input.ID)+";", "\n")
+	}
+	documentRoot := rootDir
+	if runtimeSettings.DocumentRoot != "" {
+		documentRoot = runtimeSettings.DocumentRoot
+	}
 	data := siteTemplateData{
 		Name:              name,
 		ListenPort:        port,
 		ServerNames:       strings.Join(domains, " "),
-		RootDir:           rootDir,
+		RootDir:           documentRoot,
+		RealPathRoot:      runtimeSettings.RealPathRoot,
 		ProxyURL:          proxyURL,
 		ProxyHost:         proxyHost,
+		Upstreams:         runtimeSettings.Upstreams,
 		Remark:            remark,
 		LogDir:            strings.TrimSuffix(logRoot, string(filepath.Separator)),
 		LogName:           logName,
@@ -402,6 +434,8 @@ func prepareWebsiteWithTLSAndSettings(
 		RewriteDirectives: runtimeSettings.RewriteDirectives,
 		ServerDirectives:  runtimeSettings.ServerDirectives,
 		ExtraLocations:    runtimeSettings.ExtraLocations,
+		WAFVariable:       runtimeSettings.WAFVariable,
+		BasicAuth:         runtimeSettings.BasicAuthRealm != "",
 		AccessLogEnabled:  runtimeSettings.AccessLogEnabled,
 		ErrorLogEnabled:   runtimeSettings.ErrorLogEnabled,
 	}
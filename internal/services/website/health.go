@@ -0,0 +1,410 @@
+package website
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/monitoring"
+
+	"gorm.io/gorm"
+)
+
+// backendProbe checks one upstream pool server and returns nil when it is
+// healthy.
+type backendProbe func(ctx context.Context, scheme, address string, check WebsiteUpstreamHealthCheck) error
+
+type backendNotifier func(ctx context.Context, change monitoring.BackendHealthChange) error
+
+// backendTarget is one probed backend. Direct targets are proxied to without
+// a pool; they are recorded under directProxyPool and only alert, since there
+// is no other server to fail over to.
+type backendTarget struct {
+	pool    string
+	scheme  string
+	address string
+	backup  bool
+	direct  bool
+	check   WebsiteUpstreamHealthCheck
+	state   *models.WebsiteBackendHealth
+	err     error
+}
+
+// directProxyPool names the health rows of direct proxy targets. It is not a
+// valid pool name, so it cannot collide with a configured pool.
+const directProxyPool = "@proxy"
+
+// defaultProxyHealthCheck probes proxy targets that are not in a pool with a
+// health check of their own.
+var defaultProxyHealthCheck = WebsiteUpstreamHealthCheck{
+	Type: UpstreamHealthCheckTCP, Timeout: 3, Fails: 3, Passes: 2,
+}
+
+// ListBackendHealth returns the active health-check state of a website's
+// upstream pool servers and direct proxy targets.
+func (service *Service) ListBackendHealth(id int64) ([]models.WebsiteBackendHealth, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	var rows []models.WebsiteBackendHealth
+	err := service.DB.Where("website_id = ?", id).Order("pool ASC, address ASC").Find(&rows).Error
+	return rows, err
+}
+
+// checkBackends probes the servers of every upstream pool that has an active
+// health check and every direct proxy target. Pool servers crossing their
+// failure threshold are rendered as down and the site is republished;
+// recovered servers are returned to rotation.
+func (manager *LifecycleManager) checkBackends(ctx context.Context) error {
+	service := manager.service
+	configured := service.DB.Model(&models.WebsiteSetting{}).Select("website_id").
+		Where("upstreams_json <> '' OR ejected_backends <> '' OR proxy_rules_json <> ''")
+	var sites []models.Website
+	err := service.DB.Where("enabled = ? AND (type = ? OR id IN (?))", true, "proxy", configured).
+		Order("id ASC").Find(&sites).Error
+	if err != nil {
+		return err
+	}
+	var result error
+	for i := range sites {
+		_, record, err := service.loadSettings(sites[i].ID)
+		if err != nil {
+			result = errors.Join(result, err)
+			continue
+		}
+		if err := manager.checkSiteBackends(ctx, &sites[i], record); err != nil {
+			result = errors.Join(result, fmt.Errorf("check backends of website %s: %w", sites[i].Name, err))
+		}
+	}
+	return result
+}
+
+func (manager *LifecycleManager) checkSiteBackends(
+	ctx context.Context,
+	site *models.Website,
+	record *models.WebsiteSetting,
+) error {
+	service := manager.service
+	targets, err := backendTargets(site, record)
+	if err != nil {
+		return err
+	}
+	var existing []models.WebsiteBackendHealth
+	if err := service.DB.Where("website_id = ?", site.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+	states := make(map[string]*models.WebsiteBackendHealth, len(existing))
+	for i := range existing {
+		states[upstreamBackendKey(existing[i].Pool, existing[i].Address)] = &existing[i]
+	}
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		key := upstreamBackendKey(target.pool, target.address)
+		target.state = states[key]
+		delete(states, key)
+		if target.state == nil {
+			target.state = &models.WebsiteBackendHealth{
+				WebsiteID: site.ID, Pool: target.pool, Address: target.address, Healthy: true,
+			}
+		}
+		wg.Add(1)
+		go func(target *backendTarget) {
+			defer wg.Done()
+			target.err = manager.probe(ctx, target.scheme, target.address, target.check)
+		}(target)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	changed := make([]*backendTarget, 0)
+	for _, target := range targets {
+		state := target.state
+		state.LastCheckedAt = now
+		if target.err != nil {
+			state.ConsecutiveFailures++
+			state.ConsecutivePasses = 0
+			state.LastError = truncateBackendError(target.err.Error())
+			if state.Healthy && state.ConsecutiveFailures >= target.check.Fails {
+				state.Healthy = false
+				state.DownSince = &now
+				changed = append(changed, target)
+			}
+			continue
+		}
+		state.ConsecutivePasses++
+		state.ConsecutiveFailures = 0
+		state.LastError = ""
+		if !state.Healthy && state.ConsecutivePasses >= target.check.Passes {
+			state.Healthy = true
+			changed = append(changed, target)
+		}
+	}
+
+	// A pool whose primary servers are all failing keeps them in rotation so
+	// Nginx can still try them; ejecting every server would only turn a
+	// degraded site into a guaranteed 502.
+	healthyPrimary := make(map[string]bool)
+	for _, target := range targets {
+		if !target.direct && !target.backup && target.state.Healthy {
+			healthyPrimary[target.pool] = true
+		}
+	}
+	wasEjected := make(map[*backendTarget]bool, len(targets))
+	ejected := make([]string, 0)
+	for _, target := range targets {
+		wasEjected[target] = target.state.Ejected
+		target.state.Ejected = !target.direct && !target.state.Healthy &&
+			(target.backup || healthyPrimary[target.pool])
+		if target.state.Ejected {
+			ejected = append(ejected, upstreamBackendKey(target.pool, target.address))
+		}
+	}
+	desired := strings.Join(ejected, "\n")
+
+	content := ""
+	configName := ""
+	if desired != record.EjectedBackends {
+		tlsOptions, err := service.activeTLSOptions(site.ID, site.Domain)
+		if err != nil {
+			return err
+		}
+		previous, err := prepareWebsiteWithTLSAndSettings(
+			site, service.WebRoot, service.LogRoot, service.challengeRoot(), tlsOptions, record,
+		)
+		if err != nil {
+			return err
+		}
+		updated := *record
+		updated.EjectedBackends = desired
+		prepared, err := prepareWebsiteWithTLSAndSettings(
+			site, service.WebRoot, service.LogRoot, service.challengeRoot(), tlsOptions, &updated,
+		)
+		if err != nil {
+			return err
+		}
+		content, err = service.preserveCustomWebsiteConfig(site, previous.config, prepared.config)
+		if err != nil {
+			return err
+		}
+		configName = prepared.configName
+	}
+
+	var publication *Publication
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		for _, target := range targets {
+			if err := tx.Save(target.state).Error; err != nil {
+				return err
+			}
+		}
+		for _, stale := range states {
+			if err := tx.Delete(stale).Error; err != nil {
+				return err
+			}
+		}
+		if configName == "" {
+			return nil
+		}
+		if err := tx.Model(&models.WebsiteSetting{}).Where("website_id = ?", site.ID).
+			Update("ejected_backends", desired).Error; err != nil {
+			return err
+		}
+		published, err := service.Publisher.Publish(ctx, map[string]*string{configName: &content})
+		if err != nil {
+			return err
+		}
+		publication = published
+		return nil
+	})
+	if err != nil {
+		if publication != nil {
+			err = errors.Join(err, publication.Rollback(context.Background()))
+		}
+		return err
+	}
+	record.EjectedBackends = desired
+
+	var result error
+	for _, target := range changed {
+		change := monitoring.BackendHealthChange{
+			WebsiteID: site.ID, WebsiteName: site.Name, Pool: target.pool, Address: target.address,
+			Direct: target.direct, Healthy: target.state.Healthy, Ejected: target.state.Ejected,
+			Detail: target.state.LastError, OccurredAt: now,
+		}
+		if target.state.DownSince != nil {
+			change.DownSince = *target.state.DownSince
+		}
+		if change.Healthy {
+			change.Ejected = wasEjected[target]
+		}
+		if err := manager.notifyBackend(ctx, change); err != nil {
+			result = errors.Join(result, err)
+		}
+	}
+	return result
+}
+
+// backendTargets lists the servers of the pools that enable a health check,
+// followed by the direct proxy targets of the site and its proxy rules.
+func backendTargets(site *models.Website, record *models.WebsiteSetting) ([]*backendTarget, error) {
+	settings, err := websiteSettingsFromModel(record)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*backendTarget, 0)
+	for _, pool := range settings.Upstreams {
+		if pool.HealthCheck == nil {
+			continue
+		}
+		name := strings.TrimSpace(pool.Name)
+		check, err := normalizeUpstreamHealthCheck(name, *pool.HealthCheck)
+		if err != nil {
+			return nil, err
+		}
+		scheme := strings.ToLower(strings.TrimSpace(pool.Scheme))
+		if scheme == "" {
+			scheme = "http"
+		}
+		for _, server := range pool.Servers {
+			address, err := normalizeUpstreamAddress(server.Address)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, &backendTarget{
+				pool: name, scheme: scheme, address: address, backup: server.Backup, check: check,
+			})
+		}
+	}
+
+	var proxyURLs []string
+	if strings.EqualFold(site.Type, "proxy") && strings.TrimSpace(settings.ProxyUpstream) == "" &&
+		strings.TrimSpace(site.SendUrl) != "" {
+		scheme := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(site.Pact), "://"))
+		if scheme == "" {
+			scheme = "http"
+		}
+		proxyURLs = append(proxyURLs, scheme+"://"+strings.TrimSpace(site.SendUrl))
+	}
+	for _, rule := range settings.ProxyRules {
+		if rule.Enabled && strings.TrimSpace(rule.Upstream) == "" {
+			proxyURLs = append(proxyURLs, strings.TrimSpace(rule.Target))
+		}
+	}
+	seen := make(map[string]struct{}, len(proxyURLs))
+	for _, value := range proxyURLs {
+		address, err := proxyTargetAddress(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := seen[address]; exists {
+			continue
+		}
+		seen[address] = struct{}{}
+		targets = append(targets, &backendTarget{
+			pool: directProxyPool, scheme: "tcp", address: address, direct: true,
+			check: defaultProxyHealthCheck,
+		})
+	}
+	return targets, nil
+}
+
+// proxyTargetAddress returns the host:port a proxy URL connects to.
+func proxyTargetAddress(value string) (string, error) {
+	if _, rest, found := strings.Cut(value, "://"); found && strings.HasPrefix(rest, "unix:") {
+		socket, _, _ := strings.Cut(strings.TrimPrefix(rest, "unix:"), ":")
+		return normalizeUpstreamAddress("unix:" + socket)
+	}
+	target, err := url.Parse(value)
+	if err != nil || target.Hostname() == "" {
+		return "", fmt.Errorf("反向代理目标 %q 无效", value)
+	}
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(target.Scheme, "https") {
+			port = "443"
+		}
+	}
+	return normalizeUpstreamAddress(net.JoinHostPort(target.Hostname(), port))
+}
+
+func probeUpstreamBackend(ctx context.Context, scheme, address string, check WebsiteUpstreamHealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.Timeout)*time.Second)
+	defer cancel()
+	network, dialAddress, host := "tcp", address, address
+	if strings.HasPrefix(address, "unix:") {
+		network, dialAddress, host = "unix", strings.TrimPrefix(address, "unix:"), "localhost"
+	}
+	dialer := &net.Dialer{}
+	if check.Type == UpstreamHealthCheckTCP {
+		conn, err := dialer.DialContext(ctx, network, dialAddress)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, dialAddress)
+		},
+		// Pool servers are usually addressed by IP while their certificates
+		// name the public domain; the probe checks liveness, not identity.
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+check.Path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", "OneinStack-HealthCheck")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if check.ExpectedStatus != 0 {
+		if response.StatusCode != check.ExpectedStatus {
+			return fmt.Errorf("unexpected HTTP status %d, want %d", response.StatusCode, check.ExpectedStatus)
+		}
+		return nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("unexpected HTTP status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func notifyMonitoringBackendHealth(ctx context.Context, change monitoring.BackendHealthChange) error {
+	manager := monitoring.Default()
+	if manager == nil {
+		return nil
+	}
+	return manager.NotifyBackendHealth(ctx, change)
+}
+
+func truncateBackendError(value string) string {
+	runes := []rune(strings.TrimSpace(value))
+	if len(runes) > 512 {
+		return string(runes[:512])
+	}
+	return string(runes)
+}
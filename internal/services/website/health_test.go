@@ -0,0 +1,191 @@
+package website
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/monitoring"
+)
+
+func TestUpstreamHealthCheckEjectsAndRestoresFailingBackends(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer healthy.Close()
+	var failingStatus atomic.Int32
+	failingStatus.Store(http.StatusInternalServerError)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(failingStatus.Load()))
+	}))
+	defer failing.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+	healthyAddress := strings.TrimPrefix(healthy.URL, "http://")
+	failingAddress := strings.TrimPrefix(failing.URL, "http://")
+
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "pool.example.com", Type: "proxy", Pact: "http", SendUrl: healthyAddress}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	settings := WebsiteSettings{
+		DefaultDocuments: "index.html", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		Upstreams: []WebsiteUpstream{
+			{Name: "app", Servers: []WebsiteUpstreamServer{{Address: healthyAddress}, {Address: failingAddress}},
+				HealthCheck: &WebsiteUpstreamHealthCheck{Path: "/healthz", Fails: 2, Passes: 1}},
+			{Name: "solo", Servers: []WebsiteUpstreamServer{{Address: closedAddress}},
+				HealthCheck: &WebsiteUpstreamHealthCheck{Type: UpstreamHealthCheckTCP, Timeout: 1, Fails: 1}},
+		},
+		ProxyUpstream: "app",
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := NewLifecycleManager(service, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []monitoring.BackendHealthChange
+	manager.notifyBackend = func(_ context.Context, change monitoring.BackendHealthChange) error {
+		changes = append(changes, change)
+		return nil
+	}
+	readConfig := func() string {
+		content, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "pool.example.com.conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	if err := manager.checkBackends(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(readConfig(), " down;") {
+		t.Fatalf("backend was ejected before reaching the failure threshold:\n%s", readConfig())
+	}
+	if len(changes) != 1 || changes[0].Pool != "solo" || changes[0].Healthy || changes[0].Ejected {
+		t.Fatalf("the only server of a pool must alert without being ejected: %#v", changes)
+	}
+	if err := manager.checkBackends(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	config := readConfig()
+	if !strings.Contains(config, "server "+failingAddress+" down;") ||
+		!strings.Contains(config, "server "+healthyAddress+";") ||
+		!strings.Contains(config, "server "+closedAddress+";") {
+		t.Fatalf("failing backend was not ejected:\n%s", config)
+	}
+	if len(changes) != 2 || changes[1].Address != failingAddress || changes[1].Healthy || !changes[1].Ejected ||
+		!strings.Contains(changes[1].Detail, "500") {
+		t.Fatalf("unexpected ejection notification: %#v", changes)
+	}
+	backends, err := service.ListBackendHealth(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backends) != 3 {
+		t.Fatalf("unexpected backend health rows: %#v", backends)
+	}
+
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(readConfig(), "server "+failingAddress+" down;") {
+		t.Fatalf("settings update returned an ejected backend to rotation:\n%s", readConfig())
+	}
+
+	failingStatus.Store(http.StatusOK)
+	if err := manager.checkBackends(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(readConfig(), failingAddress+" down") {
+		t.Fatalf("recovered backend is still ejected:\n%s", readConfig())
+	}
+	if len(changes) != 3 || changes[2].Address != failingAddress || !changes[2].Healthy || !changes[2].Ejected ||
+		changes[2].DownSince.IsZero() {
+		t.Fatalf("unexpected recovery notification: %#v", changes)
+	}
+}
+
+func TestHealthCheckProbesDirectProxyTargets(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer healthy.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+	healthyAddress := strings.TrimPrefix(healthy.URL, "http://")
+
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "direct.example.com", Type: "proxy", Pact: "http", SendUrl: closedAddress}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	settings := WebsiteSettings{
+		DefaultDocuments: "index.html", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		ProxyRules: []WebsiteProxyRule{{Path: "/api", Target: healthy.URL, Enabled: true}},
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := NewLifecycleManager(service, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []monitoring.BackendHealthChange
+	manager.notifyBackend = func(_ context.Context, change monitoring.BackendHealthChange) error {
+		changes = append(changes, change)
+		return nil
+	}
+	before, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "direct.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range defaultProxyHealthCheck.Fails {
+		if err := manager.checkBackends(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(changes) != 1 || changes[0].Pool != directProxyPool || !changes[0].Direct ||
+		changes[0].Address != closedAddress || changes[0].Healthy || changes[0].Ejected {
+		t.Fatalf("unexpected direct target notifications: %#v", changes)
+	}
+	backends, err := service.ListBackendHealth(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backends) != 2 {
+		t.Fatalf("unexpected backend health rows: %#v", backends)
+	}
+	for _, backend := range backends {
+		if backend.Healthy != (backend.Address == healthyAddress) || backend.Ejected {
+			t.Fatalf("unexpected backend health: %#v", backend)
+		}
+	}
+	after, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "direct.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Fatalf("a direct proxy target changed the site config:\n%s", after)
+	}
+}
@@ -28,8 +28,11 @@ const (
 	maxTrafficReadBytes    = 16 << 20
 )
 
+// nginxTrafficLinePattern matches the combined log format and the panel's
+// per-site format, which appends $request_time.
 var nginxTrafficLinePattern = regexp.MustCompile(
-	`\[(\d{2}/[A-Za-z]{3}/\d{4}):[^\]]+\]\s+"[^"]*"\s+\d{3}\s+(\d+|-)`,
+	`^(\S+)\s+\S+\s+\S+\s+\[(\d{2}/[A-Za-z]{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]\s+"([^"]*)"\s+(\d{3})\s+(\d+|-)` +
+		`(?:\s+"([^"]*)"\s+"([^"]*)")?(?:\s+(\d+(?:\.\d+)?|-))?`,
 )
 
 // SetEnabled safely removes or restores one managed virtual-host file and
@@ -156,6 +159,9 @@ func (service *Service) collectTraffic() error {
 			result = errors.Join(result, fmt.Errorf("collect traffic for %s: %w", sites[i].Name, err))
 		}
 	}
+	if err := service.pruneTrafficAnalytics(time.Now()); err != nil {
+		result = errors.Join(result, fmt.Errorf("prune traffic analytics: %w", err))
+	}
 	return result
 }
 
@@ -217,10 +223,10 @@ func (service *Service) collectSiteTraffic(site *models.Website, logRoot string)
 		return nil
 	}
 	complete := data[:lastNewline+1]
-	aggregates := parseTrafficLines(complete)
+	batch := parseTrafficLines(complete)
 	newOffset := cursor.Offset + int64(lastNewline+1)
 	return service.DB.Transaction(func(tx *gorm.DB) error {
-		for day, aggregate := range aggregates {
+		for day, aggregate := range batch.daily {
 			record := models.WebsiteTrafficDaily{
 				WebsiteID:    site.ID,
 				Day:          day,
@@ -238,6 +244,12 @@ func (service *Service) collectSiteTraffic(site *models.Website, logRoot string)
 				return err
 			}
 		}
+		if err := mergeTrafficHours(tx, site.ID, batch.hourly); err != nil {
+			return err
+		}
+		if err := mergeTrafficTop(tx, site.ID, batch.top); err != nil {
+			return err
+		}
 		cursor.Offset = newOffset
 		cursor.LogPath = logPath
 		cursor.FileIdentity = identity
@@ -250,31 +262,98 @@ type trafficAggregate struct {
 	requests int64
 }
 
-func parseTrafficLines(data []byte) map[string]trafficAggregate {
-	result := make(map[string]trafficAggregate)
+type trafficHour struct {
+	trafficAggregate
+	status  [4]int64
+	bots    int64
+	latency []int64
+}
+
+type trafficTopKey struct {
+	day       string
+	dimension string
+	value     string
+}
+
+type trafficBatch struct {
+	daily  map[string]trafficAggregate
+	hourly map[string]*trafficHour
+	top    map[trafficTopKey]trafficAggregate
+}
+
+func parseTrafficLines(data []byte) *trafficBatch {
+	batch := &trafficBatch{
+		daily:  make(map[string]trafficAggregate),
+		hourly: make(map[string]*trafficHour),
+		top:    make(map[trafficTopKey]trafficAggregate),
+	}
 	for _, line := range bytes.Split(data, []byte{'\n'}) {
 		matches := nginxTrafficLinePattern.FindSubmatch(line)
-		if len(matches) != 3 {
+		if len(matches) != 9 {
 			continue
 		}
-		parsedDay, err := time.Parse("02/Jan/2006", string(matches[1]))
+		parsed, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(matches[2]))
 		if err != nil {
 			continue
 		}
 		bytesSent := int64(0)
-		if string(matches[2]) != "-" {
-			bytesSent, err = strconv.ParseInt(string(matches[2]), 10, 64)
+		if string(matches[5]) != "-" {
+			bytesSent, err = strconv.ParseInt(string(matches[5]), 10, 64)
 			if err != nil || bytesSent < 0 {
 				continue
 			}
 		}
-		day := parsedDay.Format("2006-01-02")
-		aggregate := result[day]
+		day := parsed.Format("2006-01-02")
+		aggregate := batch.daily[day]
 		aggregate.bytes += bytesSent
 		aggregate.requests++
-		result[day] = aggregate
+		batch.daily[day] = aggregate
+
+		hourKey := parsed.Format(trafficHourLayout)
+		hour := batch.hourly[hourKey]
+		if hour == nil {
+			hour = &trafficHour{latency: make([]int64, len(trafficLatencyBoundsMs)+1)}
+			batch.hourly[hourKey] = hour
+		}
+		hour.bytes += bytesSent
+		hour.requests++
+		status := string(matches[4])
+		if class := int(status[0] - '2'); class >= 0 && class < len(hour.status) {
+			hour.status[class]++
+		}
+		agent := string(matches[7])
+		if trafficBotPattern.MatchString(agent) {
+			hour.bots++
+		}
+		if value := string(matches[8]); value != "" && value != "-" {
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				hour.latency[trafficLatencyBucket(seconds*1000)]++
+			}
+		}
+
+		referer := string(matches[6])
+		if referer == "-" {
+			referer = ""
+		}
+		for dimension, value := range map[string]string{
+			TrafficDimensionURL:      trafficRequestPath(string(matches[3])),
+			TrafficDimensionStatus:   status,
+			TrafficDimensionClientIP: string(matches[1]),
+			TrafficDimensionReferer:  referer,
+			TrafficDimensionAgent:    agent,
+		} {
+			value = truncateTrafficValue(value)
+			if value == "" || value == "-" {
+				continue
+			}
+			key := trafficTopKey{day: day, dimension: dimension, value: value}
+			entry := batch.top[key]
+			entry.bytes += bytesSent
+			entry.requests++
+			batch.top[key] = entry
+		}
 	}
-	return result
+	return batch
 }
 
 func trafficFileIdentity(info os.FileInfo) string {
@@ -285,12 +364,14 @@ func trafficFileIdentity(info os.FileInfo) string {
 }
 
 type LifecycleManager struct {
-	service  *Service
-	interval time.Duration
-	mu       sync.Mutex
-	cancel   context.CancelFunc
-	done     chan struct{}
-	alerted  map[int64]string
+	service       *Service
+	interval      time.Duration
+	mu            sync.Mutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+	alerted       map[int64]string
+	probe         backendProbe
+	notifyBackend backendNotifier
 }
 
 func NewLifecycleManager(service *Service, interval time.Duration) (*LifecycleManager, error) {
@@ -303,7 +384,10 @@ func NewLifecycleManager(service *Service, interval time.Duration) (*LifecycleMa
 	if interval <= 0 {
 		return nil, errors.New("website lifecycle interval must be positive")
 	}
-	return &LifecycleManager{service: service, interval: interval, alerted: make(map[int64]string)}, nil
+	return &LifecycleManager{
+		service: service, interval: interval, alerted: make(map[int64]string),
+		probe: probeUpstreamBackend, notifyBackend: notifyMonitoringBackendHealth,
+	}, nil
 }
 
 func NewDefaultLifecycleManager(interval time.Duration) (*LifecycleManager, error) {
@@ -347,7 +431,9 @@ func (manager *LifecycleManager) runOnce(ctx context.Context) error {
 	_, restoreErr := manager.service.RestoreMissingManagedConfigs(ctx)
 	tamperErr := manager.service.enforceTamperProtection(ctx)
 	alertErr := manager.emitTrafficAlerts()
-	return errors.Join(trafficErr, expirationErr, restoreErr, tamperErr, alertErr)
+	backendErr := manager.checkBackends(ctx)
+	poolErr := manager.service.moveSharedPHPPools(ctx)
+	return errors.Join(trafficErr, expirationErr, restoreErr, tamperErr, alertErr, backendErr, poolErr)
 }
 
 func (service *Service) enforceTamperProtection(ctx context.Context) error {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,6 +112,82 @@ func TestWebsiteTrafficCollectorUsesCursorAndAggregatesByDay(t *testing.T) {
 	}
 }
 
+func TestWebsiteTrafficAnalyticsAggregatesHoursTopValuesAndLatency(t *testing.T) {
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "stats.example.com", Type: "static", RootDir: "/stats"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "stats.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "log_format oneinstack_stats_example_com ") ||
+		!strings.Contains(string(config), "_access.log oneinstack_stats_example_com;") {
+		t.Fatalf("access log does not use the analytics format:\n%s", config)
+	}
+	now := time.Now()
+	logDay, day := now.Format("02/Jan/2006"), now.Format("2006-01-02")
+	lines := []string{
+		`10.0.0.1 - - [` + logDay + `:10:00:00 +0800] "GET /?a=1 HTTP/1.1" 200 100 "https://ref.example/" "Mozilla/5.0" 0.004`,
+		`10.0.0.1 - - [` + logDay + `:10:10:00 +0800] "GET /?a=2 HTTP/1.1" 200 100 "-" "Mozilla/5.0" 0.020`,
+		`10.0.0.2 - - [` + logDay + `:10:20:00 +0800] "GET /api HTTP/1.1" 502 50 "-" "Googlebot/2.1" 1.800`,
+		`10.0.0.3 - - [` + logDay + `:11:00:00 +0800] "GET /old HTTP/1.1" 301 0 "-" "curl/8.0"`,
+		`not an access log line`,
+	}
+	logPath := filepath.Join(service.LogRoot, "stats_example_com_access.log")
+	if err := os.MkdirAll(service.LogRoot, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.collectTraffic(); err != nil {
+		t.Fatal(err)
+	}
+	query := TrafficAnalyticsQuery{From: day, To: day}
+	analytics, err := service.TrafficAnalytics(site.ID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytics.RequestCount != 4 || analytics.BytesSent != 250 || analytics.BotRequests != 2 ||
+		analytics.StatusClasses["2xx"] != 2 || analytics.StatusClasses["3xx"] != 1 || analytics.StatusClasses["5xx"] != 1 {
+		t.Fatalf("unexpected analytics totals: %#v", analytics)
+	}
+	if analytics.RequestTime.Samples != 3 || analytics.RequestTime.P50Ms != 25 || analytics.RequestTime.P95Ms != 2500 {
+		t.Fatalf("unexpected request_time percentiles: %#v", analytics.RequestTime)
+	}
+	urls := analytics.Top[TrafficDimensionURL]
+	if len(urls) != 3 || urls[0].Value != "/" || urls[0].RequestCount != 2 {
+		t.Fatalf("unexpected top URLs: %#v", urls)
+	}
+	if referers := analytics.Top[TrafficDimensionReferer]; len(referers) != 1 || referers[0].Value != "https://ref.example/" {
+		t.Fatalf("unexpected referers: %#v", referers)
+	}
+	if ips := analytics.Top[TrafficDimensionClientIP]; len(ips) != 3 || ips[0].Value != "10.0.0.1" {
+		t.Fatalf("unexpected client IPs: %#v", ips)
+	}
+	hours, err := service.TrafficHours(site.ID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 2 || hours[0].Hour != day+" 10" || hours[0].RequestCount != 3 || hours[1].Status3xx != 1 {
+		t.Fatalf("unexpected hourly buckets: %#v", hours)
+	}
+	statuses, err := service.TrafficTop(site.ID, TrafficDimensionStatus, TrafficAnalyticsQuery{From: day, To: day, Limit: 1})
+	if err != nil || len(statuses) != 1 || statuses[0].Value != "200" {
+		t.Fatalf("unexpected status ranking: %#v %v", statuses, err)
+	}
+	if _, err := service.TrafficTop(site.ID, "cookie", query); err == nil {
+		t.Fatal("unknown analytics dimension was accepted")
+	}
+	var daily models.WebsiteTrafficDaily
+	if err := service.DB.First(&daily, "website_id = ? AND day = ?", site.ID, day).Error; err != nil ||
+		daily.RequestCount != 4 {
+		t.Fatalf("daily totals diverged from analytics: %#v %v", daily, err)
+	}
+}
+
 func newLifecycleTestService(t *testing.T) *Service {
 	t.Helper()
 	db := openWebsiteTestDB(t)
@@ -0,0 +1,592 @@
+package website
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	defaultPHPInstallRoot = "/usr/local"
+	defaultPHPStateRoot   = "/var/lib/oneinstack/components"
+	// webServerAccount is the Nginx worker account that must reach the pool
+	// sockets and the files of isolated sites.
+	webServerAccount   = "www"
+	maxPHPPoolChildren = 1000
+	maxPHPINIOverrides = 50
+)
+
+// SharedSiteAccount runs the PHP pools and build commands of shared sites.
+// Its primary group is the web server group, so it can write shared trees,
+// but unlike the web server account it never joins the groups of isolated
+// sites.
+const SharedSiteAccount = "www-php"
+
+var (
+	phpVersionPattern    = regexp.MustCompile(`^[5-9]\.[0-9]$`)
+	phpRuntimeDirPattern = regexp.MustCompile(`^php([5-9])([0-9])$`)
+	phpINIKeyPattern     = regexp.MustCompile(`^[a-z][a-z0-9_.]{0,63}$`)
+	phpAccountPattern    = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,30}$`)
+	phpFunctionPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+)
+
+// defaultPHPDisabledFunctions are disabled in site pools unless the pool
+// lists its own set.
+var defaultPHPDisabledFunctions = []string{
+	"exec", "passthru", "shell_exec", "system", "proc_open", "popen",
+	"pcntl_exec", "dl", "putenv", "chroot", "chgrp", "chown",
+}
+
+// phpReservedINIKeys are rendered from dedicated pool settings.
+var phpReservedINIKeys = map[string]struct{}{
+	"open_basedir": {}, "disable_functions": {}, "disable_classes": {},
+}
+
+// PHPRuntime is an installed PHP-FPM line that can host site pools.
+type PHPRuntime struct {
+	Version    string `json:"version"`
+	InstallDir string `json:"install_dir"`
+	Service    string `json:"service"`
+	// Legacy marks the single-version /usr/local/php layout.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// WebsitePHPPool tunes the dedicated PHP-FPM pool of a site with a pinned PHP
+// version. Zero values take the defaults; a nil DisabledFunctions disables
+// the default function set.
+type WebsitePHPPool struct {
+	User              string            `json:"user"`
+	Group             string            `json:"group"`
+	PM                string            `json:"pm"`
+	MaxChildren       int               `json:"max_children"`
+	StartServers      int               `json:"start_servers"`
+	MinSpareServers   int               `json:"min_spare_servers"`
+	MaxSpareServers   int               `json:"max_spare_servers"`
+	MaxRequests       int               `json:"max_requests"`
+	IdleTimeout       int               `json:"idle_timeout"`
+	OpenBasedir       []string          `json:"open_basedir"`
+	DisabledFunctions []string          `json:"disabled_functions"`
+	INIOverrides      map[string]string `json:"ini_overrides"`
+}
+
+// PHPPoolManager writes the per-site PHP-FPM pools into the side-by-side
+// runtimes below Root (php83 for PHP 8.3) and reloads their services.
+type PHPPoolManager struct {
+	Root      string
+	StateRoot string
+	Runner    CommandRunner
+}
+
+// Runtimes lists the installed PHP-FPM lines in version order.
+func (manager *PHPPoolManager) Runtimes() ([]PHPRuntime, error) {
+	if manager == nil {
+		return nil, errors.New("PHP 运行时管理未配置")
+	}
+	root := filepath.Clean(strings.TrimSpace(manager.Root))
+	if !filepath.IsAbs(root) {
+		return nil, errors.New("PHP 安装目录必须是绝对路径")
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	runtimes := make([]PHPRuntime, 0)
+	seen := make(map[string]struct{})
+	for _, entry := range entries {
+		match := phpRuntimeDirPattern.FindStringSubmatch(entry.Name())
+		if match == nil || !entry.IsDir() {
+			continue
+		}
+		installDir := filepath.Join(root, entry.Name())
+		if !phpFPMInstalled(installDir) {
+			continue
+		}
+		version := match[1] + "." + match[2]
+		seen[version] = struct{}{}
+		runtimes = append(runtimes, PHPRuntime{
+			Version: version, InstallDir: installDir, Service: entry.Name() + "-fpm",
+		})
+	}
+	legacyDir := filepath.Join(root, "php")
+	if phpFPMInstalled(legacyDir) && strings.TrimSpace(manager.StateRoot) != "" {
+		content, err := os.ReadFile(filepath.Join(manager.StateRoot, "php", "version"))
+		version := strings.TrimSpace(string(content))
+		if _, exists := seen[version]; err == nil && phpVersionPattern.MatchString(version) && !exists {
+			runtimes = append(runtimes, PHPRuntime{
+				Version: version, InstallDir: legacyDir, Service: "php-fpm", Legacy: true,
+			})
+		}
+	}
+	sort.Slice(runtimes, func(i, j int) bool { return runtimes[i].Version < runtimes[j].Version })
+	return runtimes, nil
+}
+
+// Runtime returns the installed line for version.
+func (manager *PHPPoolManager) Runtime(version string) (PHPRuntime, error) {
+	runtimes, err := manager.Runtimes()
+	if err != nil {
+		return PHPRuntime{}, err
+	}
+	for _, runtime := range runtimes {
+		if runtime.Version == version {
+			return runtime, nil
+		}
+	}
+	return PHPRuntime{}, fmt.Errorf("PHP %s 未安装，请先在软件管理中安装", version)
+}
+
+func phpFPMInstalled(installDir string) bool {
+	info, err := os.Stat(filepath.Join(installDir, "sbin", "php-fpm"))
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return false
+	}
+	info, err = os.Stat(filepath.Join(installDir, "etc", "php-fpm.d"))
+	return err == nil && info.IsDir()
+}
+
+func (runtime PHPRuntime) poolPath(siteID int64) string {
+	return filepath.Join(runtime.InstallDir, "etc", "php-fpm.d", fmt.Sprintf("oneinstack-site%d.conf", siteID))
+}
+
+// phpPoolSocket names the pool socket per version so the pools of two lines
+// can listen side by side while a site switches between them.
+func phpPoolSocket(siteID int64, version string) string {
+	return fmt.Sprintf("/dev/shm/oneinstack-php%s-site%d.sock", strings.ReplaceAll(version, ".", ""), siteID)
+}
+
+// writePool replaces the pool file of siteID in runtime, or removes it when
+// content is nil, then validates the runtime's configuration and reloads it.
+// The returned function restores the previous pool and reloads again.
+func (manager *PHPPoolManager) writePool(
+	ctx context.Context,
+	runtime PHPRuntime,
+	siteID int64,
+	content *string,
+) (func(context.Context) error, error) {
+	if manager == nil || manager.Runner == nil {
+		return nil, errors.New("PHP 运行时管理未配置")
+	}
+	path := runtime.poolPath(siteID)
+	previous, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read PHP-FPM pool: %w", err)
+	}
+	if content == nil && !existed {
+		return func(context.Context) error { return nil }, nil
+	}
+	if content != nil {
+		err = atomicWriteConfig(filepath.Dir(path), path, []byte(*content))
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write PHP-FPM pool: %w", err)
+	}
+	restore := func(ctx context.Context) error {
+		var err error
+		if existed {
+			err = atomicWriteConfig(filepath.Dir(path), path, previous)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("restore PHP-FPM pool: %w", err)
+		}
+		return manager.reload(ctx, runtime)
+	}
+	if err := manager.reload(ctx, runtime); err != nil {
+		return nil, errors.Join(err, restore(ctx))
+	}
+	return restore, nil
+}
+
+// poolUser returns the account the pool of siteID in the runtime of version
+// runs as, or "" when there is no such pool.
+func (manager *PHPPoolManager) poolUser(version string, siteID int64) string {
+	if manager == nil || strings.TrimSpace(version) == "" {
+		return ""
+	}
+	runtime, err := manager.Runtime(version)
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(runtime.poolPath(siteID))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if user, ok := strings.CutPrefix(line, "user = "); ok {
+			return strings.TrimSpace(user)
+		}
+	}
+	return ""
+}
+
+// reload tests the complete FPM configuration of runtime before a graceful
+// reload, so a rejected pool never reaches the running master.
+func (manager *PHPPoolManager) reload(ctx context.Context, runtime PHPRuntime) error {
+	binary := filepath.Join(runtime.InstallDir, "sbin", "php-fpm")
+	config := filepath.Join(runtime.InstallDir, "etc", "php-fpm.conf")
+	if output, err := manager.Runner.Run(ctx, binary, "--test", "--fpm-config", config); err != nil {
+		return fmt.Errorf("PHP %s 配置校验失败: %s", runtime.Version, commandMessage(output, err))
+	}
+	if output, err := manager.Runner.Run(ctx, "systemctl", "reload", runtime.Service+".service"); err != nil {
+		return fmt.Errorf("PHP %s 重载失败: %s", runtime.Version, commandMessage(output, err))
+	}
+	return nil
+}
+
+func commandMessage(output []byte, err error) string {
+	message := strings.TrimSpace(string(output))
+	if len(message) > 1000 {
+		message = message[:1000]
+	}
+	if message == "" {
+		message = err.Error()
+	}
+	return message
+}
+
+// renderPHPPool renders the FPM pool of a site. open_basedir always contains
+// the site root; the pool runs as the site's system user when it has one.
+func renderPHPPool(site *models.Website, rootDir, version string, pool *WebsitePHPPool) (string, error) {
+	settings := WebsitePHPPool{}
+	if pool != nil {
+		settings = *pool
+	}
+	// Isolated sites always run as their own account, which is the default
+	// pool user and group. Shared sites default to the shared site account.
+	fallbackUser, fallbackGroup := SharedSiteAccount, webServerAccount
+	if site.SystemUser != "" {
+		fallbackUser, fallbackGroup = site.SystemUser, site.SystemUser
+	}
+	account := func(value, fallback, field string) (string, error) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return fallback, nil
+		}
+		if !phpAccountPattern.MatchString(value) || value == "root" {
+			return "", fmt.Errorf("PHP 进程池%s %q 无效", field, value)
+		}
+		if site.SystemUser != "" && value != site.SystemUser {
+			return "", fmt.Errorf("隔离网站的 PHP 进程池%s只能是 %s", field, site.SystemUser)
+		}
+		return value, nil
+	}
+	user, err := account(settings.User, fallbackUser, "用户")
+	if err != nil {
+		return "", err
+	}
+	// The web server account holds the groups of every isolated site.
+	if user == webServerAccount {
+		return "", fmt.Errorf("PHP 进程池用户不能是 Web 服务器账户 %s", webServerAccount)
+	}
+	group, err := account(settings.Group, fallbackGroup, "用户组")
+	if err != nil {
+		return "", err
+	}
+	children := settings.MaxChildren
+	if children == 0 {
+		children = 10
+	}
+	if children < 1 || children > maxPHPPoolChildren {
+		return "", fmt.Errorf("PHP 最大进程数必须在 1–%d 之间", maxPHPPoolChildren)
+	}
+	maxRequests := settings.MaxRequests
+	if maxRequests == 0 {
+		maxRequests = 500
+	}
+	if maxRequests < 0 || maxRequests > 1000000 {
+		return "", errors.New("PHP 进程最大请求数必须在 0–1000000 之间")
+	}
+	lines := []string{
+		fmt.Sprintf("; Managed by OneinStack Panel for website %d; changes are overwritten.", site.ID),
+		fmt.Sprintf("[site%d]", site.ID),
+		"user = " + user,
+		"group = " + group,
+		"listen = " + phpPoolSocket(site.ID, version),
+		"listen.owner = " + webServerAccount,
+		"listen.group = " + webServerAccount,
+		"listen.mode = 0660",
+	}
+	switch pm := strings.TrimSpace(settings.PM); pm {
+	case "", "ondemand":
+		idle := settings.IdleTimeout
+		if idle == 0 {
+			idle = 10
+		}
+		if idle < 1 || idle > 3600 {
+			return "", errors.New("PHP 空闲进程超时必须在 1–3600 秒之间")
+		}
+		lines = append(lines, "pm = ondemand",
+			fmt.Sprintf("pm.max_children = %d", children),
+			fmt.Sprintf("pm.process_idle_timeout = %ds", idle))
+	case "static":
+		lines = append(lines, "pm = static", fmt.Sprintf("pm.max_children = %d", children))
+	case "dynamic":
+		start, minSpare, maxSpare := settings.StartServers, settings.MinSpareServers, settings.MaxSpareServers
+		if minSpare == 0 {
+			minSpare = 1
+		}
+		if maxSpare == 0 {
+			maxSpare = max(minSpare, min(children, 4))
+		}
+		if start == 0 {
+			start = minSpare
+		}
+		if minSpare < 1 || minSpare > start || start > maxSpare || maxSpare > children {
+			return "", errors.New("PHP 进程数需满足 1 ≤ 最小空闲 ≤ 启动数 ≤ 最大空闲 ≤ 最大进程数")
+		}
+		lines = append(lines, "pm = dynamic",
+			fmt.Sprintf("pm.max_children = %d", children),
+			fmt.Sprintf("pm.start_servers = %d", start),
+			fmt.Sprintf("pm.min_spare_servers = %d", minSpare),
+			fmt.Sprintf("pm.max_spare_servers = %d", maxSpare))
+	default:
+		return "", errors.New("PHP 进程管理方式只能是 ondemand、dynamic 或 static")
+	}
+	lines = append(lines,
+		fmt.Sprintf("pm.max_requests = %d", maxRequests),
+		"chdir = /",
+		"catch_workers_output = yes",
+		"clear_env = yes",
+		"security.limit_extensions = .php",
+	)
+
+	basedir := []string{strings.TrimSuffix(rootDir, "/") + "/", "/tmp/", "/var/tmp/"}
+	for _, value := range settings.OpenBasedir {
+		value = strings.TrimSpace(value)
+		cleaned := filepath.Clean(value)
+		if !filepath.IsAbs(value) || cleaned == "/" || strings.ContainsAny(value, ":;\r\n\"'$`") {
+			return "", fmt.Errorf("open_basedir 路径 %q 无效", value)
+		}
+		basedir = append(basedir, cleaned+"/")
+	}
+	lines = append(lines, "php_admin_value[open_basedir] = "+strings.Join(basedir, ":"))
+	functions := settings.DisabledFunctions
+	if functions == nil {
+		functions = defaultPHPDisabledFunctions
+	}
+	for _, function := range functions {
+		if !phpFunctionPattern.MatchString(function) {
+			return "", fmt.Errorf("禁用函数名 %q 无效", function)
+		}
+	}
+	if len(functions) > 0 {
+		lines = append(lines, "php_admin_value[disable_functions] = "+strings.Join(functions, ","))
+	}
+	if len(settings.INIOverrides) > maxPHPINIOverrides {
+		return "", fmt.Errorf("php.ini 覆盖项不能超过 %d 个", maxPHPINIOverrides)
+	}
+	keys := make([]string, 0, len(settings.INIOverrides))
+	for key := range settings.INIOverrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := strings.TrimSpace(settings.INIOverrides[key])
+		if !phpINIKeyPattern.MatchString(key) {
+			return "", fmt.Errorf("php.ini 配置项 %q 无效", key)
+		}
+		if _, reserved := phpReservedINIKeys[key]; reserved {
+			return "", fmt.Errorf("php.ini 配置项 %s 请使用进程池的专用设置", key)
+		}
+		if value == "" || len(value) > 512 || strings.ContainsAny(value, "\r\n\x00;\"") {
+			return "", fmt.Errorf("php.ini 配置项 %s 的值无效", key)
+		}
+		lines = append(lines, fmt.Sprintf("php_admin_value[%s] = %s", key, value))
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// PHPRuntimes lists the PHP lines a site can be pinned to.
+func (service *Service) PHPRuntimes() ([]PHPRuntime, error) {
+	if service.PHP == nil {
+		return []PHPRuntime{}, nil
+	}
+	return service.PHP.Runtimes()
+}
+
+// SwitchPHPVersion pins the site to another installed PHP line. The new pool
+// is running before Nginx is pointed at its socket, and the old pool is only
+// removed after the switch was published.
+func (service *Service) SwitchPHPVersion(ctx context.Context, id int64, version string) (*WebsiteSettingsDocument, error) {
+	settings, _, err := service.loadSettings(id)
+	if err != nil {
+		return nil, err
+	}
+	settings.PHPVersion = strings.TrimSpace(version)
+	return service.UpdateSettings(ctx, id, settings)
+}
+
+// phpPoolChange is a pool update that is live before Nginx publication.
+// Rollback undoes it when publication fails; Commit removes the pool of the
+// previous line after a version switch.
+type phpPoolChange struct {
+	rollback func(context.Context) error
+	commit   func(context.Context) error
+}
+
+func (change *phpPoolChange) Rollback(ctx context.Context) error {
+	if change == nil || change.rollback == nil {
+		return nil
+	}
+	return change.rollback(ctx)
+}
+
+func (change *phpPoolChange) Commit(ctx context.Context) error {
+	if change == nil || change.commit == nil {
+		return nil
+	}
+	return change.commit(ctx)
+}
+
+// applyPHPPool brings the pool of site in line with settings, moving it from
+// the line pinned in previous when the version changed.
+func (service *Service) applyPHPPool(
+	ctx context.Context,
+	site *models.Website,
+	previous, settings WebsiteSettings,
+) (*phpPoolChange, error) {
+	version := strings.TrimSpace(settings.PHPVersion)
+	oldVersion := strings.TrimSpace(previous.PHPVersion)
+	if version == "" && oldVersion == "" {
+		return &phpPoolChange{}, nil
+	}
+	if service.PHP == nil {
+		return nil, errors.New("当前环境未配置 PHP 多版本管理")
+	}
+	change := &phpPoolChange{}
+	if version != "" {
+		runtime, content, err := service.renderSitePHPPool(site, settings)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.prepareSharedPHPPool(ctx, site, oldVersion); err != nil {
+			return nil, err
+		}
+		if change.rollback, err = service.PHP.writePool(ctx, runtime, site.ID, &content); err != nil {
+			return nil, err
+		}
+	}
+	if oldVersion != "" && oldVersion != version {
+		change.commit = func(ctx context.Context) error {
+			runtime, err := service.PHP.Runtime(oldVersion)
+			if err != nil {
+				// The old line was uninstalled together with its pools.
+				return nil
+			}
+			_, err = service.PHP.writePool(ctx, runtime, site.ID, nil)
+			return err
+		}
+	}
+	return change, nil
+}
+
+// prepareSharedPHPPool creates the shared site account before a shared
+// site's pool runs as it, and makes the tree writable for it when the pool
+// pinned to oldVersion ran as another account.
+func (service *Service) prepareSharedPHPPool(ctx context.Context, site *models.Website, oldVersion string) error {
+	if site.SystemUser != "" || service.SystemUsers == nil {
+		return nil
+	}
+	if err := service.SystemUsers.EnsureSharedAccount(ctx); err != nil {
+		return err
+	}
+	if service.PHP.poolUser(oldVersion, site.ID) == SharedSiteAccount {
+		return nil
+	}
+	root, err := service.ManagedRoot(site)
+	if err != nil || root == "" {
+		return err
+	}
+	if _, err := os.Stat(root); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return service.SystemUsers.Normalize(ctx, root, "")
+}
+
+// moveSharedPHPPools re-renders the pools of shared sites that still run as
+// the web server account, which holds the groups of every isolated site.
+func (service *Service) moveSharedPHPPools(ctx context.Context) error {
+	if service.PHP == nil || service.SystemUsers == nil {
+		return nil
+	}
+	pinned := service.DB.Model(&models.WebsiteSetting{}).Select("website_id").Where("php_version <> ?", "")
+	var sites []models.Website
+	if err := service.DB.Where("system_user = ? AND id IN (?)", "", pinned).Order("id").Find(&sites).Error; err != nil {
+		return err
+	}
+	var errs []error
+	for i := range sites {
+		site := &sites[i]
+		settings, _, err := service.loadSettings(site.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if service.PHP.poolUser(settings.PHPVersion, site.ID) != webServerAccount {
+			continue
+		}
+		if settings.PHPPool != nil && strings.TrimSpace(settings.PHPPool.User) == webServerAccount {
+			settings.PHPPool.User = ""
+			encoded, err := json.Marshal(settings.PHPPool)
+			if err == nil {
+				err = service.DB.Model(&models.WebsiteSetting{}).Where("website_id = ?", site.ID).
+					Update("php_pool_json", string(encoded)).Error
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if _, err := service.applyPHPPool(ctx, site, settings, settings); err != nil {
+			errs = append(errs, fmt.Errorf("迁移网站 %s 的 PHP 进程池: %w", site.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renderSitePHPPool resolves the pinned runtime of site and renders its pool.
+func (service *Service) renderSitePHPPool(site *models.Website, settings WebsiteSettings) (PHPRuntime, string, error) {
+	version := strings.TrimSpace(settings.PHPVersion)
+	if service.PHP == nil {
+		return PHPRuntime{}, "", errors.New("当前环境未配置 PHP 多版本管理")
+	}
+	runtime, err := service.PHP.Runtime(version)
+	if err != nil {
+		return PHPRuntime{}, "", err
+	}
+	root, err := service.ManagedRoot(site)
+	if err != nil {
+		return PHPRuntime{}, "", err
+	}
+	content, err := renderPHPPool(site, root, version, settings.PHPPool)
+	return runtime, content, err
+}
+
+// removePHPPool drops the pool of a deleted site.
+func (service *Service) removePHPPool(ctx context.Context, siteID int64, version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" || service.PHP == nil {
+		return nil
+	}
+	runtime, err := service.PHP.Runtime(version)
+	if err != nil {
+		return nil
+	}
+	_, err = service.PHP.writePool(ctx, runtime, siteID, nil)
+	return err
+}
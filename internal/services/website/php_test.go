@@ -0,0 +1,142 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+func TestWebsitePHPVersionSwitchMovesSitePool(t *testing.T) {
+	service := newLifecycleTestService(t)
+	runner := &fakeNginxRunner{}
+	phpRoot := t.TempDir()
+	for _, name := range []string{"php82", "php83", "php"} {
+		if err := os.MkdirAll(filepath.Join(phpRoot, name, "sbin"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(phpRoot, name, "etc", "php-fpm.d"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(phpRoot, name, "sbin", "php-fpm"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stateRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(stateRoot, "php"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateRoot, "php", "version"), []byte("7.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service.PHP = &PHPPoolManager{Root: phpRoot, StateRoot: stateRoot, Runner: runner}
+
+	runtimes, err := service.PHPRuntimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 3 || runtimes[0].Version != "7.4" || !runtimes[0].Legacy ||
+		runtimes[2].Version != "8.3" || runtimes[2].Service != "php83-fpm" {
+		t.Fatalf("unexpected runtimes: %#v", runtimes)
+	}
+
+	site := &models.Website{Domain: "legacy.example.com", Type: "php"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	settings := defaultWebsiteSettings()
+	settings.PHPVersion = "8.2"
+	settings.PHPPool = &WebsitePHPPool{
+		PM: "dynamic", MaxChildren: 8, StartServers: 2, MinSpareServers: 1, MaxSpareServers: 3,
+		OpenBasedir:  []string{"/data/shared"},
+		INIOverrides: map[string]string{"memory_limit": "256M", "upload_max_filesize": "64M"},
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	pool82 := filepath.Join(phpRoot, "php82", "etc", "php-fpm.d", "oneinstack-site1.conf")
+	content, err := os.ReadFile(pool82)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"[site1]\nuser = www-php\ngroup = www\nlisten = /dev/shm/oneinstack-php82-site1.sock",
+		"pm = dynamic\npm.max_children = 8\npm.start_servers = 2\npm.min_spare_servers = 1\npm.max_spare_servers = 3",
+		"php_admin_value[open_basedir] = " + site.RootDir + "/:/tmp/:/var/tmp/:/data/shared/",
+		"php_admin_value[disable_functions] = exec,passthru,shell_exec,system",
+		"php_admin_value[memory_limit] = 256M\nphp_admin_value[upload_max_filesize] = 64M",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("pool is missing %q:\n%s", expected, content)
+		}
+	}
+	config, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "legacy.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "fastcgi_pass unix:/dev/shm/oneinstack-php82-site1.sock;") {
+		t.Fatalf("site does not use its pool socket:\n%s", config)
+	}
+
+	if _, err := service.SwitchPHPVersion(context.Background(), site.ID, "8.3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pool82); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("old pool was kept: %v", err)
+	}
+	pool83 := filepath.Join(phpRoot, "php83", "etc", "php-fpm.d", "oneinstack-site1.conf")
+	if _, err := os.Stat(pool83); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := false
+	for _, call := range runner.calls {
+		if strings.Join(call, " ") == "systemctl reload php83-fpm.service" {
+			reloaded = true
+		}
+	}
+	if !reloaded {
+		t.Fatalf("php83-fpm was not reloaded: %#v", runner.calls)
+	}
+
+	// A rejected FPM configuration restores the running pool.
+	runner.results = []runnerResult{{output: "ERROR: invalid pool", err: errors.New("exit status 78")}}
+	settings.PHPVersion = "8.3"
+	settings.PHPPool.MaxChildren = 9
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err == nil {
+		t.Fatal("rejected FPM configuration was accepted")
+	}
+	restored, err := os.ReadFile(pool83)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(restored), "pm.max_children = 8") {
+		t.Fatalf("pool was not restored:\n%s", restored)
+	}
+
+	for _, pool := range []*WebsitePHPPool{
+		{User: "root"},
+		{User: "www"},
+		{PM: "dynamic", MaxChildren: 2, StartServers: 3},
+		{INIOverrides: map[string]string{"open_basedir": "/"}},
+		{OpenBasedir: []string{"/"}},
+	} {
+		if _, err := renderPHPPool(site, site.RootDir, "8.3", pool); err == nil {
+			t.Fatalf("invalid pool was accepted: %#v", pool)
+		}
+	}
+	settings.PHPVersion = "5.6"
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err == nil {
+		t.Fatal("missing PHP runtime was accepted")
+	}
+
+	if err := service.Delete(context.Background(), site.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pool83); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("pool of deleted site was kept: %v", err)
+	}
+}
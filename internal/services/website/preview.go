@@ -205,15 +205,19 @@ func (service *Service) PreviewSettingsUpdate(id int64, settings WebsiteSettings
 	if err != nil {
 		return WebsiteRuntimePreview{}, err
 	}
-	_, previousRecord, err := service.loadSettings(id)
+	previousSettings, previousRecord, err := service.loadSettings(id)
 	if err != nil {
 		return WebsiteRuntimePreview{}, err
 	}
 	settings.UpdatedAt = nowForWebsitePreview()
+	if settings.BasicAuth, err = normalizeBasicAuth(settings.BasicAuth, previousSettings.BasicAuth); err != nil {
+		return WebsiteRuntimePreview{}, err
+	}
 	record, err := settings.toModel(id)
 	if err != nil {
 		return WebsiteRuntimePreview{}, err
 	}
+	keepManagedSettings(record, previousRecord)
 	tlsOptions, err := service.activeTLSOptions(site.ID, site.Domain)
 	if err != nil {
 		return WebsiteRuntimePreview{}, err
@@ -245,6 +249,11 @@ func (service *Service) PreviewSettingsUpdate(id int64, settings WebsiteSettings
 			return WebsiteRuntimePreview{}, err
 		}
 	}
+	if strings.TrimSpace(settings.PHPVersion) != "" {
+		if _, _, err := service.renderSitePHPPool(site, settings); err != nil {
+			return WebsiteRuntimePreview{}, err
+		}
+	}
 	version, err := service.RuntimeRevision(site.ID)
 	if err != nil {
 		return WebsiteRuntimePreview{}, err
@@ -0,0 +1,476 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// A site using releases keeps every deployment in <root>/releases/<name> and
+// serves <root>/current, a relative symbolic link that is replaced with a
+// rename so a release switch never exposes a half-uploaded tree.
+const (
+	websiteReleasesDir        = "releases"
+	websiteCurrentLink        = "current"
+	defaultWebsiteReleaseKeep = 5
+	maxWebsiteReleaseKeep     = 50
+)
+
+// ErrWebsiteReleaseInvalid marks release requests rejected before any change.
+var ErrWebsiteReleaseInvalid = errors.New("website release is invalid")
+
+var releaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ReleaseInput describes a new release. Source is set by trusted callers
+// such as the Git deployment task to stage an already prepared tree.
+type ReleaseInput struct {
+	Name        string `json:"name"`
+	Note        string `json:"note"`
+	CopyCurrent bool   `json:"copy_current"`
+	Source      string `json:"-"`
+}
+
+// renderReleaseRoot returns the document root of a site using releases and,
+// while a canary is configured, the split_clients block that sends the canary
+// share of clients to the canary release.
+func renderReleaseRoot(site *models.Website, rootDir string, record *models.WebsiteSetting) (string, string, error) {
+	if site == nil || site.ID <= 0 || rootDir == "" || strings.EqualFold(site.Type, "proxy") {
+		return "", "", errors.New("只有 PHP 和静态站点可以使用发布目录")
+	}
+	current := filepath.Join(rootDir, websiteCurrentLink)
+	canary := strings.TrimSpace(record.CanaryRelease)
+	if canary == "" && record.CanaryPercent == 0 {
+		return current, "", nil
+	}
+	if !releaseNamePattern.MatchString(canary) {
+		return "", "", fmt.Errorf("灰度发布版本 %q 无效", canary)
+	}
+	if record.CanaryPercent < 1 || record.CanaryPercent > 99 {
+		return "", "", errors.New("灰度流量比例必须在 1–99 之间")
+	}
+	variable := fmt.Sprintf("$oneinstack_site%d_release", site.ID)
+	block := fmt.Sprintf("split_clients \"${remote_addr}${http_user_agent}\" %s {\n    %d%% \"%s\";\n    * \"%s\";\n}",
+		variable, record.CanaryPercent, filepath.Join(rootDir, websiteReleasesDir, canary), current)
+	return variable, block, nil
+}
+
+func (service *Service) ListReleases(id int64) ([]models.WebsiteRelease, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	var releases []models.WebsiteRelease
+	err := service.DB.Where("website_id = ?", id).Order("id DESC").Find(&releases).Error
+	return releases, err
+}
+
+// CreateRelease stages an empty release directory, or a copy of the active
+// release (the plain site root before the first activation), for uploading.
+// A Source tree takes precedence over CopyCurrent.
+func (service *Service) CreateRelease(ctx context.Context, id int64, input ReleaseInput) (*models.WebsiteRelease, error) {
+	site, root, err := service.releaseSite(id)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = time.Now().Format("20060102-150405")
+	}
+	if !releaseNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: 版本名称只能包含字母、数字、点、下划线和连字符", ErrWebsiteReleaseInvalid)
+	}
+	note := strings.TrimSpace(input.Note)
+	if len([]rune(note)) > 255 {
+		return nil, fmt.Errorf("%w: 版本说明不能超过 255 个字符", ErrWebsiteReleaseInvalid)
+	}
+	var exists int64
+	if err := service.DB.Model(&models.WebsiteRelease{}).
+		Where("website_id = ? AND name = ?", site.ID, name).Count(&exists).Error; err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, fmt.Errorf("%w: 版本 %s 已存在", ErrWebsiteConflict, name)
+	}
+	releasesRoot := filepath.Join(root, websiteReleasesDir)
+	if _, err := ensureManagedDirectory(service.WebRoot, releasesRoot); err != nil {
+		return nil, err
+	}
+	directory := filepath.Join(releasesRoot, name)
+	if err := os.Mkdir(directory, 0755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("%w: 版本目录 %s 已存在", ErrWebsiteConflict, name)
+		}
+		return nil, err
+	}
+	if input.Source != "" {
+		if err := copyReleaseTree(ctx, filepath.Clean(input.Source), directory, false); err != nil {
+			_ = os.RemoveAll(directory)
+			return nil, fmt.Errorf("copy release source: %w", err)
+		}
+	} else if input.CopyCurrent {
+		source := root
+		var active models.WebsiteRelease
+		err := service.DB.First(&active, "website_id = ? AND active = ?", site.ID, true).Error
+		switch {
+		case err == nil:
+			source = filepath.Join(releasesRoot, active.Name)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			_ = os.RemoveAll(directory)
+			return nil, err
+		}
+		if err := copyReleaseTree(ctx, source, directory, source == root); err != nil {
+			_ = os.RemoveAll(directory)
+			return nil, fmt.Errorf("copy current release: %w", err)
+		}
+	}
+	// Copied trees keep the ownership of their source, so an isolated site's
+	// release is handed to its account before it can be activated.
+	if site.SystemUser != "" && service.SystemUsers != nil {
+		if err := service.SystemUsers.Normalize(ctx, directory, site.SystemUser); err != nil {
+			_ = os.RemoveAll(directory)
+			return nil, fmt.Errorf("normalize release ownership: %w", err)
+		}
+	}
+	release := &models.WebsiteRelease{WebsiteID: site.ID, Name: name, Note: note}
+	if err := service.DB.Create(release).Error; err != nil {
+		_ = os.RemoveAll(directory)
+		return nil, err
+	}
+	return release, nil
+}
+
+// ActivateRelease points the current link at a release. The first activation
+// also republishes the site so Nginx serves the link instead of the root.
+// Releases beyond the retention count are removed afterwards.
+func (service *Service) ActivateRelease(ctx context.Context, id, releaseID int64) (*models.WebsiteRelease, error) {
+	site, root, err := service.releaseSite(id)
+	if err != nil {
+		return nil, err
+	}
+	var release models.WebsiteRelease
+	if err := service.DB.First(&release, "id = ? AND website_id = ?", releaseID, site.ID).Error; err != nil {
+		return nil, err
+	}
+	directory, err := validateManagedPath(service.WebRoot, filepath.Join(root, websiteReleasesDir, release.Name))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w: 版本目录 %s 不存在", ErrWebsiteReleaseInvalid, release.Name)
+	}
+	_, previous, err := service.loadSettings(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	updated := *previous
+	updated.ReleasesEnabled = true
+	if updated.CanaryRelease == release.Name {
+		// Activating the canary promotes it to every client.
+		updated.CanaryRelease = ""
+		updated.CanaryPercent = 0
+	}
+
+	currentLink := filepath.Join(root, websiteCurrentLink)
+	restoreLink, err := switchCurrentRelease(currentLink, filepath.Join(websiteReleasesDir, release.Name))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = service.publishReleaseSettings(ctx, site, previous, &updated, func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebsiteRelease{}).Where("website_id = ?", site.ID).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebsiteRelease{}).Where("id = ?", release.ID).
+			Updates(map[string]any{"active": true, "activated_at": now}).Error
+	})
+	if err != nil {
+		return nil, errors.Join(err, restoreLink())
+	}
+	release.Active = true
+	release.ActivatedAt = &now
+	keep := updated.ReleaseKeep
+	if keep == 0 {
+		keep = defaultWebsiteReleaseKeep
+	}
+	if err := service.pruneReleases(site, root, keep, updated.CanaryRelease); err != nil {
+		return &release, fmt.Errorf("prune old releases: %w", err)
+	}
+	return &release, nil
+}
+
+// RollbackRelease reactivates the release that was active before the
+// current one.
+func (service *Service) RollbackRelease(ctx context.Context, id int64) (*models.WebsiteRelease, error) {
+	if _, _, err := service.releaseSite(id); err != nil {
+		return nil, err
+	}
+	var previous models.WebsiteRelease
+	err := service.DB.Where("website_id = ? AND active = ? AND activated_at IS NOT NULL", id, false).
+		Order("activated_at DESC").First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: 没有可回滚的发布版本", ErrWebsiteReleaseInvalid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return service.ActivateRelease(ctx, id, previous.ID)
+}
+
+// SetCanary sends percent of clients to a staged release. A zero release ID
+// or percentage removes the canary.
+func (service *Service) SetCanary(ctx context.Context, id, releaseID int64, percent int) error {
+	site, root, err := service.releaseSite(id)
+	if err != nil {
+		return err
+	}
+	_, previous, err := service.loadSettings(site.ID)
+	if err != nil {
+		return err
+	}
+	updated := *previous
+	updated.CanaryRelease = ""
+	updated.CanaryPercent = 0
+	if releaseID != 0 && percent != 0 {
+		if !previous.ReleasesEnabled {
+			return fmt.Errorf("%w: 请先激活一个发布版本", ErrWebsiteReleaseInvalid)
+		}
+		if percent < 1 || percent > 99 {
+			return fmt.Errorf("%w: 灰度流量比例必须在 1–99 之间", ErrWebsiteReleaseInvalid)
+		}
+		var release models.WebsiteRelease
+		if err := service.DB.First(&release, "id = ? AND website_id = ?", releaseID, site.ID).Error; err != nil {
+			return err
+		}
+		if release.Active {
+			return fmt.Errorf("%w: 当前版本不能作为灰度版本", ErrWebsiteReleaseInvalid)
+		}
+		directory := filepath.Join(root, websiteReleasesDir, release.Name)
+		if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+			return fmt.Errorf("%w: 版本目录 %s 不存在", ErrWebsiteReleaseInvalid, release.Name)
+		}
+		updated.CanaryRelease = release.Name
+		updated.CanaryPercent = percent
+	}
+	return service.publishReleaseSettings(ctx, site, previous, &updated, nil)
+}
+
+func (service *Service) releaseSite(id int64) (*models.Website, string, error) {
+	site, err := service.Get(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.EqualFold(strings.TrimSpace(site.Type), "proxy") {
+		return nil, "", fmt.Errorf("%w: 反向代理站点不支持发布目录", ErrWebsiteReleaseInvalid)
+	}
+	root, err := service.ManagedRoot(site)
+	if err != nil {
+		return nil, "", err
+	}
+	return site, root, nil
+}
+
+// publishReleaseSettings stores release state and republishes the site when
+// its rendered configuration changes, keeping manual configuration edits.
+func (service *Service) publishReleaseSettings(
+	ctx context.Context,
+	site *models.Website,
+	previous, updated *models.WebsiteSetting,
+	apply func(tx *gorm.DB) error,
+) error {
+	tlsOptions, err := service.activeTLSOptions(site.ID, site.Domain)
+	if err != nil {
+		return err
+	}
+	before, err := prepareWebsiteWithTLSAndSettings(
+		site, service.WebRoot, service.LogRoot, service.challengeRoot(), tlsOptions, previous,
+	)
+	if err != nil {
+		return err
+	}
+	after, err := prepareWebsiteWithTLSAndSettings(
+		site, service.WebRoot, service.LogRoot, service.challengeRoot(), tlsOptions, updated,
+	)
+	if err != nil {
+		return err
+	}
+	var publication *Publication
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(updated).Error; err != nil {
+			return err
+		}
+		if apply != nil {
+			if err := apply(tx); err != nil {
+				return err
+			}
+		}
+		if !site.Enabled || before.config == after.config {
+			return nil
+		}
+		content, err := service.preserveCustomWebsiteConfig(site, before.config, after.config)
+		if err != nil {
+			return err
+		}
+		published, err := service.Publisher.Publish(ctx, map[string]*string{after.configName: &content})
+		if err != nil {
+			return err
+		}
+		publication = published
+		return nil
+	})
+	if err != nil && publication != nil {
+		err = errors.Join(err, publication.Rollback(context.Background()))
+	}
+	return err
+}
+
+// switchCurrentRelease atomically replaces the current link and returns a
+// function restoring the previous target.
+func switchCurrentRelease(link, target string) (func() error, error) {
+	previous := ""
+	info, err := os.Lstat(link)
+	switch {
+	case err == nil && info.Mode()&os.ModeSymlink == 0:
+		return nil, fmt.Errorf("%w: 网站根目录中的 %s 不是符号链接，请先移走", ErrWebsiteReleaseInvalid, websiteCurrentLink)
+	case err == nil:
+		if previous, err = os.Readlink(link); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	replace := func(target string) error {
+		temporary := filepath.Join(filepath.Dir(link), "."+websiteCurrentLink+"-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+		if err := os.Symlink(target, temporary); err != nil {
+			return err
+		}
+		if err := os.Rename(temporary, link); err != nil {
+			_ = os.Remove(temporary)
+			return err
+		}
+		return nil
+	}
+	if err := replace(target); err != nil {
+		return nil, fmt.Errorf("switch current release: %w", err)
+	}
+	return func() error {
+		if previous == "" {
+			return os.Remove(link)
+		}
+		return replace(previous)
+	}, nil
+}
+
+// pruneReleases removes the oldest releases beyond keep. The active release
+// and the canary are always kept.
+func (service *Service) pruneReleases(site *models.Website, root string, keep int, canary string) error {
+	var releases []models.WebsiteRelease
+	if err := service.DB.Where("website_id = ?", site.ID).Order("id DESC").Find(&releases).Error; err != nil {
+		return err
+	}
+	var result error
+	kept := 0
+	for _, release := range releases {
+		if release.Active || release.Name == canary || kept < keep {
+			kept++
+			continue
+		}
+		directory, err := validateManagedPath(service.WebRoot, filepath.Join(root, websiteReleasesDir, release.Name))
+		if err == nil {
+			err = os.RemoveAll(directory)
+		}
+		if err == nil {
+			err = service.DB.Delete(&models.WebsiteRelease{}, "id = ?", release.ID).Error
+		}
+		if err != nil {
+			result = errors.Join(result, fmt.Errorf("remove release %s: %w", release.Name, err))
+		}
+	}
+	return result
+}
+
+// copyReleaseTree copies a release, recreating symbolic links as links. A
+// plain site root is copied without its releases directory and current link.
+func copyReleaseTree(ctx context.Context, source, destination string, siteRoot bool) error {
+	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if relative == "." {
+			return nil
+		}
+		if siteRoot && (relative == websiteReleasesDir || relative == websiteCurrentLink ||
+			strings.HasPrefix(relative, "."+websiteCurrentLink+"-")) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(destination, relative)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyReleaseFile(path, target, info)
+		default:
+			return nil
+		}
+	})
+}
+
+// copyReleaseFile copies the regular file the walk found at source. Release
+// sources can be written by other accounts, so the file is opened without
+// following links and must still be the file that was walked; a path swapped
+// for a link in the meantime fails the copy instead of leaking its target.
+func copyReleaseFile(source, target string, walked fs.FileInfo) error {
+	input, err := os.OpenFile(source, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	opened, err := input.Stat()
+	if err != nil {
+		return err
+	}
+	if !opened.Mode().IsRegular() || !os.SameFile(opened, walked) {
+		return fmt.Errorf("release file %s changed while it was copied", source)
+	}
+	output, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, walked.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
@@ -0,0 +1,160 @@
+package website
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+func TestWebsiteReleasesSwitchAtomicallyWithCanaryAndRollback(t *testing.T) {
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "deploy.example.com", Type: "php"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, WebsiteSettings{
+		DefaultDocuments: "index.php", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		AccessLogEnabled: true, ErrorLogEnabled: true, ReleaseKeep: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	root := site.RootDir
+	if err := os.WriteFile(filepath.Join(root, "index.php"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	readConfig := func() string {
+		content, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "deploy.example.com.conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+	current := filepath.Join(root, websiteCurrentLink)
+	currentTarget := func() string {
+		target, err := os.Readlink(current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+
+	first, err := service.CreateRelease(context.Background(), site.ID, ReleaseInput{Name: "v1", CopyCurrent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, websiteReleasesDir, "v1", "index.php")); err != nil || string(content) != "v1" {
+		t.Fatalf("first release did not copy the site root: %q %v", content, err)
+	}
+	if _, err := service.CreateRelease(context.Background(), site.ID, ReleaseInput{Name: "../x"}); err == nil {
+		t.Fatal("unsafe release name was accepted")
+	}
+	if err := service.SetCanary(context.Background(), site.ID, first.ID, 10); err == nil {
+		t.Fatal("canary was accepted before any release was active")
+	}
+	if _, err := service.ActivateRelease(context.Background(), site.ID, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	config := readConfig()
+	if currentTarget() != filepath.Join(websiteReleasesDir, "v1") ||
+		!strings.Contains(config, "root "+current+";") ||
+		!strings.Contains(config, "fastcgi_param SCRIPT_FILENAME $realpath_root$fastcgi_script_name;") {
+		t.Fatalf("first activation did not switch to the current link:\n%s", config)
+	}
+
+	second, err := service.CreateRelease(context.Background(), site.ID, ReleaseInput{Name: "v2", CopyCurrent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, websiteReleasesDir, "v2", "index.php"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetCanary(context.Background(), site.ID, second.ID, 10); err != nil {
+		t.Fatal(err)
+	}
+	config = readConfig()
+	variable := fmt.Sprintf("$oneinstack_site%d_release", site.ID)
+	if !strings.Contains(config, "split_clients \"${remote_addr}${http_user_agent}\" "+variable+" {\n    10% \""+
+		filepath.Join(root, websiteReleasesDir, "v2")+"\";\n    * \""+current+"\";\n}") ||
+		!strings.Contains(config, "root "+variable+";") {
+		t.Fatalf("canary split was not rendered:\n%s", config)
+	}
+	if currentTarget() != filepath.Join(websiteReleasesDir, "v1") {
+		t.Fatal("canary changed the current release")
+	}
+
+	if _, err := service.ActivateRelease(context.Background(), site.ID, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if currentTarget() != filepath.Join(websiteReleasesDir, "v2") || strings.Contains(readConfig(), "split_clients") {
+		t.Fatalf("activating the canary did not promote it:\n%s", readConfig())
+	}
+	rolledBack, err := service.RollbackRelease(context.Background(), site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Name != "v1" || currentTarget() != filepath.Join(websiteReleasesDir, "v1") {
+		t.Fatalf("rollback did not restore v1: %#v", rolledBack)
+	}
+
+	third, err := service.CreateRelease(context.Background(), site.ID, ReleaseInput{Name: "v3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ActivateRelease(context.Background(), site.ID, third.ID); err != nil {
+		t.Fatal(err)
+	}
+	releases, err := service.ListReleases(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 2 || releases[0].Name != "v3" || !releases[0].Active || releases[1].Name != "v2" {
+		t.Fatalf("retention kept unexpected releases: %#v", releases)
+	}
+	if _, err := os.Stat(filepath.Join(root, websiteReleasesDir, "v1")); !os.IsNotExist(err) {
+		t.Fatalf("pruned release directory still exists: %v", err)
+	}
+
+	if _, err := service.UpdateSettings(context.Background(), site.ID, WebsiteSettings{
+		DefaultDocuments: "index.php", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		AccessLogEnabled: true, ErrorLogEnabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(readConfig(), "root "+current+";") {
+		t.Fatalf("settings update dropped the release root:\n%s", readConfig())
+	}
+}
+
+func TestCopyReleaseFileRefusesAFileSwappedForALink(t *testing.T) {
+	root := t.TempDir()
+	secret := filepath.Join(root, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(root, "index.html")
+	if err := os.WriteFile(source, []byte("page"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	walked, err := os.Lstat(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, source); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "copy.html")
+	if err := copyReleaseFile(source, target, walked); err == nil {
+		t.Fatal("a file swapped for a link was copied")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("the link target was written to the release: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package website
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	maxWebsiteRequestLimits    = 16
+	maxWebsiteRequestRate      = 100000
+	maxWebsiteRequestBurst     = 100000
+	maxWebsiteConnectionLimit  = 65535
+	maxWebsiteRequestWhitelist = 200
+
+	requestLimitKeyIP           = "ip"
+	requestLimitKeyHeaderPrefix = "header:"
+)
+
+var requestLimitHeaderPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,63}$`)
+
+// WebsiteRequestLimit throttles requests below Path, or the whole site when
+// Path is empty, with a limit_req rate and/or a limit_conn ceiling. Key is
+// "ip" or "header:<Name>"; requests without the header, and clients in
+// Whitelist, are never limited.
+type WebsiteRequestLimit struct {
+	Path        string   `json:"path"`
+	Rate        int      `json:"rate"`
+	RateUnit    string   `json:"rate_unit"`
+	Burst       int      `json:"burst"`
+	NoDelay     bool     `json:"nodelay"`
+	Connections int      `json:"connections"`
+	Key         string   `json:"key"`
+	Whitelist   []string `json:"whitelist"`
+	Enabled     bool     `json:"enabled"`
+}
+
+// renderRequestLimits returns the zones and key maps for the http context and
+// the limit_req/limit_conn directives for the server block. The directives
+// sit at server level so they also cover PHP and proxy locations; path
+// scoping happens in the key map, because an empty key is not accounted.
+func renderRequestLimits(site *models.Website, limits []WebsiteRequestLimit) (string, []string, error) {
+	if len(limits) > maxWebsiteRequestLimits {
+		return "", nil, fmt.Errorf("请求限制规则不能超过 %d 条", maxWebsiteRequestLimits)
+	}
+	var blocks, server []string
+	seen := make(map[string]struct{})
+	for index, limit := range limits {
+		if !limit.Enabled {
+			continue
+		}
+		if site == nil || site.ID <= 0 {
+			return "", nil, errors.New("请求限制需要已保存的网站")
+		}
+		path := ""
+		if strings.TrimSpace(limit.Path) != "" && strings.TrimSpace(limit.Path) != "/" {
+			var err error
+			if path, err = validateLocationPath(limit.Path); err != nil {
+				return "", nil, fmt.Errorf("请求限制: %w", err)
+			}
+		}
+		if _, exists := seen[path]; exists {
+			return "", nil, fmt.Errorf("请求限制路径 %q 被重复配置", path)
+		}
+		seen[path] = struct{}{}
+		if limit.Rate < 0 || limit.Rate > maxWebsiteRequestRate ||
+			limit.Burst < 0 || limit.Burst > maxWebsiteRequestBurst {
+			return "", nil, fmt.Errorf("请求速率必须在 0–%d 之间，突发值必须在 0–%d 之间",
+				maxWebsiteRequestRate, maxWebsiteRequestBurst)
+		}
+		if limit.Connections < 0 || limit.Connections > maxWebsiteConnectionLimit {
+			return "", nil, fmt.Errorf("并发连接数必须在 0–%d 之间", maxWebsiteConnectionLimit)
+		}
+		if limit.Rate == 0 && limit.Connections == 0 {
+			return "", nil, errors.New("请求限制至少需要设置请求速率或并发连接数")
+		}
+		unit := strings.TrimSpace(limit.RateUnit)
+		if unit == "" {
+			unit = "s"
+		}
+		if unit != "s" && unit != "m" {
+			return "", nil, errors.New("请求速率单位只能是 s 或 m")
+		}
+		key, err := requestLimitKeyVariable(limit.Key)
+		if err != nil {
+			return "", nil, err
+		}
+		whitelist, err := validateIPLines(strings.Join(limit.Whitelist, "\n"))
+		if err != nil {
+			return "", nil, fmt.Errorf("请求限制白名单: %w", err)
+		}
+		if len(whitelist) > maxWebsiteRequestWhitelist {
+			return "", nil, fmt.Errorf("请求限制白名单不能超过 %d 条", maxWebsiteRequestWhitelist)
+		}
+
+		prefix := fmt.Sprintf("$oneinstack_site%d_limit%d", site.ID, index+1)
+		if path != "" || len(whitelist) > 0 {
+			source, pattern := "$uri", "^"+regexp.QuoteMeta(path)
+			if len(whitelist) > 0 {
+				trusted := prefix + "_trusted"
+				entries := make([]string, 0, len(whitelist))
+				for _, value := range whitelist {
+					entries = append(entries, fmt.Sprintf("\n    %s 1;", value))
+				}
+				blocks = append(blocks, fmt.Sprintf(
+					"geo $remote_addr %s {\n    default 0;%s\n}", trusted, strings.Join(entries, ""),
+				))
+				source, pattern = `"`+trusted+`$uri"`, "^0"+regexp.QuoteMeta(path)
+			}
+			if path != "" {
+				pattern += "(?:/|$)"
+			}
+			blocks = append(blocks, fmt.Sprintf(
+				"map %s %s_key {\n    default \"\";\n    \"~%s\" %s;\n}", source, prefix, pattern, key,
+			))
+			key = prefix + "_key"
+		}
+		if limit.Rate > 0 {
+			zone := fmt.Sprintf("oneinstack_site%d_req%d", site.ID, index+1)
+			blocks = append(blocks, fmt.Sprintf("limit_req_zone %s zone=%s:10m rate=%dr/%s;", key, zone, limit.Rate, unit))
+			directive := fmt.Sprintf("    limit_req zone=%s burst=%d", zone, limit.Burst)
+			if limit.NoDelay {
+				directive += " nodelay"
+			}
+			server = append(server, directive+";")
+		}
+		if limit.Connections > 0 {
+			zone := fmt.Sprintf("oneinstack_site%d_conn%d", site.ID, index+1)
+			blocks = append(blocks, fmt.Sprintf("limit_conn_zone %s zone=%s:10m;", key, zone))
+			server = append(server, fmt.Sprintf("    limit_conn %s %d;", zone, limit.Connections))
+		}
+	}
+	return strings.Join(blocks, "\n"), server, nil
+}
+
+// requestLimitKeyVariable maps a limit key to the Nginx variable the zone is
+// keyed by.
+func requestLimitKeyVariable(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == requestLimitKeyIP {
+		return "$binary_remote_addr", nil
+	}
+	header, ok := strings.CutPrefix(value, requestLimitKeyHeaderPrefix)
+	if !ok || !requestLimitHeaderPattern.MatchString(header) {
+		return "", fmt.Errorf("请求限制键 %q 无效，只能是 ip 或 header:<请求头名>", value)
+	}
+	return "$http_" + strings.ReplaceAll(strings.ToLower(header), "-", "_"), nil
+}
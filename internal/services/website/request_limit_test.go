@@ -0,0 +1,79 @@
+package website
+
+import (
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+func TestRequestLimitsRenderZonesKeyMapsAndServerDirectives(t *testing.T) {
+	site := &models.Website{ID: 7, Type: "php"}
+	settings := defaultWebsiteSettings()
+	settings.RequestLimits = []WebsiteRequestLimit{
+		{Rate: 50, Burst: 100, NoDelay: true, Connections: 20, Enabled: true},
+		{Path: "/wp-login.php", Rate: 10, RateUnit: "m", Burst: 5, Whitelist: []string{"10.0.0.0/8", "192.0.2.10"}, Enabled: true},
+		{Path: "/api/", Rate: 5, Key: "header:X-Api-Key", Enabled: true},
+		{Path: "/disabled", Rate: 1, Enabled: false},
+	}
+	settings.WAF = &WebsiteWAF{Enabled: true, RatePerSecond: 30, RateBurst: 60}
+	record, err := settings.toModel(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := renderWebsiteSettings(site, "/data/wwwroot/limits", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"limit_req_zone $binary_remote_addr zone=oneinstack_site7_req1:10m rate=50r/s;",
+		"limit_conn_zone $binary_remote_addr zone=oneinstack_site7_conn1:10m;",
+		"geo $remote_addr $oneinstack_site7_limit2_trusted {\n    default 0;\n    10.0.0.0/8 1;\n    192.0.2.10 1;\n}",
+		"map \"$oneinstack_site7_limit2_trusted$uri\" $oneinstack_site7_limit2_key {\n    default \"\";\n    \"~^0/wp-login\\.php(?:/|$)\" $binary_remote_addr;\n}",
+		"limit_req_zone $oneinstack_site7_limit2_key zone=oneinstack_site7_req2:10m rate=10r/m;",
+		"map $uri $oneinstack_site7_limit3_key {\n    default \"\";\n    \"~^/api(?:/|$)\" $http_x_api_key;\n}",
+	} {
+		if !strings.Contains(rendered.Upstreams, expected) {
+			t.Fatalf("http context is missing %q:\n%s", expected, rendered.Upstreams)
+		}
+	}
+	for _, expected := range []string{
+		"    limit_req zone=oneinstack_site7_req1 burst=100 nodelay;",
+		"    limit_conn oneinstack_site7_conn1 20;",
+		"    limit_req zone=oneinstack_site7_req2 burst=5;",
+		"    limit_req zone=oneinstack_site7_req3 burst=0;",
+		"    limit_conn_status 429;",
+		"    limit_req zone=oneinstack_site7_waf burst=60 nodelay;",
+	} {
+		if !strings.Contains(rendered.ServerDirectives, expected) {
+			t.Fatalf("server directives are missing %q:\n%s", expected, rendered.ServerDirectives)
+		}
+	}
+	if count := strings.Count(rendered.ServerDirectives, "limit_req_status 429;"); count != 1 {
+		t.Fatalf("limit_req_status rendered %d times:\n%s", count, rendered.ServerDirectives)
+	}
+	if strings.Contains(rendered.Upstreams, "disabled") {
+		t.Fatalf("disabled limit was rendered:\n%s", rendered.Upstreams)
+	}
+
+	invalid := [][]WebsiteRequestLimit{
+		{{Path: "/login", Enabled: true}},
+		{{Path: "/login", Rate: 1, RateUnit: "h", Enabled: true}},
+		{{Path: "/login", Rate: 1, Key: "header:X Bad", Enabled: true}},
+		{{Path: "/login", Rate: 1, Key: "cookie:session", Enabled: true}},
+		{{Path: "/login", Rate: 1, Whitelist: []string{"not-an-ip"}, Enabled: true}},
+		{{Path: "/login;", Rate: 1, Enabled: true}},
+		{{Path: "/login", Rate: 1, Enabled: true}, {Path: "/login/", Connections: 1, Enabled: true}},
+	}
+	for _, limits := range invalid {
+		settings := defaultWebsiteSettings()
+		settings.RequestLimits = limits
+		record, err := settings.toModel(site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := renderWebsiteSettings(site, "/data/wwwroot/limits", record); err == nil {
+			t.Fatalf("invalid request limits were accepted: %#v", limits)
+		}
+	}
+}
@@ -34,11 +34,14 @@ type WebsiteRedirectRule struct {
 	Enabled bool   `json:"enabled"`
 }
 
+// WebsiteProxyRule forwards a path to Target, or to the named upstream pool
+// when Upstream is set.
 type WebsiteProxyRule struct {
-	Path    string `json:"path"`
-	Target  string `json:"target"`
-	Host    string `json:"host"`
-	Enabled bool   `json:"enabled"`
+	Path     string `json:"path"`
+	Target   string `json:"target"`
+	Upstream string `json:"upstream,omitempty"`
+	Host     string `json:"host"`
+	Enabled  bool   `json:"enabled"`
 }
 
 type WebsiteSettings struct {
@@ -53,6 +56,11 @@ type WebsiteSettings struct {
 	Bindings          []WebsiteDirectoryBinding `json:"bindings"`
 	Redirects         []WebsiteRedirectRule     `json:"redirects"`
 	ProxyRules        []WebsiteProxyRule        `json:"proxy_rules"`
+	Upstreams         []WebsiteUpstream         `json:"upstreams"`
+	ProxyUpstream     string                    `json:"proxy_upstream"`
+	ReleaseKeep       int                       `json:"release_keep"`
+	WAF               *WebsiteWAF               `json:"waf,omitempty"`
+	RequestLimits     []WebsiteRequestLimit     `json:"request_limits"`
 	HotlinkEnabled    bool                      `json:"hotlink_enabled"`
 	HotlinkAllowEmpty bool                      `json:"hotlink_allow_empty"`
 	HotlinkDomains    string                    `json:"hotlink_domains"`
@@ -60,6 +68,9 @@ type WebsiteSettings struct {
 	SecurityHeaders   bool                      `json:"security_headers"`
 	DeniedPaths       string                    `json:"denied_paths"`
 	PHPBackend        string                    `json:"php_backend"`
+	PHPVersion        string                    `json:"php_version"`
+	PHPPool           *WebsitePHPPool           `json:"php_pool,omitempty"`
+	BasicAuth         *WebsiteBasicAuth         `json:"basic_auth,omitempty"`
 	TamperProtection  bool                      `json:"tamper_protection"`
 	TrafficAlert      bool                      `json:"traffic_alert"`
 	TrafficAlertBytes int64                     `json:"traffic_alert_bytes"`
@@ -84,14 +95,23 @@ type WebsiteLogDocument struct {
 	Lines   int    `json:"lines"`
 }
 
+// renderedWebsiteSettings holds the settings fragments for the site
+// templates. Upstreams carries every block placed in the Nginx http context;
+// DocumentRoot replaces RootDir in the root directive when releases are used.
 type renderedWebsiteSettings struct {
 	RootDir           string
+	DocumentRoot      string
+	RealPathRoot      bool
+	ProxyURL          string
+	Upstreams         string
 	DefaultDocuments  string
 	AutoIndex         string
 	PHPBackend        string
 	RewriteDirectives string
 	ServerDirectives  string
 	ExtraLocations    string
+	WAFVariable       string
+	BasicAuthRealm    string
 	AccessLogEnabled  bool
 	ErrorLogEnabled   bool
 }
@@ -135,15 +155,19 @@ func (service *Service) UpdateSettings(
 	if err != nil {
 		return nil, err
 	}
-	_, previousRecord, err := service.loadSettings(id)
+	previousSettings, previousRecord, err := service.loadSettings(id)
 	if err != nil {
 		return nil, err
 	}
 	settings.UpdatedAt = time.Now()
+	if settings.BasicAuth, err = normalizeBasicAuth(settings.BasicAuth, previousSettings.BasicAuth); err != nil {
+		return nil, err
+	}
 	record, err := settings.toModel(id)
 	if err != nil {
 		return nil, err
 	}
+	keepManagedSettings(record, previousRecord)
 	tlsOptions, err := service.activeTLSOptions(site.ID, site.Domain)
 	if err != nil {
 		return nil, err
@@ -170,6 +194,15 @@ func (service *Service) UpdateSettings(
 	if err != nil {
 		return nil, err
 	}
+	// The pool must listen before Nginx points fastcgi_pass at its socket.
+	phpPool, err := service.applyPHPPool(ctx, site, previousSettings, settings)
+	if err != nil {
+		return nil, err
+	}
+	restoreBasicAuth, err := writeBasicAuthFile(service.WebRoot, site.ID, settings.BasicAuth)
+	if err != nil {
+		return nil, errors.Join(err, phpPool.Rollback(context.Background()))
+	}
 
 	var publication *Publication
 	err = service.DB.Transaction(func(tx *gorm.DB) error {
@@ -206,7 +239,10 @@ func (service *Service) UpdateSettings(
 		if publication != nil {
 			err = errors.Join(err, publication.Rollback(context.Background()))
 		}
-		return nil, err
+		return nil, errors.Join(err, restoreBasicAuth(), phpPool.Rollback(context.Background()))
+	}
+	if err := phpPool.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("网站已切换 PHP 版本，但旧进程池清理失败: %w", err)
 	}
 	return &WebsiteSettingsDocument{Website: *site, Settings: settings}, nil
 }
@@ -447,8 +483,8 @@ func (service *Service) ReadLog(id int64, logType string, lineLimit int) (*Websi
 		return nil, err
 	}
 	logType = strings.ToLower(strings.TrimSpace(logType))
-	if logType != "access" && logType != "error" {
-		return nil, errors.New("日志类型只能是 access 或 error")
+	if logType != "access" && logType != "error" && logType != "waf" {
+		return nil, errors.New("日志类型只能是 access、error 或 waf")
 	}
 	if lineLimit <= 0 {
 		lineLimit = 200
@@ -735,7 +771,8 @@ func websiteSettingsFromModel(record *models.WebsiteSetting) (WebsiteSettings, e
 		PHPBackend: record.PHPBackend, TamperProtection: record.TamperProtection,
 		TrafficAlert: record.TrafficAlert, TrafficAlertBytes: record.TrafficAlertBytes,
 		AccessLogEnabled: record.AccessLogEnabled, ErrorLogEnabled: record.ErrorLogEnabled,
-		UpdatedAt: record.UpdatedAt,
+		ProxyUpstream: record.ProxyUpstream, ReleaseKeep: record.ReleaseKeep,
+		PHPVersion: record.PHPVersion, UpdatedAt: record.UpdatedAt,
 	}
 	if strings.TrimSpace(settings.DefaultDocuments) == "" {
 		settings.DefaultDocuments = defaultWebsiteSettings().DefaultDocuments
@@ -761,6 +798,31 @@ func websiteSettingsFromModel(record *models.WebsiteSetting) (WebsiteSettings, e
 			return WebsiteSettings{}, fmt.Errorf("decode website proxy rules: %w", err)
 		}
 	}
+	if record.UpstreamsJSON != "" {
+		if err := json.Unmarshal([]byte(record.UpstreamsJSON), &settings.Upstreams); err != nil {
+			return WebsiteSettings{}, fmt.Errorf("decode website upstream pools: %w", err)
+		}
+	}
+	if record.WAFJSON != "" {
+		if err := json.Unmarshal([]byte(record.WAFJSON), &settings.WAF); err != nil {
+			return WebsiteSettings{}, fmt.Errorf("decode website firewall: %w", err)
+		}
+	}
+	if record.RequestLimitsJSON != "" {
+		if err := json.Unmarshal([]byte(record.RequestLimitsJSON), &settings.RequestLimits); err != nil {
+			return WebsiteSettings{}, fmt.Errorf("decode website request limits: %w", err)
+		}
+	}
+	if record.PHPPoolJSON != "" {
+		if err := json.Unmarshal([]byte(record.PHPPoolJSON), &settings.PHPPool); err != nil {
+			return WebsiteSettings{}, fmt.Errorf("decode website PHP pool: %w", err)
+		}
+	}
+	if record.BasicAuthJSON != "" {
+		if err := json.Unmarshal([]byte(record.BasicAuthJSON), &settings.BasicAuth); err != nil {
+			return WebsiteSettings{}, fmt.Errorf("decode website basic authentication: %w", err)
+		}
+	}
 	return settings, nil
 }
 
@@ -777,6 +839,36 @@ func (settings WebsiteSettings) toModel(id int64) (*models.WebsiteSetting, error
 	if err != nil {
 		return nil, err
 	}
+	upstreams := []byte("")
+	if len(settings.Upstreams) > 0 {
+		if upstreams, err = json.Marshal(settings.Upstreams); err != nil {
+			return nil, err
+		}
+	}
+	waf := []byte("")
+	if settings.WAF != nil {
+		if waf, err = json.Marshal(settings.WAF); err != nil {
+			return nil, err
+		}
+	}
+	requestLimits := []byte("")
+	if len(settings.RequestLimits) > 0 {
+		if requestLimits, err = json.Marshal(settings.RequestLimits); err != nil {
+			return nil, err
+		}
+	}
+	phpPool := []byte("")
+	if settings.PHPPool != nil {
+		if phpPool, err = json.Marshal(settings.PHPPool); err != nil {
+			return nil, err
+		}
+	}
+	basicAuth := []byte("")
+	if settings.BasicAuth != nil {
+		if basicAuth, err = json.Marshal(settings.BasicAuth); err != nil {
+			return nil, err
+		}
+	}
 	return &models.WebsiteSetting{
 		WebsiteID: id, RunningDirectory: settings.RunningDirectory,
 		DirectoryListing: settings.DirectoryListing, DefaultDocuments: settings.DefaultDocuments,
@@ -784,7 +876,14 @@ func (settings WebsiteSettings) toModel(id int64) (*models.WebsiteSetting, error
 		RateLimitKB: settings.RateLimitKB, RateLimitAfterKB: settings.RateLimitAfterKB,
 		RewriteRules: settings.RewriteRules, BindingsJSON: string(bindings),
 		RedirectsJSON: string(redirects), ProxyRulesJSON: string(proxies),
-		HotlinkEnabled: settings.HotlinkEnabled, HotlinkAllowEmpty: settings.HotlinkAllowEmpty,
+		UpstreamsJSON: string(upstreams), ProxyUpstream: strings.TrimSpace(settings.ProxyUpstream),
+		WAFJSON:           string(waf),
+		RequestLimitsJSON: string(requestLimits),
+		PHPVersion:        strings.TrimSpace(settings.PHPVersion),
+		PHPPoolJSON:       string(phpPool),
+		BasicAuthJSON:     string(basicAuth),
+		ReleaseKeep:       settings.ReleaseKeep,
+		HotlinkEnabled:    settings.HotlinkEnabled, HotlinkAllowEmpty: settings.HotlinkAllowEmpty,
 		HotlinkDomains: settings.HotlinkDomains, HotlinkExtensions: settings.HotlinkExtensions,
 		SecurityHeaders: settings.SecurityHeaders, DeniedPaths: settings.DeniedPaths,
 		PHPBackend: settings.PHPBackend, TamperProtection: settings.TamperProtection,
@@ -794,18 +893,32 @@ func (settings WebsiteSettings) toModel(id int64) (*models.WebsiteSetting, error
 	}, nil
 }
 
+// keepManagedSettings carries the state owned by the health checker and the
+// release manager into a record rebuilt from user-editable settings.
+func keepManagedSettings(record, previous *models.WebsiteSetting) {
+	if previous == nil {
+		return
+	}
+	record.EjectedBackends = previous.EjectedBackends
+	record.ReleasesEnabled = previous.ReleasesEnabled
+	record.CanaryRelease = previous.CanaryRelease
+	record.CanaryPercent = previous.CanaryPercent
+}
+
 func renderWebsiteSettings(
 	site *models.Website,
 	rootDir string,
 	record *models.WebsiteSetting,
 ) (renderedWebsiteSettings, error) {
 	settings := defaultWebsiteSettings()
+	ejected := map[string]struct{}{}
 	if record != nil {
 		var err error
 		settings, err = websiteSettingsFromModel(record)
 		if err != nil {
 			return renderedWebsiteSettings{}, err
 		}
+		ejected = parseEjectedBackends(record.EjectedBackends)
 	}
 	rendered := renderedWebsiteSettings{
 		DefaultDocuments: settings.DefaultDocuments,
@@ -826,9 +939,36 @@ func renderWebsiteSettings(
 	if err := validatePHPBackend(settings.PHPBackend); err != nil {
 		return renderedWebsiteSettings{}, err
 	}
+	if version := strings.TrimSpace(settings.PHPVersion); version != "" {
+		if !phpVersionPattern.MatchString(version) {
+			return renderedWebsiteSettings{}, fmt.Errorf("PHP 版本 %q 无效", version)
+		}
+		if site == nil || site.ID <= 0 || strings.EqualFold(site.Type, "proxy") {
+			return renderedWebsiteSettings{}, errors.New("只有已保存的 PHP 站点可以指定 PHP 版本")
+		}
+		rendered.PHPBackend = "unix:" + phpPoolSocket(site.ID, version)
+	}
 	if site != nil && strings.EqualFold(site.Type, "proxy") {
 		rendered.PHPBackend = "unix:/dev/shm/php-cgi.sock"
 	}
+	if auth := settings.BasicAuth; auth != nil && auth.Enabled {
+		if site == nil || site.ID <= 0 {
+			return renderedWebsiteSettings{}, errors.New("只有已保存的站点可以启用访问认证")
+		}
+		if err := validateBasicAuthRealm(auth.Realm); err != nil {
+			return renderedWebsiteSettings{}, err
+		}
+		if _, err := renderBasicAuthFile(auth); err != nil {
+			return renderedWebsiteSettings{}, err
+		}
+		if len(auth.Users) == 0 {
+			return renderedWebsiteSettings{}, errors.New("启用访问认证时至少需要一个用户")
+		}
+		rendered.BasicAuthRealm = strings.TrimSpace(auth.Realm)
+		if rendered.BasicAuthRealm == "" {
+			rendered.BasicAuthRealm = defaultBasicAuthRealm
+		}
+	}
 	if rootDir != "" && strings.TrimSpace(settings.RunningDirectory) != "" {
 		runningRoot, err := managedRunningDirectory(rootDir, settings.RunningDirectory)
 		if err != nil {
@@ -836,18 +976,59 @@ func renderWebsiteSettings(
 		}
 		rendered.RootDir = runningRoot
 	}
+	if settings.ReleaseKeep < 0 || settings.ReleaseKeep > maxWebsiteReleaseKeep {
+		return renderedWebsiteSettings{}, fmt.Errorf("保留的发布版本数必须在 0–%d 之间", maxWebsiteReleaseKeep)
+	}
+	releaseBlocks := ""
+	if record != nil && record.ReleasesEnabled {
+		documentRoot, blocks, err := renderReleaseRoot(site, rootDir, record)
+		if err != nil {
+			return renderedWebsiteSettings{}, err
+		}
+		if strings.TrimSpace(settings.RunningDirectory) != "" {
+			if documentRoot, err = managedRunningDirectory(documentRoot, settings.RunningDirectory); err != nil {
+				return renderedWebsiteSettings{}, err
+			}
+		}
+		rendered.DocumentRoot = documentRoot
+		rendered.RealPathRoot = true
+		releaseBlocks = blocks
+	}
 
 	rewrite, err := renderRewriteRules(settings.RewriteRules)
 	if err != nil {
 		return renderedWebsiteSettings{}, err
 	}
 	rendered.RewriteDirectives = rewrite
-	serverDirectives, err := renderServerDirectives(settings)
+	serverDirectives, limitZones, err := renderServerDirectives(site, settings)
 	if err != nil {
 		return renderedWebsiteSettings{}, err
 	}
 	rendered.ServerDirectives = serverDirectives
-	extraLocations, err := renderExtraLocations(rootDir, settings)
+	waf, err := renderWAF(site, settings.WAF)
+	if err != nil {
+		return renderedWebsiteSettings{}, err
+	}
+	if waf.ServerDirectives != "" {
+		rendered.ServerDirectives = strings.TrimPrefix(rendered.ServerDirectives+"\n"+waf.ServerDirectives, "\n")
+	}
+	rendered.WAFVariable = waf.Variable
+	upstreams, upstreamTargets, err := renderUpstreams(site, settings.Upstreams, ejected)
+	if err != nil {
+		return renderedWebsiteSettings{}, err
+	}
+	rendered.Upstreams = strings.TrimSpace(strings.Join([]string{upstreams, releaseBlocks, waf.HTTPBlocks, limitZones}, "\n"))
+	if pool := strings.TrimSpace(settings.ProxyUpstream); pool != "" {
+		if site == nil || !strings.EqualFold(site.Type, "proxy") {
+			return renderedWebsiteSettings{}, errors.New("只有反向代理站点可以使用上游池作为默认目标")
+		}
+		target, exists := upstreamTargets[pool]
+		if !exists {
+			return renderedWebsiteSettings{}, fmt.Errorf("上游池 %s 不存在", pool)
+		}
+		rendered.ProxyURL = target
+	}
+	extraLocations, err := renderExtraLocations(rootDir, settings, upstreamTargets)
 	if err != nil {
 		return renderedWebsiteSettings{}, err
 	}
@@ -942,15 +1123,17 @@ func renderRewriteRules(value string) (string, error) {
 	return strings.TrimSuffix(result.String(), "\n"), nil
 }
 
-func renderServerDirectives(settings WebsiteSettings) (string, error) {
+// renderServerDirectives returns the server-level directives and the
+// http-context zones the request limits depend on.
+func renderServerDirectives(site *models.Website, settings WebsiteSettings) (string, string, error) {
 	var lines []string
 	allowed, err := validateIPLines(settings.AllowedIPs)
 	if err != nil {
-		return "", fmt.Errorf("访问白名单: %w", err)
+		return "", "", fmt.Errorf("访问白名单: %w", err)
 	}
 	denied, err := validateIPLines(settings.DeniedIPs)
 	if err != nil {
-		return "", fmt.Errorf("访问黑名单: %w", err)
+		return "", "", fmt.Errorf("访问黑名单: %w", err)
 	}
 	for _, value := range denied {
 		lines = append(lines, "    deny "+value+";")
@@ -963,7 +1146,7 @@ func renderServerDirectives(settings WebsiteSettings) (string, error) {
 	}
 	if settings.RateLimitKB < 0 || settings.RateLimitKB > 10<<20 ||
 		settings.RateLimitAfterKB < 0 || settings.RateLimitAfterKB > 10<<20 {
-		return "", errors.New("流量限制必须在 0–10485760 KB/s 范围内")
+		return "", "", errors.New("流量限制必须在 0–10485760 KB/s 范围内")
 	}
 	if settings.RateLimitAfterKB > 0 {
 		lines = append(lines, fmt.Sprintf("    limit_rate_after %dk;", settings.RateLimitAfterKB))
@@ -971,6 +1154,20 @@ func renderServerDirectives(settings WebsiteSettings) (string, error) {
 	if settings.RateLimitKB > 0 {
 		lines = append(lines, fmt.Sprintf("    limit_rate %dk;", settings.RateLimitKB))
 	}
+	zones, limits, err := renderRequestLimits(site, settings.RequestLimits)
+	if err != nil {
+		return "", "", err
+	}
+	lines = append(lines, limits...)
+	// The status directives may appear once per server block; the firewall's
+	// per-IP rate shares limit_req_status with the request limits.
+	wafRate := settings.WAF != nil && settings.WAF.Enabled && settings.WAF.RatePerSecond > 0
+	if wafRate || strings.Contains(zones, "limit_req_zone ") {
+		lines = append(lines, "    limit_req_status 429;")
+	}
+	if strings.Contains(zones, "limit_conn_zone ") {
+		lines = append(lines, "    limit_conn_status 429;")
+	}
 	if settings.SecurityHeaders {
 		lines = append(lines,
 			`    add_header X-Content-Type-Options "nosniff" always;`,
@@ -978,10 +1175,10 @@ func renderServerDirectives(settings WebsiteSettings) (string, error) {
 			`    add_header Referrer-Policy "strict-origin-when-cross-origin" always;`,
 		)
 	}
-	return strings.Join(lines, "\n"), nil
+	return strings.Join(lines, "\n"), zones, nil
 }
 
-func renderExtraLocations(rootDir string, settings WebsiteSettings) (string, error) {
+func renderExtraLocations(rootDir string, settings WebsiteSettings, upstreams map[string]string) (string, error) {
 	var blocks []string
 	seen := make(map[string]struct{})
 	for _, binding := range settings.Bindings {
@@ -1040,8 +1237,16 @@ func renderExtraLocations(rootDir string, settings WebsiteSettings) (string, err
 			return "", fmt.Errorf("路径 %s 被重复配置", path)
 		}
 		seen[path] = struct{}{}
-		target, err := validateProxyTarget(proxy.Target)
-		if err != nil {
+		var target string
+		if pool := strings.TrimSpace(proxy.Upstream); pool != "" {
+			if strings.TrimSpace(proxy.Target) != "" {
+				return "", fmt.Errorf("反向代理 %s 不能同时配置目标地址和上游池", path)
+			}
+			var exists bool
+			if target, exists = upstreams[pool]; !exists {
+				return "", fmt.Errorf("上游池 %s 不存在", pool)
+			}
+		} else if target, err = validateProxyTarget(proxy.Target); err != nil {
 			return "", err
 		}
 		host := strings.TrimSpace(proxy.Host)
@@ -0,0 +1,270 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"oneinstack/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SystemUserManager creates the Linux accounts of isolated sites. An isolated
+// tree is owned by the site account and group with setgid directories, and the
+// web server account joins the site group so Nginx can still serve it while
+// the PHP pools of other sites cannot read it. No PHP pool runs as the web
+// server account: shared sites use SharedSiteAccount.
+type SystemUserManager struct {
+	Runner CommandRunner
+}
+
+// websiteSystemUser names the account of a site after its ID, so renaming the
+// domain never renames the account.
+func websiteSystemUser(siteID int64) string {
+	return fmt.Sprintf("site%d", siteID)
+}
+
+func (manager *SystemUserManager) run(ctx context.Context, name string, args ...string) error {
+	if manager == nil || manager.Runner == nil {
+		return errors.New("网站系统用户管理未配置")
+	}
+	if output, err := manager.Runner.Run(ctx, name, args...); err != nil {
+		return fmt.Errorf("%s 执行失败: %s", name, commandMessage(output, err))
+	}
+	return nil
+}
+
+// Create adds the account and group of a site. An existing account with the
+// same name is refused rather than adopted.
+func (manager *SystemUserManager) Create(ctx context.Context, user, home string) error {
+	if manager == nil || manager.Runner == nil {
+		return errors.New("网站系统用户管理未配置")
+	}
+	if _, err := manager.Runner.Run(ctx, "getent", "passwd", user); err == nil {
+		return fmt.Errorf("系统用户 %s 已存在", user)
+	}
+	if err := manager.run(ctx, "useradd", "--system", "--user-group", "--home-dir", home,
+		"--no-create-home", "--shell", "/usr/sbin/nologin", "--comment", "OneinStack website", user); err != nil {
+		return err
+	}
+	if err := manager.run(ctx, "usermod", "--append", "--groups", user, webServerAccount); err != nil {
+		return errors.Join(err, manager.Remove(ctx, user))
+	}
+	return nil
+}
+
+// EnsureSharedAccount adds SharedSiteAccount when it is missing. Its primary
+// group is the web server group and it joins no site group.
+func (manager *SystemUserManager) EnsureSharedAccount(ctx context.Context) error {
+	if manager == nil || manager.Runner == nil {
+		return errors.New("网站系统用户管理未配置")
+	}
+	if _, err := manager.Runner.Run(ctx, "getent", "passwd", SharedSiteAccount); err == nil {
+		return nil
+	}
+	return manager.run(ctx, "useradd", "--system", "--gid", webServerAccount, "--home-dir", "/nonexistent",
+		"--no-create-home", "--shell", "/usr/sbin/nologin", "--comment", "OneinStack shared sites", SharedSiteAccount)
+}
+
+// Remove deletes the account of a site; the user-private group goes with it.
+func (manager *SystemUserManager) Remove(ctx context.Context, user string) error {
+	if manager == nil || manager.Runner == nil {
+		return errors.New("网站系统用户管理未配置")
+	}
+	if _, err := manager.Runner.Run(ctx, "getent", "passwd", user); err != nil {
+		return nil
+	}
+	return manager.run(ctx, "userdel", user)
+}
+
+// Normalize resets ownership and modes below root: directories 2750 and files
+// 0640 for an isolated site, 2775/0664 owned by the web server account for a
+// shared site, whose group lets SharedSiteAccount write. Symlinks are never
+// followed.
+func (manager *SystemUserManager) Normalize(ctx context.Context, root, user string) error {
+	root = filepath.Clean(root)
+	if !filepath.IsAbs(root) || root == string(filepath.Separator) {
+		return errors.New("网站根目录无效")
+	}
+	owner, directoryMode, fileMode := webServerAccount+":"+webServerAccount, "2775", "0664"
+	if user != "" {
+		owner, directoryMode, fileMode = user+":"+user, "2750", "0640"
+	}
+	if err := manager.run(ctx, "chown", "-R", "-P", owner, "--", root); err != nil {
+		return err
+	}
+	if err := manager.run(ctx, "find", root, "-type", "d", "-exec", "chmod", directoryMode, "{}", "+"); err != nil {
+		return err
+	}
+	return manager.run(ctx, "find", root, "-type", "f", "-exec", "chmod", fileMode, "{}", "+")
+}
+
+// WebsiteIsolationDocument reports the isolation state of a site.
+type WebsiteIsolationDocument struct {
+	WebsiteID  int64  `json:"website_id"`
+	SystemUser string `json:"system_user"`
+	RootDir    string `json:"root_dir"`
+}
+
+// SetIsolation moves a site to its own system user or back to the shared web
+// server account, normalising the tree and re-rendering its PHP pool.
+func (service *Service) SetIsolation(ctx context.Context, id int64, isolated bool) (*WebsiteIsolationDocument, error) {
+	if err := service.validate(); err != nil {
+		return nil, err
+	}
+	site, err := service.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	root, err := service.ManagedRoot(site)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		return nil, errors.New("反向代理站点没有网站目录，无需隔离")
+	}
+	if isolated == (site.SystemUser != "") {
+		if err := service.SystemUsers.Normalize(ctx, root, site.SystemUser); err != nil {
+			return nil, err
+		}
+		return &WebsiteIsolationDocument{WebsiteID: site.ID, SystemUser: site.SystemUser, RootDir: root}, nil
+	}
+	settings, _, err := service.loadSettings(id)
+	if err != nil {
+		return nil, err
+	}
+	previousUser := site.SystemUser
+	user := ""
+	if isolated {
+		user = websiteSystemUser(site.ID)
+		if err := service.SystemUsers.Create(ctx, user, root); err != nil {
+			return nil, err
+		}
+	}
+	site.SystemUser = user
+	undo := func(err error) error {
+		site.SystemUser = previousUser
+		err = errors.Join(err, service.SystemUsers.Normalize(context.Background(), root, previousUser))
+		if isolated {
+			err = errors.Join(err, service.SystemUsers.Remove(context.Background(), user))
+		}
+		return err
+	}
+	if err := service.SystemUsers.Normalize(ctx, root, user); err != nil {
+		return nil, undo(err)
+	}
+	phpPool, err := service.applyPHPPool(ctx, site, settings, settings)
+	if err != nil {
+		return nil, undo(err)
+	}
+	if err := service.DB.Model(&models.Website{}).Where("id = ?", site.ID).
+		Update("system_user", user).Error; err != nil {
+		return nil, undo(errors.Join(err, phpPool.Rollback(context.Background())))
+	}
+	if !isolated {
+		if err := service.SystemUsers.Remove(ctx, previousUser); err != nil {
+			return nil, fmt.Errorf("网站已取消隔离，但删除系统用户 %s 失败: %w", previousUser, err)
+		}
+	}
+	return &WebsiteIsolationDocument{WebsiteID: site.ID, SystemUser: user, RootDir: root}, nil
+}
+
+// isolateNewWebsite gives a site created with Isolated its system user.
+func (service *Service) isolateNewWebsite(ctx context.Context, tx *gorm.DB, site *models.Website) (string, error) {
+	if !site.Isolated || site.RootDir == "" {
+		return "", nil
+	}
+	if service.SystemUsers == nil {
+		return "", errors.New("当前环境不支持网站系统用户隔离")
+	}
+	user := websiteSystemUser(site.ID)
+	if err := service.SystemUsers.Create(ctx, user, site.RootDir); err != nil {
+		return "", err
+	}
+	if err := service.SystemUsers.Normalize(ctx, site.RootDir, user); err != nil {
+		return "", errors.Join(err, service.SystemUsers.Remove(context.Background(), user))
+	}
+	if err := tx.Model(&models.Website{}).Where("id = ?", site.ID).Update("system_user", user).Error; err != nil {
+		return "", errors.Join(err, service.SystemUsers.Remove(context.Background(), user))
+	}
+	site.SystemUser = user
+	return user, nil
+}
+
+// AssignedRoots returns the managed roots of the sites assigned to a panel
+// user. ok is false when the user has no assignment and
+// keeps the file scope of its permissions.
+func AssignedRoots(db *gorm.DB, userID int64) ([]string, bool, error) {
+	var sites []models.Website
+	assigned := db.Model(&models.WebsiteAssignment{}).Select("website_id").Where("user_id = ?", userID)
+	err := db.Where("id IN (?)", assigned).Order("id").Find(&sites).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if len(sites) == 0 {
+		return nil, false, nil
+	}
+	roots := make([]string, 0, len(sites))
+	for _, site := range sites {
+		if root := strings.TrimSpace(site.RootDir); root != "" && !strings.EqualFold(site.Type, "proxy") {
+			roots = append(roots, filepath.Clean(root))
+		}
+	}
+	return roots, true, nil
+}
+
+// Assignments lists the panel users bound to a site.
+func (service *Service) Assignments(id int64) ([]int64, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	userIDs := make([]int64, 0)
+	err := service.DB.Model(&models.WebsiteAssignment{}).
+		Where("website_id = ?", id).Order("user_id").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// SetAssignments replaces the panel users bound to a site.
+func (service *Service) SetAssignments(id int64, userIDs []int64) ([]int64, error) {
+	if _, err := service.Get(id); err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]struct{}, len(userIDs))
+	unique := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID <= 0 {
+			return nil, errors.New("用户 ID 必须是正整数")
+		}
+		if _, exists := seen[userID]; !exists {
+			seen[userID] = struct{}{}
+			unique = append(unique, userID)
+		}
+	}
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if len(unique) > 0 {
+			var count int64
+			if err := tx.Model(&models.User{}).Where("id IN ?", unique).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != int64(len(unique)) {
+				return errors.New("指定的面板用户不存在")
+			}
+		}
+		if err := tx.Delete(&models.WebsiteAssignment{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		for _, userID := range unique {
+			if err := tx.Create(&models.WebsiteAssignment{WebsiteID: id, UserID: userID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service.Assignments(id)
+}
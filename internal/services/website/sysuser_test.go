@@ -0,0 +1,216 @@
+package website
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+type fakeSystemUserRunner struct {
+	users map[string]bool
+	calls []string
+}
+
+func (runner *fakeSystemUserRunner) Run(_ context.Context, name string, args ...string) ([]byte, error) {
+	call := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	runner.calls = append(runner.calls, call)
+	switch name {
+	case "getent":
+		if !runner.users[args[len(args)-1]] {
+			return nil, errors.New("exit status 2")
+		}
+	case "useradd":
+		runner.users[args[len(args)-1]] = true
+	case "userdel":
+		delete(runner.users, args[len(args)-1])
+	}
+	return nil, nil
+}
+
+func (runner *fakeSystemUserRunner) called(call string) bool {
+	for _, value := range runner.calls {
+		if value == call {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWebsiteIsolationOwnsTreeScopesPoolAndFiles(t *testing.T) {
+	service := newLifecycleTestService(t)
+	if err := service.DB.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	runner := &fakeSystemUserRunner{users: map[string]bool{"www": true}}
+	service.SystemUsers = &SystemUserManager{Runner: runner}
+
+	site := &models.Website{Domain: "tenant.example.com", Type: "php", Isolated: true, SystemUser: "root"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	if site.SystemUser != "site1" {
+		t.Fatalf("unexpected system user %q", site.SystemUser)
+	}
+	stored, err := service.Get(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SystemUser != "site1" {
+		t.Fatalf("system user was not stored: %#v", stored)
+	}
+	for _, expected := range []string{
+		"useradd --system --user-group --home-dir " + site.RootDir + " --no-create-home --shell /usr/sbin/nologin --comment OneinStack website site1",
+		"usermod --append --groups site1 www",
+		"chown -R -P site1:site1 -- " + site.RootDir,
+		"find " + site.RootDir + " -type d -exec chmod 2750 {} +",
+		"find " + site.RootDir + " -type f -exec chmod 0640 {} +",
+	} {
+		if !runner.called(expected) {
+			t.Fatalf("missing command %q in %#v", expected, runner.calls)
+		}
+	}
+
+	pool, err := renderPHPPool(stored, stored.RootDir, "8.3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(pool, "user = site1\ngroup = site1\n") || !strings.Contains(pool, "listen.owner = www") {
+		t.Fatalf("isolated pool does not run as the site user:\n%s", pool)
+	}
+	if _, err := renderPHPPool(stored, stored.RootDir, "8.3", &WebsitePHPPool{User: "www"}); err == nil {
+		t.Fatal("isolated pool accepted the shared web server user")
+	}
+
+	shared := &models.Website{Domain: "shared.example.com", Type: "static"}
+	if err := service.Add(context.Background(), shared); err != nil {
+		t.Fatal(err)
+	}
+	if shared.SystemUser != "" || runner.users["site2"] {
+		t.Fatalf("shared site was isolated: %#v", shared)
+	}
+	user := models.User{Username: "tenant"}
+	if err := service.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := AssignedRoots(service.DB, user.ID); err != nil || ok {
+		t.Fatalf("unassigned user was scoped: %v %v", ok, err)
+	}
+	if _, err := service.SetAssignments(site.ID, []int64{user.ID, user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.SetAssignments(site.ID, []int64{user.ID + 100}); err == nil {
+		t.Fatal("unknown panel user was assigned")
+	}
+	roots, ok, err := AssignedRoots(service.DB, user.ID)
+	if err != nil || !ok || len(roots) != 1 || roots[0] != site.RootDir {
+		t.Fatalf("unexpected assigned roots: %#v %v %v", roots, ok, err)
+	}
+
+	release, err := service.CreateRelease(context.Background(), site.ID, ReleaseInput{Name: "v1", CopyCurrent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseDirectory := filepath.Join(site.RootDir, websiteReleasesDir, release.Name)
+	if !runner.called("chown -R -P site1:site1 -- " + releaseDirectory) {
+		t.Fatalf("release was not handed to the site user: %#v", runner.calls)
+	}
+
+	document, err := service.SetIsolation(context.Background(), site.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document.SystemUser != "" || runner.users["site1"] ||
+		!runner.called("chown -R -P www:www -- "+site.RootDir) {
+		t.Fatalf("isolation was not removed: %#v %#v", document, runner.calls)
+	}
+	if _, err := service.SetIsolation(context.Background(), site.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	runner.calls = nil
+	if err := service.Delete(context.Background(), site.ID); err != nil {
+		t.Fatal(err)
+	}
+	if runner.users["site1"] || !runner.called("chown -R -P www:www -- "+site.RootDir) {
+		t.Fatalf("deleted site kept its account or files: %#v", runner.calls)
+	}
+	if _, ok, _ := AssignedRoots(service.DB, user.ID); ok {
+		t.Fatal("assignment of deleted site was kept")
+	}
+}
+
+func TestSharedPHPPoolsMoveOffTheWebServerAccount(t *testing.T) {
+	service := newLifecycleTestService(t)
+	runner := &fakeSystemUserRunner{users: map[string]bool{"www": true}}
+	service.SystemUsers = &SystemUserManager{Runner: runner}
+	phpRoot := t.TempDir()
+	for _, directory := range []string{"sbin", filepath.Join("etc", "php-fpm.d")} {
+		if err := os.MkdirAll(filepath.Join(phpRoot, "php83", directory), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(phpRoot, "php83", "sbin", "php-fpm"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	service.PHP = &PHPPoolManager{Root: phpRoot, StateRoot: t.TempDir(), Runner: &fakeNginxRunner{}}
+
+	site := &models.Website{Domain: "shared.example.com", Type: "php"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(site.RootDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	settings := defaultWebsiteSettings()
+	settings.PHPVersion = "8.3"
+	settings.PHPPool = &WebsitePHPPool{User: "www"}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err == nil {
+		t.Fatal("shared pool accepted the web server account")
+	}
+	settings.PHPPool = nil
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"useradd --system --gid www --home-dir /nonexistent --no-create-home --shell /usr/sbin/nologin --comment OneinStack shared sites www-php",
+		"chown -R -P www:www -- " + site.RootDir,
+		"find " + site.RootDir + " -type d -exec chmod 2775 {} +",
+	} {
+		if !runner.called(expected) {
+			t.Fatalf("missing command %q in %#v", expected, runner.calls)
+		}
+	}
+
+	// A pool written before the move still runs as the web server account.
+	poolPath := filepath.Join(phpRoot, "php83", "etc", "php-fpm.d", "oneinstack-site1.conf")
+	if err := os.WriteFile(poolPath, []byte("[site1]\nuser = www\ngroup = www\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DB.Model(&models.WebsiteSetting{}).Where("website_id = ?", site.ID).
+		Update("php_pool_json", `{"user":"www"}`).Error; err != nil {
+		t.Fatal(err)
+	}
+	runner.calls = nil
+	if err := service.moveSharedPHPPools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(poolPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pool), "user = www-php\ngroup = www\n") ||
+		!runner.called("chown -R -P www:www -- "+site.RootDir) {
+		t.Fatalf("legacy pool was not moved: %#v\n%s", runner.calls, pool)
+	}
+	runner.calls = nil
+	if err := service.moveSharedPHPPools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if runner.called("chown -R -P www:www -- " + site.RootDir) {
+		t.Fatalf("moved pool was normalised again: %#v", runner.calls)
+	}
+}
@@ -0,0 +1,288 @@
+package website
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	UpstreamMethodRoundRobin = "round_robin"
+	UpstreamMethodLeastConn  = "least_conn"
+	UpstreamMethodIPHash     = "ip_hash"
+
+	UpstreamHealthCheckHTTP = "http"
+	UpstreamHealthCheckTCP  = "tcp"
+
+	maxWebsiteUpstreams       = 16
+	maxWebsiteUpstreamServers = 32
+)
+
+var upstreamNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// WebsiteUpstreamServer is one backend of an upstream pool. MaxFails and
+// FailTimeout (seconds) configure Nginx passive health checks; zero keeps the
+// Nginx defaults.
+type WebsiteUpstreamServer struct {
+	Address     string `json:"address"`
+	Weight      int    `json:"weight"`
+	MaxFails    int    `json:"max_fails"`
+	FailTimeout int    `json:"fail_timeout"`
+	Backup      bool   `json:"backup"`
+}
+
+// WebsiteUpstream is a named, load-balanced group of backends that proxy
+// sites and proxy rules can target instead of a single address.
+type WebsiteUpstream struct {
+	Name        string                      `json:"name"`
+	Method      string                      `json:"method"`
+	Scheme      string                      `json:"scheme"`
+	Servers     []WebsiteUpstreamServer     `json:"servers"`
+	HealthCheck *WebsiteUpstreamHealthCheck `json:"health_check,omitempty"`
+}
+
+// WebsiteUpstreamHealthCheck enables active probing of every server in a
+// pool. An http check requests Path and expects ExpectedStatus, or any 2xx/3xx
+// status when it is zero; a tcp check only connects. A server is ejected after
+// Fails consecutive failures and returns after Passes consecutive successes.
+type WebsiteUpstreamHealthCheck struct {
+	Type           string `json:"type"`
+	Path           string `json:"path"`
+	ExpectedStatus int    `json:"expected_status"`
+	Timeout        int    `json:"timeout"`
+	Fails          int    `json:"fails"`
+	Passes         int    `json:"passes"`
+}
+
+// upstreamBlockName is unique per site because upstream blocks share the
+// Nginx http context with every other site.
+func upstreamBlockName(site *models.Website, pool string) string {
+	return fmt.Sprintf("oneinstack_site%d_%s", site.ID, pool)
+}
+
+// renderUpstreams validates the pools of a site and renders their upstream
+// blocks. Servers listed in ejected are marked down unless that would leave a
+// pool without a primary server. The returned map resolves a pool name to its
+// proxy_pass target.
+func renderUpstreams(
+	site *models.Website,
+	pools []WebsiteUpstream,
+	ejected map[string]struct{},
+) (string, map[string]string, error) {
+	targets := make(map[string]string, len(pools))
+	if len(pools) == 0 {
+		return "", targets, nil
+	}
+	if len(pools) > maxWebsiteUpstreams {
+		return "", nil, fmt.Errorf("上游池不能超过 %d 个", maxWebsiteUpstreams)
+	}
+	if site == nil || site.ID <= 0 {
+		return "", nil, errors.New("上游池需要在网站创建后配置")
+	}
+	blocks := make([]string, 0, len(pools))
+	for _, pool := range pools {
+		name := strings.TrimSpace(pool.Name)
+		if !upstreamNamePattern.MatchString(name) {
+			return "", nil, fmt.Errorf("上游池名称 %q 无效，只能包含小写字母、数字和下划线", pool.Name)
+		}
+		if _, exists := targets[name]; exists {
+			return "", nil, fmt.Errorf("上游池 %s 被重复配置", name)
+		}
+		scheme := strings.ToLower(strings.TrimSpace(pool.Scheme))
+		if scheme == "" {
+			scheme = "http"
+		}
+		if scheme != "http" && scheme != "https" {
+			return "", nil, fmt.Errorf("上游池 %s 的协议只能是 http 或 https", name)
+		}
+		method := strings.TrimSpace(pool.Method)
+		if method == "" {
+			method = UpstreamMethodRoundRobin
+		}
+		switch method {
+		case UpstreamMethodRoundRobin, UpstreamMethodLeastConn, UpstreamMethodIPHash:
+		default:
+			return "", nil, fmt.Errorf("上游池 %s 的负载均衡方式只能是 round_robin、least_conn 或 ip_hash", name)
+		}
+		if pool.HealthCheck != nil {
+			if _, err := normalizeUpstreamHealthCheck(name, *pool.HealthCheck); err != nil {
+				return "", nil, err
+			}
+		}
+		lines, err := renderUpstreamServers(name, method, pool.Servers, ejected)
+		if err != nil {
+			return "", nil, err
+		}
+		blockName := upstreamBlockName(site, name)
+		var block strings.Builder
+		block.WriteString("upstream " + blockName + " {\n")
+		if method != UpstreamMethodRoundRobin {
+			block.WriteString("    " + method + ";\n")
+		}
+		for _, line := range lines {
+			block.WriteString("    " + line + "\n")
+		}
+		block.WriteString("}")
+		blocks = append(blocks, block.String())
+		targets[name] = scheme + "://" + blockName
+	}
+	return strings.Join(blocks, "\n"), targets, nil
+}
+
+func renderUpstreamServers(
+	pool, method string,
+	servers []WebsiteUpstreamServer,
+	ejected map[string]struct{},
+) ([]string, error) {
+	if len(servers) == 0 || len(servers) > maxWebsiteUpstreamServers {
+		return nil, fmt.Errorf("上游池 %s 必须包含 1–%d 个后端", pool, maxWebsiteUpstreamServers)
+	}
+	lines := make([]string, 0, len(servers))
+	down := make([]bool, 0, len(servers))
+	seen := make(map[string]struct{}, len(servers))
+	primary, available := 0, 0
+	for _, server := range servers {
+		address, err := normalizeUpstreamAddress(server.Address)
+		if err != nil {
+			return nil, fmt.Errorf("上游池 %s: %w", pool, err)
+		}
+		if _, exists := seen[address]; exists {
+			return nil, fmt.Errorf("上游池 %s 的后端 %s 被重复配置", pool, address)
+		}
+		seen[address] = struct{}{}
+		if server.Weight < 0 || server.Weight > 100 {
+			return nil, fmt.Errorf("上游池 %s 的后端权重必须在 1–100 之间", pool)
+		}
+		if server.MaxFails < 0 || server.MaxFails > 100 {
+			return nil, fmt.Errorf("上游池 %s 的 max_fails 必须在 0–100 之间", pool)
+		}
+		if server.FailTimeout < 0 || server.FailTimeout > 3600 {
+			return nil, fmt.Errorf("上游池 %s 的 fail_timeout 必须在 0–3600 秒之间", pool)
+		}
+		if server.Backup && method == UpstreamMethodIPHash {
+			return nil, fmt.Errorf("上游池 %s 使用 ip_hash 时不能配置备用后端", pool)
+		}
+		line := "server " + address
+		if server.Weight > 0 {
+			line += " weight=" + strconv.Itoa(server.Weight)
+		}
+		if server.MaxFails > 0 {
+			line += " max_fails=" + strconv.Itoa(server.MaxFails)
+		}
+		if server.FailTimeout > 0 {
+			line += " fail_timeout=" + strconv.Itoa(server.FailTimeout) + "s"
+		}
+		_, isEjected := ejected[upstreamBackendKey(pool, address)]
+		if server.Backup {
+			line += " backup"
+		} else {
+			primary++
+			if !isEjected {
+				available++
+			}
+		}
+		lines = append(lines, line)
+		down = append(down, isEjected)
+	}
+	if primary == 0 {
+		return nil, fmt.Errorf("上游池 %s 至少需要一个非备用后端", pool)
+	}
+	for index := range lines {
+		if down[index] && available > 0 {
+			lines[index] += " down"
+		}
+		lines[index] += ";"
+	}
+	return lines, nil
+}
+
+// upstreamBackendKey identifies a pool server in the ejected backend list.
+func upstreamBackendKey(pool, address string) string {
+	return pool + "/" + address
+}
+
+func parseEjectedBackends(value string) map[string]struct{} {
+	ejected := make(map[string]struct{})
+	for _, line := range splitSettingLines(value) {
+		ejected[line] = struct{}{}
+	}
+	return ejected
+}
+
+func normalizeUpstreamHealthCheck(pool string, check WebsiteUpstreamHealthCheck) (WebsiteUpstreamHealthCheck, error) {
+	check.Type = strings.ToLower(strings.TrimSpace(check.Type))
+	if check.Type == "" {
+		check.Type = UpstreamHealthCheckHTTP
+	}
+	switch check.Type {
+	case UpstreamHealthCheckHTTP:
+		check.Path = strings.TrimSpace(check.Path)
+		if check.Path == "" {
+			check.Path = "/"
+		}
+		if !strings.HasPrefix(check.Path, "/") || strings.ContainsAny(check.Path, " \t\r\n#") {
+			return check, fmt.Errorf("上游池 %s 的健康检查路径无效", pool)
+		}
+		if check.ExpectedStatus != 0 && (check.ExpectedStatus < 100 || check.ExpectedStatus > 599) {
+			return check, fmt.Errorf("上游池 %s 的健康检查期望状态码无效", pool)
+		}
+	case UpstreamHealthCheckTCP:
+		check.Path = ""
+		check.ExpectedStatus = 0
+	default:
+		return check, fmt.Errorf("上游池 %s 的健康检查类型只能是 http 或 tcp", pool)
+	}
+	if check.Timeout == 0 {
+		check.Timeout = 3
+	}
+	if check.Fails == 0 {
+		check.Fails = 3
+	}
+	if check.Passes == 0 {
+		check.Passes = 2
+	}
+	if check.Timeout < 1 || check.Timeout > 30 {
+		return check, fmt.Errorf("上游池 %s 的健康检查超时必须在 1–30 秒之间", pool)
+	}
+	if check.Fails < 1 || check.Fails > 10 || check.Passes < 1 || check.Passes > 10 {
+		return check, fmt.Errorf("上游池 %s 的健康检查失败和恢复次数必须在 1–10 之间", pool)
+	}
+	return check, nil
+}
+
+// normalizeUpstreamAddress accepts host:port or a unix: socket path.
+func normalizeUpstreamAddress(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "unix:") {
+		path := strings.TrimPrefix(value, "unix:")
+		if !filepath.IsAbs(path) || strings.ContainsAny(path, "\r\n\t ;{}\"'$`") {
+			return "", fmt.Errorf("后端 Unix Socket 路径 %q 无效", value)
+		}
+		return "unix:" + filepath.Clean(path), nil
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", fmt.Errorf("后端地址 %q 必须是 主机:端口", value)
+	}
+	parsedPort, err := strconv.Atoi(port)
+	if err != nil || parsedPort < 1 || parsedPort > 65535 {
+		return "", fmt.Errorf("后端地址 %q 的端口无效", value)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return net.JoinHostPort(ip.String(), port), nil
+	}
+	if strings.EqualFold(host, "localhost") {
+		return net.JoinHostPort("localhost", port), nil
+	}
+	normalized, _, err := normalizeDomainToken(host)
+	if err != nil || strings.HasPrefix(normalized, "*.") {
+		return "", fmt.Errorf("后端地址 %q 的主机名无效", value)
+	}
+	return net.JoinHostPort(normalized, port), nil
+}
@@ -0,0 +1,112 @@
+package website
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+func TestWebsiteUpstreamPoolsRenderIntoPublishedProxyConfig(t *testing.T) {
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "app.example.com", Type: "proxy", Pact: "http", SendUrl: "127.0.0.1:3000"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	settings := WebsiteSettings{
+		DefaultDocuments: "index.html", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		AccessLogEnabled: true, ErrorLogEnabled: true,
+		Upstreams: []WebsiteUpstream{
+			{Name: "node", Method: UpstreamMethodLeastConn, Servers: []WebsiteUpstreamServer{
+				{Address: "127.0.0.1:3000", Weight: 3, MaxFails: 2, FailTimeout: 15},
+				{Address: "127.0.0.1:3001"},
+				{Address: "10.0.0.9:3000", Backup: true},
+			}},
+			{Name: "java", Method: UpstreamMethodIPHash, Scheme: "https", Servers: []WebsiteUpstreamServer{
+				{Address: "localhost:8443"}, {Address: "localhost:8444"},
+			}},
+		},
+		ProxyUpstream: "node",
+		ProxyRules:    []WebsiteProxyRule{{Path: "/api", Upstream: "java", Enabled: true}},
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "app.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := upstreamBlockName(site, "node")
+	java := upstreamBlockName(site, "java")
+	for _, expected := range []string{
+		"upstream " + node + " {\n    least_conn;\n    server 127.0.0.1:3000 weight=3 max_fails=2 fail_timeout=15s;\n" +
+			"    server 127.0.0.1:3001;\n    server 10.0.0.9:3000 backup;\n}",
+		"upstream " + java + " {\n    ip_hash;\n",
+		"proxy_pass http://" + node + ";",
+		"location /api {\n        proxy_pass https://" + java + ";",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("published config missing %q:\n%s", expected, content)
+		}
+	}
+	stored, err := service.GetSettings(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Settings.ProxyUpstream != "node" || len(stored.Settings.Upstreams) != 2 ||
+		len(stored.Settings.Upstreams[0].Servers) != 3 || stored.Settings.ProxyRules[0].Upstream != "java" {
+		t.Fatalf("upstream settings were not stored: %#v", stored.Settings)
+	}
+
+	settings.Upstreams[0].Servers = settings.Upstreams[0].Servers[1:]
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	content, err = os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "app.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "weight=3") || strings.Count(string(content), "upstream "+node) != 1 {
+		t.Fatalf("removed backend is still published:\n%s", content)
+	}
+}
+
+func TestWebsiteUpstreamPoolsRejectInvalidConfiguration(t *testing.T) {
+	site := &models.Website{ID: 4, Type: "proxy"}
+	valid := []WebsiteUpstreamServer{{Address: "127.0.0.1:3000"}}
+	for name, settings := range map[string]WebsiteSettings{
+		"bad name":         {Upstreams: []WebsiteUpstream{{Name: "Bad-Name", Servers: valid}}},
+		"duplicate pool":   {Upstreams: []WebsiteUpstream{{Name: "a", Servers: valid}, {Name: "a", Servers: valid}}},
+		"bad method":       {Upstreams: []WebsiteUpstream{{Name: "a", Method: "random", Servers: valid}}},
+		"no servers":       {Upstreams: []WebsiteUpstream{{Name: "a"}}},
+		"missing port":     {Upstreams: []WebsiteUpstream{{Name: "a", Servers: []WebsiteUpstreamServer{{Address: "127.0.0.1"}}}}},
+		"unsafe host":      {Upstreams: []WebsiteUpstream{{Name: "a", Servers: []WebsiteUpstreamServer{{Address: "evil;host:80"}}}}},
+		"only backup":      {Upstreams: []WebsiteUpstream{{Name: "a", Servers: []WebsiteUpstreamServer{{Address: "127.0.0.1:1", Backup: true}}}}},
+		"ip_hash backup":   {Upstreams: []WebsiteUpstream{{Name: "a", Method: UpstreamMethodIPHash, Servers: append(valid, WebsiteUpstreamServer{Address: "127.0.0.1:2", Backup: true})}}},
+		"unknown pool":     {Upstreams: []WebsiteUpstream{{Name: "a", Servers: valid}}, ProxyUpstream: "b"},
+		"rule target pool": {Upstreams: []WebsiteUpstream{{Name: "a", Servers: valid}}, ProxyRules: []WebsiteProxyRule{{Path: "/x", Upstream: "a", Target: "http://127.0.0.1", Enabled: true}}},
+	} {
+		settings.DefaultDocuments = "index.html"
+		settings.PHPBackend = "unix:/dev/shm/php-cgi.sock"
+		record, err := settings.toModel(site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := renderWebsiteSettings(site, "", record); err == nil {
+			t.Errorf("%s: invalid upstream configuration was accepted", name)
+		}
+	}
+	record, err := (WebsiteSettings{
+		DefaultDocuments: "index.html", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		Upstreams: []WebsiteUpstream{{Name: "a", Servers: valid}}, ProxyUpstream: "a",
+	}).toModel(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renderWebsiteSettings(&models.Website{ID: 4, Type: "static"}, "/data/wwwroot/x", record); err == nil {
+		t.Fatal("static site accepted an upstream pool as its default target")
+	}
+}
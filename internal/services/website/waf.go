@@ -0,0 +1,322 @@
+package website
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"oneinstack/internal/models"
+)
+
+const (
+	WAFRuleBadUserAgent   = "bad_user_agent"
+	WAFRuleExploitPath    = "exploit_path"
+	WAFRuleWordPressProbe = "wordpress_probe"
+	WAFRuleSQLInjection   = "sql_injection"
+	WAFRuleXSS            = "xss"
+	WAFRuleTraversal      = "path_traversal"
+	WAFRuleMethod         = "method"
+	WAFRuleCountry        = "country"
+
+	defaultWAFGeoIPDatabase = "/usr/local/share/GeoIP/GeoLite2-Country.mmdb"
+	maxWAFExcludedPaths     = 32
+	maxWAFBodyKB            = 1 << 20
+	maxWAFRatePerSecond     = 10000
+)
+
+// wafRuleGroup is a managed set of request patterns. Target is the Nginx
+// variable the case-insensitive patterns are matched against.
+type wafRuleGroup struct {
+	ID       string
+	Target   string
+	Patterns []string
+}
+
+// wafRuleGroups lists the managed rule groups. Within one target the first
+// matching pattern names the blocked hit. Patterns are Nginx map regexes and
+// must not contain double quotes or escaped backslashes.
+var wafRuleGroups = []wafRuleGroup{
+	{ID: WAFRuleBadUserAgent, Target: "$http_user_agent", Patterns: []string{
+		`(?:sqlmap|nikto|nmap|masscan|zgrab|wpscan|acunetix|nessus|netsparker|dirbuster|gobuster|feroxbuster|nuclei|havij|w3af|jaeles|fimap|whatweb)`,
+	}},
+	{ID: WAFRuleExploitPath, Target: "$request_uri", Patterns: []string{
+		`/\.(?:env|git|svn|hg|bzr|htaccess|htpasswd|DS_Store|aws|ssh)(?:[/?.]|$)`,
+		`/(?:phpmyadmin|pma|myadmin|adminer(?:-[0-9.]+)?\.php|phpinfo\.php|shell\.php|cgi-bin/|vendor/phpunit/|actuator/|solr/admin|boaform/)`,
+		// Archives and dumps are only blocked when they look like site backups:
+		// named after a backup or dump, or SQL files at the web root. Other
+		// downloads are served normally.
+		`\.(?:bak|backup|old|orig|swp)(?:\?|$)`,
+		`/(?:[^/?]*[_.-])?(?:backups?|bak|dump|database|db|wwwroot|htdocs|www)(?:[_.-][^/?]*)?\.(?:sql|zip|rar|7z|tar|tgz|tar\.gz|sql\.gz)(?:\?|$)`,
+		`^/[^/?]+\.sql(?:\.gz)?(?:\?|$)`,
+	}},
+	// The login page and xmlrpc.php are left alone: WordPress sites use them,
+	// and blocking them would lock administrators and apps out.
+	{ID: WAFRuleWordPressProbe, Target: "$request_uri", Patterns: []string{
+		`/(?:wp-config\.php|wp-admin/(?:install|setup-config)\.php|wp-content/debug\.log)`,
+		`/wp-json/wp/v2/users`,
+		`[?&]author=[0-9]`,
+	}},
+	{ID: WAFRuleSQLInjection, Target: "$request_uri", Patterns: []string{
+		`union(?:\s|\+|%20|%09|/\*.*?\*/)+(?:all(?:\s|\+|%20)+)?select`,
+		`(?:select|concat|extractvalue|updatexml)(?:\s|\+|%20)*(?:\(|%28).*information_schema`,
+		`(?:sleep|benchmark|pg_sleep|waitfor(?:\s|\+|%20)+delay)(?:\s|\+|%20)*(?:\(|%28|%27)`,
+		`(?:%27|')(?:\s|\+|%20)*(?:or|and)(?:\s|\+|%20)+(?:%27|'|[0-9])`,
+		`(?:load_file|into(?:\s|\+|%20)+(?:out|dump)file)`,
+	}},
+	{ID: WAFRuleXSS, Target: "$request_uri", Patterns: []string{
+		`(?:<|%3C)(?:\s|%20)*/?(?:script|iframe|svg|object|embed)`,
+		`(?:javascript|vbscript)(?::|%3A)`,
+		`on(?:error|load|mouseover|focus)(?:\s|%20)*(?:=|%3D)`,
+	}},
+	{ID: WAFRuleTraversal, Target: "$request_uri", Patterns: []string{
+		`(?:\.\./|\.\.%2f|%2e%2e(?:/|%2f))`,
+		`(?:/etc/(?:passwd|shadow)|proc/self/environ|php://(?:input|filter)|data://|expect://)`,
+	}},
+}
+
+var (
+	wafCountryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	wafMethodPattern  = regexp.MustCompile(`^[A-Z]{3,16}$`)
+)
+
+// WebsiteWAF enables the managed request filter. Every rule group is active
+// unless listed in DisabledRules; requests below ExcludedPaths are never
+// filtered. Zero limits leave the Nginx defaults in place.
+type WebsiteWAF struct {
+	Enabled          bool     `json:"enabled"`
+	DisabledRules    []string `json:"disabled_rules"`
+	ExcludedPaths    []string `json:"excluded_paths"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	MaxBodyKB        int64    `json:"max_body_kb"`
+	RatePerSecond    int      `json:"rate_per_second"`
+	RateBurst        int      `json:"rate_burst"`
+	BlockedCountries []string `json:"blocked_countries"`
+	GeoIPDatabase    string   `json:"geoip_database"`
+}
+
+// WAFRuleGroups lists the managed rule group IDs in evaluation order.
+func WAFRuleGroups() []string {
+	groups := make([]string, 0, len(wafRuleGroups)+2)
+	for _, group := range wafRuleGroups {
+		groups = append(groups, group.ID)
+	}
+	return append(groups, WAFRuleMethod, WAFRuleCountry)
+}
+
+type renderedWAF struct {
+	// HTTPBlocks are the maps, GeoIP lookup and rate zone of the http context.
+	HTTPBlocks string
+	// ServerDirectives reject flagged requests in each server block.
+	ServerDirectives string
+	// Variable holds the blocking rule ID, empty for allowed requests.
+	Variable string
+}
+
+// renderWAF chains one Nginx map per stage. Each map defaults to the result
+// of the previous stage, so the final variable names a matching rule, or is
+// empty when nothing matched or the path is excluded.
+func renderWAF(site *models.Website, waf *WebsiteWAF) (renderedWAF, error) {
+	if waf == nil || !waf.Enabled {
+		return renderedWAF{}, nil
+	}
+	if site == nil || site.ID <= 0 {
+		return renderedWAF{}, errors.New("网站防火墙需要已保存的网站")
+	}
+	prefix := fmt.Sprintf("$oneinstack_site%d_waf", site.ID)
+	disabled := make(map[string]struct{}, len(waf.DisabledRules))
+	known := make(map[string]struct{})
+	for _, id := range WAFRuleGroups() {
+		known[id] = struct{}{}
+	}
+	for _, id := range waf.DisabledRules {
+		id = strings.TrimSpace(id)
+		if _, ok := known[id]; !ok {
+			return renderedWAF{}, fmt.Errorf("防火墙规则组 %q 不存在", id)
+		}
+		disabled[id] = struct{}{}
+	}
+	excluded, err := wafExcludedPathPattern(waf.ExcludedPaths)
+	if err != nil {
+		return renderedWAF{}, err
+	}
+
+	var blocks []string
+	previous := `""`
+	stage := 0
+	addMap := func(source string, entries []string) {
+		stage++
+		variable := fmt.Sprintf("%s_%d", prefix, stage)
+		blocks = append(blocks, fmt.Sprintf("map %s %s {\n    default %s;\n%s\n}",
+			source, variable, previous, strings.Join(entries, "\n")))
+		previous = variable
+	}
+
+	if _, off := disabled[WAFRuleMethod]; !off && len(waf.AllowedMethods) > 0 {
+		entries := []string{fmt.Sprintf("    default %q;", WAFRuleMethod)}
+		seen := make(map[string]struct{})
+		for _, method := range waf.AllowedMethods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if !wafMethodPattern.MatchString(method) {
+				return renderedWAF{}, fmt.Errorf("请求方法 %q 无效", method)
+			}
+			if _, ok := seen[method]; ok {
+				continue
+			}
+			seen[method] = struct{}{}
+			entries = append(entries, fmt.Sprintf("    %s %s;", method, previous))
+		}
+		// The allow-list map inverts the chain: listed methods pass the
+		// previous result on and everything else is blocked.
+		stage++
+		variable := fmt.Sprintf("%s_%d", prefix, stage)
+		blocks = append(blocks, fmt.Sprintf("map $request_method %s {\n%s\n}", variable, strings.Join(entries, "\n")))
+		previous = variable
+	}
+	byTarget := make(map[string][]string)
+	targets := make([]string, 0)
+	for _, group := range wafRuleGroups {
+		if _, off := disabled[group.ID]; off {
+			continue
+		}
+		if _, ok := byTarget[group.Target]; !ok {
+			targets = append(targets, group.Target)
+		}
+		for _, pattern := range group.Patterns {
+			byTarget[group.Target] = append(byTarget[group.Target], fmt.Sprintf("    \"~*%s\" %q;", pattern, group.ID))
+		}
+	}
+	for _, target := range targets {
+		addMap(target, byTarget[target])
+	}
+
+	if _, off := disabled[WAFRuleCountry]; !off && len(waf.BlockedCountries) > 0 {
+		database := strings.TrimSpace(waf.GeoIPDatabase)
+		if database == "" {
+			database = defaultWAFGeoIPDatabase
+		}
+		if !filepath.IsAbs(database) || strings.ContainsAny(database, " \t\r\n;{}\"'$`") {
+			return renderedWAF{}, errors.New("GeoIP 数据库路径必须是不含特殊字符的绝对路径")
+		}
+		countryVariable := prefix + "_country"
+		blocks = append(blocks, fmt.Sprintf("geoip2 %s {\n    %s country iso_code;\n}", database, countryVariable))
+		entries := make([]string, 0, len(waf.BlockedCountries))
+		seen := make(map[string]struct{})
+		for _, country := range waf.BlockedCountries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if !wafCountryPattern.MatchString(country) {
+				return renderedWAF{}, fmt.Errorf("国家代码 %q 无效，应为两位 ISO 3166 代码", country)
+			}
+			if _, ok := seen[country]; ok {
+				continue
+			}
+			seen[country] = struct{}{}
+			entries = append(entries, fmt.Sprintf("    %s %q;", country, WAFRuleCountry))
+		}
+		sort.Strings(entries)
+		addMap(countryVariable, entries)
+	}
+
+	final := prefix
+	exclusion := ""
+	if excluded != "" {
+		exclusion = fmt.Sprintf("\n    \"~%s\" \"\";", excluded)
+	}
+	blocks = append(blocks, fmt.Sprintf("map $uri %s {\n    default %s;%s\n}", final, previous, exclusion))
+
+	var server []string
+	if waf.MaxBodyKB < 0 || waf.MaxBodyKB > maxWAFBodyKB {
+		return renderedWAF{}, fmt.Errorf("请求体大小限制必须在 0–%d KB 之间", maxWAFBodyKB)
+	}
+	if waf.MaxBodyKB > 0 {
+		server = append(server, fmt.Sprintf("    client_max_body_size %dk;", waf.MaxBodyKB))
+	}
+	if waf.RatePerSecond < 0 || waf.RatePerSecond > maxWAFRatePerSecond ||
+		waf.RateBurst < 0 || waf.RateBurst > maxWAFRatePerSecond {
+		return renderedWAF{}, fmt.Errorf("单 IP 请求速率和突发值必须在 0–%d 之间", maxWAFRatePerSecond)
+	}
+	if waf.RatePerSecond > 0 {
+		zone := fmt.Sprintf("oneinstack_site%d_waf", site.ID)
+		rateKey := prefix + "_rate_key"
+		exclusion := ""
+		if excluded != "" {
+			exclusion = fmt.Sprintf("\n    \"~%s\" \"\";", excluded)
+		}
+		blocks = append(blocks,
+			fmt.Sprintf("map $uri %s {\n    default $binary_remote_addr;%s\n}", rateKey, exclusion),
+			fmt.Sprintf("limit_req_zone %s zone=%s:10m rate=%dr/s;", rateKey, zone, waf.RatePerSecond),
+		)
+		server = append(server,
+			fmt.Sprintf("    limit_req zone=%s burst=%d nodelay;", zone, waf.RateBurst),
+		)
+	}
+	server = append(server, fmt.Sprintf("    if (%s) {\n        return 403;\n    }", final))
+	return renderedWAF{
+		HTTPBlocks:       strings.Join(blocks, "\n"),
+		ServerDirectives: strings.Join(server, "\n"),
+		Variable:         final,
+	}, nil
+}
+
+// wafExcludedPathPattern joins the excluded path prefixes into one anchored,
+// quoted-literal regex.
+func wafExcludedPathPattern(paths []string) (string, error) {
+	if len(paths) > maxWAFExcludedPaths {
+		return "", fmt.Errorf("防火墙排除路径不能超过 %d 个", maxWAFExcludedPaths)
+	}
+	alternatives := make([]string, 0, len(paths))
+	for _, value := range paths {
+		path, err := validateLocationPath(value)
+		if err != nil {
+			return "", fmt.Errorf("防火墙排除路径: %w", err)
+		}
+		alternatives = append(alternatives, regexp.QuoteMeta(path))
+	}
+	if len(alternatives) == 0 {
+		return "", nil
+	}
+	return "^(?:" + strings.Join(alternatives, "|") + ")", nil
+}
+
+// WAFHit is one request blocked by the firewall, read from the site's WAF log.
+type WAFHit struct {
+	Time      string `json:"time"`
+	ClientIP  string `json:"client_ip"`
+	Rule      string `json:"rule"`
+	Method    string `json:"method"`
+	URI       string `json:"uri"`
+	UserAgent string `json:"user_agent"`
+}
+
+type WAFHitLog struct {
+	Hits   []WAFHit       `json:"hits"`
+	ByRule map[string]int `json:"by_rule"`
+}
+
+// ListWAFHits returns the most recent blocked requests, newest first, with a
+// per-rule count over the returned window.
+func (service *Service) ListWAFHits(id int64, limit int) (*WAFHitLog, error) {
+	document, err := service.ReadLog(id, "waf", limit)
+	if err != nil {
+		return nil, err
+	}
+	result := &WAFHitLog{Hits: make([]WAFHit, 0), ByRule: make(map[string]int)}
+	if document.Content == "" {
+		return result, nil
+	}
+	lines := strings.Split(document.Content, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		fields := strings.SplitN(lines[i], "\t", 6)
+		if len(fields) != 6 || fields[2] == "" {
+			continue
+		}
+		result.Hits = append(result.Hits, WAFHit{
+			Time: fields[0], ClientIP: fields[1], Rule: fields[2],
+			Method: fields[3], URI: fields[4], UserAgent: fields[5],
+		})
+		result.ByRule[fields[2]]++
+	}
+	return result, nil
+}
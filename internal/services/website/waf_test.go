@@ -0,0 +1,156 @@
+package website
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"oneinstack/internal/models"
+)
+
+func TestWebsiteWAFRendersRuleChainLimitsAndHitLog(t *testing.T) {
+	service := newLifecycleTestService(t)
+	site := &models.Website{Domain: "waf.example.com", Type: "php"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	settings := WebsiteSettings{
+		DefaultDocuments: "index.php", PHPBackend: "unix:/dev/shm/php-cgi.sock",
+		ErrorLogEnabled: true,
+		WAF: &WebsiteWAF{
+			Enabled: true, DisabledRules: []string{WAFRuleWordPressProbe},
+			ExcludedPaths: []string{"/api/upload"}, AllowedMethods: []string{"get", "POST", "HEAD"},
+			MaxBodyKB: 2048, RatePerSecond: 20, RateBurst: 40, BlockedCountries: []string{"xx", "YY"},
+		},
+	}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(service.Publisher.ConfigDir, "waf.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := string(content)
+	for _, expected := range []string{
+		"map $request_method $oneinstack_site1_waf_1 {\n    default \"method\";\n    GET \"\";",
+		"map $http_user_agent $oneinstack_site1_waf_2 {\n    default $oneinstack_site1_waf_1;",
+		"map $request_uri $oneinstack_site1_waf_3 {\n    default $oneinstack_site1_waf_2;",
+		"geoip2 " + defaultWAFGeoIPDatabase + " {\n    $oneinstack_site1_waf_country country iso_code;\n}",
+		"    XX \"country\";\n    YY \"country\";",
+		"map $uri $oneinstack_site1_waf {\n    default $oneinstack_site1_waf_4;\n    \"~^(?:/api/upload)\" \"\";\n}",
+		"limit_req_zone $oneinstack_site1_waf_rate_key zone=oneinstack_site1_waf:10m rate=20r/s;",
+		"    limit_req zone=oneinstack_site1_waf burst=40 nodelay;",
+		"    client_max_body_size 2048k;",
+		"    if ($oneinstack_site1_waf) {\n        return 403;\n    }",
+		"access_log " + service.LogRoot + "/waf_example_com_waf.log oneinstack_waf_waf_example_com if=$oneinstack_site1_waf;",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Fatalf("WAF config is missing %q:\n%s", expected, config)
+		}
+	}
+	if strings.Contains(config, "wp-config") || strings.Contains(config, "access_log off;") {
+		t.Fatalf("disabled rule group or access_log off was rendered:\n%s", config)
+	}
+
+	settings.WAF.DisabledRules = []string{"unknown"}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err == nil {
+		t.Fatal("unknown rule group was accepted")
+	}
+	settings.WAF.DisabledRules = nil
+	settings.WAF.ExcludedPaths = []string{"/a;b"}
+	if _, err := service.UpdateSettings(context.Background(), site.ID, settings); err == nil {
+		t.Fatal("unsafe excluded path was accepted")
+	}
+
+	if err := os.MkdirAll(service.LogRoot, 0750); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(service.LogRoot, "waf_example_com_waf.log")
+	hits := "2026-10-01T10:00:00+08:00\t10.0.0.1\tsql_injection\tGET\t/?id=1%27%20or%201=1\tcurl/8\n" +
+		"2026-10-01T10:00:01+08:00\t10.0.0.2\tbad_user_agent\tGET\t/\tsqlmap/1.7\n"
+	if err := os.WriteFile(logPath, []byte(hits), 0640); err != nil {
+		t.Fatal(err)
+	}
+	log, err := service.ListWAFHits(site.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Hits) != 2 || log.Hits[0].Rule != WAFRuleBadUserAgent || log.ByRule[WAFRuleSQLInjection] != 1 {
+		t.Fatalf("unexpected WAF hits: %#v", log)
+	}
+}
+
+func TestWAFRuleGroupsMatchCommonAttacksOnly(t *testing.T) {
+	compiled := make(map[string][]*regexp.Regexp)
+	for _, group := range wafRuleGroups {
+		for _, pattern := range group.Patterns {
+			if strings.ContainsAny(pattern, "\"") || strings.Contains(pattern, `\\`) {
+				t.Fatalf("pattern %q cannot be quoted in an Nginx map", pattern)
+			}
+			compiled[group.ID] = append(compiled[group.ID], regexp.MustCompile("(?i)"+pattern))
+		}
+	}
+	matches := func(group, value string) bool {
+		for _, pattern := range compiled[group] {
+			if pattern.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	}
+	attacks := map[string][]string{
+		WAFRuleBadUserAgent:   {"sqlmap/1.7#stable", "Mozilla/5.0 (compatible; Nuclei)"},
+		WAFRuleExploitPath:    {"/.env", "/.git/config", "/vendor/phpunit/phpunit/src/Util/PHP/eval-stdin.php", "/backup.sql"},
+		WAFRuleWordPressProbe: {"/wp-config.php", "/wp-admin/install.php", "/wp-json/wp/v2/users", "/?author=1"},
+		WAFRuleSQLInjection:   {"/item?id=1%20UNION%20SELECT%201,2", "/?q=1%27%20or%20%271%27=%271", "/?id=sleep(5)"},
+		WAFRuleXSS:            {"/?q=%3Cscript%3Ealert(1)", "/?u=javascript:alert(1)"},
+		WAFRuleTraversal:      {"/download?file=../../etc/passwd", "/?f=%2e%2e%2fconfig"},
+	}
+	attacks[WAFRuleExploitPath] = append(attacks[WAFRuleExploitPath],
+		"/wwwroot.zip", "/files/site-backup-2026.tar.gz", "/mysql_dump.sql.gz", "/shop.sql", "/index.php.bak")
+	for group, values := range attacks {
+		for _, value := range values {
+			if !matches(group, value) {
+				t.Errorf("%s did not match %q", group, value)
+			}
+		}
+	}
+	for _, benign := range []string{
+		"/", "/blog/union-station", "/search?q=select+a+plan", "/images/logo.png", "/css/app.css?v=3",
+		"/downloads/release-2.1.zip", "/files/dataset.tar.gz", "/docs/schema/tables.sql", "/feedback.zip",
+		"/wp-login.php", "/wp-login.php?action=lostpassword", "/xmlrpc.php", "/wp-admin/",
+	} {
+		for group := range compiled {
+			if matches(group, benign) {
+				t.Errorf("%s matched benign request %q", group, benign)
+			}
+		}
+	}
+}
+
+func TestDefaultWAFDoesNotBlockWordPressLogin(t *testing.T) {
+	rendered, err := renderWAF(&models.Website{ID: 1}, &WebsiteWAF{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := regexp.MustCompile(`"~\*(.+)" "([a-z_]+)";`)
+	blocked := func(uri string) string {
+		for _, match := range entry.FindAllStringSubmatch(rendered.HTTPBlocks, -1) {
+			if regexp.MustCompile("(?i)" + match[1]).MatchString(uri) {
+				return match[2]
+			}
+		}
+		return ""
+	}
+	for _, uri := range []string{"/wp-login.php", "/wp-login.php?redirect_to=%2Fwp-admin%2F", "/xmlrpc.php"} {
+		if rule := blocked(uri); rule != "" {
+			t.Errorf("default WAF blocks %s with %s", uri, rule)
+		}
+	}
+	if rule := blocked("/wp-config.php"); rule != WAFRuleWordPressProbe {
+		t.Fatalf("default WAF does not render the WordPress probe rules:\n%s", rendered.HTTPBlocks)
+	}
+}
@@ -31,6 +31,8 @@ type Service struct {
 	Publisher       *Publisher
 	ConfigManager   *WebServerConfigManager
 	Firewall        *safeservice.Service
+	PHP             *PHPPoolManager
+	SystemUsers     *SystemUserManager
 }
 
 func defaultService() (*Service, error) {
@@ -54,6 +56,12 @@ func defaultService() (*Service, error) {
 		},
 		ConfigManager: newWebServerConfigManager(server),
 		Firewall:      safeservice.NewDefaultService(),
+		PHP: &PHPPoolManager{
+			Root:      defaultPHPInstallRoot,
+			StateRoot: defaultPHPStateRoot,
+			Runner:    OSCommandRunner{},
+		},
+		SystemUsers: &SystemUserManager{Runner: OSCommandRunner{}},
 	}, nil
 }
 
@@ -276,6 +284,8 @@ func (service *Service) add(ctx context.Context, param *models.Website, allowMan
 	}
 	param.Enabled = true
 	param.DisabledReason = ""
+	// The account is only ever assigned by isolation below.
+	param.SystemUser = ""
 	if err := normalizeWebsiteExpiration(param, time.Now()); err != nil {
 		return err
 	}
@@ -313,6 +323,7 @@ func (service *Service) add(ctx context.Context, param *models.Website, allowMan
 		}
 	}
 	var publication *Publication
+	systemUser := ""
 	transactionErr := service.DB.Transaction(func(tx *gorm.DB) error {
 		var existing int64
 		if err := tx.Model(&models.Website{}).
@@ -326,6 +337,11 @@ func (service *Service) add(ctx context.Context, param *models.Website, allowMan
 		if err := tx.Create(&prepared.model).Error; err != nil {
 			return err
 		}
+		user, err := service.isolateNewWebsite(ctx, tx, &prepared.model)
+		if err != nil {
+			return err
+		}
+		systemUser = user
 		content := prepared.config
 		published, err := service.Publisher.Publish(ctx, map[string]*string{
 			prepared.configName: &content,
@@ -346,6 +362,9 @@ func (service *Service) add(ctx context.Context, param *models.Website, allowMan
 				service.Firewall.Delete(context.Background(), firewallRuleID),
 			)
 		}
+		if systemUser != "" {
+			transactionErr = errors.Join(transactionErr, service.SystemUsers.Remove(context.Background(), systemUser))
+		}
 		cleanupWebsiteAddFiles(prepared.model.RootDir, defaultPagePath, createdRoot, createdDefaultPage)
 		return transactionErr
 	}
@@ -375,7 +394,7 @@ func (service *Service) Update(ctx context.Context, param *models.Website) error
 	if err := service.DB.First(&existing, "id = ?", param.ID).Error; err != nil {
 		return err
 	}
-	_, settings, err := service.loadSettings(existing.ID)
+	currentSettings, settings, err := service.loadSettings(existing.ID)
 	if err != nil {
 		return err
 	}
@@ -409,6 +428,7 @@ func (service *Service) Update(ctx context.Context, param *models.Website) error
 	prepared.model.CreateTime = existing.CreateTime
 	prepared.model.Enabled = existing.Enabled
 	prepared.model.DisabledReason = existing.DisabledReason
+	prepared.model.SystemUser = existing.SystemUser
 	if err := normalizeWebsiteExpiration(&prepared.model, time.Now()); err != nil {
 		return err
 	}
@@ -432,6 +452,7 @@ func (service *Service) Update(ctx context.Context, param *models.Website) error
 		prepared.model.CreateTime = existing.CreateTime
 		prepared.model.Enabled = existing.Enabled
 		prepared.model.DisabledReason = existing.DisabledReason
+		prepared.model.SystemUser = existing.SystemUser
 		if err := normalizeWebsiteExpiration(&prepared.model, time.Now()); err != nil {
 			return err
 		}
@@ -447,6 +468,14 @@ func (service *Service) Update(ctx context.Context, param *models.Website) error
 		}
 		return errors.New("stored website has an unsafe Nginx config name")
 	}
+	// The pool's open_basedir follows the site root.
+	phpPool, err := service.applyPHPPool(ctx, &prepared.model, currentSettings, currentSettings)
+	if err != nil {
+		if createdRoot {
+			_ = os.Remove(prepared.model.RootDir)
+		}
+		return err
+	}
 
 	var publication *Publication
 	transactionErr := service.DB.Transaction(func(tx *gorm.DB) error {
@@ -486,12 +515,16 @@ func (service *Service) Update(ctx context.Context, param *models.Website) error
 		if publication != nil {
 			transactionErr = errors.Join(transactionErr, publication.Rollback(context.Background()))
 		}
+		transactionErr = errors.Join(transactionErr, phpPool.Rollback(context.Background()))
 		if createdRoot {
 			_ = os.Remove(prepared.model.RootDir)
 		}
 		return transactionErr
 	}
 	*param = prepared.model
+	if prepared.model.SystemUser != "" && prepared.model.RootDir != existing.RootDir {
+		return service.SystemUsers.Normalize(ctx, prepared.model.RootDir, prepared.model.SystemUser)
+	}
 	return nil
 }
 
@@ -530,6 +563,10 @@ func (service *Service) DeleteWithOptions(ctx context.Context, id int64, deleteF
 	if err != nil {
 		return err
 	}
+	siteSettings, _, err := service.loadSettings(id)
+	if err != nil {
+		return err
+	}
 	var activeTasks int64
 	if err := service.DB.Model(&models.CertificateTask{}).
 		Where("website_id = ? AND status IN ?", id, models.ActiveCertificateTaskStatuses()).
@@ -626,6 +663,27 @@ func (service *Service) DeleteWithOptions(ctx context.Context, id int64, deleteF
 		if err := tx.Delete(&models.WebsiteTrafficCursor{}, "website_id = ?", id).Error; err != nil {
 			return err
 		}
+		if err := tx.Delete(&models.WebsiteTrafficHourly{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteTrafficTop{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteBackendHealth{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteRelease{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteDeploySource{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteAssignment{}, "website_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebsiteStaging{}, "website_id = ? OR live_website_id = ?", id, id).Error; err != nil {
+			return err
+		}
 		published, err := service.Publisher.Publish(ctx, map[string]*string{
 			configName: nil,
 		})
@@ -646,7 +704,23 @@ func (service *Service) DeleteWithOptions(ctx context.Context, id int64, deleteF
 			return fmt.Errorf("remove staged website data: %w", err)
 		}
 	}
-	return nil
+	if err := service.removePHPPool(ctx, id, siteSettings.PHPVersion); err != nil {
+		return err
+	}
+	if err := os.Remove(basicAuthFile(service.WebRoot, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if existing.SystemUser == "" {
+		return nil
+	}
+	// Retained files go back to the web server account before the owning
+	// account disappears.
+	if !deleteFiles && rootPath != "" {
+		if err := service.SystemUsers.Normalize(ctx, rootPath, ""); err != nil {
+			return err
+		}
+	}
+	return service.SystemUsers.Remove(ctx, existing.SystemUser)
 }
 
 func validateManagedPath(baseValue, targetValue string) (string, error) {
@@ -782,6 +856,9 @@ func (service *Service) activeTLSOptions(websiteID int64, normalizedDomains stri
 	return options, nil
 }
 
+// certificateCoversDomains reports whether every website domain is listed on
+// the certificate or matched by one of its wildcard names. A wildcard only
+// covers a single label, so *.example.com does not cover example.com.
 func certificateCoversDomains(certificateDomains, websiteDomains string) bool {
 	available := make(map[string]struct{})
 	for _, domain := range strings.Split(certificateDomains, ",") {
@@ -789,7 +866,14 @@ func certificateCoversDomains(certificateDomains, websiteDomains string) bool {
 	}
 	for _, domain := range strings.Split(websiteDomains, ",") {
 		domain = strings.ToLower(strings.TrimSpace(domain))
-		if _, exists := available[domain]; !exists {
+		if _, exists := available[domain]; exists {
+			continue
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found || strings.HasPrefix(domain, "*.") {
+			return false
+		}
+		if _, exists := available["*."+parent]; !exists {
 			return false
 		}
 	}
@@ -162,6 +162,10 @@ func TestPrepareWebsiteRendersACMEChallengeTLSAndRedirect(t *testing.T) {
 			t.Fatalf("TLS config is missing %q:\n%s", expected, site.config)
 		}
 	}
+	// Sites without upstream pools render no empty upstream block.
+	if header := site.config[:strings.Index(site.config, "server {")]; strings.HasSuffix(header, "\n\n") {
+		t.Fatalf("config has a blank line before the server block:\n%s", site.config)
+	}
 }
 
 func TestPublisherRestoresOldConfigWhenNginxTestFails(t *testing.T) {
@@ -506,6 +510,13 @@ func openWebsiteTestDB(t *testing.T) *gorm.DB {
 		&models.WebsiteSetting{},
 		&models.WebsiteTrafficDaily{},
 		&models.WebsiteTrafficCursor{},
+		&models.WebsiteTrafficHourly{},
+		&models.WebsiteTrafficTop{},
+		&models.WebsiteBackendHealth{},
+		&models.WebsiteRelease{},
+		&models.WebsiteDeploySource{},
+		&models.WebsiteAssignment{},
+		&models.WebsiteStaging{},
 		&models.Certificate{},
 		&models.CertificateTask{},
 		&models.CertificateOperationLock{},
@@ -514,3 +525,21 @@ func openWebsiteTestDB(t *testing.T) *gorm.DB {
 	}
 	return db
 }
+
+func TestCertificateCoversDomainsMatchesSingleLabelWildcards(t *testing.T) {
+	certificateDomains := "*.example.com,example.com"
+	cases := map[string]bool{
+		"example.com,www.example.com": true,
+		"shop.example.com":            true,
+		"*.example.com":               true,
+		"deep.shop.example.com":       false,
+		"example.org":                 false,
+		"*.shop.example.com":          false,
+		"shop.example.com,other.net":  false,
+	}
+	for websiteDomains, want := range cases {
+		if got := certificateCoversDomains(certificateDomains, websiteDomains); got != want {
+			t.Fatalf("certificateCoversDomains(%q) = %v, want %v", websiteDomains, got, want)
+		}
+	}
+}
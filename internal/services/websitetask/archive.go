@@ -333,6 +333,45 @@ type extractedArchive struct {
 	DatabasePath string
 }
 
+// readArchiveManifest reads only the manifest entry of a website archive.
+func readArchiveManifest(source string) (*archiveManifest, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.New("website backup is not a valid gzip archive")
+	}
+	defer gzipReader.Close()
+	reader := tar.NewReader(gzipReader)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("website backup manifest is missing")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.ToSlash(filepath.Clean(header.Name)) != archiveManifestName {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg || header.Size < 0 || header.Size > maxManifestBytes {
+			return nil, errors.New("website backup manifest is invalid")
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, maxManifestBytes+1))
+		if err != nil || int64(len(data)) != header.Size {
+			return nil, errors.New("website backup manifest is truncated")
+		}
+		var manifest archiveManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, errors.New("website backup manifest cannot be decoded")
+		}
+		return &manifest, nil
+	}
+}
+
 func extractArchive(
 	ctx context.Context,
 	source, stagingRoot string,
@@ -0,0 +1,415 @@
+package websitetask
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/internal/services/website"
+	"oneinstack/utils"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+const (
+	maxDeployKeySize      = 64 * 1024
+	maxDeployBuildCommand = 16 * 1024
+	deployBuildTimeout    = 30 * time.Minute
+	// deployBuildUser runs the builds of shared sites. It is the account of
+	// their PHP pools, not the web server account, which can read the trees
+	// of isolated sites.
+	deployBuildUser = website.SharedSiteAccount
+)
+
+var (
+	// ErrDeployWebhookUnauthorized is returned for push webhooks whose
+	// signature does not match the source's secret.
+	ErrDeployWebhookUnauthorized = errors.New("deploy webhook signature is invalid")
+
+	deployBranchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,254}$`)
+	scpLikeRepoPattern  = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^-].*$`)
+)
+
+type DeploySourceInput struct {
+	RepoURL       string `json:"repoUrl"`
+	Branch        string `json:"branch"`
+	DeployKey     string `json:"deployKey"`
+	ClearKey      bool   `json:"clearKey"`
+	BuildCommands string `json:"buildCommands"`
+	RotateSecret  bool   `json:"rotateSecret"`
+}
+
+// DeploySourceResult carries the webhook secret only when it was generated by
+// the request; it cannot be read back afterwards.
+type DeploySourceResult struct {
+	*models.WebsiteDeploySource
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+}
+
+func (m *Manager) GetDeploySource(websiteID int64) (*models.WebsiteDeploySource, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	var source models.WebsiteDeploySource
+	if err := m.db.First(&source, "website_id = ?", websiteID).Error; err != nil {
+		return nil, err
+	}
+	source.DeployKeyConfigured = source.DeployKeyEncrypted != ""
+	return &source, nil
+}
+
+// SaveDeploySource creates or replaces the Git source of a website. An empty
+// deploy key keeps the stored key unless ClearKey is set.
+func (m *Manager) SaveDeploySource(
+	websiteID int64,
+	input DeploySourceInput,
+	userID int64,
+) (*DeploySourceResult, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	if userID <= 0 {
+		return nil, errors.New("authenticated user is required")
+	}
+	if _, err := m.sites.Get(websiteID); err != nil {
+		return nil, err
+	}
+	repoURL, err := normalizeDeployRepoURL(input.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	branch := strings.TrimSpace(input.Branch)
+	if branch == "" {
+		branch = "main"
+	}
+	if !validDeployBranch(branch) {
+		return nil, errors.New("分支名称无效")
+	}
+	commands := strings.TrimSpace(strings.ReplaceAll(input.BuildCommands, "\r\n", "\n"))
+	if len(commands) > maxDeployBuildCommand {
+		return nil, fmt.Errorf("构建命令不能超过 %d 字节", maxDeployBuildCommand)
+	}
+
+	source := models.WebsiteDeploySource{WebsiteID: websiteID}
+	err = m.db.First(&source, "website_id = ?", websiteID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	source.RepoURL = repoURL
+	source.Branch = branch
+	source.BuildCommands = commands
+	source.ConfiguredBy = userID
+	if key := strings.TrimSpace(input.DeployKey); key != "" {
+		if len(key) > maxDeployKeySize {
+			return nil, fmt.Errorf("部署私钥不能超过 %d 字节", maxDeployKeySize)
+		}
+		if _, err := ssh.ParsePrivateKey([]byte(key)); err != nil {
+			return nil, errors.New("部署私钥格式无效或不支持带口令私钥")
+		}
+		encrypted, err := utils.EncryptCredential(key+"\n", utils.CredentialPurposeWebsiteDeployKey)
+		if err != nil {
+			return nil, err
+		}
+		source.DeployKeyEncrypted = encrypted
+	} else if input.ClearKey {
+		source.DeployKeyEncrypted = ""
+	}
+	result := &DeploySourceResult{WebsiteDeploySource: &source}
+	if source.WebhookSecretEncrypted == "" || input.RotateSecret {
+		secret := make([]byte, 24)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		result.WebhookSecret = hex.EncodeToString(secret)
+		encrypted, err := utils.EncryptCredential(result.WebhookSecret, utils.CredentialPurposeWebsiteWebhook)
+		if err != nil {
+			return nil, err
+		}
+		source.WebhookSecretEncrypted = encrypted
+	}
+	if err := m.db.Save(&source).Error; err != nil {
+		return nil, err
+	}
+	source.DeployKeyConfigured = source.DeployKeyEncrypted != ""
+	return result, nil
+}
+
+func (m *Manager) DeleteDeploySource(websiteID int64) error {
+	if err := m.Start(); err != nil {
+		return err
+	}
+	result := m.db.Delete(&models.WebsiteDeploySource{}, "website_id = ?", websiteID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m *Manager) SubmitDeploy(websiteID, requestedBy int64) (*models.WebsiteTask, error) {
+	return m.submit(Request{
+		Operation: models.WebsiteTaskOperationDeploy,
+		WebsiteID: websiteID,
+	}, requestedBy)
+}
+
+// HandleDeployWebhook verifies a push webhook and queues a deployment on
+// behalf of the user who configured the source. Pushes to other branches are
+// acknowledged without a task. GitHub (X-Hub-Signature-256: sha256=<hex>) and
+// Gitea/Gogs (bare hex) signatures are accepted.
+func (m *Manager) HandleDeployWebhook(websiteID int64, signature string, body []byte) (*models.WebsiteTask, error) {
+	source, err := m.GetDeploySource(websiteID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.DecryptCredential(source.WebhookSecretEncrypted, utils.CredentialPurposeWebsiteWebhook)
+	if err != nil || secret == "" {
+		return nil, ErrDeployWebhookUnauthorized
+	}
+	provided, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return nil, ErrDeployWebhookUnauthorized
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return nil, ErrDeployWebhookUnauthorized
+	}
+	var payload struct {
+		Ref string `json:"ref"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("decode push payload: %w", err)
+	}
+	if payload.Ref != "refs/heads/"+source.Branch {
+		return nil, nil
+	}
+	return m.SubmitDeploy(websiteID, source.ConfiguredBy)
+}
+
+// runDeploy clones the configured branch, runs the build commands and
+// publishes the result as a new website release.
+func (m *Manager) runDeploy(
+	ctx context.Context,
+	task *models.WebsiteTask,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	source, err := m.GetDeploySource(task.WebsiteID)
+	if err != nil {
+		return fmt.Errorf("load deploy source: %w", err)
+	}
+	workRoot := filepath.Join(m.backupRoot, ".work")
+	if err := os.MkdirAll(workRoot, 0700); err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp(workRoot, "deploy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	// The checkout lives outside the root-only work directory so the build
+	// user can reach it; the deploy key never leaves workDir.
+	buildDir, err := os.MkdirTemp("", "oneinstack-deploy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(buildDir)
+	baseEnv := []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME=" + buildDir,
+		"LANG=C.UTF-8",
+	}
+	env := append(append([]string{}, baseEnv...),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL=http:https:ssh:file",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	if source.DeployKeyEncrypted != "" {
+		key, err := utils.DecryptCredential(source.DeployKeyEncrypted, utils.CredentialPurposeWebsiteDeployKey)
+		if err != nil {
+			return fmt.Errorf("decrypt deploy key: %w", err)
+		}
+		keyPath := filepath.Join(workDir, "deploy_key")
+		if err := os.WriteFile(keyPath, []byte(key), 0600); err != nil {
+			return err
+		}
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+keyPath+
+			" -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new"+
+			" -o UserKnownHostsFile="+filepath.Join(m.backupRoot, ".deploy_known_hosts"))
+	}
+
+	checkout := filepath.Join(buildDir, "src")
+	report(5, "正在拉取 Git 仓库 "+source.Branch+" 分支")
+	_, _ = fmt.Fprintf(log, "[%s] cloning %s (%s)\n", time.Now().UTC().Format(time.RFC3339), source.RepoURL, source.Branch)
+	if err := runDeployCommand(ctx, log, env, workDir, "git", "clone", "--depth", "1", "--single-branch",
+		"--branch", source.Branch, "--", source.RepoURL, checkout); err != nil {
+		return fmt.Errorf("clone repository: %w", err)
+	}
+	output, err := gitOutput(ctx, env, checkout, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("resolve deployed commit: %w", err)
+	}
+	commit := strings.TrimSpace(output)
+	_, _ = fmt.Fprintf(log, "[%s] checked out %s\n", time.Now().UTC().Format(time.RFC3339), commit)
+	if err := os.RemoveAll(filepath.Join(checkout, ".git")); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if source.BuildCommands != "" {
+		report(35, "正在执行构建命令")
+		buildCtx, cancel := context.WithTimeout(ctx, deployBuildTimeout)
+		defer cancel()
+		command := exec.CommandContext(buildCtx, "sh", "-e", "-c", source.BuildCommands)
+		command.Dir = checkout
+		command.Env = append(baseEnv, "ONEINSTACK_DEPLOY_COMMIT="+commit)
+		command.Stdout = log
+		command.Stderr = log
+		site, err := m.sites.Get(task.WebsiteID)
+		if err != nil {
+			return fmt.Errorf("load website: %w", err)
+		}
+		if site.SystemUser == "" && m.buildUser == website.SharedSiteAccount && m.sites.SystemUsers != nil {
+			if err := m.sites.SystemUsers.EnsureSharedAccount(ctx); err != nil {
+				return fmt.Errorf("prepare build user: %w", err)
+			}
+		}
+		runAs, err := configureBuildUser(command, buildDir, m.buildAccount(site))
+		if err != nil {
+			return fmt.Errorf("prepare build user: %w", err)
+		}
+		isolateBuildProcesses(command)
+		_, _ = fmt.Fprintf(log, "[%s] running build commands as %s\n", time.Now().UTC().Format(time.RFC3339), runAs)
+		err = command.Run()
+		stopBuildProcesses(command)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("build commands failed: %w", err)
+		}
+	}
+
+	report(70, "正在创建发布版本")
+	short := commit
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	release, err := m.sites.CreateRelease(ctx, task.WebsiteID, website.ReleaseInput{
+		// Redeploying the same commit still needs a distinct release name.
+		Name:   short + "-" + strings.SplitN(task.ID, "-", 2)[0],
+		Note:   "Git " + source.Branch + "@" + short,
+		Source: checkout,
+	})
+	if err != nil {
+		return fmt.Errorf("create release: %w", err)
+	}
+	report(85, "正在切换到新版本 "+release.Name)
+	if _, err := m.sites.ActivateRelease(ctx, task.WebsiteID, release.ID); err != nil {
+		return fmt.Errorf("activate release: %w", err)
+	}
+	now := time.Now().UTC()
+	if err := m.db.Model(&models.WebsiteDeploySource{}).Where("website_id = ?", task.WebsiteID).
+		Updates(map[string]any{"last_commit": commit, "last_deployed_at": now}).Error; err != nil {
+		return err
+	}
+	report(99, "Git 部署完成，当前版本 "+release.Name)
+	return nil
+}
+
+// buildAccount is the account build commands run as. Isolated sites build as
+// their own account, which cannot read the trees of other sites; shared sites
+// build as the shared site account.
+func (m *Manager) buildAccount(site *models.Website) string {
+	if site.SystemUser != "" {
+		return site.SystemUser
+	}
+	return m.buildUser
+}
+
+func runDeployCommand(ctx context.Context, log io.Writer, env []string, dir, name string, args ...string) error {
+	command := exec.CommandContext(ctx, name, args...)
+	command.Dir = dir
+	command.Env = env
+	command.Stdout = log
+	command.Stderr = log
+	if err := command.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+func gitOutput(ctx context.Context, env []string, dir string, args ...string) (string, error) {
+	command := exec.CommandContext(ctx, "git", args...)
+	command.Dir = dir
+	command.Env = env
+	output, err := command.Output()
+	return string(output), err
+}
+
+// normalizeDeployRepoURL accepts http(s), ssh and scp-like repository
+// locations. Git transport helpers such as ext:: are refused because they run
+// arbitrary commands, and local paths and file:// URLs because the clone runs
+// as root and could read any repository on the host.
+func normalizeDeployRepoURL(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
+		return "", errors.New("仓库地址不能为空")
+	case len(value) > 1024:
+		return "", errors.New("仓库地址不能超过 1024 个字符")
+	case strings.HasPrefix(value, "-") || strings.ContainsAny(value, " \t\r\n"):
+		return "", errors.New("仓库地址无效")
+	case filepath.IsAbs(value):
+		return "", errors.New("不支持本机路径作为仓库地址")
+	case scpLikeRepoPattern.MatchString(value):
+		return value, nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", errors.New("仓库地址无效")
+	}
+	switch parsed.Scheme {
+	case "http", "https", "ssh":
+		if parsed.Host == "" {
+			return "", errors.New("仓库地址无效")
+		}
+		return value, nil
+	default:
+		return "", errors.New("仓库地址只支持 http、https、ssh 协议或 user@host:path 格式")
+	}
+}
+
+func validDeployBranch(branch string) bool {
+	if !deployBranchPattern.MatchString(branch) || strings.Contains(branch, "..") ||
+		strings.Contains(branch, "//") || strings.HasSuffix(branch, "/") ||
+		strings.HasSuffix(branch, ".lock") || strings.HasSuffix(branch, ".") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package websitetask
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/website"
+	"oneinstack/utils"
+)
+
+func TestGitDeployFromLocalRepositoryAndSignedWebhook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	utils.ConfigureCredentialKey(bytes.Repeat([]byte{0x42}, 32))
+	root := t.TempDir()
+	git := func(dir string, args ...string) {
+		t.Helper()
+		command := exec.Command("git", args...)
+		command.Dir = dir
+		command.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if output, err := command.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	bare := filepath.Join(root, "site.git")
+	work := filepath.Join(root, "work")
+	git(root, "init", "--bare", "--initial-branch=main", bare)
+	git(root, "clone", bare, work)
+	if err := os.WriteFile(filepath.Join(work, "index.html"), []byte("from git"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(work, "add", "index.html")
+	git(work, "commit", "-m", "initial")
+	git(work, "push", "origin", "HEAD:main")
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Local repositories are refused, so the test repository is served over
+	// smart HTTP, which also supports the shallow clone a deploy makes.
+	gitServer := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(gitServer.Close)
+	repoURL := gitServer.URL + "/site.git"
+
+	db := openWebsiteTaskTestDB(t)
+	webRoot := filepath.Join(root, "www")
+	for _, directory := range []string{
+		webRoot, filepath.Join(root, "logs"), filepath.Join(root, "nginx"),
+		filepath.Join(root, "challenge"), filepath.Join(root, "certificates"),
+	} {
+		if err := os.MkdirAll(directory, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := &website.Service{
+		DB: db, WebRoot: webRoot, LogRoot: filepath.Join(root, "logs"),
+		ChallengeRoot:   filepath.Join(root, "challenge"),
+		CertificateRoot: filepath.Join(root, "certificates"),
+		Publisher: &website.Publisher{
+			ConfigDir:   filepath.Join(root, "nginx"),
+			NginxBinary: "nginx", Runner: fakeCommandRunner{},
+		},
+	}
+	site := &models.Website{Domain: "git.example.com", Type: "static", RootDir: "/git"}
+	if err := service.Add(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(
+		db, filepath.Join(root, "backups"), filepath.Join(root, "tasklogs"),
+		service, &fakeDatabaseOperator{}, 64<<20, 1000, 0,
+	)
+	if os.Geteuid() == 0 {
+		// Build commands never run as root; the test host has no www account.
+		manager.buildUser = "nobody"
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+
+	if _, err := manager.SubmitDeploy(site.ID, 1); err == nil {
+		t.Fatal("deploy was accepted without a source")
+	}
+	for _, local := range []string{"ext::sh -c id", "file://" + bare, bare} {
+		if _, err := manager.SaveDeploySource(site.ID, DeploySourceInput{RepoURL: local, Branch: "main"}, 1); err == nil {
+			t.Fatalf("repository %s was accepted", local)
+		}
+	}
+	if _, err := manager.SaveDeploySource(site.ID, DeploySourceInput{
+		RepoURL: repoURL, Branch: "main", DeployKey: "not a key",
+	}, 1); err == nil {
+		t.Fatal("invalid deploy key was accepted")
+	}
+	result, err := manager.SaveDeploySource(site.ID, DeploySourceInput{
+		RepoURL: repoURL, Branch: "main",
+		BuildCommands: "echo \"$ONEINSTACK_DEPLOY_COMMIT\" > build.txt",
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.WebhookSecret == "" || result.WebhookSecretEncrypted == result.WebhookSecret {
+		t.Fatalf("webhook secret was not generated and encrypted: %#v", result)
+	}
+
+	task, err := manager.SubmitDeploy(site.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task = waitForWebsiteTask(t, manager, task.ID)
+	if task.Status != models.WebsiteTaskStatusSucceeded {
+		logContent, _ := os.ReadFile(task.LogPath)
+		t.Fatalf("deploy task failed: %#v\n%s", task, logContent)
+	}
+	current := filepath.Join(webRoot, "git", "current")
+	if content, err := os.ReadFile(filepath.Join(current, "index.html")); err != nil || string(content) != "from git" {
+		t.Fatalf("deployed content is missing: %q %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(current, ".git")); !os.IsNotExist(err) {
+		t.Fatalf("repository metadata was published: %v", err)
+	}
+	source, err := manager.GetDeploySource(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build, err := os.ReadFile(filepath.Join(current, "build.txt"))
+	if err != nil || len(source.LastCommit) != 40 || string(build) != source.LastCommit+"\n" {
+		t.Fatalf("build output does not match the deployed commit: %q %q %v", build, source.LastCommit, err)
+	}
+
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	sign := func(payload []byte) string {
+		mac := hmac.New(sha256.New, []byte(result.WebhookSecret))
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	if _, err := manager.HandleDeployWebhook(site.ID, "sha256=00", body); !errors.Is(err, ErrDeployWebhookUnauthorized) {
+		t.Fatalf("forged webhook was not rejected: %v", err)
+	}
+	other := []byte(`{"ref":"refs/heads/feature"}`)
+	if task, err := manager.HandleDeployWebhook(site.ID, sign(other), other); err != nil || task != nil {
+		t.Fatalf("push to another branch queued a deploy: %#v %v", task, err)
+	}
+	task, err = manager.HandleDeployWebhook(site.ID, sign(body), body)
+	if err != nil || task == nil {
+		t.Fatalf("signed webhook did not queue a deploy: %v", err)
+	}
+	if task = waitForWebsiteTask(t, manager, task.ID); task.Status != models.WebsiteTaskStatusSucceeded {
+		t.Fatalf("webhook deploy failed: %#v", task)
+	}
+	releases, err := service.ListReleases(site.ID)
+	if err != nil || len(releases) != 2 || !releases[0].Active {
+		t.Fatalf("deploys did not create releases: %#v %v", releases, err)
+	}
+}
+
+func TestDeployBuildsRunAsTheIsolatedSiteAccount(t *testing.T) {
+	manager := &Manager{buildUser: deployBuildUser}
+	if got := manager.buildAccount(&models.Website{ID: 7, SystemUser: "site7"}); got != "site7" {
+		t.Fatalf("isolated site builds as %q", got)
+	}
+	if got := manager.buildAccount(&models.Website{ID: 8}); got != deployBuildUser {
+		t.Fatalf("shared site builds as %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package websitetask
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// configureBuildUser runs build commands as the given account when the panel
+// runs as root, handing it the build directory first. Repository commands
+// never run as root: a missing account fails the build. Without root the
+// commands keep the panel's own identity.
+func configureBuildUser(command *exec.Cmd, buildDir, username string) (string, error) {
+	current := strconv.Itoa(os.Geteuid())
+	if os.Geteuid() != 0 {
+		return current, nil
+	}
+	account, err := user.Lookup(username)
+	if err != nil {
+		var unknown user.UnknownUserError
+		if errors.As(err, &unknown) {
+			return "", fmt.Errorf("build account %q does not exist", username)
+		}
+		return "", err
+	}
+	if account.Uid == "0" {
+		return "", fmt.Errorf("build account %q is root", username)
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return "", err
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return "", err
+	}
+	err = filepath.WalkDir(buildDir, func(path string, _ fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		return os.Lchown(path, int(uid), int(gid))
+	})
+	if err != nil {
+		return "", err
+	}
+	command.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+	}
+	return account.Username, nil
+}
+
+// isolateBuildProcesses starts build commands in their own process group so
+// a cancelled build takes its children with it.
+func isolateBuildProcesses(command *exec.Cmd) {
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Setpgid = true
+	command.Cancel = func() error {
+		if command.Process == nil {
+			return os.ErrProcessDone
+		}
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	command.WaitDelay = 10 * time.Second
+}
+
+// stopBuildProcesses kills whatever the build left running in its process
+// group, so nothing owned by the build account can still change the tree
+// while it is copied into a release.
+func stopBuildProcesses(command *exec.Cmd) {
+	if command.Process != nil {
+		_ = syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+}
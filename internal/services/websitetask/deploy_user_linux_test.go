@@ -0,0 +1,55 @@
+//go:build linux
+
+package websitetask
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigureBuildUserNeverFallsBackToRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("build users are only switched when the panel runs as root")
+	}
+	for _, username := range []string{"oneinstack-missing-build-user", "root"} {
+		command := exec.Command("true")
+		if runAs, err := configureBuildUser(command, t.TempDir(), username); err == nil {
+			t.Fatalf("build for %s would run as %s", username, runAs)
+		}
+		if command.SysProcAttr != nil {
+			t.Fatalf("command for %s was prepared despite the error", username)
+		}
+	}
+}
+
+func TestStopBuildProcessesKillsWhatTheBuildLeftRunning(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	command := exec.CommandContext(context.Background(), "sh", "-c", "sleep 30 >/dev/null 2>&1 & echo $! > "+pidFile)
+	isolateBuildProcesses(command)
+	if err := command.Run(); err != nil {
+		t.Fatal(err)
+	}
+	stopBuildProcesses(command)
+	content, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := filepath.Join("/proc", strings.TrimSpace(string(content)), "stat")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// The orphan may linger as a zombie until it is reaped.
+		value, err := os.ReadFile(stat)
+		if err != nil || strings.Contains(string(value), ") Z ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background build process is still running: %s", value)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package websitetask
+
+import (
+	"os/exec"
+	"os/user"
+)
+
+// Non-Linux builds run build commands as the panel user; production panels
+// are Linux and switch to the build account there.
+func configureBuildUser(_ *exec.Cmd, _, _ string) (string, error) {
+	account, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return account.Username, nil
+}
+
+func isolateBuildProcesses(*exec.Cmd) {}
+
+func stopBuildProcesses(*exec.Cmd) {}
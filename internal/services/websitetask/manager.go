@@ -55,6 +55,16 @@ type Request struct {
 	DatabaseID  int64
 	DeleteFiles bool
 	ConfirmName string
+
+	StagingWebsiteID    int64
+	StagingDomain       string
+	StagingDatabaseID   int64
+	StagingDatabaseName string
+	RewriteDatabase     bool
+	PushDatabase        bool
+	AuthUsername        string
+	AuthPassword        string
+	StagingAuth         string
 }
 
 type queuedTask struct {
@@ -68,8 +78,11 @@ type Manager struct {
 	logRoot          string
 	sites            *website.Service
 	databases        DatabaseOperator
+	staging          StagingDatabaseOperator
 	limits           archiveLimits
 	minimumFreeBytes int64
+	buildUser        string
+	removeTree       func(string) error
 	queue            chan queuedTask
 	stopCh           chan struct{}
 
@@ -92,11 +105,14 @@ func NewManager(
 	maxFiles int,
 	minimumFreeBytes int64,
 ) *Manager {
+	staging, _ := databases.(StagingDatabaseOperator)
 	return &Manager{
 		db: db, backupRoot: filepath.Clean(backupRoot), logRoot: filepath.Clean(logRoot),
-		sites: sites, databases: databases,
+		sites: sites, databases: databases, staging: staging,
 		limits:           archiveLimits{MaxBytes: maxBytes, MaxFiles: maxFiles},
 		minimumFreeBytes: minimumFreeBytes,
+		buildUser:        deployBuildUser,
+		removeTree:       os.RemoveAll,
 		queue:            make(chan queuedTask, defaultQueueSize), stopCh: make(chan struct{}),
 		cancels: make(map[string]context.CancelFunc),
 	}
@@ -152,6 +168,14 @@ func (m *Manager) Start() error {
 	return m.startErr
 }
 
+// QueueDepth reports how many accepted tasks are waiting for a worker.
+func (m *Manager) QueueDepth() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.queue)
+}
+
 func invalidRoot(path string) bool {
 	return path == "" || path == "." || path == string(filepath.Separator) || !filepath.IsAbs(path)
 }
@@ -207,6 +231,21 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.WebsiteTas
 		if err == nil && request.ConfirmName != site.Name {
 			err = errors.New("网站确认名称不匹配")
 		}
+	case models.WebsiteTaskOperationDeploy:
+		site, err = m.sites.Get(request.WebsiteID)
+		if err == nil {
+			_, err = m.GetDeploySource(request.WebsiteID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = errors.New("网站尚未配置 Git 部署源")
+			}
+		}
+	case models.WebsiteTaskOperationClone:
+		site, err = m.sites.Get(request.WebsiteID)
+		if err == nil {
+			err = m.prepareClone(&request, site)
+		}
+	case models.WebsiteTaskOperationPush:
+		site, err = m.preparePush(&request)
 	case models.WebsiteTaskOperationRestore:
 		if request.BackupID == "" {
 			return nil, errors.New("website backup is required")
@@ -248,6 +287,17 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.WebsiteTas
 	if active > 0 {
 		return nil, fmt.Errorf("website %s already has an active task", websiteName)
 	}
+	if request.StagingWebsiteID > 0 {
+		if err := m.db.Model(&models.WebsiteTask{}).
+			Where("(website_id = ? OR staging_website_id = ?) AND status IN ?",
+				request.StagingWebsiteID, request.StagingWebsiteID, models.ActiveWebsiteTaskStatuses()).
+			Count(&active).Error; err != nil {
+			return nil, err
+		}
+		if active > 0 {
+			return nil, errors.New("staging website already has an active task")
+		}
+	}
 	if request.DatabaseID > 0 {
 		if err := m.db.Model(&models.DatabaseTask{}).
 			Where("library_id = ? AND status IN ?", request.DatabaseID, models.ActiveDatabaseTaskStatuses()).
@@ -265,6 +315,9 @@ func (m *Manager) submit(request Request, requestedBy int64) (*models.WebsiteTas
 		WebsiteID: request.WebsiteID, WebsiteName: websiteName,
 		DatabaseID: request.DatabaseID, DatabaseName: databaseName,
 		SourceBackupID: request.BackupID, DeleteFiles: request.DeleteFiles,
+		StagingWebsiteID: request.StagingWebsiteID, StagingDomain: request.StagingDomain,
+		StagingDatabaseID: request.StagingDatabaseID, StagingDatabaseName: request.StagingDatabaseName,
+		RewriteDatabase: request.RewriteDatabase, StagingAuthJSON: request.StagingAuth,
 		Status: models.WebsiteTaskStatusQueued, Progress: 0,
 		Message: "网站任务已进入队列", RequestedBy: requestedBy,
 		LogPath:   filepath.Join(m.logRoot, "task_"+taskID+".log"),
@@ -378,6 +431,12 @@ func (m *Manager) run(item queuedTask) {
 		err = m.runDelete(ctx, &task, logFile, report)
 	case models.WebsiteTaskOperationRestore:
 		err = m.runRestore(ctx, &task, logFile, report)
+	case models.WebsiteTaskOperationDeploy:
+		err = m.runDeploy(ctx, &task, logFile, report)
+	case models.WebsiteTaskOperationClone:
+		err = m.runClone(ctx, &task, logFile, report)
+	case models.WebsiteTaskOperationPush:
+		err = m.runPush(ctx, &task, logFile, report)
 	}
 	if err != nil {
 		status := models.WebsiteTaskStatusFailed
@@ -639,7 +698,7 @@ func (m *Manager) replaceWebsiteFiles(
 		if !hadPrevious {
 			return nil
 		}
-		return os.RemoveAll(previous)
+		return m.removeTree(previous)
 	}
 	return rollback, commit, nil
 }
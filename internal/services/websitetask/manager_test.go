@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -33,6 +34,8 @@ type fakeDatabaseOperator struct {
 	backupValue []byte
 	restored    []byte
 	block       chan struct{}
+	copies      []fakeDatabaseCopy
+	copyErr     error
 }
 
 func (operator *fakeDatabaseOperator) Backup(
@@ -173,6 +176,20 @@ func TestWebsiteBackupRestoreDeleteLifecycle(t *testing.T) {
 	if backup.DatabaseName != "site_db" || backup.SHA256 == "" || backup.SizeBytes == 0 {
 		t.Fatalf("unexpected website backup: %#v", backup)
 	}
+	imported, err := manager.ImportBackup(site.ID, backup.FilePath, *backup, models.WebsiteBackupSourceRemote, 1)
+	if err != nil || imported.SHA256 != backup.SHA256 || imported.WebsiteName != site.Name {
+		t.Fatalf("backup of the site was not imported: %#v %v", imported, err)
+	}
+	other := &models.Website{Domain: "other.example.com", Type: "static"}
+	if err := siteService.Add(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.ImportBackup(other.ID, backup.FilePath, *backup, models.WebsiteBackupSourceRemote, 1); err == nil {
+		t.Fatal("backup of another website was imported")
+	}
+	if entries, err := os.ReadDir(filepath.Join(root, "backups", strconv.FormatInt(other.ID, 10))); err == nil && len(entries) > 0 {
+		t.Fatalf("refused import left files behind: %v", entries)
+	}
 
 	if err := os.WriteFile(indexPath, []byte("version-two"), 0640); err != nil {
 		t.Fatal(err)
@@ -545,7 +562,14 @@ func waitForWebsiteTask(t *testing.T, manager *Manager, taskID string) *models.W
 		if err != nil {
 			t.Fatal(err)
 		}
-		if models.IsWebsiteTaskTerminal(task.Status) {
+		// The worker releases the operation lock after the final status, so a
+		// chained task waits for the lock as well.
+		var locks int64
+		if err := manager.db.Model(&models.WebsiteOperationLock{}).
+			Where("task_id = ?", taskID).Count(&locks).Error; err != nil {
+			t.Fatal(err)
+		}
+		if models.IsWebsiteTaskTerminal(task.Status) && locks == 0 {
 			return task
 		}
 		time.Sleep(10 * time.Millisecond)
@@ -584,6 +608,10 @@ func openWebsiteTaskTestDB(t *testing.T) *gorm.DB {
 		&models.WebsiteSetting{},
 		&models.WebsiteTrafficDaily{},
 		&models.WebsiteTrafficCursor{},
+		&models.WebsiteTrafficHourly{},
+		&models.WebsiteTrafficTop{},
+		&models.WebsiteBackendHealth{},
+		&models.WebsiteRelease{},
 		&models.Storage{},
 		&models.Library{},
 		&models.DatabaseTask{},
@@ -595,6 +623,9 @@ func openWebsiteTaskTestDB(t *testing.T) *gorm.DB {
 		&models.WebsiteTask{},
 		&models.WebsiteBackup{},
 		&models.WebsiteOperationLock{},
+		&models.WebsiteDeploySource{},
+		&models.WebsiteAssignment{},
+		&models.WebsiteStaging{},
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -7,9 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"oneinstack/internal/models"
+	"oneinstack/utils"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -195,6 +198,62 @@ func (m *Manager) OpenBackup(
 	return file, info, backup, nil
 }
 
+// ImportBackup copies a website archive obtained elsewhere, such as an
+// off-site copy, into the backup store of a website and registers it with the
+// given source. The copy must match original.SHA256 and its manifest must
+// name the target website.
+func (m *Manager) ImportBackup(
+	websiteID int64,
+	path string,
+	original models.WebsiteBackup,
+	source string,
+	requestedBy int64,
+) (*models.WebsiteBackup, error) {
+	var site models.Website
+	if err := m.db.Select("id", "name").First(&site, websiteID).Error; err != nil {
+		return nil, err
+	}
+	backupID := uuid.NewString()
+	destination, err := m.artifactPath(websiteID, backupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CopyVerifiedFile(path, destination, original.SHA256); err != nil {
+		return nil, fmt.Errorf("import website backup: %w", err)
+	}
+	// A restore checks the archive against the backup record; an archive of
+	// another site is refused here instead of failing that restore later.
+	manifest, err := readArchiveManifest(destination)
+	if err == nil && (manifest.Website.ID != site.ID || manifest.Website.Name != site.Name) {
+		err = fmt.Errorf("website archive belongs to website %d (%s), not %s", manifest.Website.ID, manifest.Website.Name, site.Name)
+	}
+	if err != nil {
+		_ = os.Remove(destination)
+		return nil, err
+	}
+	size, checksum, err := verifyRegularFile(destination)
+	if err != nil {
+		_ = os.Remove(destination)
+		return nil, err
+	}
+	fileName := original.FileName
+	if !strings.HasSuffix(fileName, ".tar.gz") {
+		fileName = site.Name + "_" + time.Now().UTC().Format("20060102_150405") + ".tar.gz"
+	}
+	backup := &models.WebsiteBackup{
+		ID: backupID, WebsiteID: site.ID, WebsiteName: site.Name,
+		DatabaseID: original.DatabaseID, DatabaseName: original.DatabaseName,
+		Source: source, FileName: fileName,
+		FilePath: destination, SizeBytes: size, SHA256: checksum,
+		CreatedBy: requestedBy, CreatedAt: time.Now().UTC(),
+	}
+	if err := m.db.Create(backup).Error; err != nil {
+		_ = os.Remove(destination)
+		return nil, err
+	}
+	return backup, nil
+}
+
 func (m *Manager) DeleteBackup(backupID string) error {
 	backup, err := m.GetBackup(strings.TrimSpace(backupID))
 	if err != nil {
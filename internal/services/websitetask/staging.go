@@ -0,0 +1,636 @@
+package websitetask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/internal/services/website"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStagingAuthUser  = "staging"
+	defaultStagingAuthRealm = "Staging"
+	maxDatabaseConfigBytes  = 1 << 20
+)
+
+var stagingDatabasePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// stagingDatabaseConfigs are the application files in a site root that name
+// its library. A clone points them at the staging library and a push keeps
+// the live copies, so neither site ends up writing the other's database.
+var stagingDatabaseConfigs = []struct {
+	Name     string
+	Database *regexp.Regexp
+}{
+	{"wp-config.php", regexp.MustCompile(`(define\(\s*['"]DB_NAME['"]\s*,\s*['"])[^'"]*(['"])`)},
+	{".env", regexp.MustCompile(`(?m)^(DB_DATABASE[ \t]*=[ \t]*["']?)[^"'\r\n]*(["']?)`)},
+}
+
+// StagingDatabaseOperator copies a MySQL library into another one, rewriting
+// domains in string values. It is optional: without it staging covers files
+// and configuration only.
+type StagingDatabaseOperator interface {
+	CreateLibraryLike(ctx context.Context, sourceID int64, name string) (int64, error)
+	DropLibrary(ctx context.Context, libraryID int64) error
+	Copy(
+		ctx context.Context,
+		sourceID, targetID int64,
+		replacements []string,
+		log io.Writer,
+		report databasetask.ProgressReporter,
+	) error
+}
+
+// CloneInput describes the staging copy of a live site. DatabaseID selects the
+// live library to duplicate into a new library named DatabaseName.
+type CloneInput struct {
+	Domain          string `json:"domain"`
+	DatabaseID      int64  `json:"databaseId"`
+	DatabaseName    string `json:"databaseName"`
+	RewriteDatabase bool   `json:"rewriteDatabase"`
+	AuthUsername    string `json:"authUsername"`
+	AuthPassword    string `json:"authPassword"`
+}
+
+// PushInput publishes a staging site over its live site. Database copies the
+// staging library over the live one.
+type PushInput struct {
+	ConfirmName     string `json:"confirmName"`
+	Database        bool   `json:"database"`
+	RewriteDatabase bool   `json:"rewriteDatabase"`
+}
+
+func (m *Manager) SubmitClone(websiteID int64, input CloneInput, requestedBy int64) (*models.WebsiteTask, error) {
+	return m.submit(Request{
+		Operation: models.WebsiteTaskOperationClone,
+		WebsiteID: websiteID, DatabaseID: input.DatabaseID,
+		StagingDomain:       strings.ToLower(strings.TrimSpace(input.Domain)),
+		StagingDatabaseName: strings.TrimSpace(input.DatabaseName),
+		RewriteDatabase:     input.RewriteDatabase,
+		AuthUsername:        strings.TrimSpace(input.AuthUsername),
+		AuthPassword:        input.AuthPassword,
+	}, requestedBy)
+}
+
+func (m *Manager) SubmitPush(stagingID int64, input PushInput, requestedBy int64) (*models.WebsiteTask, error) {
+	return m.submit(Request{
+		Operation:        models.WebsiteTaskOperationPush,
+		StagingWebsiteID: stagingID, PushDatabase: input.Database,
+		RewriteDatabase: input.RewriteDatabase,
+		ConfirmName:     strings.TrimSpace(input.ConfirmName),
+	}, requestedBy)
+}
+
+// GetStaging returns the live-site link of a staging site.
+func (m *Manager) GetStaging(stagingID int64) (*models.WebsiteStaging, error) {
+	if err := m.Start(); err != nil {
+		return nil, err
+	}
+	var staging models.WebsiteStaging
+	if err := m.db.First(&staging, "website_id = ?", stagingID).Error; err != nil {
+		return nil, err
+	}
+	return &staging, nil
+}
+
+// prepareClone validates a clone request and fills the persisted staging
+// fields of the task; the basic-auth password is hashed before it is stored.
+func (m *Manager) prepareClone(request *Request, site *models.Website) error {
+	domain := request.StagingDomain
+	if domain == "" {
+		return errors.New("请填写预发布站点域名")
+	}
+	if strings.ContainsAny(domain, ", \t") || strings.HasPrefix(domain, "*.") {
+		return errors.New("预发布站点只能使用一个确定的域名")
+	}
+	for _, existing := range strings.Split(site.Domain, ",") {
+		if strings.EqualFold(strings.TrimSpace(existing), domain) {
+			return errors.New("预发布站点域名不能与原站点相同")
+		}
+	}
+	if request.DatabaseID > 0 {
+		if m.staging == nil {
+			return errors.New("当前环境不支持复制网站数据库")
+		}
+		if !stagingDatabasePattern.MatchString(request.StagingDatabaseName) {
+			return errors.New("预发布数据库名称只能包含字母、数字和下划线")
+		}
+	} else if request.StagingDatabaseName != "" {
+		return errors.New("复制数据库时需要选择原站点数据库")
+	}
+	username := request.AuthUsername
+	if username == "" {
+		username = defaultStagingAuthUser
+	}
+	if request.AuthPassword == "" {
+		return errors.New("请设置预发布站点的访问密码")
+	}
+	account, err := website.NewBasicAuthUser(username, request.AuthPassword)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	request.StagingAuth = string(encoded)
+	request.AuthPassword = ""
+	return nil
+}
+
+// preparePush resolves the live site and libraries of a staging site.
+func (m *Manager) preparePush(request *Request) (*models.Website, error) {
+	staging, err := m.GetStaging(request.StagingWebsiteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("该网站不是预发布站点")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.sites.Get(staging.WebsiteID); err != nil {
+		return nil, err
+	}
+	live, err := m.sites.Get(staging.LiveWebsiteID)
+	if err != nil {
+		return nil, err
+	}
+	if request.ConfirmName != live.Name {
+		return nil, errors.New("网站确认名称不匹配")
+	}
+	request.WebsiteID = live.ID
+	if request.PushDatabase {
+		if staging.DatabaseID <= 0 || staging.LiveDatabaseID <= 0 {
+			return nil, errors.New("预发布站点没有复制数据库，无法推送数据库")
+		}
+		if m.staging == nil {
+			return nil, errors.New("当前环境不支持复制网站数据库")
+		}
+		request.DatabaseID = staging.LiveDatabaseID
+		request.StagingDatabaseID = staging.DatabaseID
+	}
+	return live, nil
+}
+
+// runClone copies the files of the live site through the archive pipeline
+// into a new site on the staging domain, carries the settings over with the
+// domain rewritten, protects the copy with basic authentication, and
+// optionally duplicates the bound library, pointing the application configs
+// of the copy at it.
+func (m *Manager) runClone(
+	ctx context.Context,
+	task *models.WebsiteTask,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) (err error) {
+	source, err := m.sites.Get(task.WebsiteID)
+	if err != nil {
+		return err
+	}
+	settingsDocument, err := m.sites.GetSettings(source.ID)
+	if err != nil {
+		return fmt.Errorf("read website settings: %w", err)
+	}
+	var account website.WebsiteBasicAuthUser
+	if err := json.Unmarshal([]byte(task.StagingAuthJSON), &account); err != nil {
+		return fmt.Errorf("decode staging credentials: %w", err)
+	}
+	report(5, "正在打包原站点文件")
+	extracted, operationRoot, cleanup, err := m.stageSiteCopy(ctx, task, source, func(progress int, message string) {
+		report(scaleProgress(progress, 5, 35), message)
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	report(40, "正在创建预发布站点 "+task.StagingDomain)
+	staging := models.Website{
+		Domain: task.StagingDomain, Type: source.Type,
+		Remark:  "预发布：" + source.Name,
+		Class:   source.Class,
+		Pact:    source.Pact,
+		SendUrl: source.SendUrl,
+		TarUrl:  source.TarUrl,
+		// The staging tree is isolated whenever the live tree is.
+		Isolated: source.SystemUser != "",
+	}
+	if err := m.sites.Add(ctx, &staging); err != nil {
+		return fmt.Errorf("create staging website: %w", err)
+	}
+	var stagingDatabaseID int64
+	defer func() {
+		if err == nil {
+			return
+		}
+		if stagingDatabaseID > 0 {
+			err = errors.Join(err, m.staging.DropLibrary(context.Background(), stagingDatabaseID))
+		}
+		err = errors.Join(err, m.sites.DeleteWithOptions(context.Background(), staging.ID, true))
+	}()
+	if err := m.db.Model(&models.WebsiteTask{}).Where("id = ?", task.ID).
+		Update("staging_website_id", staging.ID).Error; err != nil {
+		return err
+	}
+
+	notices, err := pointDatabaseConfigs(extracted.SiteRoot, task.StagingDatabaseName)
+	if err != nil {
+		return fmt.Errorf("rewrite staging database config: %w", err)
+	}
+	for _, notice := range notices {
+		_, _ = fmt.Fprintln(log, notice)
+	}
+
+	report(50, "正在复制网站文件")
+	_, commitFiles, err := m.replaceWebsiteFiles(&staging, extracted.SiteRoot, operationRoot)
+	if err != nil {
+		return err
+	}
+	if err := commitFiles(); err != nil {
+		return err
+	}
+	if err := m.normalizeStagedTree(ctx, &staging); err != nil {
+		return err
+	}
+
+	report(60, "正在生成预发布站点配置")
+	settings := rewriteSettingsDomain(settingsDocument.Settings, source, &staging)
+	settings.BasicAuth = &website.WebsiteBasicAuth{
+		Enabled: true, Realm: defaultStagingAuthRealm,
+		Users: []website.WebsiteBasicAuthUser{account},
+	}
+	if _, err := m.sites.UpdateSettings(ctx, staging.ID, settings); err != nil {
+		return fmt.Errorf("apply staging website settings: %w", err)
+	}
+
+	if task.DatabaseID > 0 {
+		report(70, "正在创建预发布数据库 "+task.StagingDatabaseName)
+		stagingDatabaseID, err = m.staging.CreateLibraryLike(ctx, task.DatabaseID, task.StagingDatabaseName)
+		if err != nil {
+			return fmt.Errorf("create staging database: %w", err)
+		}
+		if err := m.db.Model(&models.WebsiteTask{}).Where("id = ?", task.ID).
+			Update("staging_database_id", stagingDatabaseID).Error; err != nil {
+			return err
+		}
+		var replacements []string
+		if task.RewriteDatabase {
+			replacements = []string{source.Name, staging.Name}
+		}
+		if err := m.staging.Copy(
+			ctx, task.DatabaseID, stagingDatabaseID, replacements, log,
+			func(progress int, message string) {
+				report(scaleProgress(progress, 72, 96), message)
+			},
+		); err != nil {
+			return fmt.Errorf("copy website database: %w", err)
+		}
+	}
+	if err := m.db.Create(&models.WebsiteStaging{
+		WebsiteID: staging.ID, LiveWebsiteID: source.ID,
+		DatabaseID: stagingDatabaseID, LiveDatabaseID: task.DatabaseID,
+		CreatedBy: task.RequestedBy,
+	}).Error; err != nil {
+		return err
+	}
+	message := "预发布站点 " + staging.Name + " 已创建"
+	if len(notices) > 0 {
+		message += "；" + strings.Join(notices, "；")
+	}
+	report(99, message)
+	return nil
+}
+
+// runPush replaces the files of the live site with the staging copy and
+// optionally copies the staging library over the live one. The live settings
+// and application database configs are kept. A verified safety backup is taken first, and the live library is
+// restored from it when the push fails after the database was touched.
+func (m *Manager) runPush(
+	ctx context.Context,
+	task *models.WebsiteTask,
+	log io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	staging, err := m.GetStaging(task.StagingWebsiteID)
+	if err != nil {
+		return fmt.Errorf("load staging link: %w", err)
+	}
+	if staging.LiveWebsiteID != task.WebsiteID {
+		return errors.New("staging link does not match task")
+	}
+	live, err := m.sites.Get(task.WebsiteID)
+	if err != nil {
+		return err
+	}
+	stagingSite, err := m.sites.Get(staging.WebsiteID)
+	if err != nil {
+		return err
+	}
+	report(5, "正在创建推送前安全快照")
+	safety, err := m.createAndRegisterBackup(
+		ctx, task, models.WebsiteBackupSourcePrePush, log,
+		func(progress int, message string) {
+			report(scaleProgress(progress, 5, 40), "推送前快照："+message)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("create pre-push safety backup: %w", err)
+	}
+	if err := m.db.Model(&models.WebsiteTask{}).Where("id = ?", task.ID).
+		Update("safety_backup_id", safety.ID).Error; err != nil {
+		return err
+	}
+
+	report(45, "正在打包预发布站点文件")
+	extracted, operationRoot, cleanup, err := m.stageSiteCopy(ctx, task, stagingSite, func(progress int, message string) {
+		report(scaleProgress(progress, 45, 60), message)
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	databaseTouched := false
+	restoreDatabase := func(err error) error {
+		if !databaseTouched {
+			return err
+		}
+		_, _ = fmt.Fprintf(log, "restoring live database from safety backup %s\n", safety.ID)
+		return errors.Join(err, m.restoreBackupDatabase(context.Background(), task, safety.ID, log))
+	}
+	if task.DatabaseID > 0 {
+		if task.StagingDatabaseID != staging.DatabaseID {
+			return errors.New("staging database does not match task")
+		}
+		var replacements []string
+		if task.RewriteDatabase {
+			replacements = []string{stagingSite.Name, live.Name}
+		}
+		report(62, "正在推送预发布数据库")
+		databaseTouched = true
+		if err := m.staging.Copy(
+			ctx, task.StagingDatabaseID, task.DatabaseID, replacements, log,
+			func(progress int, message string) {
+				report(scaleProgress(progress, 62, 85), message)
+			},
+		); err != nil {
+			return restoreDatabase(fmt.Errorf("push website database: %w", err))
+		}
+	}
+	report(88, "正在替换线上网站文件")
+	liveRoot, err := m.sites.ManagedRoot(live)
+	if err != nil {
+		return restoreDatabase(err)
+	}
+	if err := keepLiveDatabaseConfigs(liveRoot, extracted.SiteRoot); err != nil {
+		return restoreDatabase(fmt.Errorf("keep live database config: %w", err))
+	}
+	rollbackFiles, commitFiles, err := m.replaceWebsiteFiles(live, extracted.SiteRoot, operationRoot)
+	if err != nil {
+		return restoreDatabase(err)
+	}
+	if err := m.normalizeStagedTree(ctx, live); err != nil {
+		return restoreDatabase(errors.Join(err, rollbackFiles()))
+	}
+	if err := commitFiles(); err != nil {
+		return restoreDatabase(errors.Join(err, rollbackFiles()))
+	}
+	report(99, "预发布站点已推送到 "+live.Name)
+	return nil
+}
+
+// stageSiteCopy archives the tree of site with the backup pipeline and
+// extracts it next to the managed roots, where it can be renamed into place.
+// The archive carries no database; callers copy libraries separately.
+func (m *Manager) stageSiteCopy(
+	ctx context.Context,
+	task *models.WebsiteTask,
+	site *models.Website,
+	report databasetask.ProgressReporter,
+) (*extractedArchive, string, func(), error) {
+	rootPath, err := m.sites.ManagedRoot(site)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	configPath, err := m.sites.ConfigFile(site)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	settingsDocument, err := m.sites.GetSettings(site.ID)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("read website settings: %w", err)
+	}
+	settings := settingsDocument.Settings
+	if err := m.checkDiskSpace(); err != nil {
+		return nil, "", nil, err
+	}
+	workParent := filepath.Join(m.backupRoot, ".work")
+	if err := os.MkdirAll(workParent, 0700); err != nil {
+		return nil, "", nil, err
+	}
+	if err := ensureRealDirectory(workParent); err != nil {
+		return nil, "", nil, err
+	}
+	workRoot := filepath.Join(workParent, task.ID+"-"+uuid.NewString())
+	if err := os.Mkdir(workRoot, 0700); err != nil {
+		return nil, "", nil, err
+	}
+	defer os.RemoveAll(workRoot)
+	artifact := filepath.Join(workRoot, "site.tar.gz")
+	report(10, "正在打包网站文件")
+	if _, _, _, err := buildArchive(ctx, site, &settings, rootPath, configPath, nil, artifact, m.limits); err != nil {
+		return nil, "", nil, err
+	}
+	stagingParent := filepath.Join(m.sites.WebRoot, ".oneinstack-restore")
+	if err := os.MkdirAll(stagingParent, 0700); err != nil {
+		return nil, "", nil, err
+	}
+	if err := ensureRealDirectory(stagingParent); err != nil {
+		return nil, "", nil, err
+	}
+	operationRoot := filepath.Join(stagingParent, task.ID)
+	if err := os.Mkdir(operationRoot, 0700); err != nil {
+		return nil, "", nil, fmt.Errorf("create website staging directory: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(operationRoot) }
+	report(60, "正在校验并解压网站文件")
+	extracted, err := extractArchive(ctx, artifact, operationRoot, m.limits)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	if rootPath == "" {
+		// Proxy sites have no tree; an empty directory keeps the callers uniform.
+		if err := os.MkdirAll(extracted.SiteRoot, 0750); err != nil {
+			cleanup()
+			return nil, "", nil, err
+		}
+	}
+	report(100, "网站文件已准备")
+	return extracted, operationRoot, cleanup, nil
+}
+
+// normalizeStagedTree hands a moved-in tree to the account of an isolated
+// site; shared sites keep the ownership recorded in the archive.
+func (m *Manager) normalizeStagedTree(ctx context.Context, site *models.Website) error {
+	if site.SystemUser == "" || m.sites.SystemUsers == nil {
+		return nil
+	}
+	root, err := m.sites.ManagedRoot(site)
+	if err != nil || root == "" {
+		return err
+	}
+	return m.sites.SystemUsers.Normalize(ctx, root, site.SystemUser)
+}
+
+// pointDatabaseConfigs rewrites the library named by the application configs
+// of a staged tree to database. It returns what the operator still has to
+// change: configs it could not rewrite, or every config found when no
+// staging library was created.
+func pointDatabaseConfigs(siteRoot, database string) ([]string, error) {
+	root, err := os.OpenRoot(siteRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	var notices []string
+	for _, config := range stagingDatabaseConfigs {
+		info, err := root.Lstat(config.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			notices = append(notices, config.Name+" 不是普通文件，请手动修改其中的数据库配置")
+			continue
+		}
+		if database == "" {
+			notices = append(notices, config.Name+" 仍指向线上数据库，请修改后再使用预发布站点")
+			continue
+		}
+		file, err := root.Open(config.Name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(io.LimitReader(file, maxDatabaseConfigBytes+1))
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > maxDatabaseConfigBytes || !config.Database.Match(content) {
+			notices = append(notices, "未能识别 "+config.Name+" 中的数据库名，请手动改为 "+database)
+			continue
+		}
+		content = config.Database.ReplaceAll(content, []byte("${1}"+database+"${2}"))
+		file, err = root.OpenFile(config.Name, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return nil, err
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return notices, nil
+}
+
+// keepLiveDatabaseConfigs replaces the application configs of a staged tree
+// with the ones of the live root, so a push never points the live site at
+// the staging library. A config only the staging tree has is dropped.
+func keepLiveDatabaseConfigs(liveRoot, siteRoot string) error {
+	if liveRoot == "" {
+		return nil
+	}
+	for _, config := range stagingDatabaseConfigs {
+		staged := filepath.Join(siteRoot, config.Name)
+		if err := os.RemoveAll(staged); err != nil {
+			return err
+		}
+		current := filepath.Join(liveRoot, config.Name)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s of the live site is not a regular file", config.Name)
+		}
+		// A hard link keeps the owner and mode of the live file; the staged
+		// tree lives beside the managed roots, on the same file system.
+		if err := os.Link(current, staged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBackupDatabase loads the database dump of a verified backup back
+// into the task's library.
+func (m *Manager) restoreBackupDatabase(ctx context.Context, task *models.WebsiteTask, backupID string, log io.Writer) error {
+	_, path, err := m.verifiedBackup(backupID)
+	if err != nil {
+		return err
+	}
+	root, err := os.MkdirTemp(filepath.Join(m.backupRoot, ".work"), "database-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(root)
+	extracted, err := extractArchive(ctx, path, root, m.limits)
+	if err != nil {
+		return err
+	}
+	if extracted.Manifest.Database == nil || extracted.Manifest.Database.ID != task.DatabaseID {
+		return errors.New("safety backup does not contain the website database")
+	}
+	return m.databases.Restore(ctx, task.DatabaseID, extracted.DatabasePath, log, func(int, string) {})
+}
+
+// rewriteSettingsDomain moves the settings of a site to another site. Only
+// the values bound to the site itself follow: hotlink entries naming the site
+// and open_basedir paths below its managed root. Proxy targets, upstream
+// servers and redirects keep pointing at the hosts they were written for,
+// even when those hosts share the live domain.
+func rewriteSettingsDomain(settings website.WebsiteSettings, from, to *models.Website) website.WebsiteSettings {
+	if settings.HotlinkDomains != "" {
+		domains := strings.Fields(strings.ReplaceAll(settings.HotlinkDomains, ",", " "))
+		for index, domain := range domains {
+			if strings.EqualFold(domain, from.Name) {
+				domains[index] = to.Name
+			}
+		}
+		settings.HotlinkDomains = strings.Join(domains, " ")
+	}
+	if settings.PHPPool != nil {
+		pool := *settings.PHPPool
+		pool.OpenBasedir = make([]string, len(settings.PHPPool.OpenBasedir))
+		oldRoot := filepath.Clean(from.RootDir)
+		for index, value := range settings.PHPPool.OpenBasedir {
+			cleaned := filepath.Clean(strings.TrimSpace(value))
+			if relative, err := filepath.Rel(oldRoot, cleaned); err == nil && filepath.IsLocal(relative) {
+				value = filepath.Join(to.RootDir, relative)
+			}
+			pool.OpenBasedir[index] = value
+		}
+		settings.PHPPool = &pool
+	}
+	return settings
+}
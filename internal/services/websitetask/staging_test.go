@@ -0,0 +1,336 @@
+package websitetask
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oneinstack/internal/models"
+	"oneinstack/internal/services/databasetask"
+	"oneinstack/internal/services/website"
+)
+
+type fakeDatabaseCopy struct {
+	source, target int64
+	replacements   []string
+}
+
+const fakeStagingLibraryID = 99
+
+func (operator *fakeDatabaseOperator) CreateLibraryLike(context.Context, int64, string) (int64, error) {
+	return fakeStagingLibraryID, nil
+}
+
+func (operator *fakeDatabaseOperator) DropLibrary(context.Context, int64) error {
+	return nil
+}
+
+func (operator *fakeDatabaseOperator) Copy(
+	_ context.Context,
+	sourceID, targetID int64,
+	replacements []string,
+	_ io.Writer,
+	report databasetask.ProgressReporter,
+) error {
+	operator.mu.Lock()
+	defer operator.mu.Unlock()
+	operator.copies = append(operator.copies, fakeDatabaseCopy{sourceID, targetID, replacements})
+	report(50, "fake database copy")
+	return operator.copyErr
+}
+
+func TestWebsiteCloneToStagingAndPushToLive(t *testing.T) {
+	db := openWebsiteTaskTestDB(t)
+	root := t.TempDir()
+	webRoot := filepath.Join(root, "www")
+	configRoot := filepath.Join(root, "nginx")
+	for _, directory := range []string{webRoot, filepath.Join(root, "logs"), configRoot, filepath.Join(root, "challenge")} {
+		if err := os.MkdirAll(directory, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	siteService := &website.Service{
+		DB: db, WebRoot: webRoot, LogRoot: filepath.Join(root, "logs"),
+		ChallengeRoot:   filepath.Join(root, "challenge"),
+		CertificateRoot: filepath.Join(root, "certificates"),
+		Publisher: &website.Publisher{
+			ConfigDir: configRoot, NginxBinary: "nginx", Runner: fakeCommandRunner{},
+		},
+	}
+	live := &models.Website{Domain: "live.example.com", Type: "static"}
+	if err := siteService.Add(context.Background(), live); err != nil {
+		t.Fatal(err)
+	}
+	liveSettings, err := siteService.GetSettings(live.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liveSettings.Settings.HotlinkDomains = "live.example.com"
+	if _, err := siteService.UpdateSettings(context.Background(), live.ID, liveSettings.Settings); err != nil {
+		t.Fatal(err)
+	}
+	livePage := filepath.Join(live.RootDir, "index.html")
+	if err := os.WriteFile(livePage, []byte("live-v1"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	liveConfig := filepath.Join(live.RootDir, "wp-config.php")
+	if err := os.WriteFile(liveConfig, []byte("<?php\ndefine( 'DB_NAME', 'live_db' );\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	connection := &models.Storage{Addr: "127.0.0.1", Port: "3306", Root: "root", Type: "mysql"}
+	if err := db.Create(connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	library := &models.Library{PID: connection.ID, Name: "live_db", Type: "mysql"}
+	if err := db.Create(library).Error; err != nil {
+		t.Fatal(err)
+	}
+	databaseOperator := &fakeDatabaseOperator{backupValue: []byte("live-database")}
+	manager := NewManager(
+		db, filepath.Join(root, "backups"), filepath.Join(root, "task-logs"),
+		siteService, databaseOperator, 64<<20, 1000, 0,
+	)
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = manager.Stop(ctx)
+	})
+
+	for _, input := range []CloneInput{
+		{Domain: "live.example.com", AuthPassword: "secret"},
+		{Domain: "staging.example.com"},
+		{Domain: "staging.example.com", AuthPassword: "secret", DatabaseID: library.ID, DatabaseName: "bad-name"},
+	} {
+		if _, err := manager.SubmitClone(live.ID, input, 1); err == nil {
+			t.Fatalf("invalid clone request was accepted: %#v", input)
+		}
+	}
+	cloneTask, err := manager.SubmitClone(live.ID, CloneInput{
+		Domain: "staging.example.com", DatabaseID: library.ID, DatabaseName: "staging_db",
+		RewriteDatabase: true, AuthPassword: "secret",
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloneTask = waitForWebsiteTask(t, manager, cloneTask.ID)
+	if cloneTask.Status != models.WebsiteTaskStatusSucceeded || cloneTask.StagingWebsiteID == 0 ||
+		cloneTask.StagingDatabaseID != fakeStagingLibraryID {
+		t.Fatalf("unexpected clone task: %#v", cloneTask)
+	}
+	staging, err := siteService.Get(cloneTask.StagingWebsiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stagingPage := filepath.Join(staging.RootDir, "index.html")
+	if value, err := os.ReadFile(stagingPage); err != nil || string(value) != "live-v1" {
+		t.Fatalf("files were not cloned: %q %v", value, err)
+	}
+	stagingConfig := filepath.Join(staging.RootDir, "wp-config.php")
+	if value, err := os.ReadFile(stagingConfig); err != nil ||
+		string(value) != "<?php\ndefine( 'DB_NAME', 'staging_db' );\n" {
+		t.Fatalf("staging config still names the live database: %q %v", value, err)
+	}
+	stagingSettings, err := siteService.GetSettings(staging.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := stagingSettings.Settings.BasicAuth
+	if stagingSettings.Settings.HotlinkDomains != "staging.example.com" ||
+		auth == nil || !auth.Enabled || len(auth.Users) != 1 || auth.Users[0].Username != "staging" ||
+		auth.Users[0].Password != "" {
+		t.Fatalf("unexpected staging settings: %#v", stagingSettings.Settings)
+	}
+	passwords, err := os.ReadFile(filepath.Join(webRoot, ".oneinstack-auth", "site2.htpasswd"))
+	if err != nil || !strings.HasPrefix(string(passwords), "staging:{SSHA}") {
+		t.Fatalf("password file was not written: %q %v", passwords, err)
+	}
+	config, err := os.ReadFile(filepath.Join(configRoot, "staging.example.com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), `auth_basic "Staging";`) ||
+		!strings.Contains(string(config), "auth_basic off;") {
+		t.Fatalf("staging config is not protected:\n%s", config)
+	}
+	if len(databaseOperator.copies) != 1 || databaseOperator.copies[0].source != library.ID ||
+		databaseOperator.copies[0].target != fakeStagingLibraryID ||
+		strings.Join(databaseOperator.copies[0].replacements, " ") != "live.example.com staging.example.com" {
+		t.Fatalf("unexpected database copy: %#v", databaseOperator.copies)
+	}
+
+	if err := os.WriteFile(stagingPage, []byte("staging-v2"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.SubmitPush(live.ID, PushInput{ConfirmName: live.Name}, 1); err == nil {
+		t.Fatal("live site was accepted as a staging site")
+	}
+	if _, err := manager.SubmitPush(staging.ID, PushInput{ConfirmName: staging.Name}, 1); err == nil {
+		t.Fatal("push accepted the staging name as confirmation")
+	}
+	pushTask, err := manager.SubmitPush(staging.ID, PushInput{
+		ConfirmName: live.Name, Database: true, RewriteDatabase: true,
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTask = waitForWebsiteTask(t, manager, pushTask.ID)
+	if pushTask.Status != models.WebsiteTaskStatusSucceeded || pushTask.SafetyBackupID == "" ||
+		pushTask.WebsiteID != live.ID || pushTask.DatabaseID != library.ID {
+		t.Fatalf("unexpected push task: %#v", pushTask)
+	}
+	if value, err := os.ReadFile(livePage); err != nil || string(value) != "staging-v2" {
+		t.Fatalf("staging files were not pushed: %q %v", value, err)
+	}
+	if value, err := os.ReadFile(liveConfig); err != nil ||
+		string(value) != "<?php\ndefine( 'DB_NAME', 'live_db' );\n" {
+		t.Fatalf("push replaced the live database config: %q %v", value, err)
+	}
+	pushed, err := siteService.GetSettings(live.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Settings.HotlinkDomains != "live.example.com" || pushed.Settings.BasicAuth != nil {
+		t.Fatalf("live settings were not kept: %#v", pushed.Settings)
+	}
+	if len(databaseOperator.copies) != 2 || databaseOperator.copies[1].source != fakeStagingLibraryID ||
+		databaseOperator.copies[1].target != library.ID ||
+		strings.Join(databaseOperator.copies[1].replacements, " ") != "staging.example.com live.example.com" {
+		t.Fatalf("unexpected database push: %#v", databaseOperator.copies)
+	}
+
+	// A failed database push restores the live library from the safety
+	// backup and leaves the live files untouched.
+	if err := os.WriteFile(stagingPage, []byte("staging-v3"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	databaseOperator.mu.Lock()
+	databaseOperator.backupValue = []byte("live-database-before-push")
+	databaseOperator.copyErr = errors.New("import failed")
+	databaseOperator.mu.Unlock()
+	failedTask, err := manager.SubmitPush(staging.ID, PushInput{ConfirmName: live.Name, Database: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failedTask = waitForWebsiteTask(t, manager, failedTask.ID)
+	if failedTask.Status != models.WebsiteTaskStatusFailed {
+		t.Fatalf("failed push was reported as %#v", failedTask)
+	}
+	if value, err := os.ReadFile(livePage); err != nil || string(value) != "staging-v2" {
+		t.Fatalf("live files changed by a failed push: %q %v", value, err)
+	}
+	databaseOperator.mu.Lock()
+	restored := string(databaseOperator.restored)
+	databaseOperator.mu.Unlock()
+	if restored != "live-database-before-push" {
+		t.Fatalf("live database was not restored: %q", restored)
+	}
+
+	// Failing to remove the replaced tree rolls the files and the database
+	// back as well.
+	databaseOperator.mu.Lock()
+	databaseOperator.backupValue = []byte("live-database-before-commit")
+	databaseOperator.copyErr = nil
+	databaseOperator.mu.Unlock()
+	manager.removeTree = func(string) error { return errors.New("device busy") }
+	commitTask, err := manager.SubmitPush(staging.ID, PushInput{ConfirmName: live.Name, Database: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitTask = waitForWebsiteTask(t, manager, commitTask.ID)
+	if commitTask.Status != models.WebsiteTaskStatusFailed {
+		t.Fatalf("push with a failed commit was reported as %#v", commitTask)
+	}
+	if value, err := os.ReadFile(livePage); err != nil || string(value) != "staging-v2" {
+		t.Fatalf("live files were not rolled back: %q %v", value, err)
+	}
+	databaseOperator.mu.Lock()
+	restored = string(databaseOperator.restored)
+	databaseOperator.mu.Unlock()
+	if restored != "live-database-before-commit" {
+		t.Fatalf("live database was not restored after the failed commit: %q", restored)
+	}
+
+	if err := siteService.Delete(context.Background(), staging.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.GetStaging(staging.ID); !IsNotFound(err) {
+		t.Fatalf("staging link of deleted site was kept: %v", err)
+	}
+}
+
+func TestRewriteSettingsDomainKeepsHostsUnderTheLiveDomain(t *testing.T) {
+	live := &models.Website{Name: "example.com", RootDir: "/data/wwwroot/example.com"}
+	staging := &models.Website{Name: "staging.example.com", RootDir: "/data/wwwroot/staging.example.com"}
+	settings := website.WebsiteSettings{
+		ProxyRules: []website.WebsiteProxyRule{{Path: "/api", Target: "http://api.example.com", Host: "api.example.com", Enabled: true}},
+		Upstreams: []website.WebsiteUpstream{{
+			Name: "backend", Servers: []website.WebsiteUpstreamServer{{Address: "app.example.com:8080"}},
+		}},
+		ProxyUpstream:  "http://api.example.com:8080",
+		Redirects:      []website.WebsiteRedirectRule{{Source: "/shop", Target: "https://shop.example.com/", Status: 301}},
+		HotlinkDomains: "example.com, cdn.example.com",
+		PHPPool: &website.WebsitePHPPool{OpenBasedir: []string{
+			"/data/wwwroot/example.com/shared", "/data/wwwroot/example.com.old", "/data/shared/example.com",
+		}},
+	}
+
+	rewritten := rewriteSettingsDomain(settings, live, staging)
+	if rule := rewritten.ProxyRules[0]; rule.Target != "http://api.example.com" || rule.Host != "api.example.com" {
+		t.Fatalf("proxy rule was rewritten: %#v", rule)
+	}
+	if address := rewritten.Upstreams[0].Servers[0].Address; address != "app.example.com:8080" {
+		t.Fatalf("upstream server was rewritten: %s", address)
+	}
+	if rewritten.ProxyUpstream != "http://api.example.com:8080" ||
+		rewritten.Redirects[0].Target != "https://shop.example.com/" {
+		t.Fatalf("proxy or redirect target was rewritten: %#v", rewritten)
+	}
+	if rewritten.HotlinkDomains != "staging.example.com cdn.example.com" {
+		t.Fatalf("unexpected hotlink domains: %q", rewritten.HotlinkDomains)
+	}
+	want := []string{"/data/wwwroot/staging.example.com/shared", "/data/wwwroot/example.com.old", "/data/shared/example.com"}
+	if strings.Join(rewritten.PHPPool.OpenBasedir, ":") != strings.Join(want, ":") {
+		t.Fatalf("unexpected open_basedir: %v", rewritten.PHPPool.OpenBasedir)
+	}
+	if settings.PHPPool.OpenBasedir[0] != "/data/wwwroot/example.com/shared" {
+		t.Fatal("the live settings were modified")
+	}
+}
+
+func TestPointDatabaseConfigsReportsWhatItCannotRewrite(t *testing.T) {
+	root := t.TempDir()
+	env := filepath.Join(root, ".env")
+	if err := os.WriteFile(env, []byte("APP_ENV=production\nDB_DATABASE=\"live_db\"\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "wp-config.php"), []byte("<?php require 'db.php';\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	notices, err := pointDatabaseConfigs(root, "staging_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "wp-config.php") {
+		t.Fatalf("unexpected notices: %q", notices)
+	}
+	if value, err := os.ReadFile(env); err != nil || string(value) != "APP_ENV=production\nDB_DATABASE=\"staging_db\"\n" {
+		t.Fatalf(".env was not rewritten: %q %v", value, err)
+	}
+
+	notices, err = pointDatabaseConfigs(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != 2 {
+		t.Fatalf("configs of a clone without a staging library were not reported: %q", notices)
+	}
+}
@@ -28,6 +28,10 @@ func ListDNSProviders(c *gin.Context) {
 	core.HandleSuccess(c, certificateService.SupportedDNSProviders())
 }
 
+func ListACMEProviders(c *gin.Context) {
+	core.HandleSuccess(c, certificateService.SupportedACMEProviders())
+}
+
 func List(c *gin.Context) {
 	catalog, ok := certificateCatalog(c)
 	if !ok {
@@ -211,6 +215,57 @@ func DeleteDNSAccount(c *gin.Context) {
 	core.HandleSuccess(c, gin.H{"deleted": true})
 }
 
+func ListACMEAccounts(c *gin.Context) {
+	catalog, ok := certificateCatalog(c)
+	if !ok {
+		return
+	}
+	accounts, err := catalog.ListACMEAccounts()
+	if err != nil {
+		catalogError(c, err, "读取 ACME 账号失败")
+		return
+	}
+	core.HandleSuccess(c, accounts)
+}
+
+func SaveACMEAccount(c *gin.Context) {
+	var request input.ACMEAccountParam
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "ACME 账号参数格式不正确"))
+		return
+	}
+	enabled := true
+	if request.Enabled != nil {
+		enabled = *request.Enabled
+	}
+	catalog, ok := certificateCatalog(c)
+	if !ok {
+		return
+	}
+	account, err := catalog.SaveACMEAccount(certificateService.ACMEAccountOptions{
+		ID: request.ID, Name: request.Name, Provider: request.Provider, DirectoryURL: request.DirectoryURL,
+		Email: request.Email, EABKeyID: request.EABKeyID, EABHMACKey: request.EABHMACKey,
+		CABundle: request.CABundle, Enabled: enabled,
+	})
+	if err != nil {
+		catalogError(c, err, "保存 ACME 账号失败")
+		return
+	}
+	core.HandleSuccess(c, account)
+}
+
+func DeleteACMEAccount(c *gin.Context) {
+	catalog, ok := certificateCatalog(c)
+	if !ok {
+		return
+	}
+	if err := catalog.DeleteACMEAccount(c.Param("id")); err != nil {
+		catalogError(c, err, "删除 ACME 账号失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"deleted": true})
+}
+
 func ListTasks(c *gin.Context) {
 	manager, ok := taskManager(c)
 	if !ok {
@@ -16,6 +16,7 @@ import (
 	"oneinstack/core"
 	accessservice "oneinstack/internal/services/access"
 	"oneinstack/internal/services/filemanager"
+	websiteService "oneinstack/internal/services/website"
 	"oneinstack/router/middleware"
 	"oneinstack/utils"
 	"os"
@@ -912,6 +913,32 @@ func managerForRequest(c *gin.Context) (*filemanager.Manager, bool) {
 		if access.HasPermission(accessservice.PermissionFileScopeBackups) {
 			allowedPrefixes = append(allowedPrefixes, "/backups")
 		}
+		// Site assignments narrow the permission scope; they never widen it.
+		roots, assigned, err := websiteService.AssignedRoots(app.DB(), access.UserID)
+		if err != nil {
+			core.HandleError(c, core.WrapError(err, core.ErrInternalError, "读取网站授权失败"))
+			return nil, false
+		}
+		if assigned {
+			prefixes := make([]string, 0, len(roots))
+			for _, root := range roots {
+				relative, err := filepath.Rel(manager.RootPath(), root)
+				if err != nil || relative == "." || relative == ".." ||
+					strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+					continue
+				}
+				prefixes = append(prefixes, "/"+filepath.ToSlash(relative))
+			}
+			if len(allowedPrefixes) > 0 {
+				prefixes = intersectScopePrefixes(prefixes, allowedPrefixes)
+			}
+			if len(prefixes) == 0 {
+				core.HandleError(c, core.NewError(core.ErrForbidden, "已授权的网站目录不在当前文件访问范围内"))
+				return nil, false
+			}
+			manager.WithScope(prefixes)
+			return manager, true
+		}
 		if len(allowedPrefixes) > 0 {
 			manager.WithScope(allowedPrefixes)
 		}
@@ -919,6 +946,36 @@ func managerForRequest(c *gin.Context) (*filemanager.Manager, bool) {
 	return manager, true
 }
 
+// intersectScopePrefixes keeps the parts of the assigned prefixes that also
+// fall inside one of the allowed prefixes.
+func intersectScopePrefixes(assigned, allowed []string) []string {
+	seen := make(map[string]struct{})
+	var prefixes []string
+	add := func(prefix string) {
+		if _, ok := seen[prefix]; ok {
+			return
+		}
+		seen[prefix] = struct{}{}
+		prefixes = append(prefixes, prefix)
+	}
+	for _, assignedPrefix := range assigned {
+		for _, allowedPrefix := range allowed {
+			switch {
+			case scopePrefixContains(allowedPrefix, assignedPrefix):
+				add(assignedPrefix)
+			case scopePrefixContains(assignedPrefix, allowedPrefix):
+				add(allowedPrefix)
+			}
+		}
+	}
+	return prefixes
+}
+
+func scopePrefixContains(prefix, virtualPath string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return virtualPath == prefix || strings.HasPrefix(virtualPath, prefix+"/")
+}
+
 func developmentFileRootFallback(rootPath string) (string, bool) {
 	if os.Getenv("GO_ENV") != "development" && app.ENV != "debug" {
 		return "", false
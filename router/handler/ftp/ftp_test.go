@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"oneinstack/app"
 	"oneinstack/internal/models"
+	accessservice "oneinstack/internal/services/access"
 	auditservice "oneinstack/internal/services/audit"
 	"oneinstack/internal/services/filemanager"
 	"oneinstack/router/middleware"
@@ -790,6 +791,58 @@ func TestDeleteRejectsAuthorizedRoot(t *testing.T) {
 	}
 }
 
+func TestSiteAssignmentsCannotWidenPermissionScope(t *testing.T) {
+	if err := app.InitDB("file:ftp-assignment-tests?mode=memory&cache=shared"); err != nil {
+		t.Fatal(err)
+	}
+	rootPath := configureTestFileRoot(t)
+	var assigned []int64
+	for _, directory := range []string{"websites/shop", "data/wwwroot/other"} {
+		if err := os.MkdirAll(filepath.Join(rootPath, directory), 0755); err != nil {
+			t.Fatal(err)
+		}
+		site := models.Website{
+			Domain:  filepath.Base(directory) + ".example.com",
+			Type:    "static",
+			RootDir: filepath.Join(rootPath, directory),
+		}
+		if err := app.DB().Create(&site).Error; err != nil {
+			t.Fatal(err)
+		}
+		assigned = append(assigned, site.ID)
+	}
+	const userID int64 = 41
+	for _, websiteID := range assigned {
+		if err := app.DB().Create(&models.WebsiteAssignment{WebsiteID: websiteID, UserID: userID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	access := &accessservice.UserAccess{
+		UserID: userID,
+		PermissionSet: map[string]struct{}{
+			accessservice.PermissionFileRead:          {},
+			accessservice.PermissionFileScopeWebsites: {},
+		},
+	}
+
+	for path, want := range map[string]int{
+		"/websites/shop":      http.StatusOK,
+		"/websites":           http.StatusBadRequest,
+		"/data/wwwroot/other": http.StatusBadRequest,
+	} {
+		gin.SetMode(gin.TestMode)
+		response := httptest.NewRecorder()
+		context, _ := gin.CreateTestContext(response)
+		context.Request = httptest.NewRequest(http.MethodPost, "/ftp/test", strings.NewReader(`{"path":"`+path+`"}`))
+		context.Request.Header.Set("Content-Type", "application/json")
+		context.Set(middleware.ContextUserAccess, access)
+		ListDirectory(context)
+		if response.Code != want {
+			t.Fatalf("list %s status = %d, want %d; body = %s", path, response.Code, want, response.Body.String())
+		}
+	}
+}
+
 func TestSaveCannotFollowSymlinkOutsideRoot(t *testing.T) {
 	rootPath := configureTestFileRoot(t)
 	outsidePath := filepath.Join(t.TempDir(), "outside.txt")
@@ -0,0 +1,166 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneinstack/core"
+	"oneinstack/internal/models"
+	auditservice "oneinstack/internal/services/audit"
+	monitorservice "oneinstack/internal/services/monitoring"
+	"oneinstack/router/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func AcknowledgeEvent(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	id, ok := parseEventID(c)
+	if !ok {
+		return
+	}
+	username := c.GetString(middleware.ContextUsername)
+	event, err := manager.AcknowledgeEvent(id, username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(c, "告警事件不存在")
+		return
+	}
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	recordAcknowledgement(c, "monitor.alert.acknowledge", event)
+	core.HandleSuccess(c, event)
+}
+
+func UnacknowledgeEvent(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	id, ok := parseEventID(c)
+	if !ok {
+		return
+	}
+	event, err := manager.UnacknowledgeEvent(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(c, "告警事件不存在")
+		return
+	}
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	recordAcknowledgement(c, "monitor.alert.unacknowledge", event)
+	core.HandleSuccess(c, event)
+}
+
+// recordAcknowledgement writes the acknowledging user into the audit chain
+// with the alert it refers to, replacing the generic request audit entry.
+func recordAcknowledgement(c *gin.Context, action string, event *models.MonitorAlertEvent) {
+	manager := auditservice.Default()
+	if manager == nil || event == nil {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	_, err := manager.Append(auditservice.EventInput{
+		RequestID: c.GetString(middleware.ContextRequestID), EventType: "monitoring", Action: action,
+		Method: c.Request.Method, Route: c.FullPath(), Path: c.Request.URL.Path, Status: http.StatusOK,
+		Outcome: "success", Sensitive: true, UserID: userID, Username: c.GetString(middleware.ContextUsername),
+		AuthMode: c.GetString(middleware.ContextAuthMode),
+		RemoteIP: auditservice.RemoteIP(c.Request), UserAgent: c.GetHeader("User-Agent"),
+		Message: fmt.Sprintf("event=%d rule=%d severity=%s %s",
+			event.ID, event.RuleID, event.Severity, event.RuleName),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err == nil {
+		c.Set(middleware.ContextAuditHandled, true)
+	}
+}
+
+func ListEscalationPolicies(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	result, err := manager.ListEscalationPolicies()
+	writeResult(c, result, err)
+}
+
+func CreateEscalationPolicy(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	var input monitorservice.EscalationPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	result, err := manager.CreateEscalationPolicy(input)
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	core.HandleSuccess(c, result)
+}
+
+func UpdateEscalationPolicy(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var input monitorservice.EscalationPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	result, err := manager.UpdateEscalationPolicy(id, input)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(c, "升级策略不存在")
+		return
+	}
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	core.HandleSuccess(c, result)
+}
+
+func DeleteEscalationPolicy(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	err := manager.DeleteEscalationPolicy(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeNotFound(c, "升级策略不存在")
+		return
+	}
+	writeResult(c, gin.H{"deleted": err == nil}, err)
+}
+
+func parseEventID(c *gin.Context) (uint64, bool) {
+	parsed, err := strconv.ParseUint(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || parsed == 0 {
+		writeBadRequest(c, errors.New("ID 必须是正整数"))
+		return 0, false
+	}
+	return parsed, true
+}
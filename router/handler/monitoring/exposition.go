@@ -0,0 +1,55 @@
+package monitoring
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"oneinstack/app"
+	"oneinstack/core"
+	"oneinstack/internal/services/audit"
+	monitorservice "oneinstack/internal/services/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Exposition serves panel and host metrics in the Prometheus text format.
+// It is outside the session-protected API and is only reachable when
+// system.metricsToken is configured; scrapers send it as a bearer token.
+func Exposition(c *gin.Context) {
+	token := app.ONE_CONFIG.System.MetricsToken
+	if token == "" {
+		core.HandleErrorWithStatus(c, http.StatusNotFound, core.NewError(core.ErrNotFound, "指标导出未启用"))
+		return
+	}
+	provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	expected := sha256.Sum256([]byte(token))
+	actual := sha256.Sum256([]byte(strings.TrimSpace(provided)))
+	if !found || subtle.ConstantTimeCompare(expected[:], actual[:]) != 1 {
+		c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+		core.HandleErrorWithStatus(c, http.StatusUnauthorized, core.NewError(core.ErrUnauthorized, "指标导出令牌无效"))
+		return
+	}
+
+	exposition := monitorservice.NewExposition()
+	if manager := monitorservice.Default(); manager != nil {
+		if err := manager.WriteExposition(exposition); err != nil {
+			log.Printf("export monitoring metrics: %v", err)
+		}
+	}
+	monitorservice.WriteTaskQueueExposition(exposition)
+	if manager := audit.Default(); manager != nil {
+		if stats, err := manager.Stats(); err != nil {
+			log.Printf("export audit metrics: %v", err)
+		} else {
+			exposition.Gauge("oneinstack_audit_chain_length",
+				"Sequence number of the audit chain head.", float64(stats.LatestSequence))
+			exposition.Gauge("oneinstack_audit_events_retained",
+				"Audit events still stored after retention cleanup.", float64(stats.Total))
+		}
+	}
+	monitorservice.WriteHTTPExposition(exposition)
+	c.Data(http.StatusOK, monitorservice.ExpositionContentType, exposition.Bytes())
+}
@@ -3,6 +3,7 @@ package monitoring
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -121,7 +122,7 @@ func History(c *gin.Context) {
 		writeBadRequest(c, err)
 		return
 	}
-	from, to, err = resolveHistoryRange(from, to, time.Now().UTC())
+	from, to, err = resolveHistoryRange(from, to, time.Now().UTC(), 366)
 	if err != nil {
 		writeBadRequest(c, err)
 		return
@@ -130,6 +131,49 @@ func History(c *gin.Context) {
 	writeResult(c, result, err)
 }
 
+func Series(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	result, err := manager.ListSeries(strings.TrimSpace(c.Query("metric")))
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	core.HandleSuccess(c, result)
+}
+
+func SeriesHistory(c *gin.Context) {
+	manager, ok := managerOrUnavailable(c)
+	if !ok {
+		return
+	}
+	from, err := optionalTime(c.Query("from"))
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	to, err := optionalTime(c.Query("to"))
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	from, to, err = resolveHistoryRange(from, to, time.Now().UTC(), 31)
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	result, err := manager.SeriesHistory(
+		strings.TrimSpace(c.Query("metric")), strings.TrimSpace(c.Query("resourceId")), from, to,
+	)
+	if err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	writeResult(c, result, nil)
+}
+
 func ListRules(c *gin.Context) {
 	manager, ok := managerOrUnavailable(c)
 	if !ok {
@@ -261,10 +305,21 @@ func Events(c *gin.Context) {
 		writeBadRequest(c, errors.New("severity 无效"))
 		return
 	}
-	if filter.ResourceType != "" && filter.ResourceType != "component_service" {
+	switch filter.ResourceType {
+	case "", "component_service", "certificate", "website", "service", "mount", "backend":
+	default:
 		writeBadRequest(c, errors.New("resourceType 无效"))
 		return
 	}
+	switch strings.TrimSpace(c.Query("acknowledged")) {
+	case "":
+	case "true", "false":
+		acknowledged := c.Query("acknowledged") == "true"
+		filter.Acknowledged = &acknowledged
+	default:
+		writeBadRequest(c, errors.New("acknowledged 必须是 true 或 false"))
+		return
+	}
 	if len(filter.ResourceID) > 64 {
 		writeBadRequest(c, errors.New("resourceId 过长"))
 		return
@@ -407,7 +462,9 @@ func optionalTime(value string) (time.Time, error) {
 	return parsed, nil
 }
 
-func resolveHistoryRange(from, to, now time.Time) (time.Time, time.Time, error) {
+// resolveHistoryRange defaults to the last 24 hours. Host history is served
+// from rollups and may span a year; resource series only keep raw samples.
+func resolveHistoryRange(from, to, now time.Time, maxDays int) (time.Time, time.Time, error) {
 	now = now.UTC().Truncate(time.Second)
 	from = from.UTC().Truncate(time.Second)
 	to = to.UTC().Truncate(time.Second)
@@ -423,8 +480,8 @@ func resolveHistoryRange(from, to, now time.Time) (time.Time, time.Time, error)
 	if to.Before(from) {
 		return time.Time{}, time.Time{}, errors.New("历史样本查询结束时间不能早于开始时间")
 	}
-	if to.Sub(from) > 31*24*time.Hour {
-		return time.Time{}, time.Time{}, errors.New("历史样本查询范围不能超过 31 天")
+	if to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("历史样本查询范围不能超过 %d 天", maxDays)
 	}
 	return from, to, nil
 }
@@ -460,6 +517,10 @@ func monitoringOperationMessage(c *gin.Context) string {
 		return "读取监控指标失败"
 	case "/v1/monitor/history":
 		return "读取监控历史失败"
+	case "/v1/monitor/series":
+		return "读取资源指标失败"
+	case "/v1/monitor/series/history":
+		return "读取资源指标历史失败"
 	case "/v1/monitor/rules":
 		if c.Request.Method == http.MethodDelete {
 			return "删除告警规则失败"
@@ -479,6 +540,14 @@ func monitoringOperationMessage(c *gin.Context) string {
 		return "删除通知通道失败"
 	case "/v1/monitor/channels/:id/test":
 		return "发送测试通知失败"
+	case "/v1/monitor/events/:id/acknowledge":
+		return "确认告警失败"
+	case "/v1/monitor/events/:id/unacknowledge":
+		return "取消确认告警失败"
+	case "/v1/monitor/escalation-policies":
+		return "读取升级策略列表失败"
+	case "/v1/monitor/escalation-policies/:id", "/v1/monitor/escalation-policies/:id/delete":
+		return "删除升级策略失败"
 	default:
 		return "处理监控请求失败"
 	}
@@ -492,6 +561,10 @@ func monitoringParameterMessage(c *gin.Context) string {
 		return "监控指标查询参数无效"
 	case "/v1/monitor/history":
 		return "监控历史查询参数无效"
+	case "/v1/monitor/series":
+		return "资源指标查询参数无效"
+	case "/v1/monitor/series/history":
+		return "资源指标历史查询参数无效"
 	case "/v1/monitor/rules":
 		return "告警规则参数无效"
 	case "/v1/monitor/rules/:id", "/v1/monitor/rules/:id/update":
@@ -506,6 +579,12 @@ func monitoringParameterMessage(c *gin.Context) string {
 		return "通知通道参数无效"
 	case "/v1/monitor/channels/:id", "/v1/monitor/channels/:id/update":
 		return "通知通道更新参数无效"
+	case "/v1/monitor/events/:id/acknowledge", "/v1/monitor/events/:id/unacknowledge":
+		return "告警确认参数无效"
+	case "/v1/monitor/escalation-policies":
+		return "升级策略参数无效"
+	case "/v1/monitor/escalation-policies/:id", "/v1/monitor/escalation-policies/:id/update":
+		return "升级策略更新参数无效"
 	default:
 		return "监控请求参数无效"
 	}
@@ -23,6 +23,7 @@ import (
 	previewservice "oneinstack/internal/services/operationpreview"
 	safeservice "oneinstack/internal/services/safe"
 	softwareService "oneinstack/internal/services/software"
+	storageService "oneinstack/internal/services/storage"
 	systemservice "oneinstack/internal/services/system"
 	"oneinstack/internal/services/website"
 	"oneinstack/router/handler/software"
@@ -189,7 +190,9 @@ func Preview(c *gin.Context) {
 		if handleWebsitePreviewError(c, operation, err) {
 			return
 		}
-		if errors.Is(err, safeservice.ErrValidation) {
+		if message, ok := mysqlAccountErrorMessage(err); ok {
+			core.HandleError(c, core.NewErrorWithDetail(core.ErrInvalidParameter, message, err.Error()))
+		} else if errors.Is(err, safeservice.ErrValidation) {
 			message := safeservice.ValidationMessage(err)
 			if message == "" {
 				message = "防火墙参数无效"
@@ -365,6 +368,15 @@ func Execute(c *gin.Context) {
 }
 
 func validatePreviewTarget(operation, resourceVersion string) error {
+	if strings.HasPrefix(resourceVersion, "mysql-account|") {
+		if operation != "database.mysql_account.change" {
+			return previewservice.ErrRequestChanged
+		}
+		if err := storageService.ValidateMySQLAccountVersion(resourceVersion); err != nil {
+			return previewservice.ErrRequestChanged
+		}
+		return nil
+	}
 	if strings.HasPrefix(resourceVersion, "website|") {
 		parts := strings.Split(resourceVersion, "|")
 		if len(parts) != 3 || !strings.HasPrefix(parts[1], "id=") || !strings.HasPrefix(parts[2], "revision=") {
@@ -692,10 +704,69 @@ func buildDocument(operation string, payload json.RawMessage) (previewservice.Do
 		document.Actions = []previewservice.Action{{Type: "firewall", Name: "通过受管 Fail2ban jail 处置单个 IP", DisplayCommand: "fail2ban-client set <managed-jail> banip|unbanip <ip>"}}
 		document.Impact = previewservice.Impact{ModifyDatabase: true, NetworkRisk: true}
 		document.Rollback = previewservice.Rollback{Supported: true, Summary: "可通过对应的解封或重新封禁任务恢复"}
+	case "database.mysql_account.change":
+		var value storageService.MySQLAccountChange
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return previewservice.Document{}, "", err
+		}
+		plan, err := storageService.PlanMySQLAccountChange(&value)
+		if err != nil {
+			return previewservice.Document{}, "", err
+		}
+		return mysqlAccountDocument(document, &value, plan), plan.Version, nil
 	}
 	return document, "", nil
 }
 
+func mysqlAccountDocument(
+	document previewservice.Document,
+	change *storageService.MySQLAccountChange,
+	plan *storageService.MySQLAccountPlan,
+) previewservice.Document {
+	action, summary := "update", "调整账号的权限和资源限制"
+	switch {
+	case change.Action == "delete":
+		action, summary = "delete", "删除账号及其全部权限"
+	case plan.Before == nil:
+		action, summary = "create", "创建账号并授予权限"
+	}
+	if len(plan.Steps) == 0 {
+		summary = "账号已是目标状态，无需修改"
+	}
+	document.Files = []previewservice.FileChange{{
+		Path:          fmt.Sprintf("MySQL 账号 '%s'@'%s'", change.User, change.Host),
+		Action:        action,
+		ChangeSummary: summary,
+		Diff:          boundedConfigDiff(storageService.RenderMySQLAccount(plan.Before), storageService.RenderMySQLAccount(plan.After)),
+	}}
+	document.Actions = make([]previewservice.Action, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		document.Actions = append(document.Actions, previewservice.Action{Type: "database", Name: step.Summary, DisplayCommand: step.Statement})
+	}
+	document.Prechecks = []previewservice.Precheck{{Name: "账号当前状态", Status: "passed", Message: "执行前将重新读取账号并确认与预览一致"}}
+	document.Impact = previewservice.Impact{ModifyDatabase: true}
+	document.Rollback = previewservice.Rollback{
+		Supported: false,
+		Summary:   "MySQL 账号语句不支持事务；新建账号在后续步骤失败时会被删除，其余已执行的步骤需要再次预览修改",
+	}
+	if change.Action == "delete" {
+		document.Rollback.Unrecoverable = []string{"已删除账号的密码"}
+	}
+	return document
+}
+
+func mysqlAccountErrorMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, storageService.ErrMySQLAccountInvalid):
+		return "MySQL 账号参数无效", true
+	case errors.Is(err, storageService.ErrMySQLAccountProtected):
+		return "该账号为系统账号或由数据库凭据管理，不能在此修改", true
+	case errors.Is(err, storageService.ErrMySQLAccountNotFound):
+		return "MySQL 账号不存在，请刷新后重试", true
+	}
+	return "", false
+}
+
 func normalizeWebsiteCreatePayload(payload json.RawMessage) (json.RawMessage, error) {
 	var value models.Website
 	if err := json.Unmarshal(payload, &value); err != nil {
@@ -1116,6 +1187,16 @@ func executeOperation(ctx context.Context, operation string, payload json.RawMes
 			return nil, err
 		}
 		return gin.H(fail2banservice.TaskResult(task)), nil
+	case "database.mysql_account.change":
+		var value storageService.MySQLAccountChange
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return nil, err
+		}
+		plan, err := storageService.ApplyMySQLAccountChange(&value, "")
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"operation": operation, "account": plan.After, "applied": len(plan.Steps), "status": "succeeded"}, nil
 	default:
 		return nil, fmt.Errorf("unsupported operation %s", operation)
 	}
@@ -1321,6 +1402,13 @@ func writeExecutionError(c *gin.Context, err error) {
 		code, message = core.ErrInsufficientPermissions, "该地址属于系统保护范围，不能封禁"
 	case errors.Is(err, fail2banservice.ErrUnavailable):
 		code, message = core.ErrServiceUnavailable, "Fail2ban 未安装、未验证或服务不可用"
+	case errors.Is(err, storageService.ErrMySQLAccountChanged):
+		code, message = core.ErrConflict, "MySQL 账号已发生变化，请重新预览后再执行"
+		detail = ""
+	default:
+		if accountMessage, ok := mysqlAccountErrorMessage(err); ok {
+			code, message = core.ErrInvalidParameter, accountMessage
+		}
 	}
 	if detail == "" {
 		core.HandleError(c, core.NewError(code, message))
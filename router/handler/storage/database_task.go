@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"oneinstack/app"
 	"oneinstack/core"
@@ -28,9 +29,11 @@ import (
 const ApprovalActionDatabaseRestore = "database.restore"
 
 type RestoreApprovalPayload struct {
-	LibraryID   int64  `json:"libraryId"`
-	BackupID    string `json:"backupId"`
-	ConfirmName string `json:"confirmName"`
+	LibraryID   int64      `json:"libraryId"`
+	BackupID    string     `json:"backupId"`
+	ConfirmName string     `json:"confirmName"`
+	StopAt      *time.Time `json:"stopAt,omitempty"`
+	StopGTID    string     `json:"stopGtid,omitempty"`
 }
 
 var (
@@ -59,7 +62,7 @@ func getDatabaseTaskManager() (*databasetask.Manager, error) {
 			database,
 			backupRoot,
 			logRoot,
-			storageService.NewMySQLDatabaseOperator(),
+			storageService.NewDatabaseOperator(),
 		)
 		databaseTaskManagerDB = database
 	}
@@ -125,6 +128,8 @@ func RestoreDatabaseBackup(c *gin.Context) {
 				LibraryID:   req.LibraryID,
 				BackupID:    req.BackupID,
 				ConfirmName: req.ConfirmName,
+				StopAt:      req.StopAt,
+				StopGTID:    req.StopGTID,
 			},
 		)
 		if err != nil {
@@ -138,7 +143,9 @@ func RestoreDatabaseBackup(c *gin.Context) {
 		}))
 		return
 	}
-	task, err := manager.SubmitRestore(req.LibraryID, req.BackupID, userID)
+	task, err := manager.SubmitRestore(req.LibraryID, req.BackupID, databasetask.RecoveryTarget{
+		StopAt: req.StopAt, StopGTID: req.StopGTID,
+	}, userID)
 	if err != nil {
 		handleDatabaseTaskError(c, err, "创建数据库恢复任务失败")
 		return
@@ -284,6 +291,21 @@ func DownloadDatabaseBackup(c *gin.Context) {
 	http.ServeContent(c.Writer, c.Request, backup.FileName, info.ModTime(), file)
 }
 
+// GetDatabaseBackupRecoveryWindow reports the latest point a backup can be
+// restored to with the binary logs archived so far.
+func GetDatabaseBackupRecoveryWindow(c *gin.Context) {
+	manager, ok := databaseManagerForRequest(c)
+	if !ok {
+		return
+	}
+	window, err := manager.RecoveryWindow(c.Param("id"))
+	if err != nil {
+		handleDatabaseTaskError(c, err, "该备份不支持时间点恢复")
+		return
+	}
+	core.HandleSuccess(c, window)
+}
+
 func DeleteDatabaseBackup(c *gin.Context) {
 	var req input.DeleteDatabaseBackupParam
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -310,6 +332,90 @@ func DeleteDatabaseBackup(c *gin.Context) {
 	core.HandleSuccess(c, nil)
 }
 
+func ListDatabaseBackupSchedules(c *gin.Context) {
+	manager, ok := databaseManagerForRequest(c)
+	if !ok {
+		return
+	}
+	schedules, err := manager.ListSchedules()
+	if err != nil {
+		handleDatabaseTaskError(c, err, "读取数据库备份计划失败")
+		return
+	}
+	core.HandleSuccess(c, schedules)
+}
+
+func GetDatabaseBackupSchedule(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := databaseManagerForRequest(c)
+	if !ok {
+		return
+	}
+	schedule, err := manager.GetSchedule(libraryID)
+	if err != nil {
+		handleDatabaseTaskError(c, err, "该数据库未配置备份计划")
+		return
+	}
+	core.HandleSuccess(c, schedule)
+}
+
+// SaveDatabaseBackupSchedule creates or replaces the backup schedule of a
+// database. Scheduled backups run as the user who saved the schedule.
+func SaveDatabaseBackupSchedule(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	var req input.DatabaseBackupScheduleParam
+	if err := c.ShouldBindJSON(&req); err != nil {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "请填写备份计划和保留策略"))
+		return
+	}
+	manager, ok := databaseManagerForRequest(c)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	schedule, err := manager.SaveSchedule(libraryID, databasetask.ScheduleInput{
+		Enabled: req.Enabled, Schedule: req.Schedule,
+		KeepDaily: req.KeepDaily, KeepWeekly: req.KeepWeekly, KeepMonthly: req.KeepMonthly,
+		NotifyOnFailure: req.NotifyOnFailure,
+	}, userID)
+	if err != nil {
+		handleDatabaseTaskError(c, err, "保存数据库备份计划失败")
+		return
+	}
+	core.HandleSuccess(c, schedule)
+}
+
+func DeleteDatabaseBackupSchedule(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := databaseManagerForRequest(c)
+	if !ok {
+		return
+	}
+	if err := manager.DeleteSchedule(libraryID); err != nil {
+		handleDatabaseTaskError(c, err, "删除数据库备份计划失败")
+		return
+	}
+	core.HandleSuccess(c, nil)
+}
+
+func libraryIDParam(c *gin.Context) (int64, bool) {
+	libraryID, err := parseLibraryID(c)
+	if err != nil || libraryID <= 0 {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "数据库标识无效"))
+		return 0, false
+	}
+	return libraryID, true
+}
+
 func databaseManagerForRequest(c *gin.Context) (*databasetask.Manager, bool) {
 	manager, err := getDatabaseTaskManager()
 	if err != nil {
@@ -379,7 +485,9 @@ func ExecuteRestoreApproval(payload RestoreApprovalPayload, requestedBy int64) (
 	if err != nil {
 		return nil, err
 	}
-	return manager.SubmitRestore(payload.LibraryID, payload.BackupID, requestedBy)
+	return manager.SubmitRestore(payload.LibraryID, payload.BackupID, databasetask.RecoveryTarget{
+		StopAt: payload.StopAt, StopGTID: payload.StopGTID,
+	}, requestedBy)
 }
 
 // Keep context imported in this package's public startup surface so callers
@@ -238,6 +238,27 @@ func GetRedisKeys(c *gin.Context) {
 	core.HandleSuccess(c, data)
 }
 
+// ListMySQLAccounts returns the accounts of a MySQL connection with their
+// database grants and limits. Changes go through the operation preview as
+// database.mysql_account.change.
+func ListMySQLAccounts(c *gin.Context) {
+	id, err := parseLibraryID(c)
+	if err != nil || id <= 0 {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "数据库连接标识无效"))
+		return
+	}
+	accounts, err := storage.ListMySQLAccounts(id)
+	if err != nil {
+		code, message := core.ErrInternalError, "读取 MySQL 账号失败"
+		if errors.Is(err, storage.ErrMySQLAccountInvalid) {
+			code, message = core.ErrBadRequest, "该连接不是 MySQL 连接"
+		}
+		core.HandleError(c, core.WrapError(err, code, message))
+		return
+	}
+	core.HandleSuccess(c, accounts)
+}
+
 func Info(c *gin.Context) {
 	mysqlInstall, redisInstall := storage.CheckStorage()
 	core.HandleSuccess(c, map[string]interface{}{"mysql": mysqlInstall, "redis": redisInstall})
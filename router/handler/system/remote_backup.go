@@ -0,0 +1,251 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"oneinstack/core"
+	"oneinstack/internal/services/remotebackup"
+	"oneinstack/router/middleware"
+)
+
+func ListRemoteBackupTargets(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	targets, err := manager.ListTargets()
+	if err != nil {
+		handleRemoteBackupError(c, err, "读取远程备份目标失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"targets": targets})
+}
+
+func CreateRemoteBackupTarget(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	var input remotebackup.TargetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "远程备份目标参数无效"))
+		return
+	}
+	target, err := manager.CreateTarget(input)
+	input.Secret = ""
+	if err != nil {
+		core.HandleError(c, core.NewErrorWithDetail(core.ErrBadRequest, "远程备份目标配置无效", err.Error()))
+		return
+	}
+	core.HandleSuccess(c, target)
+}
+
+func UpdateRemoteBackupTarget(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	var input remotebackup.TargetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "远程备份目标参数无效"))
+		return
+	}
+	target, err := manager.UpdateTarget(id, input)
+	input.Secret = ""
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleRemoteBackupError(c, err, "远程备份目标不存在")
+		return
+	}
+	if err != nil {
+		core.HandleError(c, core.NewErrorWithDetail(core.ErrBadRequest, "远程备份目标配置无效", err.Error()))
+		return
+	}
+	core.HandleSuccess(c, target)
+}
+
+func DeleteRemoteBackupTarget(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	if err := manager.DeleteTarget(id); err != nil {
+		handleRemoteBackupError(c, err, "删除远程备份目标失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"deleted": true})
+}
+
+func TestRemoteBackupTarget(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	err := manager.TestTarget(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handleRemoteBackupError(c, err, "远程备份目标不存在")
+		return
+	}
+	if err != nil {
+		core.HandleError(c, core.NewErrorWithDetail(core.ErrBadRequest, "远程备份目标连接测试失败", err.Error()))
+		return
+	}
+	core.HandleSuccess(c, gin.H{"reachable": true})
+}
+
+func SyncRemoteBackupTarget(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+	result, err := manager.SyncTarget(ctx, id)
+	if err != nil {
+		handleRemoteBackupError(c, err, "同步远程备份失败")
+		return
+	}
+	core.HandleSuccess(c, result)
+}
+
+func ListRemoteBackups(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	backups, err := manager.ListRemote(ctx, id)
+	if err != nil {
+		handleRemoteBackupError(c, err, "读取远程备份失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"backups": backups})
+}
+
+func UploadRemoteBackup(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Kind     string `json:"kind" binding:"required"`
+		BackupID string `json:"backupId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "请选择要上传的备份"))
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	transfer, err := manager.SubmitUpload(id, strings.TrimSpace(request.Kind), request.BackupID, userID)
+	if err != nil {
+		handleRemoteBackupError(c, err, "创建远程备份上传任务失败")
+		return
+	}
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, transfer))
+}
+
+func RestoreRemoteBackup(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	id, ok := remoteBackupTargetID(c)
+	if !ok {
+		return
+	}
+	var input remotebackup.RestoreInput
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Key) == "" {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "请选择要取回的远程备份"))
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	transfer, err := manager.RestoreFromRemote(id, input, userID)
+	input.Passphrase = ""
+	if err != nil {
+		handleRemoteBackupError(c, err, "创建远程备份取回任务失败")
+		return
+	}
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, transfer))
+}
+
+func ListRemoteBackupTransfers(c *gin.Context) {
+	manager, ok := remoteBackupManagerForRequest(c)
+	if !ok {
+		return
+	}
+	targetID, _ := strconv.ParseInt(c.Query("targetId"), 10, 64)
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	transfers, err := manager.ListTransfers(targetID, page, pageSize)
+	if err != nil {
+		handleRemoteBackupError(c, err, "读取远程备份传输记录失败")
+		return
+	}
+	core.HandleSuccess(c, transfers)
+}
+
+func remoteBackupManagerForRequest(c *gin.Context) (*remotebackup.Manager, bool) {
+	manager := remotebackup.Default()
+	if manager == nil {
+		core.HandleErrorWithStatus(c, http.StatusServiceUnavailable,
+			core.NewError(core.ErrServiceUnavailable, "远程备份服务不可用，请稍后重试"))
+		return nil, false
+	}
+	return manager, true
+}
+
+func remoteBackupTargetID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "远程备份目标标识无效"))
+		return 0, false
+	}
+	return id, true
+}
+
+func handleRemoteBackupError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "远程备份目标或备份不存在"))
+	case errors.Is(err, remotebackup.ErrObjectNotFound):
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "远程备份不存在"))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "操作已取消或超时"))
+	default:
+		core.HandleError(c, core.NewErrorWithDetail(core.ErrBadRequest, message, err.Error()))
+	}
+}
@@ -0,0 +1,90 @@
+package website
+
+import (
+	"errors"
+	"strconv"
+
+	"oneinstack/core"
+	websiteService "oneinstack/internal/services/website"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetWebsiteAnalytics(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	analytics, err := service.TrafficAnalytics(id, analyticsQuery(c))
+	if err != nil {
+		handleAnalyticsError(c, err)
+		return
+	}
+	core.HandleSuccess(c, analytics)
+}
+
+func GetWebsiteAnalyticsHourly(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	hours, err := service.TrafficHours(id, analyticsQuery(c))
+	if err != nil {
+		handleAnalyticsError(c, err)
+		return
+	}
+	core.HandleSuccess(c, hours)
+}
+
+func GetWebsiteAnalyticsTop(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	entries, err := service.TrafficTop(id, c.Param("dimension"), analyticsQuery(c))
+	if err != nil {
+		handleAnalyticsError(c, err)
+		return
+	}
+	core.HandleSuccess(c, entries)
+}
+
+// websiteServiceForRequest resolves the website service or answers the
+// request with a configuration error.
+func websiteServiceForRequest(c *gin.Context) (*websiteService.Service, bool) {
+	service, err := websiteService.DefaultService()
+	if err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, "网站服务不可用"))
+		return nil, false
+	}
+	return service, true
+}
+
+func analyticsQuery(c *gin.Context) websiteService.TrafficAnalyticsQuery {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	return websiteService.TrafficAnalyticsQuery{From: c.Query("from"), To: c.Query("to"), Limit: limit}
+}
+
+func handleAnalyticsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "网站不存在"))
+	case errors.Is(err, websiteService.ErrWebsiteParameterInvalid):
+		core.HandleError(c, core.WrapError(err, core.ErrInvalidParameter, "访问统计查询参数无效"))
+	default:
+		core.HandleError(c, core.WrapError(err, core.ErrInternalError, "读取访问统计失败"))
+	}
+}
@@ -40,10 +40,14 @@ type CertificateIssueApprovalPayload struct {
 	AutoRenew       *bool  `json:"autoRenew"`
 	RenewBeforeDays int    `json:"renewBeforeDays"`
 	ForceHTTPS      bool   `json:"forceHttps"`
+	ChallengeType   string `json:"challengeType,omitempty"`
+	DNSAccountID    string `json:"dnsAccountId,omitempty"`
+	ACMEAccountID   string `json:"acmeAccountId,omitempty"`
 }
 
 type CertificateRenewApprovalPayload struct {
 	CertificateID string `json:"certificateId"`
+	ACMEAccountID string `json:"acmeAccountId,omitempty"`
 }
 
 type CertificateDisableApprovalPayload struct {
@@ -148,6 +152,9 @@ func ExecuteCertificateApproval(service *approvalservice.Service, request *model
 			RenewBeforeDays: payload.RenewBeforeDays,
 			ForceHTTPS:      payload.ForceHTTPS,
 			RequestedBy:     request.RequestedBy,
+			ChallengeType:   payload.ChallengeType,
+			DNSAccountID:    payload.DNSAccountID,
+			ACMEAccountID:   payload.ACMEAccountID,
 		})
 		if err != nil {
 			return err
@@ -158,7 +165,10 @@ func ExecuteCertificateApproval(service *approvalservice.Service, request *model
 		if err := json.Unmarshal([]byte(request.PayloadSnapshot), &payload); err != nil {
 			return err
 		}
-		task, err := manager.SubmitRenew(payload.CertificateID, request.RequestedBy)
+		task, err := manager.SubmitRenewWithOptions(payload.CertificateID, certificateService.RenewOptions{
+			ACMEAccountID: payload.ACMEAccountID,
+			RequestedBy:   request.RequestedBy,
+		})
 		if err != nil {
 			return err
 		}
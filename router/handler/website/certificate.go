@@ -83,6 +83,9 @@ func IssueCertificate(c *gin.Context) {
 			AutoRenew:       request.AutoRenew,
 			RenewBeforeDays: request.RenewBeforeDays,
 			ForceHTTPS:      request.ForceHTTPS,
+			ChallengeType:   request.ChallengeType,
+			DNSAccountID:    request.DNSAccountID,
+			ACMEAccountID:   request.ACMEAccountID,
 		})
 		if err != nil {
 			core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "创建证书签发审批失败"))
@@ -102,6 +105,9 @@ func IssueCertificate(c *gin.Context) {
 		RenewBeforeDays: request.RenewBeforeDays,
 		ForceHTTPS:      request.ForceHTTPS,
 		RequestedBy:     userID,
+		ChallengeType:   request.ChallengeType,
+		DNSAccountID:    request.DNSAccountID,
+		ACMEAccountID:   request.ACMEAccountID,
 	})
 	if err != nil {
 		handleCertificateError(c, err, "创建证书签发任务失败")
@@ -133,6 +139,14 @@ func GetCertificate(c *gin.Context) {
 }
 
 func RenewCertificate(c *gin.Context) {
+	// The body is optional; it only selects another CA profile for this renewal.
+	var request input.CertificateRenewParam
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			core.HandleError(c, core.NewError(core.ErrBadRequest, "证书续签参数格式不正确"))
+			return
+		}
+	}
 	manager, ok := certificateManagerForRequest(c)
 	if !ok {
 		return
@@ -141,6 +155,7 @@ func RenewCertificate(c *gin.Context) {
 	if shouldRequestWebsiteApproval(c) {
 		approval, err := createWebsiteApproval(c, ApprovalActionCertificateRenew, "", c.Param("id"), CertificateRenewApprovalPayload{
 			CertificateID: c.Param("id"),
+			ACMEAccountID: request.ACMEAccountID,
 		})
 		if err != nil {
 			core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "创建证书续签审批失败"))
@@ -153,7 +168,10 @@ func RenewCertificate(c *gin.Context) {
 		}))
 		return
 	}
-	task, err := manager.SubmitRenew(c.Param("id"), userID)
+	task, err := manager.SubmitRenewWithOptions(c.Param("id"), certificateService.RenewOptions{
+		ACMEAccountID: request.ACMEAccountID,
+		RequestedBy:   userID,
+	})
 	if err != nil {
 		handleCertificateError(c, err, "创建证书续签任务失败")
 		return
@@ -0,0 +1,160 @@
+package website
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"oneinstack/core"
+	auditservice "oneinstack/internal/services/audit"
+	"oneinstack/internal/services/websitetask"
+	"oneinstack/router/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDeployWebhookBody = 1 << 20
+
+func GetWebsiteDeploySource(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	source, err := manager.GetDeploySource(id)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "读取 Git 部署源失败")
+		return
+	}
+	core.HandleSuccess(c, source)
+}
+
+func SaveWebsiteDeploySource(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request websitetask.DeploySourceInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "Git 部署源参数格式不正确"))
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	result, err := manager.SaveDeploySource(id, request, userID)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "保存 Git 部署源失败")
+		return
+	}
+	appendDeployAudit(c, "website.deploy.source.save", userID, http.StatusOK,
+		fmt.Sprintf("website=%d repo=%s branch=%s", id, result.RepoURL, result.Branch))
+	core.HandleSuccess(c, result)
+}
+
+func DeleteWebsiteDeploySource(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	if err := manager.DeleteDeploySource(id); err != nil {
+		handleWebsiteTaskError(c, err, "删除 Git 部署源失败")
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	appendDeployAudit(c, "website.deploy.source.delete", userID, http.StatusOK, fmt.Sprintf("website=%d", id))
+	core.HandleSuccess(c, nil)
+}
+
+func DeployWebsite(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	task, err := manager.SubmitDeploy(id, userID)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "创建 Git 部署任务失败")
+		return
+	}
+	appendDeployAudit(c, "website.deploy.submit", userID, http.StatusAccepted,
+		fmt.Sprintf("website=%d task=%s", id, task.ID))
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, task))
+}
+
+// WebsiteDeployWebhook is the unauthenticated push endpoint for Git hosts;
+// requests are authenticated by the HMAC signature of the body.
+func WebsiteDeployWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		core.HandleError(c, core.NewFieldError(core.ErrInvalidParameter, "id 必须是正整数", "id"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxDeployWebhookBody+1))
+	if err != nil || len(body) > maxDeployWebhookBody {
+		core.HandleError(c, core.NewError(core.ErrBadRequest, "Webhook 请求体过大或无法读取"))
+		return
+	}
+	signature := c.GetHeader("X-Hub-Signature-256")
+	for _, header := range []string{"X-Gitea-Signature", "X-Gogs-Signature"} {
+		if strings.TrimSpace(signature) == "" {
+			signature = c.GetHeader(header)
+		}
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	task, err := manager.HandleDeployWebhook(id, signature, body)
+	switch {
+	case errors.Is(err, websitetask.ErrDeployWebhookUnauthorized) || websitetask.IsNotFound(err):
+		// Unknown sites and bad signatures look the same to the caller.
+		core.HandleError(c, core.NewError(core.ErrUnauthorized, "Webhook 签名无效"))
+		return
+	case err != nil:
+		handleWebsiteTaskError(c, err, "处理 Git 推送事件失败")
+		return
+	case task == nil:
+		core.HandleSuccess(c, gin.H{"ignored": true})
+		return
+	}
+	appendDeployAudit(c, "website.deploy.webhook", task.RequestedBy, http.StatusAccepted,
+		fmt.Sprintf("website=%d task=%s", id, task.ID))
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, task))
+}
+
+func appendDeployAudit(c *gin.Context, action string, userID int64, status int, message string) {
+	audit := auditservice.Default()
+	if audit == nil {
+		return
+	}
+	_, _ = audit.Append(auditservice.EventInput{
+		EventType: "website",
+		Action:    action,
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Path:      c.Request.URL.Path,
+		Status:    status,
+		Outcome:   "success",
+		Sensitive: true,
+		UserID:    userID,
+		RemoteIP:  auditservice.RemoteIP(c.Request),
+		Message:   message,
+	})
+}
@@ -0,0 +1,80 @@
+package website
+
+import (
+	"errors"
+
+	"oneinstack/core"
+	"oneinstack/router/input"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetWebsiteIsolation(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request input.WebsiteIsolationParam
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "网站隔离参数格式不正确"))
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	document, err := service.SetIsolation(c.Request.Context(), id, request.Enabled)
+	if err != nil {
+		handleIsolationError(c, err, "更新网站系统用户隔离失败")
+		return
+	}
+	core.HandleSuccess(c, document)
+}
+
+func GetWebsiteAssignments(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	userIDs, err := service.Assignments(id)
+	if err != nil {
+		handleIsolationError(c, err, "读取网站授权用户失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"userIds": userIDs})
+}
+
+func UpdateWebsiteAssignments(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request input.WebsiteAssignmentParam
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "网站授权参数格式不正确"))
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	userIDs, err := service.SetAssignments(id, request.UserIDs)
+	if err != nil {
+		handleIsolationError(c, err, "更新网站授权用户失败")
+		return
+	}
+	core.HandleSuccess(c, gin.H{"userIds": userIDs})
+}
+
+func handleIsolationError(c *gin.Context, err error, message string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "网站不存在"))
+		return
+	}
+	core.HandleError(c, core.WrapError(err, core.ErrConfigError, message))
+}
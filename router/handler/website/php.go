@@ -0,0 +1,50 @@
+package website
+
+import (
+	"errors"
+
+	"oneinstack/core"
+	"oneinstack/router/input"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ListPHPRuntimes(c *gin.Context) {
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	runtimes, err := service.PHPRuntimes()
+	if err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, "读取 PHP 版本失败"))
+		return
+	}
+	core.HandleSuccess(c, runtimes)
+}
+
+func SwitchWebsitePHPVersion(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request input.WebsitePHPVersionParam
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "PHP 版本参数格式不正确"))
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	document, err := service.SwitchPHPVersion(c.Request.Context(), id, request.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			core.HandleError(c, core.WrapError(err, core.ErrNotFound, "网站不存在"))
+			return
+		}
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, "切换 PHP 版本失败"))
+		return
+	}
+	core.HandleSuccess(c, document)
+}
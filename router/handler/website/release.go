@@ -0,0 +1,132 @@
+package website
+
+import (
+	"errors"
+	"strconv"
+
+	"oneinstack/core"
+	websiteService "oneinstack/internal/services/website"
+	"oneinstack/router/input"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ListWebsiteReleases(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := releaseService(c)
+	if !ok {
+		return
+	}
+	releases, err := service.ListReleases(id)
+	if err != nil {
+		handleReleaseError(c, err, "读取发布版本失败")
+		return
+	}
+	core.HandleSuccess(c, releases)
+}
+
+func CreateWebsiteRelease(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request websiteService.ReleaseInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "发布版本参数格式不正确"))
+		return
+	}
+	service, ok := releaseService(c)
+	if !ok {
+		return
+	}
+	release, err := service.CreateRelease(c.Request.Context(), id, request)
+	if err != nil {
+		handleReleaseError(c, err, "创建发布版本失败")
+		return
+	}
+	core.HandleSuccess(c, release)
+}
+
+func ActivateWebsiteRelease(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	releaseID, err := strconv.ParseInt(c.Param("releaseId"), 10, 64)
+	if err != nil || releaseID <= 0 {
+		core.HandleError(c, core.NewFieldError(core.ErrInvalidParameter, "releaseId 必须是正整数", "releaseId"))
+		return
+	}
+	service, ok := releaseService(c)
+	if !ok {
+		return
+	}
+	release, err := service.ActivateRelease(c.Request.Context(), id, releaseID)
+	if err != nil {
+		handleReleaseError(c, err, "切换发布版本失败")
+		return
+	}
+	core.HandleSuccess(c, release)
+}
+
+func RollbackWebsiteRelease(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, ok := releaseService(c)
+	if !ok {
+		return
+	}
+	release, err := service.RollbackRelease(c.Request.Context(), id)
+	if err != nil {
+		handleReleaseError(c, err, "回滚发布版本失败")
+		return
+	}
+	core.HandleSuccess(c, release)
+}
+
+func UpdateWebsiteCanary(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request input.WebsiteCanaryParam
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "灰度发布参数格式不正确"))
+		return
+	}
+	service, ok := releaseService(c)
+	if !ok {
+		return
+	}
+	if err := service.SetCanary(c.Request.Context(), id, request.ReleaseID, request.Percent); err != nil {
+		handleReleaseError(c, err, "更新灰度发布失败")
+		return
+	}
+	core.HandleSuccess(c, request)
+}
+
+func releaseService(c *gin.Context) (*websiteService.Service, bool) {
+	service, err := websiteService.DefaultService()
+	if err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, "网站服务不可用"))
+		return nil, false
+	}
+	return service, true
+}
+
+func handleReleaseError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "网站或发布版本不存在"))
+	case errors.Is(err, websiteService.ErrWebsiteReleaseInvalid), errors.Is(err, websiteService.ErrWebsiteConflict):
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, message))
+	default:
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, message))
+	}
+}
@@ -34,6 +34,24 @@ func GetWebsiteSettings(c *gin.Context) {
 	core.HandleSuccess(c, document)
 }
 
+func GetWebsiteBackendHealth(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	service, err := websiteService.DefaultService()
+	if err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrConfigError, "网站服务不可用"))
+		return
+	}
+	rows, err := service.ListBackendHealth(id)
+	if err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrInternalError, "读取上游后端健康状态失败"))
+		return
+	}
+	core.HandleSuccess(c, rows)
+}
+
 func UpdateWebsiteSettings(c *gin.Context) {
 	if !rejectDirectMutation(c, "website.settings.update") {
 		return
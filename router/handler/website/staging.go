@@ -0,0 +1,79 @@
+package website
+
+import (
+	"fmt"
+	"net/http"
+
+	"oneinstack/core"
+	"oneinstack/internal/services/websitetask"
+	"oneinstack/router/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CloneWebsite(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request websitetask.CloneInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "网站克隆参数格式不正确"))
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	task, err := manager.SubmitClone(id, request, userID)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "创建网站克隆任务失败")
+		return
+	}
+	appendDeployAudit(c, "website.clone.submit", userID, http.StatusAccepted,
+		fmt.Sprintf("website=%d staging=%s task=%s", id, task.StagingDomain, task.ID))
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, task))
+}
+
+func GetWebsiteStaging(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	staging, err := manager.GetStaging(id)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "读取预发布站点信息失败")
+		return
+	}
+	core.HandleSuccess(c, staging)
+}
+
+func PushWebsiteStaging(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	var request websitetask.PushInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		core.HandleError(c, core.WrapError(err, core.ErrBadRequest, "预发布推送参数格式不正确"))
+		return
+	}
+	manager, ok := websiteManagerForRequest(c)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.AuthenticatedUserID(c)
+	task, err := manager.SubmitPush(id, request, userID)
+	if err != nil {
+		handleWebsiteTaskError(c, err, "创建预发布推送任务失败")
+		return
+	}
+	appendDeployAudit(c, "website.staging.push", userID, http.StatusAccepted,
+		fmt.Sprintf("staging=%d website=%d database=%t task=%s", id, task.WebsiteID, request.Database, task.ID))
+	c.JSON(http.StatusAccepted, core.SuccessResponseForContext(c, task))
+}
@@ -0,0 +1,46 @@
+package website
+
+import (
+	"errors"
+	"strconv"
+
+	"oneinstack/core"
+	websiteService "oneinstack/internal/services/website"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ListWebsiteWAFRules(c *gin.Context) {
+	core.HandleSuccess(c, websiteService.WAFRuleGroups())
+}
+
+func GetWebsiteWAFHits(c *gin.Context) {
+	id, ok := websiteIDParam(c)
+	if !ok {
+		return
+	}
+	lineLimit, err := strconv.Atoi(c.DefaultQuery("lines", "200"))
+	if err != nil || lineLimit < 1 || lineLimit > 2000 {
+		core.HandleError(c, core.NewFieldError(core.ErrInvalidParameter, "lines 必须是 1 到 2000 之间的整数", "lines"))
+		return
+	}
+	service, ok := websiteServiceForRequest(c)
+	if !ok {
+		return
+	}
+	hits, err := service.ListWAFHits(id, lineLimit)
+	if err != nil {
+		handleWAFError(c, err)
+		return
+	}
+	core.HandleSuccess(c, hits)
+}
+
+func handleWAFError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		core.HandleError(c, core.WrapError(err, core.ErrNotFound, "网站不存在"))
+		return
+	}
+	core.HandleError(c, core.WrapError(err, core.ErrInternalError, "读取防火墙拦截日志失败"))
+}
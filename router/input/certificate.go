@@ -28,6 +28,18 @@ type CertificateBindingParam struct {
 	ForceHTTPS bool  `json:"forceHttps"`
 }
 
+type ACMEAccountParam struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Provider     string `json:"provider"`
+	DirectoryURL string `json:"directoryUrl"`
+	Email        string `json:"email"`
+	EABKeyID     string `json:"eabKeyId"`
+	EABHMACKey   string `json:"eabHmacKey"`
+	CABundle     string `json:"caBundle"`
+	Enabled      *bool  `json:"enabled"`
+}
+
 type DNSAccountParam struct {
 	ID            string `json:"id"`
 	Name          string `json:"name"`
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type QueryParam struct {
@@ -165,6 +166,9 @@ func validateConnectionPassword(password, storageType string, update bool) error
 	if strings.TrimSpace(password) == "" && storageType == "mysql" && !update {
 		return fmt.Errorf("MySQL password cannot be empty")
 	}
+	if strings.TrimSpace(password) == "" && storageType == "postgres" && !update {
+		return fmt.Errorf("PostgreSQL password cannot be empty")
+	}
 	return nil
 }
 
@@ -174,6 +178,8 @@ func validateType(t string) error {
 		return nil
 	case "redis":
 		return nil
+	case "postgres":
+		return nil
 	}
 	return fmt.Errorf("unsupported storage service: %s", t)
 }
@@ -191,10 +197,26 @@ type DatabaseBackupParam struct {
 	LibraryID int64 `json:"libraryId" binding:"required"`
 }
 
+// DatabaseRestoreParam restores a backup. StopAt or StopGTID additionally
+// replays archived binary logs up to that point.
 type DatabaseRestoreParam struct {
-	LibraryID   int64  `json:"libraryId" binding:"required"`
-	BackupID    string `json:"backupId" binding:"required"`
-	ConfirmName string `json:"confirmName" binding:"required"`
+	LibraryID   int64      `json:"libraryId" binding:"required"`
+	BackupID    string     `json:"backupId" binding:"required"`
+	ConfirmName string     `json:"confirmName" binding:"required"`
+	StopAt      *time.Time `json:"stopAt"`
+	StopGTID    string     `json:"stopGtid"`
+}
+
+// DatabaseBackupScheduleParam configures scheduled backups of a database.
+// KeepDaily, KeepWeekly and KeepMonthly are how many daily, weekly and monthly
+// backups are retained.
+type DatabaseBackupScheduleParam struct {
+	Enabled         bool   `json:"enabled"`
+	Schedule        string `json:"schedule" binding:"required"`
+	KeepDaily       int    `json:"keepDaily"`
+	KeepWeekly      int    `json:"keepWeekly"`
+	KeepMonthly     int    `json:"keepMonthly"`
+	NotifyOnFailure bool   `json:"notifyOnFailure"`
 }
 
 type DeleteDatabaseBackupParam struct {
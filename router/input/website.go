@@ -20,6 +20,13 @@ type CertificateIssueParam struct {
 	AutoRenew       *bool  `json:"autoRenew"`
 	RenewBeforeDays int    `json:"renewBeforeDays"`
 	ForceHTTPS      bool   `json:"forceHttps"`
+	ChallengeType   string `json:"challengeType"`
+	DNSAccountID    string `json:"dnsAccountId"`
+	ACMEAccountID   string `json:"acmeAccountId"`
+}
+
+type CertificateRenewParam struct {
+	ACMEAccountID string `json:"acmeAccountId"`
 }
 
 type CertificateDisableParam struct {
@@ -50,3 +57,20 @@ type WebsiteStatusParam struct {
 type DeleteWebsiteBackupParam struct {
 	ConfirmName string `json:"confirmName"`
 }
+
+type WebsiteCanaryParam struct {
+	ReleaseID int64 `json:"releaseId"`
+	Percent   int   `json:"percent"`
+}
+
+type WebsitePHPVersionParam struct {
+	Version string `json:"version" binding:"required"`
+}
+
+type WebsiteIsolationParam struct {
+	Enabled bool `json:"enabled"`
+}
+
+type WebsiteAssignmentParam struct {
+	UserIDs []int64 `json:"userIds"`
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"time"
+
+	monitorservice "oneinstack/internal/services/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMetrics feeds the latency histogram exported on /metrics. The route
+// pattern, not the raw path, is recorded so IDs do not create new series.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+		monitorservice.ObserveHTTPRequest(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(started))
+	}
+}
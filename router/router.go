@@ -64,6 +64,7 @@ func SetupRouter() *gin.Engine {
 		SkipPaths: []string{
 			"/health/live",
 			"/health/ready",
+			"/metrics",
 			"/v1/log/runtime",
 			"/v1/log/runtime/stats",
 			"/v1/log/runtime/stream",
@@ -79,10 +80,12 @@ func SetupRouter() *gin.Engine {
 			)
 		},
 	}), gin.Recovery())
+	r.Use(middleware.RequestMetrics())
 
 	r.NoRoute(middleware.MidUiHandle)
 	r.GET("/health/live", health.Live)
 	r.GET("/health/ready", health.Ready)
+	r.GET("/metrics", middleware.RateLimitMiddleware(120, time.Minute), monitoringHandler.Exposition)
 	api := r.Group("/v1")
 
 	// 公共路由必须显式注册在受保护路由组之外。
@@ -99,6 +102,10 @@ func SetupRouter() *gin.Engine {
 			middleware.RateLimitMiddleware(30, time.Minute),
 			ftp.DownloadSharedFile,
 		)
+		api.POST("/public/website/:id/deploy-hook",
+			middleware.RateLimitMiddleware(30, time.Minute),
+			website.WebsiteDeployWebhook,
+		)
 	}
 
 	// 除上述白名单外，所有 API 默认要求认证、限流并记录审计日志。
@@ -119,6 +126,10 @@ func SetupRouter() *gin.Engine {
 		certificateg.GET("/dns-accounts", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.ListDNSAccounts)
 		certificateg.POST("/dns-accounts", middleware.RequirePermission(accessservice.PermissionCertificateWrite), certificateHandler.SaveDNSAccount)
 		certificateg.DELETE("/dns-accounts/:id", middleware.RequirePermission(accessservice.PermissionCertificateWrite), certificateHandler.DeleteDNSAccount)
+		certificateg.GET("/acme-providers", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.ListACMEProviders)
+		certificateg.GET("/acme-accounts", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.ListACMEAccounts)
+		certificateg.POST("/acme-accounts", middleware.RequirePermission(accessservice.PermissionCertificateWrite), certificateHandler.SaveACMEAccount)
+		certificateg.DELETE("/acme-accounts/:id", middleware.RequirePermission(accessservice.PermissionCertificateWrite), certificateHandler.DeleteACMEAccount)
 		certificateg.GET("/tasks", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.ListTasks)
 		certificateg.GET("/tasks/:id", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.GetTask)
 		certificateg.GET("/tasks/:id/log", middleware.RequirePermission(accessservice.PermissionCertificateRead), certificateHandler.GetTaskLog)
@@ -212,6 +223,16 @@ func SetupRouter() *gin.Engine {
 		sys.POST("/backups/:id/preflight", middleware.RequirePermission(accessservice.PermissionSystemRead), system.PreflightPanelBackup)
 		sys.POST("/backups/:id/restore", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.RestorePanelBackup)
 		sys.GET("/restore/status", middleware.RequirePermission(accessservice.PermissionSystemRead), system.GetPanelRestoreStatus)
+		sys.GET("/remote-backups/targets", middleware.RequirePermission(accessservice.PermissionSystemRead), system.ListRemoteBackupTargets)
+		sys.POST("/remote-backups/targets", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.CreateRemoteBackupTarget)
+		sys.POST("/remote-backups/targets/:id/update", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.UpdateRemoteBackupTarget)
+		sys.POST("/remote-backups/targets/:id/delete", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.DeleteRemoteBackupTarget)
+		sys.POST("/remote-backups/targets/:id/test", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.TestRemoteBackupTarget)
+		sys.POST("/remote-backups/targets/:id/sync", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.SyncRemoteBackupTarget)
+		sys.GET("/remote-backups/targets/:id/backups", middleware.RequirePermission(accessservice.PermissionSystemRead), system.ListRemoteBackups)
+		sys.POST("/remote-backups/targets/:id/upload", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.UploadRemoteBackup)
+		sys.POST("/remote-backups/targets/:id/restore", middleware.RequirePermission(accessservice.PermissionSystemWrite), system.RestoreRemoteBackup)
+		sys.GET("/remote-backups/transfers", middleware.RequirePermission(accessservice.PermissionSystemRead), system.ListRemoteBackupTransfers)
 		sys.POST("/updatesystemtitle", system.UpdateSystemTitle)
 
 		//备注相关
@@ -252,10 +273,17 @@ func SetupRouter() *gin.Engine {
 		storageg.POST("/liblist", middleware.RequirePermission("database.read"), storage.GetLib)
 		storageg.POST("/rklist", middleware.RequirePermission("database.read"), storage.GetRedisKeys)
 		storageg.POST("/info", middleware.RequirePermission("database.read"), storage.Info)
+		storageg.GET("/connections/:id/mysql-accounts", middleware.RequirePermission("database.read"), storage.ListMySQLAccounts)
 		storageg.POST("/backups", middleware.RequirePermission("database.write"), storage.CreateDatabaseBackup)
 		storageg.GET("/backups", middleware.RequirePermission("database.read"), storage.ListDatabaseBackups)
 		storageg.GET("/backups/:id/download", middleware.RequirePermission("database.read"), storage.DownloadDatabaseBackup)
+		storageg.GET("/backups/:id/recovery-window", middleware.RequirePermission("database.read"), storage.GetDatabaseBackupRecoveryWindow)
 		storageg.POST("/backups/:id/delete", middleware.RequirePermission("database.write"), storage.DeleteDatabaseBackup)
+		storageg.GET("/backup-schedules", middleware.RequirePermission("database.read"), storage.ListDatabaseBackupSchedules)
+		storageg.GET("/libraries/:id/backup-schedule", middleware.RequirePermission("database.read"), storage.GetDatabaseBackupSchedule)
+		storageg.POST("/libraries/:id/backup-schedule", middleware.RequirePermission("database.write"), storage.SaveDatabaseBackupSchedule)
+		storageg.POST("/libraries/:id/backup-schedule/delete",
+			middleware.RequirePermission("database.write"), storage.DeleteDatabaseBackupSchedule)
 		storageg.POST("/restores", middleware.RequirePermission("database.write"), storage.RestoreDatabaseBackup)
 		storageg.GET("/tasks", middleware.RequirePermission("database.read"), storage.ListDatabaseTasks)
 		storageg.GET("/tasks/:id", middleware.RequirePermission("database.read"), storage.GetDatabaseTask)
@@ -368,10 +396,33 @@ func SetupRouter() *gin.Engine {
 		websiteg.POST("/:id/status", middleware.RequirePermission("website.write"), website.SetStatus)
 		websiteg.GET("/:id/settings", middleware.RequirePermission("website.read"), website.GetWebsiteSettings)
 		websiteg.PUT("/:id/settings", middleware.RequirePermission("website.write"), website.UpdateWebsiteSettings)
+		websiteg.GET("/:id/backends", middleware.RequirePermission("website.read"), website.GetWebsiteBackendHealth)
+		websiteg.GET("/:id/analytics", middleware.RequirePermission("website.read"), website.GetWebsiteAnalytics)
+		websiteg.GET("/:id/analytics/hourly", middleware.RequirePermission("website.read"), website.GetWebsiteAnalyticsHourly)
+		websiteg.GET("/:id/analytics/top/:dimension", middleware.RequirePermission("website.read"), website.GetWebsiteAnalyticsTop)
+		websiteg.GET("/:id/waf/hits", middleware.RequirePermission("website.read"), website.GetWebsiteWAFHits)
+		websiteg.GET("/:id/releases", middleware.RequirePermission("website.read"), website.ListWebsiteReleases)
+		websiteg.POST("/:id/releases", middleware.RequirePermission("website.write"), website.CreateWebsiteRelease)
+		websiteg.POST("/:id/releases/rollback", middleware.RequirePermission("website.write"), website.RollbackWebsiteRelease)
+		websiteg.POST("/:id/releases/:releaseId/activate", middleware.RequirePermission("website.write"), website.ActivateWebsiteRelease)
+		websiteg.PUT("/:id/canary", middleware.RequirePermission("website.write"), website.UpdateWebsiteCanary)
+		websiteg.PUT("/:id/php-version", middleware.RequirePermission("website.write"), website.SwitchWebsitePHPVersion)
+		websiteg.PUT("/:id/isolation", middleware.RequirePermission("website.write"), website.SetWebsiteIsolation)
+		websiteg.GET("/:id/assignments", middleware.RequireSuperAdmin(), website.GetWebsiteAssignments)
+		websiteg.PUT("/:id/assignments", middleware.RequireSuperAdmin(), website.UpdateWebsiteAssignments)
+		websiteg.GET("/:id/deploy-source", middleware.RequirePermission("website.read"), website.GetWebsiteDeploySource)
+		websiteg.PUT("/:id/deploy-source", middleware.RequirePermission("website.write"), website.SaveWebsiteDeploySource)
+		websiteg.DELETE("/:id/deploy-source", middleware.RequirePermission("website.write"), website.DeleteWebsiteDeploySource)
+		websiteg.POST("/:id/deploy", middleware.RequirePermission("website.write"), website.DeployWebsite)
+		websiteg.POST("/:id/clone", middleware.RequirePermission("website.write"), website.CloneWebsite)
+		websiteg.GET("/:id/staging", middleware.RequirePermission("website.read"), website.GetWebsiteStaging)
+		websiteg.POST("/:id/staging/push", middleware.RequirePermission("website.write"), website.PushWebsiteStaging)
 		websiteg.GET("/:id/log", middleware.RequirePermission("website.read"), website.GetWebsiteLog)
 		websiteg.GET("/:id/config", middleware.RequirePermission("website.read"), website.GetWebsiteManagedConfig)
 		websiteg.PUT("/:id/config", middleware.RequirePermission("website.write"), website.UpdateWebsiteManagedConfig)
 		websiteg.POST("/info", middleware.RequirePermission("website.read"), website.Info)
+		websiteg.GET("/waf/rules", middleware.RequirePermission("website.read"), website.ListWebsiteWAFRules)
+		websiteg.GET("/php/runtimes", middleware.RequirePermission("website.read"), website.ListPHPRuntimes)
 		websiteg.GET("/web-server", middleware.RequirePermission("website.read"), website.GetWebServerStatus)
 		websiteg.GET("/web-server/configs", middleware.RequirePermission("website.read"), website.ListWebServerConfigs)
 		websiteg.GET("/web-server/config", middleware.RequirePermission("website.read"), website.GetWebServerConfig)
@@ -456,6 +507,8 @@ func SetupRouter() *gin.Engine {
 		monitoringg.POST("/services/:component/silence", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.SilenceServiceHealth)
 		monitoringg.GET("/metrics", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.Metrics)
 		monitoringg.GET("/history", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.History)
+		monitoringg.GET("/series", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.Series)
+		monitoringg.GET("/series/history", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.SeriesHistory)
 		monitoringg.GET("/rules", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.ListRules)
 		monitoringg.POST("/rules", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.CreateRule)
 		monitoringg.PUT("/rules/:id", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.UpdateRule)
@@ -464,6 +517,14 @@ func SetupRouter() *gin.Engine {
 		monitoringg.POST("/rules/:id/delete", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.DeleteRule)
 		monitoringg.POST("/rules/:id/silence", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.SilenceRule)
 		monitoringg.GET("/events", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.Events)
+		monitoringg.POST("/events/:id/acknowledge", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.AcknowledgeEvent)
+		monitoringg.POST("/events/:id/unacknowledge", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.UnacknowledgeEvent)
+		monitoringg.GET("/escalation-policies", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.ListEscalationPolicies)
+		monitoringg.POST("/escalation-policies", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.CreateEscalationPolicy)
+		monitoringg.PUT("/escalation-policies/:id", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.UpdateEscalationPolicy)
+		monitoringg.DELETE("/escalation-policies/:id", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.DeleteEscalationPolicy)
+		monitoringg.POST("/escalation-policies/:id/update", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.UpdateEscalationPolicy)
+		monitoringg.POST("/escalation-policies/:id/delete", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.DeleteEscalationPolicy)
 		monitoringg.GET("/deliveries", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.Deliveries)
 		monitoringg.GET("/channels", middleware.RequirePermission(accessservice.PermissionMonitoringRead), monitoringHandler.ListChannels)
 		monitoringg.POST("/channels", middleware.RequirePermission(accessservice.PermissionMonitoringWrite), monitoringHandler.CreateChannel)
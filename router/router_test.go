@@ -15,6 +15,7 @@ import (
 	"oneinstack/app"
 	"oneinstack/internal/crypto"
 	"oneinstack/internal/models"
+	accessservice "oneinstack/internal/services/access"
 	auditservice "oneinstack/internal/services/audit"
 	logservice "oneinstack/internal/services/log"
 	securityservice "oneinstack/internal/services/security"
@@ -23,10 +24,11 @@ import (
 )
 
 var publicRoutes = map[string]struct{}{
-	http.MethodPost + " /v1/login":                     {},
-	http.MethodGet + " /v1/panel-entry/status":         {},
-	http.MethodGet + " /v1/sys/getbaseinfo":            {},
-	http.MethodGet + " /v1/public/file-share/download": {},
+	http.MethodPost + " /v1/login":                          {},
+	http.MethodGet + " /v1/panel-entry/status":              {},
+	http.MethodGet + " /v1/sys/getbaseinfo":                 {},
+	http.MethodGet + " /v1/public/file-share/download":      {},
+	http.MethodPost + " /v1/public/website/:id/deploy-hook": {},
 }
 
 func TestMain(m *testing.M) {
@@ -317,6 +319,40 @@ func TestStorageRoutesRequireAdministratorRole(t *testing.T) {
 	}
 }
 
+func TestWebsiteAssignmentRoutesRequireSuperAdministrator(t *testing.T) {
+	const userID int64 = 913
+	if err := app.DB().Save(&models.User{
+		ID:       userID,
+		Username: "website-operator",
+		Password: "existing-password-hash",
+		IsAdmin:  false,
+	}).Error; err != nil {
+		t.Fatalf("save non-admin user: %v", err)
+	}
+	if err := accessservice.NewService(app.DB()).AssignRoles(userID, []string{accessservice.RoleWebsiteAdmin}); err != nil {
+		t.Fatalf("assign website role: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = app.DB().Delete(&models.UserRole{}, "user_id = ?", userID).Error
+		_ = app.DB().Delete(&models.User{}, userID).Error
+	})
+
+	token := testTokenForUser(t, "website-operator", userID)
+	router := SetupRouter()
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req := httptest.NewRequest(method, "/v1/website/1/assignments", strings.NewReader(`{"userIds":[913]}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), `"code":1202`) {
+			t.Fatalf("%s assignments: status=%d body=%s", method, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
 func TestSoftwareServiceRoutesRequireAdministratorRole(t *testing.T) {
 	const userID int64 = 912
 	if err := app.DB().Save(&models.User{
@@ -950,3 +986,43 @@ func saveTestUser(t *testing.T, username, password string) {
 		t.Fatalf("save test user: %v", err)
 	}
 }
+
+func TestMetricsExpositionRequiresConfiguredToken(t *testing.T) {
+	previous := app.ONE_CONFIG.System.MetricsToken
+	t.Cleanup(func() { app.ONE_CONFIG.System.MetricsToken = previous })
+	router := SetupRouter()
+	scrape := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = "192.0.2.250:1234"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	app.ONE_CONFIG.System.MetricsToken = ""
+	if recorder := scrape("Bearer anything"); recorder.Code != http.StatusNotFound {
+		t.Fatalf("disabled exporter status = %d", recorder.Code)
+	}
+	app.ONE_CONFIG.System.MetricsToken = strings.Repeat("m", 40)
+	if recorder := scrape("Bearer " + strings.Repeat("x", 40)); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token status = %d", recorder.Code)
+	}
+	// The rejected scrape above is itself observed, so the histogram has data.
+	recorder := scrape("Bearer " + strings.Repeat("m", 40))
+	if recorder.Code != http.StatusOK ||
+		!strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("scrape status = %d, content type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE oneinstack_http_request_duration_seconds histogram",
+		`oneinstack_http_request_duration_seconds_bucket{method="GET",route="/metrics",status="4xx",le="+Inf"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("exposition is missing %q:\n%s", want, body)
+		}
+	}
+}
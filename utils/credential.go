@@ -26,6 +26,11 @@ const (
 	CredentialPurposeBastionPassword  = "bastion.password"
 	CredentialPurposeRegistryPassword = "container.registry.password"
 	CredentialPurposeCertificateDNS   = "certificate.dns"
+	CredentialPurposeCertificateACME  = "certificate.acme"
+	CredentialPurposeWebsiteDeployKey = "website.deploy.key"
+	CredentialPurposeWebsiteWebhook   = "website.deploy.webhook"
+	CredentialPurposeRemoteBackup     = "remote-backup.secret"
+	CredentialPurposeRemotePassphrase = "remote-backup.passphrase"
 )
 
 var (
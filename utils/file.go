@@ -5,6 +5,8 @@ import (
 	"archive/zip"
 	"bufio"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
@@ -136,6 +138,37 @@ func DownloadFile(url string, destPath string) error {
 	return nil
 }
 
+// CopyVerifiedFile 经由 destination.partial 复制文件，仅当内容的 SHA-256 与
+// checksum 一致时才重命名为 destination，否则删除临时文件并返回错误
+func CopyVerifiedFile(source, destination, checksum string) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	partial := destination + ".partial"
+	output, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(output, hash), input)
+	if syncErr := output.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), checksum) {
+		err = errors.New("copied file does not match its checksum")
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, destination)
+}
+
 // SetExecPermissions 设置指定目录及其子目录下所有文件的执行权限
 func SetExecPermissions(dir string) error {
 	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {